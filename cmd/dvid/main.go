@@ -1,5 +1,5 @@
 // Command-line interface to a remote DVID server.
-// Provides essential commands on top of core http server: init, serve, repair.
+// Provides essential commands on top of core http server: init, serve, repair, restore.
 
 package main
 
@@ -32,6 +32,7 @@ import (
 	_ "github.com/janelia-flyem/dvid/datatype/keyvalue"
 	_ "github.com/janelia-flyem/dvid/datatype/labelarray"
 	_ "github.com/janelia-flyem/dvid/datatype/labelblk"
+	_ "github.com/janelia-flyem/dvid/datatype/labelgraph"
 	_ "github.com/janelia-flyem/dvid/datatype/labelmap"
 	_ "github.com/janelia-flyem/dvid/datatype/labelsz"
 	_ "github.com/janelia-flyem/dvid/datatype/labelvol"
@@ -101,6 +102,12 @@ Commands that can be performed without a running server:
     help
     serve  <configuration path>
 
+    restore <configuration path> <backup path>
+
+        Rebuilds metadata and data instances from a backup directory or tar archive
+        made by the "backup" command or POST /api/server/backup.  The stores in the
+        configuration must not hold any repos.
+
 For storage engines that have repair ability (e.g., basholeveldb):
 
     repair <engine name> <database path>
@@ -229,6 +236,8 @@ func DoCommand(cmd dvid.Command) error {
 		return DoServe(cmd)
 	case "repair":
 		return DoRepair(cmd)
+	case "restore":
+		return DoRestore(cmd)
 	case "about":
 		fmt.Println(server.About())
 	// Send everything else to server via DVID terminal
@@ -260,6 +269,57 @@ func DoRepair(cmd dvid.Command) error {
 	return nil
 }
 
+// DoRestore performs the "restore" command, rebuilding an empty datastore from a backup.
+func DoRestore(cmd dvid.Command) error {
+	configPath := cmd.Argument(1)
+	archivePath := cmd.Argument(2)
+	if archivePath == "" {
+		return fmt.Errorf("restore command must be followed by the path to the TOML configuration file and the backup path")
+	}
+	if err := openDatastore(cmd, configPath); err != nil {
+		return err
+	}
+	err := datastore.RestoreBackup(archivePath, server.DatastoreConfig())
+	datastore.Shutdown()
+	storage.Shutdown()
+	if err != nil {
+		return fmt.Errorf("unable to restore from backup %q: %v", archivePath, err)
+	}
+	fmt.Printf("Restored datastore from backup %q.\n", archivePath)
+	return nil
+}
+
+// openDatastore loads the server configuration and initializes the storage and
+// datastore layers.
+func openDatastore(cmd dvid.Command, configPath string) error {
+	if err := server.LoadConfig(configPath); err != nil {
+		return fmt.Errorf("error loading configuration file %q: %v", configPath, err)
+	}
+
+	if err := server.Initialize(); err != nil {
+		return err
+	}
+
+	// Initialize storage and datastore layer
+	backend, err := server.InitBackend()
+	if err != nil {
+		return err
+	}
+	datatypes := make(map[dvid.TypeString]struct{})
+	for _, t := range datastore.Compiled {
+		datatypes[t.GetTypeName()] = struct{}{}
+	}
+	initMetadata, err := storage.Initialize(cmd.Settings(), backend, datatypes)
+	if err != nil {
+		return fmt.Errorf("unable to initialize storage: %v", err)
+	}
+
+	if err := datastore.Initialize(initMetadata, server.DatastoreConfig()); err != nil {
+		return fmt.Errorf("unable to initialize datastore: %v", err)
+	}
+	return nil
+}
+
 // DoServe opens a datastore then creates both web and rpc servers for the datastore
 func DoServe(cmd dvid.Command) error {
 	// Capture ctrl+c and other interrupts.  Then handle graceful shutdown.
@@ -292,32 +352,10 @@ func DoServe(cmd dvid.Command) error {
 	if configPath == "" {
 		return fmt.Errorf("serve command must be followed by the path to the TOML configuration file")
 	}
-	if err := server.LoadConfig(configPath); err != nil {
-		return fmt.Errorf("error loading configuration file %q: %v", configPath, err)
-	}
-
-	if err := server.Initialize(); err != nil {
+	if err := openDatastore(cmd, configPath); err != nil {
 		return err
 	}
 
-	// Initialize storage and datastore layer
-	backend, err := server.InitBackend()
-	if err != nil {
-		return err
-	}
-	datatypes := make(map[dvid.TypeString]struct{})
-	for _, t := range datastore.Compiled {
-		datatypes[t.GetTypeName()] = struct{}{}
-	}
-	initMetadata, err := storage.Initialize(cmd.Settings(), backend, datatypes)
-	if err != nil {
-		return fmt.Errorf("unable to initialize storage: %v", err)
-	}
-
-	if err := datastore.Initialize(initMetadata, server.DatastoreConfig()); err != nil {
-		return fmt.Errorf("unable to initialize datastore: %v", err)
-	}
-
 	// add handlers to help us track memory usage - they don't track memory until they're told to
 	profiler.AddMemoryProfilingHandlers()
 
@@ -0,0 +1,787 @@
+// +build !clustered,!gcloud
+
+/*
+	This file contains local server code supporting online backup of metadata and data
+	instances to a directory or tar archive, and restoration of a store from that backup.
+*/
+
+package datastore
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+const backupManifestName = "manifest.json"
+
+// backupPartSize is the approximate maximum number of bytes in each part file of a backup.
+var backupPartSize = 64 * dvid.Mega
+
+// BackupConfig specifies the destination and contents of an online backup.
+type BackupConfig struct {
+	// Path is a directory or, if it ends with ".tar", a tar archive.
+	Path string `json:"path"`
+
+	// UUID and Instances select the data instances to backup.  If no instances are
+	// given, all data instances in all repos are backed up.
+	UUID      dvid.UUID          `json:"uuid,omitempty"`
+	Instances dvid.InstanceNames `json:"instances,omitempty"`
+}
+
+// BackupInstance describes the backup of a data instance.
+type BackupInstance struct {
+	Name     dvid.InstanceName
+	DataUUID dvid.UUID
+	TypeName dvid.TypeString
+	Parts    []string
+	NumKV    uint64
+}
+
+// BackupBlobs describes the backup of blobs from a store shared by the given data instances.
+type BackupBlobs struct {
+	DataUUIDs []dvid.UUID
+	Parts     []string
+	NumKV     uint64
+}
+
+// BackupManifest is written last into a backup and describes its contents.  Metadata
+// is always backed up in full, even if only some data instances are selected.
+type BackupManifest struct {
+	Created       time.Time
+	MetadataParts []string
+	MetadataNumKV uint64
+	Instances     []BackupInstance
+	Blobs         []BackupBlobs
+	NumKV         uint64
+	Bytes         uint64
+}
+
+// BackupStatus gives the progress of the last requested backup.
+type BackupStatus struct {
+	Running  bool
+	Path     string
+	Started  time.Time
+	Finished time.Time
+	NumKV    uint64
+	Bytes    uint64
+	Error    string `json:",omitempty"`
+}
+
+var (
+	backupStatus   BackupStatus
+	backupStatusMu sync.RWMutex
+)
+
+// GetBackupStatus returns the status of the currently running or last finished backup.
+func GetBackupStatus() BackupStatus {
+	backupStatusMu.RLock()
+	defer backupStatusMu.RUnlock()
+	return backupStatus
+}
+
+func backupProgress(numKV, numBytes uint64) {
+	backupStatusMu.Lock()
+	backupStatus.NumKV += numKV
+	backupStatus.Bytes += numBytes
+	backupStatusMu.Unlock()
+}
+
+// StartBackup begins a backup in the background.  Only one backup can run at a time,
+// and its progress can be checked using GetBackupStatus().
+func StartBackup(cfg BackupConfig) error {
+	if err := beginBackup(cfg.Path); err != nil {
+		return err
+	}
+	go func() {
+		manifest, err := runBackup(cfg)
+		endBackup(err)
+		if err != nil {
+			dvid.Errorf("Backup to %q failed: %v\n", cfg.Path, err)
+		} else {
+			dvid.Infof("Backup to %q finished: %d key-value pairs, %d bytes\n", cfg.Path, manifest.NumKV, manifest.Bytes)
+		}
+	}()
+	return nil
+}
+
+// Backup writes a backup of metadata and the selected data instances to a directory or tar
+// archive, returning when finished.  All metadata and data are backed up at the same point
+// in time, so mutations are suspended while snapshots of the stores are taken or, for stores
+// without snapshot support, for the duration of the backup.
+func Backup(cfg BackupConfig) (*BackupManifest, error) {
+	if err := beginBackup(cfg.Path); err != nil {
+		return nil, err
+	}
+	manifest, err := runBackup(cfg)
+	endBackup(err)
+	return manifest, err
+}
+
+func beginBackup(path string) error {
+	if path == "" {
+		return fmt.Errorf("backup requires a destination path")
+	}
+	backupStatusMu.Lock()
+	defer backupStatusMu.Unlock()
+	if backupStatus.Running {
+		return fmt.Errorf("backup to %q is already running", backupStatus.Path)
+	}
+	backupStatus = BackupStatus{Running: true, Path: path, Started: time.Now()}
+	return nil
+}
+
+func endBackup(err error) {
+	backupStatusMu.Lock()
+	backupStatus.Running = false
+	backupStatus.Finished = time.Now()
+	if err != nil {
+		backupStatus.Error = err.Error()
+	}
+	backupStatusMu.Unlock()
+}
+
+// getBackupData returns the data instances selected by the backup configuration.
+func getBackupData(cfg BackupConfig) ([]DataService, error) {
+	if manager == nil {
+		return nil, ErrManagerNotInitialized
+	}
+	var dataservices []DataService
+	if len(cfg.Instances) == 0 {
+		manager.idMutex.RLock()
+		for _, d := range manager.iids {
+			if !d.IsDeleted() {
+				dataservices = append(dataservices, d)
+			}
+		}
+		manager.idMutex.RUnlock()
+		return dataservices, nil
+	}
+	if cfg.UUID == "" {
+		return nil, fmt.Errorf("backup of selected instances requires a UUID")
+	}
+	for _, name := range cfg.Instances {
+		d, err := GetDataByUUIDName(cfg.UUID, name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to backup data %q: %v", name, err)
+		}
+		dataservices = append(dataservices, d)
+	}
+	return dataservices, nil
+}
+
+// suspendMutations waits for running mutating requests and merge jobs to finish and refuses
+// new ones until the returned function is called.  It also waits until no data instance is
+// handling syncs or other updates so the stores are unchanging while suspended.
+func suspendMutations() (resume func()) {
+	mutationGate.Lock()
+	manager.idMutex.RLock()
+	dataservices := make([]DataService, 0, len(manager.iids))
+	for _, d := range manager.iids {
+		dataservices = append(dataservices, d)
+	}
+	manager.idMutex.RUnlock()
+	for _, d := range dataservices {
+		syncer, isSyncer := d.(Syncer)
+		updater, isUpdater := d.(dataUpdater)
+		for (isSyncer && syncer.SyncPending()) || (isUpdater && updater.Updating()) {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	return mutationGate.Unlock
+}
+
+// backupSource is a store or a point-in-time view of a store that can be backed up.
+type backupSource interface {
+	RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out chan *storage.KeyValue, cancel <-chan struct{}) error
+}
+
+// backupViews holds the sources read for each store during a backup.
+type backupViews struct {
+	sources   map[dvid.Store]backupSource
+	snapshots []storage.RawSnapshot
+}
+
+// newBackupViews takes point-in-time snapshots of the given stores if they support them.
+// If every store has a snapshot, complete is true and mutations can resume during the backup.
+func newBackupViews(stores []storage.OrderedKeyValueDB) (views *backupViews, complete bool, err error) {
+	views = &backupViews{sources: make(map[dvid.Store]backupSource, len(stores))}
+	complete = true
+	for _, db := range stores {
+		if _, found := views.sources[db]; found {
+			continue
+		}
+		snapshotter, ok := db.(storage.RawSnapshotter)
+		if !ok {
+			views.sources[db] = db
+			complete = false
+			continue
+		}
+		snap, err := snapshotter.NewRawSnapshot()
+		if err != nil {
+			views.release()
+			return nil, false, fmt.Errorf("unable to snapshot store %s: %v", db, err)
+		}
+		views.sources[db] = snap
+		views.snapshots = append(views.snapshots, snap)
+	}
+	return views, complete, nil
+}
+
+func (views *backupViews) source(db storage.OrderedKeyValueDB) backupSource {
+	if src, found := views.sources[db]; found {
+		return src
+	}
+	return db
+}
+
+func (views *backupViews) release() {
+	for _, snap := range views.snapshots {
+		snap.Release()
+	}
+	views.snapshots = nil
+}
+
+// runBackup suspends mutations while taking snapshots of the stores to backup.  If all stores
+// support snapshots, mutations resume while the snapshots are written.  Otherwise mutations
+// stay suspended until the backup is finished so it reflects a single point in time.
+func runBackup(cfg BackupConfig) (*BackupManifest, error) {
+	if manager == nil {
+		return nil, ErrManagerNotInitialized
+	}
+	resume := suspendMutations()
+	defer func() {
+		if resume != nil {
+			resume()
+		}
+	}()
+
+	dataservices, err := getBackupData(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metadb, err := storage.MetaDataKVStore()
+	if err != nil {
+		return nil, err
+	}
+	stores := []storage.OrderedKeyValueDB{metadb}
+	for _, d := range dataservices {
+		db, err := GetOrderedKeyValueDB(d)
+		if err != nil {
+			return nil, fmt.Errorf("unable to backup data %q: %v", d.DataName(), err)
+		}
+		stores = append(stores, db)
+	}
+	views, complete, err := newBackupViews(stores)
+	if err != nil {
+		return nil, err
+	}
+	defer views.release()
+	if complete {
+		resume()
+		resume = nil
+		dvid.Infof("Resumed mutations after taking snapshots for backup to %q\n", cfg.Path)
+	}
+
+	aw, err := newArchiveWriter(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &BackupManifest{Created: time.Now()}
+	if err = writeBackup(aw, manifest, views, metadb, dataservices); err != nil {
+		aw.close()
+		return nil, err
+	}
+	if err = aw.close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func writeBackup(aw archiveWriter, manifest *BackupManifest, views *backupViews, metadb storage.OrderedKeyValueDB, dataservices []DataService) error {
+	pw := &backupPartWriter{aw: aw, prefix: "metadata"}
+	begKey, endKey := storage.MetadataContext{}.KeyRange()
+	if err := pw.writeRange(views.source(metadb), begKey, endKey); err != nil {
+		return fmt.Errorf("unable to backup metadata: %v", err)
+	}
+	manifest.MetadataParts, manifest.MetadataNumKV = pw.parts, pw.numKV
+	manifest.NumKV, manifest.Bytes = pw.numKV, pw.numBytes
+	dvid.Infof("Backed up %d metadata key-value pairs\n", pw.numKV)
+
+	blobStores := make(map[dvid.Store]int)
+	for _, d := range dataservices {
+		db, err := GetOrderedKeyValueDB(d)
+		if err != nil {
+			return fmt.Errorf("unable to backup data %q: %v", d.DataName(), err)
+		}
+		pw = &backupPartWriter{aw: aw, prefix: "data-" + string(d.DataUUID())}
+		begKey, endKey := storage.DataInstanceKeyRange(d.InstanceID())
+		if err := pw.writeRange(views.source(db), begKey, endKey); err != nil {
+			return fmt.Errorf("unable to backup data %q: %v", d.DataName(), err)
+		}
+		manifest.Instances = append(manifest.Instances, BackupInstance{
+			Name:     d.DataName(),
+			DataUUID: d.DataUUID(),
+			TypeName: d.TypeName(),
+			Parts:    pw.parts,
+			NumKV:    pw.numKV,
+		})
+		manifest.NumKV += pw.numKV
+		manifest.Bytes += pw.numBytes
+		dvid.Infof("Backed up %d key-value pairs for data %q\n", pw.numKV, d.DataName())
+
+		if i, found := blobStores[db]; found {
+			manifest.Blobs[i].DataUUIDs = append(manifest.Blobs[i].DataUUIDs, d.DataUUID())
+			continue
+		}
+		pw = &backupPartWriter{aw: aw, prefix: "blobs-" + string(d.DataUUID())}
+		// blob keys are content hashes, so a key of max bytes follows all of them.
+		begKey, endKey = storage.ConstructBlobKey(nil), storage.ConstructBlobKey(bytes.Repeat([]byte{0xFF}, 64))
+		if err := pw.writeRange(views.source(db), begKey, endKey); err != nil {
+			return fmt.Errorf("unable to backup blobs for data %q: %v", d.DataName(), err)
+		}
+		blobStores[db] = len(manifest.Blobs)
+		manifest.Blobs = append(manifest.Blobs, BackupBlobs{
+			DataUUIDs: []dvid.UUID{d.DataUUID()},
+			Parts:     pw.parts,
+			NumKV:     pw.numKV,
+		})
+		manifest.NumKV += pw.numKV
+		manifest.Bytes += pw.numBytes
+	}
+
+	jsonBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return aw.writeFile(backupManifestName, jsonBytes)
+}
+
+// backupPartWriter writes key-value pairs into a sequence of part files, each holding
+// records of uvarint key length, key, uvarint value length, and value.
+type backupPartWriter struct {
+	aw       archiveWriter
+	prefix   string
+	buf      bytes.Buffer
+	parts    []string
+	numKV    uint64
+	numBytes uint64
+}
+
+func (pw *backupPartWriter) add(k, v []byte) error {
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(k)))
+	pw.buf.Write(lenBuf[:n])
+	pw.buf.Write(k)
+	n = binary.PutUvarint(lenBuf[:], uint64(len(v)))
+	pw.buf.Write(lenBuf[:n])
+	pw.buf.Write(v)
+	pw.numKV++
+	pw.numBytes += uint64(len(k) + len(v))
+	if pw.buf.Len() >= backupPartSize {
+		return pw.flush()
+	}
+	return nil
+}
+
+func (pw *backupPartWriter) flush() error {
+	if pw.buf.Len() == 0 {
+		return nil
+	}
+	name := fmt.Sprintf("%s-%05d.kv", pw.prefix, len(pw.parts))
+	if err := pw.aw.writeFile(name, pw.buf.Bytes()); err != nil {
+		return err
+	}
+	pw.parts = append(pw.parts, name)
+	pw.buf.Reset()
+	return nil
+}
+
+// writeRange writes all key-value pairs in the range, which is read from a single
+// range query and therefore from a consistent view of the store.
+func (pw *backupPartWriter) writeRange(db backupSource, begKey, endKey storage.Key) error {
+	ch := make(chan *storage.KeyValue)
+	cancel := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- db.RawRangeQuery(begKey, endKey, false, ch, cancel)
+	}()
+	var lastKV, lastBytes uint64
+	for {
+		select {
+		case kv := <-ch:
+			if kv == nil {
+				if err := <-errCh; err != nil {
+					return err
+				}
+				backupProgress(pw.numKV-lastKV, pw.numBytes-lastBytes)
+				return pw.flush()
+			}
+			if err := pw.add(kv.K, kv.V); err != nil {
+				close(cancel)
+				<-errCh
+				return err
+			}
+			if pw.numKV-lastKV >= 10000 {
+				backupProgress(pw.numKV-lastKV, pw.numBytes-lastBytes)
+				lastKV, lastBytes = pw.numKV, pw.numBytes
+			}
+		case err := <-errCh:
+			if err == nil {
+				err = fmt.Errorf("range query ended before completion")
+			}
+			return err
+		}
+	}
+}
+
+// archiveWriter writes named files into a backup directory or tar archive.
+type archiveWriter interface {
+	writeFile(name string, data []byte) error
+	close() error
+}
+
+func newArchiveWriter(path string) (archiveWriter, error) {
+	if strings.HasSuffix(path, ".tar") {
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("backup archive %q already exists", path)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		return &tarArchiveWriter{f: f, tw: tar.NewWriter(f)}, nil
+	}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(path, backupManifestName)); err == nil {
+		return nil, fmt.Errorf("backup directory %q already holds a backup", path)
+	}
+	return dirArchiveWriter(path), nil
+}
+
+type dirArchiveWriter string
+
+func (dir dirArchiveWriter) writeFile(name string, data []byte) error {
+	return ioutil.WriteFile(filepath.Join(string(dir), name), data, 0644)
+}
+
+func (dir dirArchiveWriter) close() error {
+	return nil
+}
+
+type tarArchiveWriter struct {
+	f  *os.File
+	tw *tar.Writer
+}
+
+func (aw *tarArchiveWriter) writeFile(name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := aw.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := aw.tw.Write(data)
+	return err
+}
+
+func (aw *tarArchiveWriter) close() error {
+	err := aw.tw.Close()
+	if cerr := aw.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// archiveReader opens named files from a backup directory or tar archive.
+type archiveReader interface {
+	open(name string) (io.ReadCloser, error)
+	close() error
+}
+
+func newArchiveReader(path string) (archiveReader, error) {
+	if !strings.HasSuffix(path, ".tar") {
+		return dirArchiveReader(path), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	ar := &tarArchiveReader{f: f, entries: make(map[string]*io.SectionReader)}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("bad backup archive %q: %v", path, err)
+		}
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		ar.entries[hdr.Name] = io.NewSectionReader(f, offset, hdr.Size)
+	}
+	return ar, nil
+}
+
+type dirArchiveReader string
+
+func (dir dirArchiveReader) open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(dir), name))
+}
+
+func (dir dirArchiveReader) close() error {
+	return nil
+}
+
+type tarArchiveReader struct {
+	f       *os.File
+	entries map[string]*io.SectionReader
+}
+
+func (ar *tarArchiveReader) open(name string) (io.ReadCloser, error) {
+	sr, found := ar.entries[name]
+	if !found {
+		return nil, fmt.Errorf("file %q not found in backup archive", name)
+	}
+	return ioutil.NopCloser(io.NewSectionReader(sr, 0, sr.Size())), nil
+}
+
+func (ar *tarArchiveReader) close() error {
+	return ar.f.Close()
+}
+
+// restoreParts stores all key-value pairs from the given part files.
+func restoreParts(ar archiveReader, parts []string, db storage.KeyValueDB) (numKV uint64, err error) {
+	for _, name := range parts {
+		var rc io.ReadCloser
+		if rc, err = ar.open(name); err != nil {
+			return
+		}
+		r := bufio.NewReader(rc)
+		for {
+			var k, v []byte
+			if k, err = readBackupBytes(r); err == io.EOF {
+				err = nil
+				break
+			}
+			if err == nil {
+				v, err = readBackupBytes(r)
+			}
+			if err == nil {
+				err = db.RawPut(k, v)
+			}
+			if err != nil {
+				rc.Close()
+				return numKV, fmt.Errorf("error restoring %q: %v", name, err)
+			}
+			numKV++
+		}
+		rc.Close()
+	}
+	return
+}
+
+func readBackupBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// RestoreBackup rebuilds metadata and the backed up data instances from a backup directory
+// or tar archive.  The datastore must be initialized and hold no repos.  Data instances are
+// assigned to stores using the current storage configuration.  Data instances that weren't
+// selected for the backup are removed from the restored metadata.
+func RestoreBackup(path string, iconfig Config) error {
+	if manager == nil {
+		return ErrManagerNotInitialized
+	}
+	manager.repoMutex.RLock()
+	numRepos := len(manager.repos)
+	manager.repoMutex.RUnlock()
+	if numRepos != 0 {
+		return fmt.Errorf("restore requires an empty datastore, yet it has %d repos", numRepos)
+	}
+
+	ar, err := newArchiveReader(path)
+	if err != nil {
+		return err
+	}
+	defer ar.close()
+	rc, err := ar.open(backupManifestName)
+	if err != nil {
+		return fmt.Errorf("unable to read backup manifest, possibly an incomplete backup: %v", err)
+	}
+	var manifest BackupManifest
+	err = json.NewDecoder(rc).Decode(&manifest)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("bad backup manifest: %v", err)
+	}
+
+	// Replace metadata and reload the repos manager.
+	metadb, err := storage.MetaDataKVStore()
+	if err != nil {
+		return err
+	}
+	begKey, endKey := storage.MetadataContext{}.KeyRange()
+	keys, err := getRawKeys(metadb, begKey, endKey)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := metadb.RawDelete(k); err != nil {
+			return err
+		}
+	}
+	numKV, err := restoreParts(ar, manifest.MetadataParts, metadb)
+	if err != nil {
+		return err
+	}
+	dvid.Infof("Restored %d metadata key-value pairs from %q\n", numKV, path)
+	if err := Initialize(false, iconfig); err != nil {
+		return fmt.Errorf("unable to load restored metadata: %v", err)
+	}
+	if err := removeUnrestoredData(manifest); err != nil {
+		return fmt.Errorf("unable to remove data not in backup from restored metadata: %v", err)
+	}
+
+	for _, inst := range manifest.Instances {
+		d, err := GetDataByDataUUID(inst.DataUUID)
+		if err != nil {
+			return fmt.Errorf("restored metadata has no data %q (%s): %v", inst.Name, inst.DataUUID, err)
+		}
+		db, err := GetOrderedKeyValueDB(d)
+		if err != nil {
+			return err
+		}
+		if numKV, err = restoreParts(ar, inst.Parts, db); err != nil {
+			return err
+		}
+		dvid.Infof("Restored %d key-value pairs for data %q\n", numKV, inst.Name)
+	}
+	for _, blobs := range manifest.Blobs {
+		if len(blobs.DataUUIDs) == 0 {
+			continue
+		}
+		d, err := GetDataByDataUUID(blobs.DataUUIDs[0])
+		if err != nil {
+			return err
+		}
+		db, err := GetKeyValueDB(d)
+		if err != nil {
+			return err
+		}
+		if _, err = restoreParts(ar, blobs.Parts, db); err != nil {
+			return err
+		}
+	}
+	dvid.Infof("Finished restore of %d key-value pairs from %q\n", manifest.NumKV, path)
+	return nil
+}
+
+// removeUnrestoredData removes data instances that weren't backed up from the repos so they
+// aren't left with metadata but no data.
+func removeUnrestoredData(manifest BackupManifest) error {
+	restored := make(map[dvid.UUID]struct{}, len(manifest.Instances))
+	for _, inst := range manifest.Instances {
+		restored[inst.DataUUID] = struct{}{}
+	}
+	repos := make(map[*repoT]struct{})
+	manager.repoMutex.RLock()
+	for _, r := range manager.repos {
+		repos[r] = struct{}{}
+	}
+	manager.repoMutex.RUnlock()
+
+	for r := range repos {
+		var removals []DataService
+		r.RLock()
+		for _, d := range r.data {
+			if _, found := restored[d.DataUUID()]; !found {
+				removals = append(removals, d)
+			}
+		}
+		r.RUnlock()
+		if len(removals) == 0 {
+			continue
+		}
+		for _, d := range removals {
+			if _, syncable := d.(Syncer); syncable {
+				r.deleteSyncGraph(d, false)
+			}
+			r.Lock()
+			tm := time.Now()
+			r.updated = tm
+			msg := fmt.Sprintf("Removed data instance '%s' of type '%s' not in restored backup", d.DataName(), d.TypeName())
+			r.log = append(r.log, fmt.Sprintf("%s  %s", tm.Format(time.RFC3339), msg))
+			delete(r.data, d.DataName())
+			r.Unlock()
+
+			manager.idMutex.Lock()
+			delete(manager.iids, d.InstanceID())
+			delete(manager.dataByUUID, d.DataUUID())
+			manager.idMutex.Unlock()
+			dvid.Infof("Removed data %q (%s) from repo %s since it wasn't in backup\n", d.DataName(), d.DataUUID(), r.uuid)
+		}
+		if err := r.save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getRawKeys returns all keys in the given range.
+func getRawKeys(db storage.OrderedKeyValueDB, begKey, endKey storage.Key) ([]storage.Key, error) {
+	ch := make(chan *storage.KeyValue)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- db.RawRangeQuery(begKey, endKey, true, ch, nil)
+	}()
+	var keys []storage.Key
+	for {
+		select {
+		case kv := <-ch:
+			if kv == nil {
+				return keys, <-errCh
+			}
+			keys = append(keys, kv.K)
+		case err := <-errCh:
+			if err == nil {
+				err = fmt.Errorf("range query ended before completion")
+			}
+			return nil, err
+		}
+	}
+}
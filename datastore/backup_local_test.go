@@ -0,0 +1,217 @@
+package datastore
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+func backupTestKey(i int) storage.TKey {
+	return storage.NewTKey(23, []byte(fmt.Sprintf("key-%04d", i)))
+}
+
+func backupTestValue(i int) []byte {
+	return []byte(fmt.Sprintf("value for key %d", i))
+}
+
+func TestBackupRestore(t *testing.T) {
+	OpenTest()
+
+	// force multiple part files
+	oldPartSize := backupPartSize
+	backupPartSize = 1000
+	defer func() {
+		backupPartSize = oldPartSize
+	}()
+
+	uuid, v := NewTestRepo()
+	dtype := &TestType{Type{Name: "testtype", URL: "github.com/janelia-flyem/dvid/datastore/testtype", Version: "1"}}
+	d, err := NewData(uuid, dtype, "backuptest", dvid.NewConfig())
+	if err != nil {
+		CloseTest()
+		t.Fatal(err)
+	}
+	db, err := GetOrderedKeyValueDB(d)
+	if err != nil {
+		CloseTest()
+		t.Fatal(err)
+	}
+	ctx := NewVersionedCtx(d, v)
+	const numKeys = 200
+	for i := 0; i < numKeys; i++ {
+		if err := db.Put(ctx, backupTestKey(i), backupTestValue(i)); err != nil {
+			CloseTest()
+			t.Fatal(err)
+		}
+	}
+	blobStore, err := GetBlobStore(d)
+	if err != nil {
+		CloseTest()
+		t.Fatal(err)
+	}
+	blobRef, err := blobStore.PutBlob([]byte("some blob data"))
+	if err != nil {
+		CloseTest()
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "backup"), filepath.Join(dir, "backup.tar")}
+	for _, path := range paths {
+		manifest, err := Backup(BackupConfig{Path: path})
+		if err != nil {
+			CloseTest()
+			t.Fatalf("backup to %q: %v\n", path, err)
+		}
+		if len(manifest.Instances) != 1 || manifest.Instances[0].NumKV != numKeys || len(manifest.Instances[0].Parts) < 2 {
+			t.Errorf("bad instance backup in manifest: %v\n", manifest.Instances)
+		}
+		if len(manifest.Blobs) != 1 || manifest.Blobs[0].NumKV != 1 {
+			t.Errorf("bad blobs backup in manifest: %v\n", manifest.Blobs)
+		}
+	}
+	if _, err := Backup(BackupConfig{Path: paths[0]}); err == nil {
+		t.Errorf("expected error when backing up to directory with existing backup\n")
+	}
+	if status := GetBackupStatus(); status.Running || status.Error == "" {
+		t.Errorf("expected finished backup with error, got %v\n", status)
+	}
+
+	// Mutations are refused while suspended for a backup.
+	resume := suspendMutations()
+	if _, err := StartMutation(); err == nil {
+		t.Errorf("expected mutation to be refused while suspended\n")
+	}
+	resume()
+	end, err := StartMutation()
+	if err != nil {
+		t.Errorf("expected mutation to be allowed after resume: %v\n", err)
+	} else {
+		end()
+	}
+
+	// Backup of selected instances shouldn't restore others.
+	if _, err := NewData(uuid, dtype, "notbackedup", dvid.NewConfig()); err != nil {
+		CloseTest()
+		t.Fatal(err)
+	}
+	selectedPath := filepath.Join(dir, "selected.tar")
+	selectedCfg := BackupConfig{Path: selectedPath, UUID: uuid, Instances: dvid.InstanceNames{"backuptest"}}
+	if _, err := Backup(selectedCfg); err != nil {
+		CloseTest()
+		t.Fatalf("backup of selected instances: %v\n", err)
+	}
+	CloseTest()
+
+	OpenTest()
+	if err := RestoreBackup(selectedPath, Config{}); err != nil {
+		CloseTest()
+		t.Fatalf("restore from %q: %v\n", selectedPath, err)
+	}
+	if _, err := GetDataByUUIDName(uuid, "backuptest"); err != nil {
+		t.Errorf("expected restored data %q: %v\n", "backuptest", err)
+	}
+	if _, err := GetDataByUUIDName(uuid, "notbackedup"); err == nil {
+		t.Errorf("expected data not in backup to be absent after restore\n")
+	}
+	CloseTest()
+
+	for _, path := range paths {
+		OpenTest()
+		if err := RestoreBackup(path, Config{}); err != nil {
+			CloseTest()
+			t.Fatalf("restore from %q: %v\n", path, err)
+		}
+		alias, err := GetRepoAlias(uuid)
+		if err != nil || alias != "testRepo" {
+			t.Errorf("restored repo %s has alias %q: %v\n", uuid, alias, err)
+		}
+		d, err := GetDataByUUIDName(uuid, "backuptest")
+		if err != nil {
+			CloseTest()
+			t.Fatal(err)
+		}
+		db, err := GetOrderedKeyValueDB(d)
+		if err != nil {
+			CloseTest()
+			t.Fatal(err)
+		}
+		ctx := NewVersionedCtx(d, v)
+		for i := 0; i < numKeys; i++ {
+			value, err := db.Get(ctx, backupTestKey(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(value, backupTestValue(i)) {
+				t.Fatalf("restored key %d from %q has value %q\n", i, path, value)
+			}
+		}
+		blobStore, err := GetBlobStore(d)
+		if err != nil {
+			CloseTest()
+			t.Fatal(err)
+		}
+		if blob, err := blobStore.GetBlob(blobRef); err != nil || string(blob) != "some blob data" {
+			t.Errorf("bad restored blob from %q: %q, %v\n", path, blob, err)
+		}
+		if err := RestoreBackup(path, Config{}); err == nil {
+			t.Errorf("expected error restoring into datastore with repos\n")
+		}
+		CloseTest()
+	}
+}
+
+func TestBackupSnapshotViews(t *testing.T) {
+	OpenTest()
+	defer CloseTest()
+
+	uuid, v := NewTestRepo()
+	dtype := &TestType{Type{Name: "testtype", URL: "github.com/janelia-flyem/dvid/datastore/testtype", Version: "1"}}
+	d, err := NewData(uuid, dtype, "snapshottest", dvid.NewConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := GetOrderedKeyValueDB(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.(storage.RawSnapshotter); !ok {
+		t.Skipf("store %s doesn't support snapshots\n", db)
+	}
+	ctx := NewVersionedCtx(d, v)
+	for i := 0; i < 10; i++ {
+		if err := db.Put(ctx, backupTestKey(i), backupTestValue(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	views, complete, err := newBackupViews([]storage.OrderedKeyValueDB{db, db})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer views.release()
+	if !complete || len(views.snapshots) != 1 {
+		t.Fatalf("expected a single snapshot for store, got %d (complete %t)\n", len(views.snapshots), complete)
+	}
+
+	// Writes after the snapshot aren't backed up.
+	for i := 10; i < 20; i++ {
+		if err := db.Put(ctx, backupTestKey(i), backupTestValue(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete(ctx, backupTestKey(0)); err != nil {
+		t.Fatal(err)
+	}
+	pw := &backupPartWriter{aw: dirArchiveWriter(t.TempDir()), prefix: "data"}
+	begKey, endKey := storage.DataInstanceKeyRange(d.InstanceID())
+	if err := pw.writeRange(views.source(db), begKey, endKey); err != nil {
+		t.Fatal(err)
+	}
+	if pw.numKV != 10 {
+		t.Errorf("expected 10 key-value pairs from snapshot, got %d\n", pw.numKV)
+	}
+}
@@ -309,6 +309,12 @@ type PropertyCopier interface {
 	CopyPropertiesFrom(DataService, storage.FilterSpec) error
 }
 
+// TKeyDescriber are data instances that can decode a type-specific key into a human-readable
+// description, e.g., a block coordinate or label, for use in reports like merge conflicts.
+type TKeyDescriber interface {
+	DescribeTKey(storage.TKey) (string, error)
+}
+
 // DataShutdownTime is the maximum number of seconds a data instance can delay when terminating
 // goroutines during Shutdown.
 const DataShutdownTime = 20
@@ -1152,7 +1158,11 @@ func (d *Data) PutBlob(b []byte) (ref string, err error) {
 	return
 }
 
+// PublishKafkaMsg sends a JSON mutation message to the Kafka topic for this data instance
+// and to any subscribers of the instance's mutation event stream.
 func (d *Data) PublishKafkaMsg(b []byte) error {
+	PublishMutationEvent(d.DataUUID(), b)
+
 	// create topic (repo ID + data instance uuid)
 	// NOTE: Kafka server must be configured to allow topic creation from
 	// messages sent to a non-existent topic
@@ -35,6 +35,15 @@ type TestData struct {
 	*Data
 }
 
+func (d *TestData) GobDecode(b []byte) error {
+	d.Data = new(Data)
+	return d.Data.GobDecode(b)
+}
+
+func (d *TestData) GobEncode() ([]byte, error) {
+	return d.Data.GobEncode()
+}
+
 func (d *TestData) DoRPC(request Request, reply *Response) error {
 	return nil
 }
@@ -337,7 +337,54 @@ func Merge(parents []dvid.UUID, note string, mt MergeType) (dvid.UUID, error) {
 	if manager == nil {
 		return dvid.NilUUID, ErrManagerNotInitialized
 	}
-	return manager.merge(parents, note, mt)
+	return manager.merge(parents, note, mt, nil)
+}
+
+// MergeWithManifest creates a child of the given parents, resolving conflicts using the
+// parent designated for each conflicting key by the manifest.  An error is returned
+// without creating the child if any conflict is not covered by the manifest.
+func MergeWithManifest(parents []dvid.UUID, note string, manifest MergeManifest) (dvid.UUID, error) {
+	if manager == nil {
+		return dvid.NilUUID, ErrManagerNotInitialized
+	}
+	return manager.merge(parents, note, MergeExternalData, manifest)
+}
+
+// GetMergeStatus returns the status of an asynchronous merge that created the given child UUID.
+func GetMergeStatus(child dvid.UUID) (MergeStatus, error) {
+	if manager == nil {
+		return MergeStatus{}, ErrManagerNotInitialized
+	}
+	return manager.getMergeStatus(child)
+}
+
+// CheckMergeComplete returns ErrMergeRunning if the given UUID is the child of an asynchronous
+// merge that is still resolving conflicts.  Data in the child shouldn't be read or modified
+// until the merge is done, since the merge writes resolved values into the child.
+func CheckMergeComplete(child dvid.UUID) error {
+	if manager == nil {
+		return ErrManagerNotInitialized
+	}
+	return manager.checkMergeComplete(child)
+}
+
+// MergeConflicts does a dry run of a merge of the given parents and returns, per data instance,
+// the number of keys modified in more than one parent and a sample of at most maxSamples
+// conflicting keys.  If no data instance names are given, all versioned instances are checked.
+func MergeConflicts(parents []dvid.UUID, names []dvid.InstanceName, maxSamples int) (map[dvid.InstanceName]*MergeConflictReport, error) {
+	if manager == nil {
+		return nil, ErrManagerNotInitialized
+	}
+	return manager.mergeConflicts(parents, names, maxSamples)
+}
+
+// GetMergeStatuses returns the status of all asynchronous merges within the repo containing
+// the given UUID, ordered by start time.
+func GetMergeStatuses(uuid dvid.UUID) ([]MergeStatus, error) {
+	if manager == nil {
+		return nil, ErrManagerNotInitialized
+	}
+	return manager.getMergeStatuses(uuid)
 }
 
 // ----- Data Instance functions -----------
@@ -850,3 +897,16 @@ func LogRepoOpToKafka(uuid dvid.UUID, b []byte) error {
 	// send message if kafka initialized
 	return storage.KafkaProduceMsg(b, topic)
 }
+
+// mutationGate is read-locked by each mutating request and write-locked while mutations
+// are suspended, e.g., to make a consistent backup.
+var mutationGate sync.RWMutex
+
+// StartMutation should be called before handling a mutating request, and the returned
+// function called when the request is done.  An error is returned if mutations are suspended.
+func StartMutation() (end func(), err error) {
+	if !mutationGate.TryRLock() {
+		return nil, fmt.Errorf("mutations are suspended while a backup is running")
+	}
+	return mutationGate.RUnlock, nil
+}
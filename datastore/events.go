@@ -0,0 +1,165 @@
+/*
+   This file provides an in-memory stream of the JSON mutation messages published by
+   data instances, so clients can follow mutations without a Kafka server.
+*/
+
+package datastore
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// EventBufferSize is the maximum number of recent mutation events retained per data
+// instance for replay to clients resuming a stream.  Buffers grow as events are published.
+var EventBufferSize = 10000
+
+// Maximum number of events that can be queued for a subscriber before it's considered
+// too slow and dropped.  Dropped subscribers can resume using the last mutation ID.
+const subscriberQueueSize = 1000
+
+// MutationEvent is a JSON mutation message published by a data instance.
+type MutationEvent struct {
+	Action     string    // the "Action" field of the message, if any
+	Version    dvid.UUID // the "UUID" field of the message, if any
+	MutationID uint64    // the "MutationID" field of the message or 0 if none
+	JSON       []byte
+}
+
+func newMutationEvent(msg []byte) MutationEvent {
+	var fields struct {
+		Action     string
+		UUID       string
+		MutationID uint64
+	}
+	if err := json.Unmarshal(msg, &fields); err != nil {
+		dvid.Debugf("mutation event isn't JSON object, so no action or version recorded: %v\n", err)
+	}
+	return MutationEvent{
+		Action:     fields.Action,
+		Version:    dvid.UUID(fields.UUID),
+		MutationID: fields.MutationID,
+		JSON:       msg,
+	}
+}
+
+// EventSubscription receives mutation events for a data instance on its channel C, which
+// is closed if the subscriber falls too far behind.
+type EventSubscription struct {
+	C <-chan MutationEvent
+
+	ch  chan MutationEvent
+	hub *eventHub
+}
+
+// Close stops delivery of events to the subscription.
+func (s *EventSubscription) Close() {
+	s.hub.mu.Lock()
+	if _, found := s.hub.subs[s]; found {
+		delete(s.hub.subs, s)
+		close(s.ch)
+	}
+	s.hub.mu.Unlock()
+}
+
+type eventHub struct {
+	mu            sync.Mutex
+	buffer        []MutationEvent // ring buffer of recent events, grown up to EventBufferSize
+	next          int             // position in ring buffer of next event once full
+	full          bool            // true if buffer has reached its size and wraps
+	lastDroppedID uint64          // largest mutation ID dropped from buffer
+	subs          map[*EventSubscription]struct{}
+}
+
+var (
+	eventHubs   = make(map[dvid.UUID]*eventHub)
+	eventHubsMu sync.Mutex
+)
+
+func getEventHub(dataID dvid.UUID) *eventHub {
+	eventHubsMu.Lock()
+	defer eventHubsMu.Unlock()
+	hub, found := eventHubs[dataID]
+	if !found {
+		hub = &eventHub{
+			subs: make(map[*EventSubscription]struct{}),
+		}
+		eventHubs[dataID] = hub
+	}
+	return hub
+}
+
+// returns buffered events in publication order.
+func (hub *eventHub) buffered() []MutationEvent {
+	if !hub.full {
+		return hub.buffer
+	}
+	return append(append([]MutationEvent{}, hub.buffer[hub.next:]...), hub.buffer[:hub.next]...)
+}
+
+// PublishMutationEvent sends a JSON mutation message for the given data instance to all
+// event subscribers and retains it for replay.
+func PublishMutationEvent(dataID dvid.UUID, msg []byte) {
+	if EventBufferSize <= 0 {
+		return
+	}
+	evt := newMutationEvent(msg)
+	hub := getEventHub(dataID)
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	// Grow the buffer as events arrive so quiet data instances don't hold a full buffer.
+	if !hub.full {
+		hub.buffer = append(hub.buffer, evt)
+		if len(hub.buffer) >= EventBufferSize {
+			hub.next = 0
+			hub.full = true
+		}
+	} else {
+		if hub.buffer[hub.next].MutationID > hub.lastDroppedID {
+			hub.lastDroppedID = hub.buffer[hub.next].MutationID
+		}
+		hub.buffer[hub.next] = evt
+		hub.next = (hub.next + 1) % len(hub.buffer)
+	}
+	for sub := range hub.subs {
+		select {
+		case sub.ch <- evt:
+		default:
+			dvid.Infof("dropping slow mutation event subscriber for data %s\n", dataID)
+			delete(hub.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// SubscribeMutationEvents returns a subscription to mutation events published for the given
+// data instance.  If resume is true, buffered events published after the last event with
+// the given mutation ID or lower are returned for replay, and gap is true if some events
+// after that mutation ID are no longer buffered.
+func SubscribeMutationEvents(dataID dvid.UUID, resume bool, since uint64) (sub *EventSubscription, replay []MutationEvent, gap bool) {
+	hub := getEventHub(dataID)
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	ch := make(chan MutationEvent, subscriberQueueSize)
+	sub = &EventSubscription{C: ch, ch: ch, hub: hub}
+	hub.subs[sub] = struct{}{}
+	if !resume {
+		return
+	}
+	buffered := hub.buffered()
+	var start int
+	for i, evt := range buffered {
+		if evt.MutationID != 0 && evt.MutationID <= since {
+			start = i + 1
+		}
+	}
+	for _, evt := range buffered[start:] {
+		if evt.MutationID == 0 || evt.MutationID > since {
+			replay = append(replay, evt)
+		}
+	}
+	gap = hub.full && start == 0 && since < hub.lastDroppedID
+	return
+}
@@ -0,0 +1,82 @@
+package datastore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+func TestMutationEvents(t *testing.T) {
+	dataID := dvid.NewUUID()
+	publish := func(action string, mutID uint64) {
+		var msg string
+		if mutID == 0 {
+			msg = fmt.Sprintf(`{"Action":%q,"UUID":"abc"}`, action)
+		} else {
+			msg = fmt.Sprintf(`{"Action":%q,"UUID":"abc","MutationID":%d}`, action, mutID)
+		}
+		PublishMutationEvent(dataID, []byte(msg))
+	}
+	publish("merge", 1)
+	publish("merge-complete", 1)
+	publish("post-nextlabel", 0)
+	publish("cleave", 2)
+	publish("cleave-complete", 2)
+	if hub := getEventHub(dataID); len(hub.buffer) != 5 || cap(hub.buffer) >= EventBufferSize {
+		t.Fatalf("expected event buffer to grow with events, got length %d, capacity %d\n", len(hub.buffer), cap(hub.buffer))
+	}
+
+	sub, replay, gap := SubscribeMutationEvents(dataID, true, 1)
+	if gap {
+		t.Fatalf("unexpected gap in events\n")
+	}
+	if len(replay) != 3 || replay[0].Action != "post-nextlabel" || replay[2].Action != "cleave-complete" {
+		t.Fatalf("bad replay of events: %v\n", replay)
+	}
+	if replay[1].MutationID != 2 || replay[1].Version != "abc" {
+		t.Fatalf("bad parsing of event: %v\n", replay[1])
+	}
+
+	publish("split", 3)
+	evt := <-sub.C
+	if evt.Action != "split" || evt.MutationID != 3 {
+		t.Fatalf("bad event received: %v\n", evt)
+	}
+	sub.Close()
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Fatalf("expected closed subscription channel\n")
+	}
+
+	sub, replay, _ = SubscribeMutationEvents(dataID, false, 0)
+	if len(replay) != 0 {
+		t.Fatalf("expected no replay without resume, got %v\n", replay)
+	}
+	// slow subscribers are dropped.
+	for i := 0; i <= subscriberQueueSize; i++ {
+		publish("merge", uint64(10+i))
+	}
+	var numReceived int
+	for range sub.C {
+		numReceived++
+	}
+	if numReceived != subscriberQueueSize {
+		t.Fatalf("expected %d events before slow subscriber dropped, got %d\n", subscriberQueueSize, numReceived)
+	}
+
+	// old events are dropped from buffer.
+	oldSize := EventBufferSize
+	EventBufferSize = 4
+	defer func() { EventBufferSize = oldSize }()
+	dataID = dvid.NewUUID()
+	for i := uint64(1); i <= 6; i++ {
+		publish("merge", i)
+	}
+	if _, replay, gap = SubscribeMutationEvents(dataID, true, 1); !gap || len(replay) != 4 || replay[0].MutationID != 3 {
+		t.Fatalf("expected gap and replay of last 4 events, got gap %t and %v\n", gap, replay)
+	}
+	if _, replay, gap = SubscribeMutationEvents(dataID, true, 3); gap || len(replay) != 3 {
+		t.Fatalf("expected no gap and replay of last 3 events, got gap %t and %v\n", gap, replay)
+	}
+}
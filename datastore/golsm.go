@@ -0,0 +1,6 @@
+// +build golsm
+
+package datastore
+
+import _ "github.com/janelia-flyem/dvid/storage/golsm"
+import _ "github.com/janelia-flyem/dvid/storage/filelog"
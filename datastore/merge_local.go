@@ -0,0 +1,753 @@
+//go:build !clustered && !gcloud
+// +build !clustered,!gcloud
+
+/*
+	This file contains local server code supporting type-specific automatic merges of
+	versions.  Each versioned data instance is scanned for keys that were modified in
+	more than one parent, and those conflicts are reconciled by the datatype (if it
+	implements AutoMerger) and written into the merged child version.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// Maximum number of per-key errors recorded in a merge status.
+const maxMergeErrors = 20
+
+// MergeInstanceStats reports the progress of merging a single data instance.
+type MergeInstanceStats struct {
+	KeysScanned uint64 `json:"keys_scanned"`
+	Conflicts   uint64 `json:"conflicts"`
+	Resolved    uint64 `json:"resolved"`
+	Failed      uint64 `json:"failed"`
+	Done        bool   `json:"done"`
+}
+
+// MergeStatus reports the progress of an asynchronous merge.
+type MergeStatus struct {
+	Child     dvid.UUID                                `json:"child"`
+	Parents   []dvid.UUID                              `json:"parents"`
+	MergeType string                                   `json:"mergeType"`
+	State     string                                   `json:"state"` // "running", "done", or "failed"
+	Started   string                                   `json:"started"`
+	Finished  string                                   `json:"finished,omitempty"`
+	Errors    []string                                 `json:"errors,omitempty"`
+	Instances map[dvid.InstanceName]MergeInstanceStats `json:"instances"`
+}
+
+// mergeJob tracks the state of an asynchronous merge into a child version.
+type mergeJob struct {
+	sync.RWMutex
+	root   dvid.UUID
+	status MergeStatus
+}
+
+var (
+	mergeJobs   = make(map[dvid.UUID]*mergeJob) // indexed by child UUID
+	mergeJobsMu sync.RWMutex
+)
+
+func newMergeJob(root, child dvid.UUID, parents []dvid.UUID, mt MergeType) *mergeJob {
+	job := &mergeJob{
+		root: root,
+		status: MergeStatus{
+			Child:     child,
+			Parents:   parents,
+			MergeType: mt.String(),
+			State:     "running",
+			Started:   time.Now().Format(time.RFC3339),
+			Instances: make(map[dvid.InstanceName]MergeInstanceStats),
+		},
+	}
+	mergeJobsMu.Lock()
+	mergeJobs[child] = job
+	mergeJobsMu.Unlock()
+	return job
+}
+
+func (job *mergeJob) updateInstance(name dvid.InstanceName, f func(*MergeInstanceStats)) {
+	job.Lock()
+	stats := job.status.Instances[name]
+	f(&stats)
+	job.status.Instances[name] = stats
+	job.Unlock()
+}
+
+func (job *mergeJob) addError(err error) {
+	job.Lock()
+	if len(job.status.Errors) < maxMergeErrors {
+		job.status.Errors = append(job.status.Errors, err.Error())
+	}
+	job.Unlock()
+}
+
+func (job *mergeJob) finish(err error) {
+	job.Lock()
+	if err != nil {
+		job.status.State = "failed"
+		job.status.Errors = append(job.status.Errors, err.Error())
+	} else {
+		job.status.State = "done"
+	}
+	job.status.Finished = time.Now().Format(time.RFC3339)
+	job.Unlock()
+}
+
+func (job *mergeJob) running() bool {
+	job.RLock()
+	defer job.RUnlock()
+	return job.status.State == "running"
+}
+
+// returns a copy of the status safe for marshaling outside the lock.
+func (job *mergeJob) getStatus() MergeStatus {
+	job.RLock()
+	defer job.RUnlock()
+	status := job.status
+	status.Parents = make([]dvid.UUID, len(job.status.Parents))
+	copy(status.Parents, job.status.Parents)
+	status.Errors = make([]string, len(job.status.Errors))
+	copy(status.Errors, job.status.Errors)
+	status.Instances = make(map[dvid.InstanceName]MergeInstanceStats, len(job.status.Instances))
+	for name, stats := range job.status.Instances {
+		status.Instances[name] = stats
+	}
+	return status
+}
+
+func (m *repoManager) getMergeStatus(child dvid.UUID) (MergeStatus, error) {
+	mergeJobsMu.RLock()
+	job, found := mergeJobs[child]
+	mergeJobsMu.RUnlock()
+	if !found {
+		return MergeStatus{}, ErrMergeNotFound
+	}
+	return job.getStatus(), nil
+}
+
+// returns ErrMergeRunning if the given version is the child of a merge still being resolved.
+func (m *repoManager) checkMergeComplete(child dvid.UUID) error {
+	mergeJobsMu.RLock()
+	job, found := mergeJobs[child]
+	mergeJobsMu.RUnlock()
+	if found && job.running() {
+		return ErrMergeRunning
+	}
+	return nil
+}
+
+func (m *repoManager) getMergeStatuses(uuid dvid.UUID) ([]MergeStatus, error) {
+	r, err := m.repoFromUUID(uuid)
+	if err != nil {
+		return nil, err
+	}
+	mergeJobsMu.RLock()
+	var jobs []*mergeJob
+	for _, job := range mergeJobs {
+		if job.root == r.uuid {
+			jobs = append(jobs, job)
+		}
+	}
+	mergeJobsMu.RUnlock()
+
+	statuses := make([]MergeStatus, len(jobs))
+	for i, job := range jobs {
+		statuses[i] = job.getStatus()
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Started < statuses[j].Started })
+	return statuses, nil
+}
+
+// mergeVersions holds the version graph information necessary to find keys that
+// were modified in more than one parent of a merge.
+type mergeVersions struct {
+	parents []dvid.VersionID
+	child   dvid.VersionID
+	base    dvid.VersionID // closest common ancestor of all parents or 0 if none.
+
+	ancestors   map[dvid.VersionID]map[dvid.VersionID]struct{} // cached strict ancestors
+	ancestorsMu sync.Mutex
+}
+
+func (m *repoManager) newMergeVersions(parents []dvid.VersionID, child dvid.VersionID) (*mergeVersions, error) {
+	mv := &mergeVersions{
+		parents:   parents,
+		child:     child,
+		ancestors: make(map[dvid.VersionID]map[dvid.VersionID]struct{}),
+	}
+
+	// Find the common ancestors (including the parents themselves) of all parents.
+	var common map[dvid.VersionID]struct{}
+	for _, parent := range parents {
+		ancestors, err := m.ancestorSet(mv, parent)
+		if err != nil {
+			return nil, err
+		}
+		lineage := make(map[dvid.VersionID]struct{}, len(ancestors)+1)
+		for v := range ancestors {
+			lineage[v] = struct{}{}
+		}
+		lineage[parent] = struct{}{}
+		if common == nil {
+			common = lineage
+			continue
+		}
+		for v := range common {
+			if _, found := lineage[v]; !found {
+				delete(common, v)
+			}
+		}
+	}
+
+	// The base is the common ancestor that isn't an ancestor of another common ancestor.
+	// For criss-cross merges with more than one candidate, we use the most recent version.
+	for v := range common {
+		closest := true
+		for v2 := range common {
+			if v2 == v {
+				continue
+			}
+			isAncestor, err := m.isAncestor(mv, v, v2)
+			if err != nil {
+				return nil, err
+			}
+			if isAncestor {
+				closest = false
+				break
+			}
+		}
+		if closest && v > mv.base {
+			mv.base = v
+		}
+	}
+	return mv, nil
+}
+
+// returns the set of strict ancestors for a version across all parent paths.
+func (m *repoManager) ancestorSet(mv *mergeVersions, v dvid.VersionID) (map[dvid.VersionID]struct{}, error) {
+	mv.ancestorsMu.Lock()
+	ancestors, found := mv.ancestors[v]
+	mv.ancestorsMu.Unlock()
+	if found {
+		return ancestors, nil
+	}
+
+	ancestors = make(map[dvid.VersionID]struct{})
+	toVisit := []dvid.VersionID{v}
+	for len(toVisit) > 0 {
+		cur := toVisit[len(toVisit)-1]
+		toVisit = toVisit[:len(toVisit)-1]
+		parents, err := m.getParentsByVersion(cur)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range parents {
+			if _, visited := ancestors[parent]; !visited {
+				ancestors[parent] = struct{}{}
+				toVisit = append(toVisit, parent)
+			}
+		}
+	}
+
+	mv.ancestorsMu.Lock()
+	mv.ancestors[v] = ancestors
+	mv.ancestorsMu.Unlock()
+	return ancestors, nil
+}
+
+// returns true if version a is a strict ancestor of version b.
+func (m *repoManager) isAncestor(mv *mergeVersions, a, b dvid.VersionID) (bool, error) {
+	ancestors, err := m.ancestorSet(mv, b)
+	if err != nil {
+		return false, err
+	}
+	_, found := ancestors[a]
+	return found, nil
+}
+
+// returns a copy of the versioned kv pairs without any invalidation marks, since
+// findMatch modifies the kvVersions as it traverses the DAG.
+func (kvv kvVersions) clean() kvVersions {
+	dup := make(kvVersions, len(kvv))
+	for v, n := range kvv {
+		dup[v] = kvvNode{kv: n.kv}
+	}
+	return dup
+}
+
+// findMergeConflict returns a non-nil MergeConflict if the key-value pairs across versions
+// for a single type-specific key were modified in more than one parent.
+func (m *repoManager) findMergeConflict(mv *mergeVersions, tk storage.TKey, kvv kvVersions) (*MergeConflict, error) {
+	kvs := make([]*storage.KeyValue, len(mv.parents))
+	matched := make(map[dvid.VersionID]struct{}, len(mv.parents))
+	for i, parent := range mv.parents {
+		kv, v, err := m.findMatch(kvv.clean(), parent)
+		if err != nil {
+			return nil, err
+		}
+		kvs[i] = kv
+		if v != 0 {
+			matched[v] = struct{}{}
+		}
+	}
+
+	// Remove any matched version that is simply inherited by another parent's match.
+	for v := range matched {
+		for v2 := range matched {
+			if v == v2 {
+				continue
+			}
+			isAncestor, err := m.isAncestor(mv, v, v2)
+			if err != nil {
+				return nil, err
+			}
+			if isAncestor {
+				delete(matched, v)
+				break
+			}
+		}
+	}
+	if len(matched) < 2 {
+		return nil, nil
+	}
+
+	conflict := &MergeConflict{
+		TKey:   tk,
+		Values: make([][]byte, len(mv.parents)),
+	}
+	for i, kv := range kvs {
+		if kv != nil {
+			conflict.Values[i] = kv.V
+		}
+	}
+	if mv.base != 0 {
+		kv, _, err := m.findMatch(kvv.clean(), mv.base)
+		if err != nil {
+			return nil, err
+		}
+		if kv != nil {
+			conflict.Base = kv.V
+		}
+	}
+	return conflict, nil
+}
+
+// scanVersionedKeys sends all key-values for a data instance, grouped by type-specific key
+// across versions, to the given function.  Keys that can't be decoded are sent to onErr.
+func scanVersionedKeys(data DataService, store storage.OrderedKeyValueDB, keysOnly bool,
+	fn func(storage.TKey, kvVersions), onErr func(error)) error {
+
+	ctx := NewVersionedCtx(data, 0)
+	ch := make(chan *storage.KeyValue, 1000)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var batchTK storage.TKey
+		kvv := kvVersions{}
+		for {
+			kv := <-ch
+			var curTK storage.TKey
+			var curV dvid.VersionID
+			if kv != nil {
+				var err error
+				if curV, err = ctx.VersionFromKey(kv.K); err != nil {
+					onErr(fmt.Errorf("can't decode key version for data %q: %v", data.DataName(), err))
+					continue
+				}
+				if curTK, err = storage.TKeyFromKey(kv.K); err != nil {
+					onErr(fmt.Errorf("can't decode type-specific key for data %q: %v", data.DataName(), err))
+					continue
+				}
+			}
+			if batchTK != nil && (kv == nil || !bytes.Equal(curTK, batchTK)) {
+				fn(batchTK, kvv)
+				kvv = kvVersions{}
+			}
+			if kv == nil {
+				return
+			}
+			batchTK = curTK
+			kvv[curV] = kvvNode{kv: kv}
+		}
+	}()
+
+	minKey, maxKey := ctx.KeyRange()
+	if err := store.RawRangeQuery(minKey, maxKey, keysOnly, ch, nil); err != nil {
+		ch <- nil
+		wg.Wait()
+		return err
+	}
+	wg.Wait()
+	return nil
+}
+
+// mergeResolver returns the value that should be written into the merged child for a
+// conflicted key, where a nil value deletes the key in the child.
+type mergeResolver func(data DataService, childCtx *VersionedCtx, c *MergeConflict) ([]byte, error)
+
+// resolves conflicts using the datatype's AutoMerger implementation if available,
+// else uses the value of the first parent that changed the key.
+func autoResolver(data DataService, childCtx *VersionedCtx, c *MergeConflict) ([]byte, error) {
+	if merger, isMerger := data.(AutoMerger); isMerger {
+		return merger.ResolveConflict(childCtx, c)
+	}
+	return c.PriorityValue(), nil
+}
+
+// resolveMerge runs through all versioned data instances in the repo and writes resolutions
+// of conflicted keys into the child version.
+func (m *repoManager) resolveMerge(r *repoT, job *mergeJob, mv *mergeVersions, resolver mergeResolver) {
+	// The merge writes into the child like a mutating request, so a backup waits for it.
+	mutationGate.RLock()
+	defer mutationGate.RUnlock()
+
+	timedLog := dvid.NewTimeLog()
+
+	r.RLock()
+	dataservices := make([]DataService, 0, len(r.data))
+	for _, dataservice := range r.data {
+		dataservices = append(dataservices, dataservice)
+	}
+	r.RUnlock()
+
+	for _, dataservice := range dataservices {
+		if !dataservice.Versioned() {
+			continue
+		}
+		if err := m.resolveMergeData(job, mv, dataservice, resolver); err != nil {
+			job.finish(fmt.Errorf("merge of data %q failed: %v", dataservice.DataName(), err))
+			dvid.Errorf("Merge into version %d failed on data %q: %v\n", mv.child, dataservice.DataName(), err)
+			return
+		}
+	}
+	job.finish(nil)
+	timedLog.Infof("Completed %s merge into version %d", job.status.MergeType, mv.child)
+}
+
+func (m *repoManager) resolveMergeData(job *mergeJob, mv *mergeVersions, data DataService, resolver mergeResolver) error {
+	store, err := GetOrderedKeyValueDB(data)
+	if err != nil {
+		dvid.Infof("Skipping merge of data %q without ordered key-value store: %v\n", data.DataName(), err)
+		return nil
+	}
+	name := data.DataName()
+	job.updateInstance(name, func(stats *MergeInstanceStats) {})
+
+	childCtx := NewVersionedCtx(data, mv.child)
+	merger, isMerger := data.(AutoMerger)
+
+	resolve := func(tk storage.TKey, kvv kvVersions) error {
+		// If the child already has its own key-value, it has precedence.
+		if _, found := kvv[mv.child]; found {
+			return nil
+		}
+		conflict, err := m.findMergeConflict(mv, tk, kvv)
+		if err != nil || conflict == nil {
+			return err
+		}
+		job.updateInstance(name, func(stats *MergeInstanceStats) { stats.Conflicts++ })
+
+		val, err := resolver(data, childCtx, conflict)
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			err = store.Delete(childCtx, tk)
+		} else {
+			err = store.Put(childCtx, tk, val)
+		}
+		if err != nil {
+			return err
+		}
+		job.updateInstance(name, func(stats *MergeInstanceStats) { stats.Resolved++ })
+		return nil
+	}
+
+	onKey := func(tk storage.TKey, kvv kvVersions) {
+		job.updateInstance(name, func(stats *MergeInstanceStats) { stats.KeysScanned++ })
+		if err := resolve(tk, kvv); err != nil {
+			job.updateInstance(name, func(stats *MergeInstanceStats) { stats.Failed++ })
+			job.addError(fmt.Errorf("data %q, key %s: %v", name, describeTKey(data, tk), err))
+		}
+	}
+	keysOnly := false
+	if err := scanVersionedKeys(data, store, keysOnly, onKey, job.addError); err != nil {
+		return err
+	}
+
+	if isMerger {
+		if err := merger.MergeComplete(childCtx, mv.parents); err != nil {
+			return err
+		}
+	}
+	job.updateInstance(name, func(stats *MergeInstanceStats) { stats.Done = true })
+	return nil
+}
+
+// MergeConflictReport describes the keys of a data instance that were modified in more than
+// one parent and would need resolution during a merge.
+type MergeConflictReport struct {
+	KeysScanned uint64   `json:"keys_scanned"`
+	Conflicts   uint64   `json:"conflicts"`
+	Samples     []string `json:"samples,omitempty"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// describes a type-specific key using the datatype if possible, else returns hexadecimal.
+func describeTKey(data DataService, tk storage.TKey) string {
+	if describer, ok := data.(TKeyDescriber); ok {
+		if desc, err := describer.DescribeTKey(tk); err == nil {
+			return desc
+		}
+	}
+	return fmt.Sprintf("%x", []byte(tk))
+}
+
+func (m *repoManager) mergeConflicts(parents []dvid.UUID, names []dvid.InstanceName, maxSamples int) (map[dvid.InstanceName]*MergeConflictReport, error) {
+	if len(parents) < 2 {
+		return nil, fmt.Errorf("must have at least two parents to check merge conflicts")
+	}
+	r, err := m.repoFromUUID(parents[0])
+	if err != nil {
+		return nil, err
+	}
+	parentsV := make([]dvid.VersionID, len(parents))
+	for i, parent := range parents {
+		r2, err := m.repoFromUUID(parent)
+		if err != nil {
+			return nil, err
+		}
+		if r2 != r {
+			return nil, fmt.Errorf("parent %s is not in the same repo as parent %s", parent, parents[0])
+		}
+		if parentsV[i], err = m.versionFromUUID(parent); err != nil {
+			return nil, err
+		}
+	}
+	mv, err := m.newMergeVersions(parentsV, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var dataservices []DataService
+	r.RLock()
+	if len(names) == 0 {
+		for _, dataservice := range r.data {
+			if dataservice.Versioned() {
+				dataservices = append(dataservices, dataservice)
+			}
+		}
+	} else {
+		for _, name := range names {
+			dataservice, found := r.data[name]
+			if !found {
+				r.RUnlock()
+				return nil, ErrInvalidDataName
+			}
+			dataservices = append(dataservices, dataservice)
+		}
+	}
+	r.RUnlock()
+
+	reports := make(map[dvid.InstanceName]*MergeConflictReport, len(dataservices))
+	for _, data := range dataservices {
+		report := new(MergeConflictReport)
+		reports[data.DataName()] = report
+		if !data.Versioned() {
+			continue
+		}
+		store, err := GetOrderedKeyValueDB(data)
+		if err != nil {
+			return nil, err
+		}
+		onErr := func(err error) {
+			if len(report.Errors) < maxMergeErrors {
+				report.Errors = append(report.Errors, err.Error())
+			}
+		}
+		onKey := func(tk storage.TKey, kvv kvVersions) {
+			report.KeysScanned++
+			conflict, err := m.findMergeConflict(mv, tk, kvv)
+			if err != nil {
+				onErr(fmt.Errorf("key %s: %v", describeTKey(data, tk), err))
+				return
+			}
+			if conflict == nil {
+				return
+			}
+			report.Conflicts++
+			if len(report.Samples) < maxSamples {
+				report.Samples = append(report.Samples, describeTKey(data, tk))
+			}
+		}
+		keysOnly := true
+		if err := scanVersionedKeys(data, store, keysOnly, onKey, onErr); err != nil {
+			return nil, err
+		}
+	}
+	return reports, nil
+}
+
+// Maximum number of uncovered conflicts listed when a merge manifest is rejected.
+const maxManifestSamples = 10
+
+// manifestRule is a MergeManifestRule with the parent resolved to an index into the
+// merge parents.
+type manifestRule struct {
+	MergeManifestRule
+	parent int
+}
+
+// compileManifest checks a manifest against the parents and data instances of a repo.
+func (m *repoManager) compileManifest(r *repoT, parents []dvid.UUID, manifest MergeManifest) (map[dvid.InstanceName][]manifestRule, error) {
+	compiled := make(map[dvid.InstanceName][]manifestRule, len(manifest))
+	r.RLock()
+	defer r.RUnlock()
+	for name, rules := range manifest {
+		if _, found := r.data[name]; !found {
+			return nil, fmt.Errorf("manifest data instance %q is not in repo %s", name, r.uuid)
+		}
+		compiled[name] = make([]manifestRule, len(rules))
+		for i, rule := range rules {
+			uuid, _, err := m.matchingUUID(rule.Parent)
+			if err != nil {
+				return nil, fmt.Errorf("manifest for data %q has bad parent %q: %v", name, rule.Parent, err)
+			}
+			parent := -1
+			for j, p := range parents {
+				if p == uuid {
+					parent = j
+					break
+				}
+			}
+			if parent < 0 {
+				return nil, fmt.Errorf("manifest for data %q has parent %s that is not being merged", name, uuid)
+			}
+			compiled[name][i] = manifestRule{MergeManifestRule: rule, parent: parent}
+		}
+	}
+	return compiled, nil
+}
+
+// returns the first matching rule or nil if no rule matches.
+func matchManifest(data DataService, rules []manifestRule, tk storage.TKey) (*manifestRule, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	var key ManifestKey
+	if keyer, ok := data.(ManifestKeyer); ok {
+		var err error
+		if key, err = keyer.ManifestKey(tk); err != nil {
+			return nil, err
+		}
+	}
+	for i := range rules {
+		if rules[i].Matches(key) {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// checkManifest verifies that every conflict in the versioned data instances of the
+// repo is covered by a manifest rule and, for data instances implementing ManifestChecker,
+// that the selected parents are consistent.
+func (m *repoManager) checkManifest(r *repoT, mv *mergeVersions, rules map[dvid.InstanceName][]manifestRule) error {
+	r.RLock()
+	var dataservices []DataService
+	for _, dataservice := range r.data {
+		if dataservice.Versioned() {
+			dataservices = append(dataservices, dataservice)
+		}
+	}
+	r.RUnlock()
+
+	var numUncovered int
+	var samples []string
+	for _, data := range dataservices {
+		store, err := GetOrderedKeyValueDB(data)
+		if err != nil {
+			continue
+		}
+		var scanErr error
+		onErr := func(err error) {
+			if scanErr == nil {
+				scanErr = err
+			}
+		}
+		dataRules := rules[data.DataName()]
+		var check ManifestCheck
+		if checker, ok := data.(ManifestChecker); ok {
+			check = checker.NewManifestCheck()
+		}
+		onKey := func(tk storage.TKey, kvv kvVersions) {
+			conflict, err := m.findMergeConflict(mv, tk, kvv)
+			if err != nil {
+				onErr(err)
+				return
+			}
+			if conflict == nil {
+				return
+			}
+			rule, err := matchManifest(data, dataRules, tk)
+			if err != nil {
+				onErr(err)
+				return
+			}
+			if rule == nil {
+				numUncovered++
+				if len(samples) < maxManifestSamples {
+					samples = append(samples, fmt.Sprintf("%s %s", data.DataName(), describeTKey(data, tk)))
+				}
+				return
+			}
+			if check != nil {
+				if err := check.AddKey(conflict, rule.MergeManifestRule, rule.parent); err != nil {
+					onErr(err)
+				}
+			}
+		}
+		keysOnly := check == nil
+		if err := scanVersionedKeys(data, store, keysOnly, onKey, onErr); err != nil {
+			return err
+		}
+		if scanErr != nil {
+			return fmt.Errorf("error checking manifest for data %q: %v", data.DataName(), scanErr)
+		}
+		if check != nil {
+			if err := check.Finish(); err != nil {
+				return fmt.Errorf("merge manifest for data %q is inconsistent: %v", data.DataName(), err)
+			}
+		}
+	}
+	if numUncovered != 0 {
+		return fmt.Errorf("merge manifest does not cover %d conflicts, including: %s", numUncovered, strings.Join(samples, "; "))
+	}
+	return nil
+}
+
+// returns a resolver that uses the value of the parent given by the manifest rules.
+func manifestResolver(rules map[dvid.InstanceName][]manifestRule) mergeResolver {
+	return func(data DataService, childCtx *VersionedCtx, c *MergeConflict) ([]byte, error) {
+		rule, err := matchManifest(data, rules[data.DataName()], c.TKey)
+		if err != nil {
+			return nil, err
+		}
+		if rule == nil {
+			return nil, fmt.Errorf("no manifest rule covers key %s", describeTKey(data, c.TKey))
+		}
+		return c.Values[rule.parent], nil
+	}
+}
@@ -7,7 +7,13 @@
 
 package datastore
 
-import "errors"
+import (
+	"bytes"
+	"errors"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
 
 // MergeType describes the expectation of processing for the merge, e.g., is it
 // expected to be free of conflicts at the key-value level, require automated
@@ -27,6 +33,167 @@ const (
 	MergeExternalData
 )
 
+func (mt MergeType) String() string {
+	switch mt {
+	case MergeConflictFree:
+		return "conflict-free"
+	case MergeTypeSpecificAuto:
+		return "auto"
+	case MergeExternalData:
+		return "external"
+	default:
+		return "unknown"
+	}
+}
+
+// MergeConflict describes a type-specific key that was modified in more than one
+// parent of a merge.  Values are the stored (possibly serialized) values.
+type MergeConflict struct {
+	TKey storage.TKey
+
+	// Base is the value in the closest common ancestor of the parents or nil if
+	// the key was not present there.
+	Base []byte
+
+	// Values holds the value for each parent in priority order.  A nil value
+	// means the key was deleted or never present in that parent.
+	Values [][]byte
+}
+
+// Changed returns true if the i-th parent's value differs from the base value.
+func (c *MergeConflict) Changed(i int) bool {
+	if i < 0 || i >= len(c.Values) {
+		return false
+	}
+	if (c.Values[i] == nil) != (c.Base == nil) {
+		return true
+	}
+	return !bytes.Equal(c.Values[i], c.Base)
+}
+
+// PriorityValue returns the value of the first parent, in priority order, that
+// changed the key relative to the base.  This is the default resolution for data
+// instances that do not implement AutoMerger.
+func (c *MergeConflict) PriorityValue() []byte {
+	for i := range c.Values {
+		if c.Changed(i) {
+			return c.Values[i]
+		}
+	}
+	if len(c.Values) == 0 {
+		return nil
+	}
+	return c.Values[0]
+}
+
+// AutoMerger is a data instance that can reconcile keys modified in more than one
+// parent during a MergeTypeSpecificAuto merge.  Like Syncer and CommitSyncer, it is
+// an optional interface checked on each data instance in the repo.
+type AutoMerger interface {
+	// ResolveConflict returns the value that should be stored for the conflicted key
+	// in the merged child version given by the context.  A nil value deletes the key
+	// in the child.
+	ResolveConflict(ctx *VersionedCtx, c *MergeConflict) ([]byte, error)
+
+	// MergeComplete is called after all conflicts for the data instance have been
+	// written into the merged child version so any in-memory state can be refreshed.
+	MergeComplete(ctx *VersionedCtx, parents []dvid.VersionID) error
+}
+
+// MergeManifest gives, for each data instance, an ordered list of rules that determine
+// which parent's value is used for a conflicted key in a MergeExternalData merge.
+type MergeManifest map[dvid.InstanceName][]MergeManifestRule
+
+// MergeManifestRule selects the parent whose value is used for matching conflicted keys.
+// A rule matches a key if the key satisfies all given criteria, so a rule with no
+// criteria matches every key of the data instance.
+type MergeManifestRule struct {
+	// Parent is the UUID (or unique prefix) of the winning parent.
+	Parent string `json:"parent"`
+
+	// Begin and End give an inclusive range of string keys, e.g., keyvalue keys.
+	// An empty End is unbounded.
+	Begin string `json:"begin,omitempty"`
+	End   string `json:"end,omitempty"`
+
+	// Labels give a set of labels or body ids.
+	Labels []uint64 `json:"labels,omitempty"`
+
+	// MinBlock and MaxBlock give an inclusive box of block coordinates.
+	MinBlock *dvid.ChunkPoint3d `json:"minBlock,omitempty"`
+	MaxBlock *dvid.ChunkPoint3d `json:"maxBlock,omitempty"`
+}
+
+// Matches returns true if the manifest key satisfies all criteria of the rule.
+func (rule *MergeManifestRule) Matches(key ManifestKey) bool {
+	if rule.Begin != "" || rule.End != "" {
+		if key.Key == "" || key.Key < rule.Begin || (rule.End != "" && key.Key > rule.End) {
+			return false
+		}
+	}
+	if len(rule.Labels) != 0 {
+		if key.Label == 0 {
+			return false
+		}
+		var found bool
+		for _, label := range rule.Labels {
+			if label == key.Label {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.MinBlock != nil || rule.MaxBlock != nil {
+		if key.Block == nil {
+			return false
+		}
+		for i := 0; i < 3; i++ {
+			if rule.MinBlock != nil && key.Block[i] < rule.MinBlock[i] {
+				return false
+			}
+			if rule.MaxBlock != nil && key.Block[i] > rule.MaxBlock[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ManifestKey describes a type-specific key using the properties that can be matched
+// by a MergeManifestRule.
+type ManifestKey struct {
+	Key   string             // string key, e.g., keyvalue key or annotation tag.
+	Label uint64             // label or body id, 0 if not applicable.
+	Block *dvid.ChunkPoint3d // block coordinate, nil if not applicable.
+}
+
+// ManifestKeyer is a data instance that can decode its type-specific keys for matching
+// against a MergeManifest.  Keys of data instances that don't implement this interface
+// can only be matched by rules without criteria.
+type ManifestKeyer interface {
+	ManifestKey(storage.TKey) (ManifestKey, error)
+}
+
+// ManifestChecker is a data instance that can verify the parents selected by a merge
+// manifest are consistent across its keys, e.g., that a label index and the blocks it
+// describes come from the same parent.  Merges with inconsistent manifests are rejected.
+type ManifestChecker interface {
+	NewManifestCheck() ManifestCheck
+}
+
+// ManifestCheck accumulates the conflicted keys of a data instance during a manifest check.
+type ManifestCheck interface {
+	// AddKey is called for each conflicted key with the matching rule and the index of
+	// the selected parent.  The conflict includes values.
+	AddKey(c *MergeConflict, rule MergeManifestRule, parent int) error
+
+	// Finish is called after all conflicted keys have been added.
+	Finish() error
+}
+
 var (
 	ErrManagerNotInitialized = errors.New("datastore repo manager not initialized")
 	ErrBadMergeType          = errors.New("bad merge type")
@@ -45,4 +212,7 @@ var (
 	ErrModifyLockedNode   = errors.New("can't modify locked node")
 	ErrBranchUnlockedNode = errors.New("can't branch an unlocked node")
 	ErrBranchUnique       = errors.New("branch already exists with given name")
+
+	ErrMergeNotFound = errors.New("no merge job found for given child UUID")
+	ErrMergeRunning  = errors.New("version is the child of a merge that is still resolving conflicts")
 )
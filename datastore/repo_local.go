@@ -1896,7 +1896,7 @@ func (m *repoManager) newVersion(parent dvid.UUID, note string, branchname strin
 	return child.uuid, r.save()
 }
 
-func (m *repoManager) merge(parents []dvid.UUID, note string, mt MergeType) (dvid.UUID, error) {
+func (m *repoManager) merge(parents []dvid.UUID, note string, mt MergeType, manifest MergeManifest) (dvid.UUID, error) {
 	if len(parents) < 2 {
 		return dvid.NilUUID, ErrInvalidUUID
 	}
@@ -1909,6 +1909,34 @@ func (m *repoManager) merge(parents []dvid.UUID, note string, mt MergeType) (dvi
 	}
 	m.repoMutex.RUnlock()
 
+	// For external data merges, make sure the manifest covers all conflicts before
+	// any change is made to the DAG.
+	var manifestRules map[dvid.InstanceName][]manifestRule
+	var manifestMV *mergeVersions
+	if mt == MergeExternalData {
+		if len(manifest) == 0 {
+			return dvid.NilUUID, fmt.Errorf("merging with external data requires a manifest")
+		}
+		parentsV := make([]dvid.VersionID, len(parents))
+		for i, parent := range parents {
+			v, err := m.versionFromUUID(parent)
+			if err != nil {
+				return dvid.NilUUID, err
+			}
+			parentsV[i] = v
+		}
+		var err error
+		if manifestRules, err = m.compileManifest(r, parents, manifest); err != nil {
+			return dvid.NilUUID, err
+		}
+		if manifestMV, err = m.newMergeVersions(parentsV, 0); err != nil {
+			return dvid.NilUUID, err
+		}
+		if err = m.checkManifest(r, manifestMV, manifestRules); err != nil {
+			return dvid.NilUUID, err
+		}
+	}
+
 	// Add the child node.  Since it's new and unavailable, no need to lock it.
 	childUUID, childV, err := m.newUUID(nil)
 	if err != nil {
@@ -1964,22 +1992,28 @@ func (m *repoManager) merge(parents []dvid.UUID, note string, mt MergeType) (dvi
 	}
 	r.RUnlock()
 
-	// TODO: we'd like to lock this child node but locked nodes have other
-	//  side effects like the ability to be branched or cloned.  Perhaps add
-	//  another node-level property saying it's read-only at this time, not
-	//  for all time.  Could require separate API call to retrieve final child
-	//  UUID given an immediately returned token.
+	// Asynchronous merges keep the child unlocked, so requests on the child are refused
+	// via CheckMergeComplete until the merge job is finished.
 	switch mt {
 	case MergeConflictFree:
 		// No processing needs to be done except for metadata changes.
 		// Any issues will be noted during key-value lookup while traversing the DAG.
 
 	case MergeTypeSpecificAuto:
-		return dvid.NilUUID, fmt.Errorf("the type-specific auto merge has not been implemented yet")
-		// go r.asyncMerge(parentNode1, parentNode2, child)
+		// Resolve keys modified in more than one parent asynchronously.  Progress can
+		// be monitored via the merge status for the child UUID.
+		mv, err := m.newMergeVersions(child.parents, childV)
+		if err != nil {
+			return dvid.NilUUID, err
+		}
+		job := newMergeJob(r.uuid, childUUID, parents, mt)
+		go m.resolveMerge(r, job, mv, autoResolver)
 
 	case MergeExternalData:
-		return dvid.NilUUID, fmt.Errorf("merging with external data has not been implemented yet")
+		// Resolve conflicts asynchronously using the parent selected by the manifest.
+		manifestMV.child = childV
+		job := newMergeJob(r.uuid, childUUID, parents, mt)
+		go m.resolveMerge(r, job, manifestMV, manifestResolver(manifestRules))
 
 	default:
 		return dvid.NilUUID, ErrBadMergeType
@@ -1083,3 +1083,27 @@ var hemibrainDAG = `{
 		"Updated": "2018-12-16T17:00:53.556072019-05:00"
 	}
 }`
+
+func TestCheckMergeComplete(t *testing.T) {
+	OpenTest()
+	defer CloseTest()
+
+	root, _ := NewTestRepo()
+	child := dvid.UUID("deadbeefcafe")
+	job := newMergeJob(root, child, []dvid.UUID{root}, MergeTypeSpecificAuto)
+	defer func() {
+		mergeJobsMu.Lock()
+		delete(mergeJobs, child)
+		mergeJobsMu.Unlock()
+	}()
+	if err := CheckMergeComplete(child); err != ErrMergeRunning {
+		t.Fatalf("expected running merge to refuse requests on child, got %v\n", err)
+	}
+	if err := CheckMergeComplete(root); err != nil {
+		t.Fatalf("expected parent of running merge to accept requests, got %v\n", err)
+	}
+	job.finish(nil)
+	if err := CheckMergeComplete(child); err != nil {
+		t.Fatalf("expected finished merge to accept requests on child, got %v\n", err)
+	}
+}
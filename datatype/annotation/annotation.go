@@ -185,14 +185,26 @@ GET <api URL>/node/<UUID>/<data name>/tag/<tag>[?<options>]
 	GET http://foo.com/api/node/83af/myannotations/tag/goodstuff?relationships=true
 	
 
-DELETE <api URL>/node/<UUID>/<data name>/element/<coord>[?<options>]
+GET <api URL>/node/<UUID>/<data name>/element/<coord or ID>
 
-	Deletes a point annotation given its location.
+	Returns the point annotation, including relationships, given either its location
+	as X_Y_Z or its element ID.
 
-	Kafka JSON message generated by this request where "User" is optional:
+	Example:
+
+	GET http://foo.com/api/node/83af/myannotations/element/23_81_100
+	GET http://foo.com/api/node/83af/myannotations/element/2345
+
+
+DELETE <api URL>/node/<UUID>/<data name>/element/<coord or ID>[?<options>]
+
+	Deletes a point annotation given either its location as X_Y_Z or its element ID.
+
+	Kafka JSON message generated by this request where "User" and "ID" are optional:
 		{ 
 			"Action": "element-delete",
 			"Point": <3d point>,
+			"ID": <element ID>,
 			"UUID": <UUID on which delete was done>,
 			"User": <user name>
 		}
@@ -224,6 +236,11 @@ POST <api URL>/node/<UUID>/<data name>/elements[?<options>]
 	Adds or modifies point annotations.  The POSTed content is an array of elements.
 	Note that deletes are handled via a separate API (see above).
 
+	Returns a JSON array of element IDs in the same order as the POSTed elements.
+	An element posted at the location of an existing element modifies that element
+	and keeps its ID, while other elements are assigned new IDs that are unique
+	across all versions of this instance.  Any "ID" in POSTed elements is ignored.
+
 	Kafka JSON message generated by this request where "User" is optional:
 		{ 
 			"Action": "element-post",
@@ -241,6 +258,58 @@ POST <api URL>/node/<UUID>/<data name>/elements[?<options>]
 
 	kafkalog    Set to "off" if you don't want this mutation logged to kafka.
 
+GET <api URL>/node/<UUID>/<data name>/query[/<size>/<offset>][?<options>]
+
+	Returns all point annotations, with relationships, that match all the given options.
+	If size and offset are given, only point annotations within that subvolume are
+	searched, where size and offset are voxels separated by underscore like the
+	/elements endpoint.  Otherwise the entire data instance is searched, which can be
+	slow for large instances unless tags are given, in which case the tag index is used.
+
+	GET Query-string Options:
+
+	kind             Comma-separated list of element kinds, e.g., "PreSyn,PostSyn".
+	tags             Comma-separated list of tags, all of which an element must have.
+	prop.<key>       The element's "Prop" value for <key> must equal the given string.
+	propmin.<key>    The element's "Prop" value for <key> must be a number >= given number.
+	propmax.<key>    The element's "Prop" value for <key> must be a number <= given number.
+
+	Example:
+
+	GET http://foo.com/api/node/83af/myannotations/query?kind=PreSyn&prop.user=bob&propmin.conf=0.8
+
+
+GET  <api URL>/node/<UUID>/<data name>/connectivity?<options>
+POST <api URL>/node/<UUID>/<data name>/connectivity
+
+	Returns the body-to-body connectivity table computed from the PreSyn -> PostSyn
+	relationships of synaptic elements at this version.  Exactly one way of selecting
+	bodies must be given:
+
+	1) POST a JSON list of body IDs, e.g., [23, 1897, 88], or use the "bodies" option.
+	   Only connections between the listed bodies are returned.
+	2) The "minsize" option selects all bodies with annotations that have at least the
+	   given number of voxels.  This requires a sync with a labelmap instance.
+	3) The "roi" option returns connections among all bodies for synapses whose PostSyn
+	   is within the ROI.  This requires a sync with a labelmap instance.
+
+	The returned JSON is sorted by descending weight, where weight is the number of
+	PreSyn -> PostSyn pairs between the bodies:
+
+	[
+		{ "PreBody": 23, "PostBody": 1897, "Weight": 12 },
+		{ "PreBody": 1897, "PostBody": 88, "Weight": 3 },
+		...
+	]
+
+	GET Query-string Options:
+
+	bodies      Comma-separated list of body IDs.
+	minsize     Minimum number of voxels for a body to be included.
+	roi         Name of ROI data instance, optionally followed by a comma and the UUID
+	            of the ROI version, e.g., "medulla,3f8c".  The UUID defaults to this version.
+
+
 GET <api URL>/node/<UUID>/<data name>/scan[?<options>]
 
 	Scans the annotations stored in blocks and returns simple stats on usage
@@ -300,6 +369,9 @@ POST <api URL>/node/<UUID>/<data name>/blocks[?<options>]
 	This low-level ingestion also does not transmit subscriber events to associated
 	synced data (e.g., labelsz).
 
+	Any element IDs in the POSTed elements are kept and indexed, so blocks retrieved
+	via GET can be ingested into a new instance without changing IDs.
+
 	The POSTed JSON should be similar to the GET version with the block coordinate as 
 	the key:
 
@@ -314,16 +386,18 @@ POST <api URL>/node/<UUID>/<data name>/blocks[?<options>]
 	kafkalog    Set to "off" if you don't want this mutation logged to kafka.
 
 
-POST <api URL>/node/<UUID>/<data name>/move/<from_coord>/<to_coord>[?<options>]
+POST <api URL>/node/<UUID>/<data name>/move/<from_coord or ID>/<to_coord>[?<options>]
 
 	Moves the point annotation from <from_coord> to <to_coord> where
-	<from_coord> and <to_coord> are of the form X_Y_Z.
+	<from_coord> and <to_coord> are of the form X_Y_Z.  The point annotation
+	to be moved can also be given by its element ID, which is kept after the move.
 
-	Kafka JSON message generated by this request where "User" is optional:
+	Kafka JSON message generated by this request where "User" and "ID" are optional:
 		{ 
 			"Action": "element-move",
 			"From": <3d point>,
 			"To": <3d point>,
+			"ID": <element ID>,
 			"UUID": <UUID on which move was done>,
 			User: <user name>
 		}
@@ -340,6 +414,7 @@ Example JSON Format of point annotation elements with ... marking omitted elemen
 
 [
 	{
+		"ID":1,
 		"Pos":[33,30,31],
 		"Kind":"PostSyn",
 		"Rels":[ 
@@ -376,6 +451,9 @@ Example JSON Format of point annotation elements with ... marking omitted elemen
 	...
 ]
 
+The "ID" property is assigned by the server when elements are POSTed and stays with
+the element when it is moved.  Elements stored before IDs were introduced have no "ID".
+
 The "Kind" property can be one of "Unknown", "PostSyn", "PreSyn", "Gap", or "Note".
 
 The "Rel" property can be one of "UnknownRelationship", "PostSynTo", "PreSynTo", "ConvergentTo", or "GroupedWith".
@@ -678,6 +756,7 @@ func (t Tags) Removed(t2 Tags) Tags {
 // used for label and tag annotations while block-indexed annotations include the
 // relationships.
 type ElementNR struct {
+	ID   uint64 `json:",omitempty"` // Assigned by server on POST /elements
 	Pos  dvid.Point3d
 	Kind ElementType
 	Tags Tags              // Indexed
@@ -685,13 +764,14 @@ type ElementNR struct {
 }
 
 func (e ElementNR) String() string {
-	s := fmt.Sprintf("Pos %s; Kind: %s; ", e.Pos, e.Kind)
+	s := fmt.Sprintf("ID %d; Pos %s; Kind: %s; ", e.ID, e.Pos, e.Kind)
 	s += fmt.Sprintf("Tags: %v; Prop: %v", e.Tags, e.Prop)
 	return s
 }
 
 func (e ElementNR) Copy() *ElementNR {
 	c := new(ElementNR)
+	c.ID = e.ID
 	c.Pos = e.Pos
 	c.Kind = e.Kind
 	c.Tags = make(Tags, len(e.Tags))
@@ -725,6 +805,7 @@ func (elems ElementsNR) Normalize() ElementsNR {
 	// For every element, create a duplicate that has sorted relationships and sorted tags.
 	out := make(ElementsNR, len(elems), len(elems))
 	for i, elem := range elems {
+		out[i].ID = elem.ID
 		out[i].Pos = elem.Pos
 		out[i].Kind = elem.Kind
 		out[i].Tags = make(Tags, len(elem.Tags))
@@ -834,6 +915,7 @@ func (elems Elements) Normalize() Elements {
 	// For every element, create a duplicate that has sorted relationships and sorted tags.
 	out := make(Elements, len(elems), len(elems))
 	for i, elem := range elems {
+		out[i].ID = elem.ID
 		out[i].Pos = elem.Pos
 		out[i].Kind = elem.Kind
 		out[i].Rels = make(Relationships, len(elem.Rels))
@@ -1165,6 +1247,11 @@ type Data struct {
 
 	denormOngoing bool // true if we are doing denormalizations so avoid ops on them.
 
+	// Largest element ID allocated across all versions, loaded from the store on first use.
+	maxElementID       uint64
+	maxElementIDLoaded bool
+	elementIDMu        sync.Mutex
+
 	sync.RWMutex // For CAS ops.  TODO: Make more specific (e.g., point locks) for efficiency.
 }
 
@@ -1175,6 +1262,16 @@ func (d *Data) Equals(d2 *Data) bool {
 	return reflect.DeepEqual(d.Properties, d2.Properties)
 }
 
+// IsMutationRequest overrides the default behavior to specify POST /connectivity as an
+// immutable request.
+func (d *Data) IsMutationRequest(action, endpoint string) bool {
+	lc := strings.ToLower(action)
+	if endpoint == "connectivity" && lc == "post" {
+		return false
+	}
+	return d.Data.IsMutationRequest(action, endpoint) // default for rest.
+}
+
 // blockSize is either defined by any synced labelblk or by the default block size.
 // Also checks to make sure that synced data is consistent.
 func (d *Data) blockSize() dvid.Point3d {
@@ -2197,6 +2294,7 @@ func (d *Data) StoreBlocks(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff bo
 	batch := batcher.NewBatch(ctx)
 
 	var blockX, blockY, blockZ int32
+	var maxID uint64
 	for key, elems := range blocks {
 		_, err := fmt.Sscanf(key, "%d,%d,%d", &blockX, &blockY, &blockZ)
 		if err != nil {
@@ -2207,6 +2305,15 @@ func (d *Data) StoreBlocks(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff bo
 		if err := putBatchElements(batch, tk, elems); err != nil {
 			return 0, err
 		}
+		putElementIDs(batch, elems)
+		for _, elem := range elems {
+			if elem.ID > maxID {
+				maxID = elem.ID
+			}
+		}
+	}
+	if err := d.reserveElementIDs(maxID); err != nil {
+		return 0, err
 	}
 
 	if !kafkaOff {
@@ -2238,15 +2345,16 @@ func (d *Data) StoreBlocks(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff bo
 }
 
 // StoreElements performs a synchronous store of synapses in JSON format, not
-// returning until the data and its denormalizations are complete.
-func (d *Data) StoreElements(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff bool) error {
+// returning until the data and its denormalizations are complete.  The IDs of
+// the stored elements are returned in the order the elements were posted.
+func (d *Data) StoreElements(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff bool) ([]uint64, error) {
 	jsonBytes, err := ioutil.ReadAll(r)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	var elems Elements
 	if err := json.Unmarshal(jsonBytes, &elems); err != nil {
-		return err
+		return nil, err
 	}
 
 	// d.Lock()
@@ -2258,6 +2366,30 @@ func (d *Data) StoreElements(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff
 	addToBlock := make(map[dvid.IZYXString]Elements)
 	tagDelta := make(map[Tag]tagDeltaT)
 
+	// Find current elements under the blocks.
+	curBlocks := make(map[dvid.IZYXString]Elements)
+	for _, elem := range elems {
+		izyxStr := elem.Pos.ToBlockIZYXString(blockSize)
+		if _, found := curBlocks[izyxStr]; found {
+			continue
+		}
+		bcoord, err := izyxStr.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		curBlockE, err := getElements(ctx, NewBlockTKey(bcoord))
+		if err != nil {
+			return nil, err
+		}
+		curBlocks[izyxStr] = curBlockE
+	}
+
+	// Elements replacing current ones keep their IDs while new elements get new IDs.
+	ids, err := d.assignElementIDs(elems, curBlocks)
+	if err != nil {
+		return nil, err
+	}
+
 	// Organize added elements into blocks
 	for _, elem := range elems {
 		// Get block coord for this element.
@@ -2268,47 +2400,39 @@ func (d *Data) StoreElements(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff
 		be = append(be, elem)
 		addToBlock[izyxStr] = be
 	}
-
-	// Find current elements under the blocks.
 	for izyxStr, elems := range addToBlock {
-		bcoord, err := izyxStr.ToChunkPoint3d()
-		if err != nil {
-			return err
-		}
-		tk := NewBlockTKey(bcoord)
-		curBlockE, err := getElements(ctx, tk)
-		if err != nil {
-			return err
-		}
-		addTagDelta(elems, curBlockE, tagDelta)
+		addTagDelta(elems, curBlocks[izyxStr], tagDelta)
 	}
 
 	// Do modifications under a batch.
 	store, err := d.KVStore()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	batcher, ok := store.(storage.KeyValueBatcher)
 	if !ok {
-		return fmt.Errorf("data type annotation requires batch-enabled store, which %q is not", store)
+		return nil, fmt.Errorf("data type annotation requires batch-enabled store, which %q is not", store)
 	}
 	batch := batcher.NewBatch(ctx)
 
 	// Store the new block elements
 	if err := d.storeBlockElements(ctx, batch, addToBlock); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Store new elements among label denormalizations
 	if err := d.storeLabelElements(ctx, batch, elems); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Store the new tag elements
 	if err := d.modifyTagElements(ctx, batch, tagDelta); err != nil {
-		return err
+		return nil, err
 	}
 
+	// Index the element IDs
+	putElementIDs(batch, elems)
+
 	if !kafkaOff {
 		// store synapse info into blob store for kakfa reference
 		var postRef string
@@ -2334,7 +2458,7 @@ func (d *Data) StoreElements(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff
 		}
 	}
 
-	return batch.Commit()
+	return ids, batch.Commit()
 }
 
 func (d *Data) DeleteElement(ctx *datastore.VersionedCtx, pt dvid.Point3d, kafkaOff bool) error {
@@ -2388,6 +2512,10 @@ func (d *Data) DeleteElement(ctx *datastore.VersionedCtx, pt dvid.Point3d, kafka
 		return err
 	}
 
+	if deleted.ID != 0 {
+		batch.Delete(NewElementIDTKey(deleted.ID))
+	}
+
 	if !kafkaOff {
 		versionuuid, _ := datastore.UUIDFromVersion(ctx.VersionID())
 		msginfo := map[string]interface{}{
@@ -2396,6 +2524,9 @@ func (d *Data) DeleteElement(ctx *datastore.VersionedCtx, pt dvid.Point3d, kafka
 			"UUID":      string(versionuuid),
 			"Timestamp": time.Now().String(),
 		}
+		if deleted.ID != 0 {
+			msginfo["ID"] = deleted.ID
+		}
 		if ctx.User != "" {
 			msginfo["User"] = ctx.User
 		}
@@ -2462,6 +2593,7 @@ func (d *Data) MoveElement(ctx *datastore.VersionedCtx, from, to dvid.Point3d, k
 			return err
 		}
 	}
+	putElementIDs(batch, Elements{*moved})
 
 	if err := batch.Commit(); err != nil {
 		return err
@@ -2476,6 +2608,9 @@ func (d *Data) MoveElement(ctx *datastore.VersionedCtx, from, to dvid.Point3d, k
 			"UUID":      string(versionuuid),
 			"Timestamp": time.Now().String(),
 		}
+		if moved.ID != 0 {
+			msginfo["ID"] = moved.ID
+		}
 		if ctx.User != "" {
 			msginfo["User"] = ctx.User
 		}
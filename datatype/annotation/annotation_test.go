@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"reflect"
 	"runtime"
@@ -632,7 +633,22 @@ func getTag(tag Tag, elems Elements) Elements {
 	return result
 }
 
-var synapsesByBlocks = `{"0,0,0":[{"Pos":[15,27,35],"Kind":"PreSyn","Tags":["Synapse1","Zlt90"],"Prop":{"I'm not a PSD":"sure","Im a T-Bar":"yes","i'm really special":""},"Rels":[{"Rel":"PreSynTo","To":[20,30,40]},{"Rel":"PreSynTo","To":[14,25,37]},{"Rel":"PreSynTo","To":[33,30,31]}]},{"Pos":[20,30,40],"Kind":"PostSyn","Tags":["Synapse1"],"Prop":{},"Rels":[{"Rel":"PostSynTo","To":[15,27,35]}]},{"Pos":[14,25,37],"Kind":"PostSyn","Tags":["Synapse1","Zlt90"],"Prop":{},"Rels":[{"Rel":"PostSynTo","To":[15,27,35]}]},{"Pos":[33,30,31],"Kind":"PostSyn","Tags":["Synapse1","Zlt90"],"Prop":{},"Rels":[{"Rel":"PostSynTo","To":[15,27,35]}]}],"1,0,1":[{"Pos":[127,63,99],"Kind":"PreSyn","Tags":["Synapse2"],"Prop":{"I'm not a PSD":"not really","Im a T-Bar":"no","i'm not really special":"at all"},"Rels":[{"Rel":"PreSynTo","To":[88,47,80]},{"Rel":"PreSynTo","To":[120,65,100]},{"Rel":"PreSynTo","To":[126,67,98]}]},{"Pos":[88,47,80],"Kind":"PostSyn","Tags":["Synapse2"],"Prop":{},"Rels":[{"Rel":"GroupedWith","To":[14,25,37]},{"Rel":"PostSynTo","To":[127,63,99]},{"Rel":"GroupedWith","To":[20,30,40]}]}],"1,1,1":[{"Pos":[120,65,100],"Kind":"PostSyn","Tags":["Synapse2"],"Prop":{},"Rels":[{"Rel":"PostSynTo","To":[127,63,99]}]},{"Pos":[126,67,98],"Kind":"PostSyn","Tags":["Synapse2"],"Prop":{},"Rels":[{"Rel":"PostSynTo","To":[127,63,99]}]}]}`
+var synapsesByBlocks = `{"0,0,0":[{"ID":1,"Pos":[15,27,35],"Kind":"PreSyn","Tags":["Synapse1","Zlt90"],"Prop":{"I'm not a PSD":"sure","Im a T-Bar":"yes","i'm really special":""},"Rels":[{"Rel":"PreSynTo","To":[20,30,40]},{"Rel":"PreSynTo","To":[14,25,37]},{"Rel":"PreSynTo","To":[33,30,31]}]},{"ID":2,"Pos":[20,30,40],"Kind":"PostSyn","Tags":["Synapse1"],"Prop":{},"Rels":[{"Rel":"PostSynTo","To":[15,27,35]}]},{"ID":3,"Pos":[14,25,37],"Kind":"PostSyn","Tags":["Synapse1","Zlt90"],"Prop":{},"Rels":[{"Rel":"PostSynTo","To":[15,27,35]}]},{"ID":4,"Pos":[33,30,31],"Kind":"PostSyn","Tags":["Synapse1","Zlt90"],"Prop":{},"Rels":[{"Rel":"PostSynTo","To":[15,27,35]}]}],"1,0,1":[{"ID":5,"Pos":[127,63,99],"Kind":"PreSyn","Tags":["Synapse2"],"Prop":{"I'm not a PSD":"not really","Im a T-Bar":"no","i'm not really special":"at all"},"Rels":[{"Rel":"PreSynTo","To":[88,47,80]},{"Rel":"PreSynTo","To":[120,65,100]},{"Rel":"PreSynTo","To":[126,67,98]}]},{"ID":6,"Pos":[88,47,80],"Kind":"PostSyn","Tags":["Synapse2"],"Prop":{},"Rels":[{"Rel":"GroupedWith","To":[14,25,37]},{"Rel":"PostSynTo","To":[127,63,99]},{"Rel":"GroupedWith","To":[20,30,40]}]}],"1,1,1":[{"ID":7,"Pos":[120,65,100],"Kind":"PostSyn","Tags":["Synapse2"],"Prop":{},"Rels":[{"Rel":"PostSynTo","To":[127,63,99]}]},{"ID":8,"Pos":[126,67,98],"Kind":"PostSyn","Tags":["Synapse2"],"Prop":{},"Rels":[{"Rel":"PostSynTo","To":[127,63,99]}]}]}`
+
+// clearIDs removes server-assigned element IDs so responses can be compared with
+// expected elements that don't specify IDs.
+func clearIDs(elems interface{}) {
+	switch e := elems.(type) {
+	case Elements:
+		for i := range e {
+			e[i].ID = 0
+		}
+	case ElementsNR:
+		for i := range e {
+			e[i].ID = 0
+		}
+	}
+}
 
 func testResponse(t *testing.T, expected Elements, template string, args ...interface{}) {
 	url := fmt.Sprintf(template, args...)
@@ -642,6 +658,7 @@ func testResponse(t *testing.T, expected Elements, template string, args ...inte
 	if err := json.Unmarshal(returnValue, &got); err != nil {
 		t.Fatal(err)
 	}
+	clearIDs(got)
 	if !reflect.DeepEqual(expected.Normalize(), got.Normalize()) {
 		_, fn, line, _ := runtime.Caller(1)
 		var expectedStr, gotStr string
@@ -682,6 +699,7 @@ func testResponseLabel(t *testing.T, expected interface{}, template string, args
 		if err := json.Unmarshal(returnValue, &got); err != nil {
 			t.Fatal(err)
 		}
+		clearIDs(got)
 		if !reflect.DeepEqual(elems.Normalize(), got.Normalize()) {
 			_, fn, line, _ := runtime.Caller(1)
 			t.Errorf("Expected for %s [%s:%d]:\n%v\nGot:\n%v\n", url, fn, line, elems.Normalize(), got.Normalize())
@@ -701,6 +719,7 @@ func testResponseLabel(t *testing.T, expected interface{}, template string, args
 		if err := json.Unmarshal(returnValue, &got); err != nil {
 			t.Fatal(err)
 		}
+		clearIDs(got)
 		if !reflect.DeepEqual(elems.Normalize(), got.Normalize()) {
 			_, fn, line, _ := runtime.Caller(1)
 			t.Errorf("Expected for %s [%s:%d]:\n%v\nGot:\n%v\n", url, fn, line, elems.Normalize(), got.Normalize())
@@ -776,7 +795,7 @@ func TestRequests(t *testing.T) {
 	data.SetTags(tags)
 	blocksURL = fmt.Sprintf("%snode/%s/%s/blocks/45_23_40/66_10_70", server.WebAPIPath, uuid, data.DataName())
 	ret = server.TestHTTP(t, "GET", blocksURL, nil)
-	expectedResult := `{"1,0,1":[{"Pos":[127,63,99],"Kind":"PreSyn","Tags":["Synapse2"],"Prop":{"I'm not a PSD":"not really","Im a T-Bar":"no","i'm not really special":"at all"},"Rels":[{"Rel":"PreSynTo","To":[88,47,80]},{"Rel":"PreSynTo","To":[120,65,100]},{"Rel":"PreSynTo","To":[126,67,98]}]},{"Pos":[88,47,80],"Kind":"PostSyn","Tags":["Synapse2"],"Prop":{},"Rels":[{"Rel":"GroupedWith","To":[14,25,37]},{"Rel":"PostSynTo","To":[127,63,99]},{"Rel":"GroupedWith","To":[20,30,40]}]}]}`
+	expectedResult := `{"1,0,1":[{"ID":5,"Pos":[127,63,99],"Kind":"PreSyn","Tags":["Synapse2"],"Prop":{"I'm not a PSD":"not really","Im a T-Bar":"no","i'm not really special":"at all"},"Rels":[{"Rel":"PreSynTo","To":[88,47,80]},{"Rel":"PreSynTo","To":[120,65,100]},{"Rel":"PreSynTo","To":[126,67,98]}]},{"ID":6,"Pos":[88,47,80],"Kind":"PostSyn","Tags":["Synapse2"],"Prop":{},"Rels":[{"Rel":"GroupedWith","To":[14,25,37]},{"Rel":"PostSynTo","To":[127,63,99]},{"Rel":"GroupedWith","To":[20,30,40]}]}]}`
 	if string(ret) != expectedResult {
 		t.Fatalf("Did not get all synapse elements returned from GET /blocks with ScanAllForBlocks:\nGot: %s\nExpected: %s\n", string(ret), expectedResult)
 	}
@@ -935,6 +954,151 @@ func TestPostLabels(t *testing.T) {
 	}
 }
 
+func TestElementIDs(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", dvid.Config{})
+
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	var ids []uint64
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", url, bytes.NewBuffer(testJSON)), &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != len(testData) {
+		t.Fatalf("expected %d IDs from POST, got %v\n", len(testData), ids)
+	}
+	for i, id := range ids {
+		if id != uint64(i+1) {
+			t.Fatalf("expected sequential IDs from POST, got %v\n", ids)
+		}
+	}
+
+	// modifying an element keeps its ID while new elements get new IDs.
+	modified := Elements{testData[1], testData[0]}
+	modified[0].Prop = map[string]string{"conf": "0.5"}
+	modified[1].Pos = dvid.Point3d{1, 2, 3}
+	testJSON, err = json.Marshal(modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", url, bytes.NewBuffer(testJSON)), &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != 2 || ids[1] != uint64(len(testData)+1) {
+		t.Fatalf("unexpected IDs after modification: %v\n", ids)
+	}
+
+	// GET by ID and by coordinate.
+	var elem Element
+	url = fmt.Sprintf("%snode/%s/mysynapses/element/2", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", url, nil), &elem); err != nil {
+		t.Fatal(err)
+	}
+	if elem.ID != 2 || !elem.Pos.Equals(testData[1].Pos) || elem.Prop["conf"] != "0.5" {
+		t.Fatalf("bad element returned for ID 2: %v\n", elem)
+	}
+	url = fmt.Sprintf("%snode/%s/mysynapses/element/127_63_99", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", url, nil), &elem); err != nil {
+		t.Fatal(err)
+	}
+	if elem.ID != 5 {
+		t.Fatalf("bad element returned for 127_63_99: %v\n", elem)
+	}
+
+	// move by ID keeps the ID and updates relationships.
+	url = fmt.Sprintf("%snode/%s/mysynapses/move/5/127_64_100", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, nil)
+	url = fmt.Sprintf("%snode/%s/mysynapses/element/5", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", url, nil), &elem); err != nil {
+		t.Fatal(err)
+	}
+	if !elem.Pos.Equals(dvid.Point3d{127, 64, 100}) {
+		t.Fatalf("expected element 5 to be moved, got %v\n", elem)
+	}
+	url = fmt.Sprintf("%snode/%s/mysynapses/element/6", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", url, nil), &elem); err != nil {
+		t.Fatal(err)
+	}
+	var relMoved bool
+	for _, rel := range elem.Rels {
+		if rel.To.Equals(dvid.Point3d{127, 64, 100}) {
+			relMoved = true
+		}
+	}
+	if !relMoved {
+		t.Fatalf("expected relationship of element 6 to follow moved element, got %v\n", elem)
+	}
+
+	// delete by ID removes the element and its ID.
+	url = fmt.Sprintf("%snode/%s/mysynapses/element/5", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "DELETE", url, nil)
+	server.TestBadHTTP(t, "GET", url, nil)
+	server.TestBadHTTP(t, "DELETE", url, nil)
+	url = fmt.Sprintf("%snode/%s/mysynapses/element/9999", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", url, nil)
+}
+
+func TestQuery(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", dvid.Config{})
+
+	elems := Elements{
+		{ElementNR: ElementNR{Pos: dvid.Point3d{10, 10, 10}, Kind: PreSyn, Tags: Tags{"a", "b"}, Prop: map[string]string{"conf": "0.9", "user": "x"}}},
+		{ElementNR: ElementNR{Pos: dvid.Point3d{20, 10, 10}, Kind: PostSyn, Tags: Tags{"a"}, Prop: map[string]string{"conf": "0.4", "user": "y"}}},
+		{ElementNR: ElementNR{Pos: dvid.Point3d{200, 10, 10}, Kind: PostSyn, Tags: Tags{"b"}, Prop: map[string]string{"conf": "0.7", "user": "x"}}},
+		{ElementNR: ElementNR{Pos: dvid.Point3d{300, 300, 300}, Kind: Note, Prop: map[string]string{"conf": "high"}}},
+	}
+	testJSON, err := json.Marshal(elems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBuffer(testJSON))
+
+	tests := []struct {
+		query    string
+		expected Elements
+	}{
+		{"query", elems},
+		{"query?kind=PostSyn", Elements{elems[1], elems[2]}},
+		{"query?kind=PreSyn,Note", Elements{elems[0], elems[3]}},
+		{"query?tags=a", Elements{elems[0], elems[1]}},
+		{"query?tags=a,b", Elements{elems[0]}},
+		{"query?tags=b&prop.user=x", Elements{elems[0], elems[2]}},
+		{"query?u=foo&app=bar&prop.user=x", Elements{elems[0], elems[2]}},
+		{"query?u=foo", elems},
+		{"query?prop.user=x", Elements{elems[0], elems[2]}},
+		{"query?propmin.conf=0.5", Elements{elems[0], elems[2]}},
+		{"query?propmin.conf=0.5&propmax.conf=0.8", Elements{elems[2]}},
+		{"query?propmax.conf=0.5&kind=PreSyn", Elements{}},
+		{"query/100_100_100/0_0_0", Elements{elems[0], elems[1]}},
+		{"query/400_400_400/0_0_0?kind=PostSyn&propmin.conf=0.6", Elements{elems[2]}},
+	}
+	for _, tc := range tests {
+		testResponse(t, tc.expected, "%snode/%s/mysynapses/%s", server.WebAPIPath, uuid, tc.query)
+	}
+
+	url = fmt.Sprintf("%snode/%s/mysynapses/query?kind=Bad", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", url, nil)
+	url = fmt.Sprintf("%snode/%s/mysynapses/query?propmin.conf=high", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", url, nil)
+	url = fmt.Sprintf("%snode/%s/mysynapses/query?foo=bar", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", url, nil)
+}
+
 var testBlocksReturn = `{"1,1,1":[{"Pos":[65,70,75],"Kind":"PostSyn","Tags":["Synapse1"],"Prop":null,"Rels":[{"Rel":"PostSynTo","To":[129,130,131]}]}],"2,2,2":[{"Pos":[129,130,131],"Kind":"PreSyn","Tags":["Synapse1"],"Prop":{"I'm not a PSD":"not really","Im a T-Bar":"no","i'm not really special":"at all"},"Rels":[{"Rel":"PreSynTo","To":[129,130,131]},{"Rel":"PreSynTo","To":[65,70,75]}]},{"Pos":[130,131,132],"Kind":"PostSyn","Tags":["Synapse1"],"Prop":null,"Rels":[{"Rel":"PostSynTo","To":[129,130,131]}]}]}`
 
 func TestPostBlocksAndAll(t *testing.T) {
@@ -1875,6 +2039,81 @@ func TestMappedLabels(t *testing.T) {
 	testMappedLabels(t, uuid, "mylabelmap", "mylabelmap")
 }
 
+func TestConnectivity(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "mylabelmap", config)
+	_ = createLabelTestVolume(t, uuid, "mylabelmap")
+	if err := datastore.BlockOnUpdating(uuid, "mylabelmap"); err != nil {
+		t.Fatalf("Error blocking on labelmap update: %v\n", err)
+	}
+
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestSync(t, uuid, "mysynapses", "mylabelmap")
+
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBuffer(testJSON))
+
+	// ROI covers voxels (0,0,0) to (63,31,63) so excludes the PostSyn at (88,47,80).
+	server.CreateTestInstance(t, uuid, "roi", "myroi", config)
+	url = fmt.Sprintf("%snode/%s/myroi/roi", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBufferString("[[0,0,0,1],[1,0,0,1]]"))
+
+	all := `[{"PreBody":1,"PostBody":2,"Weight":1},{"PreBody":1,"PostBody":3,"Weight":1},{"PreBody":3,"PostBody":4,"Weight":1}]`
+	tests := []struct {
+		method   string
+		query    string
+		body     string
+		expected string
+	}{
+		{"POST", "", "[1,2,3,4]", all},
+		{"POST", "", "[4,3]", `[{"PreBody":3,"PostBody":4,"Weight":1}]`},
+		{"GET", "bodies=1,3", "", `[{"PreBody":1,"PostBody":3,"Weight":1}]`},
+		{"GET", "bodies=2,4", "", `[]`},
+		{"GET", "minsize=1", "", all},
+		{"GET", "minsize=100000000", "", `[]`},
+		{"GET", "roi=myroi", "", `[{"PreBody":1,"PostBody":2,"Weight":1},{"PreBody":1,"PostBody":3,"Weight":1}]`},
+		{"GET", "roi=myroi," + string(uuid), "", `[{"PreBody":1,"PostBody":2,"Weight":1},{"PreBody":1,"PostBody":3,"Weight":1}]`},
+	}
+	for _, tc := range tests {
+		url = fmt.Sprintf("%snode/%s/mysynapses/connectivity?%s", server.WebAPIPath, uuid, tc.query)
+		var payload io.Reader
+		if tc.body != "" {
+			payload = strings.NewReader(tc.body)
+		}
+		got := server.TestHTTP(t, tc.method, url, payload)
+		if string(got) != tc.expected {
+			t.Errorf("connectivity %s %q %s: expected %s, got %s\n", tc.method, tc.query, tc.body, tc.expected, string(got))
+		}
+	}
+
+	url = fmt.Sprintf("%snode/%s/mysynapses/connectivity", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", url, nil)
+	url = fmt.Sprintf("%snode/%s/mysynapses/connectivity?bodies=1&minsize=10", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", url, nil)
+	url = fmt.Sprintf("%snode/%s/mysynapses/connectivity?minsize=abc", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", url, nil)
+
+	// POSTed body list is a query and allowed on committed nodes.
+	if err := datastore.Commit(uuid, "connectivity test", nil); err != nil {
+		t.Fatalf("unable to commit node %s: %v\n", uuid, err)
+	}
+	url = fmt.Sprintf("%snode/%s/mysynapses/connectivity", server.WebAPIPath, uuid)
+	if got := server.TestHTTP(t, "POST", url, strings.NewReader("[1,2,3,4]")); string(got) != all {
+		t.Errorf("connectivity POST on committed node: expected %s, got %s\n", all, string(got))
+	}
+}
+
 func TestSupervoxelSplit(t *testing.T) {
 	if err := server.OpenTest(); err != nil {
 		t.Fatalf("can't open test server: %v\n", err)
@@ -0,0 +1,200 @@
+/*
+	This file supports body-to-body connectivity computed from synaptic relationships.
+*/
+
+package annotation
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/labelmap"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// Connection is a weighted edge from a body with PreSyn elements to a body with
+// PostSyn elements, where the weight is the number of PreSyn -> PostSyn pairs.
+type Connection struct {
+	PreBody  uint64
+	PostBody uint64
+	Weight   uint32
+}
+
+// Connections is a connectivity table sorted by descending weight.
+type Connections []Connection
+
+func (c Connections) Len() int {
+	return len(c)
+}
+
+func (c Connections) Less(i, j int) bool {
+	if c[i].Weight != c[j].Weight {
+		return c[i].Weight > c[j].Weight
+	}
+	if c[i].PreBody != c[j].PreBody {
+		return c[i].PreBody < c[j].PreBody
+	}
+	return c[i].PostBody < c[j].PostBody
+}
+
+func (c Connections) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+// synapticPair is a PreSyn and PostSyn position connected by relationships.
+type synapticPair struct {
+	pre, post dvid.Point3d
+}
+
+// addSynapticPairs adds the PreSyn -> PostSyn pairs given by the relationships of elements.
+// Pairs are added whether the relationship is stored with the PreSyn, PostSyn, or both.
+func addSynapticPairs(pairs map[synapticPair]struct{}, elems Elements) {
+	for _, elem := range elems {
+		for _, rel := range elem.Rels {
+			switch {
+			case elem.Kind == PreSyn && rel.Rel == PreSynTo:
+				pairs[synapticPair{elem.Pos, rel.To}] = struct{}{}
+			case elem.Kind == PostSyn && rel.Rel == PostSynTo:
+				pairs[synapticPair{rel.To, elem.Pos}] = struct{}{}
+			}
+		}
+	}
+}
+
+// connectionsFromPairs returns the connectivity table given body lookups for the positions
+// of synaptic pairs.  Pairs with either position not in a body are ignored.
+func connectionsFromPairs(pairs map[synapticPair]struct{}, bodyAt func(dvid.Point3d) (uint64, bool)) Connections {
+	weights := make(map[[2]uint64]uint32)
+	for pair := range pairs {
+		preBody, found := bodyAt(pair.pre)
+		if !found {
+			continue
+		}
+		postBody, found := bodyAt(pair.post)
+		if !found {
+			continue
+		}
+		weights[[2]uint64{preBody, postBody}]++
+	}
+	conns := make(Connections, 0, len(weights))
+	for bodies, weight := range weights {
+		conns = append(conns, Connection{PreBody: bodies[0], PostBody: bodies[1], Weight: weight})
+	}
+	sort.Sort(conns)
+	return conns
+}
+
+// GetConnectivity returns the weighted connections among the given bodies using the
+// label denormalizations, which are kept current by syncs with label data.
+func (d *Data) GetConnectivity(ctx *datastore.VersionedCtx, bodies []uint64) (Connections, error) {
+	posBody := make(map[string]uint64)
+	pairs := make(map[synapticPair]struct{})
+	for _, body := range bodies {
+		if body == 0 {
+			continue
+		}
+		elems, err := d.getExpandedElements(ctx, NewLabelTKey(body))
+		if err != nil {
+			return nil, err
+		}
+		for _, elem := range elems {
+			posBody[elem.Pos.MapKey()] = body
+		}
+		addSynapticPairs(pairs, elems)
+	}
+	return connectionsFromPairs(pairs, func(pt dvid.Point3d) (uint64, bool) {
+		body, found := posBody[pt.MapKey()]
+		return body, found
+	}), nil
+}
+
+// GetBodiesAboveSize returns the bodies with annotations that have at least the given
+// number of voxels.  This requires a sync with a labelmap instance.
+func (d *Data) GetBodiesAboveSize(ctx *datastore.VersionedCtx, minSize uint64) ([]uint64, error) {
+	var lm *labelmap.Data
+	for dataUUID := range d.SyncedData() {
+		if source, err := labelmap.GetByDataUUID(dataUUID); err == nil {
+			lm = source
+			break
+		}
+	}
+	if lm == nil {
+		return nil, fmt.Errorf("annotation %q must be synced with a labelmap instance to select bodies by size", d.DataName())
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	tkeys, err := store.KeysInRange(ctx, NewLabelTKey(1), NewLabelTKey(0xFFFFFFFFFFFFFFFF))
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]uint64, 0, len(tkeys))
+	for _, tk := range tkeys {
+		label, err := DecodeLabelTKey(tk)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	sizes, err := labelmap.GetLabelSizes(lm, ctx.VersionID(), labels, false)
+	if err != nil {
+		return nil, err
+	}
+	var bodies []uint64
+	for i, label := range labels {
+		if sizes[i] >= minSize {
+			bodies = append(bodies, label)
+		}
+	}
+	return bodies, nil
+}
+
+// GetROIConnectivity returns the weighted connections among all bodies for synapses whose
+// PostSyn element is within the ROI.  This requires a sync with a labelmap instance.
+func (d *Data) GetROIConnectivity(ctx *datastore.VersionedCtx, roiSpec storage.FilterSpec) (Connections, error) {
+	labelData, ok := d.getSyncedLabels().(labelPointType)
+	if !ok {
+		return nil, fmt.Errorf("annotation %q must be synced with a labelmap instance to get ROI connectivity", d.DataName())
+	}
+	elems, err := d.GetROISynapses(ctx, roiSpec)
+	if err != nil {
+		return nil, err
+	}
+	inROI := make(map[string]struct{}, len(elems))
+	for _, elem := range elems {
+		if elem.Kind == PostSyn {
+			inROI[elem.Pos.MapKey()] = struct{}{}
+		}
+	}
+	allPairs := make(map[synapticPair]struct{})
+	addSynapticPairs(allPairs, elems)
+	pairs := make(map[synapticPair]struct{}, len(allPairs))
+	ptIndex := make(map[string]int)
+	var pts []dvid.Point3d
+	for pair := range allPairs {
+		if _, found := inROI[pair.post.MapKey()]; !found {
+			continue
+		}
+		pairs[pair] = struct{}{}
+		for _, pt := range []dvid.Point3d{pair.pre, pair.post} {
+			if _, found := ptIndex[pt.MapKey()]; !found {
+				ptIndex[pt.MapKey()] = len(pts)
+				pts = append(pts, pt)
+			}
+		}
+	}
+	labels, err := labelData.GetLabelPoints(ctx.VersionID(), pts, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	return connectionsFromPairs(pairs, func(pt dvid.Point3d) (uint64, bool) {
+		i, found := ptIndex[pt.MapKey()]
+		if !found || labels[i] == 0 {
+			return 0, false
+		}
+		return labels[i], true
+	}), nil
+}
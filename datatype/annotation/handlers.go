@@ -361,30 +361,66 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 
 		case "post":
 			kafkaOff := r.URL.Query().Get("kafkalog") == "off"
-			if err := d.StoreElements(ctx, r.Body, kafkaOff); err != nil {
+			ids, err := d.StoreElements(ctx, r.Body, kafkaOff)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			jsonBytes, err := json.Marshal(ids)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-type", "application/json")
+			if _, err := w.Write(jsonBytes); err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
+			timedLog.Infof("HTTP %s: posted %d synapse elements (%s)", r.Method, len(ids), r.URL)
 		default:
 			server.BadRequest(w, r, "Only GET or POST action is available on 'elements' endpoint.")
 			return
 		}
 
 	case "element":
-		// DELETE <api URL>/node/<UUID>/<data name>/element/<coord>
-		if action != "delete" {
-			server.BadRequest(w, r, "Only DELETE action is available on 'element' endpoint.")
+		// GET <api URL>/node/<UUID>/<data name>/element/<coord or ID>
+		// DELETE <api URL>/node/<UUID>/<data name>/element/<coord or ID>
+		if action != "get" && action != "delete" {
+			server.BadRequest(w, r, "Only GET or DELETE action is available on 'element' endpoint.")
 			return
 		}
 		if len(parts) < 5 {
-			server.BadRequest(w, r, "Must include coordinate after DELETE on 'element' endpoint.")
+			server.BadRequest(w, r, "Must include coordinate or ID after 'element' endpoint.")
 			return
 		}
-		pt, err := dvid.StringToPoint3d(parts[4], "_")
+		pt, err := d.elementPosition(ctx, parts[4])
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
 		}
+		if action == "get" {
+			elem, err := d.getElement(ctx, pt)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if elem == nil {
+				server.BadRequest(w, r, "no element at %s in annotation %q", pt, d.DataName())
+				return
+			}
+			jsonBytes, err := json.Marshal(elem)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-type", "application/json")
+			if _, err := w.Write(jsonBytes); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			timedLog.Infof("HTTP %s: get synaptic element at %s (%s)", r.Method, pt, r.URL)
+			return
+		}
 		kafkaOff := r.URL.Query().Get("kafkalog") == "off"
 		if err := d.DeleteElement(ctx, pt, kafkaOff); err != nil {
 			server.BadRequest(w, r, err)
@@ -392,8 +428,144 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 		timedLog.Infof("HTTP %s: delete synaptic element at %s (%s)", r.Method, pt, r.URL)
 
+	case "query":
+		// GET <api URL>/node/<UUID>/<data name>/query[/<size>/<offset>]?<options>
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'query' endpoint.")
+			return
+		}
+		var ext3d *dvid.Extents3d
+		switch len(parts) {
+		case 4:
+		case 6:
+			var err error
+			if ext3d, err = dvid.NewExtents3dFromStrings(parts[5], parts[4], "_"); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		default:
+			server.BadRequest(w, r, "Expect either no arguments or size and offset after 'query' endpoint.")
+			return
+		}
+		q, err := ParseElementQuery(r.URL.Query())
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		elems, err := d.QueryElements(ctx, q, ext3d)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if elems == nil {
+			elems = Elements{}
+		}
+		jsonBytes, err := json.Marshal(elems)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: query returned %d synapse elements (%s)", r.Method, len(elems), r.URL)
+
+	case "connectivity":
+		// GET  <api URL>/node/<UUID>/<data name>/connectivity?<options>
+		// POST <api URL>/node/<UUID>/<data name>/connectivity
+		if action != "get" && action != "post" {
+			server.BadRequest(w, r, "Only GET or POST actions are available on 'connectivity' endpoint.")
+			return
+		}
+		queryStrings := r.URL.Query()
+		bodiesStr := queryStrings.Get("bodies")
+		minSizeStr := queryStrings.Get("minsize")
+		roiStr := queryStrings.Get("roi")
+		var numModes int
+		for _, opt := range []string{bodiesStr, minSizeStr, roiStr} {
+			if opt != "" {
+				numModes++
+			}
+		}
+		if action == "post" {
+			numModes++
+		}
+		if numModes != 1 {
+			server.BadRequest(w, r, "connectivity requires exactly one of a POSTed body list, 'bodies', 'minsize', or 'roi'")
+			return
+		}
+		var conns Connections
+		var err error
+		switch {
+		case action == "post", bodiesStr != "":
+			var bodies []uint64
+			if action == "post" {
+				data, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				if err := json.Unmarshal(data, &bodies); err != nil {
+					server.BadRequest(w, r, fmt.Sprintf("expected JSON list of body IDs: %v", err))
+					return
+				}
+			} else {
+				for _, bodyStr := range strings.Split(bodiesStr, ",") {
+					body, err := strconv.ParseUint(strings.TrimSpace(bodyStr), 10, 64)
+					if err != nil {
+						server.BadRequest(w, r, "bad body ID %q in 'bodies' option", bodyStr)
+						return
+					}
+					bodies = append(bodies, body)
+				}
+			}
+			conns, err = d.GetConnectivity(ctx, bodies)
+		case minSizeStr != "":
+			var minSize uint64
+			if minSize, err = strconv.ParseUint(minSizeStr, 10, 64); err != nil {
+				server.BadRequest(w, r, "bad 'minsize' option %q", minSizeStr)
+				return
+			}
+			var bodies []uint64
+			if bodies, err = d.GetBodiesAboveSize(ctx, minSize); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			conns, err = d.GetConnectivity(ctx, bodies)
+		default:
+			roiParts := strings.Split(roiStr, ",")
+			roiSpec := "roi:"
+			switch len(roiParts) {
+			case 1:
+				roiSpec += roiParts[0] + "," + string(uuid)
+			case 2:
+				roiSpec += roiStr
+			default:
+				server.BadRequest(w, r, "Bad ROI specification: %q", roiStr)
+				return
+			}
+			conns, err = d.GetROIConnectivity(ctx, storage.FilterSpec(roiSpec))
+		}
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(conns)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: connectivity returned %d connections (%s)", r.Method, len(conns), r.URL)
+
 	case "move":
-		// POST <api URL>/node/<UUID>/<data name>/move/<from_coord>/<to_coord>
+		// POST <api URL>/node/<UUID>/<data name>/move/<from_coord or ID>/<to_coord>
 		if action != "post" {
 			server.BadRequest(w, r, "Only POST action is available on 'move' endpoint.")
 			return
@@ -402,7 +574,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			server.BadRequest(w, r, "Must include 'from' and 'to' coordinate after 'move' endpoint.")
 			return
 		}
-		fromPt, err := dvid.StringToPoint3d(parts[4], "_")
+		fromPt, err := d.elementPosition(ctx, parts[4])
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -0,0 +1,191 @@
+/*
+	This file supports stable IDs for point annotation elements.
+*/
+
+package annotation
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// loadMaxElementID makes sure the largest allocated element ID is in memory.
+// Caller must hold elementIDMu.
+func (d *Data) loadMaxElementID() error {
+	if d.maxElementIDLoaded {
+		return nil
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	ctx := storage.NewDataContext(d, 0)
+	data, err := store.Get(ctx, maxElementIDTKey)
+	if err != nil {
+		return err
+	}
+	if len(data) == 8 {
+		d.maxElementID = binary.LittleEndian.Uint64(data)
+	} else if data != nil {
+		return fmt.Errorf("bad max element ID for annotation %q: expected 8 bytes, got %d", d.DataName(), len(data))
+	}
+	d.maxElementIDLoaded = true
+	return nil
+}
+
+// persistMaxElementID stores the largest allocated element ID.  Caller must hold elementIDMu.
+func (d *Data) persistMaxElementID() error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, d.maxElementID)
+	ctx := storage.NewDataContext(d, 0)
+	return store.Put(ctx, maxElementIDTKey, buf)
+}
+
+// newElementIDs allocates n new element IDs, returning the first of the consecutive IDs.
+// IDs are unique across all versions of the data instance.
+func (d *Data) newElementIDs(n int) (first uint64, err error) {
+	d.elementIDMu.Lock()
+	defer d.elementIDMu.Unlock()
+	if err = d.loadMaxElementID(); err != nil {
+		return
+	}
+	first = d.maxElementID + 1
+	d.maxElementID += uint64(n)
+	err = d.persistMaxElementID()
+	return
+}
+
+// reserveElementIDs makes sure new element IDs will be larger than the given ID,
+// e.g., after ingesting elements with IDs.
+func (d *Data) reserveElementIDs(id uint64) error {
+	d.elementIDMu.Lock()
+	defer d.elementIDMu.Unlock()
+	if err := d.loadMaxElementID(); err != nil {
+		return err
+	}
+	if id <= d.maxElementID {
+		return nil
+	}
+	d.maxElementID = id
+	return d.persistMaxElementID()
+}
+
+// assignElementIDs sets the IDs of posted elements, given the current elements in
+// the affected blocks.  An element posted at the position of a current element keeps
+// that element's ID, and any other element gets a new ID.  IDs within the posted
+// elements are ignored since element positions can only be changed via moves.
+func (d *Data) assignElementIDs(elems Elements, curBlocks map[dvid.IZYXString]Elements) ([]uint64, error) {
+	curIDs := make(map[string]uint64)
+	for _, curBlockE := range curBlocks {
+		for _, elem := range curBlockE {
+			if elem.ID != 0 {
+				curIDs[elem.Pos.MapKey()] = elem.ID
+			}
+		}
+	}
+	newIndex := make(map[string]uint64) // 1-based index among new IDs for new positions
+	for _, elem := range elems {
+		key := elem.Pos.MapKey()
+		if _, found := curIDs[key]; !found && newIndex[key] == 0 {
+			newIndex[key] = uint64(len(newIndex) + 1)
+		}
+	}
+	var first uint64
+	if len(newIndex) > 0 {
+		var err error
+		if first, err = d.newElementIDs(len(newIndex)); err != nil {
+			return nil, err
+		}
+	}
+	ids := make([]uint64, len(elems))
+	for i, elem := range elems {
+		key := elem.Pos.MapKey()
+		if id, found := curIDs[key]; found {
+			elems[i].ID = id
+		} else {
+			elems[i].ID = first + newIndex[key] - 1
+		}
+		ids[i] = elems[i].ID
+	}
+	return ids, nil
+}
+
+// putElementIDs indexes the positions of the given elements by their IDs.
+func putElementIDs(batch storage.Batch, elems Elements) {
+	for _, elem := range elems {
+		if elem.ID != 0 {
+			batch.Put(NewElementIDTKey(elem.ID), elem.Pos.Bytes())
+		}
+	}
+}
+
+// GetElementByID returns the element with the given ID or nil if there is no such
+// element in the version.
+func (d *Data) GetElementByID(ctx *datastore.VersionedCtx, id uint64) (*Element, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	val, err := store.Get(ctx, NewElementIDTKey(id))
+	if err != nil || val == nil {
+		return nil, err
+	}
+	pt, err := dvid.Point3d{}.PointFromBytes(val)
+	if err != nil {
+		return nil, fmt.Errorf("bad position stored for element ID %d: %v", id, err)
+	}
+	// Make sure the element at the indexed position hasn't been replaced.
+	elem, err := d.getElement(ctx, pt)
+	if err != nil || elem == nil || elem.ID != id {
+		return nil, err
+	}
+	return elem, nil
+}
+
+// getElement returns the element at the given position or nil if there is none.
+func (d *Data) getElement(ctx *datastore.VersionedCtx, pt dvid.Point3d) (*Element, error) {
+	bcoord := pt.Chunk(d.blockSize()).(dvid.ChunkPoint3d)
+	elems, err := getElements(ctx, NewBlockTKey(bcoord))
+	if err != nil {
+		return nil, err
+	}
+	for _, elem := range elems {
+		if elem.Pos.Equals(pt) {
+			return elem.Copy(), nil
+		}
+	}
+	return nil, nil
+}
+
+// elementPosition returns the position of an element specified either by a coordinate
+// string of form "X_Y_Z" or an element ID.
+func (d *Data) elementPosition(ctx *datastore.VersionedCtx, s string) (dvid.Point3d, error) {
+	if strings.Contains(s, "_") {
+		return dvid.StringToPoint3d(s, "_")
+	}
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return dvid.Point3d{}, fmt.Errorf("expected coordinate or element ID, got %q", s)
+	}
+	elem, err := d.GetElementByID(ctx, id)
+	if err != nil {
+		return dvid.Point3d{}, err
+	}
+	if elem == nil {
+		return dvid.Point3d{}, fmt.Errorf("no element with ID %d in annotation %q", id, d.DataName())
+	}
+	return elem.Pos, nil
+}
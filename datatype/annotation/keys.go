@@ -28,8 +28,16 @@ const (
 
 	// key is block coordinate.  value is serialization of synaptic elements.
 	keyBlock = 72
+
+	// key is element ID.  value is the position of the element with that ID.
+	keyElementID = 73
+
+	// unversioned key for the largest element ID allocated across all versions.
+	keyMaxElementID = 74
 )
 
+var maxElementIDTKey = storage.NewTKey(keyMaxElementID, nil)
+
 // DescribeTKeyClass returns a string explanation of what a particular TKeyClass
 // is used for.  Implements the datastore.TKeyClassDescriber interface.
 func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
@@ -40,11 +48,52 @@ func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
 		return "annotation label key"
 	case keyBlock:
 		return "annotation block coord key"
+	case keyElementID:
+		return "annotation element ID key"
+	case keyMaxElementID:
+		return "annotation max element ID key"
 	default:
 	}
 	return "unknown annotation key"
 }
 
+// DescribeTKey returns a human-readable description of a type-specific key, e.g., the block
+// coordinate, label, or tag.  Implements the datastore.TKeyDescriber interface.
+func (d *Data) DescribeTKey(tk storage.TKey) (string, error) {
+	class, err := tk.Class()
+	if err != nil {
+		return "", err
+	}
+	switch class {
+	case keyBlock:
+		pt, err := DecodeBlockTKey(tk)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("block %s", pt), nil
+	case keyLabel:
+		label, err := DecodeLabelTKey(tk)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("label %d", label), nil
+	case keyTag:
+		tag, err := DecodeTagTKey(tk)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("tag %q", tag), nil
+	case keyElementID:
+		id, err := DecodeElementIDTKey(tk)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("element ID %d", id), nil
+	default:
+		return d.DescribeTKeyClass(class), nil
+	}
+}
+
 // NewTagTKey returns a TKey for a given tag.
 func NewTagTKey(tag Tag) (storage.TKey, error) {
 	if len(tag) == 0 {
@@ -84,6 +133,27 @@ func DecodeLabelTKey(tk storage.TKey) (label uint64, err error) {
 	return
 }
 
+// NewElementIDTKey returns a TKey for a given element ID.
+func NewElementIDTKey(id uint64) storage.TKey {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, id)
+	return storage.NewTKey(keyElementID, buf)
+}
+
+// DecodeElementIDTKey returns the element ID corresponding to this type-specific key.
+func DecodeElementIDTKey(tk storage.TKey) (id uint64, err error) {
+	ibytes, err := tk.ClassBytes(keyElementID)
+	if err != nil {
+		return
+	}
+	if len(ibytes) != 8 {
+		err = fmt.Errorf("expected 8 byte element ID key, got %d bytes", len(ibytes))
+		return
+	}
+	id = binary.BigEndian.Uint64(ibytes)
+	return
+}
+
 func BlockTKeyRange() (min, max storage.TKey) {
 	return NewBlockTKey(dvid.MinChunkPoint3d), NewBlockTKey(dvid.MaxChunkPoint3d)
 }
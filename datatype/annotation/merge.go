@@ -0,0 +1,150 @@
+/*
+	This file supports type-specific automatic merging of annotation versions.
+*/
+
+package annotation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// decodes elements keyed by position along with the JSON for each element so
+// changes can be detected.
+func decodeMergeElements(val []byte) (map[string]Element, map[string][]byte, error) {
+	elemMap := make(map[string]Element)
+	jsonMap := make(map[string][]byte)
+	if val == nil {
+		return elemMap, jsonMap, nil
+	}
+	var elems Elements
+	if err := json.Unmarshal(val, &elems); err != nil {
+		return nil, nil, err
+	}
+	for _, elem := range elems.Normalize() {
+		b, err := json.Marshal(elem)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := elem.Pos.MapKey()
+		elemMap[key] = elem
+		jsonMap[key] = b
+	}
+	return elemMap, jsonMap, nil
+}
+
+// ResolveConflict implements the datastore.AutoMerger interface.  Elements stored under
+// a block, label, or tag key are merged by position: an element added, modified, or deleted
+// in a parent relative to the common ancestor is carried into the child, with earlier
+// parents taking priority if the same position was changed in more than one parent.
+// Since the label and tag denormalizations are merged using the same rule as blocks,
+// they stay consistent with the merged block elements.
+func (d *Data) ResolveConflict(ctx *datastore.VersionedCtx, c *datastore.MergeConflict) ([]byte, error) {
+	class, err := c.TKey.Class()
+	if err != nil {
+		return nil, err
+	}
+	if class != keyBlock && class != keyLabel && class != keyTag {
+		return c.PriorityValue(), nil
+	}
+	_, baseJSON, err := decodeMergeElements(c.Base)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode base elements: %v", err)
+	}
+	parentElems := make([]map[string]Element, len(c.Values))
+	parentJSON := make([]map[string][]byte, len(c.Values))
+	positions := make(map[string]struct{}, len(baseJSON))
+	for key := range baseJSON {
+		positions[key] = struct{}{}
+	}
+	for i, val := range c.Values {
+		if parentElems[i], parentJSON[i], err = decodeMergeElements(val); err != nil {
+			return nil, fmt.Errorf("unable to decode elements from parent %d: %v", i, err)
+		}
+		for key := range parentJSON[i] {
+			positions[key] = struct{}{}
+		}
+	}
+
+	var merged Elements
+	for key := range positions {
+		baseVal, inBase := baseJSON[key]
+		var elem Element
+		keep := false
+		if inBase {
+			// unchanged positions can use any parent that still has the element
+			for i := range c.Values {
+				if e, found := parentElems[i][key]; found {
+					elem, keep = e, true
+					break
+				}
+			}
+		}
+		for i := range c.Values {
+			val, found := parentJSON[i][key]
+			if found != inBase || (found && !bytes.Equal(val, baseVal)) {
+				elem, keep = parentElems[i][key], found
+				break
+			}
+		}
+		if keep {
+			merged = append(merged, elem)
+		}
+	}
+	if len(merged) == 0 {
+		return nil, nil
+	}
+	sort.Sort(merged)
+
+	if class == keyBlock {
+		return json.Marshal(merged)
+	}
+	elemsNR := make(ElementsNR, len(merged))
+	for i, elem := range merged {
+		elemsNR[i] = elem.ElementNR
+	}
+	return json.Marshal(elemsNR)
+}
+
+// MergeComplete implements the datastore.AutoMerger interface.  Annotations are not
+// cached, so nothing needs to be done.
+func (d *Data) MergeComplete(ctx *datastore.VersionedCtx, parents []dvid.VersionID) error {
+	return nil
+}
+
+// ManifestKey implements the datastore.ManifestKeyer interface so merge manifests can
+// select parents by block coordinate, label, or tag.
+func (d *Data) ManifestKey(tk storage.TKey) (datastore.ManifestKey, error) {
+	class, err := tk.Class()
+	if err != nil {
+		return datastore.ManifestKey{}, err
+	}
+	switch class {
+	case keyBlock:
+		pt, err := DecodeBlockTKey(tk)
+		if err != nil {
+			return datastore.ManifestKey{}, err
+		}
+		return datastore.ManifestKey{Block: &pt}, nil
+	case keyLabel:
+		label, err := DecodeLabelTKey(tk)
+		if err != nil {
+			return datastore.ManifestKey{}, err
+		}
+		return datastore.ManifestKey{Label: label}, nil
+	case keyTag:
+		tag, err := DecodeTagTKey(tk)
+		if err != nil {
+			return datastore.ManifestKey{}, err
+		}
+		return datastore.ManifestKey{Key: string(tag)}, nil
+	default:
+		return datastore.ManifestKey{}, nil
+	}
+}
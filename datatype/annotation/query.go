@@ -0,0 +1,239 @@
+/*
+	This file supports queries of point annotation elements by kind, tags and properties.
+*/
+
+package annotation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// ElementQuery describes the elements to be returned by a query.  An element must
+// match all specified criteria.
+type ElementQuery struct {
+	Kinds   []ElementType      // element must be one of these kinds if non-empty
+	Tags    Tags               // element must have all these tags
+	Props   map[string]string  // element property must equal given value
+	PropMin map[string]float64 // element property must be numeric and >= given value
+	PropMax map[string]float64 // element property must be numeric and <= given value
+}
+
+// standardQueryParams are DVID-wide query string options that aren't element criteria.
+var standardQueryParams = map[string]struct{}{
+	"u":           {},
+	"app":         {},
+	"interactive": {},
+	"admintoken":  {},
+}
+
+// ParseElementQuery returns a query given the query string options of a /query request.
+// Standard DVID options like the user "u" and application "app" are ignored.
+func ParseElementQuery(values url.Values) (*ElementQuery, error) {
+	q := &ElementQuery{
+		Props:   make(map[string]string),
+		PropMin: make(map[string]float64),
+		PropMax: make(map[string]float64),
+	}
+	for param, vals := range values {
+		if len(vals) == 0 {
+			continue
+		}
+		if _, found := standardQueryParams[param]; found {
+			continue
+		}
+		val := vals[len(vals)-1]
+		switch {
+		case param == "kind":
+			for _, kindStr := range strings.Split(val, ",") {
+				kind := StringToElementType(kindStr)
+				if kind == UnknownElem && kindStr != "Unknown" {
+					return nil, fmt.Errorf("unknown element kind %q in query", kindStr)
+				}
+				q.Kinds = append(q.Kinds, kind)
+			}
+		case param == "tags":
+			for _, tag := range strings.Split(val, ",") {
+				if tag != "" {
+					q.Tags = append(q.Tags, Tag(tag))
+				}
+			}
+		case strings.HasPrefix(param, "prop."):
+			q.Props[param[len("prop."):]] = val
+		case strings.HasPrefix(param, "propmin."):
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad numeric value for %q in query: %v", param, err)
+			}
+			q.PropMin[param[len("propmin."):]] = f
+		case strings.HasPrefix(param, "propmax."):
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad numeric value for %q in query: %v", param, err)
+			}
+			q.PropMax[param[len("propmax."):]] = f
+		default:
+			return nil, fmt.Errorf("unknown query option %q", param)
+		}
+	}
+	return q, nil
+}
+
+// Matches returns true if the element satisfies the query.
+func (q *ElementQuery) Matches(elem ElementNR) bool {
+	if len(q.Kinds) != 0 {
+		var found bool
+		for _, kind := range q.Kinds {
+			if elem.Kind == kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, tag := range q.Tags {
+		var found bool
+		for _, etag := range elem.Tags {
+			if etag == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for key, value := range q.Props {
+		if v, found := elem.Prop[key]; !found || v != value {
+			return false
+		}
+	}
+	for key, min := range q.PropMin {
+		f, ok := numericProp(elem, key)
+		if !ok || f < min {
+			return false
+		}
+	}
+	for key, max := range q.PropMax {
+		f, ok := numericProp(elem, key)
+		if !ok || f > max {
+			return false
+		}
+	}
+	return true
+}
+
+func numericProp(elem ElementNR, key string) (float64, bool) {
+	v, found := elem.Prop[key]
+	if !found {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+// QueryElements returns the elements, including relationships, that match the query.
+// If ext is nil, the whole data instance is searched.  If the query has tags and no
+// bounding box, the tag denormalization is used to find candidate elements.
+func (d *Data) QueryElements(ctx *datastore.VersionedCtx, q *ElementQuery, ext *dvid.Extents3d) (Elements, error) {
+	if ext != nil {
+		elems, err := d.GetRegionSynapses(ctx, ext)
+		if err != nil {
+			return nil, err
+		}
+		return q.filter(elems), nil
+	}
+	if len(q.Tags) != 0 {
+		return d.queryTagElements(ctx, q)
+	}
+
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	minTKey, maxTKey := BlockTKeyRange()
+	var elements Elements
+	err = store.ProcessRange(ctx, minTKey, maxTKey, nil, func(chunk *storage.Chunk) error {
+		if len(chunk.V) == 0 {
+			return nil
+		}
+		var blockElems Elements
+		if err := json.Unmarshal(chunk.V, &blockElems); err != nil {
+			return err
+		}
+		elements = append(elements, q.filter(blockElems)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return elements, nil
+}
+
+// queryTagElements uses the first tag's denormalization to find matching elements and
+// then retrieves them with relationships from their blocks.
+func (d *Data) queryTagElements(ctx *datastore.VersionedCtx, q *ElementQuery) (Elements, error) {
+	tk, err := NewTagTKey(q.Tags[0])
+	if err != nil {
+		return nil, err
+	}
+	tagElems, err := getElementsNR(ctx, tk)
+	if err != nil {
+		return nil, err
+	}
+	blockSize := d.blockSize()
+	matched := make(map[dvid.IZYXString]map[string]struct{})
+	for _, elem := range tagElems {
+		if !q.Matches(elem) {
+			continue
+		}
+		izyxStr := elem.Pos.ToBlockIZYXString(blockSize)
+		pts, found := matched[izyxStr]
+		if !found {
+			pts = make(map[string]struct{})
+			matched[izyxStr] = pts
+		}
+		pts[elem.Pos.MapKey()] = struct{}{}
+	}
+	var elements Elements
+	for izyxStr, pts := range matched {
+		bcoord, err := izyxStr.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		blockElems, err := getElements(ctx, NewBlockTKey(bcoord))
+		if err != nil {
+			return nil, err
+		}
+		for _, elem := range blockElems {
+			if _, found := pts[elem.Pos.MapKey()]; found && q.Matches(elem.ElementNR) {
+				elements = append(elements, elem)
+			}
+		}
+	}
+	sort.Sort(elements)
+	return elements, nil
+}
+
+func (q *ElementQuery) filter(elems Elements) Elements {
+	var matched Elements
+	for _, elem := range elems {
+		if q.Matches(elem.ElementNR) {
+			matched = append(matched, elem)
+		}
+	}
+	return matched
+}
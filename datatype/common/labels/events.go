@@ -150,6 +150,7 @@ type DeltaMergeEnd struct {
 
 // DeltaSplit describes the voxels modified during a split operation.
 // The Split field may be null if this is a coarse split only defined by block indices.
+// The SVSplits field is only set by datatypes that relabel supervoxels on a split.
 type DeltaSplit struct {
 	MutID        uint64
 	OldLabel     uint64
@@ -157,6 +158,7 @@ type DeltaSplit struct {
 	Split        dvid.BlockRLEs
 	SortedBlocks dvid.IZYXSlice
 	SplitVoxels  uint64
+	SVSplits     map[uint64]SVSplit
 }
 
 // DeltaSplitStart is the data sent during a SplitStartEvent.
@@ -0,0 +1,353 @@
+/*
+Package mesh provides surface mesh generation from binary 3d masks via marching cubes
+and serialization of meshes into the neuroglancer legacy precomputed, OBJ, and PLY formats.
+*/
+package mesh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// Format is a serialization format for meshes.
+type Format string
+
+const (
+	// NgMesh is the neuroglancer legacy (draco-free) precomputed mesh format: a little-endian
+	// uint32 vertex count, float32 x,y,z for each vertex, then uint32 vertex indices for
+	// each triangle.
+	NgMesh Format = "ngmesh"
+
+	// OBJ is the Wavefront OBJ text format.
+	OBJ Format = "obj"
+
+	// PLY is the binary little-endian Stanford PLY format.
+	PLY Format = "ply"
+)
+
+// ParseFormat returns the Format for a string, defaulting to NgMesh for an empty string.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", NgMesh:
+		return NgMesh, nil
+	case OBJ, PLY:
+		return Format(s), nil
+	default:
+		return "", fmt.Errorf("unknown mesh format %q, must be %q, %q, or %q", s, NgMesh, OBJ, PLY)
+	}
+}
+
+// ContentType returns the HTTP Content-Type for the format.
+func (f Format) ContentType() string {
+	if f == OBJ {
+		return "text/plain"
+	}
+	return "application/octet-stream"
+}
+
+// Mesh is a triangle mesh where each triangle is given by three indices into the
+// vertices, which are stored as consecutive x, y, z coordinates.
+type Mesh struct {
+	Vertices  []float32
+	Triangles []uint32
+}
+
+// NumVertices returns the number of vertices in the mesh.
+func (m *Mesh) NumVertices() int {
+	return len(m.Vertices) / 3
+}
+
+// NumTriangles returns the number of triangles in the mesh.
+func (m *Mesh) NumTriangles() int {
+	return len(m.Triangles) / 3
+}
+
+// Write serializes the mesh in the given format.
+func (m *Mesh) Write(w io.Writer, format Format) error {
+	switch format {
+	case NgMesh:
+		return m.writeNgMesh(w)
+	case OBJ:
+		return m.writeOBJ(w)
+	case PLY:
+		return m.writePLY(w)
+	default:
+		return fmt.Errorf("unknown mesh format %q", format)
+	}
+}
+
+// MarshalBinary returns the mesh in neuroglancer legacy precomputed format.
+func (m *Mesh) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := m.writeNgMesh(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary sets the mesh from data in neuroglancer legacy precomputed format.
+func (m *Mesh) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("mesh data too short: %d bytes", len(data))
+	}
+	numVertices := int(binary.LittleEndian.Uint32(data[0:4]))
+	pos := 4
+	if len(data) < pos+numVertices*12 {
+		return fmt.Errorf("mesh data has %d bytes, too short for %d vertices", len(data), numVertices)
+	}
+	m.Vertices = make([]float32, numVertices*3)
+	for i := range m.Vertices {
+		m.Vertices[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[pos : pos+4]))
+		pos += 4
+	}
+	remaining := len(data) - pos
+	if remaining%12 != 0 {
+		return fmt.Errorf("mesh data has %d bytes of triangle indices, not a multiple of 12", remaining)
+	}
+	m.Triangles = make([]uint32, remaining/4)
+	for i := range m.Triangles {
+		m.Triangles[i] = binary.LittleEndian.Uint32(data[pos : pos+4])
+		if int(m.Triangles[i]) >= numVertices {
+			return fmt.Errorf("mesh triangle index %d exceeds number of vertices %d", m.Triangles[i], numVertices)
+		}
+		pos += 4
+	}
+	return nil
+}
+
+func (m *Mesh) writeNgMesh(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.LittleEndian, uint32(m.NumVertices())); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, m.Vertices); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, m.Triangles); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (m *Mesh) writeOBJ(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i := 0; i < len(m.Vertices); i += 3 {
+		fmt.Fprintf(bw, "v %g %g %g\n", m.Vertices[i], m.Vertices[i+1], m.Vertices[i+2])
+	}
+	for i := 0; i < len(m.Triangles); i += 3 {
+		fmt.Fprintf(bw, "f %d %d %d\n", m.Triangles[i]+1, m.Triangles[i+1]+1, m.Triangles[i+2]+1)
+	}
+	return bw.Flush()
+}
+
+func (m *Mesh) writePLY(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "ply\nformat binary_little_endian 1.0\n")
+	fmt.Fprintf(bw, "element vertex %d\nproperty float x\nproperty float y\nproperty float z\n", m.NumVertices())
+	fmt.Fprintf(bw, "element face %d\nproperty list uchar uint vertex_indices\nend_header\n", m.NumTriangles())
+	if err := binary.Write(bw, binary.LittleEndian, m.Vertices); err != nil {
+		return err
+	}
+	for i := 0; i < len(m.Triangles); i += 3 {
+		if err := bw.WriteByte(3); err != nil {
+			return err
+		}
+		if err := binary.Write(bw, binary.LittleEndian, m.Triangles[i:i+3]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Builder accumulates marching cubes triangles over one or more subvolumes of a binary
+// mask, sharing vertices across calls so the resulting mesh is watertight.
+type Builder struct {
+	vertexIndex map[[3]int32]uint32 // vertex position in half-voxel units -> index
+	vertices    [][3]int32
+	triangles   []uint32
+}
+
+// NewBuilder returns a new mesh builder.
+func NewBuilder() *Builder {
+	return &Builder{vertexIndex: make(map[[3]int32]uint32)}
+}
+
+// March runs marching cubes over all cells whose lowest corner voxel is within [begin, end),
+// where the inside function returns true for voxels within the object.  Cells span the
+// centers of 2x2x2 voxels, so a cell with lowest corner voxel (x, y, z) needs the inside
+// function for voxels up to (x+1, y+1, z+1).  Each cell should only be marched once per
+// mesh.
+func (b *Builder) March(begin, end dvid.Point3d, inside func(x, y, z int32) bool) {
+	for z := begin[2]; z < end[2]; z++ {
+		for y := begin[1]; y < end[1]; y++ {
+			for x := begin[0]; x < end[0]; x++ {
+				b.MarchCell(x, y, z, inside)
+			}
+		}
+	}
+}
+
+// MarchCell runs marching cubes on the single cell with lowest corner voxel (x, y, z).
+func (b *Builder) MarchCell(x, y, z int32, inside func(x, y, z int32) bool) {
+	var cubeCase uint8
+	for c := uint8(0); c < 8; c++ {
+		pos := cornerPos[c]
+		if inside(x+pos[0], y+pos[1], z+pos[2]) {
+			cubeCase |= 1 << c
+		}
+	}
+	for _, edge := range triTable[cubeCase] {
+		ca, cb := cornerPos[edgeCorners[edge][0]], cornerPos[edgeCorners[edge][1]]
+		key := [3]int32{2*x + ca[0] + cb[0], 2*y + ca[1] + cb[1], 2*z + ca[2] + cb[2]}
+		index, found := b.vertexIndex[key]
+		if !found {
+			index = uint32(len(b.vertices))
+			b.vertexIndex[key] = index
+			b.vertices = append(b.vertices, key)
+		}
+		b.triangles = append(b.triangles, index)
+	}
+}
+
+// Mesh returns the mesh built so far, with vertices scaled by the given voxel size.
+// Vertex coordinates are such that voxel (0,0,0) spans from the origin to the voxel size.
+func (b *Builder) Mesh(voxelSize [3]float32) *Mesh {
+	m := &Mesh{
+		Vertices:  make([]float32, len(b.vertices)*3),
+		Triangles: make([]uint32, len(b.triangles)),
+	}
+	for i, key := range b.vertices {
+		for dim := 0; dim < 3; dim++ {
+			m.Vertices[i*3+dim] = (float32(key[dim])/2 + 0.5) * voxelSize[dim]
+		}
+	}
+	copy(m.Triangles, b.triangles)
+	return m
+}
+
+// Cube corner c is at (c&1, (c>>1)&1, (c>>2)&1) and the 12 cube edges each join two corners.
+var (
+	cornerPos   [8][3]int32
+	edgeCorners [12][2]uint8
+	triTable    [256][]uint8
+)
+
+// Build the marching cubes triangle table.  Rather than hard-coding the usual table, we derive
+// it from the isolines on each cube face.  Each face is traversed counter-clockwise when viewed
+// from outside the cube, and each isoline segment runs from an edge exiting the object to the
+// edge entering the inside corners just traversed.  Ambiguous faces therefore always separate
+// inside corners, which is consistent for both cubes sharing the face and gives watertight
+// meshes.  Segments are chained into loops that are triangulated as fans, wound so triangle
+// normals point out of the object.
+func init() {
+	for c := 0; c < 8; c++ {
+		cornerPos[c] = [3]int32{int32(c & 1), int32((c >> 1) & 1), int32((c >> 2) & 1)}
+	}
+	edgeOf := make(map[[2]uint8]uint8)
+	var numEdges uint8
+	for a := uint8(0); a < 8; a++ {
+		for dim := uint(0); dim < 3; dim++ {
+			b := a | (1 << dim)
+			if b == a {
+				continue
+			}
+			edgeCorners[numEdges] = [2]uint8{a, b}
+			edgeOf[[2]uint8{a, b}] = numEdges
+			edgeOf[[2]uint8{b, a}] = numEdges
+			numEdges++
+		}
+	}
+
+	// get corners of each face in counter-clockwise order viewed from outside.
+	var faces [6][4]uint8
+	for dim := 0; dim < 3; dim++ {
+		u, v := (dim+1)%3, (dim+2)%3
+		for side := int32(0); side < 2; side++ {
+			var corners [4]uint8
+			for i, uv := range [4][2]int32{{0, 0}, {1, 0}, {1, 1}, {0, 1}} {
+				var pos [3]int32
+				pos[dim], pos[u], pos[v] = side, uv[0], uv[1]
+				corners[i] = uint8(pos[0] + 2*pos[1] + 4*pos[2])
+			}
+			// (u, v, dim) is a right-handed frame, so the order above is counter-clockwise
+			// viewed from +dim.  Reverse it for the face at the low side.
+			if side == 0 {
+				corners[1], corners[3] = corners[3], corners[1]
+			}
+			faces[dim*2+int(side)] = corners
+		}
+	}
+
+	for cubeCase := 0; cubeCase < 256; cubeCase++ {
+		inside := func(c uint8) bool { return cubeCase&(1<<c) != 0 }
+		next := make(map[uint8]uint8)
+		for _, corners := range faces {
+			for k := 0; k < 4; k++ {
+				k1 := (k + 1) % 4
+				if !inside(corners[k]) || inside(corners[k1]) {
+					continue
+				}
+				exit := edgeOf[[2]uint8{corners[k], corners[k1]}]
+				j := k
+				for inside(corners[(j+3)%4]) {
+					j = (j + 3) % 4
+				}
+				entry := edgeOf[[2]uint8{corners[(j+3)%4], corners[j]}]
+				next[exit] = entry
+			}
+		}
+		var tris []uint8
+		for e := uint8(0); e < 12; e++ {
+			if _, found := next[e]; !found {
+				continue
+			}
+			loop := []uint8{e}
+			for cur := next[e]; cur != e; cur = next[cur] {
+				loop = append(loop, cur)
+				delete(next, loop[len(loop)-2])
+			}
+			delete(next, loop[len(loop)-1])
+
+			// Fan diagonals lying on a cube face could also be generated by the neighboring
+			// cube, so start the fan where all diagonals pass through the cube interior.
+			// Every loop in the table has such a start.
+			var start int
+			for s := 0; s < len(loop); s++ {
+				ok := true
+				for i := 2; i+1 < len(loop); i++ {
+					if edgesShareFace(loop[s], loop[(s+i)%len(loop)]) {
+						ok = false
+						break
+					}
+				}
+				if ok {
+					start = s
+					break
+				}
+			}
+			for i := 1; i+1 < len(loop); i++ {
+				tris = append(tris, loop[start], loop[(start+i+1)%len(loop)], loop[(start+i)%len(loop)])
+			}
+		}
+		triTable[cubeCase] = tris
+	}
+}
+
+// returns true if the two cube edges lie on a common cube face.
+func edgesShareFace(e1, e2 uint8) bool {
+	for dim := 0; dim < 3; dim++ {
+		side := cornerPos[edgeCorners[e1][0]][dim]
+		if cornerPos[edgeCorners[e1][1]][dim] == side &&
+			cornerPos[edgeCorners[e2][0]][dim] == side &&
+			cornerPos[edgeCorners[e2][1]][dim] == side {
+			return true
+		}
+	}
+	return false
+}
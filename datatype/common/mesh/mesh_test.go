@@ -0,0 +1,171 @@
+package mesh
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// checks that every directed triangle edge is matched by exactly one opposing edge,
+// i.e., the mesh is closed and consistently oriented, and returns its signed volume.
+func checkClosedMesh(t *testing.T, m *Mesh) float64 {
+	directed := make(map[[2]uint32]int)
+	for i := 0; i < len(m.Triangles); i += 3 {
+		for j := 0; j < 3; j++ {
+			a, b := m.Triangles[i+j], m.Triangles[i+(j+1)%3]
+			if a == b {
+				t.Fatalf("degenerate triangle %d: %v\n", i/3, m.Triangles[i:i+3])
+			}
+			directed[[2]uint32{a, b}]++
+		}
+	}
+	for edge, count := range directed {
+		if count != 1 {
+			t.Fatalf("directed edge %v used %d times\n", edge, count)
+		}
+		if directed[[2]uint32{edge[1], edge[0]}] != 1 {
+			t.Fatalf("directed edge %v has no opposing edge\n", edge)
+		}
+	}
+	var volume float64
+	for i := 0; i < len(m.Triangles); i += 3 {
+		var p [3][3]float64
+		for j := 0; j < 3; j++ {
+			v := m.Triangles[i+j]
+			for dim := 0; dim < 3; dim++ {
+				p[j][dim] = float64(m.Vertices[v*3+uint32(dim)])
+			}
+		}
+		volume += (p[0][0]*(p[1][1]*p[2][2]-p[1][2]*p[2][1]) -
+			p[0][1]*(p[1][0]*p[2][2]-p[1][2]*p[2][0]) +
+			p[0][2]*(p[1][0]*p[2][1]-p[1][1]*p[2][0])) / 6
+	}
+	return volume
+}
+
+func TestMarchingCubesTable(t *testing.T) {
+	for cubeCase := 0; cubeCase < 256; cubeCase++ {
+		if len(triTable[cubeCase])%3 != 0 {
+			t.Fatalf("case %d has bad triangle list: %v\n", cubeCase, triTable[cubeCase])
+		}
+		if (cubeCase == 0 || cubeCase == 255) != (len(triTable[cubeCase]) == 0) {
+			t.Fatalf("case %d has triangles %v\n", cubeCase, triTable[cubeCase])
+		}
+	}
+	// single inside corner should give single triangle cutting off corner.
+	if len(triTable[1]) != 3 {
+		t.Fatalf("expected one triangle for single corner, got %v\n", triTable[1])
+	}
+}
+
+func TestSingleVoxel(t *testing.T) {
+	b := NewBuilder()
+	b.March(dvid.Point3d{-1, -1, -1}, dvid.Point3d{1, 1, 1}, func(x, y, z int32) bool {
+		return x == 0 && y == 0 && z == 0
+	})
+	m := b.Mesh([3]float32{8, 8, 8})
+	if m.NumVertices() != 6 || m.NumTriangles() != 8 {
+		t.Fatalf("expected octahedron with 6 vertices and 8 triangles, got %d and %d\n", m.NumVertices(), m.NumTriangles())
+	}
+	volume := checkClosedMesh(t, m)
+	if volume <= 0 {
+		t.Fatalf("expected outward facing triangles with positive volume, got %f\n", volume)
+	}
+	for i := 0; i < len(m.Vertices); i++ {
+		if m.Vertices[i] < 0 || m.Vertices[i] > 8 {
+			t.Fatalf("vertex coordinate %f outside of voxel bounds\n", m.Vertices[i])
+		}
+	}
+}
+
+func TestRandomVolumes(t *testing.T) {
+	size := dvid.Point3d{12, 10, 9}
+	for trial := 0; trial < 20; trial++ {
+		mask := make([]bool, size.Prod())
+		for i := range mask {
+			mask[i] = rand.Intn(3) == 0
+		}
+		inside := func(x, y, z int32) bool {
+			if x < 0 || y < 0 || z < 0 || x >= size[0] || y >= size[1] || z >= size[2] {
+				return false
+			}
+			return mask[z*size[0]*size[1]+y*size[0]+x]
+		}
+		// march in two slabs to make sure vertices are shared across calls.
+		b := NewBuilder()
+		b.March(dvid.Point3d{-1, -1, -1}, dvid.Point3d{size[0], size[1], 4}, inside)
+		b.March(dvid.Point3d{-1, -1, 4}, size, inside)
+		m := b.Mesh([3]float32{1, 1, 1})
+		if volume := checkClosedMesh(t, m); volume <= 0 {
+			t.Fatalf("expected positive volume for random mask, got %f\n", volume)
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	b := NewBuilder()
+	b.March(dvid.Point3d{-1, -1, -1}, dvid.Point3d{2, 1, 1}, func(x, y, z int32) bool {
+		return (x == 0 || x == 1) && y == 0 && z == 0
+	})
+	m := b.Mesh([3]float32{4, 4, 40})
+
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 4+m.NumVertices()*12+m.NumTriangles()*12 {
+		t.Fatalf("bad ngmesh size %d\n", len(data))
+	}
+	var m2 Mesh
+	if err := m2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(m2.Vertices) != len(m.Vertices) || len(m2.Triangles) != len(m.Triangles) {
+		t.Fatalf("bad mesh round trip\n")
+	}
+	for i := range m.Vertices {
+		if m.Vertices[i] != m2.Vertices[i] {
+			t.Fatalf("vertex coordinate %d differs after round trip\n", i)
+		}
+	}
+	for i := range m.Triangles {
+		if m.Triangles[i] != m2.Triangles[i] {
+			t.Fatalf("triangle index %d differs after round trip\n", i)
+		}
+	}
+	if err := m2.UnmarshalBinary(data[:len(data)-4]); err == nil {
+		t.Fatalf("expected error on truncated ngmesh\n")
+	}
+
+	var buf bytes.Buffer
+	if err := m.Write(&buf, OBJ); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != m.NumVertices()+m.NumTriangles() || !strings.HasPrefix(lines[0], "v ") || !strings.HasPrefix(lines[len(lines)-1], "f ") {
+		t.Fatalf("bad OBJ output:\n%s\n", buf.String())
+	}
+
+	buf.Reset()
+	if err := m.Write(&buf, PLY); err != nil {
+		t.Fatal(err)
+	}
+	header := "end_header\n"
+	pos := bytes.Index(buf.Bytes(), []byte(header))
+	if !bytes.HasPrefix(buf.Bytes(), []byte("ply\n")) || pos < 0 {
+		t.Fatalf("bad PLY header\n")
+	}
+	if buf.Len()-pos-len(header) != m.NumVertices()*12+m.NumTriangles()*13 {
+		t.Fatalf("bad PLY body size\n")
+	}
+
+	if _, err := ParseFormat("stl"); err == nil {
+		t.Fatalf("expected error on unknown format\n")
+	}
+	if f, err := ParseFormat(""); err != nil || f != NgMesh {
+		t.Fatalf("expected default ngmesh format\n")
+	}
+}
@@ -0,0 +1,122 @@
+// +build ngprecomputed
+
+/*
+	This file supports export of uint8 image versions into neuroglancer precomputed format.
+*/
+
+package imageblk
+
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+	"github.com/janelia-flyem/dvid/storage/ngprecomputed"
+)
+
+// exportPrecomputed writes the given version of this data as a neuroglancer precomputed
+// image volume into a local directory.  Lower resolution scales are taken from any
+// instances with the same name and suffixes "_1", "_2", etc., which is how multi-scale
+// grayscale is named in DVID.  The encoding can be "raw" or "jpeg".
+func (d *Data) exportPrecomputed(uuid dvid.UUID, v dvid.VersionID, dir, encoding string, sharded bool) error {
+	timedLog := dvid.NewTimeLog()
+	scales := []*Data{d}
+	for level := 1; ; level++ {
+		name := dvid.InstanceName(fmt.Sprintf("%s_%d", d.DataName(), level))
+		dataservice, err := datastore.GetDataByUUIDName(uuid, name)
+		if err != nil {
+			break
+		}
+		scaleData, ok := dataservice.(*Data)
+		if !ok {
+			break
+		}
+		scales = append(scales, scaleData)
+	}
+
+	config := ngprecomputed.VolumeConfig{
+		VolumeType: "image",
+		DataType:   "uint8",
+		Scales:     make([]ngprecomputed.ScaleConfig, len(scales)),
+	}
+	for level, scaleData := range scales {
+		if scaleData.Values.BytesPerElement() != 1 {
+			return fmt.Errorf("data %q is not uint8 and can't be exported to precomputed", scaleData.DataName())
+		}
+		if scaleData.GridStore != "" {
+			return fmt.Errorf("data %q uses GridStore %q and can't be exported", scaleData.DataName(), scaleData.GridStore)
+		}
+		blockSize, ok := scaleData.BlockSize().(dvid.Point3d)
+		if !ok {
+			return fmt.Errorf("data %q does not have 3d block size", scaleData.DataName())
+		}
+		extents, err := scaleData.GetExtents(datastore.NewVersionedCtx(scaleData, v))
+		if err != nil {
+			return err
+		}
+		if extents.MinPoint == nil || extents.MaxPoint == nil {
+			return fmt.Errorf("data %q has no extents at version %d", scaleData.DataName(), v)
+		}
+		var size dvid.Point3d
+		var resolution [3]float64
+		for dim := uint8(0); dim < 3; dim++ {
+			if extents.MinPoint.Value(dim) < 0 {
+				return fmt.Errorf("data %q has negative coordinates, which can't be exported", scaleData.DataName())
+			}
+			size[dim] = extents.MaxPoint.Value(dim) + 1
+			resolution[dim] = float64(scaleData.Properties.Resolution.VoxelSize[dim])
+		}
+		config.Scales[level] = ngprecomputed.ScaleConfig{
+			ChunkSize:  blockSize,
+			Size:       size,
+			Resolution: resolution,
+			Encoding:   encoding,
+		}
+		if sharded {
+			config.Scales[level].SetDefaultSharding()
+		}
+	}
+
+	writer, err := ngprecomputed.NewWriter(dir, config)
+	if err != nil {
+		return err
+	}
+	var numBlocks int
+	for level, scaleData := range scales {
+		store, err := datastore.GetOrderedKeyValueDB(scaleData)
+		if err != nil {
+			return err
+		}
+		ctx := datastore.NewVersionedCtx(scaleData, v)
+		begTKey := NewTKeyByCoord(dvid.MinIndexZYX.ToIZYXString())
+		endTKey := NewTKeyByCoord(dvid.MaxIndexZYX.ToIZYXString())
+		err = store.ProcessRange(ctx, begTKey, endTKey, nil, func(c *storage.Chunk) error {
+			if c == nil || c.V == nil {
+				return nil
+			}
+			indexZYX, err := DecodeTKey(c.K)
+			if err != nil {
+				return err
+			}
+			data, _, err := dvid.DeserializeData(c.V, true)
+			if err != nil {
+				return fmt.Errorf("unable to deserialize block %s: %v", indexZYX, err)
+			}
+			if err := writer.WriteChunk(level, dvid.ChunkPoint3d(*indexZYX), data); err != nil {
+				dvid.Errorf("Skipping block %s of data %q in precomputed export: %v\n", indexZYX, scaleData.DataName(), err)
+				return nil
+			}
+			numBlocks++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	timedLog.Infof("Exported %d blocks in %d scales of data %q to precomputed volume %q", numBlocks, len(scales), d.DataName(), dir)
+	return nil
+}
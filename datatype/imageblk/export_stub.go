@@ -0,0 +1,14 @@
+// +build !ngprecomputed
+
+package imageblk
+
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// exportPrecomputed requires the ngprecomputed build tag.
+func (d *Data) exportPrecomputed(uuid dvid.UUID, v dvid.VersionID, dir, encoding string, sharded bool) error {
+	return fmt.Errorf("DVID was not built with ngprecomputed support")
+}
@@ -124,6 +124,29 @@ $ dvid node <UUID> <data name> roi <new roi data name> <background values separa
 
     $ dvid node 3f8c mygrayscale roi grayscale_roi 0,255
 
+$ dvid node <UUID> <data name> export-precomputed <directory> [encoding=jpeg] [sharded=true]
+
+    Asynchronously exports the given version of uint8 data into a local directory as a
+    neuroglancer precomputed volume.  Lower resolution scales are exported from any data
+    instances with the same name and "_1", "_2", ... suffixes.  Requires DVID built with
+    the "ngprecomputed" tag.  Errors are printed in the server log.
+
+    Example:
+
+    $ dvid node 3f8c grayscale export-precomputed /data/precomputed/grayscale encoding=raw
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data to export.
+    directory     Path of a directory on the server that will hold the exported volume.
+
+    Configuration Settings (case-insensitive keys):
+
+    encoding      Chunk encoding, either "jpeg" (default) or "raw".
+    sharded       If "true" (default), chunks are written into sharded files with gzip
+                    encoding of minishard indices and chunk data.
+
     
     ------------------
 
@@ -473,6 +496,26 @@ POST <api URL>/node/<UUID>/<data name>/blocks/<block coord>/<spanX>
     block coord   The block coordinate of the first block in X_Y_Z format.  Block coordinates
                   can be derived from voxel coordinates by dividing voxel coordinates by
                   the block size for a data type.
+
+GET <api URL>/node/<UUID>/<data name>/precomputed/info
+GET <api URL>/node/<UUID>/<data name>/precomputed/<scale key>/<x0-x1_y0-y1_z0-z1>
+
+    Serves the given version of uint8 data as a neuroglancer precomputed volume with "raw"
+    encoding, so neuroglancer can use a source like:
+
+    precomputed://http://myserver/api/node/3f8c/grayscale/precomputed
+
+    The "info" endpoint returns the JSON description of the volume, where the scale key is
+    based on the voxel resolution, e.g., "8_8_8", and chunk sizes match the block size.
+    Chunk requests return uint8 voxels within the given voxel ranges with X varying fastest,
+    and are gzip-encoded if the client accepts it.
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data.
+    scale key     Key of the scale given in the info JSON.
+    x0-x1_...     Voxel ranges (exclusive of end) along each dimension, each at most 512 voxels.
 `
 
 var (
@@ -1786,6 +1829,38 @@ func (d *Data) DoRPC(req datastore.Request, reply *datastore.Response) error {
 		}
 		return d.ForegroundROI(req, reply)
 
+	case "export-precomputed":
+		if len(req.Command) < 5 {
+			return fmt.Errorf("Poorly formatted export-precomputed command.  See command-line help.")
+		}
+		var uuidStr, dataName, cmdStr, dir string
+		req.CommandArgs(1, &uuidStr, &dataName, &cmdStr, &dir)
+		uuid, versionID, err := datastore.MatchingUUID(uuidStr)
+		if err != nil {
+			return err
+		}
+		settings := req.Settings()
+		encoding, found, err := settings.GetString("encoding")
+		if err != nil {
+			return err
+		}
+		if !found {
+			encoding = "jpeg"
+		}
+		sharded, found, err := settings.GetBool("sharded")
+		if err != nil {
+			return err
+		}
+		if !found {
+			sharded = true
+		}
+		go func() {
+			if err := d.exportPrecomputed(uuid, versionID, dir, encoding, sharded); err != nil {
+				dvid.Errorf("Cannot export data %q @ node %s to precomputed %q: %v\n", dataName, uuidStr, dir, err)
+			}
+		}()
+		reply.Text = fmt.Sprintf("Asynchronously exporting data %q @ node %s to precomputed volume %q (errors will be printed in server log) ...\n", dataName, uuidStr, dir)
+
 	default:
 		return fmt.Errorf("Unknown command.  Data instance '%s' [%s] does not support '%s' command.",
 			d.DataName(), d.TypeName(), req.TypeCommand())
@@ -2354,6 +2429,10 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			return
 		}
 
+	case "precomputed":
+		d.handlePrecomputed(ctx, w, r, parts)
+		timedLog.Infof("HTTP %s: precomputed (%s)", r.Method, r.URL)
+
 	case "blocks":
 		// GET  <api URL>/node/<UUID>/<data name>/blocks/<block coord>/<spanX>
 		// POST <api URL>/node/<UUID>/<data name>/blocks/<block coord>/<spanX>
@@ -40,6 +40,23 @@ func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
 	}
 }
 
+// DescribeTKey returns a human-readable description of a type-specific key, e.g., the block
+// coordinate.  Implements the datastore.TKeyDescriber interface.
+func (d *Data) DescribeTKey(tk storage.TKey) (string, error) {
+	class, err := tk.Class()
+	if err != nil {
+		return "", err
+	}
+	if class != keyImageBlock {
+		return d.DescribeTKeyClass(class), nil
+	}
+	idx, err := DecodeTKey(tk)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("block %s", dvid.ChunkPoint3d(*idx)), nil
+}
+
 // NewTKeyByCoord returns a TKey for a block coord in string format.
 func NewTKeyByCoord(izyx dvid.IZYXString) storage.TKey {
 	return storage.NewTKey(keyImageBlock, []byte(izyx))
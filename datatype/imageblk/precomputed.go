@@ -0,0 +1,200 @@
+/*
+	This file supports serving a version of data as a neuroglancer precomputed volume.
+*/
+
+package imageblk
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// MaxPrecomputedChunkSize is the maximum size along any dimension of a chunk request
+// to the neuroglancer precomputed endpoint.
+const MaxPrecomputedChunkSize = 512
+
+type precomputedScale struct {
+	ChunkSizes  []dvid.Point3d `json:"chunk_sizes"`
+	Encoding    string         `json:"encoding"`
+	Key         string         `json:"key"`
+	Resolution  [3]float64     `json:"resolution"`
+	Size        dvid.Point3d   `json:"size"`
+	VoxelOffset dvid.Point3d   `json:"voxel_offset"`
+}
+
+type precomputedInfo struct {
+	StoreType   string             `json:"@type"`
+	VolumeType  string             `json:"type"`
+	DataType    string             `json:"data_type"`
+	NumChannels int                `json:"num_channels"`
+	Scales      []precomputedScale `json:"scales"`
+}
+
+// PrecomputedScaleKey returns the key of a scale in the neuroglancer precomputed info,
+// which is based on the voxel resolution at that scale, e.g., "8_8_8".
+func (d *Data) PrecomputedScaleKey(scale uint8) string {
+	var res [3]float64
+	for dim := 0; dim < 3; dim++ {
+		res[dim] = float64(d.Properties.Resolution.VoxelSize[dim]) * float64(uint64(1)<<scale)
+	}
+	return fmt.Sprintf("%g_%g_%g", res[0], res[1], res[2])
+}
+
+// PrecomputedInfo returns the neuroglancer precomputed info JSON for the given version
+// with the given number of scales, each of which is 2x lower resolution than the prior.
+// The volume type is "image" or "segmentation" and the data type is, e.g., "uint8".
+func (d *Data) PrecomputedInfo(ctx *datastore.VersionedCtx, volumeType, dataType string, numScales int) ([]byte, error) {
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("data %q does not have 3d block size", d.DataName())
+	}
+	extents, err := d.GetExtents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if extents.MinPoint == nil || extents.MaxPoint == nil {
+		return nil, fmt.Errorf("data %q has no extents at version %s", d.DataName(), ctx.VersionUUID())
+	}
+	info := precomputedInfo{
+		StoreType:   "neuroglancer_multiscale_volume",
+		VolumeType:  volumeType,
+		DataType:    dataType,
+		NumChannels: 1,
+		Scales:      make([]precomputedScale, numScales),
+	}
+	for scale := 0; scale < numScales; scale++ {
+		var offset, size dvid.Point3d
+		var res [3]float64
+		for dim := uint8(0); dim < 3; dim++ {
+			// start at block boundary so chunk requests map to whole blocks.
+			minPt := extents.MinPoint.Value(dim) >> uint(scale)
+			maxPt := extents.MaxPoint.Value(dim) >> uint(scale)
+			if minPt >= 0 {
+				offset[dim] = (minPt / blockSize[dim]) * blockSize[dim]
+			} else {
+				offset[dim] = ((minPt - blockSize[dim] + 1) / blockSize[dim]) * blockSize[dim]
+			}
+			size[dim] = maxPt + 1 - offset[dim]
+			res[dim] = float64(d.Properties.Resolution.VoxelSize[dim]) * float64(uint64(1)<<uint(scale))
+		}
+		info.Scales[scale] = precomputedScale{
+			ChunkSizes:  []dvid.Point3d{blockSize},
+			Encoding:    "raw",
+			Key:         d.PrecomputedScaleKey(uint8(scale)),
+			Resolution:  res,
+			Size:        size,
+			VoxelOffset: offset,
+		}
+	}
+	return json.Marshal(info)
+}
+
+// ParsePrecomputedChunk returns the scale and subvolume for a neuroglancer precomputed
+// chunk request given the scale key and a chunk name of the form "x0-x1_y0-y1_z0-z1".
+func (d *Data) ParsePrecomputedChunk(scaleKey, chunkName string, numScales int) (scale uint8, subvol *dvid.Subvolume, err error) {
+	var found bool
+	for s := 0; s < numScales; s++ {
+		if d.PrecomputedScaleKey(uint8(s)) == scaleKey {
+			scale, found = uint8(s), true
+			break
+		}
+	}
+	if !found {
+		err = fmt.Errorf("unknown precomputed scale key %q", scaleKey)
+		return
+	}
+	var offset, size dvid.Point3d
+	ranges := strings.Split(chunkName, "_")
+	if len(ranges) != 3 {
+		err = fmt.Errorf("bad precomputed chunk name %q", chunkName)
+		return
+	}
+	for dim, rng := range ranges {
+		var beg, end int32
+		if _, err = fmt.Sscanf(rng, "%d-%d", &beg, &end); err != nil {
+			err = fmt.Errorf("bad precomputed chunk name %q: %v", chunkName, err)
+			return
+		}
+		if end <= beg || end-beg > MaxPrecomputedChunkSize {
+			err = fmt.Errorf("bad range %q in precomputed chunk name %q", rng, chunkName)
+			return
+		}
+		offset[dim] = beg
+		size[dim] = end - beg
+	}
+	subvol = dvid.NewSubvolume(offset, size)
+	return
+}
+
+// WritePrecomputedChunk writes chunk data for a neuroglancer precomputed request, using
+// gzip content encoding if the client accepts it.
+func WritePrecomputedChunk(w http.ResponseWriter, r *http.Request, data []byte) error {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	var out io.Writer = w
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		defer zw.Close()
+		out = zw
+	}
+	_, err := out.Write(data)
+	return err
+}
+
+// handles GET of precomputed info and chunks for uint8 image data.
+func (d *Data) handlePrecomputed(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/precomputed/info
+	// GET <api URL>/node/<UUID>/<data name>/precomputed/<scale key>/<x0-x1_y0-y1_z0-z1>
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "only GET action is available on precomputed endpoint")
+		return
+	}
+	if d.GridStore != "" {
+		server.BadRequest(w, r, "data %q does not support /precomputed endpoint since it is proxying data", d.DataName())
+		return
+	}
+	if d.Values.BytesPerElement() != 1 {
+		server.BadRequest(w, r, "data %q is not uint8 so can't be served as precomputed", d.DataName())
+		return
+	}
+	if len(parts) == 5 && parts[4] == "info" {
+		jsonBytes, err := d.PrecomputedInfo(ctx, "image", "uint8", 1)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(jsonBytes))
+		return
+	}
+	if len(parts) != 6 {
+		server.BadRequest(w, r, "precomputed endpoint must be followed by info or <scale key>/<chunk name>")
+		return
+	}
+	_, subvol, err := d.ParsePrecomputedChunk(parts[4], parts[5], 1)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	vox, err := d.NewVoxels(subvol, nil)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	data, err := d.GetVolume(ctx.VersionID(), vox, "")
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if err := WritePrecomputedChunk(w, r, data); err != nil {
+		dvid.Errorf("unable to write precomputed chunk %s: %v\n", subvol, err)
+	}
+}
@@ -464,3 +464,57 @@ func TestGrayscaleRepoPersistence(t *testing.T) {
 		t.Errorf("Expected %v, got %v\n", oldData, *grayscale2)
 	}
 }
+
+func TestPrecomputedAPI(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	makeGrayscale(uuid, t, "grayscale")
+
+	offset := dvid.Point3d{32, 32, 32}
+	size := dvid.Point3d{64, 64, 64}
+	vol := testVolume{
+		data:   makeVolume(offset, size),
+		offset: offset,
+		size:   size,
+	}
+	vol.put(t, uuid, "grayscale")
+	if err := datastore.BlockOnUpdating(uuid, "grayscale"); err != nil {
+		t.Fatalf("Error blocking on POST of grayscale: %v\n", err)
+	}
+
+	infoReq := fmt.Sprintf("%snode/%s/grayscale/precomputed/info", server.WebAPIPath, uuid)
+	infoJSON := server.TestHTTP(t, "GET", infoReq, nil)
+	var info struct {
+		Type     string `json:"type"`
+		DataType string `json:"data_type"`
+		Scales   []struct {
+			Key         string         `json:"key"`
+			ChunkSizes  []dvid.Point3d `json:"chunk_sizes"`
+			Size        dvid.Point3d   `json:"size"`
+			VoxelOffset dvid.Point3d   `json:"voxel_offset"`
+		} `json:"scales"`
+	}
+	if err := json.Unmarshal(infoJSON, &info); err != nil {
+		t.Fatalf("bad info JSON: %s\n", string(infoJSON))
+	}
+	if info.Type != "image" || info.DataType != "uint8" || len(info.Scales) != 1 {
+		t.Fatalf("bad info JSON: %s\n", string(infoJSON))
+	}
+	scale := info.Scales[0]
+	if scale.Key != "8_8_8" || scale.VoxelOffset != offset || scale.Size != size {
+		t.Fatalf("bad scale in info JSON: %s\n", string(infoJSON))
+	}
+
+	chunkReq := fmt.Sprintf("%snode/%s/grayscale/precomputed/8_8_8/32-96_32-96_32-96", server.WebAPIPath, uuid)
+	data := server.TestHTTP(t, "GET", chunkReq, nil)
+	if !bytes.Equal(data, vol.data) {
+		t.Errorf("precomputed chunk doesn't match posted volume\n")
+	}
+
+	badReq := fmt.Sprintf("%snode/%s/grayscale/precomputed/8_8_8/0-1024_0-64_0-64", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", badReq, nil)
+}
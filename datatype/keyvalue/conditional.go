@@ -0,0 +1,273 @@
+/*
+	This file supports conditional writes of key-value pairs using entity tags (ETags).
+*/
+
+package keyvalue
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+const (
+	numWriteShards = 64
+)
+
+// writeMu serializes writes to keys in the same shard so a conditional write can check
+// the current value and write without another write interleaving.
+var writeMu [numWriteShards]sync.Mutex
+
+// lockKeys locks the write shards of the given keys in ascending order to prevent
+// deadlocks, returning a function that unlocks them.
+func (d *Data) lockKeys(keys ...string) (unlock func()) {
+	shardSet := make(map[int]struct{}, len(keys))
+	for _, keyStr := range keys {
+		h := fnv.New32a()
+		h.Write([]byte(d.DataUUID()))
+		h.Write([]byte(keyStr))
+		shardSet[int(h.Sum32()%numWriteShards)] = struct{}{}
+	}
+	shards := make([]int, 0, len(shardSet))
+	for shard := range shardSet {
+		shards = append(shards, shard)
+	}
+	sort.Ints(shards)
+	for _, shard := range shards {
+		writeMu[shard].Lock()
+	}
+	return func() {
+		for _, shard := range shards {
+			writeMu[shard].Unlock()
+		}
+	}
+}
+
+// ETag returns the strong entity tag, including surrounding quotes, for a value.
+func ETag(value []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(value))
+}
+
+// Precondition holds the If-Match and If-None-Match conditions for a write.  Each is
+// either empty (no condition), "*", or a comma-separated list of ETags.
+type Precondition struct {
+	IfMatch     string
+	IfNoneMatch string
+}
+
+// GetPrecondition returns the precondition given by a request's headers.
+func GetPrecondition(r *http.Request) Precondition {
+	return Precondition{
+		IfMatch:     r.Header.Get("If-Match"),
+		IfNoneMatch: r.Header.Get("If-None-Match"),
+	}
+}
+
+// Empty returns true if there are no conditions.
+func (p Precondition) Empty() bool {
+	return p.IfMatch == "" && p.IfNoneMatch == ""
+}
+
+// matchesETag returns true if the condition is "*" or lists the given ETag.
+// Weak ETags are compared as strong ones.
+func matchesETag(condition, etag string) bool {
+	for _, tag := range strings.Split(condition, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns nil if the precondition holds for a key with the given current value.
+func (p Precondition) check(keyStr string, value []byte, found bool) error {
+	var etag string
+	if found {
+		etag = ETag(value)
+	}
+	if p.IfMatch != "" && (!found || !matchesETag(p.IfMatch, etag)) {
+		return &PreconditionFailedError{Key: keyStr, Header: "If-Match", Condition: p.IfMatch, ETag: etag}
+	}
+	if p.IfNoneMatch != "" && found && matchesETag(p.IfNoneMatch, etag) {
+		return &PreconditionFailedError{Key: keyStr, Header: "If-None-Match", Condition: p.IfNoneMatch, ETag: etag}
+	}
+	return nil
+}
+
+// PreconditionFailedError is returned when a conditional write isn't done because
+// the current value of a key doesn't satisfy the precondition.
+type PreconditionFailedError struct {
+	Key       string
+	Header    string
+	Condition string
+	ETag      string // current ETag of the key or empty if key doesn't exist.
+}
+
+func (e *PreconditionFailedError) Error() string {
+	if e.ETag == "" {
+		return fmt.Sprintf("precondition %s: %s failed for key %q, which doesn't exist", e.Header, e.Condition, e.Key)
+	}
+	return fmt.Sprintf("precondition %s: %s failed for key %q with ETag %s", e.Header, e.Condition, e.Key, e.ETag)
+}
+
+// PutDataIf puts a key-value only if the precondition holds for the key's current value.
+// A *PreconditionFailedError is returned if the precondition fails.
+func (d *Data) PutDataIf(ctx storage.Context, keyStr string, value []byte, p Precondition) error {
+	unlock := d.lockKeys(keyStr)
+	defer unlock()
+
+	if !p.Empty() {
+		curValue, found, err := d.GetData(ctx, keyStr)
+		if err != nil {
+			return err
+		}
+		if err := p.check(keyStr, curValue, found); err != nil {
+			return err
+		}
+	}
+	return d.putData(ctx, keyStr, value)
+}
+
+// DeleteDataIf deletes a key-value pair only if the precondition holds for the key's current
+// value.  A *PreconditionFailedError is returned if the precondition fails.
+func (d *Data) DeleteDataIf(ctx storage.Context, keyStr string, p Precondition) error {
+	unlock := d.lockKeys(keyStr)
+	defer unlock()
+
+	if !p.Empty() {
+		curValue, found, err := d.GetData(ctx, keyStr)
+		if err != nil {
+			return err
+		}
+		if err := p.check(keyStr, curValue, found); err != nil {
+			return err
+		}
+	}
+	return d.deleteData(ctx, keyStr)
+}
+
+// AtomicOp is a put or delete of a key within an atomic batch, conditioned on the key's
+// current value.
+type AtomicOp struct {
+	Key         string
+	Value       []byte // base64-encoded in JSON
+	Delete      bool
+	IfMatch     string `json:",omitempty"`
+	IfNoneMatch string `json:",omitempty"`
+}
+
+// PutAtomic commits a batch of puts and deletes only if all their preconditions hold,
+// returning the ETags of the put values.  Preconditions are checked against the values
+// before the batch.  A *PreconditionFailedError is returned if any precondition fails,
+// in which case no key is modified.
+func (d *Data) PutAtomic(ctx storage.Context, ops []AtomicOp) (map[string]string, error) {
+	batcher, err := datastore.GetKeyValueBatcher(d)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(ops))
+	tkeys := make([]storage.TKey, len(ops))
+	seen := make(map[string]struct{}, len(ops))
+	for i, op := range ops {
+		if _, found := seen[op.Key]; found {
+			return nil, fmt.Errorf("key %q is used more than once in atomic batch", op.Key)
+		}
+		seen[op.Key] = struct{}{}
+		keys[i] = op.Key
+		if op.Delete && len(op.Value) != 0 {
+			return nil, fmt.Errorf("key %q in atomic batch has both a value and a delete", op.Key)
+		}
+		if tkeys[i], err = NewTKey(op.Key); err != nil {
+			return nil, err
+		}
+	}
+
+	unlock := d.lockKeys(keys...)
+	defer unlock()
+
+	for _, op := range ops {
+		p := Precondition{IfMatch: op.IfMatch, IfNoneMatch: op.IfNoneMatch}
+		if p.Empty() {
+			continue
+		}
+		curValue, found, err := d.GetData(ctx, op.Key)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.check(op.Key, curValue, found); err != nil {
+			return nil, err
+		}
+	}
+	etags := make(map[string]string, len(ops))
+	batch := batcher.NewBatch(ctx)
+	for i, op := range ops {
+		if op.Delete {
+			batch.Delete(tkeys[i])
+			continue
+		}
+		serialization, err := dvid.SerializeData(op.Value, d.Compression(), d.Checksum())
+		if err != nil {
+			return nil, fmt.Errorf("Unable to serialize data: %v\n", err)
+		}
+		batch.Put(tkeys[i], serialization)
+		etags[op.Key] = ETag(op.Value)
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, fmt.Errorf("unable to commit atomic batch of %d keys: %v", len(ops), err)
+	}
+	return etags, nil
+}
+
+// handleAtomicIngest handles a POST /keyvalues?atomic=true and returns the number of keys
+// in the committed batch.
+func (d *Data) handleAtomicIngest(w http.ResponseWriter, r *http.Request, uuid dvid.UUID, ctx *datastore.VersionedCtx) (int, error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return 0, err
+	}
+	var ops []AtomicOp
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return 0, fmt.Errorf("bad atomic keyvalues JSON: %v", err)
+	}
+	etags, err := d.PutAtomic(ctx, ops)
+	if err != nil {
+		return 0, err
+	}
+	for _, op := range ops {
+		if op.Delete {
+			continue
+		}
+		msginfo := map[string]interface{}{
+			"Action":    "postkv",
+			"Key":       op.Key,
+			"Bytes":     len(op.Value),
+			"UUID":      string(uuid),
+			"Timestamp": time.Now().String(),
+		}
+		jsonmsg, _ := json.Marshal(msginfo)
+		if err = d.PublishKafkaMsg(jsonmsg); err != nil {
+			dvid.Errorf("Error on sending keyvalue POST op to kafka: %v\n", err)
+		}
+	}
+	jsonBytes, err := json.Marshal(etags)
+	if err != nil {
+		return 0, err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(jsonBytes); err != nil {
+		return 0, err
+	}
+	return len(ops), nil
+}
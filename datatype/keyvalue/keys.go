@@ -34,6 +34,16 @@ func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
 	return "unknown keyvalue key"
 }
 
+// DescribeTKey returns the quoted key for a type-specific key.  Implements the
+// datastore.TKeyDescriber interface.
+func (d *Data) DescribeTKey(tk storage.TKey) (string, error) {
+	key, err := DecodeTKey(tk)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("key %q", key), nil
+}
+
 // NewTKey returns the "key" key component.
 func NewTKey(key string) (storage.TKey, error) {
 	return storage.NewTKey(keyStandard, append([]byte(key), 0)), nil
@@ -217,6 +217,22 @@ HEAD <api URL>/node/<UUID>/<data name>/key/<key>
 	200 (OK) if a sparse volume of the given label exists within any optional bounds.
 	404 (File not Found) if there is no sparse volume for the given label within any optional bounds.
 
+	GET returns the value's entity tag in the "ETag" header, e.g., "9a0364b9e99bb480dd25e1f0284c8555"
+	including the quotes, which changes whenever the value changes.  POST returns the ETag
+	of the stored value in the same header.
+
+	POST and DELETE can be made conditional on the current value using standard headers:
+
+	If-Match        The write is done only if the key exists and its ETag is one of the
+	                  given comma-separated ETags, or for "*", if the key exists.
+	If-None-Match   The write is done only if the key doesn't exist or its ETag is not one
+	                  of the given ETags.  Use "*" to only create a new key.
+
+	If the condition fails, HTTP status code 412 (Precondition Failed) is returned and
+	the key is not modified.  For example, a client can read a value and its ETag, modify
+	the value, then POST it with the ETag in "If-Match" to avoid overwriting another
+	client's intervening change.
+
 	Arguments:
 
 	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
@@ -232,7 +248,7 @@ HEAD <api URL>/node/<UUID>/<data name>/key/<key>
 	}
 
 GET <api URL>/node/<UUID>/<data name>/keyvalues[?jsontar=true]
-POST <api URL>/node/<UUID>/<data name>/keyvalues
+POST <api URL>/node/<UUID>/<data name>/keyvalues[?atomic=true]
 
 	Allows batch query or ingest of data. 
 
@@ -255,6 +271,24 @@ POST <api URL>/node/<UUID>/<data name>/keyvalues
 	returned.  If a key is not found, it is included in return but with nil value (0 bytes or "{}").
 
 	For POST, the query body must include a KeyValues serialization.
+
+	For POST with "atomic=true", the query body must instead be a JSON array of
+	operations, each with optional preconditions that have the same meaning as the
+	If-Match and If-None-Match headers of POST /key:
+
+	[
+		{ "Key": "key1", "Value": <base64-encoded value>, "IfMatch": "\"<ETag>\"" },
+		{ "Key": "key2", "Value": <base64-encoded value>, "IfNoneMatch": "*" },
+		{ "Key": "key3", "Delete": true, "IfMatch": "*" },
+		...
+	]
+
+	All operations are committed in a single storage batch only if every precondition
+	holds for the values before the batch.  Otherwise, HTTP status code 412 (Precondition
+	Failed) is returned and no key is modified.  On success, JSON of the ETags of the put
+	values is returned:
+
+	{ "key1": "\"<ETag>\"", "key2": "\"<ETag>\"" }
 	
 	POSTs will be logged as a series of Kafka JSON messages, each with the format equivalent
 	to the single POST /key:
@@ -512,6 +546,12 @@ func (d *Data) GetData(ctx storage.Context, keyStr string) ([]byte, bool, error)
 
 // PutData puts a key-value at a given uuid
 func (d *Data) PutData(ctx storage.Context, keyStr string, value []byte) error {
+	unlock := d.lockKeys(keyStr)
+	defer unlock()
+	return d.putData(ctx, keyStr, value)
+}
+
+func (d *Data) putData(ctx storage.Context, keyStr string, value []byte) error {
 	db, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
 		return err
@@ -529,6 +569,12 @@ func (d *Data) PutData(ctx storage.Context, keyStr string, value []byte) error {
 
 // DeleteData deletes a key-value pair
 func (d *Data) DeleteData(ctx storage.Context, keyStr string) error {
+	unlock := d.lockKeys(keyStr)
+	defer unlock()
+	return d.deleteData(ctx, keyStr)
+}
+
+func (d *Data) deleteData(ctx storage.Context, keyStr string) error {
 	db, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
 		return err
@@ -717,6 +763,19 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			}
 			comment = fmt.Sprintf("HTTP GET keyvalues on %d keys, %d bytes, data %q", numKeys, writtenBytes, d.DataName())
 		case "post":
+			if r.URL.Query().Get("atomic") == "true" {
+				numKeys, err := d.handleAtomicIngest(w, r, uuid, ctx)
+				if err != nil {
+					if _, failed := err.(*PreconditionFailedError); failed {
+						http.Error(w, err.Error(), http.StatusPreconditionFailed)
+						return
+					}
+					server.BadRequest(w, r, err)
+					return
+				}
+				comment = fmt.Sprintf("HTTP POST atomic keyvalues on %d keys, data %q", numKeys, d.DataName())
+				break
+			}
 			if err := d.handleIngest(r, uuid, ctx); err != nil {
 				server.BadRequest(w, r, err)
 				return
@@ -759,18 +818,23 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				http.Error(w, fmt.Sprintf("Key %q not found", keyStr), http.StatusNotFound)
 				return
 			}
+			w.Header().Set("ETag", ETag(value))
 			if value != nil || len(value) > 0 {
+				w.Header().Set("Content-Type", "application/octet-stream")
 				_, err = w.Write(value)
 				if err != nil {
 					server.BadRequest(w, r, err)
 					return
 				}
-				w.Header().Set("Content-Type", "application/octet-stream")
 			}
 			comment = fmt.Sprintf("HTTP GET key %q of keyvalue %q: %d bytes (%s)", keyStr, d.DataName(), len(value), url)
 
 		case "delete":
-			if err := d.DeleteData(ctx, keyStr); err != nil {
+			if err := d.DeleteDataIf(ctx, keyStr, GetPrecondition(r)); err != nil {
+				if _, failed := err.(*PreconditionFailedError); failed {
+					http.Error(w, err.Error(), http.StatusPreconditionFailed)
+					return
+				}
 				server.BadRequest(w, r, err)
 				return
 			}
@@ -783,6 +847,17 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				return
 			}
 
+			err = d.PutDataIf(ctx, keyStr, data, GetPrecondition(r))
+			if err != nil {
+				if _, failed := err.(*PreconditionFailedError); failed {
+					http.Error(w, err.Error(), http.StatusPreconditionFailed)
+					return
+				}
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("ETag", ETag(data))
+
 			go func() {
 				msginfo := map[string]interface{}{
 					"Action":    "postkv",
@@ -792,16 +867,10 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 					"Timestamp": time.Now().String(),
 				}
 				jsonmsg, _ := json.Marshal(msginfo)
-				if err = d.PublishKafkaMsg(jsonmsg); err != nil {
+				if err := d.PublishKafkaMsg(jsonmsg); err != nil {
 					dvid.Errorf("Error on sending keyvalue POST op to kafka: %v\n", err)
 				}
 			}()
-
-			err = d.PutData(ctx, keyStr, data)
-			if err != nil {
-				server.BadRequest(w, r, err)
-				return
-			}
 			comment = fmt.Sprintf("HTTP POST keyvalue '%s': %d bytes (%s)", d.DataName(), len(data), url)
 		default:
 			server.BadRequest(w, r, "key endpoint does not support %q HTTP verb", action)
@@ -9,9 +9,11 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	pb "google.golang.org/protobuf/proto"
 
@@ -256,6 +258,152 @@ func TestKeyvalueRequests(t *testing.T) {
 	testRequest(t, uuid, versionID, "mykeyvalue")
 }
 
+// sends a request with the given headers and returns the response.
+func testConditionalHTTP(t *testing.T, method, urlStr string, payload io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, urlStr, payload)
+	if err != nil {
+		t.Fatalf("Unsuccessful %s on %q: %v\n", method, urlStr, err)
+	}
+	for header, value := range headers {
+		req.Header.Set(header, value)
+	}
+	w := httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	return w
+}
+
+func TestKeyvalueConditional(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	if _, err := datastore.NewData(uuid, kvtype, "configs", config); err != nil {
+		t.Fatalf("Error creating new keyvalue instance: %v\n", err)
+	}
+	keyreq := fmt.Sprintf("%snode/%s/configs/key/settings", server.WebAPIPath, uuid)
+
+	// Create-only POST succeeds for a new key then fails.
+	value1 := `{"version": 1}`
+	resp := testConditionalHTTP(t, "POST", keyreq, strings.NewReader(value1), map[string]string{"If-None-Match": "*"})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected create-only POST to succeed, got status %d: %s\n", resp.Code, resp.Body.String())
+	}
+	etag1 := resp.Header().Get("ETag")
+	if etag1 != ETag([]byte(value1)) {
+		t.Fatalf("expected POST ETag %s, got %s\n", ETag([]byte(value1)), etag1)
+	}
+	resp = testConditionalHTTP(t, "POST", keyreq, strings.NewReader(`{"version": 0}`), map[string]string{"If-None-Match": "*"})
+	if resp.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 on create-only POST of existing key, got %d\n", resp.Code)
+	}
+
+	// GET returns the ETag.
+	resp = server.TestHTTPResponse(t, "GET", keyreq, nil)
+	if resp.Code != http.StatusOK || resp.Body.String() != value1 {
+		t.Fatalf("bad GET of key (status %d): %s\n", resp.Code, resp.Body.String())
+	}
+	if resp.Header().Get("ETag") != etag1 {
+		t.Fatalf("expected GET ETag %s, got %s\n", etag1, resp.Header().Get("ETag"))
+	}
+
+	// Compare-and-swap: the first writer with the current ETag wins.
+	value2 := `{"version": 2}`
+	resp = testConditionalHTTP(t, "POST", keyreq, strings.NewReader(value2), map[string]string{"If-Match": etag1})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected POST with matching ETag to succeed, got status %d: %s\n", resp.Code, resp.Body.String())
+	}
+	etag2 := resp.Header().Get("ETag")
+	resp = testConditionalHTTP(t, "POST", keyreq, strings.NewReader(`{"version": 3}`), map[string]string{"If-Match": etag1})
+	if resp.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 on POST with stale ETag, got %d\n", resp.Code)
+	}
+	if value := server.TestHTTP(t, "GET", keyreq, nil); string(value) != value2 {
+		t.Fatalf("expected value %s after failed POST, got %s\n", value2, string(value))
+	}
+	resp = testConditionalHTTP(t, "POST", keyreq, strings.NewReader(value1), map[string]string{"If-None-Match": etag1})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected POST with non-matching If-None-Match to succeed, got status %d\n", resp.Code)
+	}
+	resp = testConditionalHTTP(t, "POST", keyreq, strings.NewReader(value2), map[string]string{"If-Match": etag2 + ", " + etag1})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected POST with ETag in If-Match list to succeed, got status %d\n", resp.Code)
+	}
+
+	// Conditional DELETE.
+	resp = testConditionalHTTP(t, "DELETE", keyreq, nil, map[string]string{"If-Match": etag1})
+	if resp.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 on DELETE with stale ETag, got %d\n", resp.Code)
+	}
+	resp = testConditionalHTTP(t, "DELETE", keyreq, nil, map[string]string{"If-Match": etag2})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected DELETE with matching ETag to succeed, got status %d\n", resp.Code)
+	}
+	resp = testConditionalHTTP(t, "DELETE", keyreq, nil, map[string]string{"If-Match": "*"})
+	if resp.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 on DELETE of missing key with If-Match, got %d\n", resp.Code)
+	}
+	resp = server.TestHTTPResponse(t, "HEAD", keyreq, nil)
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected deleted key to be missing, got status %d\n", resp.Code)
+	}
+
+	// Atomic batch with a failing precondition doesn't modify any key.
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader(value1))
+	otherreq := fmt.Sprintf("%snode/%s/configs/key/other", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", otherreq, strings.NewReader("old"))
+	atomicreq := fmt.Sprintf("%snode/%s/configs/keyvalues?atomic=true", server.WebAPIPath, uuid)
+	ops := []AtomicOp{
+		{Key: "settings", Value: []byte(value2), IfMatch: etag1},
+		{Key: "newkey", Value: []byte("new"), IfNoneMatch: "*"},
+		{Key: "other", Delete: true, IfMatch: ETag([]byte("stale"))},
+	}
+	jsonBytes, err := json.Marshal(ops)
+	if err != nil {
+		t.Fatalf("unable to marshal atomic ops: %v\n", err)
+	}
+	resp = server.TestHTTPResponse(t, "POST", atomicreq, bytes.NewBuffer(jsonBytes))
+	if resp.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 on atomic batch with stale ETag, got %d: %s\n", resp.Code, resp.Body.String())
+	}
+	if value := server.TestHTTP(t, "GET", keyreq, nil); string(value) != value1 {
+		t.Fatalf("expected value %s after failed atomic batch, got %s\n", value1, string(value))
+	}
+	newreq := fmt.Sprintf("%snode/%s/configs/key/newkey", server.WebAPIPath, uuid)
+	if resp = server.TestHTTPResponse(t, "HEAD", newreq, nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected no new key after failed atomic batch, got status %d\n", resp.Code)
+	}
+
+	// Atomic batch commits when all preconditions hold.
+	ops[2].IfMatch = ETag([]byte("old"))
+	if jsonBytes, err = json.Marshal(ops); err != nil {
+		t.Fatalf("unable to marshal atomic ops: %v\n", err)
+	}
+	returnValue := server.TestHTTP(t, "POST", atomicreq, bytes.NewBuffer(jsonBytes))
+	var etags map[string]string
+	if err := json.Unmarshal(returnValue, &etags); err != nil {
+		t.Fatalf("unable to unmarshal atomic batch response %s: %v\n", string(returnValue), err)
+	}
+	if len(etags) != 2 || etags["settings"] != etag2 || etags["newkey"] != ETag([]byte("new")) {
+		t.Fatalf("bad ETags returned from atomic batch: %v\n", etags)
+	}
+	if value := server.TestHTTP(t, "GET", keyreq, nil); string(value) != value2 {
+		t.Fatalf("expected value %s after atomic batch, got %s\n", value2, string(value))
+	}
+	if value := server.TestHTTP(t, "GET", newreq, nil); string(value) != "new" {
+		t.Fatalf("expected new key value after atomic batch, got %s\n", string(value))
+	}
+	if resp = server.TestHTTPResponse(t, "HEAD", otherreq, nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected deleted key after atomic batch, got status %d\n", resp.Code)
+	}
+
+	// Bad atomic batches.
+	server.TestBadHTTP(t, "POST", atomicreq, strings.NewReader(`[{"Key": "a"}, {"Key": "a"}]`))
+	server.TestBadHTTP(t, "POST", atomicreq, strings.NewReader(`{"Key": "a"}`))
+}
+
 type resolveResp struct {
 	Child dvid.UUID `json:"child"`
 }
@@ -968,6 +1116,229 @@ func TestDiamondGetOnMerge(t *testing.T) {
 	}
 }
 
+func TestKeyvalueAutoMerge(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+
+	config := dvid.NewConfig()
+	dataservice, err := datastore.NewData(uuid, kvtype, "automerge", config)
+	if err != nil {
+		t.Fatalf("Error creating new keyvalue instance: %v\n", err)
+	}
+	data, ok := dataservice.(*Data)
+	if !ok {
+		t.Fatalf("Returned new data instance is not keyvalue.Data\n")
+	}
+	keyreq := func(uuid dvid.UUID, key string) string {
+		return fmt.Sprintf("%snode/%s/%s/key/%s", server.WebAPIPath, uuid, data.DataName(), key)
+	}
+
+	server.TestHTTP(t, "POST", keyreq(uuid, "jsonkey"), strings.NewReader(`{"a":1,"b":1}`))
+	server.TestHTTP(t, "POST", keyreq(uuid, "plainkey"), strings.NewReader("original"))
+	if err = datastore.Commit(uuid, "root", nil); err != nil {
+		t.Fatalf("Unable to commit root node %s: %v\n", uuid, err)
+	}
+
+	uuid2, err := datastore.NewVersion(uuid, "first child", "", nil)
+	if err != nil {
+		t.Fatalf("Unable to create 1st child off root %s: %v\n", uuid, err)
+	}
+	server.TestHTTP(t, "POST", keyreq(uuid2, "jsonkey"), strings.NewReader(`{"a":2,"b":1}`))
+	server.TestHTTP(t, "POST", keyreq(uuid2, "plainkey"), strings.NewReader("first"))
+	if err = datastore.Commit(uuid2, "first child", nil); err != nil {
+		t.Fatalf("Unable to commit node %s: %v\n", uuid2, err)
+	}
+
+	uuid3, err := datastore.NewVersion(uuid, "second child", "newbranch", nil)
+	if err != nil {
+		t.Fatalf("Unable to create 2nd child off root %s: %v\n", uuid, err)
+	}
+	server.TestHTTP(t, "POST", keyreq(uuid3, "jsonkey"), strings.NewReader(`{"a":1,"b":3,"c":4}`))
+	server.TestHTTP(t, "POST", keyreq(uuid3, "plainkey"), strings.NewReader("second"))
+	server.TestHTTP(t, "POST", keyreq(uuid3, "newkey"), strings.NewReader("only in second"))
+	if err = datastore.Commit(uuid3, "second child", nil); err != nil {
+		t.Fatalf("Unable to commit node %s: %v\n", uuid3, err)
+	}
+
+	conflictsReq := fmt.Sprintf("%srepo/%s/conflicts?parents=%s,%s&data=%s", server.WebAPIPath, uuid, uuid2, uuid3, data.DataName())
+	returnValue := server.TestHTTP(t, "GET", conflictsReq, nil)
+	var reports map[dvid.InstanceName]datastore.MergeConflictReport
+	if err := json.Unmarshal(returnValue, &reports); err != nil {
+		t.Fatalf("Can't parse return of conflicts request: %s\n", string(returnValue))
+	}
+	report, found := reports[data.DataName()]
+	if !found || report.KeysScanned != 3 || report.Conflicts != 2 {
+		t.Fatalf("Bad conflicts report: %s\n", string(returnValue))
+	}
+	if len(report.Samples) != 2 || report.Samples[0] != `key "jsonkey"` || report.Samples[1] != `key "plainkey"` {
+		t.Errorf("Bad conflicts report samples: %v\n", report.Samples)
+	}
+	badReq := fmt.Sprintf("%srepo/%s/conflicts?parents=%s", server.WebAPIPath, uuid, uuid2)
+	server.TestBadHTTP(t, "GET", badReq, nil)
+	otherRepo, _ := datastore.NewTestRepo()
+	badReq = fmt.Sprintf("%srepo/%s/conflicts?parents=%s,%s", server.WebAPIPath, otherRepo, uuid2, uuid3)
+	server.TestBadHTTP(t, "GET", badReq, nil)
+
+	mergeJSON := fmt.Sprintf(`{"mergeType":"auto","parents":[%q,%q],"note":"auto merge"}`, uuid2, uuid3)
+	mergeReq := fmt.Sprintf("%srepo/%s/merge", server.WebAPIPath, uuid)
+	returnValue = server.TestHTTP(t, "POST", mergeReq, strings.NewReader(mergeJSON))
+	var mergeResp struct {
+		Child dvid.UUID `json:"child"`
+	}
+	if err := json.Unmarshal(returnValue, &mergeResp); err != nil {
+		t.Fatalf("Can't parse return of merge request: %s\n", string(returnValue))
+	}
+
+	statusReq := fmt.Sprintf("%srepo/%s/merge/%s", server.WebAPIPath, uuid, mergeResp.Child)
+	var status datastore.MergeStatus
+	for i := 0; i < 100; i++ {
+		returnValue = server.TestHTTP(t, "GET", statusReq, nil)
+		if err := json.Unmarshal(returnValue, &status); err != nil {
+			t.Fatalf("Can't parse return of merge status request: %s\n", string(returnValue))
+		}
+		if status.State != "running" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if status.State != "done" {
+		t.Fatalf("Expected merge to complete, got status: %v\n", status)
+	}
+	stats := status.Instances[data.DataName()]
+	if stats.Conflicts != 2 || stats.Resolved != 2 || stats.Failed != 0 {
+		t.Errorf("Expected 2 resolved conflicts, got stats %v\n", stats)
+	}
+
+	returnValue = server.TestHTTP(t, "GET", keyreq(mergeResp.Child, "jsonkey"), nil)
+	var merged map[string]int
+	if err := json.Unmarshal(returnValue, &merged); err != nil {
+		t.Fatalf("Can't parse merged JSON value: %s\n", string(returnValue))
+	}
+	if len(merged) != 3 || merged["a"] != 2 || merged["b"] != 3 || merged["c"] != 4 {
+		t.Errorf("Bad field merge of JSON value: %s\n", string(returnValue))
+	}
+	returnValue = server.TestHTTP(t, "GET", keyreq(mergeResp.Child, "plainkey"), nil)
+	if string(returnValue) != "first" {
+		t.Errorf("Expected first parent to have priority for non-JSON value, got %q\n", string(returnValue))
+	}
+	returnValue = server.TestHTTP(t, "GET", keyreq(mergeResp.Child, "newkey"), nil)
+	if string(returnValue) != "only in second" {
+		t.Errorf("Expected non-conflicted key in merged child, got %q\n", string(returnValue))
+	}
+
+	statusReq = fmt.Sprintf("%srepo/%s/merge", server.WebAPIPath, uuid)
+	returnValue = server.TestHTTP(t, "GET", statusReq, nil)
+	var statuses []datastore.MergeStatus
+	if err := json.Unmarshal(returnValue, &statuses); err != nil {
+		t.Fatalf("Can't parse return of merge status list: %s\n", string(returnValue))
+	}
+	if len(statuses) != 1 || statuses[0].Child != mergeResp.Child {
+		t.Errorf("Expected one merge status for child %s, got %s\n", mergeResp.Child, string(returnValue))
+	}
+}
+
+func TestKeyvalueExternalMerge(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+
+	config := dvid.NewConfig()
+	dataservice, err := datastore.NewData(uuid, kvtype, "externalmerge", config)
+	if err != nil {
+		t.Fatalf("Error creating new keyvalue instance: %v\n", err)
+	}
+	data, ok := dataservice.(*Data)
+	if !ok {
+		t.Fatalf("Returned new data instance is not keyvalue.Data\n")
+	}
+	keyreq := func(uuid dvid.UUID, key string) string {
+		return fmt.Sprintf("%snode/%s/%s/key/%s", server.WebAPIPath, uuid, data.DataName(), key)
+	}
+
+	server.TestHTTP(t, "POST", keyreq(uuid, "jsonkey"), strings.NewReader(`{"a":1,"b":1}`))
+	server.TestHTTP(t, "POST", keyreq(uuid, "plainkey"), strings.NewReader("original"))
+	if err = datastore.Commit(uuid, "root", nil); err != nil {
+		t.Fatalf("Unable to commit root node %s: %v\n", uuid, err)
+	}
+
+	uuid2, err := datastore.NewVersion(uuid, "first child", "", nil)
+	if err != nil {
+		t.Fatalf("Unable to create 1st child off root %s: %v\n", uuid, err)
+	}
+	server.TestHTTP(t, "POST", keyreq(uuid2, "jsonkey"), strings.NewReader(`{"a":2,"b":1}`))
+	server.TestHTTP(t, "POST", keyreq(uuid2, "plainkey"), strings.NewReader("first"))
+	if err = datastore.Commit(uuid2, "first child", nil); err != nil {
+		t.Fatalf("Unable to commit node %s: %v\n", uuid2, err)
+	}
+
+	uuid3, err := datastore.NewVersion(uuid, "second child", "newbranch", nil)
+	if err != nil {
+		t.Fatalf("Unable to create 2nd child off root %s: %v\n", uuid, err)
+	}
+	server.TestHTTP(t, "POST", keyreq(uuid3, "jsonkey"), strings.NewReader(`{"a":1,"b":3}`))
+	server.TestHTTP(t, "POST", keyreq(uuid3, "plainkey"), strings.NewReader("second"))
+	server.TestHTTP(t, "POST", keyreq(uuid3, "newkey"), strings.NewReader("only in second"))
+	if err = datastore.Commit(uuid3, "second child", nil); err != nil {
+		t.Fatalf("Unable to commit node %s: %v\n", uuid3, err)
+	}
+
+	// manifest that doesn't cover "plainkey" conflict should be rejected.
+	mergeReq := fmt.Sprintf("%srepo/%s/merge", server.WebAPIPath, uuid)
+	mergeJSON := fmt.Sprintf(`{"mergeType":"external","parents":[%q,%q],"note":"external merge",
+		"manifest":{"externalmerge":[{"parent":%q,"begin":"jsonkey","end":"jsonkey"}]}}`, uuid2, uuid3, uuid3)
+	server.TestBadHTTP(t, "POST", mergeReq, strings.NewReader(mergeJSON))
+
+	mergeJSON = fmt.Sprintf(`{"mergeType":"external","parents":[%q,%q],"note":"external merge"}`, uuid2, uuid3)
+	server.TestBadHTTP(t, "POST", mergeReq, strings.NewReader(mergeJSON))
+
+	mergeJSON = fmt.Sprintf(`{"mergeType":"external","parents":[%q,%q],"note":"external merge",
+		"manifest":{"externalmerge":[{"parent":%q,"begin":"jsonkey","end":"jsonkey"},{"parent":%q}]}}`,
+		uuid2, uuid3, uuid3, uuid2)
+	returnValue := server.TestHTTP(t, "POST", mergeReq, strings.NewReader(mergeJSON))
+	var mergeResp struct {
+		Child dvid.UUID `json:"child"`
+	}
+	if err := json.Unmarshal(returnValue, &mergeResp); err != nil {
+		t.Fatalf("Can't parse return of merge request: %s\n", string(returnValue))
+	}
+
+	statusReq := fmt.Sprintf("%srepo/%s/merge/%s", server.WebAPIPath, uuid, mergeResp.Child)
+	var status datastore.MergeStatus
+	for i := 0; i < 100; i++ {
+		returnValue = server.TestHTTP(t, "GET", statusReq, nil)
+		if err := json.Unmarshal(returnValue, &status); err != nil {
+			t.Fatalf("Can't parse return of merge status request: %s\n", string(returnValue))
+		}
+		if status.State != "running" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if status.State != "done" || status.MergeType != "external" {
+		t.Fatalf("Expected external merge to complete, got status: %v\n", status)
+	}
+
+	returnValue = server.TestHTTP(t, "GET", keyreq(mergeResp.Child, "jsonkey"), nil)
+	if string(returnValue) != `{"a":1,"b":3}` {
+		t.Errorf("Expected manifest to select second parent for jsonkey, got %q\n", string(returnValue))
+	}
+	returnValue = server.TestHTTP(t, "GET", keyreq(mergeResp.Child, "plainkey"), nil)
+	if string(returnValue) != "first" {
+		t.Errorf("Expected manifest to select first parent for plainkey, got %q\n", string(returnValue))
+	}
+	returnValue = server.TestHTTP(t, "GET", keyreq(mergeResp.Child, "newkey"), nil)
+	if string(returnValue) != "only in second" {
+		t.Errorf("Expected non-conflicted key in merged child, got %q\n", string(returnValue))
+	}
+}
+
 /*
 TODO -- Complete when mutation log access added, so we can check mutation is logged and test blobstore
 		fetch with reference.
@@ -0,0 +1,98 @@
+/*
+	This file supports type-specific automatic merging of keyvalue versions.
+*/
+
+package keyvalue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// MergeJSONObjects does a three-way, field-level merge of JSON objects modified in parallel
+// from a common base.  Each top-level field takes the value of the first object (in order
+// of priority) that changed the field relative to the base, where a field absent from an
+// object is considered deleted.  The base may be nil if the objects don't share an ancestor.
+func MergeJSONObjects(base map[string]json.RawMessage, objs []map[string]json.RawMessage) map[string]json.RawMessage {
+	fields := make(map[string]struct{})
+	for field := range base {
+		fields[field] = struct{}{}
+	}
+	for _, obj := range objs {
+		for field := range obj {
+			fields[field] = struct{}{}
+		}
+	}
+	merged := make(map[string]json.RawMessage, len(fields))
+	for field := range fields {
+		baseVal, inBase := base[field]
+		val, keep := baseVal, inBase
+		for _, obj := range objs {
+			objVal, inObj := obj[field]
+			if inObj != inBase || (inObj && !bytes.Equal(objVal, baseVal)) {
+				val, keep = objVal, inObj
+				break
+			}
+		}
+		if keep {
+			merged[field] = val
+		}
+	}
+	return merged
+}
+
+// ResolveConflict implements the datastore.AutoMerger interface.  If all parents have
+// JSON object values for the key, the objects are merged field by field, else the value
+// from the first parent (in order of priority) that changed the key is used.
+func (d *Data) ResolveConflict(ctx *datastore.VersionedCtx, c *datastore.MergeConflict) ([]byte, error) {
+	uncompress := true
+	var base map[string]json.RawMessage
+	if c.Base != nil {
+		value, _, err := dvid.DeserializeData(c.Base, uncompress)
+		if err != nil {
+			return nil, fmt.Errorf("unable to deserialize base value: %v", err)
+		}
+		if err := json.Unmarshal(value, &base); err != nil {
+			return c.PriorityValue(), nil
+		}
+	}
+	objs := make([]map[string]json.RawMessage, len(c.Values))
+	for i, data := range c.Values {
+		if data == nil {
+			return c.PriorityValue(), nil
+		}
+		value, _, err := dvid.DeserializeData(data, uncompress)
+		if err != nil {
+			return nil, fmt.Errorf("unable to deserialize value from parent %d: %v", i, err)
+		}
+		if err := json.Unmarshal(value, &(objs[i])); err != nil || objs[i] == nil {
+			return c.PriorityValue(), nil
+		}
+	}
+	value, err := json.Marshal(MergeJSONObjects(base, objs))
+	if err != nil {
+		return nil, err
+	}
+	return dvid.SerializeData(value, d.Compression(), d.Checksum())
+}
+
+// MergeComplete implements the datastore.AutoMerger interface.  There is no cached
+// state for keyvalue data so nothing needs to be done.
+func (d *Data) MergeComplete(ctx *datastore.VersionedCtx, parents []dvid.VersionID) error {
+	return nil
+}
+
+// ManifestKey implements the datastore.ManifestKeyer interface so merge manifests can
+// select parents by key range.
+func (d *Data) ManifestKey(tk storage.TKey) (datastore.ManifestKey, error) {
+	key, err := DecodeTKey(tk)
+	if err != nil {
+		return datastore.ManifestKey{}, err
+	}
+	return datastore.ManifestKey{Key: key}, nil
+}
@@ -0,0 +1,190 @@
+/*
+	This file supports computing the contacts between labels within blocks.
+*/
+
+package labelgraph
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// labelPair is a pair of distinct non-zero labels with the smaller label first.
+type labelPair struct {
+	label1 uint64
+	label2 uint64
+}
+
+func newLabelPair(a, b uint64) labelPair {
+	if a > b {
+		a, b = b, a
+	}
+	return labelPair{a, b}
+}
+
+// contacts gives the # of voxel faces shared by each pair of labels.
+type contacts map[labelPair]uint64
+
+// add records n voxel faces shared by two labels, ignoring background and self contacts.
+func (c contacts) add(a, b, n uint64) {
+	if a == 0 || b == 0 || a == b {
+		return
+	}
+	c[newLabelPair(a, b)] += n
+}
+
+// relabel returns the contacts after relabeling labels with the given mapping and whether
+// any contact was changed.
+func (c contacts) relabel(mapping map[uint64]uint64) (contacts, bool) {
+	var changed bool
+	for pair := range c {
+		_, found1 := mapping[pair.label1]
+		_, found2 := mapping[pair.label2]
+		if found1 || found2 {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return c, false
+	}
+	relabeled := make(contacts, len(c))
+	for pair, n := range c {
+		label1, label2 := pair.label1, pair.label2
+		if mapped, found := mapping[label1]; found {
+			label1 = mapped
+		}
+		if mapped, found := mapping[label2]; found {
+			label2 = mapped
+		}
+		relabeled.add(label1, label2, n)
+	}
+	return relabeled, true
+}
+
+// MarshalBinary serializes the contacts as a sorted list of (label1, label2, # faces)
+// with each value a little-endian uint64.
+func (c contacts) MarshalBinary() ([]byte, error) {
+	pairs := make([]labelPair, 0, len(c))
+	for pair := range c {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].label1 != pairs[j].label1 {
+			return pairs[i].label1 < pairs[j].label1
+		}
+		return pairs[i].label2 < pairs[j].label2
+	})
+	buf := make([]byte, len(pairs)*24)
+	for i, pair := range pairs {
+		binary.LittleEndian.PutUint64(buf[i*24:i*24+8], pair.label1)
+		binary.LittleEndian.PutUint64(buf[i*24+8:i*24+16], pair.label2)
+		binary.LittleEndian.PutUint64(buf[i*24+16:i*24+24], c[pair])
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary deserializes contacts serialized by MarshalBinary.
+func (c *contacts) UnmarshalBinary(data []byte) error {
+	if len(data)%24 != 0 {
+		return fmt.Errorf("bad contacts serialization: length %d is not a multiple of 24", len(data))
+	}
+	*c = make(contacts, len(data)/24)
+	for i := 0; i < len(data); i += 24 {
+		pair := labelPair{
+			label1: binary.LittleEndian.Uint64(data[i : i+8]),
+			label2: binary.LittleEndian.Uint64(data[i+8 : i+16]),
+		}
+		(*c)[pair] = binary.LittleEndian.Uint64(data[i+16 : i+24])
+	}
+	return nil
+}
+
+// blockVoxels gives the label of each voxel in a block.
+type blockVoxels struct {
+	size  dvid.Point3d
+	solid bool
+	label uint64 // label of every voxel if the block is solid.
+	data  []byte // packed little-endian uint64 labels if the block isn't solid.
+}
+
+func newBlockVoxels(block *labels.Block) blockVoxels {
+	bv := blockVoxels{size: block.Size}
+	if len(block.Labels) < 2 {
+		bv.solid = true
+		if len(block.Labels) == 1 {
+			bv.label = block.Labels[0]
+		}
+		return bv
+	}
+	bv.data, _ = block.MakeLabelVolume()
+	return bv
+}
+
+func (bv blockVoxels) at(x, y, z int32) uint64 {
+	if bv.solid {
+		return bv.label
+	}
+	i := ((z*bv.size[1]+y)*bv.size[0] + x) * 8
+	return binary.LittleEndian.Uint64(bv.data[i : i+8])
+}
+
+// computeContacts returns the contacts between labels within a block as well as across
+// the faces it shares with the next blocks along the x, y, and z axes.  Each face between
+// blocks is therefore counted by exactly one block.
+func computeContacts(bv blockVoxels, next [3]blockVoxels) (contacts, error) {
+	for _, nbv := range next {
+		if nbv.size != bv.size {
+			return nil, fmt.Errorf("neighboring block size %s differs from block size %s", nbv.size, bv.size)
+		}
+	}
+	c := make(contacts)
+	nx, ny, nz := bv.size[0], bv.size[1], bv.size[2]
+	if !bv.solid {
+		for z := int32(0); z < nz; z++ {
+			for y := int32(0); y < ny; y++ {
+				for x := int32(0); x < nx; x++ {
+					label := bv.at(x, y, z)
+					if label == 0 {
+						continue
+					}
+					if x+1 < nx {
+						c.add(label, bv.at(x+1, y, z), 1)
+					}
+					if y+1 < ny {
+						c.add(label, bv.at(x, y+1, z), 1)
+					}
+					if z+1 < nz {
+						c.add(label, bv.at(x, y, z+1), 1)
+					}
+				}
+			}
+		}
+	}
+	if bv.solid && next[0].solid && next[1].solid && next[2].solid {
+		c.add(bv.label, next[0].label, uint64(ny*nz))
+		c.add(bv.label, next[1].label, uint64(nx*nz))
+		c.add(bv.label, next[2].label, uint64(nx*ny))
+		return c, nil
+	}
+	for z := int32(0); z < nz; z++ {
+		for y := int32(0); y < ny; y++ {
+			c.add(bv.at(nx-1, y, z), next[0].at(0, y, z), 1)
+		}
+	}
+	for z := int32(0); z < nz; z++ {
+		for x := int32(0); x < nx; x++ {
+			c.add(bv.at(x, ny-1, z), next[1].at(x, 0, z), 1)
+		}
+	}
+	for y := int32(0); y < ny; y++ {
+		for x := int32(0); x < nx; x++ {
+			c.add(bv.at(x, y, nz-1), next[2].at(x, y, 0), 1)
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,80 @@
+/*
+	This file supports keyspaces for the labelgraph data type.
+*/
+
+package labelgraph
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+const (
+	// keyUnknown should never be used and is a check for corrupt or incorrectly set keys
+	keyUnknown storage.TKeyClass = iota
+
+	// reserved type-specific key for metadata
+	keyProperties = datastore.PropertyTKeyClass
+
+	// key is label + neighbor label, with value equal to the edge weight.  Each edge is
+	// stored under both of its labels so the neighbors of a label form a contiguous range.
+	keyEdge = 77
+
+	// key is block coordinate, with value equal to the label contacts last computed for
+	// the block.  Necessary to remove old contacts when a block is recomputed.
+	keyBlockContacts = 78
+)
+
+// DescribeTKeyClass returns a string explanation of what a particular TKeyClass
+// is used for.  Implements the datastore.TKeyClassDescriber interface.
+func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
+	switch tkc {
+	case keyEdge:
+		return "labelgraph label + neighbor label key"
+	case keyBlockContacts:
+		return "labelgraph block coordinate key"
+	default:
+	}
+	return "unknown labelgraph key"
+}
+
+// NewEdgeTKey returns a type-specific key for the edge from a label to a neighbor label.
+func NewEdgeTKey(label, neighbor uint64) storage.TKey {
+	ibytes := make([]byte, 16)
+	binary.BigEndian.PutUint64(ibytes[0:8], label)
+	binary.BigEndian.PutUint64(ibytes[8:16], neighbor)
+	return storage.NewTKey(keyEdge, ibytes)
+}
+
+// DecodeEdgeTKey decodes a type-specific key into the label and neighbor label of an edge.
+func DecodeEdgeTKey(tk storage.TKey) (label, neighbor uint64, err error) {
+	ibytes, err := tk.ClassBytes(keyEdge)
+	if err != nil {
+		return
+	}
+	if len(ibytes) != 16 {
+		err = fmt.Errorf("expected 16 bytes for edge key, got %d bytes", len(ibytes))
+		return
+	}
+	label = binary.BigEndian.Uint64(ibytes[0:8])
+	neighbor = binary.BigEndian.Uint64(ibytes[8:16])
+	return
+}
+
+// NewBlockContactsTKey returns a type-specific key for the contacts computed for a block.
+func NewBlockContactsTKey(bcoord dvid.IZYXString) storage.TKey {
+	return storage.NewTKey(keyBlockContacts, []byte(bcoord))
+}
+
+// DecodeBlockContactsTKey decodes a type-specific key into a block coordinate.
+func DecodeBlockContactsTKey(tk storage.TKey) (bcoord dvid.IZYXString, err error) {
+	ibytes, err := tk.ClassBytes(keyBlockContacts)
+	if err != nil {
+		return
+	}
+	return dvid.IZYXString(ibytes), nil
+}
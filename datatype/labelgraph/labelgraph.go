@@ -0,0 +1,600 @@
+/*
+Package labelgraph supports a region adjacency graph of the labels in a synced labelmap.
+*/
+package labelgraph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/labelmap"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+const (
+	Version  = "0.1"
+	RepoURL  = "github.com/janelia-flyem/dvid/datatype/labelgraph"
+	TypeName = "labelgraph"
+)
+
+const helpMessage = `
+API for labelgraph data type (github.com/janelia-flyem/dvid/datatype/labelgraph)
+=======================================================================================
+
+Note: UUIDs referenced below are strings that may either be a unique prefix of a
+hexadecimal UUID string (e.g., 3FA22) or a branch leaf specification that adds
+a colon (":") followed by the case-dependent branch name.  In the case of a
+branch leaf specification, the unique UUID prefix just identifies the repo of
+the branch, and the UUID referenced is really the leaf of the branch name.
+For example, if we have a DAG with root A -> B -> C where C is the current
+HEAD or leaf of the "master" (default) branch, then asking for "B:master" is
+the same as asking for "C".  If we add another version so A -> B -> C -> D, then
+references to "B:master" now return the data from "D".
+
+A labelgraph maintains the region adjacency graph of the labels (bodies) in a synced
+labelmap.  Each vertex is a label and each edge joins two labels that touch, with the
+edge weight equal to the contact surface between the labels, i.e., the # of voxel faces
+shared by the two labels.  Contacts are computed per block as labels are ingested or
+mutated and the graph is kept up to date through merges, splits, and cleaves.  Since
+the graph is only built from sync events, the labelgraph should be synced to its
+labelmap before labels are ingested.
+
+Command-line:
+
+$ dvid repo <UUID> new labelgraph <data name> <settings...>
+
+	Adds newly named data of the 'type name' to repo with specified UUID.
+
+	Example:
+
+	$ dvid repo 3f8c new labelgraph bodygraph
+
+    Arguments:
+
+    UUID           Hexadecimal string with enough characters to uniquely identify a version node.
+    data name      Name of data to create, e.g., "bodygraph"
+    settings       Configuration settings in "key=value" format separated by spaces.
+
+    ------------------
+
+HTTP API (Level 2 REST):
+
+GET  <api URL>/node/<UUID>/<data name>/help
+
+	Returns data-specific help message.
+
+
+GET  <api URL>/node/<UUID>/<data name>/info
+POST <api URL>/node/<UUID>/<data name>/info
+
+    Retrieves or puts DVID-specific data properties for this labelgraph data instance.
+
+    Example:
+
+    GET <api URL>/node/3f8c/bodygraph/info
+
+    Returns JSON with configuration settings.
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of labelgraph data.
+
+
+POST <api URL>/node/<UUID>/<data name>/sync?<options>
+
+    Establishes a labelmap for which the graph is maintained.  Expects JSON to be POSTed
+    with the following format:
+
+    { "sync": "segmentation" }
+
+	To delete syncs, pass an empty string of names with query string "replace=true":
+
+	{ "sync": "" }
+
+    The "sync" property should be followed by a comma-delimited list of data instance names
+    with only one labelmap allowed.
+
+    GET Query-string Options:
+
+    replace    Set to "true" if you want passed syncs to replace and not be appended to current syncs.
+			   Default operation is false.
+
+
+GET <api URL>/node/<UUID>/<data name>/neighbors/<label>
+
+	Returns JSON for the labels adjacent to the given label, sorted by decreasing edge weight:
+
+	[ { "Label": 21, "Weight": 8192 }, { "Label": 8, "Weight": 431 }, ... ]
+
+
+GET <api URL>/node/<UUID>/<data name>/edge/<label1>/<label2>
+
+	Returns JSON for the weight of the edge between two labels, which is 0 if the labels
+	don't touch:
+
+	{ "Label1": 8, "Label2": 21, "Weight": 431 }
+
+
+GET  <api URL>/node/<UUID>/<data name>/subgraph?labels=<label1>,<label2>,...
+POST <api URL>/node/<UUID>/<data name>/subgraph
+
+	Returns JSON for the subgraph induced by the given labels, which can be specified by
+	the "labels" query string or a POSTed JSON list of labels.  Each vertex gives its
+	adjacent labels within the subgraph and has a weight equal to its total contact
+	surface with all labels.  Each edge within the subgraph is listed once:
+
+	{
+		"Vertices": [
+			{ "Properties": null, "Weight": 8623, "Id": 8, "Vertices": [21] },
+			{ "Properties": null, "Weight": 20480, "Id": 21, "Vertices": [8] }
+		],
+		"Edges": [
+			{ "Properties": null, "Weight": 431, "Vertexpair": { "Vertex1": 8, "Vertex2": 21 } }
+		]
+	}
+`
+
+var (
+	dtype *Type
+)
+
+const (
+	MaxLabelsReturned = 10000 // Maximum number of labels in a subgraph
+)
+
+func init() {
+	dtype = new(Type)
+	dtype.Type = datastore.Type{
+		Name:    TypeName,
+		URL:     RepoURL,
+		Version: Version,
+		Requirements: &storage.Requirements{
+			Batcher: true,
+		},
+	}
+
+	// See doc for package on why channels are segregated instead of interleaved.
+	// Data types must be registered with the datastore to be used.
+	datastore.Register(dtype)
+
+	// Need to register types that will be used to fulfill interfaces.
+	gob.Register(&Type{})
+	gob.Register(&Data{})
+}
+
+// Neighbor is a label adjacent to another label and the weight of the edge between them.
+type Neighbor struct {
+	Label  uint64
+	Weight uint64
+}
+
+// Neighbors is a slice of Neighbor sorted by decreasing weight and then increasing label.
+type Neighbors []Neighbor
+
+// --- Sort interface
+
+func (n Neighbors) Len() int {
+	return len(n)
+}
+
+func (n Neighbors) Less(i, j int) bool {
+	if n[i].Weight != n[j].Weight {
+		return n[i].Weight > n[j].Weight
+	}
+	return n[i].Label < n[j].Label
+}
+
+func (n Neighbors) Swap(i, j int) {
+	n[i], n[j] = n[j], n[i]
+}
+
+// Subgraph is the subgraph induced by a set of labels.
+type Subgraph struct {
+	Vertices []dvid.GraphVertex
+	Edges    []dvid.GraphEdge
+}
+
+// NewData returns a pointer to labelgraph data.
+func NewData(uuid dvid.UUID, id dvid.InstanceID, name dvid.InstanceName, c dvid.Config) (*Data, error) {
+	basedata, err := datastore.NewDataService(dtype, uuid, id, name, c)
+	if err != nil {
+		return nil, err
+	}
+	return &Data{Data: basedata}, nil
+}
+
+// --- Labelgraph Datatype -----
+
+type Type struct {
+	datastore.Type
+}
+
+// --- TypeService interface ---
+
+func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.InstanceName, c dvid.Config) (datastore.DataService, error) {
+	return NewData(uuid, id, name, c)
+}
+
+func (dtype *Type) Help() string {
+	return helpMessage
+}
+
+// Data instance of labelgraph, a region adjacency graph of labels.
+type Data struct {
+	*datastore.Data
+
+	// Keep track of sync operations that could be updating the data.
+	datastore.Updater
+
+	// channels for processing messages from the synced labelmap
+	syncCh   chan datastore.SyncMessage
+	syncDone chan *sync.WaitGroup
+}
+
+func (d *Data) Equals(d2 *Data) bool {
+	return d.Data.Equals(d2.Data)
+}
+
+// GetSyncedLabelmap returns the synced labelmap or nil if there is none.
+func (d *Data) GetSyncedLabelmap() *labelmap.Data {
+	for dataUUID := range d.SyncedData() {
+		source, err := datastore.GetDataByDataUUID(dataUUID)
+		if err != nil {
+			dvid.Errorf("Got error accessing synced data %s: %v\n", dataUUID, err)
+			continue
+		}
+		if lm, ok := source.(*labelmap.Data); ok {
+			return lm
+		}
+	}
+	return nil
+}
+
+// GetNeighbors returns the labels adjacent to the given label.
+func (d *Data) GetNeighbors(ctx *datastore.VersionedCtx, label uint64) (Neighbors, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	kvs, err := store.GetRange(ctx, NewEdgeTKey(label, 0), NewEdgeTKey(label, math.MaxUint64))
+	if err != nil {
+		return nil, err
+	}
+	neighbors := make(Neighbors, 0, len(kvs))
+	for _, kv := range kvs {
+		_, neighbor, err := DecodeEdgeTKey(kv.K)
+		if err != nil {
+			return nil, err
+		}
+		if len(kv.V) != 8 {
+			return nil, fmt.Errorf("bad size in value for edge %d-%d: value has length %d", label, neighbor, len(kv.V))
+		}
+		neighbors = append(neighbors, Neighbor{Label: neighbor, Weight: binary.LittleEndian.Uint64(kv.V)})
+	}
+	sort.Sort(neighbors)
+	return neighbors, nil
+}
+
+// GetEdgeWeight returns the weight of the edge between two labels or 0 if they aren't adjacent.
+func (d *Data) GetEdgeWeight(ctx *datastore.VersionedCtx, label1, label2 uint64) (uint64, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return 0, err
+	}
+	return d.getEdgeWeight(ctx, store, label1, label2)
+}
+
+// GetSubgraph returns the subgraph induced by the given labels.
+func (d *Data) GetSubgraph(ctx *datastore.VersionedCtx, labels []uint64) (*Subgraph, error) {
+	labelSet := make(map[uint64]struct{}, len(labels))
+	for _, label := range labels {
+		labelSet[label] = struct{}{}
+	}
+	if len(labelSet) > MaxLabelsReturned {
+		return nil, fmt.Errorf("subgraph cannot have more than %d labels, got %d", MaxLabelsReturned, len(labelSet))
+	}
+	sorted := make([]uint64, 0, len(labelSet))
+	for label := range labelSet {
+		sorted = append(sorted, label)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	subgraph := &Subgraph{
+		Vertices: make([]dvid.GraphVertex, 0, len(sorted)),
+		Edges:    []dvid.GraphEdge{},
+	}
+	for _, label := range sorted {
+		neighbors, err := d.GetNeighbors(ctx, label)
+		if err != nil {
+			return nil, err
+		}
+		vertex := dvid.GraphVertex{
+			GraphElement: &dvid.GraphElement{},
+			Id:           dvid.VertexID(label),
+			Vertices:     []dvid.VertexID{},
+		}
+		for _, neighbor := range neighbors {
+			vertex.Weight += float64(neighbor.Weight)
+			if _, found := labelSet[neighbor.Label]; !found {
+				continue
+			}
+			vertex.Vertices = append(vertex.Vertices, dvid.VertexID(neighbor.Label))
+			if label < neighbor.Label {
+				subgraph.Edges = append(subgraph.Edges, dvid.GraphEdge{
+					GraphElement: &dvid.GraphElement{Weight: float64(neighbor.Weight)},
+					Vertexpair:   dvid.VertexPairID{Vertex1: dvid.VertexID(label), Vertex2: dvid.VertexID(neighbor.Label)},
+				})
+			}
+		}
+		sort.Slice(vertex.Vertices, func(i, j int) bool { return vertex.Vertices[i] < vertex.Vertices[j] })
+		subgraph.Vertices = append(subgraph.Vertices, vertex)
+	}
+	sort.Slice(subgraph.Edges, func(i, j int) bool {
+		pi, pj := subgraph.Edges[i].Vertexpair, subgraph.Edges[j].Vertexpair
+		if pi.Vertex1 != pj.Vertex1 {
+			return pi.Vertex1 < pj.Vertex1
+		}
+		return pi.Vertex2 < pj.Vertex2
+	})
+	return subgraph, nil
+}
+
+// GetByUUIDName returns a pointer to labelgraph data given a version (UUID) and data name.
+func GetByUUIDName(uuid dvid.UUID, name dvid.InstanceName) (*Data, error) {
+	source, err := datastore.GetDataByUUIDName(uuid, name)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := source.(*Data)
+	if !ok {
+		return nil, fmt.Errorf("Instance '%s' is not a labelgraph datatype!", name)
+	}
+	return data, nil
+}
+
+// --- datastore.DataService interface ---------
+
+func (d *Data) Help() string {
+	return helpMessage
+}
+
+func (d *Data) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Base     *datastore.Data
+		Extended struct{}
+	}{
+		d.Data,
+		struct{}{},
+	})
+}
+
+func (d *Data) GobDecode(b []byte) error {
+	buf := bytes.NewBuffer(b)
+	dec := gob.NewDecoder(buf)
+	if err := dec.Decode(&(d.Data)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *Data) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(d.Data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DoRPC acts as a switchboard for RPC commands.
+func (d *Data) DoRPC(request datastore.Request, reply *datastore.Response) error {
+	switch request.TypeCommand() {
+	default:
+		return fmt.Errorf("Unknown command.  Data type '%s' [%s] does not support '%s' command.",
+			d.DataName(), d.TypeName(), request.TypeCommand())
+	}
+}
+
+// parseLabels returns the labels in a comma-separated list.
+func parseLabels(s string) ([]uint64, error) {
+	var labels []uint64
+	for _, labelStr := range strings.Split(s, ",") {
+		labelStr = strings.TrimSpace(labelStr)
+		if labelStr == "" {
+			continue
+		}
+		label, err := strconv.ParseUint(labelStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad label %q in labels list: %v", labelStr, err)
+		}
+		labels = append(labels, label)
+	}
+	return labels, nil
+}
+
+// ServeHTTP handles all incoming HTTP requests for this data.
+func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) (activity map[string]interface{}) {
+	timedLog := dvid.NewTimeLog()
+
+	// Get the action (GET, POST)
+	action := strings.ToLower(r.Method)
+
+	// Break URL request into arguments
+	url := r.URL.Path[len(server.WebAPIPath):]
+	parts := strings.Split(url, "/")
+	if len(parts[len(parts)-1]) == 0 {
+		parts = parts[:len(parts)-1]
+	}
+
+	// Handle POST on data -> setting of configuration
+	if len(parts) == 3 && action == "put" {
+		config, err := server.DecodeJSON(r)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if err := d.ModifyConfig(config); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if err := datastore.SaveDataByUUID(uuid, d); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		fmt.Fprintf(w, "Changed '%s' based on received configuration:\n%s\n", d.DataName(), config)
+		return
+	}
+
+	if len(parts) < 4 {
+		server.BadRequest(w, r, "Incomplete API request")
+		return
+	}
+
+	// Process help and info.
+	switch parts[3] {
+	case "help":
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, dtype.Help())
+
+	case "info":
+		jsonBytes, err := d.MarshalJSON()
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, string(jsonBytes))
+
+	case "sync":
+		if action != "post" {
+			server.BadRequest(w, r, "Only POST allowed to sync endpoint")
+			return
+		}
+		replace := r.URL.Query().Get("replace") == "true"
+		if err := datastore.SetSyncByJSON(d, uuid, replace, r.Body); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+
+	case "neighbors":
+		// GET <api URL>/node/<UUID>/<data name>/neighbors/<label>
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'neighbors' endpoint.")
+			return
+		}
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "Must include label after 'neighbors' endpoint.")
+			return
+		}
+		label, err := strconv.ParseUint(parts[4], 10, 64)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		neighbors, err := d.GetNeighbors(ctx, label)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		jsonBytes, err := json.Marshal(neighbors)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: get %d neighbors of label %d: %s", r.Method, len(neighbors), label, r.URL)
+
+	case "edge":
+		// GET <api URL>/node/<UUID>/<data name>/edge/<label1>/<label2>
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'edge' endpoint.")
+			return
+		}
+		if len(parts) < 6 {
+			server.BadRequest(w, r, "Must include two labels after 'edge' endpoint.")
+			return
+		}
+		label1, err := strconv.ParseUint(parts[4], 10, 64)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		label2, err := strconv.ParseUint(parts[5], 10, 64)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		weight, err := d.GetEdgeWeight(ctx, label1, label2)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		fmt.Fprintf(w, `{"Label1":%d,"Label2":%d,"Weight":%d}`, label1, label2, weight)
+		timedLog.Infof("HTTP %s: get edge %d-%d: %s", r.Method, label1, label2, r.URL)
+
+	case "subgraph":
+		// GET  <api URL>/node/<UUID>/<data name>/subgraph?labels=<label1>,<label2>,...
+		// POST <api URL>/node/<UUID>/<data name>/subgraph
+		var labels []uint64
+		switch action {
+		case "get":
+			var err error
+			if labels, err = parseLabels(r.URL.Query().Get("labels")); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		case "post":
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				server.BadRequest(w, r, "Bad POST request body for subgraph query: %v", err)
+				return
+			}
+			if err := json.Unmarshal(data, &labels); err != nil {
+				server.BadRequest(w, r, fmt.Sprintf("Bad JSON label array sent in 'subgraph' query: %v", err))
+				return
+			}
+		default:
+			server.BadRequest(w, r, "Only GET or POST actions are available on 'subgraph' endpoint.")
+			return
+		}
+		subgraph, err := d.GetSubgraph(ctx, labels)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		jsonBytes, err := json.Marshal(subgraph)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: get subgraph of %d labels: %s", r.Method, len(labels), r.URL)
+
+	default:
+		server.BadAPIRequest(w, r, d)
+	}
+	return
+}
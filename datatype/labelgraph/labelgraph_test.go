@@ -0,0 +1,279 @@
+package labelgraph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// A slice of bytes representing 3d label volume
+type testVolume struct {
+	data []byte
+	size dvid.Point3d
+}
+
+func newTestVolume(nx, ny, nz int32) *testVolume {
+	return &testVolume{
+		data: make([]byte, nx*ny*nz*8),
+		size: dvid.Point3d{nx, ny, nz},
+	}
+}
+
+// Sets voxels in body to given label.
+func (v *testVolume) add(label uint64, ox, oy, oz int32, sx, sy, sz int32) {
+	nx := v.size.Value(0)
+	ny := v.size.Value(1)
+	nxy := nx * ny
+	for z := oz; z < oz+sz; z++ {
+		for y := oy; y < oy+sy; y++ {
+			p := (z*nxy + y*nx + ox) * 8
+			for x := ox; x < ox+sx; x++ {
+				binary.LittleEndian.PutUint64(v.data[p:p+8], label)
+				p += 8
+			}
+		}
+	}
+}
+
+// Put label data into given data instance.
+func (v *testVolume) put(t *testing.T, uuid dvid.UUID, name string) {
+	apiStr := fmt.Sprintf("%snode/%s/%s/raw/0_1_2/%d_%d_%d/0_0_0?mutate=true", server.WebAPIPath,
+		uuid, name, v.size[0], v.size[1], v.size[2])
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBuffer(v.data))
+}
+
+func getBytesRLE(t *testing.T, rles dvid.RLEs) *bytes.Buffer {
+	n := len(rles)
+	buf := new(bytes.Buffer)
+	buf.WriteByte(dvid.EncodingBinary)
+	binary.Write(buf, binary.LittleEndian, uint8(3))  // # of dimensions
+	binary.Write(buf, binary.LittleEndian, byte(0))   // dimension of run (X = 0)
+	buf.WriteByte(byte(0))                            // reserved for later
+	binary.Write(buf, binary.LittleEndian, uint32(0)) // Placeholder for # voxels
+	binary.Write(buf, binary.LittleEndian, uint32(n)) // Placeholder for # spans
+	rleBytes, err := rles.MarshalBinary()
+	if err != nil {
+		t.Errorf("Unable to serialize RLEs: %v\n", err)
+	}
+	buf.Write(rleBytes)
+	return buf
+}
+
+func blockUntilSynced(t *testing.T, uuid dvid.UUID) {
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "graph"); err != nil {
+		t.Fatalf("Error blocking on sync of labelgraph: %v\n", err)
+	}
+}
+
+func checkNeighbors(t *testing.T, uuid dvid.UUID, label uint64, expected string) {
+	url := fmt.Sprintf("%snode/%s/graph/neighbors/%d", server.WebAPIPath, uuid, label)
+	data := server.TestHTTP(t, "GET", url, nil)
+	if string(data) != expected {
+		t.Errorf("bad neighbors for label %d: expected %s, got %s\n", label, expected, string(data))
+	}
+}
+
+func checkEdge(t *testing.T, uuid dvid.UUID, label1, label2, weight uint64) {
+	url := fmt.Sprintf("%snode/%s/graph/edge/%d/%d", server.WebAPIPath, uuid, label1, label2)
+	data := server.TestHTTP(t, "GET", url, nil)
+	expected := fmt.Sprintf(`{"Label1":%d,"Label2":%d,"Weight":%d}`, label1, label2, weight)
+	if string(data) != expected {
+		t.Errorf("bad edge %d-%d: expected %s, got %s\n", label1, label2, expected, string(data))
+	}
+}
+
+func TestContacts(t *testing.T) {
+	size := dvid.Point3d{16, 16, 16}
+	vol := newTestVolume(16, 16, 16)
+	vol.add(1, 0, 0, 0, 8, 16, 16)
+	vol.add(2, 8, 0, 0, 8, 16, 16)
+	vol.add(3, 8, 8, 8, 8, 8, 8)
+	block, err := labels.MakeBlock(vol.data, size)
+	if err != nil {
+		t.Fatalf("unable to make block: %v\n", err)
+	}
+	empty := newBlockVoxels(labels.MakeSolidBlock(0, size))
+	solid := newBlockVoxels(labels.MakeSolidBlock(4, size))
+
+	c, err := computeContacts(newBlockVoxels(block), [3]blockVoxels{solid, empty, empty})
+	if err != nil {
+		t.Fatalf("unable to compute contacts: %v\n", err)
+	}
+	expected := contacts{
+		{1, 2}: 192, // x = 7/8 plane outside of label 3
+		{1, 3}: 64,  // x = 7/8 plane next to label 3
+		{2, 3}: 128, // y = 7/8 and z = 7/8 planes of label 3
+		{2, 4}: 192, // x = 15 face with next block along x
+		{3, 4}: 64,
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected contacts %v, got %v\n", expected, c)
+	}
+
+	c, err = computeContacts(solid, [3]blockVoxels{solid, newBlockVoxels(block), empty})
+	if err != nil {
+		t.Fatalf("unable to compute contacts: %v\n", err)
+	}
+	expected = contacts{{1, 4}: 128, {2, 4}: 128}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected solid block contacts %v, got %v\n", expected, c)
+	}
+
+	serialization, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unable to serialize contacts: %v\n", err)
+	}
+	var c2 contacts
+	if err := c2.UnmarshalBinary(serialization); err != nil {
+		t.Fatalf("unable to deserialize contacts: %v\n", err)
+	}
+	if !reflect.DeepEqual(c, c2) {
+		t.Errorf("expected deserialized contacts %v, got %v\n", c, c2)
+	}
+
+	relabeled, changed := c.relabel(map[uint64]uint64{3: 1})
+	if changed {
+		t.Errorf("expected no change in contacts from relabeling absent label, got %v\n", relabeled)
+	}
+	relabeled, changed = c.relabel(map[uint64]uint64{2: 1})
+	if !changed || !reflect.DeepEqual(relabeled, contacts{{1, 4}: 256}) {
+		t.Errorf("bad relabeled contacts: %v\n", relabeled)
+	}
+	relabeled, _ = c.relabel(map[uint64]uint64{4: 1})
+	if !reflect.DeepEqual(relabeled, contacts{{1, 2}: 128}) {
+		t.Errorf("bad relabeled contacts after merging neighbors: %v\n", relabeled)
+	}
+}
+
+func TestLabelgraph(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := datastore.NewTestRepo()
+	var config dvid.Config
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	server.CreateTestInstance(t, uuid, "labelgraph", "graph", config)
+	server.CreateTestSync(t, uuid, "graph", "labels")
+
+	// Labels 1 and 2 touch across the x = 63/64 block boundary, while labels 3 and 4
+	// touch across the y = 63/64 block boundary.
+	volume := newTestVolume(128, 128, 128)
+	volume.add(1, 0, 0, 0, 64, 128, 128)
+	volume.add(2, 64, 0, 0, 36, 128, 128)
+	volume.add(3, 100, 0, 0, 28, 64, 128)
+	volume.add(4, 100, 64, 0, 28, 64, 128)
+	volume.put(t, uuid, "labels")
+	blockUntilSynced(t, uuid)
+
+	checkNeighbors(t, uuid, 2, `[{"Label":1,"Weight":16384},{"Label":3,"Weight":8192},{"Label":4,"Weight":8192}]`)
+	checkNeighbors(t, uuid, 3, `[{"Label":2,"Weight":8192},{"Label":4,"Weight":3584}]`)
+	checkNeighbors(t, uuid, 10, `[]`)
+	checkEdge(t, uuid, 4, 3, 3584)
+	checkEdge(t, uuid, 1, 3, 0)
+
+	// Merge 4 into 3.
+	url := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBufferString("[3,4]"))
+	blockUntilSynced(t, uuid)
+	checkNeighbors(t, uuid, 3, `[{"Label":2,"Weight":16384}]`)
+	checkNeighbors(t, uuid, 4, `[]`)
+	checkEdge(t, uuid, 2, 4, 0)
+
+	// Cleave supervoxel 4 back off of 3.
+	url = fmt.Sprintf("%snode/%s/labels/cleave/3", server.WebAPIPath, uuid)
+	data := server.TestHTTP(t, "POST", url, bytes.NewBufferString("[4]"))
+	var cleaveResp struct {
+		CleavedLabel uint64
+	}
+	if err := json.Unmarshal(data, &cleaveResp); err != nil {
+		t.Fatalf("bad cleave response: %s\n", string(data))
+	}
+	blockUntilSynced(t, uuid)
+	cleaved := cleaveResp.CleavedLabel
+	checkNeighbors(t, uuid, 3, fmt.Sprintf(`[{"Label":2,"Weight":8192},{"Label":%d,"Weight":3584}]`, cleaved))
+	checkEdge(t, uuid, 2, cleaved, 8192)
+
+	// Split the x < 32 half of label 1.
+	var rles dvid.RLEs
+	for z := int32(0); z < 128; z++ {
+		for y := int32(0); y < 128; y++ {
+			rles = append(rles, dvid.NewRLE(dvid.Point3d{0, y, z}, 32))
+		}
+	}
+	url = fmt.Sprintf("%snode/%s/labels/split/1", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "POST", url, getBytesRLE(t, rles))
+	splitResp := make(map[string]uint64)
+	if err := json.Unmarshal(data, &splitResp); err != nil {
+		t.Fatalf("bad split response: %s\n", string(data))
+	}
+	blockUntilSynced(t, uuid)
+	split := splitResp["label"]
+	checkNeighbors(t, uuid, 1, fmt.Sprintf(`[{"Label":2,"Weight":16384},{"Label":%d,"Weight":16384}]`, split))
+	checkNeighbors(t, uuid, split, `[{"Label":1,"Weight":16384}]`)
+
+	// Overwrite the first block with label 100, which touches labels 1, 2, and the split label
+	// across block boundaries.
+	volume = newTestVolume(64, 64, 64)
+	volume.add(100, 0, 0, 0, 64, 64, 64)
+	volume.put(t, uuid, "labels")
+	blockUntilSynced(t, uuid)
+	checkNeighbors(t, uuid, 1, fmt.Sprintf(`[{"Label":2,"Weight":12288},{"Label":%d,"Weight":12288},{"Label":100,"Weight":4096}]`, split))
+	checkNeighbors(t, uuid, 100, fmt.Sprintf(`[{"Label":1,"Weight":4096},{"Label":2,"Weight":4096},{"Label":%d,"Weight":4096}]`, split))
+
+	expected := `{"Vertices":[` +
+		`{"Properties":null,"Weight":28672,"Id":1,"Vertices":[2,100]},` +
+		`{"Properties":null,"Weight":32768,"Id":2,"Vertices":[1,100]},` +
+		`{"Properties":null,"Weight":0,"Id":10,"Vertices":[]},` +
+		`{"Properties":null,"Weight":12288,"Id":100,"Vertices":[1,2]}],"Edges":[` +
+		`{"Properties":null,"Weight":12288,"Vertexpair":{"Vertex1":1,"Vertex2":2}},` +
+		`{"Properties":null,"Weight":4096,"Vertexpair":{"Vertex1":1,"Vertex2":100}},` +
+		`{"Properties":null,"Weight":4096,"Vertexpair":{"Vertex1":2,"Vertex2":100}}]}`
+	url = fmt.Sprintf("%snode/%s/graph/subgraph?labels=100,2,1,10", server.WebAPIPath, uuid)
+	if data = server.TestHTTP(t, "GET", url, nil); string(data) != expected {
+		t.Errorf("bad subgraph:\nexpected %s\ngot %s\n", expected, string(data))
+	}
+	url = fmt.Sprintf("%snode/%s/graph/subgraph", server.WebAPIPath, uuid)
+	if data = server.TestHTTP(t, "POST", url, bytes.NewBufferString("[1,2,100,10]")); string(data) != expected {
+		t.Errorf("bad POSTed subgraph:\nexpected %s\ngot %s\n", expected, string(data))
+	}
+	url = fmt.Sprintf("%snode/%s/graph/subgraph?labels=1,a", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", url, nil)
+
+	// Merging 100 into 1 in a child version shouldn't change the parent graph.
+	url = fmt.Sprintf("%snode/%s/commit", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBufferString(`{"note": "first version"}`))
+	url = fmt.Sprintf("%snode/%s/newversion", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "POST", url, nil)
+	var versionResp struct {
+		Child dvid.UUID `json:"child"`
+	}
+	if err := json.Unmarshal(data, &versionResp); err != nil {
+		t.Fatalf("Expected 'child' JSON response.  Got %s\n", string(data))
+	}
+	child := versionResp.Child
+	url = fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, child)
+	server.TestHTTP(t, "POST", url, bytes.NewBufferString("[1,100]"))
+	blockUntilSynced(t, child)
+	checkNeighbors(t, child, 1, fmt.Sprintf(`[{"Label":2,"Weight":16384},{"Label":%d,"Weight":16384}]`, split))
+	checkNeighbors(t, child, 100, `[]`)
+	checkEdge(t, uuid, 1, 2, 12288)
+	checkEdge(t, uuid, 2, 100, 4096)
+
+	// Only labelmap syncs are supported.
+	server.CreateTestInstance(t, child, "labelgraph", "othergraph", config)
+	url = fmt.Sprintf("%snode/%s/graph/sync", server.WebAPIPath, child)
+	server.TestBadHTTP(t, "POST", url, bytes.NewBufferString(`{"sync": "othergraph"}`))
+}
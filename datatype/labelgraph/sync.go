@@ -0,0 +1,367 @@
+/*
+	This file supports keeping the label graph in sync with a labelmap.
+*/
+
+package labelgraph
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/labelmap"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// Number of change messages we can buffer before blocking on sync channel.
+const syncBufferSize = 1000
+
+// Number of blocks whose contacts are updated in one batch.
+const blocksPerBatch = 100
+
+// InitDataHandlers launches goroutines to handle each labelgraph instance's syncs.
+func (d *Data) InitDataHandlers() error {
+	if d.syncCh != nil || d.syncDone != nil {
+		return nil
+	}
+	d.syncCh = make(chan datastore.SyncMessage, syncBufferSize)
+	d.syncDone = make(chan *sync.WaitGroup)
+
+	// Launch handlers of sync events.
+	fmt.Printf("Launching sync event handler for data %q...\n", d.DataName())
+	go d.processEvents()
+	return nil
+}
+
+// Shutdown terminates blocks until syncs are done then terminates background goroutines processing data.
+func (d *Data) Shutdown(wg *sync.WaitGroup) {
+	if d.syncDone != nil {
+		dwg := new(sync.WaitGroup)
+		dwg.Add(1)
+		d.syncDone <- dwg
+		dwg.Wait() // Block until we are done.
+	}
+	wg.Done()
+}
+
+// GetSyncSubs implements the datastore.Syncer interface.  Returns a list of subscriptions
+// to the sync data instance that will notify the receiver.
+func (d *Data) GetSyncSubs(synced dvid.Data) (datastore.SyncSubs, error) {
+	if synced.TypeName() != "labelmap" {
+		return nil, fmt.Errorf("unable to sync %s with %s since datatype %q is not supported", d.DataName(), synced.DataName(), synced.TypeName())
+	}
+	if d.syncCh == nil {
+		if err := d.InitDataHandlers(); err != nil {
+			return nil, fmt.Errorf("unable to initialize handlers for data %q: %v\n", d.DataName(), err)
+		}
+	}
+
+	events := []string{
+		labels.IngestBlockEvent,
+		labels.MutateBlockEvent,
+		labels.MergeBlockEvent,
+		labels.SplitLabelEvent,
+		labels.CleaveLabelEvent,
+		// --- supervoxel split does not change the label of any voxel, so ignored
+	}
+	subs := make(datastore.SyncSubs, len(events))
+	for i, event := range events {
+		subs[i] = datastore.SyncSub{
+			Event:  datastore.SyncEvent{Data: synced.DataUUID(), Event: event},
+			Notify: d.DataUUID(),
+			Ch:     d.syncCh,
+		}
+	}
+	return subs, nil
+}
+
+// SyncPending returns true if any sync messages are in queue
+func (d *Data) SyncPending() bool {
+	return len(d.syncCh) > 0
+}
+
+// If labels are ingested, mutated, merged, split, or cleaved, adjust the affected edges.
+func (d *Data) processEvents() {
+	defer func() {
+		if e := recover(); e != nil {
+			msg := fmt.Sprintf("Panic detected on labelgraph sync thread: %+v\n", e)
+			dvid.ReportPanic(msg, server.WebServer())
+		}
+	}()
+	batcher, err := datastore.GetKeyValueBatcher(d)
+	if err != nil {
+		dvid.Errorf("Exiting sync goroutine for labelgraph %q: %v\n", d.DataName(), err)
+		return
+	}
+	var stop bool
+	var wg *sync.WaitGroup
+	for {
+		select {
+		case wg = <-d.syncDone:
+			queued := len(d.syncCh)
+			if queued > 0 {
+				dvid.Infof("Received shutdown signal for %q sync events (%d in queue)\n", d.DataName(), queued)
+				stop = true
+			} else {
+				dvid.Infof("Shutting down sync event handler for instance %q...\n", d.DataName())
+				wg.Done()
+				return
+			}
+		case msg := <-d.syncCh:
+			ctx := datastore.NewVersionedCtx(d, msg.Version)
+			d.handleSyncMessage(ctx, msg, batcher)
+
+			if stop && len(d.syncCh) == 0 {
+				dvid.Infof("Shutting down sync even handler for instance %q after draining sync events.\n", d.DataName())
+				wg.Done()
+				return
+			}
+		}
+	}
+}
+
+func (d *Data) handleSyncMessage(ctx *datastore.VersionedCtx, msg datastore.SyncMessage, batcher storage.KeyValueBatcher) {
+	d.StartUpdate()
+	defer d.StopUpdate()
+
+	t0 := time.Now()
+	mutation := fmt.Sprintf("sync of labelgraph %s: event %s", d.DataName(), msg.Event)
+	var diagnostic string
+	successful := true
+
+	var err error
+	lm := d.GetSyncedLabelmap()
+	if lm == nil {
+		err = fmt.Errorf("no synced labelmap")
+	} else {
+		switch delta := msg.Delta.(type) {
+		case labelmap.IngestedBlock:
+			err = d.recomputeBlocks(ctx, lm, dvid.IZYXSlice{delta.BCoord}, batcher)
+		case labelmap.MutatedBlock:
+			err = d.recomputeBlocks(ctx, lm, dvid.IZYXSlice{delta.BCoord}, batcher)
+		case labels.DeltaMerge:
+			err = d.mergeLabels(ctx, delta, batcher)
+		case labels.DeltaSplit:
+			err = d.recomputeBlocks(ctx, lm, delta.SortedBlocks, batcher)
+		case labels.CleaveOp:
+			var idx *labels.Index
+			if idx, err = labelmap.GetLabelIndex(lm, ctx.VersionID(), delta.CleavedLabel, false); err == nil {
+				err = d.recomputeBlocks(ctx, lm, idx.GetBlockIndices(), batcher)
+			}
+		default:
+			err = fmt.Errorf("unexpected delta: %v", msg)
+		}
+	}
+	if err != nil {
+		diagnostic = fmt.Sprintf("labelgraph %s could not process event %s: %v", d.DataName(), msg.Event, err)
+		dvid.Criticalf("labelgraph %q could not process event %s: %v\n", d.DataName(), msg.Event, err)
+		successful = false
+	}
+
+	if server.KafkaAvailable() {
+		t := time.Since(t0)
+		activity := map[string]interface{}{
+			"time":       t0.Unix(),
+			"duration":   t.Seconds() * 1000.0,
+			"mutation":   mutation,
+			"successful": successful,
+		}
+		if diagnostic != "" {
+			activity["diagnostic"] = diagnostic
+		}
+		storage.LogActivityToKafka(activity)
+	}
+}
+
+// mergeLabels relabels the contacts of merged labels to the target label.  Since a merge
+// only changes the labels of voxels, no voxels need to be read.
+func (d *Data) mergeLabels(ctx *datastore.VersionedCtx, delta labels.DeltaMerge, batcher storage.KeyValueBatcher) error {
+	mapping := make(map[uint64]uint64, len(delta.Merged))
+	for merged := range delta.Merged {
+		mapping[merged] = delta.Target
+	}
+	return d.updateBlocks(ctx, delta.Blocks, batcher, func(bcoord dvid.IZYXString, old contacts) (contacts, bool, error) {
+		cur, changed := old.relabel(mapping)
+		return cur, changed, nil
+	})
+}
+
+// recomputeBlocks recomputes the contacts of blocks from the current labels of a labelmap.
+func (d *Data) recomputeBlocks(ctx *datastore.VersionedCtx, lm *labelmap.Data, blocks dvid.IZYXSlice, batcher storage.KeyValueBatcher) error {
+	v := ctx.VersionID()
+	getVoxels := func(chunkPt dvid.ChunkPoint3d) (blockVoxels, error) {
+		block, err := lm.GetLabelBlock(v, chunkPt)
+		if err != nil {
+			return blockVoxels{}, err
+		}
+		return newBlockVoxels(block), nil
+	}
+	return d.updateBlocks(ctx, blocks, batcher, func(bcoord dvid.IZYXString, old contacts) (contacts, bool, error) {
+		chunkPt, err := bcoord.ToChunkPoint3d()
+		if err != nil {
+			return nil, false, err
+		}
+		bv, err := getVoxels(chunkPt)
+		if err != nil {
+			return nil, false, err
+		}
+		var next [3]blockVoxels
+		for axis := 0; axis < 3; axis++ {
+			nextPt := chunkPt
+			nextPt[axis]++
+			if next[axis], err = getVoxels(nextPt); err != nil {
+				return nil, false, err
+			}
+		}
+		cur, err := computeContacts(bv, next)
+		return cur, true, err
+	})
+}
+
+// affectedBlocks returns the sorted blocks whose contacts can change if the voxels of the
+// given blocks change.  Since each block holds the contacts across the faces it shares with
+// the next blocks along each axis, the previous blocks along each axis are also affected.
+func affectedBlocks(blocks dvid.IZYXSlice) (dvid.IZYXSlice, error) {
+	affected := make(map[dvid.IZYXString]struct{}, 4*len(blocks))
+	for _, bcoord := range blocks {
+		chunkPt, err := bcoord.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		affected[bcoord] = struct{}{}
+		for axis := 0; axis < 3; axis++ {
+			prevPt := chunkPt
+			prevPt[axis]--
+			affected[prevPt.ToIZYXString()] = struct{}{}
+		}
+	}
+	sorted := make(dvid.IZYXSlice, 0, len(affected))
+	for bcoord := range affected {
+		sorted = append(sorted, bcoord)
+	}
+	sort.Sort(sorted)
+	return sorted, nil
+}
+
+// contactsFunc returns the current contacts of a block given the previously stored contacts
+// and whether they have changed.
+type contactsFunc func(bcoord dvid.IZYXString, old contacts) (cur contacts, changed bool, err error)
+
+// updateBlocks stores the current contacts for the blocks affected by changes to the given
+// blocks and applies any change in contacts to the edge weights.
+func (d *Data) updateBlocks(ctx *datastore.VersionedCtx, blocks dvid.IZYXSlice, batcher storage.KeyValueBatcher, f contactsFunc) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	affected, err := affectedBlocks(blocks)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(affected); start += blocksPerBatch {
+		end := start + blocksPerBatch
+		if end > len(affected) {
+			end = len(affected)
+		}
+		batch := batcher.NewBatch(ctx)
+		changes := make(map[labelPair]int64)
+		for _, bcoord := range affected[start:end] {
+			old, err := d.getBlockContacts(ctx, store, bcoord)
+			if err != nil {
+				return err
+			}
+			cur, changed, err := f(bcoord, old)
+			if err != nil {
+				return fmt.Errorf("block %s: %v", bcoord, err)
+			}
+			if !changed {
+				continue
+			}
+			for pair, n := range old {
+				changes[pair] -= int64(n)
+			}
+			for pair, n := range cur {
+				changes[pair] += int64(n)
+			}
+			if len(cur) == 0 {
+				if len(old) != 0 {
+					batch.Delete(NewBlockContactsTKey(bcoord))
+				}
+				continue
+			}
+			val, err := cur.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			batch.Put(NewBlockContactsTKey(bcoord), val)
+		}
+		for pair, change := range changes {
+			if change == 0 {
+				continue
+			}
+			weight, err := d.getEdgeWeight(ctx, store, pair.label1, pair.label2)
+			if err != nil {
+				return err
+			}
+			if change < 0 && uint64(-change) > weight {
+				dvid.Criticalf("labelgraph %q received change that would subtract %d from weight %d of edge %d-%d!  Setting floor at 0.\n", d.DataName(), -change, weight, pair.label1, pair.label2)
+				weight = 0
+			} else {
+				weight = uint64(int64(weight) + change)
+			}
+			putEdge(batch, pair, weight)
+		}
+		if err := batch.Commit(); err != nil {
+			return fmt.Errorf("bad commit of %d blocks: %v", end-start, err)
+		}
+	}
+	return nil
+}
+
+// getBlockContacts returns the stored contacts for a block.
+func (d *Data) getBlockContacts(ctx *datastore.VersionedCtx, store storage.OrderedKeyValueDB, bcoord dvid.IZYXString) (contacts, error) {
+	val, err := store.Get(ctx, NewBlockContactsTKey(bcoord))
+	if err != nil {
+		return nil, err
+	}
+	var c contacts
+	if err := c.UnmarshalBinary(val); err != nil {
+		return nil, fmt.Errorf("block %s: %v", bcoord, err)
+	}
+	return c, nil
+}
+
+// getEdgeWeight returns the stored weight of an edge or 0 if the labels aren't adjacent.
+func (d *Data) getEdgeWeight(ctx *datastore.VersionedCtx, store storage.OrderedKeyValueDB, label1, label2 uint64) (uint64, error) {
+	val, err := store.Get(ctx, NewEdgeTKey(label1, label2))
+	if err != nil {
+		return 0, err
+	}
+	if val == nil {
+		return 0, nil
+	}
+	if len(val) != 8 {
+		return 0, fmt.Errorf("bad size in value for edge %d-%d: value has length %d", label1, label2, len(val))
+	}
+	return binary.LittleEndian.Uint64(val), nil
+}
+
+// putEdge adds to the batch the weight of an edge under both of its labels.  A zero weight
+// removes the edge.
+func putEdge(batch storage.Batch, pair labelPair, weight uint64) {
+	if weight == 0 {
+		batch.Delete(NewEdgeTKey(pair.label1, pair.label2))
+		batch.Delete(NewEdgeTKey(pair.label2, pair.label1))
+		return
+	}
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, weight)
+	batch.Put(NewEdgeTKey(pair.label1, pair.label2), buf)
+	batch.Put(NewEdgeTKey(pair.label2, pair.label1), buf)
+}
@@ -634,8 +634,9 @@ func (d *Data) getSupervoxelBlock(v dvid.VersionID, bcoord dvid.ChunkPoint3d, sc
 	return &block, nil
 }
 
-// getBlockLabels returns a block of labels at given scale in packed little-endian uint64 format.
-func (d *Data) getBlockLabels(v dvid.VersionID, bcoord dvid.ChunkPoint3d, scale uint8, supervoxels bool) ([]byte, error) {
+// getMappedBlock returns a compressed Block of the given block coordinate with supervoxels
+// mapped to their labels unless supervoxels is true.
+func (d *Data) getMappedBlock(v dvid.VersionID, bcoord dvid.ChunkPoint3d, scale uint8, supervoxels bool) (*labels.Block, error) {
 	block, err := d.getSupervoxelBlock(v, bcoord, scale)
 	if err != nil {
 		return nil, err
@@ -652,6 +653,15 @@ func (d *Data) getBlockLabels(v dvid.VersionID, bcoord dvid.ChunkPoint3d, scale
 			return nil, fmt.Errorf("unable to modify block %s mapping: %v", bcoord, err)
 		}
 	}
+	return block, nil
+}
+
+// getBlockLabels returns a block of labels at given scale in packed little-endian uint64 format.
+func (d *Data) getBlockLabels(v dvid.VersionID, bcoord dvid.ChunkPoint3d, scale uint8, supervoxels bool) ([]byte, error) {
+	block, err := d.getMappedBlock(v, bcoord, scale, supervoxels)
+	if err != nil {
+		return nil, err
+	}
 	labelData, _ := block.MakeLabelVolume()
 	return labelData, nil
 }
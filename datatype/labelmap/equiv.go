@@ -180,7 +180,10 @@ func addCleaveToMapping(d dvid.Data, v dvid.VersionID, op labels.CleaveOp) error
 		supervoxelSet[supervoxel] = struct{}{}
 		lmap.setMapping(v, supervoxel, op.CleavedLabel)
 	}
-	lmap.setMapping(v, op.CleavedLabel, 0)
+	// The cleaved label can be a supervoxel, e.g., if a merge is reverted, so don't unmap it.
+	if _, found := supervoxelSet[op.CleavedLabel]; !found {
+		lmap.setMapping(v, op.CleavedLabel, 0)
+	}
 	mapOp := labels.MappingOp{
 		MutID:    op.MutID,
 		Mapped:   op.CleavedLabel,
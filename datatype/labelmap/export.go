@@ -0,0 +1,123 @@
+// +build ngprecomputed
+
+/*
+	This file supports export of labelmap versions into neuroglancer precomputed format.
+*/
+
+package labelmap
+
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+	"github.com/janelia-flyem/dvid/storage/ngprecomputed"
+)
+
+// exportPrecomputed writes all scales of the given version as a neuroglancer precomputed
+// segmentation volume with raw uint64 chunks into a local directory.  Unless supervoxels
+// is true, labels are mapped to their agglomerated bodies for the version.
+func (d *Data) exportPrecomputed(v dvid.VersionID, dir string, supervoxels, sharded bool) error {
+	timedLog := dvid.NewTimeLog()
+	ctx := datastore.NewVersionedCtx(d, v)
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return fmt.Errorf("data %q does not have 3d block size", d.DataName())
+	}
+	extents, err := d.GetExtents(ctx)
+	if err != nil {
+		return err
+	}
+	if extents.MinPoint == nil || extents.MaxPoint == nil {
+		return fmt.Errorf("data %q has no extents at version %d", d.DataName(), v)
+	}
+	var size dvid.Point3d
+	var resolution [3]float64
+	for dim := uint8(0); dim < 3; dim++ {
+		if extents.MinPoint.Value(dim) < 0 {
+			return fmt.Errorf("data %q has negative coordinates, which can't be exported", d.DataName())
+		}
+		size[dim] = extents.MaxPoint.Value(dim) + 1
+		resolution[dim] = float64(d.Properties.Resolution.VoxelSize[dim])
+	}
+
+	numScales := int(d.MaxDownresLevel) + 1
+	config := ngprecomputed.VolumeConfig{
+		VolumeType: "segmentation",
+		DataType:   "uint64",
+		Scales:     make([]ngprecomputed.ScaleConfig, numScales),
+	}
+	for scale := 0; scale < numScales; scale++ {
+		var scaleSize dvid.Point3d
+		var scaleRes [3]float64
+		for dim := 0; dim < 3; dim++ {
+			scaleSize[dim] = (size[dim] + (1 << uint(scale)) - 1) >> uint(scale)
+			scaleRes[dim] = resolution[dim] * float64(int(1)<<uint(scale))
+		}
+		config.Scales[scale] = ngprecomputed.ScaleConfig{
+			ChunkSize:  blockSize,
+			Size:       scaleSize,
+			Resolution: scaleRes,
+			Encoding:   "raw",
+		}
+		if sharded {
+			config.Scales[scale].SetDefaultSharding()
+		}
+	}
+
+	var mapping *VCache
+	if !supervoxels {
+		if mapping, err = getMapping(d, v); err != nil {
+			return err
+		}
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	writer, err := ngprecomputed.NewWriter(dir, config)
+	if err != nil {
+		return err
+	}
+	var numBlocks int
+	for scale := uint8(0); int(scale) < numScales; scale++ {
+		begTKey := NewBlockTKeyByCoord(scale, dvid.MinIndexZYX.ToIZYXString())
+		endTKey := NewBlockTKeyByCoord(scale, dvid.MaxIndexZYX.ToIZYXString())
+		err = store.ProcessRange(ctx, begTKey, endTKey, nil, func(c *storage.Chunk) error {
+			if c == nil || c.V == nil {
+				return nil
+			}
+			_, idx, err := DecodeBlockTKey(c.K)
+			if err != nil {
+				return err
+			}
+			data, _, err := dvid.DeserializeData(c.V, true)
+			if err != nil {
+				return fmt.Errorf("unable to deserialize block %s: %v", idx, err)
+			}
+			var block labels.Block
+			if err := block.UnmarshalBinary(data); err != nil {
+				return fmt.Errorf("unable to unmarshal block %s: %v", idx, err)
+			}
+			if mapping != nil {
+				modifyBlockMapping(v, &block, mapping)
+			}
+			lblarray, _ := block.MakeLabelVolume()
+			if err := writer.WriteChunk(int(scale), dvid.ChunkPoint3d(*idx), lblarray); err != nil {
+				return fmt.Errorf("unable to write block %s, scale %d after %d exported blocks: %v", idx, scale, numBlocks, err)
+			}
+			numBlocks++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	timedLog.Infof("Exported %d blocks in %d scales of data %q to precomputed volume %q", numBlocks, numScales, d.DataName(), dir)
+	return nil
+}
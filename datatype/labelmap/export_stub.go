@@ -0,0 +1,14 @@
+// +build !ngprecomputed
+
+package labelmap
+
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// exportPrecomputed requires the ngprecomputed build tag.
+func (d *Data) exportPrecomputed(v dvid.VersionID, dir string, supervoxels, sharded bool) error {
+	return fmt.Errorf("DVID was not built with ngprecomputed support")
+}
@@ -0,0 +1,101 @@
+// +build ngprecomputed
+
+package labelmap
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/downres"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+func TestExportPrecomputed(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("MaxDownresLevel", "1")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	volume := newTestVolume(128, 128, 128)
+	volume.addSubvol(dvid.Point3d{40, 40, 40}, dvid.Point3d{40, 40, 40}, 1)
+	volume.addSubvol(dvid.Point3d{40, 40, 80}, dvid.Point3d{40, 40, 40}, 2)
+	volume.put(t, uuid, "labels")
+	if err := downres.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+	mergeReq := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", mergeReq, strings.NewReader("[1, 2]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+
+	dataservice, err := datastore.GetDataByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, ok := dataservice.(*Data)
+	if !ok {
+		t.Fatalf("can't cast labels data service into labelmap.Data\n")
+	}
+	dir, err := ioutil.TempDir("", "labelmap-precomputed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := d.exportPrecomputed(v, dir, false, false); err != nil {
+		t.Fatalf("error exporting precomputed: %v\n", err)
+	}
+
+	infoJSON, err := ioutil.ReadFile(filepath.Join(dir, "info"))
+	if err != nil {
+		t.Fatalf("unable to read info file: %v\n", err)
+	}
+	var info struct {
+		Type     string `json:"type"`
+		DataType string `json:"data_type"`
+		Scales   []struct {
+			Key  string       `json:"key"`
+			Size dvid.Point3d `json:"size"`
+		} `json:"scales"`
+	}
+	if err := json.Unmarshal(infoJSON, &info); err != nil {
+		t.Fatalf("bad info file: %s\n", string(infoJSON))
+	}
+	if info.Type != "segmentation" || info.DataType != "uint64" || len(info.Scales) != 2 {
+		t.Fatalf("bad info file: %s\n", string(infoJSON))
+	}
+	if info.Scales[0].Size != (dvid.Point3d{128, 128, 128}) || info.Scales[1].Size != (dvid.Point3d{64, 64, 64}) {
+		t.Fatalf("bad scale sizes in info file: %s\n", string(infoJSON))
+	}
+
+	// check voxel in label 2 is exported as merged label 1 for both scales.
+	checkVoxel := func(scale int, chunkName string, x, y, z int32) {
+		data, err := ioutil.ReadFile(filepath.Join(dir, info.Scales[scale].Key, chunkName))
+		if err != nil {
+			t.Fatalf("unable to read scale %d chunk %q: %v\n", scale, chunkName, err)
+		}
+		if len(data) != 64*64*64*8 {
+			t.Fatalf("expected full chunk, got %d bytes\n", len(data))
+		}
+		i := (z*64*64 + y*64 + x) * 8
+		if label := binary.LittleEndian.Uint64(data[i : i+8]); label != 1 {
+			t.Errorf("expected label 1 at (%d,%d,%d) in scale %d chunk %q, got %d\n", x, y, z, scale, chunkName, label)
+		}
+	}
+	checkVoxel(0, "0-64_0-64_64-128", 50, 50, 100-64)
+	checkVoxel(0, "0-64_0-64_0-64", 50, 50, 50)
+	checkVoxel(1, "0-64_0-64_0-64", 25, 25, 50)
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/datatype/common/labels"
 	"github.com/janelia-flyem/dvid/datatype/common/proto"
+	"github.com/janelia-flyem/dvid/datatype/imageblk"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 	pb "google.golang.org/protobuf/proto"
@@ -839,6 +840,51 @@ func (d *Data) handlePseudocolor(ctx *datastore.VersionedCtx, w http.ResponseWri
 	timedLog.Infof("HTTP GET pseudocolor with shape %s, size %s, offset %s", parts[4], parts[5], parts[6])
 }
 
+func (d *Data) handlePrecomputed(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/precomputed/info
+	// GET <api URL>/node/<UUID>/<data name>/precomputed/<scale key>/<x0-x1_y0-y1_z0-z1>
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "only GET action is available on precomputed endpoint")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+	numScales := int(d.MaxDownresLevel) + 1
+	if len(parts) == 5 && parts[4] == "info" {
+		jsonBytes, err := d.PrecomputedInfo(ctx, "segmentation", "uint64", numScales)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(jsonBytes))
+		timedLog.Infof("HTTP GET precomputed info for %q", d.DataName())
+		return
+	}
+	if len(parts) != 6 {
+		server.BadRequest(w, r, "precomputed endpoint must be followed by info or <scale key>/<chunk name>")
+		return
+	}
+	scale, subvol, err := d.ParsePrecomputedChunk(parts[4], parts[5], numScales)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	lbl, err := d.NewLabels(subvol, nil)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	data, err := d.GetVolume(ctx.VersionID(), lbl, false, scale, "")
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if err := imageblk.WritePrecomputedChunk(w, r, data); err != nil {
+		dvid.Errorf("unable to write precomputed chunk %s: %v\n", subvol, err)
+	}
+	timedLog.Infof("HTTP GET precomputed chunk %s at scale %d for %q", parts[5], scale, d.DataName())
+}
+
 func (d *Data) handleDataRequest(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
 	if len(parts) < 7 {
 		server.BadRequest(w, r, "'%s' must be followed by shape/size/offset", parts[3])
@@ -41,6 +41,9 @@ const (
 
 	// mutation cache keys = label + mutid. value = label index just before mutation applied.
 	keyMutcache = 240
+
+	// key = mutation id. value = JSON of information needed to revert a merge or cleave.
+	keyRevert = 241
 )
 
 // DescribeTKeyClass returns a string explanation of what a particular TKeyClass
@@ -63,11 +66,56 @@ func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
 		return "labelmap next label key"
 	case keyMutcache:
 		return "labelmap mutation cache key"
+	case keyRevert:
+		return "labelmap mutation revert key"
 	default:
 	}
 	return "unknown labelmap key"
 }
 
+// DescribeTKey returns a human-readable description of a type-specific key, e.g., the block
+// coordinate or label.  Implements the datastore.TKeyDescriber interface.
+func (d *Data) DescribeTKey(tk storage.TKey) (string, error) {
+	class, err := tk.Class()
+	if err != nil {
+		return "", err
+	}
+	switch class {
+	case keyLabelBlock:
+		scale, idx, err := DecodeBlockTKey(tk)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("block %s scale %d", dvid.ChunkPoint3d(*idx), scale), nil
+	case keyLabelIndex:
+		label, err := DecodeLabelIndexTKey(tk)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("label %d", label), nil
+	case keyAffinities:
+		label, err := DecodeAffinitiesTKey(tk)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("affinities for label %d", label), nil
+	case keyMutcache:
+		label, mutID, err := decodeMutcacheKey(tk)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("mutation cache for label %d, mutation %d", label, mutID), nil
+	case keyRevert:
+		mutID, err := decodeRevertTKey(tk)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("revert record for mutation %d", mutID), nil
+	default:
+		return d.DescribeTKeyClass(class), nil
+	}
+}
+
 var (
 	maxLabelTKey     = storage.NewTKey(keyLabelMax, nil)
 	maxRepoLabelTKey = storage.NewTKey(keyRepoLabelMax, nil)
@@ -165,3 +213,24 @@ func decodeMutcacheKey(tk storage.TKey) (label, mutid uint64, err error) {
 	mutid = math.MaxUint64 - binary.BigEndian.Uint64(ibytes[8:16])
 	return
 }
+
+// newRevertTKey returns a TKey for the revert record of a mutation.
+func newRevertTKey(mutID uint64) storage.TKey {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, mutID)
+	return storage.NewTKey(keyRevert, buf)
+}
+
+func decodeRevertTKey(tk storage.TKey) (mutID uint64, err error) {
+	var ibytes []byte
+	ibytes, err = tk.ClassBytes(keyRevert)
+	if err != nil {
+		return
+	}
+	if len(ibytes) != 8 {
+		err = fmt.Errorf("bad key size (%d) for revert key", len(ibytes))
+		return
+	}
+	mutID = binary.BigEndian.Uint64(ibytes)
+	return
+}
@@ -56,6 +56,7 @@ func (d *Data) Initialize() {
 	} else {
 		indexCache.Clear()
 	}
+	initMeshCache()
 
 	mutcachePath := server.MutcachePath(d.DataName())
 	if mutcachePath != "" {
@@ -416,6 +417,7 @@ func putCachedLabelIndex(d dvid.Data, v dvid.VersionID, idx *labels.Index) error
 	if err := putLabelIndexAndMax(ctx, idx); err != nil {
 		return err
 	}
+	invalidateMeshes(d, v, idx.Label)
 	if indexCache != nil {
 		idxBytes, err := pb.Marshal(idx)
 		if err != nil {
@@ -435,6 +437,7 @@ func deleteCachedLabelIndex(d dvid.Data, v dvid.VersionID, label uint64) error {
 	if err := deleteLabelIndex(ctx, label); err != nil {
 		return err
 	}
+	invalidateMeshes(d, v, label)
 	if indexCache != nil {
 		k := indexKey{data: d, version: v, label: label}.Bytes()
 		indexCache.Del(k)
@@ -695,8 +698,10 @@ func (d *Data) cleaveIndex(v dvid.VersionID, op labels.CleaveOp, info dvid.ModIn
 
 // ChangeLabelIndex applies changes to a label's index and then stores the result.
 // Supervoxel size changes for blocks should be passed into the function.  The passed
-// SupervoxelDelta can contain more supervoxels than the label index.
-func ChangeLabelIndex(d dvid.Data, v dvid.VersionID, label uint64, delta labels.SupervoxelChanges) error {
+// SupervoxelDelta can contain more supervoxels than the label index.  An existing index
+// is marked as last modified by the given mutation, e.g., so reverts of earlier merges
+// can detect later painting into the body.
+func ChangeLabelIndex(d dvid.Data, v dvid.VersionID, label, mutID uint64, delta labels.SupervoxelChanges) error {
 	shard := label % numIndexShards
 	indexMu[shard].Lock()
 	defer indexMu[shard].Unlock()
@@ -708,6 +713,8 @@ func ChangeLabelIndex(d dvid.Data, v dvid.VersionID, label uint64, delta labels.
 	if idx == nil {
 		idx = new(labels.Index)
 		idx.Label = label
+	} else if mutID > idx.LastMutId {
+		idx.LastMutId = mutID
 	}
 
 	if err := idx.ModifyBlocks(label, delta); err != nil {
@@ -720,30 +727,67 @@ func ChangeLabelIndex(d dvid.Data, v dvid.VersionID, label uint64, delta labels.
 	return putCachedLabelIndex(d, v, idx)
 }
 
-// getMergedIndex gets index data for all labels in a set with possible bounds.
-func (d *Data) getMergedIndex(v dvid.VersionID, mutID uint64, lbls labels.Set, bounds dvid.Bounds) (*labels.Index, error) {
+// ProcessLabelSizes calls the given function with the label and number of voxels for each
+// indexed label at the given version, in label order.
+func ProcessLabelSizes(d dvid.Data, v dvid.VersionID, f func(label, numVoxels uint64) error) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return fmt.Errorf("problem getting store for data %q: %v", d.DataName(), err)
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	begTKey := NewLabelIndexTKey(0)
+	endTKey := NewLabelIndexTKey(math.MaxUint64)
+	return store.ProcessRange(ctx, begTKey, endTKey, nil, func(c *storage.Chunk) error {
+		if c == nil || len(c.V) == 0 {
+			return nil
+		}
+		label, err := DecodeLabelIndexTKey(c.K)
+		if err != nil {
+			return err
+		}
+		data, _, err := dvid.DeserializeData(c.V, true)
+		if err != nil {
+			return err
+		}
+		idx := new(labels.Index)
+		if err := pb.Unmarshal(data, idx); err != nil {
+			return err
+		}
+		return f(label, idx.NumVoxels())
+	})
+}
+
+// getMergedIndex gets index data for all labels in a set with possible bounds.  The
+// supervoxels of each label before any bounds are applied are also returned.
+func (d *Data) getMergedIndex(v dvid.VersionID, mutID uint64, lbls labels.Set, bounds dvid.Bounds) (*labels.Index, map[uint64][]uint64, error) {
 	if len(lbls) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 	idx := new(labels.Index)
+	supervoxels := make(map[uint64][]uint64, len(lbls))
 	for label := range lbls {
 		idx2, err := GetLabelIndex(d, v, label, false)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if err := d.addMutcache(v, mutID, idx2); err != nil {
 			dvid.Criticalf("unable to add merge mutid %d index %d: %v\n", mutID, label, err)
 		}
+		if idx2 != nil {
+			for supervoxel := range idx2.GetSupervoxels() {
+				supervoxels[label] = append(supervoxels[label], supervoxel)
+			}
+		}
 		if bounds.Block != nil && bounds.Block.IsSet() {
 			if err := idx2.FitToBounds(bounds.Block); err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 		}
 		if err := idx.Add(idx2); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
-	return idx, nil
+	return idx, supervoxels, nil
 }
 
 // given supervoxels with given mapping and whether they were actually in in-memory SVMap, check
@@ -903,6 +947,7 @@ func (d *Data) handleBlockMutate(v dvid.VersionID, ch chan blockChange, mut Muta
 		return
 	}
 	bc := blockChange{
+		mutID:  mut.MutID,
 		bcoord: mut.BCoord,
 	}
 	if d.IndexedLabels {
@@ -922,6 +967,7 @@ func (d *Data) handleBlockIndexing(v dvid.VersionID, ch chan blockChange, mut In
 		return
 	}
 	bc := blockChange{
+		mutID:  mut.MutID,
 		bcoord: mut.BCoord,
 	}
 	if d.IndexedLabels {
@@ -934,6 +980,7 @@ func (d *Data) handleBlockIndexing(v dvid.VersionID, ch chan blockChange, mut In
 // sends supervoxel-specific changes to concurrency-handling label indexing functions.
 
 type blockChange struct {
+	mutID  uint64
 	bcoord dvid.IZYXString
 	delta  map[uint64]int32
 }
@@ -944,8 +991,12 @@ func (d *Data) aggregateBlockChanges(v dvid.VersionID, svmap *VCache, ch <-chan
 	mappedVersions := svmap.getMappedVersionsDist(v)
 	labelset := make(labels.Set)
 	svChanges := make(labels.SupervoxelChanges)
-	var maxLabel uint64
+	sizeChanges := make(map[uint64]int64)
+	var maxLabel, lastMutID uint64
 	for change := range ch {
+		if change.mutID > lastMutID {
+			lastMutID = change.mutID
+		}
 		for supervoxel, delta := range change.delta {
 			blockChanges, found := svChanges[supervoxel]
 			if !found {
@@ -958,6 +1009,7 @@ func (d *Data) aggregateBlockChanges(v dvid.VersionID, svmap *VCache, ch <-chan
 			}
 			label, _ := svmap.mapLabel(supervoxel, mappedVersions)
 			labelset[label] = struct{}{}
+			sizeChanges[label] += int64(delta)
 		}
 	}
 	go func() {
@@ -967,10 +1019,26 @@ func (d *Data) aggregateBlockChanges(v dvid.VersionID, svmap *VCache, ch <-chan
 	}()
 	if d.IndexedLabels {
 		for label := range labelset {
-			if err := ChangeLabelIndex(d, v, label, svChanges); err != nil {
+			if err := ChangeLabelIndex(d, v, label, lastMutID, svChanges); err != nil {
 				dvid.Errorf("indexing label %d: %v\n", label, err)
 			}
 		}
+
+		// Publish change in label sizes after indexing so syncs see consistent sizes.
+		for label, change := range sizeChanges {
+			if label == 0 || change == 0 {
+				continue
+			}
+			delta := labels.DeltaModSize{
+				Label:      label,
+				SizeChange: change,
+			}
+			evt := datastore.SyncEvent{Data: d.DataUUID(), Event: labels.ChangeSizeEvent}
+			msg := datastore.SyncMessage{Event: labels.ChangeSizeEvent, Version: v, Delta: delta}
+			if err := datastore.NotifySubscribers(evt, msg); err != nil {
+				dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
+			}
+		}
 	}
 }
 
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	pb "google.golang.org/protobuf/proto"
 
@@ -451,3 +452,197 @@ func TestIngest2(t *testing.T) {
 	apiStr = fmt.Sprintf("%snode/%s/labels/blocks?noindexing=true", server.WebAPIPath, uuid)
 	server.TestBadHTTP(t, "POST", apiStr, &buf)
 }
+
+func TestMergeLabelIndices(t *testing.T) {
+	serialize := func(idx *labels.Index) []byte {
+		data, err := pb.Marshal(idx)
+		if err != nil {
+			t.Fatalf("couldn't marshal index: %v\n", err)
+		}
+		compressFormat, _ := dvid.NewCompression(dvid.LZ4, dvid.DefaultCompression)
+		compressed, err := dvid.SerializeData(data, compressFormat, dvid.NoChecksum)
+		if err != nil {
+			t.Fatalf("couldn't serialize index: %v\n", err)
+		}
+		return compressed
+	}
+	block1 := labels.EncodeBlockIndex(1, 2, 3)
+	block2 := labels.EncodeBlockIndex(4, 5, 6)
+
+	base := new(labels.Index)
+	base.Label = 10
+	base.Blocks = map[uint64]*proto.SVCount{
+		block1: {Counts: map[uint64]uint32{10: 100, 11: 50}},
+	}
+
+	// first parent adds voxels to supervoxel 10 and a new block.
+	parent1 := new(labels.Index)
+	parent1.Label = 10
+	parent1.LastMutId = 5
+	parent1.LastModUser = "first"
+	parent1.Blocks = map[uint64]*proto.SVCount{
+		block1: {Counts: map[uint64]uint32{10: 120, 11: 50}},
+		block2: {Counts: map[uint64]uint32{12: 30}},
+	}
+
+	// second parent removes supervoxel 11.
+	parent2 := new(labels.Index)
+	parent2.Label = 10
+	parent2.LastMutId = 7
+	parent2.LastModUser = "second"
+	parent2.Blocks = map[uint64]*proto.SVCount{
+		block1: {Counts: map[uint64]uint32{10: 100}},
+	}
+
+	c := &datastore.MergeConflict{
+		TKey:   NewLabelIndexTKey(10),
+		Base:   serialize(base),
+		Values: [][]byte{serialize(parent1), serialize(parent2)},
+	}
+	merged, err := mergeLabelIndices(10, c)
+	if err != nil {
+		t.Fatalf("unable to merge label indices: %v\n", err)
+	}
+	idx, err := decodeMergeIndex(merged)
+	if err != nil {
+		t.Fatalf("unable to decode merged label index: %v\n", err)
+	}
+	expected := new(labels.Index)
+	expected.Label = 10
+	expected.LastMutId = 7
+	expected.LastModUser = "second"
+	expected.Blocks = map[uint64]*proto.SVCount{
+		block1: {Counts: map[uint64]uint32{10: 120}},
+		block2: {Counts: map[uint64]uint32{12: 30}},
+	}
+	if !pb.Equal(&idx.LabelIndex, &expected.LabelIndex) {
+		t.Fatalf("expected merged index:\n%v\ngot:\n%v\n", expected, idx)
+	}
+
+	// if all voxels are removed, the index should be deleted.
+	empty := new(labels.Index)
+	empty.Label = 10
+	c.Values = [][]byte{serialize(empty), serialize(base)}
+	if merged, err = mergeLabelIndices(10, c); err != nil {
+		t.Fatalf("unable to merge label indices: %v\n", err)
+	}
+	if merged != nil {
+		t.Fatalf("expected deleted index after merge, got %d bytes\n", len(merged))
+	}
+}
+
+// creates two parents off a root where both paint the voxels with x in [16,32) of a
+// block, the first parent with label 2 and the second with label 3.
+func createMergeParents(t *testing.T) (root dvid.UUID, parents []dvid.UUID) {
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", dvid.Config{})
+
+	volume := newTestVolume(64, 64, 64)
+	volume.addSubvol(dvid.Point3d{0, 0, 0}, dvid.Point3d{64, 64, 64}, 1)
+	volume.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+	if err := datastore.Commit(uuid, "root", nil); err != nil {
+		t.Fatalf("Unable to commit root node %s: %v\n", uuid, err)
+	}
+
+	parents = make([]dvid.UUID, 2)
+	for i, label := range []uint64{2, 3} {
+		var err error
+		if parents[i], err = datastore.NewVersion(uuid, "paint", fmt.Sprintf("branch%d", i), nil); err != nil {
+			t.Fatalf("Unable to create child off root %s: %v\n", uuid, err)
+		}
+		volume = newTestVolume(64, 64, 64)
+		volume.addSubvol(dvid.Point3d{0, 0, 0}, dvid.Point3d{64, 64, 64}, 1)
+		volume.addSubvol(dvid.Point3d{int32(i) * 16, 0, 0}, dvid.Point3d{32, 64, 64}, label)
+		volume.putMutable(t, parents[i], "labels")
+		if err := datastore.BlockOnUpdating(parents[i], "labels"); err != nil {
+			t.Fatalf("Error blocking on update for labels: %v\n", err)
+		}
+		if err := datastore.Commit(parents[i], "painted", nil); err != nil {
+			t.Fatalf("Unable to commit node %s: %v\n", parents[i], err)
+		}
+	}
+	return uuid, parents
+}
+
+func TestAutoMergeSameVoxels(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	// The first parent takes priority for voxels painted by both.
+	uuid, parents := createMergeParents(t)
+	mergeJSON := fmt.Sprintf(`{"mergeType":"auto","parents":[%q,%q],"note":"auto merge"}`, parents[0], parents[1])
+	mergeReq := fmt.Sprintf("%srepo/%s/merge", server.WebAPIPath, uuid)
+	returnValue := server.TestHTTP(t, "POST", mergeReq, strings.NewReader(mergeJSON))
+	var mergeResp struct {
+		Child dvid.UUID `json:"child"`
+	}
+	if err := json.Unmarshal(returnValue, &mergeResp); err != nil {
+		t.Fatalf("Can't parse return of merge request: %s\n", string(returnValue))
+	}
+	statusReq := fmt.Sprintf("%srepo/%s/merge/%s", server.WebAPIPath, uuid, mergeResp.Child)
+	var status datastore.MergeStatus
+	for i := 0; i < 100; i++ {
+		returnValue = server.TestHTTP(t, "GET", statusReq, nil)
+		if err := json.Unmarshal(returnValue, &status); err != nil {
+			t.Fatalf("Can't parse return of merge status request: %s\n", string(returnValue))
+		}
+		if status.State != "running" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if status.State != "done" {
+		t.Fatalf("Expected merge to complete, got status: %v\n", status)
+	}
+
+	merged := newTestVolume(64, 64, 64)
+	merged.get(t, mergeResp.Child, "labels", true)
+	merged.verifyLabel(t, 2, 20, 10, 10)
+	merged.verifyLabel(t, 3, 40, 10, 10)
+	merged.verifyLabel(t, 1, 50, 10, 10)
+
+	expected := map[uint64]uint64{1: 16 * 64 * 64, 2: 32 * 64 * 64, 3: 16 * 64 * 64}
+	for label, expectedSize := range expected {
+		reqStr := fmt.Sprintf("%snode/%s/labels/size/%d", server.WebAPIPath, mergeResp.Child, label)
+		r := server.TestHTTP(t, "GET", reqStr, nil)
+		var jsonVal struct {
+			Voxels uint64 `json:"voxels"`
+		}
+		if err := json.Unmarshal(r, &jsonVal); err != nil {
+			t.Fatalf("unable to get size for label %d: %v", label, err)
+		}
+		if jsonVal.Voxels != expectedSize {
+			t.Errorf("expected merged label %d to have %d voxels, got %d\n", label, expectedSize, jsonVal.Voxels)
+		}
+	}
+}
+
+func TestManifestLabelRules(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, parents := createMergeParents(t)
+	mergeReq := fmt.Sprintf("%srepo/%s/merge", server.WebAPIPath, uuid)
+
+	// Label 1 index from second parent doesn't match its block from first parent.
+	mergeJSON := fmt.Sprintf(`{"mergeType":"external","parents":[%q,%q],"manifest":{"labels":[
+		{"parent":%q,"labels":[1]},
+		{"parent":%q}
+	]}}`, parents[0], parents[1], parents[1], parents[0])
+	server.TestBadHTTP(t, "POST", mergeReq, strings.NewReader(mergeJSON))
+
+	// Adding a block rule that selects the same parent is consistent.
+	mergeJSON = fmt.Sprintf(`{"mergeType":"external","parents":[%q,%q],"manifest":{"labels":[
+		{"parent":%q,"labels":[1]},
+		{"parent":%q,"minBlock":[0,0,0],"maxBlock":[0,0,0]},
+		{"parent":%q}
+	]}}`, parents[0], parents[1], parents[1], parents[1], parents[0])
+	server.TestHTTP(t, "POST", mergeReq, strings.NewReader(mergeJSON))
+}
@@ -22,6 +22,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/datatype/common/labels"
@@ -143,7 +144,52 @@ $ dvid node <UUID> <data name> dump <dump type> <file path>
 	data name     Name of data to add.
 	dump type     One of "svcount", "mappings", or "indices".
 	file path     Absolute path to a writable file that the dvid server has write privileges to.
+
+$ dvid node <UUID> <data name> export-precomputed <directory> [supervoxels=false] [sharded=true]
+
+	Asynchronously exports all scales of the specified version of labelmap data into a local 
+	directory as a neuroglancer precomputed segmentation volume with raw uint64 chunks.
+	Requires DVID built with the "ngprecomputed" tag.  Errors are printed in the server log.
+
+    Example: 
+
+    $ dvid node 3f8c segmentation export-precomputed /data/precomputed/segmentation
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of data to export.
+	directory     Path of a directory on the server that will hold the exported volume.
+
+    Configuration Settings (case-insensitive keys):
+
+	supervoxels   If "true", exports supervoxel ids instead of agglomerated labels.
+	sharded       If "true" (default), chunks are written into sharded files with gzip
+	                encoding of minishard indices and chunk data.
 	
+$ dvid node <UUID> <data name> replay <from UUID> [to=<UUID>] [source=<name>] [minmutid=<id>] [maxmutid=<id>]
+
+	Replays completed merges, renumbers, cleaves, splits, and supervoxel splits recorded in the
+	JSON mutation log of a source labelmap onto the given version of this labelmap, and prints
+	a report of any mutation that failed to apply.  See the POST /replay endpoint for details.
+
+    Example: 
+
+    $ dvid node 8a90 segmentation replay 3f8c to=28a1 source=old-segmentation
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify the target version.
+	data name     Name of target labelmap instance.
+	from UUID     The first version of the source mutation log range.
+
+    Configuration Settings (case-insensitive keys):
+
+	to            The last version of the source mutation log range (default: from UUID).
+	source        Name of source labelmap instance (default: target instance).
+	minmutid      If given, mutations with lower mutation IDs are skipped.
+	maxmutid      If given, mutations with higher mutation IDs are skipped.
+
 $ dvid node <UUID> <data name> set-nextlabel <label>
 
 	Sets the counter for new labels repo-wide for the given labelmap instance.
@@ -646,6 +692,29 @@ GET <api URL>/node/<UUID>/<data name>/blocks/<size>/<offset>[?queryopts]
                   (Service Unavailable) status code is returned.
 
 
+GET <api URL>/node/<UUID>/<data name>/precomputed/info
+GET <api URL>/node/<UUID>/<data name>/precomputed/<scale key>/<x0-x1_y0-y1_z0-z1>
+
+	Serves the given version of labels, with merges applied via the version's mapping, as a 
+	neuroglancer precomputed segmentation with "raw" uint64 encoding.  Neuroglancer can use 
+	a source like:
+
+	precomputed://http://myserver/api/node/3f8c/segmentation/precomputed
+
+	The "info" endpoint returns the JSON description of the volume with one scale for each
+	level from 0 to MaxDownresLevel.  The scale key is based on the voxel resolution at that
+	scale, e.g., "8_8_8" and "16_16_16", and chunk sizes match the block size.  Chunk requests
+	return uint64 labels within the given voxel ranges with X varying fastest, and are
+	gzip-encoded if the client accepts it.
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of label data.
+    scale key     Key of the scale given in the info JSON.
+    x0-x1_...     Voxel ranges (exclusive of end) along each dimension, each at most 512 voxels.
+
+
 POST <api URL>/node/<UUID>/<data name>/blocks[?queryopts]
 
     Puts properly-sized supervoxel block data.  This is the most server-efficient way of
@@ -1170,6 +1239,30 @@ GET <api URL>/node/<UUID>/<data name>/sparsevols-coarse/<start label>/<end label
 			int32   Length of run
 
 
+GET <api URL>/node/<UUID>/<data name>/mesh/<label>[?queryopts]
+
+	Returns a surface mesh of the given body computed by marching cubes over the body's
+	blocks at the given scale.  Vertices are in physical units given by the voxel
+	resolution, e.g., nanometers.  Meshes are cached in memory until the body is modified 
+	via merge, split, cleave, or other mutations.  The size of the mesh cache can be set
+	via a "labelmapmesh" cache in the server configuration, and defaults to 100 MB.
+
+	Returns a status code 404 (Not Found) if label does not exist.
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of labelmap instance.
+	label         The body label.
+
+	Query-string Options:
+
+	scale         A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2 resolution
+	                of previous level.  Level 0 (default) is the highest resolution.
+	format        "ngmesh" (default) for the neuroglancer legacy precomputed mesh format without
+	                draco compression, "obj" for Wavefront OBJ, or "ply" for binary PLY.
+
+
 POST <api URL>/node/<UUID>/<data name>/renumber
 
 	Renumbers labels.  Requires JSON in request body using the following format:
@@ -1614,6 +1707,75 @@ GET <api URL>/node/<UUID>/<data name>/mutations-range/<beg>/<end>?rangefmt=<form
 		"timestamps":  The range is in the form of RFC 3339 timestamps.
 
 
+POST <api URL>/node/<UUID>/<data name>/revert/<mutid>
+
+	Reverts a merge or cleave with the given mutation ID by applying its inverse as new mutations.
+	A merge is reverted by cleaving the supervoxels each merged body had just before the merge
+	out of the target body directly into that body's original label.  A cleave is reverted by
+	merging the cleaved body back into the original body.  The mutation must have been
+	done in the given version or one of its ancestors.
+
+	If a later mutation modified any of the affected bodies, including voxel writes via /raw,
+	/blocks or ingestion, or a merged label has been reused, the revert is refused with status
+	code 409 (Conflict) and a description of the conflicts.
+	On success, returns JSON with the mutation IDs of the applied inverse mutations:
+
+	{"MutationIDs": [1000231, 1000232]}
+
+	Arguments:
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of labelmap instance.
+	mutid         Mutation ID of the merge or cleave to revert.
+
+	Query-string Options:
+
+	u             (optional) Username of the user performing the revert.
+	app           (optional) Name of the application performing the revert.
+
+POST <api URL>/node/<UUID>/<data name>/replay
+
+	Replays completed mutations from the JSON mutation log of a source labelmap onto this
+	version of the labelmap.  Merges, renumbers, cleaves, splits, and supervoxel splits are
+	applied in the order they were logged, each as a new mutation of this version.  This
+	allows proofreading to be reproduced on a re-segmented volume or recovered after
+	corruption.  Requires a Jsonstore in the [mutations] section of the server configuration,
+	and splits can only be replayed if the source split data was saved to a blob store.
+	
+	Labels created by cleaves, splits, and supervoxel splits will differ from those in the
+	source, so later mutations referencing them are translated to the new target labels.
+	Supervoxels created by body splits are not translated.
+
+	The POSTed JSON specifies the source mutations:
+
+	{
+		"Source": "old-segmentation",   // optional, defaults to this labelmap instance
+		"From": "3f8c",                 // first version in source mutation log range
+		"To": "28a1",                   // optional last version, defaults to "From" version
+		"MinMutationID": 1000,          // optional, skip mutations with lower IDs
+		"MaxMutationID": 2000           // optional, skip mutations with higher IDs
+	}
+
+	The "From" version must be an ancestor of the "To" version.  A successful replay returns
+	a JSON report where failed mutations are listed with their source version, mutation ID,
+	and error, and "Relabeled" maps source labels to new target labels:
+
+	{
+		"Applied": 24,
+		"Failed": [
+			{"Action": "cleave", "Version": "28a1...", "MutationID": 1023, "Error": "..."}
+		],
+		"Relabeled": {"1025": 2331, ...}
+	}
+
+	Arguments:
+	UUID          Hexadecimal string with enough characters to uniquely identify the target version.
+	data name     Name of target labelmap instance.
+
+	Query-string Options:
+
+	u             (optional) Username of the user performing the replay.
+	app           (optional) Name of the application performing the replay.
+
 GET <api URL>/node/<UUID>/<data name>/history/<label>/<from UUID>/<to UUID>
 
 	Returns JSON for mutations involving labels in "from UUID" version that correspond to the
@@ -1688,6 +1850,9 @@ var (
 	DefaultBlockSize int32   = 64
 	DefaultRes       float32 = imageblk.DefaultRes
 	DefaultUnits             = imageblk.DefaultUnits
+
+	mutationCount = dvid.NewCounterVec("dvid_labelmap_mutations_total",
+		"Number of completed labelmap mutations by instance and action.", "instance", "action")
 )
 
 // SparseVolFormat indicates the type of encoding used for sparse volume representation.
@@ -2666,6 +2831,84 @@ func (d *Data) DoRPC(req datastore.Request, reply *datastore.Response) error {
 		}
 		return nil
 
+	case "export-precomputed":
+		if len(req.Command) < 5 {
+			return fmt.Errorf("poorly formatted export-precomputed command.  See command-line help")
+		}
+		var uuidStr, dataName, cmdStr, dir string
+		req.CommandArgs(1, &uuidStr, &dataName, &cmdStr, &dir)
+		uuid, v, err := datastore.MatchingUUID(uuidStr)
+		if err != nil {
+			return err
+		}
+		settings := req.Settings()
+		supervoxels, _, err := settings.GetBool("supervoxels")
+		if err != nil {
+			return err
+		}
+		sharded, found, err := settings.GetBool("sharded")
+		if err != nil {
+			return err
+		}
+		if !found {
+			sharded = true
+		}
+		go func() {
+			if err := d.exportPrecomputed(v, dir, supervoxels, sharded); err != nil {
+				dvid.Errorf("Cannot export data %q @ node %s to precomputed %q: %v\n", d.DataName(), uuid, dir, err)
+			}
+		}()
+		reply.Text = fmt.Sprintf("Asynchronously exporting data %q, uuid %s to precomputed volume %q (errors will be printed in server log) ...\n", d.DataName(), uuid, dir)
+		return nil
+
+	case "replay":
+		if len(req.Command) < 5 {
+			return fmt.Errorf("poorly formatted replay command.  See command-line help")
+		}
+		var uuidStr, dataName, cmdStr, fromStr string
+		req.CommandArgs(1, &uuidStr, &dataName, &cmdStr, &fromStr)
+		_, v, err := datastore.MatchingUUID(uuidStr)
+		if err != nil {
+			return err
+		}
+		replayReq := ReplayRequest{From: fromStr}
+		settings := req.Settings()
+		if replayReq.To, _, err = settings.GetString("to"); err != nil {
+			return err
+		}
+		var source string
+		if source, _, err = settings.GetString("source"); err != nil {
+			return err
+		}
+		replayReq.Source = dvid.InstanceName(source)
+		for key, mutID := range map[string]*uint64{"minmutid": &replayReq.MinMutationID, "maxmutid": &replayReq.MaxMutationID} {
+			var idStr string
+			if idStr, _, err = settings.GetString(key); err != nil {
+				return err
+			}
+			if idStr != "" {
+				if *mutID, err = strconv.ParseUint(idStr, 10, 64); err != nil {
+					return fmt.Errorf("bad %s setting %q: %v", key, idStr, err)
+				}
+			}
+		}
+		src, sequence, err := d.getReplaySource(replayReq)
+		if err != nil {
+			return err
+		}
+		info := dvid.ModInfo{App: "replay", Time: time.Now().Format(time.RFC3339)}
+		report, err := d.ReplayMutations(v, src, sequence, replayReq.MinMutationID, replayReq.MaxMutationID, info)
+		if err != nil {
+			return err
+		}
+		jsonBytes, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return err
+		}
+		reply.Text = fmt.Sprintf("Replayed %d mutations onto data %q @ node %s with %d failures:\n%s\n",
+			report.Applied, d.DataName(), uuidStr, len(report.Failed), string(jsonBytes))
+		return nil
+
 	default:
 		return fmt.Errorf("unknown command.  Data type '%s' [%s] does not support '%s' command",
 			d.DataName(), d.TypeName(), req.TypeCommand())
@@ -2907,6 +3150,9 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	case "raw", "isotropic":
 		d.handleDataRequest(ctx, w, r, parts)
 
+	case "precomputed":
+		d.handlePrecomputed(ctx, w, r, parts)
+
 	// endpoints after this must have data instance IndexedLabels = true
 
 	case "lastmod":
@@ -2939,6 +3185,9 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	case "sparsevols-coarse":
 		d.handleSparsevolsCoarse(ctx, w, r, parts)
 
+	case "mesh":
+		d.handleMesh(ctx, w, r, parts)
+
 	case "maxlabel":
 		d.handleMaxlabel(ctx, w, r, parts)
 
@@ -2987,6 +3236,12 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	case "mutations-range":
 		d.handleMutationsRange(ctx, w, r, parts)
 
+	case "replay":
+		d.handleReplay(ctx, w, r)
+
+	case "revert":
+		d.handleRevert(ctx, w, r, parts)
+
 	default:
 		server.BadAPIRequest(w, r, d)
 	}
@@ -2951,3 +2951,78 @@ func TestNextLabels(t *testing.T) {
 		t.Fatalf("Expected next label to be 42, got %d\n", lbls.NextLabel)
 	}
 }
+
+func TestPrecomputedFacade(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("MaxDownresLevel", "1")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	volume := newTestVolume(128, 128, 128)
+	volume.addSubvol(dvid.Point3d{40, 40, 40}, dvid.Point3d{40, 40, 40}, 1)
+	volume.addSubvol(dvid.Point3d{40, 40, 80}, dvid.Point3d{40, 40, 40}, 2)
+	volume.put(t, uuid, "labels")
+	if err := downres.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+	mergeReq := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", mergeReq, bytes.NewBufferString("[1, 2]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+
+	infoReq := fmt.Sprintf("%snode/%s/labels/precomputed/info", server.WebAPIPath, uuid)
+	infoJSON := server.TestHTTP(t, "GET", infoReq, nil)
+	var info struct {
+		Type     string `json:"type"`
+		DataType string `json:"data_type"`
+		Scales   []struct {
+			Key         string       `json:"key"`
+			Size        dvid.Point3d `json:"size"`
+			VoxelOffset dvid.Point3d `json:"voxel_offset"`
+		} `json:"scales"`
+	}
+	if err := json.Unmarshal(infoJSON, &info); err != nil {
+		t.Fatalf("bad info JSON: %s\n", string(infoJSON))
+	}
+	if info.Type != "segmentation" || info.DataType != "uint64" || len(info.Scales) != 2 {
+		t.Fatalf("bad info JSON: %s\n", string(infoJSON))
+	}
+	if info.Scales[0].Key != "8_8_8" || info.Scales[1].Key != "16_16_16" {
+		t.Fatalf("bad scale keys in info JSON: %s\n", string(infoJSON))
+	}
+	if info.Scales[0].Size != (dvid.Point3d{128, 128, 128}) || info.Scales[1].Size != (dvid.Point3d{64, 64, 64}) {
+		t.Fatalf("bad scale sizes in info JSON: %s\n", string(infoJSON))
+	}
+
+	// label 2 voxels should be returned as label 1 after merge at both scales.
+	tests := []struct {
+		scaleKey string
+		chunk    string
+		pt       dvid.Point3d // relative to chunk offset
+	}{
+		{"8_8_8", "0-64_0-64_64-128", dvid.Point3d{50, 50, 26}},
+		{"16_16_16", "0-64_0-64_0-64", dvid.Point3d{25, 25, 45}},
+	}
+	for _, tc := range tests {
+		chunkReq := fmt.Sprintf("%snode/%s/labels/precomputed/%s/%s", server.WebAPIPath, uuid, tc.scaleKey, tc.chunk)
+		data := server.TestHTTP(t, "GET", chunkReq, nil)
+		if len(data) != 64*64*64*8 {
+			t.Fatalf("expected %d bytes for chunk %s, got %d\n", 64*64*64*8, tc.chunk, len(data))
+		}
+		i := (tc.pt[2]*64*64 + tc.pt[1]*64 + tc.pt[0]) * 8
+		if label := binary.LittleEndian.Uint64(data[i : i+8]); label != 1 {
+			t.Errorf("expected label 1 at %s in chunk %s of scale %s, got %d\n", tc.pt, tc.chunk, tc.scaleKey, label)
+		}
+	}
+
+	badReq := fmt.Sprintf("%snode/%s/labels/precomputed/32_32_32/0-64_0-64_0-64", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", badReq, nil)
+	badReq = fmt.Sprintf("%snode/%s/labels/precomputed/8_8_8/0-64_0-64", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", badReq, nil)
+}
@@ -0,0 +1,505 @@
+/*
+	This file supports type-specific automatic merging of labelmap versions.
+*/
+
+package labelmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	pb "google.golang.org/protobuf/proto"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/common/proto"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// ResolveConflict implements the datastore.AutoMerger interface.  Conflicts are resolved
+// relative to the closest common ancestor of the parents:
+//
+//   - Label blocks are merged voxel by voxel, where each voxel takes the label from the
+//     first parent that changed it.  Missing blocks are considered to be all zero.
+//   - Label indices are merged by adding the change in each parent's supervoxel counts
+//     to the ancestor's counts.  The most recent mutation metadata is kept.  After all
+//     conflicts are resolved, counts within blocks changed by more than one parent are
+//     recomputed from the merged blocks since parents may have changed the same voxels.
+//   - Max label keys use the maximum across parents.
+//
+// All other keys use the value from the first parent that changed it.  Note that
+// supervoxel to label mappings are based on the first parent only, so agglomeration
+// changes in other parents should be limited to distinct bodies.
+func (d *Data) ResolveConflict(ctx *datastore.VersionedCtx, c *datastore.MergeConflict) ([]byte, error) {
+	class, err := c.TKey.Class()
+	if err != nil {
+		return nil, err
+	}
+	switch class {
+	case keyLabelBlock:
+		scale, idx, err := DecodeBlockTKey(c.TKey)
+		if err != nil {
+			return nil, err
+		}
+		merged, mb, err := d.mergeBlocks(c)
+		if err != nil {
+			return nil, err
+		}
+		if scale == 0 {
+			recordMergedBlock(d, ctx.VersionID(), labels.EncodeBlockIndex(idx[0], idx[1], idx[2]), mb)
+		}
+		return merged, nil
+	case keyLabelIndex:
+		label, err := DecodeLabelIndexTKey(c.TKey)
+		if err != nil {
+			return nil, err
+		}
+		if indexCache != nil {
+			indexCache.Del(indexKey{data: d, version: ctx.VersionID(), label: label}.Bytes())
+		}
+		invalidateMeshes(d, ctx.VersionID(), label)
+		return mergeLabelIndices(label, c)
+	case keyLabelMax:
+		var maxLabel uint64
+		var found bool
+		for _, val := range c.Values {
+			if len(val) != 8 {
+				continue
+			}
+			if label := binary.LittleEndian.Uint64(val); !found || label > maxLabel {
+				maxLabel, found = label, true
+			}
+		}
+		if !found {
+			return nil, nil
+		}
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, maxLabel)
+		return buf, nil
+	default:
+		return c.PriorityValue(), nil
+	}
+}
+
+// MergeComplete implements the datastore.AutoMerger interface.  The in-memory max label
+// of the child version is set to the maximum of the parents, and label indices are
+// corrected for blocks changed by more than one parent.
+func (d *Data) MergeComplete(ctx *datastore.VersionedCtx, parents []dvid.VersionID) error {
+	var maxLabel uint64
+	d.mlMu.RLock()
+	for _, parent := range parents {
+		if label, found := d.MaxLabel[parent]; found && label > maxLabel {
+			maxLabel = label
+		}
+	}
+	d.mlMu.RUnlock()
+	if _, err := d.updateMaxLabel(ctx.VersionID(), maxLabel); err != nil {
+		return err
+	}
+	return d.correctMergedIndices(ctx)
+}
+
+// mergedBlock holds the supervoxel counts of a merged block and all supervoxels that
+// were in the merged, base, or parent blocks.
+type mergedBlock struct {
+	counts  map[uint64]int32
+	touched labels.Set
+}
+
+type mergedBlocksKey struct {
+	data dvid.UUID
+	v    dvid.VersionID
+}
+
+// mergedBlocks holds the scale 0 blocks resolved during a merge into a version, indexed
+// by block index, until label indices are corrected on merge completion.
+var (
+	mergedBlocks   = make(map[mergedBlocksKey]map[uint64]*mergedBlock)
+	mergedBlocksMu sync.Mutex
+)
+
+func recordMergedBlock(d dvid.Data, v dvid.VersionID, blockIndex uint64, mb *mergedBlock) {
+	key := mergedBlocksKey{data: d.DataUUID(), v: v}
+	mergedBlocksMu.Lock()
+	blocks, found := mergedBlocks[key]
+	if !found {
+		blocks = make(map[uint64]*mergedBlock)
+		mergedBlocks[key] = blocks
+	}
+	blocks[blockIndex] = mb
+	mergedBlocksMu.Unlock()
+}
+
+// correctMergedIndices recomputes the supervoxel counts of label indices within blocks
+// changed by more than one parent, since the merged index counts are only correct if
+// the parents changed different voxels.
+func (d *Data) correctMergedIndices(ctx *datastore.VersionedCtx) error {
+	v := ctx.VersionID()
+	key := mergedBlocksKey{data: d.DataUUID(), v: v}
+	mergedBlocksMu.Lock()
+	blocks := mergedBlocks[key]
+	delete(mergedBlocks, key)
+	mergedBlocksMu.Unlock()
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	mapping, err := getMapping(d, v)
+	if err != nil {
+		return err
+	}
+	labelBlocks := make(map[uint64][]uint64) // label -> affected block indices
+	for blockIndex, mb := range blocks {
+		blockLabels := make(labels.Set)
+		for sv := range mb.touched {
+			label, _ := mapping.MappedLabel(v, sv)
+			blockLabels[label] = struct{}{}
+		}
+		for label := range blockLabels {
+			labelBlocks[label] = append(labelBlocks[label], blockIndex)
+		}
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	for label, blockIndices := range labelBlocks {
+		idx, err := getLabelIndex(ctx, label)
+		if err != nil {
+			return fmt.Errorf("unable to get merged index for label %d: %v", label, err)
+		}
+		if idx == nil {
+			idx = new(labels.Index)
+			idx.Label = label
+		}
+		if idx.Blocks == nil {
+			idx.Blocks = make(map[uint64]*proto.SVCount)
+		}
+		for _, blockIndex := range blockIndices {
+			svc := &proto.SVCount{Counts: make(map[uint64]uint32)}
+			for sv, count := range blocks[blockIndex].counts {
+				if mapped, _ := mapping.MappedLabel(v, sv); mapped == label && count > 0 {
+					svc.Counts[sv] = uint32(count)
+				}
+			}
+			if len(svc.Counts) == 0 {
+				delete(idx.Blocks, blockIndex)
+			} else {
+				idx.Blocks[blockIndex] = svc
+			}
+		}
+		if len(idx.Blocks) == 0 {
+			err = deleteLabelIndex(ctx, label)
+		} else {
+			err = putLabelIndex(store, ctx, d, idx)
+		}
+		if err != nil {
+			return err
+		}
+		if indexCache != nil {
+			indexCache.Del(indexKey{data: d, version: v, label: label}.Bytes())
+		}
+		invalidateMeshes(d, v, label)
+	}
+	dvid.Infof("Corrected merged indices of %d labels in %d blocks changed by multiple parents of data %q\n",
+		len(labelBlocks), len(blocks), d.DataName())
+	return nil
+}
+
+// decodes a serialized block into a label volume and its labels or returns nil if there's
+// no block.
+func decodeMergeBlock(serialization []byte) ([]byte, dvid.Point3d, []uint64, error) {
+	if serialization == nil {
+		return nil, dvid.Point3d{}, nil, nil
+	}
+	deserialization, _, err := dvid.DeserializeData(serialization, true)
+	if err != nil {
+		return nil, dvid.Point3d{}, nil, err
+	}
+	var block labels.Block
+	if err = block.UnmarshalBinary(deserialization); err != nil {
+		return nil, dvid.Point3d{}, nil, err
+	}
+	lblarray, size := block.MakeLabelVolume()
+	return lblarray, size, block.Labels, nil
+}
+
+// mergeBlocks returns the serialized merged block and its supervoxel counts.
+func (d *Data) mergeBlocks(c *datastore.MergeConflict) ([]byte, *mergedBlock, error) {
+	mb := &mergedBlock{counts: make(map[uint64]int32), touched: make(labels.Set)}
+	addTouched := func(lbls []uint64) {
+		for _, label := range lbls {
+			if label != 0 {
+				mb.touched[label] = struct{}{}
+			}
+		}
+	}
+	var blockSize dvid.Point3d
+	var found bool
+	parentVols := make([][]byte, len(c.Values))
+	for i, val := range c.Values {
+		lblarray, size, lbls, err := decodeMergeBlock(val)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to decode block from parent %d: %v", i, err)
+		}
+		if lblarray == nil {
+			continue
+		}
+		addTouched(lbls)
+		if found && !size.Equals(blockSize) {
+			return nil, nil, fmt.Errorf("parent %d has block size %s, expected %s", i, size, blockSize)
+		}
+		parentVols[i], blockSize, found = lblarray, size, true
+	}
+	baseVol, baseSize, baseLabels, err := decodeMergeBlock(c.Base)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to decode base block: %v", err)
+	}
+	addTouched(baseLabels)
+	if !found {
+		return nil, mb, nil // block was deleted in all parents
+	}
+	numBytes := blockSize.Prod() * 8
+	zeroVol := make([]byte, numBytes)
+	for i := range parentVols {
+		if parentVols[i] == nil {
+			parentVols[i] = zeroVol
+		}
+	}
+	if baseVol == nil {
+		baseVol = zeroVol
+	} else if !baseSize.Equals(blockSize) {
+		return nil, nil, fmt.Errorf("base has block size %s, expected %s", baseSize, blockSize)
+	}
+
+	merged := make([]byte, numBytes)
+	copy(merged, baseVol)
+	for pos := int64(0); pos < numBytes; pos += 8 {
+		for _, vol := range parentVols {
+			if !bytes.Equal(vol[pos:pos+8], baseVol[pos:pos+8]) {
+				copy(merged[pos:pos+8], vol[pos:pos+8])
+				break
+			}
+		}
+	}
+	block, err := labels.MakeBlock(merged, blockSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	mb.counts = block.CalcNumLabels(nil)
+	for sv := range mb.counts {
+		mb.touched[sv] = struct{}{}
+	}
+	data, err := block.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	serialization, err := dvid.SerializeData(data, d.Compression(), d.Checksum())
+	return serialization, mb, err
+}
+
+// decodes a serialized label index or returns nil if there's no index.
+func decodeMergeIndex(compressed []byte) (*labels.Index, error) {
+	if len(compressed) == 0 {
+		return nil, nil
+	}
+	val, _, err := dvid.DeserializeData(compressed, true)
+	if err != nil {
+		return nil, err
+	}
+	idx := new(labels.Index)
+	if err := pb.Unmarshal(val, idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+func mergeLabelIndices(label uint64, c *datastore.MergeConflict) ([]byte, error) {
+	base, err := decodeMergeIndex(c.Base)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode base index for label %d: %v", label, err)
+	}
+	counts := make(map[uint64]map[uint64]int64) // block -> supervoxel -> count
+	if base != nil {
+		for block, svc := range base.Blocks {
+			if svc == nil {
+				continue
+			}
+			counts[block] = make(map[uint64]int64, len(svc.Counts))
+			for sv, count := range svc.Counts {
+				counts[block][sv] = int64(count)
+			}
+		}
+	}
+	var latest *labels.Index
+	for i, val := range c.Values {
+		idx, err := decodeMergeIndex(val)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode index for label %d from parent %d: %v", label, i, err)
+		}
+		if idx == nil {
+			idx = new(labels.Index)
+		}
+		if latest == nil || idx.LastMutId > latest.LastMutId {
+			latest = idx
+		}
+		// add parent counts for blocks and supervoxels not in base
+		for block, svc := range idx.Blocks {
+			if svc == nil {
+				continue
+			}
+			blockCounts, found := counts[block]
+			if !found {
+				blockCounts = make(map[uint64]int64, len(svc.Counts))
+				counts[block] = blockCounts
+			}
+			for sv, count := range svc.Counts {
+				blockCounts[sv] += int64(count)
+			}
+		}
+		// subtract base counts
+		if base != nil {
+			for block, svc := range base.Blocks {
+				if svc == nil {
+					continue
+				}
+				for sv, count := range svc.Counts {
+					counts[block][sv] -= int64(count)
+				}
+			}
+		}
+	}
+
+	merged := new(labels.Index)
+	merged.Label = label
+	merged.Blocks = make(map[uint64]*proto.SVCount)
+	for block, blockCounts := range counts {
+		svc := &proto.SVCount{Counts: make(map[uint64]uint32)}
+		for sv, count := range blockCounts {
+			if count > 0 {
+				svc.Counts[sv] = uint32(count)
+			}
+		}
+		if len(svc.Counts) != 0 {
+			merged.Blocks[block] = svc
+		}
+	}
+	if len(merged.Blocks) == 0 {
+		return nil, nil
+	}
+	merged.LastMutId = latest.LastMutId
+	merged.LastModTime = latest.LastModTime
+	merged.LastModUser = latest.LastModUser
+	merged.LastModApp = latest.LastModApp
+
+	serialization, err := pb.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("error trying to serialize merged index for label %d: %v", label, err)
+	}
+	compressFormat, _ := dvid.NewCompression(dvid.LZ4, dvid.DefaultCompression)
+	return dvid.SerializeData(serialization, compressFormat, dvid.NoChecksum)
+}
+
+// ManifestKey implements the datastore.ManifestKeyer interface so merge manifests can
+// select parents by block coordinate for label blocks and by label for label indices,
+// affinities, and mutation caches.  Since label rules don't match blocks, manifests are
+// checked so blocks in a label's index come from the parent selected by its label rule.
+func (d *Data) ManifestKey(tk storage.TKey) (datastore.ManifestKey, error) {
+	class, err := tk.Class()
+	if err != nil {
+		return datastore.ManifestKey{}, err
+	}
+	var label uint64
+	switch class {
+	case keyLabelBlock:
+		_, idx, err := DecodeBlockTKey(tk)
+		if err != nil {
+			return datastore.ManifestKey{}, err
+		}
+		pt := dvid.ChunkPoint3d(*idx)
+		return datastore.ManifestKey{Block: &pt}, nil
+	case keyLabelIndex:
+		label, err = DecodeLabelIndexTKey(tk)
+	case keyAffinities:
+		label, err = DecodeAffinitiesTKey(tk)
+	case keyMutcache:
+		label, _, err = decodeMutcacheKey(tk)
+	}
+	return datastore.ManifestKey{Label: label}, err
+}
+
+// labelmapManifestCheck verifies that a label index selected by a manifest label rule comes
+// from the same parent as the conflicted blocks holding that label.
+type labelmapManifestCheck struct {
+	blockParents map[uint64]int // scale 0 block index -> selected parent
+	labelRules   map[uint64]labelRuleBlocks
+}
+
+type labelRuleBlocks struct {
+	parent int
+	blocks labels.Set // blocks in the base or any parent index of the label
+}
+
+// NewManifestCheck implements the datastore.ManifestChecker interface.
+func (d *Data) NewManifestCheck() datastore.ManifestCheck {
+	return &labelmapManifestCheck{
+		blockParents: make(map[uint64]int),
+		labelRules:   make(map[uint64]labelRuleBlocks),
+	}
+}
+
+func (mc *labelmapManifestCheck) AddKey(c *datastore.MergeConflict, rule datastore.MergeManifestRule, parent int) error {
+	class, err := c.TKey.Class()
+	if err != nil {
+		return err
+	}
+	switch class {
+	case keyLabelBlock:
+		scale, idx, err := DecodeBlockTKey(c.TKey)
+		if err != nil {
+			return err
+		}
+		if scale == 0 {
+			mc.blockParents[labels.EncodeBlockIndex(idx[0], idx[1], idx[2])] = parent
+		}
+	case keyLabelIndex:
+		if len(rule.Labels) == 0 {
+			return nil
+		}
+		label, err := DecodeLabelIndexTKey(c.TKey)
+		if err != nil {
+			return err
+		}
+		lr := labelRuleBlocks{parent: parent, blocks: make(labels.Set)}
+		for _, val := range append([][]byte{c.Base}, c.Values...) {
+			idx, err := decodeMergeIndex(val)
+			if err != nil {
+				return fmt.Errorf("unable to decode index for label %d: %v", label, err)
+			}
+			if idx == nil {
+				continue
+			}
+			for block := range idx.Blocks {
+				lr.blocks[block] = struct{}{}
+			}
+		}
+		mc.labelRules[label] = lr
+	}
+	return nil
+}
+
+func (mc *labelmapManifestCheck) Finish() error {
+	for label, lr := range mc.labelRules {
+		for block := range lr.blocks {
+			if parent, found := mc.blockParents[block]; found && parent != lr.parent {
+				x, y, z := labels.DecodeBlockIndex(block)
+				return fmt.Errorf("label %d is selected from parent %d but its conflicting block (%d,%d,%d) is from parent %d; add a block rule so they match",
+					label, lr.parent+1, x, y, z, parent+1)
+			}
+		}
+	}
+	return nil
+}
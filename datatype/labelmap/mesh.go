@@ -0,0 +1,312 @@
+/*
+	This file supports generation and caching of body surface meshes.
+*/
+
+package labelmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/coocood/freecache"
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/common/mesh"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// DefaultMeshCacheSize is the size in MB of the in-memory body mesh cache if it is not
+// set via the "labelmapmesh" cache in the server configuration.
+const DefaultMeshCacheSize = 100
+
+var (
+	// cache of serialized body meshes keyed by data, version, label, and scale.
+	meshCache *freecache.Cache
+
+	// incremented on every mesh invalidation so meshes computed concurrently with
+	// a mutation are not cached.
+	meshInvalidations uint64
+)
+
+func initMeshCache() {
+	if meshCache != nil {
+		meshCache.Clear()
+		return
+	}
+	numBytes := server.CacheSize("labelmapmesh")
+	if numBytes == 0 {
+		numBytes = DefaultMeshCacheSize * dvid.Mega
+	}
+	meshCache = freecache.NewCache(numBytes)
+}
+
+func meshCacheKey(d dvid.Data, v dvid.VersionID, label uint64, scale uint8) []byte {
+	return append(indexKey{data: d, version: v, label: label}.Bytes(), scale)
+}
+
+// invalidateMeshes removes any cached meshes for the given label at all scales.  This is
+// called whenever a label index changes, which covers merges, splits, cleaves, and any
+// other modification of a body.
+func invalidateMeshes(d dvid.Data, v dvid.VersionID, label uint64) {
+	if meshCache == nil {
+		return
+	}
+	lmap, ok := d.(*Data)
+	if !ok {
+		return
+	}
+	atomic.AddUint64(&meshInvalidations, 1)
+	for scale := uint8(0); scale <= lmap.MaxDownresLevel; scale++ {
+		meshCache.Del(meshCacheKey(d, v, label, scale))
+	}
+}
+
+// GetLabelMesh returns a surface mesh for the given body at the given scale, computed via
+// marching cubes over the body's blocks.  Vertices are in physical units given by the voxel
+// resolution.  If the body doesn't exist, nil is returned.  Meshes are cached until the
+// body is modified.
+func (d *Data) GetLabelMesh(v dvid.VersionID, label uint64, scale uint8) (*mesh.Mesh, error) {
+	if scale > d.MaxDownresLevel {
+		return nil, fmt.Errorf("scale %d exceeds max scale %d of data %q", scale, d.MaxDownresLevel, d.DataName())
+	}
+	var cacheKey []byte
+	var invalidations uint64
+	if meshCache != nil {
+		cacheKey = meshCacheKey(d, v, label, scale)
+		invalidations = atomic.LoadUint64(&meshInvalidations)
+		if data, err := meshCache.Get(cacheKey); err == nil {
+			m := new(mesh.Mesh)
+			if err := m.UnmarshalBinary(data); err == nil {
+				return m, nil
+			}
+			dvid.Errorf("bad cached mesh for label %d, data %q: %v\n", label, d.DataName(), err)
+		}
+	}
+
+	m, err := d.computeLabelMesh(v, label, scale)
+	if err != nil || m == nil {
+		return m, err
+	}
+
+	if meshCache != nil && atomic.LoadUint64(&meshInvalidations) == invalidations {
+		data, err := m.MarshalBinary()
+		if err != nil {
+			dvid.Errorf("unable to serialize mesh for label %d, data %q: %v\n", label, d.DataName(), err)
+		} else if err := meshCache.Set(cacheKey, data, 0); err != nil {
+			dvid.Debugf("unable to cache mesh for label %d, data %q: %v\n", label, d.DataName(), err)
+		}
+	}
+	return m, nil
+}
+
+// GetSupervoxelMesh returns a surface mesh for the given supervoxel at scale 0, computed via
+// marching cubes over the supervoxel's blocks.  Vertices are in physical units given by the
+// voxel resolution.  If the supervoxel doesn't exist, nil is returned.  Unlike body meshes,
+// supervoxel meshes are not cached.
+func (d *Data) GetSupervoxelMesh(v dvid.VersionID, supervoxel uint64) (*mesh.Mesh, error) {
+	idx, err := GetLabelIndex(d, v, supervoxel, true)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil || len(idx.Blocks) == 0 {
+		return nil, nil
+	}
+	indices, err := idx.GetProcessedBlockIndices(0, dvid.Bounds{}, supervoxel)
+	if err != nil {
+		return nil, err
+	}
+	if len(indices) == 0 {
+		return nil, nil
+	}
+	supervoxels := labels.Set{supervoxel: struct{}{}}
+	return d.computeMesh(v, fmt.Sprintf("supervoxel %d", supervoxel), supervoxels, indices, 0)
+}
+
+// computes a body mesh, holding a bit mask for each of the body's blocks in memory.
+func (d *Data) computeLabelMesh(v dvid.VersionID, label uint64, scale uint8) (*mesh.Mesh, error) {
+	idx, err := GetLabelIndex(d, v, label, false)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil || len(idx.Blocks) == 0 {
+		return nil, nil
+	}
+	supervoxels := idx.GetSupervoxels()
+	indices, err := idx.GetProcessedBlockIndices(scale, dvid.Bounds{}, 0)
+	if err != nil {
+		return nil, err
+	}
+	return d.computeMesh(v, fmt.Sprintf("label %d", label), supervoxels, indices, scale)
+}
+
+// computes a mesh of the given supervoxels within the given blocks, holding a bit mask for
+// each block in memory.
+func (d *Data) computeMesh(v dvid.VersionID, desc string, supervoxels labels.Set, indices dvid.IZYXSlice, scale uint8) (*mesh.Mesh, error) {
+	timedLog := dvid.NewTimeLog()
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("block size for data %q should be 3d, not: %s", d.DataName(), d.BlockSize())
+	}
+
+	ctx := datastore.NewVersionedCtx(d, v)
+	masks := make(map[dvid.ChunkPoint3d][]uint64, len(indices))
+	for _, izyx := range indices {
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		block, err := d.getLabelBlock(ctx, scale, izyx)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			continue
+		}
+		lblarray, size := block.MakeLabelVolume()
+		if size != blockSize {
+			return nil, fmt.Errorf("block %s of data %q has size %s, expected %s", bcoord, d.DataName(), size, blockSize)
+		}
+		mask := make([]uint64, (size.Prod()+63)/64)
+		var lastLabel uint64
+		var lastInside bool
+		for i := 0; i < len(lblarray)/8; i++ {
+			lbl := binary.LittleEndian.Uint64(lblarray[i*8 : i*8+8])
+			if lbl != lastLabel {
+				_, lastInside = supervoxels[lbl]
+				lastLabel = lbl
+			}
+			if lastInside && lbl != 0 {
+				mask[i>>6] |= 1 << uint(i&63)
+			}
+		}
+		masks[bcoord] = mask
+	}
+
+	var lastCoord dvid.ChunkPoint3d
+	var lastMask []uint64
+	inside := func(x, y, z int32) bool {
+		bcoord := dvid.ChunkPoint3d{floorDiv(x, blockSize[0]), floorDiv(y, blockSize[1]), floorDiv(z, blockSize[2])}
+		if lastMask == nil || bcoord != lastCoord {
+			lastCoord, lastMask = bcoord, masks[bcoord]
+			if lastMask == nil {
+				return false
+			}
+		}
+		bx, by, bz := x-bcoord[0]*blockSize[0], y-bcoord[1]*blockSize[1], z-bcoord[2]*blockSize[2]
+		i := (bz*blockSize[1]+by)*blockSize[0] + bx
+		return lastMask[i>>6]&(1<<uint(i&63)) != 0
+	}
+
+	// Each cell touching a block's voxels is marched by the first block, in ZYX order, that
+	// has a mask among the blocks touched by the cell.  Cells inside a block only touch it.
+	owner := func(x, y, z int32) (bcoord dvid.ChunkPoint3d) {
+		var candidates [3][2]int32
+		for dim, c := range [3]int32{x, y, z} {
+			candidates[dim] = [2]int32{floorDiv(c, blockSize[dim]), floorDiv(c+1, blockSize[dim])}
+		}
+		for _, bz := range candidates[2] {
+			for _, by := range candidates[1] {
+				for _, bx := range candidates[0] {
+					bcoord = dvid.ChunkPoint3d{bx, by, bz}
+					if _, found := masks[bcoord]; found {
+						return
+					}
+				}
+			}
+		}
+		return
+	}
+
+	builder := mesh.NewBuilder()
+	for bcoord := range masks {
+		var begin, end dvid.Point3d
+		for dim := 0; dim < 3; dim++ {
+			begin[dim] = bcoord[dim] * blockSize[dim]
+			end[dim] = begin[dim] + blockSize[dim]
+		}
+		for z := begin[2] - 1; z < end[2]; z++ {
+			zInterior := z >= begin[2] && z < end[2]-1
+			for y := begin[1] - 1; y < end[1]; y++ {
+				yInterior := y >= begin[1] && y < end[1]-1
+				for x := begin[0] - 1; x < end[0]; x++ {
+					interior := zInterior && yInterior && x >= begin[0] && x < end[0]-1
+					if interior || owner(x, y, z) == bcoord {
+						builder.MarchCell(x, y, z, inside)
+					}
+				}
+			}
+		}
+	}
+
+	var voxelSize [3]float32
+	for dim := 0; dim < 3; dim++ {
+		voxelSize[dim] = d.Properties.Resolution.VoxelSize[dim] * float32(uint32(1)<<scale)
+	}
+	m := builder.Mesh(voxelSize)
+	timedLog.Infof("Computed mesh for %s, data %q, scale %d: %d blocks, %d vertices, %d triangles",
+		desc, d.DataName(), scale, len(masks), m.NumVertices(), m.NumTriangles())
+	return m, nil
+}
+
+// returns floor(a / b) for positive b.
+func floorDiv(a, b int32) int32 {
+	if a >= 0 {
+		return a / b
+	}
+	return -((-a + b - 1) / b)
+}
+
+func (d *Data) handleMesh(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/mesh/<label>?scale=0&format=ngmesh
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "DVID requires label to follow 'mesh' command")
+		return
+	}
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "only GET action is available on mesh endpoint")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	label, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be meshed as body.\n")
+		return
+	}
+	queryStrings := r.URL.Query()
+	scale, err := getScale(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, "bad scale specified: %v", err)
+		return
+	}
+	format, err := mesh.ParseFormat(queryStrings.Get("format"))
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+
+	m, err := d.GetLabelMesh(ctx.VersionID(), label, scale)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if m == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-type", format.ContentType())
+	if err := m.Write(w, format); err != nil {
+		dvid.Errorf("unable to write mesh for label %d: %v\n", label, err)
+		return
+	}
+	timedLog.Infof("HTTP GET mesh for label %d, scale %d, format %s (%s)", label, scale, format, r.URL)
+}
@@ -0,0 +1,117 @@
+package labelmap
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/downres"
+	"github.com/janelia-flyem/dvid/datatype/common/mesh"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+func getTestMesh(t *testing.T, uuid dvid.UUID, label uint64, query string) *mesh.Mesh {
+	apiStr := fmt.Sprintf("%snode/%s/labels/mesh/%d%s", server.WebAPIPath, uuid, label, query)
+	data := server.TestHTTP(t, "GET", apiStr, nil)
+	m := new(mesh.Mesh)
+	if err := m.UnmarshalBinary(data); err != nil {
+		t.Fatalf("bad mesh returned for label %d: %v\n", label, err)
+	}
+	// make sure the mesh is closed and consistently oriented.
+	directed := make(map[[2]uint32]struct{})
+	for i := 0; i < len(m.Triangles); i += 3 {
+		for j := 0; j < 3; j++ {
+			edge := [2]uint32{m.Triangles[i+j], m.Triangles[i+(j+1)%3]}
+			if _, found := directed[edge]; found {
+				t.Fatalf("mesh for label %d has repeated directed edge %v\n", label, edge)
+			}
+			directed[edge] = struct{}{}
+		}
+	}
+	for edge := range directed {
+		if _, found := directed[[2]uint32{edge[1], edge[0]}]; !found {
+			t.Fatalf("mesh for label %d is not closed at edge %v\n", label, edge)
+		}
+	}
+	return m
+}
+
+func meshBounds(m *mesh.Mesh) (minPt, maxPt [3]float32) {
+	for dim := 0; dim < 3; dim++ {
+		minPt[dim], maxPt[dim] = m.Vertices[dim], m.Vertices[dim]
+	}
+	for i := 0; i < len(m.Vertices); i += 3 {
+		for dim := 0; dim < 3; dim++ {
+			if m.Vertices[i+dim] < minPt[dim] {
+				minPt[dim] = m.Vertices[i+dim]
+			}
+			if m.Vertices[i+dim] > maxPt[dim] {
+				maxPt[dim] = m.Vertices[i+dim]
+			}
+		}
+	}
+	return
+}
+
+func TestLabelMesh(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("MaxDownresLevel", "1")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	// bodies cross block boundaries at 64.
+	volume := newTestVolume(128, 128, 128)
+	volume.addSubvol(dvid.Point3d{40, 40, 40}, dvid.Point3d{40, 40, 40}, 1)
+	volume.addSubvol(dvid.Point3d{40, 40, 80}, dvid.Point3d{40, 40, 40}, 2)
+	volume.put(t, uuid, "labels")
+	if err := downres.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+
+	m := getTestMesh(t, uuid, 1, "")
+	minPt, maxPt := meshBounds(m)
+	if minPt != [3]float32{320, 320, 320} || maxPt != [3]float32{640, 640, 640} {
+		t.Fatalf("bad mesh bounds for label 1: %v -> %v\n", minPt, maxPt)
+	}
+	m = getTestMesh(t, uuid, 1, "?scale=1")
+	minPt, maxPt = meshBounds(m)
+	if minPt != [3]float32{320, 320, 320} || maxPt != [3]float32{640, 640, 640} {
+		t.Fatalf("bad scale 1 mesh bounds for label 1: %v -> %v\n", minPt, maxPt)
+	}
+
+	objReq := fmt.Sprintf("%snode/%s/labels/mesh/1?format=obj", server.WebAPIPath, uuid)
+	objData := server.TestHTTP(t, "GET", objReq, nil)
+	if !strings.HasPrefix(string(objData), "v ") {
+		t.Fatalf("bad OBJ mesh returned: %s\n", string(objData[:50]))
+	}
+	badReq := fmt.Sprintf("%snode/%s/labels/mesh/1?format=stl", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", badReq, nil)
+	badReq = fmt.Sprintf("%snode/%s/labels/mesh/1?scale=2", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", badReq, nil)
+
+	// merge should invalidate cached mesh of label 1.
+	mergeReq := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", mergeReq, bytes.NewBufferString("[1, 2]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+	m = getTestMesh(t, uuid, 1, "")
+	minPt, maxPt = meshBounds(m)
+	if minPt != [3]float32{320, 320, 320} || maxPt != [3]float32{640, 640, 960} {
+		t.Fatalf("bad mesh bounds for label 1 after merge: %v -> %v\n", minPt, maxPt)
+	}
+	missingReq := fmt.Sprintf("%snode/%s/labels/mesh/2", server.WebAPIPath, uuid)
+	resp := server.TestHTTPResponse(t, "GET", missingReq, nil)
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for mesh of merged label 2, got %d\n", resp.Code)
+	}
+}
@@ -84,6 +84,7 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 
 	// Get all the affected blocks in the merge.
 	var targetIdx, mergeIdx *labels.Index
+	var mergedSupervoxels map[uint64][]uint64
 	if targetIdx, err = GetLabelIndex(d, v, op.Target, false); err != nil {
 		err = fmt.Errorf("error accessing index of merge target label %d: %v", op.Target, err)
 		return
@@ -96,7 +97,7 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 		dvid.Criticalf("unable to add merge mutid %d target index %d: %v\n", mutID, op.Target, err)
 	}
 	delta.TargetVoxels = targetIdx.NumVoxels()
-	if mergeIdx, err = d.getMergedIndex(v, mutID, op.Merged, dvid.Bounds{}); err != nil {
+	if mergeIdx, mergedSupervoxels, err = d.getMergedIndex(v, mutID, op.Merged, dvid.Bounds{}); err != nil {
 		err = fmt.Errorf("can't get block indices of merge labels %s: %v", op.Merged, err)
 		return
 	}
@@ -143,6 +144,10 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 	if err = labels.LogMerge(d, v, op); err != nil {
 		return
 	}
+	rec := revertRecord{Action: "merge", Label: op.Target, Merged: mergedSupervoxels}
+	if err := d.putRevertRecord(v, mutID, rec); err != nil {
+		dvid.Errorf("unable to store revert record for merge mutation %d: %v\n", mutID, err)
+	}
 
 	dvid.Infof("merge label %d: %d supervoxels, %d blocks\n", op.Target, len(mergeIdx.GetSupervoxels()), len(mergeIdx.Blocks))
 
@@ -162,6 +167,7 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 
 	timedLog.Infof("merge %s -> %d, data %q, resulting in %d blocks", delta.Merged, delta.Target, d.DataName(), len(delta.Blocks))
 
+	mutationCount.Inc(string(d.DataName()), "merge")
 	msginfo["Action"] = "merge-complete"
 	msginfo["Timestamp"] = time.Now().String()
 	jsonBytes, _ = json.Marshal(msginfo)
@@ -305,6 +311,7 @@ func (d *Data) RenumberLabels(v dvid.VersionID, origLabel, newLabel uint64, info
 
 	timedLog.Infof("renumber %s -> %d, data %q, resulting in %d blocks", origLabel, newLabel, d.DataName(), len(delta.Blocks))
 
+	mutationCount.Inc(string(d.DataName()), "renumber")
 	msginfo["Action"] = "renumber-complete"
 	msginfo["Timestamp"] = time.Now().String()
 	jsonBytes, _ = json.Marshal(msginfo)
@@ -354,7 +361,13 @@ func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, r
 		err = fmt.Errorf("bad cleave supervoxels JSON: %v", err)
 		return
 	}
+	mutID, err = d.cleaveSupervoxels(v, label, cleaveLabel, cleaveSupervoxels, info)
+	return
+}
 
+// cleaves the given supervoxels from a label into the given cleave label, which should
+// either be new or a label no longer in use, e.g., a label being restored on revert.
+func (d *Data) cleaveSupervoxels(v dvid.VersionID, label, cleaveLabel uint64, cleaveSupervoxels []uint64, info dvid.ModInfo) (mutID uint64, err error) {
 	// send kafka cleave event to instance-uuid topic
 	mutID = d.NewMutationID()
 	versionuuid, _ := datastore.UUIDFromVersion(v)
@@ -406,6 +419,10 @@ func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, r
 	if err = labels.LogCleave(d, v, op); err != nil {
 		return
 	}
+	rec := revertRecord{Action: "cleave", Label: label, CleavedLabel: cleaveLabel, CleavedSupervoxels: cleaveSupervoxels}
+	if err := d.putRevertRecord(v, mutID, rec); err != nil {
+		dvid.Errorf("unable to store revert record for cleave mutation %d: %v\n", mutID, err)
+	}
 
 	// notify syncs after processing because downstream sync might rely on changes
 	evt := datastore.SyncEvent{d.DataUUID(), labels.CleaveLabelEvent}
@@ -415,6 +432,18 @@ func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, r
 		return
 	}
 
+	// Publish change in label sizes.
+	evt = datastore.SyncEvent{Data: d.DataUUID(), Event: labels.ChangeSizeEvent}
+	msg = datastore.SyncMessage{Event: labels.ChangeSizeEvent, Version: v, Delta: labels.DeltaNewSize{Label: cleaveLabel, Size: cleavedSize}}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
+	}
+	msg = datastore.SyncMessage{Event: labels.ChangeSizeEvent, Version: v, Delta: labels.DeltaModSize{Label: label, SizeChange: -int64(cleavedSize)}}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
+	}
+
+	mutationCount.Inc(string(d.DataName()), "cleave")
 	msginfo["Action"] = "cleave-complete"
 	msginfo["CleavedSize"] = cleavedSize
 	msginfo["RemainSize"] = remainSize
@@ -844,6 +873,7 @@ func (d *Data) SplitLabels(v dvid.VersionID, fromLabel uint64, r io.ReadCloser,
 		Split:        splitmap,
 		SortedBlocks: splitblks,
 		SplitVoxels:  splitSize,
+		SVSplits:     svsplit.Splits,
 	}
 	evt := datastore.SyncEvent{d.DataUUID(), labels.SplitLabelEvent}
 	msg := datastore.SyncMessage{labels.SplitLabelEvent, v, deltaSplit}
@@ -851,6 +881,7 @@ func (d *Data) SplitLabels(v dvid.VersionID, fromLabel uint64, r io.ReadCloser,
 		dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
 	}
 
+	mutationCount.Inc(string(d.DataName()), "split")
 	msginfo["Action"] = "split-complete"
 	msginfo["Timestamp"] = time.Now().String()
 	jsonBytes, _ = json.Marshal(msginfo)
@@ -1085,6 +1116,7 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 		dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
 	}
 
+	mutationCount.Inc(string(d.DataName()), "split-supervoxel")
 	msginfo["Action"] = "split-supervoxel-complete"
 	msginfo["SplitSize"] = splitSize
 	msginfo["RemainSize"] = remainSize
@@ -1,16 +1,20 @@
 package labelmap
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -826,8 +830,15 @@ func TestMergeLabels(t *testing.T) {
 	}
 
 	// Test merge of 3 into 2
+	mergesBefore := mutationCount.Value("labels", "merge")
 	testMerge := mergeJSON(`[2, 3]`)
 	testMerge.send(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	if merges := mutationCount.Value("labels", "merge"); merges != mergesBefore+1 {
+		t.Errorf("expected merge to be counted in metrics, got %f -> %f\n", mergesBefore, merges)
+	}
 
 	// Make sure label 3 sparsevol has been removed.
 	reqStr = fmt.Sprintf("%snode/%s/labels/sparsevol/%d", server.WebAPIPath, uuid, 3)
@@ -4738,3 +4749,301 @@ var (
 		body1, body2, body3, body4, bodysplit, body6, body7,
 	}
 )
+
+// reads server-sent events from the stream until the given number of events are read.
+func readTestEvents(t *testing.T, r *bufio.Reader, num int) (ids []string, actions []string) {
+	var id, action string
+	for len(actions) < num {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error reading event stream after %d events: %v\n", len(actions), err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = line[4:]
+		case strings.HasPrefix(line, "event: "):
+			action = line[7:]
+		case line == "":
+			ids = append(ids, id)
+			actions = append(actions, action)
+			id, action = "", ""
+		}
+	}
+	return
+}
+
+func TestMutationEventStream(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	merge := func(mergeJSON string) uint64 {
+		reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+		r := server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString(mergeJSON))
+		var resp struct {
+			MutationID uint64
+		}
+		if err := json.Unmarshal(r, &resp); err != nil {
+			t.Fatalf("bad merge response: %s\n", string(r))
+		}
+		return resp.MutationID
+	}
+	mutID1 := merge("[1, 2]")
+	reqStr := fmt.Sprintf("%snode/%s/labels/nextlabel/5", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(server.ServeSingleHTTP))
+	defer ts.Close()
+	eventsURL := fmt.Sprintf("%s%snode/%s/labels/events", ts.URL, server.WebAPIPath, uuid)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	req, _ := http.NewRequestWithContext(ctx, "GET", eventsURL+"?since=0", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unable to GET event stream: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("bad response to GET event stream: %d, %s\n", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	stream := bufio.NewReader(resp.Body)
+	ids, actions := readTestEvents(t, stream, 3)
+	if !reflect.DeepEqual(actions, []string{"merge", "merge-complete", "post-nextlabel"}) {
+		t.Fatalf("bad replayed events: %v\n", actions)
+	}
+	if ids[1] != fmt.Sprintf("%d", mutID1) || ids[2] != "" {
+		t.Fatalf("bad replayed event ids: %v\n", ids)
+	}
+
+	// live events
+	mutID2 := merge("[3, 4]")
+	ids, actions = readTestEvents(t, stream, 2)
+	if !reflect.DeepEqual(actions, []string{"merge", "merge-complete"}) || ids[1] != fmt.Sprintf("%d", mutID2) {
+		t.Fatalf("bad live events: %v, ids %v\n", actions, ids)
+	}
+	cancel()
+	resp.Body.Close()
+
+	// resume after first merge
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, "GET", eventsURL, nil)
+	req.Header.Set("Last-Event-ID", fmt.Sprintf("%d", mutID1))
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("unable to GET event stream: %v\n", err)
+	}
+	defer resp.Body.Close()
+	_, actions = readTestEvents(t, bufio.NewReader(resp.Body), 3)
+	if !reflect.DeepEqual(actions, []string{"post-nextlabel", "merge", "merge-complete"}) {
+		t.Fatalf("bad resumed events: %v\n", actions)
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/events?since=foo", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+}
+
+func TestReplayMutations(t *testing.T) {
+	testConfig := server.TestConfig{Mutations: server.MutationsConfig{Jsonstore: t.TempDir()}}
+	if err := server.OpenTest(testConfig); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	root, _ := initTestRepo()
+	server.CreateTestInstance(t, root, "labelmap", "labels", dvid.Config{})
+	server.CreateTestInstance(t, root, "labelmap", "labels2", dvid.Config{})
+	createLabelTestVolume(t, root, "labels")
+	createLabelTestVolume(t, root, "labels2")
+	for _, name := range []dvid.InstanceName{"labels", "labels2"} {
+		if err := datastore.BlockOnUpdating(root, name); err != nil {
+			t.Fatalf("Error blocking on sync of %s: %v\n", name, err)
+		}
+	}
+
+	// mutate source labels across two versions.
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, root)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[1, 2]"))
+	reqStr = fmt.Sprintf("%snode/%s/labels/cleave/1", server.WebAPIPath, root)
+	r := server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[2]"))
+	var cleaveResp struct {
+		CleavedLabel uint64
+	}
+	if err := json.Unmarshal(r, &cleaveResp); err != nil {
+		t.Fatalf("Unable to get new label from cleave.  Instead got: %s\n", string(r))
+	}
+
+	commitReq := fmt.Sprintf("%snode/%s/commit", server.WebAPIPath, root)
+	server.TestHTTP(t, "POST", commitReq, bytes.NewBufferString(`{"note": "first proofreading"}`))
+	newVersionReq := fmt.Sprintf("%snode/%s/newversion", server.WebAPIPath, root)
+	r = server.TestHTTP(t, "POST", newVersionReq, nil)
+	var respChild struct {
+		Child dvid.UUID `json:"child"`
+	}
+	if err := json.Unmarshal(r, &respChild); err != nil {
+		t.Fatalf("Expected 'child' JSON response.  Got %s\n", string(r))
+	}
+	child := respChild.Child
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, child)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString(fmt.Sprintf("[3, %d]", cleaveResp.CleavedLabel)))
+	reqStr = fmt.Sprintf("%snode/%s/labels/renumber", server.WebAPIPath, child)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[100, 4]"))
+
+	// replay onto target, which will generate different new labels.
+	reqStr = fmt.Sprintf("%snode/%s/labels2/set-nextlabel/1000", server.WebAPIPath, child)
+	server.TestHTTP(t, "POST", reqStr, nil)
+	replayReq := fmt.Sprintf("%snode/%s/labels2/replay", server.WebAPIPath, child)
+	replayJSON := fmt.Sprintf(`{"Source": "labels", "From": %q, "To": %q}`, root, child)
+	r = server.TestHTTP(t, "POST", replayReq, bytes.NewBufferString(replayJSON))
+	var report ReplayReport
+	if err := json.Unmarshal(r, &report); err != nil {
+		t.Fatalf("bad replay report: %s\n", string(r))
+	}
+	if report.Applied != 4 || len(report.Failed) != 0 {
+		t.Fatalf("expected 4 applied mutations with no failures, got: %s\n", string(r))
+	}
+	if report.Relabeled[cleaveResp.CleavedLabel] != 1001 {
+		t.Fatalf("expected cleaved label %d to be relabeled 1001, got: %s\n", cleaveResp.CleavedLabel, string(r))
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels2/supervoxels/3", server.WebAPIPath, child)
+	r = server.TestHTTP(t, "GET", reqStr, nil)
+	var supervoxels []uint64
+	if err := json.Unmarshal(r, &supervoxels); err != nil {
+		t.Fatalf("bad supervoxels response: %s\n", string(r))
+	}
+	if len(supervoxels) != 2 || supervoxels[0]+supervoxels[1] != 5 {
+		t.Fatalf("expected supervoxels 2 and 3 in replayed label 3, got %v\n", supervoxels)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels2/supervoxels/100", server.WebAPIPath, child)
+	server.TestHTTP(t, "GET", reqStr, nil)
+
+	// replaying again should report failures, e.g., renumber to existing label.
+	r = server.TestHTTP(t, "POST", replayReq, bytes.NewBufferString(replayJSON))
+	report = ReplayReport{}
+	if err := json.Unmarshal(r, &report); err != nil {
+		t.Fatalf("bad replay report: %s\n", string(r))
+	}
+	if len(report.Failed) == 0 {
+		t.Fatalf("expected failures on second replay, got: %s\n", string(r))
+	}
+	last := report.Failed[len(report.Failed)-1]
+	if last.Action != "renumber" || last.Version != child || last.Error == "" {
+		t.Fatalf("expected failed renumber at end of report, got: %s\n", string(r))
+	}
+
+	// bad requests
+	server.TestBadHTTP(t, "POST", replayReq, bytes.NewBufferString(`{"Source": "labels"}`))
+	badJSON := fmt.Sprintf(`{"From": %q, "To": %q}`, child, root)
+	server.TestBadHTTP(t, "POST", replayReq, bytes.NewBufferString(badJSON))
+}
+
+func getTestSupervoxels(t *testing.T, uuid dvid.UUID, label uint64) []uint64 {
+	reqStr := fmt.Sprintf("%snode/%s/labels/supervoxels/%d", server.WebAPIPath, uuid, label)
+	r := server.TestHTTP(t, "GET", reqStr, nil)
+	var supervoxels []uint64
+	if err := json.Unmarshal(r, &supervoxels); err != nil {
+		t.Fatalf("bad supervoxels response for label %d: %s\n", label, string(r))
+	}
+	sort.Slice(supervoxels, func(i, j int) bool { return supervoxels[i] < supervoxels[j] })
+	return supervoxels
+}
+
+func TestRevertMutations(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", dvid.Config{})
+	vol := createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	mutate := func(endpoint, payload string) uint64 {
+		reqStr := fmt.Sprintf("%snode/%s/labels/%s", server.WebAPIPath, uuid, endpoint)
+		r := server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString(payload))
+		var resp struct {
+			MutationID uint64
+		}
+		if err := json.Unmarshal(r, &resp); err != nil || resp.MutationID == 0 {
+			t.Fatalf("bad response to %s: %s\n", endpoint, string(r))
+		}
+		return resp.MutationID
+	}
+	revertReq := func(mutID uint64) string {
+		return fmt.Sprintf("%snode/%s/labels/revert/%d", server.WebAPIPath, uuid, mutID)
+	}
+
+	// revert a merge
+	mergeID := mutate("merge", "[1, 2]")
+	server.TestHTTP(t, "POST", revertReq(mergeID), nil)
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	if svs := getTestSupervoxels(t, uuid, 1); len(svs) != 1 || svs[0] != 1 {
+		t.Fatalf("expected only supervoxel 1 in label 1 after revert, got %v\n", svs)
+	}
+	if svs := getTestSupervoxels(t, uuid, 2); len(svs) != 1 || svs[0] != 2 {
+		t.Fatalf("expected only supervoxel 2 in label 2 after revert, got %v\n", svs)
+	}
+	retrieved := newTestVolume(128, 128, 128)
+	retrieved.get(t, uuid, "labels", false)
+	if err := retrieved.equals(vol); err != nil {
+		t.Fatalf("label volume after revert of merge not equal to original: %v\n", err)
+	}
+
+	// a merge modified by a later mutation can't be reverted
+	mergeID = mutate("merge", "[3, 4]")
+	mutate("merge", "[3, 1]")
+	resp := server.TestHTTPResponse(t, "POST", revertReq(mergeID), nil)
+	if resp.Code != http.StatusConflict || !strings.Contains(resp.Body.String(), "label 3 was modified") {
+		t.Fatalf("expected conflict on revert of merge %d, got %d: %s\n", mergeID, resp.Code, resp.Body.String())
+	}
+
+	// revert a cleave
+	r := server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/labels/cleave/3", server.WebAPIPath, uuid), bytes.NewBufferString("[4]"))
+	var cleaveResp struct {
+		CleavedLabel uint64
+		MutationID   uint64
+	}
+	if err := json.Unmarshal(r, &cleaveResp); err != nil {
+		t.Fatalf("Unable to get new label from cleave.  Instead got: %s\n", string(r))
+	}
+	server.TestHTTP(t, "POST", revertReq(cleaveResp.MutationID), nil)
+	if svs := getTestSupervoxels(t, uuid, 3); len(svs) != 3 || svs[0] != 1 || svs[1] != 3 || svs[2] != 4 {
+		t.Fatalf("expected supervoxels 1, 3, 4 in label 3 after revert of cleave, got %v\n", svs)
+	}
+	reqStr := fmt.Sprintf("%snode/%s/labels/supervoxels/%d", server.WebAPIPath, uuid, cleaveResp.CleavedLabel)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+
+	// the cleave was already reverted, and unknown mutations can't be reverted.
+	resp = server.TestHTTPResponse(t, "POST", revertReq(cleaveResp.MutationID), nil)
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("expected conflict on second revert of cleave, got %d: %s\n", resp.Code, resp.Body.String())
+	}
+	server.TestBadHTTP(t, "POST", revertReq(9999999), nil)
+
+	// a merge can't be reverted after later painting into the body.
+	mergeID = mutate("merge", "[3, 2]")
+	painted := newTestVolume(128, 128, 128)
+	copy(painted.data, vol.data)
+	painted.addSubvol(dvid.Point3d{0, 0, 0}, dvid.Point3d{10, 10, 10}, 2)
+	painted.putMutable(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	resp = server.TestHTTPResponse(t, "POST", revertReq(mergeID), nil)
+	if resp.Code != http.StatusConflict || !strings.Contains(resp.Body.String(), "label 3 was modified") {
+		t.Fatalf("expected conflict on revert of merge %d after painting, got %d: %s\n", mergeID, resp.Code, resp.Body.String())
+	}
+}
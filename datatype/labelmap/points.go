@@ -45,6 +45,12 @@ func (d *Data) GetLabelBytes(v dvid.VersionID, bcoord dvid.ChunkPoint3d) ([]byte
 	return d.getBlockLabels(v, bcoord, 0, false)
 }
 
+// GetLabelBlock returns a compressed block of hi-res (body) labels (scale 0).  If the block
+// has not been stored, a solid block of label 0 is returned.
+func (d *Data) GetLabelBlock(v dvid.VersionID, bcoord dvid.ChunkPoint3d) (*labels.Block, error) {
+	return d.getMappedBlock(v, bcoord, 0, false)
+}
+
 // GetLabelAtPoint returns the 64-bit unsigned int label for a given point.
 func (d *Data) GetLabelAtPoint(v dvid.VersionID, pt dvid.Point) (uint64, error) {
 	return d.GetLabelAtScaledPoint(v, pt, 0, false)
@@ -0,0 +1,292 @@
+/*
+	This file supports replaying the JSON mutation log of a labelmap onto another version,
+	possibly of a different labelmap instance.
+*/
+
+package labelmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// ReplayRequest specifies a range of a source labelmap's mutation log to be replayed.
+type ReplayRequest struct {
+	Source        dvid.InstanceName // name of source labelmap; if empty, the target instance is used
+	From          string            // UUID of first version in source mutation log range
+	To            string            // UUID of last version in range; if empty, only From is replayed
+	MinMutationID uint64            // if non-zero, skip mutations with lower IDs
+	MaxMutationID uint64            // if non-zero, skip mutations with higher IDs
+}
+
+// ReplayResult describes the application of one source mutation onto the target.
+type ReplayResult struct {
+	Action           string    // action of the source mutation, e.g., "merge"
+	Version          dvid.UUID // version of the source mutation
+	MutationID       uint64    // mutation ID of the source mutation
+	TargetMutationID uint64    `json:",omitempty"`
+	Error            string    `json:",omitempty"`
+}
+
+// ReplayReport summarizes a replay of mutations onto a target version.
+type ReplayReport struct {
+	Applied int            // number of mutations successfully applied
+	Failed  []ReplayResult // mutations that could not be applied, in replay order
+
+	// Relabeled maps new labels created in the source by cleaves, splits, and supervoxel splits
+	// to the corresponding labels created in the target.  Later replayed mutations that
+	// reference these source labels are translated using this map.
+	Relabeled map[uint64]uint64
+}
+
+// fields of completed mutation records in the JSON mutation log.
+type mutationRecord struct {
+	Action     string
+	UUID       dvid.UUID
+	MutationID uint64
+
+	Target   uint64   // merge, split
+	Labels   []uint64 // merge
+	NewLabel uint64   // split, renumber
+
+	OrigLabel          uint64   // cleave, renumber
+	CleavedLabel       uint64   // cleave
+	CleavedSupervoxels []uint64 // cleave
+	DataRef            string   // cleave with large supervoxel list
+
+	Split            string // split, split-supervoxel: reference to RLEs in blob store
+	Supervoxel       uint64 // split-supervoxel
+	SplitSupervoxel  uint64 // split-supervoxel
+	RemainSupervoxel uint64 // split-supervoxel
+}
+
+// ReplayMutations applies the completed merges, renumbers, cleaves, splits, and supervoxel
+// splits logged for the source labelmap across the given sequence of versions (ordered from
+// root to leaf) onto version v of this labelmap.  Mutations that fail to apply are recorded
+// in the returned report and do not stop the replay.  Supervoxels created by body splits in
+// the source are not translated, so later mutations that reference them may fail.
+func (d *Data) ReplayMutations(v dvid.VersionID, src *Data, sequence []dvid.UUID, minMutID, maxMutID uint64, info dvid.ModInfo) (*ReplayReport, error) {
+	timedLog := dvid.NewTimeLog()
+	records, err := server.ReadMutationsForSequence(src.DataUUID(), sequence)
+	if err != nil {
+		return nil, err
+	}
+	report := &ReplayReport{Relabeled: make(map[uint64]uint64)}
+	relabel := func(label uint64) uint64 {
+		if mapped, found := report.Relabeled[label]; found {
+			return mapped
+		}
+		return label
+	}
+	for _, data := range records {
+		var rec mutationRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			dvid.Errorf("skipping unparseable mutation record for data %q: %s\n", src.DataName(), string(data))
+			continue
+		}
+		if !strings.HasSuffix(rec.Action, "-complete") {
+			continue
+		}
+		if (minMutID != 0 && rec.MutationID < minMutID) || (maxMutID != 0 && rec.MutationID > maxMutID) {
+			continue
+		}
+		result := ReplayResult{
+			Action:     strings.TrimSuffix(rec.Action, "-complete"),
+			Version:    rec.UUID,
+			MutationID: rec.MutationID,
+		}
+		if result.TargetMutationID, err = d.replayMutation(v, src, rec, relabel, report, info); err != nil {
+			result.Error = err.Error()
+			report.Failed = append(report.Failed, result)
+			dvid.Infof("Unable to replay %s mutation %d from data %q onto data %q: %v\n",
+				result.Action, rec.MutationID, src.DataName(), d.DataName(), err)
+			continue
+		}
+		report.Applied++
+	}
+	timedLog.Infof("Replayed %d mutations from data %q onto data %q, %d failed",
+		report.Applied, src.DataName(), d.DataName(), len(report.Failed))
+	return report, nil
+}
+
+// applies a single completed mutation record, returning the target mutation ID.
+func (d *Data) replayMutation(v dvid.VersionID, src *Data, rec mutationRecord, relabel func(uint64) uint64, report *ReplayReport, info dvid.ModInfo) (mutID uint64, err error) {
+	switch rec.Action {
+	case "merge-complete":
+		op := labels.MergeOp{Target: relabel(rec.Target), Merged: make(labels.Set, len(rec.Labels))}
+		for _, label := range rec.Labels {
+			op.Merged[relabel(label)] = struct{}{}
+		}
+		return d.MergeLabels(v, op, info)
+
+	case "renumber-complete":
+		if mutID, err = d.RenumberLabels(v, relabel(rec.OrigLabel), rec.NewLabel, info); err == nil {
+			delete(report.Relabeled, rec.OrigLabel)
+		}
+		return
+
+	case "cleave-complete":
+		supervoxels := rec.CleavedSupervoxels
+		if rec.DataRef != "" {
+			var full []byte
+			if full, err = src.GetBlob(rec.DataRef); err != nil {
+				return
+			}
+			var fullRec mutationRecord
+			if err = json.Unmarshal(full, &fullRec); err != nil {
+				return 0, fmt.Errorf("bad cleave record in blob %q: %v", rec.DataRef, err)
+			}
+			supervoxels = fullRec.CleavedSupervoxels
+		}
+		for i, sv := range supervoxels {
+			supervoxels[i] = relabel(sv)
+		}
+		var cleaveJSON []byte
+		if cleaveJSON, err = json.Marshal(supervoxels); err != nil {
+			return
+		}
+		var cleaveLabel uint64
+		cleaveLabel, mutID, err = d.CleaveLabel(v, relabel(rec.OrigLabel), info, ioutil.NopCloser(bytes.NewBuffer(cleaveJSON)))
+		if err == nil {
+			report.Relabeled[rec.CleavedLabel] = cleaveLabel
+		}
+		return
+
+	case "split-complete":
+		var split *bytes.Buffer
+		if split, err = getReplaySplit(src, rec.Split); err != nil {
+			return
+		}
+		var toLabel uint64
+		toLabel, mutID, err = d.SplitLabels(v, relabel(rec.Target), ioutil.NopCloser(split), info)
+		if err == nil {
+			report.Relabeled[rec.NewLabel] = toLabel
+		}
+		return
+
+	case "split-supervoxel-complete":
+		var split *bytes.Buffer
+		if split, err = getReplaySplit(src, rec.Split); err != nil {
+			return
+		}
+		var splitSV, remainSV uint64
+		splitSV, remainSV, mutID, err = d.SplitSupervoxel(v, relabel(rec.Supervoxel), 0, 0, ioutil.NopCloser(split), info, true)
+		if err == nil {
+			report.Relabeled[rec.SplitSupervoxel] = splitSV
+			report.Relabeled[rec.RemainSupervoxel] = remainSV
+		}
+		return
+
+	default:
+		return 0, fmt.Errorf("replay of %q mutations is not supported", rec.Action)
+	}
+}
+
+// returns a binary sparse volume for split RLEs stored in the source's blob store.
+func getReplaySplit(src *Data, ref string) (*bytes.Buffer, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("no split data was stored for mutation, so it can't be replayed")
+	}
+	rleData, err := src.GetBlob(ref)
+	if err != nil {
+		return nil, err
+	}
+	if len(rleData) == 0 || len(rleData)%16 != 0 {
+		return nil, fmt.Errorf("bad split data in blob %q: %d bytes", ref, len(rleData))
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(dvid.EncodingBinary)
+	binary.Write(buf, binary.LittleEndian, uint8(3))                // # of dimensions
+	binary.Write(buf, binary.LittleEndian, byte(0))                 // dimension of run (X = 0)
+	buf.WriteByte(byte(0))                                          // reserved for later
+	binary.Write(buf, binary.LittleEndian, uint32(0))               // Placeholder for # voxels
+	binary.Write(buf, binary.LittleEndian, uint32(len(rleData)/16)) // # spans
+	buf.Write(rleData)
+	return buf, nil
+}
+
+// parses a replay request and returns the source labelmap and its version sequence
+// from root to leaf.
+func (d *Data) getReplaySource(req ReplayRequest) (src *Data, sequence []dvid.UUID, err error) {
+	if req.From == "" {
+		return nil, nil, fmt.Errorf("replay requires a source 'From' UUID")
+	}
+	fromUUID, _, err := datastore.MatchingUUID(req.From)
+	if err != nil {
+		return
+	}
+	toUUID := fromUUID
+	if req.To != "" {
+		if toUUID, _, err = datastore.MatchingUUID(req.To); err != nil {
+			return
+		}
+	}
+	src = d
+	if req.Source != "" && req.Source != d.DataName() {
+		if src, err = GetByUUIDName(toUUID, req.Source); err != nil {
+			return
+		}
+	}
+	var reversed []dvid.UUID
+	if reversed, err = datastore.GetVersionSequence(fromUUID, toUUID); err != nil {
+		return
+	}
+	if reversed[len(reversed)-1] != fromUUID {
+		return nil, nil, fmt.Errorf("version %s is not an ancestor of version %s", fromUUID, toUUID)
+	}
+	sequence = make([]dvid.UUID, len(reversed))
+	for i, uuid := range reversed {
+		sequence[len(reversed)-1-i] = uuid
+	}
+	return
+}
+
+func (d *Data) handleReplay(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// POST <api URL>/node/<UUID>/<data name>/replay
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "Replay requests must be POST actions.")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		server.BadRequest(w, r, "Bad POSTed data for replay.  Should be JSON.")
+		return
+	}
+	var req ReplayRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		server.BadRequest(w, r, fmt.Sprintf("Bad replay JSON: %v", err))
+		return
+	}
+	src, sequence, err := d.getReplaySource(req)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	info := dvid.GetModInfo(r)
+	report, err := d.ReplayMutations(ctx.VersionID(), src, sequence, req.MinMutationID, req.MaxMutationID, info)
+	if err != nil {
+		server.BadRequest(w, r, fmt.Sprintf("Error on replay: %v", err))
+		return
+	}
+	jsonBytes, err := json.Marshal(report)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+
+	timedLog.Infof("HTTP replay request (%s): %d applied, %d failed", r.URL, report.Applied, len(report.Failed))
+}
@@ -0,0 +1,203 @@
+/*
+	This file supports reverting individual merges and cleaves by applying inverse mutations.
+*/
+
+package labelmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// revertRecord holds the information needed to compute the inverse of a merge or cleave.
+type revertRecord struct {
+	Action string // "merge" or "cleave"
+	Label  uint64 // merge target or the label that was cleaved
+
+	// supervoxels of each merged label just before the merge.
+	Merged map[uint64][]uint64 `json:",omitempty"`
+
+	CleavedLabel       uint64   `json:",omitempty"`
+	CleavedSupervoxels []uint64 `json:",omitempty"`
+}
+
+// RevertConflictError is returned when a mutation can't be reverted because later
+// mutations modified the same bodies.
+type RevertConflictError struct {
+	MutationID uint64
+	Conflicts  []string
+}
+
+func (e *RevertConflictError) Error() string {
+	return fmt.Sprintf("cannot revert mutation %d: %s", e.MutationID, strings.Join(e.Conflicts, "; "))
+}
+
+func (d *Data) putRevertRecord(v dvid.VersionID, mutID uint64, rec revertRecord) error {
+	store, err := datastore.GetKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	return store.Put(ctx, newRevertTKey(mutID), data)
+}
+
+// returns nil if no revert record is available for the mutation.
+func (d *Data) getRevertRecord(v dvid.VersionID, mutID uint64) (*revertRecord, error) {
+	store, err := datastore.GetKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	data, err := store.Get(ctx, newRevertTKey(mutID))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	rec := new(revertRecord)
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, fmt.Errorf("bad revert record for mutation %d: %v", mutID, err)
+	}
+	return rec, nil
+}
+
+// checks that a label's index was last modified by the given mutation.
+func (d *Data) checkLastMutation(v dvid.VersionID, label, mutID uint64) (conflict string, err error) {
+	idx, err := GetLabelIndex(d, v, label, false)
+	if err != nil {
+		return "", err
+	}
+	if idx == nil {
+		return fmt.Sprintf("label %d no longer exists", label), nil
+	}
+	if idx.LastMutId != mutID {
+		return fmt.Sprintf("label %d was modified by mutation %d", label, idx.LastMutId), nil
+	}
+	return "", nil
+}
+
+// RevertMutation applies the inverse of a merge or cleave with the given mutation ID, which
+// must have been done in version v or one of its ancestors.  A merge is reverted by cleaving
+// each merged body's supervoxels from the target back into its original label, and a
+// cleave is reverted by merging the cleaved label back.  If any of the bodies have been
+// modified by a later mutation, a *RevertConflictError is returned and nothing is changed.
+// The mutation IDs of the applied inverse mutations are returned.
+func (d *Data) RevertMutation(v dvid.VersionID, mutID uint64, info dvid.ModInfo) (mutIDs []uint64, err error) {
+	var rec *revertRecord
+	if rec, err = d.getRevertRecord(v, mutID); err != nil {
+		return
+	}
+	if rec == nil {
+		return nil, fmt.Errorf("no revertable merge or cleave with mutation id %d found in data %q", mutID, d.DataName())
+	}
+	conflictErr := &RevertConflictError{MutationID: mutID}
+	var conflict string
+	switch rec.Action {
+	case "merge":
+		if conflict, err = d.checkLastMutation(v, rec.Label, mutID); err != nil {
+			return
+		}
+		if conflict != "" {
+			conflictErr.Conflicts = append(conflictErr.Conflicts, conflict)
+		}
+		var exists bool
+		for label := range rec.Merged {
+			if exists, err = d.labelIndexExists(v, label); err != nil {
+				return
+			}
+			if exists {
+				conflictErr.Conflicts = append(conflictErr.Conflicts, fmt.Sprintf("merged label %d exists again", label))
+			}
+		}
+		if len(conflictErr.Conflicts) != 0 {
+			return nil, conflictErr
+		}
+		merged := make([]uint64, 0, len(rec.Merged))
+		for label := range rec.Merged {
+			merged = append(merged, label)
+		}
+		sort.Slice(merged, func(i, j int) bool { return merged[i] < merged[j] })
+		for _, label := range merged {
+			var cleaveMutID uint64
+			if cleaveMutID, err = d.cleaveSupervoxels(v, rec.Label, label, rec.Merged[label], info); err != nil {
+				return mutIDs, fmt.Errorf("unable to cleave merged label %d from label %d: %v", label, rec.Label, err)
+			}
+			mutIDs = append(mutIDs, cleaveMutID)
+		}
+
+	case "cleave":
+		for _, label := range []uint64{rec.Label, rec.CleavedLabel} {
+			if conflict, err = d.checkLastMutation(v, label, mutID); err != nil {
+				return
+			}
+			if conflict != "" {
+				conflictErr.Conflicts = append(conflictErr.Conflicts, conflict)
+			}
+		}
+		if len(conflictErr.Conflicts) != 0 {
+			return nil, conflictErr
+		}
+		op := labels.MergeOp{Target: rec.Label, Merged: labels.Set{rec.CleavedLabel: struct{}{}}}
+		var mergeMutID uint64
+		if mergeMutID, err = d.MergeLabels(v, op, info); err != nil {
+			return
+		}
+		mutIDs = append(mutIDs, mergeMutID)
+
+	default:
+		return nil, fmt.Errorf("revert of %q mutation %d is not supported", rec.Action, mutID)
+	}
+	return
+}
+
+func (d *Data) handleRevert(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// POST <api URL>/node/<UUID>/<data name>/revert/<mutid>
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "Revert requests must be POST actions.")
+		return
+	}
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires mutation ID to follow 'revert' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	mutID, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	info := dvid.GetModInfo(r)
+	mutIDs, err := d.RevertMutation(ctx.VersionID(), mutID, info)
+	if err != nil {
+		if _, conflict := err.(*RevertConflictError); conflict {
+			dvid.Infof("Refused revert (%s): %v\n", r.URL, err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		server.BadRequest(w, r, err)
+		return
+	}
+	jsonBytes, err := json.Marshal(struct {
+		MutationIDs []uint64
+	}{mutIDs})
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+
+	timedLog.Infof("HTTP revert of mutation %d request (%s)", mutID, r.URL)
+}
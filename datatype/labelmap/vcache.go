@@ -247,7 +247,16 @@ func (vc *VCache) loadVersionMapping(ancestors []dvid.VersionID, dataname dvid.I
 				dvid.Errorf("unable to unmarshal cleave log message for version %d: %v\n", v, err)
 				continue
 			}
-			vc.setMapping(v, op.Cleavedlabel, 0)
+			isSupervoxel := false
+			for _, supervoxel := range op.GetCleaved() {
+				if supervoxel == op.Cleavedlabel {
+					isSupervoxel = true
+					break
+				}
+			}
+			if !isSupervoxel {
+				vc.setMapping(v, op.Cleavedlabel, 0)
+			}
 
 		case proto.RenumberOpType:
 			numMsgs["Renumber"]++
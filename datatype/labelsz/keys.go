@@ -5,6 +5,7 @@
 package labelsz
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"math"
@@ -26,6 +27,12 @@ const (
 
 	// key is index type + label, with value equal to size, necessary to delete old indices.
 	keyTypeLabel = 98
+
+	// key is ROI name + index type + size + label for rankings restricted to a registered ROI.
+	keyROITypeSizeLabel = 99
+
+	// key is ROI name + index type + label, with value equal to size within the ROI.
+	keyROITypeLabel = 100
 )
 
 // DescribeTKeyClass returns a string explanation of what a particular TKeyClass
@@ -36,6 +43,10 @@ func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
 		return "labelsz index type + label key"
 	case keyTypeSizeLabel:
 		return "labelsz index type + size + label key"
+	case keyROITypeLabel:
+		return "labelsz ROI + index type + label key"
+	case keyROITypeSizeLabel:
+		return "labelsz ROI + index type + size + label key"
 	default:
 	}
 	return "unknown labelsz key"
@@ -194,3 +205,97 @@ func DecodeTypeLabelTKey(tk storage.TKey) (i IndexType, label uint64, err error)
 	label = binary.BigEndian.Uint64(ibytes[1:])
 	return
 }
+
+// NewROITypeSizeLabelTKey returns a type-specific key for the (index type, size, label) tuple
+// within a registered ROI.
+func NewROITypeSizeLabelTKey(roiName string, i IndexType, sz uint32, label uint64) storage.TKey {
+	rsz := math.MaxUint32 - sz
+
+	n := len(roiName) + 1
+	buf := make([]byte, n+1+4+8)
+	copy(buf, roiName)
+	buf[n] = byte(i)
+	binary.BigEndian.PutUint32(buf[n+1:n+5], rsz)
+	binary.BigEndian.PutUint64(buf[n+5:], label)
+	return storage.NewTKey(keyROITypeSizeLabel, buf)
+}
+
+// DecodeROITypeSizeLabelTKey decodes a type-specific key into a (ROI name, index type, size, label) tuple.
+func DecodeROITypeSizeLabelTKey(tk storage.TKey) (roiName string, i IndexType, sz uint32, label uint64, err error) {
+	var ibytes []byte
+	ibytes, err = tk.ClassBytes(keyROITypeSizeLabel)
+	if err != nil {
+		return
+	}
+	n := bytes.IndexByte(ibytes, 0)
+	if n < 0 || len(ibytes) != n+1+13 {
+		err = fmt.Errorf("labelsz ROI element size type-specific key is badly formatted (%d bytes)", len(ibytes))
+		return
+	}
+	roiName = string(ibytes[:n])
+	ibytes = ibytes[n+1:]
+	i = IndexType(ibytes[0])
+	sz = math.MaxUint32 - binary.BigEndian.Uint32(ibytes[1:5])
+	label = binary.BigEndian.Uint64(ibytes[5:])
+	return
+}
+
+// NewROITypeLabelTKey returns a type-specific key for the (index type, label) tuple within
+// a registered ROI.
+func NewROITypeLabelTKey(roiName string, i IndexType, label uint64) storage.TKey {
+	n := len(roiName) + 1
+	buf := make([]byte, n+1+8)
+	copy(buf, roiName)
+	buf[n] = byte(i)
+	binary.BigEndian.PutUint64(buf[n+1:], label)
+	return storage.NewTKey(keyROITypeLabel, buf)
+}
+
+// DecodeROITypeLabelTKey decodes a type-specific key into a (ROI name, index type, label) tuple.
+func DecodeROITypeLabelTKey(tk storage.TKey) (roiName string, i IndexType, label uint64, err error) {
+	var ibytes []byte
+	ibytes, err = tk.ClassBytes(keyROITypeLabel)
+	if err != nil {
+		return
+	}
+	n := bytes.IndexByte(ibytes, 0)
+	if n < 0 || len(ibytes) != n+1+9 {
+		err = fmt.Errorf("labelsz ROI label size type-specific key is badly formatted (%d bytes)", len(ibytes))
+		return
+	}
+	roiName = string(ibytes[:n])
+	i = IndexType(ibytes[n+1])
+	label = binary.BigEndian.Uint64(ibytes[n+2:])
+	return
+}
+
+// typeSizeLabelTKey returns the sorted size key for the global rankings if roiName is
+// empty or the rankings within the named ROI.
+func typeSizeLabelTKey(roiName string, i IndexType, sz uint32, label uint64) storage.TKey {
+	if roiName == "" {
+		return NewTypeSizeLabelTKey(i, sz, label)
+	}
+	return NewROITypeSizeLabelTKey(roiName, i, sz, label)
+}
+
+// typeLabelTKey returns the label size key for the global rankings if roiName is empty
+// or the rankings within the named ROI.
+func typeLabelTKey(roiName string, i IndexType, label uint64) storage.TKey {
+	if roiName == "" {
+		return NewTypeLabelTKey(i, label)
+	}
+	return NewROITypeLabelTKey(roiName, i, label)
+}
+
+// decodeTypeSizeLabelTKey decodes either a global or ROI sorted size key.
+func decodeTypeSizeLabelTKey(tk storage.TKey) (i IndexType, sz uint32, label uint64, err error) {
+	var class storage.TKeyClass
+	if class, err = tk.Class(); err != nil {
+		return
+	}
+	if class == keyROITypeSizeLabel {
+		_, i, sz, label, err = DecodeROITypeSizeLabelTKey(tk)
+		return
+	}
+	return DecodeTypeSizeLabelTKey(tk)
+}
@@ -1,5 +1,5 @@
 /*
-Package labelsz supports ranking labels by # annotations of each type.
+Package labelsz supports ranking labels by # annotations of each type or # voxels.
 */
 package labelsz
 
@@ -67,6 +67,9 @@ $ dvid repo <UUID> new labelsz <data name> <settings...>
     ROI            Value must be in "<roiname>,<uuid>" format where <roiname> is the name of the
 				   static ROI that defines the extent of tracking and <uuid> is the immutable
 				   version used for this labelsz.
+    ROIs           Semicolon-separated list of "<roiname>[,<uuid>]" ROIs for which separate
+                   annotation rankings are maintained.  If <uuid> is omitted, the ROI at the
+                   version used to create the labelsz is used.
 	
     ------------------
 
@@ -110,6 +113,8 @@ POST <api URL>/node/<UUID>/<data name>/info
     OPTIONAL "ROI"        Value must be in "<roiname>,<uuid>" format where <roiname> is the name of the
 				   		  static ROI that defines the extent of tracking and <uuid> is the immutable
 				   		  version used for this labelsz.
+    OPTIONAL "ROIs"       Semicolon-separated list of "<roiname>[,<uuid>]" ROIs for which separate
+                          annotation rankings are maintained.  See the /rois endpoint.
 							 
 POST <api URL>/node/<UUID>/<data name>/sync?<options>
 
@@ -127,7 +132,10 @@ POST <api URL>/node/<UUID>/<data name>/sync?<options>
 	and then kept in sync thereafter.  It is not allowed to change syncs.  You can, however,
 	create a new labelsz data instance and sync it as required.
 
-    The labelsz data type only accepts syncs to annotation data instances.
+    The labelsz data type only accepts syncs to annotation and labelmap data instances.
+    An annotation sync provides the synapse counts while a labelmap sync provides the
+    "Voxels" counts.  Both can be synced, e.g., { "sync": "synapses,segmentation" }.
+    Voxel counts are not restricted by any ROI.
 
     GET Query-string Options:
 
@@ -135,14 +143,33 @@ POST <api URL>/node/<UUID>/<data name>/sync?<options>
 			   Default operation is false.
 
 
-GET <api URL>/node/<UUID>/<data name>/count/<label>/<index type>
+GET  <api URL>/node/<UUID>/<data name>/rois
+POST <api URL>/node/<UUID>/<data name>/rois[?replace=true]
+
+	Gets or registers the ROIs for which separate annotation rankings are maintained in
+	addition to the global rankings.  The ROI rankings are then available by adding the
+	"roi=<roiname>" query string to the /count, /counts, /top, and /threshold endpoints.
+	Each ROI is fixed at a version, so the POSTed JSON is a list of specifications of the
+	form "<roiname>" or "<roiname>,<uuid>", where a missing UUID means the ROI at the
+	version of the request:
+
+	[ "mushroom-body", "medulla,3f8c" ]
+
+	Registering ROIs adds to the current ROIs unless "replace=true" is set.  After a POST,
+	a reload of the labelsz is started to compute the rankings for the ROIs.  Element
+	positions must also be within any static ROI set at creation to be counted.
+
+	ROI rankings are only available for annotation element types and not "Voxels".
+
+
+GET <api URL>/node/<UUID>/<data name>/count/<label>/<index type>[?roi=<roiname>]
 
 	Returns the count of the given annotation element type for the given label.
 	The index type may be any annotation element type ("PostSyn", "PreSyn", "Gap", "Note"),
 	the catch-all for synapses "AllSyn", or the number of voxels "Voxels".
 
 	For synapse indexing, the labelsz data instance must be synced with an annotations instance.
-	(future) For # voxel indexing, the labelsz data instance must be synced with a labelvol instance.
+	For # voxel indexing, the labelsz data instance must be synced with a labelmap instance.
 
 	Example:
 
@@ -156,7 +183,7 @@ GET <api URL>/node/<UUID>/<data name>/count/<label>/<index type>
 Note: For the following URL endpoints that return and accept POSTed JSON values, see the JSON format
 at end of this documentation.
 
-GET <api URL>/node/<UUID>/<data name>/counts/<index type>
+GET <api URL>/node/<UUID>/<data name>/counts/<index type>[?roi=<roiname>]
 
 	Returns the count of the given annotation element type for the POSTed labels.
 	Note "counts" is plural. 
@@ -171,14 +198,14 @@ GET <api URL>/node/<UUID>/<data name>/counts/<index type>
 		{ "Label": 8137, "PreSyn": 58 } 
 	]
 
-GET <api URL>/node/<UUID>/<data name>/top/<N>/<index type>
+GET <api URL>/node/<UUID>/<data name>/top/<N>/<index type>[?roi=<roiname>]
 
 	Returns a list of the top N labels with respect to number of the specified index type.
 	The index type may be any annotation element type ("PostSyn", "PreSyn", "Gap", "Note"),
 	the catch-all for synapses "AllSyn", or the number of voxels "Voxels".
 
 	For synapse indexing, the labelsz data instance must be synced with an annotations instance.
-	(future) For # voxel indexing, the labelsz data instance must be synced with a labelvol instance.
+	For # voxel indexing, the labelsz data instance must be synced with a labelmap instance.
 
 	Example:
 
@@ -188,6 +215,9 @@ GET <api URL>/node/<UUID>/<data name>/top/<N>/<index type>
 
 	[ { "Label": 188,  "PreSyn": 81 }, { "Label": 23, "PreSyn": 65 }, { "Label": 8137, "PreSyn": 58 } ]
 
+	If the "roi" query string is given, the ranking only counts elements within that
+	registered ROI, e.g., GET <api URL>/node/3f8c/labelrankings/top/3/PostSyn?roi=mushroom-body
+
 GET <api URL>/node/<UUID>/<data name>/threshold/<T>/<index type>[?<options>]
 
 	Returns a list of up to 10,000 labels per request that have # given element types >= T.
@@ -199,12 +229,13 @@ GET <api URL>/node/<UUID>/<data name>/threshold/<T>/<index type>[?<options>]
 	the catch-all for synapses "AllSyn", or the number of voxels "Voxels".
 
 	For synapse indexing, the labelsz data instance must be synced with an annotations instance.
-	(future) For # voxel indexing, the labelsz data instance must be synced with a labelvol instance.
+	For # voxel indexing, the labelsz data instance must be synced with a labelmap instance.
 
     GET Query-string Options:
 
     offset  The starting rank in the sorted list (in descending order) of labels with # given element types >= T.
     n       Number of labels to return.
+    roi     Name of a registered ROI (see /rois) to restrict rankings to that ROI.
 
 	Example:
 
@@ -217,9 +248,12 @@ GET <api URL>/node/<UUID>/<data name>/threshold/<T>/<index type>[?<options>]
 	In the above example, the query returns the labels ranked #10,001 to #10,003 in the sorted list, in
 	descending order of # PreSyn >= 10.
 
+	Voxel rankings saturate at 4,294,967,294 voxels, so larger bodies have that size in
+	/top and /threshold results.  The /count and /counts endpoints return exact # voxels.
+
 POST <api URL>/node/<UUID>/<data name>/reload
 
-	Forces asynchornous denormalization from its synced annotations instance.  Can be 
+	Forces asynchornous denormalization from its synced annotations and labelmap instances.  Can be 
 	used to initialize a newly added instance.  Note that the labelsz will be locked until
 	the denormalization is finished with a log message.
 `
@@ -290,6 +324,18 @@ func NewData(uuid dvid.UUID, id dvid.InstanceID, name dvid.InstanceName, c dvid.
 		}
 	}
 
+	// See if we have ROIs for which rankings should be maintained.
+	var rois []string
+	roisStr, found, err := c.GetString("ROIs")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		if rois, err = parseROISpecs(strings.Split(roisStr, ";"), uuid); err != nil {
+			return nil, err
+		}
+	}
+
 	// Initialize the Data for this data type
 	basedata, err := datastore.NewDataService(dtype, uuid, id, name, c)
 	if err != nil {
@@ -299,6 +345,7 @@ func NewData(uuid dvid.UUID, id dvid.InstanceID, name dvid.InstanceName, c dvid.
 		Data: basedata,
 		Properties: Properties{
 			StaticROI: roistr,
+			ROIs:      rois,
 		},
 	}
 	return data, nil
@@ -325,6 +372,10 @@ type Properties struct {
 	// StaticROI is an optional static ROI specification of the form "<roiname>,<uuid>"
 	// Note that it *cannot* mutate after the labelsz instance is created.
 	StaticROI string
+
+	// ROIs are optional ROI specifications of the form "<roiname>,<uuid>" for which
+	// separate rankings are maintained in addition to the global rankings.
+	ROIs []string
 }
 
 // Data instance of labelvol, label sparse volumes.
@@ -340,6 +391,9 @@ type Data struct {
 	iROI       *roi.Immutable
 	roiChecked bool
 
+	// cache of immutable ROIs with separate rankings, indexed by ROI name.
+	iROIs map[string]*roi.Immutable
+
 	// channels for processing messages from synced data like annotations
 	syncCh   chan datastore.SyncMessage
 	syncDone chan *sync.WaitGroup
@@ -355,13 +409,17 @@ func (d *Data) Equals(d2 *Data) bool {
 	return reflect.DeepEqual(d.Properties, d2.Properties)
 }
 
+// GetSyncedAnnotation returns the synced annotation or nil if there is none.
 func (d *Data) GetSyncedAnnotation() *annotation.Data {
 	for dataUUID := range d.SyncedData() {
-		source, err := annotation.GetByDataUUID(dataUUID)
-		if err == nil {
-			return source
+		source, err := datastore.GetDataByDataUUID(dataUUID)
+		if err != nil {
+			dvid.Errorf("Got error accessing synced data %s: %v\n", dataUUID, err)
+			continue
+		}
+		if annot, ok := source.(*annotation.Data); ok {
+			return annot
 		}
-		dvid.Errorf("Got error accessing synced annotation %s: %v\n", dataUUID, err)
 	}
 	return nil
 }
@@ -392,35 +450,43 @@ func (d *Data) inROI(pos dvid.Point3d) bool {
 }
 
 // GetCountElementType returns a count of the given ElementType for a given label.
-func (d *Data) GetCountElementType(ctx *datastore.VersionedCtx, label uint64, i IndexType) (uint32, error) {
+// If roiName is not empty, the count is restricted to the named registered ROI.
+func (d *Data) GetCountElementType(ctx *datastore.VersionedCtx, roiName string, label uint64, i IndexType) (uint64, error) {
 	if d.uninitialized {
 		return 0, fmt.Errorf("stats not available for labelsz %q at this time", d.DataName())
 	}
+	if err := d.checkROI(roiName, i); err != nil {
+		return 0, err
+	}
 
 	store, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
 		return 0, err
 	}
 
-	val, err := store.Get(ctx, NewTypeLabelTKey(i, label))
+	val, err := store.Get(ctx, typeLabelTKey(roiName, i, label))
 	if err != nil {
 		return 0, err
 	}
 	if val == nil {
 		return 0, nil
 	}
-	if len(val) != 4 {
-		return 0, fmt.Errorf("bad size in value for index type %s, label %d: value has length %d", i, label, len(val))
+	count, err := decodeCount(i, val)
+	if err != nil {
+		return 0, fmt.Errorf("label %d: %v", label, err)
 	}
-	count := binary.LittleEndian.Uint32(val)
 	return count, nil
 }
 
-// SendCountsByElementType writes the counts for given index type for a list of labels
-func (d *Data) SendCountsByElementType(w http.ResponseWriter, ctx *datastore.VersionedCtx, labels []uint64, idxType IndexType) error {
+// SendCountsByElementType writes the counts for given index type for a list of labels.
+// If roiName is not empty, the counts are restricted to the named registered ROI.
+func (d *Data) SendCountsByElementType(w http.ResponseWriter, ctx *datastore.VersionedCtx, roiName string, labels []uint64, idxType IndexType) error {
 	if d.uninitialized {
 		return fmt.Errorf("stats not available for labelsz %q at this time", d.DataName())
 	}
+	if err := d.checkROI(roiName, idxType); err != nil {
+		return err
+	}
 
 	store, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
@@ -433,18 +499,17 @@ func (d *Data) SendCountsByElementType(w http.ResponseWriter, ctx *datastore.Ver
 	}
 	numLabels := len(labels)
 	for i, label := range labels {
-		val, err := store.Get(ctx, NewTypeLabelTKey(idxType, label))
+		val, err := store.Get(ctx, typeLabelTKey(roiName, idxType, label))
 		if err != nil {
 			dvid.Errorf("problem in GET for index type %s, label %d: %v", idxType, label, err)
 			continue
 		}
-		var count uint32
+		var count uint64
 		if val != nil {
-			if len(val) != 4 {
-				dvid.Errorf("bad value size %d for index type %s, label %d", len(val), idxType, label)
+			if count, err = decodeCount(idxType, val); err != nil {
+				dvid.Errorf("bad value for label %d: %v", label, err)
 				continue
 			}
-			count = binary.LittleEndian.Uint32(val)
 		}
 		if _, err := fmt.Fprintf(w, `{"Label":%d,%q:%d}`, label, idxType, count); err != nil {
 			continue
@@ -458,10 +523,14 @@ func (d *Data) SendCountsByElementType(w http.ResponseWriter, ctx *datastore.Ver
 }
 
 // GetTopElementType returns a sorted list of the top N labels that have the given ElementType.
-func (d *Data) GetTopElementType(ctx *datastore.VersionedCtx, n int, i IndexType) (LabelSizes, error) {
+// If roiName is not empty, the rankings are restricted to the named registered ROI.
+func (d *Data) GetTopElementType(ctx *datastore.VersionedCtx, roiName string, n int, i IndexType) (LabelSizes, error) {
 	if d.uninitialized {
 		return nil, fmt.Errorf("stats not available for labelsz %q at this time", d.DataName())
 	}
+	if err := d.checkROI(roiName, i); err != nil {
+		return nil, err
+	}
 
 	if n < 0 {
 		return nil, fmt.Errorf("bad N (%d) in top request", n)
@@ -476,15 +545,15 @@ func (d *Data) GetTopElementType(ctx *datastore.VersionedCtx, n int, i IndexType
 	}
 
 	// Setup key range for iterating through keys of this ElementType.
-	begTKey := NewTypeSizeLabelTKey(i, math.MaxUint32-1, 0)
-	endTKey := NewTypeSizeLabelTKey(i, 0, math.MaxUint64)
+	begTKey := typeSizeLabelTKey(roiName, i, math.MaxUint32-1, 0)
+	endTKey := typeSizeLabelTKey(roiName, i, 0, math.MaxUint64)
 
 	// Iterate through the first N kv then abort.
 	shortCircuitErr := fmt.Errorf("Found data, aborting.")
 	lsz := make(LabelSizes, n)
 	rank := 0
 	err = store.ProcessRange(ctx, begTKey, endTKey, nil, func(chunk *storage.Chunk) error {
-		idxType, sz, label, err := DecodeTypeSizeLabelTKey(chunk.K)
+		idxType, sz, label, err := decodeTypeSizeLabelTKey(chunk.K)
 		if err != nil {
 			return err
 		}
@@ -506,10 +575,14 @@ func (d *Data) GetTopElementType(ctx *datastore.VersionedCtx, n int, i IndexType
 
 // GetLabelsByThreshold returns a sorted list of labels that meet the given minSize threshold.
 // We allow a maximum of MaxLabelsReturned returned labels and start with rank "offset".
-func (d *Data) GetLabelsByThreshold(ctx *datastore.VersionedCtx, i IndexType, minSize uint32, offset, num int) (LabelSizes, error) {
+// If roiName is not empty, the rankings are restricted to the named registered ROI.
+func (d *Data) GetLabelsByThreshold(ctx *datastore.VersionedCtx, roiName string, i IndexType, minSize uint32, offset, num int) (LabelSizes, error) {
 	if d.uninitialized {
 		return nil, fmt.Errorf("stats not available for labelsz %q at this time", d.DataName())
 	}
+	if err := d.checkROI(roiName, i); err != nil {
+		return nil, err
+	}
 
 	var nReturns int
 	if num == 0 {
@@ -526,8 +599,8 @@ func (d *Data) GetLabelsByThreshold(ctx *datastore.VersionedCtx, i IndexType, mi
 	}
 
 	// Setup key range for iterating through keys of this ElementType.
-	begTKey := NewTypeSizeLabelTKey(i, math.MaxUint32-1, 0)
-	endTKey := NewTypeSizeLabelTKey(i, 0, math.MaxUint64)
+	begTKey := typeSizeLabelTKey(roiName, i, math.MaxUint32-1, 0)
+	endTKey := typeSizeLabelTKey(roiName, i, 0, math.MaxUint64)
 
 	// Iterate through sorted size list until we get what we need.
 	shortCircuitErr := fmt.Errorf("Found data, aborting.")
@@ -535,7 +608,7 @@ func (d *Data) GetLabelsByThreshold(ctx *datastore.VersionedCtx, i IndexType, mi
 	rank := 0
 	saved := 0
 	err = store.ProcessRange(ctx, begTKey, endTKey, nil, func(chunk *storage.Chunk) error {
-		idxType, sz, label, err := DecodeTypeSizeLabelTKey(chunk.K)
+		idxType, sz, label, err := decodeTypeSizeLabelTKey(chunk.K)
 		if err != nil {
 			return err
 		}
@@ -706,7 +779,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			server.BadRequest(w, r, fmt.Errorf("unknown index type specified (%q)", parts[5]))
 			return
 		}
-		count, err := d.GetCountElementType(ctx, label, idxType)
+		count, err := d.GetCountElementType(ctx, r.URL.Query().Get("roi"), label, idxType)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -743,7 +816,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			server.BadRequest(w, r, fmt.Sprintf("Bad JSON label array sent in 'counts' query: %v", err))
 			return
 		}
-		if err := d.SendCountsByElementType(w, ctx, labels, idxType); err != nil {
+		if err := d.SendCountsByElementType(w, ctx, r.URL.Query().Get("roi"), labels, idxType); err != nil {
 			server.BadRequest(w, r, err)
 			return
 		}
@@ -768,7 +841,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			server.BadRequest(w, r, fmt.Errorf("unknown index type specified (%q)", parts[5]))
 			return
 		}
-		labelSizes, err := d.GetTopElementType(ctx, int(n), i)
+		labelSizes, err := d.GetTopElementType(ctx, r.URL.Query().Get("roi"), int(n), i)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -825,7 +898,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			}
 		}
 
-		labels, err := d.GetLabelsByThreshold(ctx, i, minSize, offset, num)
+		labels, err := d.GetLabelsByThreshold(ctx, queryStrings.Get("roi"), i, minSize, offset, num)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -842,6 +915,48 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 		timedLog.Infof("HTTP %s: get %d labels for index type %s with threshold %d: %s", r.Method, num, i, t, r.URL)
 
+	case "rois":
+		switch action {
+		case "get":
+			// GET <api URL>/node/<UUID>/<data name>/rois
+			jsonBytes, err := json.Marshal(d.GetROIs())
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-type", "application/json")
+			if _, err := w.Write(jsonBytes); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		case "post":
+			// POST <api URL>/node/<UUID>/<data name>/rois[?replace=true]
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			var specs []string
+			if err := json.Unmarshal(data, &specs); err != nil {
+				server.BadRequest(w, r, fmt.Sprintf("expected JSON list of ROI specifications: %v", err))
+				return
+			}
+			replace := r.URL.Query().Get("replace") == "true"
+			if err := d.AddROIs(specs, uuid, replace); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if err := datastore.SaveDataByUUID(uuid, d); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			d.ReloadData(ctx)
+			timedLog.Infof("HTTP %s: registered ROIs %v for labelsz %q", r.Method, d.GetROIs(), d.DataName())
+		default:
+			server.BadRequest(w, r, "Only GET or POST actions are available on 'rois' endpoint.")
+			return
+		}
+
 	case "reload":
 		// POST <api URL>/node/<UUID>/<data name>/reload
 		if action != "post" {
@@ -861,13 +976,15 @@ func (d *Data) ReloadData(ctx *datastore.VersionedCtx) {
 	dvid.Infof("Started recalculation of labelsz %q...\n", d.DataName())
 }
 
-// Get all labeled annotations from synced annotation instance and repopulate the labelsz.
+// Get all labeled annotations from synced annotation instance and label sizes from synced
+// labelmap instance, then repopulate the labelsz.
 func (d *Data) resync(ctx *datastore.VersionedCtx) {
 	timedLog := dvid.NewTimeLog()
 
 	annot := d.GetSyncedAnnotation()
-	if annot == nil {
-		dvid.Errorf("Unable to get synced annotation.  Aborting reload of labelsz %q.\n", d.DataName())
+	lm := d.GetSyncedLabelmap()
+	if annot == nil && lm == nil {
+		dvid.Errorf("Unable to get synced annotation or labelmap.  Aborting reload of labelsz %q.\n", d.DataName())
 		return
 	}
 
@@ -885,18 +1002,41 @@ func (d *Data) resync(ctx *datastore.VersionedCtx) {
 		d.uninitialized = false
 	}()
 
-	minTSLTKey := storage.MinTKey(keyTypeSizeLabel)
-	maxTSLTKey := storage.MaxTKey(keyTypeSizeLabel)
-	if err := store.DeleteRange(ctx, minTSLTKey, maxTSLTKey); err != nil {
-		dvid.Errorf("Unable to delete type-size-label denormalization for labelsz %q: %v\n", d.DataName(), err)
-		return
+	// Only delete the indices that will be regenerated.
+	var reloaded []IndexType
+	if annot != nil {
+		reloaded = append(reloaded, PostSyn, PreSyn, Gap, Note, AllSyn)
+
+		minTSLTKey := storage.MinTKey(keyROITypeSizeLabel)
+		maxTSLTKey := storage.MaxTKey(keyROITypeSizeLabel)
+		if err := store.DeleteRange(ctx, minTSLTKey, maxTSLTKey); err != nil {
+			dvid.Errorf("Unable to delete ROI type-size-label denormalization for labelsz %q: %v\n", d.DataName(), err)
+			return
+		}
+		minTypeTKey := storage.MinTKey(keyROITypeLabel)
+		maxTypeTKey := storage.MaxTKey(keyROITypeLabel)
+		if err := store.DeleteRange(ctx, minTypeTKey, maxTypeTKey); err != nil {
+			dvid.Errorf("Unable to delete ROI type-label denormalization for labelsz %q: %v\n", d.DataName(), err)
+			return
+		}
+	}
+	if lm != nil {
+		reloaded = append(reloaded, Voxels)
 	}
+	for _, i := range reloaded {
+		minTSLTKey := NewTypeSizeLabelTKey(i, math.MaxUint32, 0)
+		maxTSLTKey := NewTypeSizeLabelTKey(i, 0, math.MaxUint64)
+		if err := store.DeleteRange(ctx, minTSLTKey, maxTSLTKey); err != nil {
+			dvid.Errorf("Unable to delete type-size-label denormalization for labelsz %q: %v\n", d.DataName(), err)
+			return
+		}
 
-	minTypeTKey := storage.MinTKey(keyTypeLabel)
-	maxTypeTKey := storage.MaxTKey(keyTypeLabel)
-	if err := store.DeleteRange(ctx, minTypeTKey, maxTypeTKey); err != nil {
-		dvid.Errorf("Unable to delete type-label denormalization for labelsz %q: %v\n", d.DataName(), err)
-		return
+		minTypeTKey := NewTypeLabelTKey(i, 0)
+		maxTypeTKey := NewTypeLabelTKey(i, math.MaxUint64)
+		if err := store.DeleteRange(ctx, minTypeTKey, maxTypeTKey); err != nil {
+			dvid.Errorf("Unable to delete type-label denormalization for labelsz %q: %v\n", d.DataName(), err)
+			return
+		}
 	}
 	timedLog.Infof("Completed deletion of labelsz %q indices. Now regenerating.", d.DataName())
 
@@ -918,41 +1058,68 @@ func (d *Data) resync(ctx *datastore.VersionedCtx) {
 		}()
 	}
 
+	if annot != nil {
+		totLabels, err := d.resyncAnnotations(ctx, annot, writerCh)
+		if err != nil {
+			dvid.Errorf("Error in reload of labelsz %q: %v\n", d.DataName(), err)
+		}
+		timedLog.Infof("Completed labelsz %q reload of %d labels from annotation %q", d.DataName(), totLabels, annot.DataName())
+	}
+	if lm != nil {
+		totLabels, err := d.resyncVoxels(ctx, lm, writerCh)
+		if err != nil {
+			dvid.Errorf("Error in voxel reload of labelsz %q: %v\n", d.DataName(), err)
+		}
+		timedLog.Infof("Completed labelsz %q reload of %d labels from labelmap %q", d.DataName(), totLabels, lm.DataName())
+	}
+	close(writerCh)
+	writerWG.Wait()
+}
+
+// resyncAnnotations repopulates the annotation rankings from the label denormalizations
+// of a synced annotation.
+func (d *Data) resyncAnnotations(ctx *datastore.VersionedCtx, annot *annotation.Data, writerCh chan<- *storage.TKeyValue) (totLabels uint64, err error) {
+	timedLog := dvid.NewTimeLog()
+
 	// interate through all label annotations and pass to writer
-	var totLabels uint64
+	roiNames, iROIs := d.registeredROIs()
 	err = annot.ProcessLabelAnnotations(ctx.VersionID(), func(label uint64, elems annotation.ElementsNR) {
-		var indexMap [AllSyn]uint32
-
+		indexMaps := make(map[string]*[AllSyn]uint32)
 		for _, elem := range elems {
-			if d.inROI(elem.Pos) {
+			for _, roiName := range d.rankingsFor(elem.Pos, roiNames, iROIs) {
+				indexMap, found := indexMaps[roiName]
+				if !found {
+					indexMap = new([AllSyn]uint32)
+					indexMaps[roiName] = indexMap
+				}
 				indexMap[elementToIndexType(elem.Kind)]++
 			}
 		}
-		var allsyn uint32
-		for i := IndexType(0); i < AllSyn; i++ {
-			if indexMap[i] > 0 {
-				buf := make([]byte, 4)
-				binary.LittleEndian.PutUint32(buf, indexMap[i])
-				writerCh <- &storage.TKeyValue{K: NewTypeLabelTKey(i, label), V: buf}
-				writerCh <- &storage.TKeyValue{K: NewTypeSizeLabelTKey(i, indexMap[i], label)}
-				allsyn += indexMap[i]
+		if _, found := indexMaps[""]; !found {
+			indexMaps[""] = new([AllSyn]uint32)
+		}
+
+		for roiName, indexMap := range indexMaps {
+			var allsyn uint32
+			for i := IndexType(0); i < AllSyn; i++ {
+				if indexMap[i] > 0 {
+					buf := make([]byte, 4)
+					binary.LittleEndian.PutUint32(buf, indexMap[i])
+					writerCh <- &storage.TKeyValue{K: typeLabelTKey(roiName, i, label), V: buf}
+					writerCh <- &storage.TKeyValue{K: typeSizeLabelTKey(roiName, i, indexMap[i], label)}
+					allsyn += indexMap[i]
+				}
 			}
+			buf := make([]byte, 4)
+			binary.LittleEndian.PutUint32(buf, allsyn)
+			writerCh <- &storage.TKeyValue{K: typeLabelTKey(roiName, AllSyn, label), V: buf}
+			writerCh <- &storage.TKeyValue{K: typeSizeLabelTKey(roiName, AllSyn, allsyn, label)}
 		}
-		buf := make([]byte, 4)
-		binary.LittleEndian.PutUint32(buf, allsyn)
-		writerCh <- &storage.TKeyValue{K: NewTypeLabelTKey(AllSyn, label), V: buf}
-		writerCh <- &storage.TKeyValue{K: NewTypeSizeLabelTKey(AllSyn, allsyn, label)}
 
 		totLabels++
 		if totLabels%10000 == 0 {
 			timedLog.Infof("Reloading labelsz %q: %d labels processed", d.DataName(), totLabels)
 		}
 	})
-	if err != nil {
-		dvid.Errorf("Error in reload of labelsz %q: %v\n", d.DataName(), err)
-	}
-	close(writerCh)
-	writerWG.Wait()
-
-	timedLog.Infof("Completed labelsz %q reload of %d labels from annotation %q", d.DataName(), totLabels, annot.DataName())
+	return
 }
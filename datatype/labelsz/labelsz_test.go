@@ -831,3 +831,230 @@ func TestLabelmap(t *testing.T) {
 		t.Errorf("Got back incorrect post-merge PreSyn noroi count of label 20: %s\n", string(retData))
 	}
 }
+
+func checkVoxelCount(t *testing.T, uuid dvid.UUID, name string, label, expected uint64) {
+	url := fmt.Sprintf("%snode/%s/%s/count/%d/Voxels", server.WebAPIPath, uuid, name, label)
+	data := server.TestHTTP(t, "GET", url, nil)
+	if string(data) != fmt.Sprintf(`{"Label":%d,"Voxels":%d}`, label, expected) {
+		t.Errorf("expected label %d to have %d voxels, got: %s\n", label, expected, string(data))
+	}
+}
+
+func TestVoxels(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := datastore.NewTestRepo()
+	var config dvid.Config
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	server.CreateTestInstance(t, uuid, "labelsz", "voxels", config)
+	server.CreateTestSync(t, uuid, "voxels", "labels")
+
+	// Label 100 has 64 x 128 x 128 voxels while labels 200 and 300 have half that.
+	_ = createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "voxels"); err != nil {
+		t.Fatalf("Error blocking on sync of labelsz: %v\n", err)
+	}
+
+	url := fmt.Sprintf("%snode/%s/voxels/top/3/Voxels", server.WebAPIPath, uuid)
+	data := server.TestHTTP(t, "GET", url, nil)
+	if string(data) != `[{"Label":100,"Size":1048576},{"Label":200,"Size":524288},{"Label":300,"Size":524288}]` {
+		t.Errorf("Got back incorrect Voxels ranking:\n%v\n", string(data))
+	}
+	url = fmt.Sprintf("%snode/%s/voxels/threshold/600000/Voxels", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "GET", url, nil)
+	if string(data) != `[{"Label":100,"Size":1048576}]` {
+		t.Errorf("Got back incorrect Voxels threshold:\n%v\n", string(data))
+	}
+
+	// Merge 200 into 100.
+	url = fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBufferString("[100,200]"))
+	if err := datastore.BlockOnUpdating(uuid, "voxels"); err != nil {
+		t.Fatalf("Error blocking on sync of labelsz: %v\n", err)
+	}
+	checkVoxelCount(t, uuid, "voxels", 100, 1572864)
+	checkVoxelCount(t, uuid, "voxels", 200, 0)
+
+	// Cleave supervoxel 200 back off of 100.
+	url = fmt.Sprintf("%snode/%s/labels/cleave/100", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "POST", url, bytes.NewBufferString("[200]"))
+	var cleaveResp struct {
+		CleavedLabel uint64
+	}
+	if err := json.Unmarshal(data, &cleaveResp); err != nil {
+		t.Fatalf("bad cleave response: %s\n", string(data))
+	}
+	if err := datastore.BlockOnUpdating(uuid, "voxels"); err != nil {
+		t.Fatalf("Error blocking on sync of labelsz: %v\n", err)
+	}
+	checkVoxelCount(t, uuid, "voxels", 100, 1048576)
+	checkVoxelCount(t, uuid, "voxels", cleaveResp.CleavedLabel, 524288)
+
+	// Split a 19 x 19 x 19 cube off of label 300.
+	var rles dvid.RLEs
+	for z := int32(64); z < 83; z++ {
+		for y := int32(0); y < 19; y++ {
+			rles = append(rles, dvid.NewRLE(dvid.Point3d{64, y, z}, 19))
+		}
+	}
+	url = fmt.Sprintf("%snode/%s/labels/split/300", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "POST", url, getBytesRLE(t, rles))
+	splitResp := make(map[string]uint64)
+	if err := json.Unmarshal(data, &splitResp); err != nil {
+		t.Fatalf("bad split response: %s\n", string(data))
+	}
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "voxels"); err != nil {
+		t.Fatalf("Error blocking on sync of labelsz: %v\n", err)
+	}
+	checkVoxelCount(t, uuid, "voxels", 300, 524288-6859)
+	checkVoxelCount(t, uuid, "voxels", splitResp["label"], 6859)
+
+	// Overwrite part of label 100 with new label 500.
+	volume := newTestVolume(64, 64, 64)
+	volume.add(500, 0, 0, 0, 64, 64, 64)
+	volume.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "voxels"); err != nil {
+		t.Fatalf("Error blocking on sync of labelsz: %v\n", err)
+	}
+	checkVoxelCount(t, uuid, "voxels", 100, 1048576-262144)
+	checkVoxelCount(t, uuid, "voxels", 500, 262144)
+
+	// A labelsz created after the labels are populated needs a reload.
+	server.CreateTestInstance(t, uuid, "labelsz", "reloaded", config)
+	server.CreateTestSync(t, uuid, "reloaded", "labels")
+	url = fmt.Sprintf("%snode/%s/reloaded/reload", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, nil)
+	time.Sleep(100 * time.Millisecond)
+	if err := datastore.BlockOnUpdating(uuid, "reloaded"); err != nil {
+		t.Fatalf("Error blocking on reload of labelsz: %v\n", err)
+	}
+	url = fmt.Sprintf("%snode/%s/reloaded/top/5/Voxels", server.WebAPIPath, uuid)
+	reloaded := server.TestHTTP(t, "GET", url, nil)
+	url = fmt.Sprintf("%snode/%s/voxels/top/5/Voxels", server.WebAPIPath, uuid)
+	synced := server.TestHTTP(t, "GET", url, nil)
+	if string(reloaded) != string(synced) {
+		t.Errorf("reloaded Voxels ranking %s differs from synced ranking %s\n", string(reloaded), string(synced))
+	}
+}
+
+func TestROIRankings(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := datastore.NewTestRepo()
+	var config dvid.Config
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	_ = createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestSync(t, uuid, "mysynapses", "labels")
+
+	server.CreateTestInstance(t, uuid, "roi", "myroi", config)
+	roiRequest := fmt.Sprintf("%snode/%s/myroi/roi", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", roiRequest, getROIReader())
+
+	// Create labelsz with ROI rankings registered at creation.
+	config.Set("ROIs", "myroi")
+	server.CreateTestInstance(t, uuid, "labelsz", "rankings", config)
+	server.CreateTestSync(t, uuid, "rankings", "mysynapses")
+
+	// Same PostSyn and PreSyn distributions as TestLabels.
+	var synapses annotation.Elements
+	for z := int32(4); z < 128; z += 4 {
+		for y := int32(4); y < 128; y += 4 {
+			for x := int32(4); x < 128; x += 4 {
+				elem := annotation.ElementNR{Pos: dvid.Point3d{x, y, z}, Kind: annotation.PostSyn}
+				synapses = append(synapses, annotation.Element{ElementNR: elem})
+			}
+		}
+	}
+	for z := int32(2); z < 128; z += 4 {
+		for y := int32(2); y < 128; y += 4 {
+			for x := int32(2); x < 128; x += 4 {
+				elem := annotation.ElementNR{Pos: dvid.Point3d{x, y, z}, Kind: annotation.PreSyn}
+				synapses = append(synapses, annotation.Element{ElementNR: elem})
+			}
+		}
+	}
+	testJSON, err := json.Marshal(synapses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBuffer(testJSON))
+	if err := datastore.BlockOnUpdating(uuid, "rankings"); err != nil {
+		t.Fatalf("Error blocking on sync of labelsz: %v\n", err)
+	}
+
+	tests := []struct {
+		request  string
+		expected string
+	}{
+		{"top/3/PreSyn", `[{"Label":100,"Size":16384},{"Label":200,"Size":8192},{"Label":300,"Size":8192}]`},
+		{"top/3/PreSyn?roi=myroi", `[{"Label":100,"Size":2048},{"Label":200,"Size":1024},{"Label":300,"Size":1024}]`},
+		{"top/3/AllSyn?roi=myroi", `[{"Label":100,"Size":4096},{"Label":200,"Size":2048},{"Label":300,"Size":2048}]`},
+		{"threshold/1100/PostSyn?roi=myroi", `[{"Label":100,"Size":2048}]`},
+		{"threshold/0/PostSyn?roi=myroi&offset=1&n=1", `[{"Label":200,"Size":1024}]`},
+		{"count/100/PostSyn?roi=myroi", `{"Label":100,"PostSyn":2048}`},
+		{"count/100/PostSyn", `{"Label":100,"PostSyn":14415}`},
+	}
+	for _, tc := range tests {
+		url = fmt.Sprintf("%snode/%s/rankings/%s", server.WebAPIPath, uuid, tc.request)
+		data := server.TestHTTP(t, "GET", url, nil)
+		if string(data) != tc.expected {
+			t.Errorf("GET %s: expected %s, got %s\n", tc.request, tc.expected, string(data))
+		}
+	}
+	url = fmt.Sprintf("%snode/%s/rankings/top/3/PreSyn?roi=unknown", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", url, nil)
+	url = fmt.Sprintf("%snode/%s/rankings/top/3/Voxels?roi=myroi", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", url, nil)
+
+	// Move a PostSyn from label 100 out of the ROI into label 300.
+	url = fmt.Sprintf("%snode/%s/mysynapses/move/32_32_32/75_21_69", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, nil)
+	if err := datastore.BlockOnUpdating(uuid, "rankings"); err != nil {
+		t.Fatalf("Error blocking on sync of labelsz: %v\n", err)
+	}
+	expectedROI := `[{"Label":100,"Size":2047},{"Label":200,"Size":1024},{"Label":300,"Size":1024}]`
+	url = fmt.Sprintf("%snode/%s/rankings/top/3/PostSyn?roi=myroi", server.WebAPIPath, uuid)
+	if data := server.TestHTTP(t, "GET", url, nil); string(data) != expectedROI {
+		t.Errorf("bad post-move PostSyn ROI ranking: %s\n", string(data))
+	}
+
+	// Register the ROI on a labelsz created after the annotations, which triggers a reload.
+	var config2 dvid.Config
+	server.CreateTestInstance(t, uuid, "labelsz", "later", config2)
+	server.CreateTestSync(t, uuid, "later", "mysynapses")
+	url = fmt.Sprintf("%snode/%s/later/rois", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, strings.NewReader(`["myroi"]`))
+	time.Sleep(100 * time.Millisecond)
+	if err := datastore.BlockOnUpdating(uuid, "later"); err != nil {
+		t.Fatalf("Error blocking on reload of labelsz: %v\n", err)
+	}
+	data := server.TestHTTP(t, "GET", url, nil)
+	if string(data) != fmt.Sprintf(`["myroi,%s"]`, uuid) {
+		t.Errorf("bad registered ROIs: %s\n", string(data))
+	}
+	url = fmt.Sprintf("%snode/%s/later/top/3/PostSyn?roi=myroi", server.WebAPIPath, uuid)
+	if data := server.TestHTTP(t, "GET", url, nil); string(data) != expectedROI {
+		t.Errorf("bad reloaded PostSyn ROI ranking: %s\n", string(data))
+	}
+}
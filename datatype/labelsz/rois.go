@@ -0,0 +1,152 @@
+/*
+	This file supports rankings restricted to registered ROIs.
+*/
+
+package labelsz
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datatype/roi"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// parseROISpecs returns ROI specifications of the form "<roiname>,<uuid>" given specifications
+// that may omit the UUID, in which case the given UUID is used.
+func parseROISpecs(specs []string, uuid dvid.UUID) ([]string, error) {
+	parsed := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		parts := strings.Split(spec, ",")
+		switch len(parts) {
+		case 1:
+			spec = parts[0] + "," + string(uuid)
+		case 2:
+		default:
+			return nil, fmt.Errorf("bad ROI value (%q) expected %q", spec, "<roiname>[,<uuid>]")
+		}
+		if parts[0] == "" {
+			return nil, fmt.Errorf("bad ROI value (%q) has no ROI name", spec)
+		}
+		parsed = append(parsed, spec)
+	}
+	return parsed, nil
+}
+
+// roiSpecName returns the ROI name of a specification of the form "<roiname>,<uuid>".
+func roiSpecName(spec string) string {
+	return strings.Split(spec, ",")[0]
+}
+
+// GetROIs returns the specifications of the registered ROIs.
+func (d *Data) GetROIs() []string {
+	d.iMutex.Lock()
+	defer d.iMutex.Unlock()
+	rois := make([]string, len(d.ROIs))
+	copy(rois, d.ROIs)
+	return rois
+}
+
+// AddROIs registers ROIs for which rankings are maintained.  If replace is true, the given
+// ROIs replace the currently registered ROIs.  The rankings for the ROIs must be computed
+// via a reload.
+func (d *Data) AddROIs(specs []string, uuid dvid.UUID, replace bool) error {
+	parsed, err := parseROISpecs(specs, uuid)
+	if err != nil {
+		return err
+	}
+
+	d.iMutex.Lock()
+	defer d.iMutex.Unlock()
+
+	var rois []string
+	if !replace {
+		rois = append(rois, d.ROIs...)
+	}
+	names := make(map[string]int, len(rois))
+	for i, spec := range rois {
+		names[roiSpecName(spec)] = i
+	}
+	for _, spec := range parsed {
+		if i, found := names[roiSpecName(spec)]; found {
+			rois[i] = spec
+		} else {
+			names[roiSpecName(spec)] = len(rois)
+			rois = append(rois, spec)
+		}
+	}
+	d.ROIs = rois
+	d.iROIs = nil
+	return nil
+}
+
+// hasROI returns true if the ROI name has been registered.
+func (d *Data) hasROI(roiName string) bool {
+	d.iMutex.Lock()
+	defer d.iMutex.Unlock()
+	for _, spec := range d.ROIs {
+		if roiSpecName(spec) == roiName {
+			return true
+		}
+	}
+	return false
+}
+
+// checkROI returns an error if rankings for the given index type aren't maintained for
+// the ROI name.  An empty ROI name signifies the global rankings.
+func (d *Data) checkROI(roiName string, i IndexType) error {
+	if roiName == "" {
+		return nil
+	}
+	if i == Voxels {
+		return fmt.Errorf("voxel rankings are not available by ROI")
+	}
+	if !d.hasROI(roiName) {
+		return fmt.Errorf("labelsz %q has no registered ROI %q", d.DataName(), roiName)
+	}
+	return nil
+}
+
+// registeredROIs returns the names and immutable ROIs of the registered ROIs.  A nil
+// immutable ROI means the ROI could not be retrieved and nothing is within it.
+func (d *Data) registeredROIs() (names []string, iROIs []*roi.Immutable) {
+	d.iMutex.Lock()
+	defer d.iMutex.Unlock()
+
+	if d.iROIs == nil {
+		d.iROIs = make(map[string]*roi.Immutable, len(d.ROIs))
+	}
+	for _, spec := range d.ROIs {
+		name := roiSpecName(spec)
+		iROI, found := d.iROIs[name]
+		if !found {
+			var err error
+			if iROI, err = roi.ImmutableBySpec(spec); err != nil {
+				dvid.Errorf("could not load immutable ROI by spec %q: %v\n", spec, err)
+			}
+			d.iROIs[name] = iROI
+		}
+		names = append(names, name)
+		iROIs = append(iROIs, iROI)
+	}
+	return
+}
+
+// rankingsFor returns the ROI names of the rankings that include the given position.
+// The empty string signifies the global rankings.
+func (d *Data) rankingsFor(pos dvid.Point3d, names []string, iROIs []*roi.Immutable) []string {
+	if !d.inROI(pos) {
+		return nil
+	}
+	rankings := []string{""}
+	for i, iROI := range iROIs {
+		if iROI != nil && iROI.VoxelWithin(pos) {
+			rankings = append(rankings, names[i])
+		}
+	}
+	return rankings
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/datatype/annotation"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 	"github.com/janelia-flyem/dvid/storage"
@@ -50,17 +51,41 @@ func (d *Data) GetSyncSubs(synced dvid.Data) (datastore.SyncSubs, error) {
 		}
 	}
 
-	subs := datastore.SyncSubs{
-		datastore.SyncSub{
-			Event:  datastore.SyncEvent{synced.DataUUID(), annotation.ModifyElementsEvent},
-			Notify: d.DataUUID(),
-			Ch:     d.syncCh,
-		},
-		// datastore.SyncSub{
-		// 	Event:  datastore.SyncEvent{synced.DataUUID(), annotation.SetElementsEvent},
-		// 	Notify: d.DataUUID(),
-		// 	Ch:     d.SyncCh,
-		// },
+	var subs datastore.SyncSubs
+	switch synced.TypeName() {
+	case "annotation":
+		subs = datastore.SyncSubs{
+			datastore.SyncSub{
+				Event:  datastore.SyncEvent{synced.DataUUID(), annotation.ModifyElementsEvent},
+				Notify: d.DataUUID(),
+				Ch:     d.syncCh,
+			},
+			// datastore.SyncSub{
+			// 	Event:  datastore.SyncEvent{synced.DataUUID(), annotation.SetElementsEvent},
+			// 	Notify: d.DataUUID(),
+			// 	Ch:     d.SyncCh,
+			// },
+		}
+	case "labelmap":
+		subs = datastore.SyncSubs{
+			datastore.SyncSub{
+				Event:  datastore.SyncEvent{Data: synced.DataUUID(), Event: labels.ChangeSizeEvent},
+				Notify: d.DataUUID(),
+				Ch:     d.syncCh,
+			},
+			datastore.SyncSub{
+				Event:  datastore.SyncEvent{Data: synced.DataUUID(), Event: labels.MergeBlockEvent},
+				Notify: d.DataUUID(),
+				Ch:     d.syncCh,
+			},
+			datastore.SyncSub{
+				Event:  datastore.SyncEvent{Data: synced.DataUUID(), Event: labels.SplitLabelEvent},
+				Notify: d.DataUUID(),
+				Ch:     d.syncCh,
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unable to sync %s with %s since datatype %q is not supported", d.DataName(), synced.DataName(), synced.TypeName())
 	}
 	return subs, nil
 }
@@ -70,7 +95,7 @@ func (d *Data) SyncPending() bool {
 	return len(d.syncCh) > 0
 }
 
-// If annotation elements are added or deleted, adjust the label counts.
+// If annotation elements are added or deleted or label sizes change, adjust the label counts.
 func (d *Data) processEvents() {
 	defer func() {
 		if e := recover(); e != nil {
@@ -111,8 +136,10 @@ func (d *Data) processEvents() {
 			switch delta := msg.Delta.(type) {
 			case annotation.DeltaModifyElements:
 				d.modifyElements(ctx, delta, batcher)
+			case labels.DeltaNewSize, labels.DeltaModSize, labels.DeltaMerge, labels.DeltaSplit:
+				d.modifyVoxels(ctx, delta, batcher)
 			default:
-				dvid.Criticalf("Cannot sync annotations from modify element.  Got unexpected delta: %v\n", msg)
+				dvid.Criticalf("Cannot sync labelsz %q.  Got unexpected delta: %v\n", d.DataName(), msg)
 			}
 			d.StopUpdate()
 
@@ -126,8 +153,9 @@ func (d *Data) processEvents() {
 	}
 }
 
-// returned map will only include labels that had previously been seen (has key)
-func (d *Data) getCounts(ctx *datastore.VersionedCtx, labels map[indexedLabel]int32) (counts map[indexedLabel]uint32, err error) {
+// returned map will only include labels that had previously been seen (has key).
+// If roiName is not empty, the counts are restricted to the named registered ROI.
+func (d *Data) getCounts(ctx *datastore.VersionedCtx, roiName string, labels map[indexedLabel]int32) (counts map[indexedLabel]uint32, err error) {
 	var store storage.OrderedKeyValueDB
 	store, err = datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
@@ -144,7 +172,7 @@ func (d *Data) getCounts(ctx *datastore.VersionedCtx, labels map[indexedLabel]in
 			return
 		}
 
-		val, err = store.Get(ctx, NewTypeLabelTKey(i, label))
+		val, err = store.Get(ctx, typeLabelTKey(roiName, i, label))
 		if err != nil {
 			return
 		}
@@ -166,40 +194,46 @@ func (d *Data) modifyElements(ctx *datastore.VersionedCtx, delta annotation.Delt
 	var diagnostic string
 	successful := true
 
-	mods := make(map[indexedLabel]int32)
-	for _, elemPos := range delta.Add {
-		if d.inROI(elemPos.Pos) {
+	// Get changes in counts for each of the rankings, where "" is the global ranking.
+	roiNames, iROIs := d.registeredROIs()
+	roiMods := make(map[string]map[indexedLabel]int32)
+	addMod := func(elemPos annotation.ElementPos, change int32) {
+		for _, roiName := range d.rankingsFor(elemPos.Pos, roiNames, iROIs) {
+			mods, found := roiMods[roiName]
+			if !found {
+				mods = make(map[indexedLabel]int32)
+				roiMods[roiName] = mods
+			}
 			i := toIndexedLabel(elemPos)
-			mods[i]++
+			mods[i] += change
 			if elemPos.Kind.IsSynaptic() {
 				i = newIndexedLabel(AllSyn, elemPos.Label)
-				mods[i]++
+				mods[i] += change
 			}
 		}
 	}
+	for _, elemPos := range delta.Add {
+		addMod(elemPos, 1)
+	}
 	for _, elemPos := range delta.Del {
-		if d.inROI(elemPos.Pos) {
-			i := toIndexedLabel(elemPos)
-			mods[i]--
-			if elemPos.Kind.IsSynaptic() {
-				i = newIndexedLabel(AllSyn, elemPos.Label)
-				mods[i]--
-			}
-		}
+		addMod(elemPos, -1)
 	}
 
 	// d.Lock()
 	// defer d.Unlock()
 
-	// Get old counts for the modified labels.
-	counts, err := d.getCounts(ctx, mods)
-	if err != nil {
-		diagnostic = fmt.Sprintf("labelsz %s couldn't get counts for modified labels: %v\n", d.DataName(), err)
-		dvid.Errorf("labelsz %q couldn't get counts for modified labels: %v\n", d.DataName(), err)
-		successful = false
-	} else {
+	batch := batcher.NewBatch(ctx)
+	for roiName, mods := range roiMods {
+		// Get old counts for the modified labels.
+		counts, err := d.getCounts(ctx, roiName, mods)
+		if err != nil {
+			diagnostic = fmt.Sprintf("labelsz %s couldn't get counts for modified labels: %v\n", d.DataName(), err)
+			dvid.Errorf("labelsz %q couldn't get counts for modified labels: %v\n", d.DataName(), err)
+			successful = false
+			continue
+		}
+
 		// Modify the keys based on the change in counts, then delete or store.
-		batch := batcher.NewBatch(ctx)
 		for il, change := range mods {
 			if change == 0 {
 				continue
@@ -213,7 +247,7 @@ func (d *Data) modifyElements(ctx *datastore.VersionedCtx, delta annotation.Delt
 			// check if we had prior key that needs to be deleted.
 			count, found := counts[il]
 			if found {
-				batch.Delete(NewTypeSizeLabelTKey(i, count, label))
+				batch.Delete(typeSizeLabelTKey(roiName, i, count, label))
 			}
 
 			// add new count
@@ -225,24 +259,23 @@ func (d *Data) modifyElements(ctx *datastore.VersionedCtx, delta annotation.Delt
 
 			// If it's at zero, we've merged or removed it so delete the count.
 			if newcount == 0 {
-				batch.Delete(NewTypeLabelTKey(i, label))
-				batch.Delete(NewTypeSizeLabelTKey(i, newcount, label))
+				batch.Delete(typeLabelTKey(roiName, i, label))
+				batch.Delete(typeSizeLabelTKey(roiName, i, newcount, label))
 				continue
 			}
 
 			// store the data.
 			buf := make([]byte, 4)
 			binary.LittleEndian.PutUint32(buf, newcount)
-			batch.Put(NewTypeLabelTKey(i, label), buf)
-			batch.Put(NewTypeSizeLabelTKey(i, newcount, label), nil)
-		}
-
-		if err := batch.Commit(); err != nil {
-			diagnostic = fmt.Sprintf("bad commit in labelsz %s during sync of modify elements: %v\n", d.DataName(), err)
-			dvid.Criticalf("bad commit in labelsz %q during sync of modify elements: %v\n", d.DataName(), err)
-			successful = false
+			batch.Put(typeLabelTKey(roiName, i, label), buf)
+			batch.Put(typeSizeLabelTKey(roiName, i, newcount, label), nil)
 		}
 	}
+	if err := batch.Commit(); err != nil {
+		diagnostic = fmt.Sprintf("bad commit in labelsz %s during sync of modify elements: %v\n", d.DataName(), err)
+		dvid.Criticalf("bad commit in labelsz %q during sync of modify elements: %v\n", d.DataName(), err)
+		successful = false
+	}
 	if server.KafkaAvailable() {
 		t := time.Since(t0)
 		activity := map[string]interface{}{
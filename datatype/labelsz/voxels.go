@@ -0,0 +1,192 @@
+/*
+	This file supports ranking labels by # voxels using size changes from a synced labelmap.
+*/
+
+package labelsz
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/labelmap"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// maxRankedVoxels is the largest voxel count that can be held by the sorted size keys.
+// Larger bodies are ranked as if they had this many voxels.
+const maxRankedVoxels = math.MaxUint32 - 1
+
+// GetSyncedLabelmap returns the synced labelmap or nil if there is none.
+func (d *Data) GetSyncedLabelmap() *labelmap.Data {
+	for dataUUID := range d.SyncedData() {
+		source, err := datastore.GetDataByDataUUID(dataUUID)
+		if err != nil {
+			dvid.Errorf("Got error accessing synced data %s: %v\n", dataUUID, err)
+			continue
+		}
+		if lm, ok := source.(*labelmap.Data); ok {
+			return lm
+		}
+	}
+	return nil
+}
+
+// rankedVoxels returns the size stored in sorted size keys for the given # voxels.
+func rankedVoxels(numVoxels uint64) uint32 {
+	if numVoxels > maxRankedVoxels {
+		return maxRankedVoxels
+	}
+	return uint32(numVoxels)
+}
+
+// decodeCount returns the count stored for a label and index type.  Voxel counts are
+// stored as 8 bytes while annotation counts are stored as 4 bytes.
+func decodeCount(i IndexType, val []byte) (uint64, error) {
+	if i == Voxels {
+		if len(val) != 8 {
+			return 0, fmt.Errorf("bad size in value for index type %s: value has length %d", i, len(val))
+		}
+		return binary.LittleEndian.Uint64(val), nil
+	}
+	if len(val) != 4 {
+		return 0, fmt.Errorf("bad size in value for index type %s: value has length %d", i, len(val))
+	}
+	return uint64(binary.LittleEndian.Uint32(val)), nil
+}
+
+// getVoxels returns the stored # voxels for a label and whether it was found.
+func (d *Data) getVoxels(ctx *datastore.VersionedCtx, store storage.OrderedKeyValueDB, label uint64) (uint64, bool, error) {
+	val, err := store.Get(ctx, NewTypeLabelTKey(Voxels, label))
+	if err != nil {
+		return 0, false, err
+	}
+	if val == nil {
+		return 0, false, nil
+	}
+	numVoxels, err := decodeCount(Voxels, val)
+	if err != nil {
+		return 0, false, fmt.Errorf("label %d: %v", label, err)
+	}
+	return numVoxels, true, nil
+}
+
+// putVoxels adds to the batch the changes necessary to go from an old # voxels for a label
+// to a new # voxels.  A zero new # voxels removes the label from the rankings.
+func putVoxels(batch storage.Batch, label uint64, oldVoxels uint64, oldFound bool, newVoxels uint64) {
+	if oldFound {
+		batch.Delete(NewTypeSizeLabelTKey(Voxels, rankedVoxels(oldVoxels), label))
+	}
+	if newVoxels == 0 {
+		batch.Delete(NewTypeLabelTKey(Voxels, label))
+		return
+	}
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, newVoxels)
+	batch.Put(NewTypeLabelTKey(Voxels, label), buf)
+	batch.Put(NewTypeSizeLabelTKey(Voxels, rankedVoxels(newVoxels), label), nil)
+}
+
+// voxelChange is either an absolute # voxels for a label or a change to its current # voxels.
+type voxelChange struct {
+	absolute bool
+	voxels   int64
+}
+
+// modifyVoxels updates the voxel rankings given a size-related delta from a synced labelmap.
+func (d *Data) modifyVoxels(ctx *datastore.VersionedCtx, delta interface{}, batcher storage.KeyValueBatcher) {
+	t0 := time.Now()
+	mutation := fmt.Sprintf("voxel sync of labelsz %s", d.DataName())
+	var diagnostic string
+	successful := true
+
+	changes := make(map[uint64]voxelChange)
+	switch delta := delta.(type) {
+	case labels.DeltaNewSize:
+		changes[delta.Label] = voxelChange{absolute: true, voxels: int64(delta.Size)}
+	case labels.DeltaModSize:
+		changes[delta.Label] = voxelChange{voxels: delta.SizeChange}
+	case labels.DeltaMerge:
+		for merged := range delta.Merged {
+			changes[merged] = voxelChange{absolute: true}
+		}
+		changes[delta.Target] = voxelChange{absolute: true, voxels: int64(delta.TargetVoxels + delta.MergedVoxels)}
+	case labels.DeltaSplit:
+		changes[delta.NewLabel] = voxelChange{absolute: true, voxels: int64(delta.SplitVoxels)}
+		changes[delta.OldLabel] = voxelChange{voxels: -int64(delta.SplitVoxels)}
+	default:
+		dvid.Criticalf("labelsz %q got unexpected delta for voxel sync: %v\n", d.DataName(), delta)
+		return
+	}
+
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		dvid.Errorf("labelsz %q couldn't get store: %v\n", d.DataName(), err)
+		return
+	}
+	batch := batcher.NewBatch(ctx)
+	for label, change := range changes {
+		oldVoxels, found, err := d.getVoxels(ctx, store, label)
+		if err != nil {
+			diagnostic = fmt.Sprintf("labelsz %s couldn't get voxels for label %d: %v\n", d.DataName(), label, err)
+			dvid.Errorf("labelsz %q couldn't get voxels for label %d: %v\n", d.DataName(), label, err)
+			successful = false
+			continue
+		}
+		var newVoxels uint64
+		switch {
+		case change.absolute:
+			newVoxels = uint64(change.voxels)
+		case change.voxels < 0 && uint64(-change.voxels) > oldVoxels:
+			dvid.Criticalf("labelsz %q received size change that would subtract %d voxels with only %d for label %d!  Setting floor at 0.\n", d.DataName(), -change.voxels, oldVoxels, label)
+		default:
+			newVoxels = uint64(int64(oldVoxels) + change.voxels)
+		}
+		if found || newVoxels != 0 {
+			putVoxels(batch, label, oldVoxels, found, newVoxels)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		diagnostic = fmt.Sprintf("bad commit in labelsz %s during voxel sync: %v\n", d.DataName(), err)
+		dvid.Criticalf("bad commit in labelsz %q during voxel sync: %v\n", d.DataName(), err)
+		successful = false
+	}
+	if server.KafkaAvailable() {
+		t := time.Since(t0)
+		activity := map[string]interface{}{
+			"time":       t0.Unix(),
+			"duration":   t.Seconds() * 1000.0,
+			"mutation":   mutation,
+			"successful": successful,
+		}
+		if diagnostic != "" {
+			activity["diagnostic"] = diagnostic
+		}
+		storage.LogActivityToKafka(activity)
+	}
+}
+
+// resyncVoxels repopulates the voxel rankings from the label indices of a synced labelmap.
+func (d *Data) resyncVoxels(ctx *datastore.VersionedCtx, lm *labelmap.Data, writerCh chan<- *storage.TKeyValue) (numLabels uint64, err error) {
+	timedLog := dvid.NewTimeLog()
+	err = labelmap.ProcessLabelSizes(lm, ctx.VersionID(), func(label, numVoxels uint64) error {
+		if label == 0 || numVoxels == 0 {
+			return nil
+		}
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, numVoxels)
+		writerCh <- &storage.TKeyValue{K: NewTypeLabelTKey(Voxels, label), V: buf}
+		writerCh <- &storage.TKeyValue{K: NewTypeSizeLabelTKey(Voxels, rankedVoxels(numVoxels), label)}
+		numLabels++
+		if numLabels%10000 == 0 {
+			timedLog.Infof("Reloading labelsz %q voxels: %d labels processed", d.DataName(), numLabels)
+		}
+		return nil
+	})
+	return
+}
@@ -50,6 +50,23 @@ func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
 	return "unknown neuronjson key"
 }
 
+// DescribeTKey returns a human-readable description of a type-specific key, e.g., the body id
+// of an annotation.  Implements the datastore.TKeyDescriber interface.
+func (d *Data) DescribeTKey(tk storage.TKey) (string, error) {
+	class, err := tk.Class()
+	if err != nil {
+		return "", err
+	}
+	if class != keyAnnotation {
+		return d.DescribeTKeyClass(class), nil
+	}
+	bodyid, err := DecodeTKey(tk)
+	if err != nil {
+		return "", err
+	}
+	return "body " + bodyid, nil
+}
+
 // NewTKey returns a TKey for the annotation kv pairs.
 func NewTKey(key string) (storage.TKey, error) {
 	return storage.NewTKey(keyAnnotation, append([]byte(key), 0)), nil
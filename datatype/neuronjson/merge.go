@@ -0,0 +1,88 @@
+/*
+	This file supports type-specific automatic merging of neuronjson versions.
+*/
+
+package neuronjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/keyvalue"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// ResolveConflict implements the datastore.AutoMerger interface.  Annotations modified in
+// more than one parent are merged field by field, with fields changed in earlier parents
+// taking priority.  A body annotation deleted in the highest priority parent that changed
+// it is deleted in the child.  Schemas are taken whole from the highest priority parent.
+func (d *Data) ResolveConflict(ctx *datastore.VersionedCtx, c *datastore.MergeConflict) ([]byte, error) {
+	class, err := c.TKey.Class()
+	if err != nil {
+		return nil, err
+	}
+	if class != keyAnnotation {
+		return c.PriorityValue(), nil
+	}
+	var base map[string]json.RawMessage
+	if c.Base != nil {
+		if err := json.Unmarshal(c.Base, &base); err != nil {
+			return nil, fmt.Errorf("unable to decode base annotation: %v", err)
+		}
+	}
+	annotations := make([]map[string]json.RawMessage, len(c.Values))
+	for i, value := range c.Values {
+		if value == nil {
+			return c.PriorityValue(), nil
+		}
+		if err := json.Unmarshal(value, &(annotations[i])); err != nil {
+			return nil, fmt.Errorf("unable to decode annotation from parent %d: %v", i, err)
+		}
+	}
+	return json.Marshal(keyvalue.MergeJSONObjects(base, annotations))
+}
+
+// MergeComplete implements the datastore.AutoMerger interface.  If an in-memory db
+// tracks the merged child version, it is reloaded from the stored annotations.
+func (d *Data) MergeComplete(ctx *datastore.VersionedCtx, parents []dvid.VersionID) error {
+	v := ctx.VersionID()
+	mdb, found := d.getMemDBbyVersion(v)
+	if !found {
+		return nil
+	}
+	fresh := &memdb{
+		data:   make(map[uint64]NeuronJSON),
+		fields: make(map[string]struct{}),
+		ids:    []uint64{},
+	}
+	if err := d.loadMemDB(v, fresh); err != nil {
+		return err
+	}
+	mdb.mu.Lock()
+	mdb.data = fresh.data
+	mdb.ids = fresh.ids
+	mdb.fields = fresh.fields
+	mdb.mu.Unlock()
+	return nil
+}
+
+// ManifestKey implements the datastore.ManifestKeyer interface so merge manifests can
+// select parents by body id or key range.  Schema keys have no manifest key.
+func (d *Data) ManifestKey(tk storage.TKey) (datastore.ManifestKey, error) {
+	class, err := tk.Class()
+	if err != nil || class != keyAnnotation {
+		return datastore.ManifestKey{}, err
+	}
+	key, err := DecodeTKey(tk)
+	if err != nil {
+		return datastore.ManifestKey{}, err
+	}
+	mkey := datastore.ManifestKey{Key: key}
+	if bodyid, err := strconv.ParseUint(key, 10, 64); err == nil {
+		mkey.Label = bodyid
+	}
+	return mkey, nil
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"encoding/gob"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
@@ -495,8 +496,8 @@ POST <api URL>/node/<UUID>/<data name>/keyvalues[?query-options]
 	replace		If "true" will remove any fields not present
 
 
-GET <api URL>/node/<UUID>/<data name>/query[?show=...]
-POST <api URL>/node/<UUID>/<data name>/query[?show=...]
+GET <api URL>/node/<UUID>/<data name>/query[?show=...&sort=...&offset=...&limit=...]
+POST <api URL>/node/<UUID>/<data name>/query[?show=...&sort=...&offset=...&limit=...]
 
 	Both GET and POST methods are permitted to launch queries, however the
 	POST method is deprecated because it will be blocked for committed versions.
@@ -510,12 +511,27 @@ POST <api URL>/node/<UUID>/<data name>/query[?show=...]
 
 	A JSON list of objects that matches the query is returned in ascending order of body ID.
 
-	Query fields can include two special types of values:
+	Query fields can include special types of values:
 	1. Regular expressions: a string value that starts with "re/" is treated as a regex with
 	   the remainder of the string being the regex.  The regex is anchored to the beginning.
 	2. Field existence: a string value that starts with "exists/" checks if a field exists.
 	   If "exists/0" is specified, the field must not exist or be set to null.  If "exists/1" 
 	   is specified, the field must exist.
+	3. Operators: a JSON object with a single operator key.  Because operators are objects,
+	   string values are always compared literally (except for the above prefixes).
+	   {"lt": N}, {"le": N}, {"gt": N}, {"ge": N} match numbers less than, less than or
+	   equal, greater than, or greater than or equal to N.
+	   {"between": [A, B]} matches numbers from A to B inclusive.
+	   {"contains": "text"} matches strings that contain the text regardless of case.
+	   {"not": term} matches if the term, which can be a value, regex, operator, or list,
+	   doesn't match.  Annotations without the field also match.
+	If a field has a list of values, the query matches if any of the values match.
+
+	A list of values for a query field matches if any of the values match, i.e., the values
+	are ORed together.  Operators can be mixed with values in a list.
+	Example:
+	{ "class": ["9A", {"contains": "interneuron"}], "position": {"between": [100, 150]},
+	  "tags": {"not": "group3"} }
 
 	Arguments:
 
@@ -526,6 +542,15 @@ POST <api URL>/node/<UUID>/<data name>/query[?show=...]
 
 	onlyid		If true (false by default), will only return a list of body ids that match.
 
+	sort		Sort the results on this list of field names separated by commas.  A field name
+				prefixed by "-" is sorted in descending order.  Lists are sorted by their first
+				element and annotations without the field are placed last.
+				Example: ?sort=class,-bodyid
+
+	offset		Skip this number of matching annotations (default 0).
+
+	limit		Return at most this number of matching annotations (default no limit).
+
 	show		If "user", shows *_user fields.
 				If "time", shows *_time fields.
 				If "all", shows both *_user and *_time fields.
@@ -936,8 +961,12 @@ func (d *Data) processStoreKeysInRange(ctx storage.Context, minTKey, maxTKey sto
 	return nil
 }
 
-// process a range of key-value pairs using supplied function.
-func (d *Data) processStoreRange(ctx storage.Context, f func(key string, value NeuronJSON)) error {
+// errStopRange is returned by range functions to end a range early.
+var errStopRange = errors.New("neuronjson: range stopped")
+
+// process a range of key-value pairs using supplied function.  If the function returns
+// errStopRange, the range ends without error.
+func (d *Data) processStoreRange(ctx storage.Context, f func(key string, value NeuronJSON) error) error {
 	db, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
 		return err
@@ -960,9 +989,11 @@ func (d *Data) processStoreRange(ctx storage.Context, f func(key string, value N
 		if err := value.UnmarshalJSON(kv.V); err != nil {
 			return err
 		}
-		f(key, value)
-		return nil
+		return f(key, value)
 	})
+	if err == errStopRange {
+		return nil
+	}
 	return err
 }
 
@@ -1126,11 +1157,12 @@ func (d *Data) GetAll(ctx storage.VersionedCtx, fieldMap map[string]struct{}, sh
 		}
 		mdb.mu.RUnlock()
 	} else {
-		process_func := func(key string, value NeuronJSON) {
+		process_func := func(key string, value NeuronJSON) error {
 			out := selectFields(value, fieldMap, showUser, showTime)
 			if len(out) > 1 {
 				all = append(all, out)
 			}
+			return nil
 		}
 		if err := d.processStoreRange(ctx, process_func); err != nil {
 			return nil, err
@@ -2078,11 +2110,15 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			return
 		}
 		onlyid := r.URL.Query().Get("onlyid") == "true"
-		err := d.Query(ctx, w, uuid, onlyid, fieldMap(r), showFields(r), r.Body)
+		opts, err := getQueryOptions(r)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
 		}
+		if err = d.Query(ctx, w, uuid, onlyid, opts, fieldMap(r), showFields(r), r.Body); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
 
 	case "keyrange":
 		if len(parts) < 6 {
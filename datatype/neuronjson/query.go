@@ -1,12 +1,14 @@
 package neuronjson
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	reflect "reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -20,9 +22,250 @@ type ListQueryJSON []QueryJSON
 
 type FieldExistence bool // field is present or not
 
+// queryNumber is a numeric query bound.  Integral bounds are kept as integers so large
+// values like body IDs above 2^53 are compared exactly.
+type queryNumber struct {
+	isInt bool
+	i     int64
+	f     float64
+}
+
+// parseQueryNumber parses a JSON number, keeping integers exact.  Integers above the
+// int64 range are converted like uint64 field values.
+func parseQueryNumber(jsonText []byte) (n queryNumber, err error) {
+	var num json.Number
+	text := bytes.TrimSpace(jsonText)
+	if len(text) == 0 || text[0] == '"' || json.Unmarshal(text, &num) != nil {
+		return n, fmt.Errorf("expected number, got %s", string(jsonText))
+	}
+	if i, err := strconv.ParseInt(string(num), 10, 64); err == nil {
+		return queryNumber{isInt: true, i: i}, nil
+	}
+	if u, err := strconv.ParseUint(string(num), 10, 64); err == nil {
+		return queryNumber{isInt: true, i: int64(u)}, nil
+	}
+	f, err := num.Float64()
+	if err != nil {
+		return n, fmt.Errorf("bad number %s: %v", string(jsonText), err)
+	}
+	return queryNumber{f: f}, nil
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// returns -1, 0, or 1 if the integer field value is less than, equal to, or greater
+// than the bound.
+func (n queryNumber) compareInt(x int64) int {
+	if !n.isInt {
+		return compareFloats(float64(x), n.f)
+	}
+	switch {
+	case x < n.i:
+		return -1
+	case x > n.i:
+		return 1
+	}
+	return 0
+}
+
+// returns -1, 0, or 1 if the non-integral field value is less than, equal to, or greater
+// than the bound.
+func (n queryNumber) compareFloat(x float64) int {
+	if n.isInt {
+		return compareFloats(x, float64(n.i))
+	}
+	return compareFloats(x, n.f)
+}
+
+// returns -1, 0, or 1 if the number is less than, equal to, or greater than the bound.
+func (n queryNumber) compareTo(bound queryNumber) int {
+	if n.isInt {
+		return bound.compareInt(n.i)
+	}
+	return bound.compareFloat(n.f)
+}
+
+// queryComparison matches numeric field values against a bound or an inclusive range.
+type queryComparison struct {
+	op  string // "eq", "lt", "le", "gt", "ge", or "between"
+	val queryNumber
+	max queryNumber // upper bound for "between"
+}
+
+// match returns true if a field value satisfies the comparison given the results of
+// comparing it to the bound and, for "between", the upper bound.
+func (qc queryComparison) match(cmpVal, cmpMax int) bool {
+	switch qc.op {
+	case "eq":
+		return cmpVal == 0
+	case "lt":
+		return cmpVal < 0
+	case "le":
+		return cmpVal <= 0
+	case "gt":
+		return cmpVal > 0
+	case "ge":
+		return cmpVal >= 0
+	case "between":
+		return cmpVal >= 0 && cmpMax <= 0
+	}
+	return false
+}
+
+func (qc queryComparison) matchInt(x int64) bool {
+	return qc.match(qc.val.compareInt(x), qc.max.compareInt(x))
+}
+
+func (qc queryComparison) matchFloat(x float64) bool {
+	return qc.match(qc.val.compareFloat(x), qc.max.compareFloat(x))
+}
+
+// querySubstring is a lower-cased string that matches field values containing it
+// regardless of case.
+type querySubstring string
+
+// queryNegation matches if its term doesn't match any of the field values.
+type queryNegation struct {
+	term interface{}
+}
+
+// parseQueryString returns a compiled regular expression if the string starts with "re/"
+// followed by a valid regex, else the string itself.
+func parseQueryString(s string) interface{} {
+	if len(s) > 3 && strings.HasPrefix(s, "re/") {
+		if re, err := regexp.Compile(s[3:]); err == nil {
+			return re
+		}
+	}
+	return s
+}
+
+// parseQueryOperator parses a query operator object with a single operator key:
+// numeric comparisons {"lt": N}, {"le": N}, {"gt": N}, {"ge": N}, an inclusive range
+// {"between": [A, B]}, case-insensitive substring search {"contains": "text"}, or
+// negation {"not": term} where the term is a number, string, operator object, or list
+// of these.
+func parseQueryOperator(jsonText []byte) (term interface{}, err error) {
+	var obj map[string]json.RawMessage
+	if err = json.Unmarshal(jsonText, &obj); err != nil {
+		return nil, err
+	}
+	if len(obj) != 1 {
+		return nil, fmt.Errorf("query operator %s must have exactly one operator", string(jsonText))
+	}
+	for op, val := range obj {
+		switch op {
+		case "lt", "le", "gt", "ge":
+			var n queryNumber
+			if n, err = parseQueryNumber(val); err != nil {
+				return nil, fmt.Errorf("bad number for %q operator: %s", op, string(val))
+			}
+			return queryComparison{op: op, val: n}, nil
+		case "between":
+			var rawBounds []json.RawMessage
+			if err = json.Unmarshal(val, &rawBounds); err != nil || len(rawBounds) != 2 {
+				return nil, fmt.Errorf("expected list of two numbers for \"between\" operator: %s", string(val))
+			}
+			bounds := make([]queryNumber, 2)
+			for i, raw := range rawBounds {
+				if bounds[i], err = parseQueryNumber(raw); err != nil {
+					return nil, fmt.Errorf("expected list of two numbers for \"between\" operator: %s", string(val))
+				}
+			}
+			if bounds[0].compareTo(bounds[1]) > 0 {
+				return nil, fmt.Errorf("minimum is larger than maximum in \"between\" operator: %s", string(val))
+			}
+			return queryComparison{op: "between", val: bounds[0], max: bounds[1]}, nil
+		case "contains":
+			var str string
+			if err = json.Unmarshal(val, &str); err != nil {
+				return nil, fmt.Errorf("expected string for \"contains\" operator: %s", string(val))
+			}
+			return querySubstring(strings.ToLower(str)), nil
+		case "not":
+			var inner interface{}
+			if inner, err = parseQueryElement(val); err != nil {
+				return nil, err
+			}
+			return queryNegation{term: inner}, nil
+		default:
+			return nil, fmt.Errorf("unknown query operator %q", op)
+		}
+	}
+	return nil, nil
+}
+
+// parseQueryElement parses a number, a string with optional "re/" prefix, an operator
+// object, or a list of these.
+func parseQueryElement(jsonText []byte) (term interface{}, err error) {
+	text := bytes.TrimSpace(jsonText)
+	if len(text) == 0 {
+		return nil, fmt.Errorf("empty query value")
+	}
+	switch text[0] {
+	case '{':
+		return parseQueryOperator(text)
+	case '"':
+		var str string
+		if err = json.Unmarshal(text, &str); err != nil {
+			return nil, err
+		}
+		return parseQueryString(str), nil
+	case '[':
+		var rawlist []json.RawMessage
+		if err = json.Unmarshal(text, &rawlist); err != nil {
+			return nil, err
+		}
+		terms := make([]interface{}, len(rawlist))
+		for i, raw := range rawlist {
+			if terms[i], err = parseQueryElement(raw); err != nil {
+				return nil, err
+			}
+		}
+		return terms, nil
+	}
+	var n queryNumber
+	if n, err = parseQueryNumber(text); err != nil {
+		return nil, fmt.Errorf("unable to parse query value %s", string(text))
+	}
+	return queryComparison{op: "eq", val: n}, nil
+}
+
+// hasQueryOperator returns true if the JSON value is an operator object or a list
+// containing one.
+func hasQueryOperator(jsonText []byte) bool {
+	text := bytes.TrimSpace(jsonText)
+	if len(text) == 0 {
+		return false
+	}
+	if text[0] == '{' {
+		return true
+	}
+	if text[0] == '[' {
+		var rawlist []json.RawMessage
+		if err := json.Unmarshal(text, &rawlist); err == nil {
+			for _, raw := range rawlist {
+				if raw = bytes.TrimSpace(raw); len(raw) != 0 && raw[0] == '{' {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 // UnmarshalJSON parses JSON with numbers preferentially converted to uint64
 // or int64 if negative, and strings with "re/" as prefix are compiled as
-// a regular expression.
+// a regular expression.  Operator objects like {"gt": 300} or lists containing
+// them are parsed by parseQueryElement.
 func (qj *QueryJSON) UnmarshalJSON(jsonText []byte) error {
 	var raw map[string]json.RawMessage
 	if err := json.Unmarshal([]byte(jsonText), &raw); err != nil {
@@ -69,19 +312,22 @@ func (qj *QueryJSON) UnmarshalJSON(jsonText []byte) error {
 			}
 			continue
 		}
+		if hasQueryOperator(val) {
+			term, err := parseQueryElement(val)
+			if err != nil {
+				return fmt.Errorf("bad query on field %q: %v", key, err)
+			}
+			(*qj)[key] = term
+			continue
+		}
 		var strlist []string
 		if err = json.Unmarshal(val, &strlist); err == nil {
 			hasRegex := false
 			iflist := make([]interface{}, len(strlist))
 			for i, s := range strlist {
-				if len(s) > 3 && strings.HasPrefix(s, "re/") {
+				iflist[i] = parseQueryString(s)
+				if _, isRegex := iflist[i].(*regexp.Regexp); isRegex {
 					hasRegex = true
-					if re, err := regexp.Compile(s[3:]); err == nil {
-						iflist[i] = re
-					}
-				}
-				if iflist[i] == nil {
-					iflist[i] = s
 				}
 			}
 			if hasRegex {
@@ -190,8 +436,12 @@ func checkField(queryValue, fieldValue interface{}) bool {
 	if len(fieldNumList) == 0 && len(fieldStrList) == 0 && len(fieldFloatList) == 0 {
 		return false
 	}
+	return checkTerm(queryValue, fieldNumList, fieldFloatList, fieldStrList)
+}
 
-	// convert query value to list of types as above for field value.
+// returns true if the query value, which can be a list of ORed terms, matches any of the
+// field values.
+func checkTerm(queryValue interface{}, fieldNumList []int64, fieldFloatList []float64, fieldStrList []string) bool {
 	switch v := queryValue.(type) {
 	case int64:
 		if checkIntMatch(v, fieldNumList) {
@@ -213,6 +463,17 @@ func checkField(queryValue, fieldValue interface{}) bool {
 				return true
 			}
 		}
+	case int:
+		if checkIntMatch(int64(v), fieldNumList) {
+			return true
+		}
+	case float64:
+		if v == float64(int64(v)) && checkIntMatch(int64(v), fieldNumList) {
+			return true
+		}
+		if checkFloatMatch(v, fieldFloatList) {
+			return true
+		}
 	case string:
 		if checkStrMatch(v, fieldStrList) {
 			return true
@@ -227,37 +488,30 @@ func checkField(queryValue, fieldValue interface{}) bool {
 		if checkRegexMatch(v, fieldStrList) {
 			return true
 		}
-	case []interface{}:
-		elem := v[0]
-		switch e := elem.(type) {
-		case int:
-			for _, val := range v {
-				if checkIntMatch(int64(val.(int)), fieldNumList) {
-					return true
-				}
+	case queryComparison:
+		for _, i := range fieldNumList {
+			if v.matchInt(i) {
+				return true
 			}
-		case float64:
-			for _, val := range v {
-				if checkFloatMatch(val.(float64), fieldFloatList) {
-					return true
-				}
+		}
+		for _, f := range fieldFloatList {
+			if v.matchFloat(f) {
+				return true
 			}
-		case string, *regexp.Regexp:
-			for _, val := range v {
-				switch query := val.(type) {
-				case string:
-					if checkStrMatch(query, fieldStrList) {
-						return true
-					}
-				case *regexp.Regexp:
-					if checkRegexMatch(query, fieldStrList) {
-						return true
-					}
-				}
+		}
+	case querySubstring:
+		for _, fieldValue := range fieldStrList {
+			if strings.Contains(strings.ToLower(fieldValue), string(v)) {
+				return true
+			}
+		}
+	case queryNegation:
+		return !checkTerm(v.term, fieldNumList, fieldFloatList, fieldStrList)
+	case []interface{}:
+		for _, term := range v {
+			if checkTerm(term, fieldNumList, fieldFloatList, fieldStrList) {
+				return true
 			}
-		default:
-			var t = reflect.TypeOf(e)
-			dvid.Errorf("neuronjson query value %v has elements of illegal type %v\n", v, t)
 		}
 	default:
 		var t = reflect.TypeOf(v)
@@ -266,6 +520,22 @@ func checkField(queryValue, fieldValue interface{}) bool {
 	return false
 }
 
+// returns true if the query value matches records without the field, i.e., it's a
+// negation or a list of terms with a negation.
+func matchesMissingField(queryValue interface{}) bool {
+	switch v := queryValue.(type) {
+	case queryNegation:
+		return true
+	case []interface{}:
+		for _, term := range v {
+			if _, isNegation := term.(queryNegation); isNegation {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func fieldMatch(queryValue, fieldValue interface{}) bool {
 	if queryValue == nil {
 		return false
@@ -325,7 +595,11 @@ func queryMatch(queryList ListQueryJSON, value map[string]interface{}) (matches
 				}
 			default:
 				// if field exists, check if it matches query
-				if !found || !fieldMatch(queryValue, recordValue) {
+				if !found || recordValue == nil {
+					if !matchesMissingField(queryValue) {
+						and_match = false
+					}
+				} else if !fieldMatch(queryValue, recordValue) {
 					and_match = false
 				}
 			}
@@ -340,64 +614,213 @@ func queryMatch(queryList ListQueryJSON, value map[string]interface{}) (matches
 	return false, nil
 }
 
-func (d *Data) queryInMemory(mdb *memdb, w http.ResponseWriter, queryL ListQueryJSON, fieldMap map[string]struct{}, showFields Fields) (err error) {
+// QueryOptions control the ordering and pagination of query results.
+type QueryOptions struct {
+	Sort   []string // fields to sort on, each with optional "-" prefix for descending order
+	Offset int      // number of matching annotations to skip
+	Limit  int      // maximum number of annotations to return, or 0 for no limit
+}
+
+// parses the "sort", "offset", and "limit" query strings.
+func getQueryOptions(r *http.Request) (opts QueryOptions, err error) {
+	queryStrings := r.URL.Query()
+	if sortStr := queryStrings.Get("sort"); sortStr != "" {
+		for _, field := range strings.Split(sortStr, ",") {
+			if field = strings.TrimSpace(field); field != "" && field != "-" {
+				opts.Sort = append(opts.Sort, field)
+			}
+		}
+	}
+	if offsetStr := queryStrings.Get("offset"); offsetStr != "" {
+		if opts.Offset, err = strconv.Atoi(offsetStr); err != nil || opts.Offset < 0 {
+			return opts, fmt.Errorf("bad offset %q, must be non-negative integer", offsetStr)
+		}
+	}
+	if limitStr := queryStrings.Get("limit"); limitStr != "" {
+		if opts.Limit, err = strconv.Atoi(limitStr); err != nil || opts.Limit < 0 {
+			return opts, fmt.Errorf("bad limit %q, must be non-negative integer", limitStr)
+		}
+	}
+	return opts, nil
+}
+
+// returns a numeric or string value for sorting on a field, using the first element
+// of list values.  The kind is 0 for numbers, 1 for strings, and 2 if missing.
+func getSortValue(value NeuronJSON, field string) (num float64, str string, kind int) {
+	switch v := value[field].(type) {
+	case uint64:
+		return float64(v), "", 0
+	case int64:
+		return float64(v), "", 0
+	case float64:
+		return v, "", 0
+	case string:
+		return 0, v, 1
+	case []int64:
+		if len(v) != 0 {
+			return float64(v[0]), "", 0
+		}
+	case []uint64:
+		if len(v) != 0 {
+			return float64(v[0]), "", 0
+		}
+	case []string:
+		if len(v) != 0 {
+			return 0, v[0], 1
+		}
+	}
+	return 0, "", 2
+}
+
+// returns true if annotation a should be ordered before b given the sort fields.
+// Annotations missing a sort field are placed last regardless of sort direction.
+func sortedBefore(a, b NeuronJSON, sortFields []string) bool {
+	for _, field := range sortFields {
+		descending := strings.HasPrefix(field, "-")
+		field = strings.TrimPrefix(field, "-")
+		numA, strA, kindA := getSortValue(a, field)
+		numB, strB, kindB := getSortValue(b, field)
+		if kindA != kindB {
+			return kindA < kindB
+		}
+		var cmp int
+		switch {
+		case kindA == 0 && numA < numB, kindA == 1 && strA < strB:
+			cmp = -1
+		case kindA == 0 && numA > numB, kindA == 1 && strA > strB:
+			cmp = 1
+		}
+		if descending {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+	}
+	return false
+}
+
+type queryResult struct {
+	value NeuronJSON // matching annotation used for sorting
+	out   NeuronJSON // annotation with the fields to be returned
+}
+
+// queryResults writes matching annotations as comma-separated JSON after applying the
+// query options.  If sorting is requested, matches are held until flush().
+type queryResults struct {
+	w    io.Writer
+	opts QueryOptions
+
+	numMatches int
+	numWritten int
+	held       []queryResult
+}
+
+func newQueryResults(w io.Writer, opts QueryOptions) *queryResults {
+	return &queryResults{w: w, opts: opts}
+}
+
+// done returns true if no more matches can be written.
+func (qr *queryResults) done() bool {
+	return len(qr.opts.Sort) == 0 && qr.opts.Limit > 0 && qr.numWritten >= qr.opts.Limit
+}
+
+// add writes or, if sorting, holds a matching annotation and its output form.
+func (qr *queryResults) add(value, out NeuronJSON) error {
+	if len(qr.opts.Sort) != 0 {
+		qr.held = append(qr.held, queryResult{value, out})
+		return nil
+	}
+	return qr.write(out)
+}
+
+func (qr *queryResults) write(out NeuronJSON) error {
+	qr.numMatches++
+	if qr.numMatches <= qr.opts.Offset || (qr.opts.Limit > 0 && qr.numWritten >= qr.opts.Limit) {
+		return nil
+	}
+	jsonBytes, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	if qr.numWritten > 0 {
+		fmt.Fprint(qr.w, ",")
+	}
+	fmt.Fprint(qr.w, string(jsonBytes))
+	qr.numWritten++
+	return nil
+}
+
+// flush writes any matches held for sorting.
+func (qr *queryResults) flush() error {
+	if len(qr.held) == 0 {
+		return nil
+	}
+	sort.SliceStable(qr.held, func(i, j int) bool {
+		return sortedBefore(qr.held[i].value, qr.held[j].value, qr.opts.Sort)
+	})
+	for _, result := range qr.held {
+		if err := qr.write(result.out); err != nil {
+			return err
+		}
+	}
+	qr.held = nil
+	return nil
+}
+
+func (d *Data) queryInMemory(mdb *memdb, results *queryResults, queryL ListQueryJSON, fieldMap map[string]struct{}, showFields Fields) (err error) {
 	mdb.mu.RLock()
 	defer mdb.mu.RUnlock()
 
 	dvid.Infof("in-memory query using mdb with queryL: %v\n", queryL)
 	showUser, showTime := showFields.Bools()
-	numMatches := 0
-	var jsonBytes []byte
 	for _, bodyid := range mdb.ids {
+		if results.done() {
+			break
+		}
 		value := mdb.data[bodyid]
 		var matches bool
 		if matches, err = queryMatch(queryL, value); err != nil {
 			return
 		} else if matches {
 			out := selectFields(value, fieldMap, showUser, showTime)
-			if jsonBytes, err = json.Marshal(out); err != nil {
-				break
+			if err = results.add(value, out); err != nil {
+				return
 			}
-			if numMatches > 0 {
-				fmt.Fprint(w, ",")
-			}
-			fmt.Fprint(w, string(jsonBytes))
-			numMatches++
 		}
 	}
-	return
+	return results.flush()
 }
 
-func (d *Data) queryBackingStore(ctx storage.VersionedCtx, w http.ResponseWriter,
+func (d *Data) queryBackingStore(ctx storage.VersionedCtx, results *queryResults,
 	queryL ListQueryJSON, fieldMap map[string]struct{}, showFields Fields) (err error) {
 
 	dvid.Infof("store query using mdb with queryL: %v\n", queryL)
-	numMatches := 0
-	process_func := func(key string, value NeuronJSON) {
+	process_func := func(key string, value NeuronJSON) error {
 		value = NeuronJSON(value)
 		if matches, err := queryMatch(queryL, value); err != nil {
-			dvid.Errorf("error in matching process: %v\n", err) // TODO: alter d.processRange to allow return of err
-			return
+			dvid.Errorf("error in matching process: %v\n", err)
+			return nil
 		} else if !matches {
-			return
+			return nil
 		}
 		out := removeReservedFields(value, showFields)
-		jsonBytes, err := json.Marshal(out)
-		if err != nil {
+		if err := results.add(value, out); err != nil {
 			dvid.Errorf("error in JSON encoding: %v\n", err)
-			return
 		}
-		if numMatches > 0 {
-			fmt.Fprint(w, ",")
+		if results.done() {
+			return errStopRange
 		}
-		fmt.Fprint(w, string(jsonBytes))
-		numMatches++
+		return nil
+	}
+	if err = d.processStoreRange(ctx, process_func); err != nil {
+		return
 	}
-	return d.processStoreRange(ctx, process_func)
+	return results.flush()
 }
 
 // Query reads POSTed data and returns JSON.
-func (d *Data) Query(ctx *datastore.VersionedCtx, w http.ResponseWriter, uuid dvid.UUID, onlyid bool, fieldMap map[string]struct{}, showFields Fields, in io.ReadCloser) (err error) {
+func (d *Data) Query(ctx *datastore.VersionedCtx, w http.ResponseWriter, uuid dvid.UUID, onlyid bool, opts QueryOptions, fieldMap map[string]struct{}, showFields Fields, in io.ReadCloser) (err error) {
 	var queryBytes []byte
 	if queryBytes, err = io.ReadAll(in); err != nil {
 		return
@@ -426,13 +849,14 @@ func (d *Data) Query(ctx *datastore.VersionedCtx, w http.ResponseWriter, uuid dv
 	}
 	w.Header().Set("Content-Type", "application/json")
 	fmt.Fprint(w, "[")
+	results := newQueryResults(w, opts)
 	mdb, found := d.getMemDBbyVersion(ctx.VersionID())
 	if found {
-		if err = d.queryInMemory(mdb, w, queryL, fieldMap, showFields); err != nil {
+		if err = d.queryInMemory(mdb, results, queryL, fieldMap, showFields); err != nil {
 			return
 		}
 	} else {
-		if err = d.queryBackingStore(ctx, w, queryL, fieldMap, showFields); err != nil {
+		if err = d.queryBackingStore(ctx, results, queryL, fieldMap, showFields); err != nil {
 			return
 		}
 	}
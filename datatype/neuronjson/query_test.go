@@ -2,10 +2,14 @@ package neuronjson
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 )
 
@@ -68,3 +72,208 @@ func TestQueryBodyIDs(t *testing.T) {
 		t.Fatalf("Bad query request return.  Expected:%v.  Got: %v\n", string(expectedValue), string(returnValue))
 	}
 }
+
+func TestQueryGrammar(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	payload := bytes.NewBufferString(`{"typename": "neuronjson", "dataname": "neurons"}`)
+	apiStr := fmt.Sprintf("%srepo/%s/instance", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr, payload)
+
+	for bodyid, jsonStr := range sampleData {
+		keyreq := fmt.Sprintf("%snode/%s/neurons/key/%d", server.WebAPIPath, uuid, bodyid)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(jsonStr))
+	}
+
+	// the parent is queried through the backing store and the child through an in-memory db.
+	if err := datastore.Commit(uuid, "sample data", nil); err != nil {
+		t.Fatalf("unable to commit node %s: %v\n", uuid, err)
+	}
+	uuid2, err := datastore.NewVersion(uuid, "child", "", nil)
+	if err != nil {
+		t.Fatalf("unable to create new version off node %s: %v\n", uuid, err)
+	}
+	d, err := GetByUUIDName(uuid2, "neurons")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.initMemoryDB([]string{string(uuid2)}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := datastore.VersionFromUUID(uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := datastore.VersionFromUUID(uuid2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := d.getMemDBbyVersion(v); found {
+		t.Fatalf("expected no in-memory db for parent version\n")
+	}
+	if _, found := d.getMemDBbyVersion(v2); !found {
+		t.Fatalf("expected in-memory db for child version\n")
+	}
+
+	tests := []struct {
+		query    string
+		options  string
+		expected []uint64
+	}{
+		{`{"position": {"gt": 300}}`, "", []uint64{3000, 3002, 3003}},
+		{`{"position": {"between": [110, 112]}}`, "", []uint64{1001, 2001, 3001}},
+		{`{"bodyid": {"lt": 1002}}`, "", []uint64{1000, 1001}},
+		{`{"bodyid": {"le": 1002}, "position": {"ge": 102}}`, "", []uint64{1000, 1001, 1002}},
+		{`{"class": {"contains": "INTERNEURON"}}`, "", []uint64{1000, 1001, 1002, 1003}},
+		{`{"class": {"not": "9A"}}`, "", []uint64{1000, 1001, 1002, 1003, 3000, 3001, 3002, 3003}},
+		{`{"class": ["9B", {"contains": "tbd"}]}`, "", []uint64{1000, 1001, 1002, 1003, 3000, 3001, 3002, 3003}},
+		{`{"tags": {"not": "re/group[12]"}}`, "", []uint64{3000, 3001, 3002, 3003}},
+		{`{"tags": {"not": ["group1", "group3"]}}`, "", []uint64{2000, 2001, 2002, 2003}},
+		{`{"bodyid": {"not": 2000}, "class": "9A"}`, "", []uint64{2001, 2002, 2003}},
+		{`{"bodyid": [{"lt": 1001}, {"gt": 3002}]}`, "", []uint64{1000, 3003}},
+		{`{"missing": {"not": "foo"}, "bodyid": {"ge": 3002}}`, "", []uint64{3002, 3003}},
+		{`[{"bodyid": 1003}, {"avg_location": {"contains": "313"}}]`, "", []uint64{1003, 3001}},
+		{`{"class": "not/9A"}`, "", []uint64{}},
+		{`{"tags": ["contains/group1", "gt/1"]}`, "", []uint64{}},
+		{`{"class": "9B"}`, "sort=-bodyid", []uint64{3003, 3002, 3001, 3000}},
+		{`{"class": "9A"}`, "sort=-position,bodyid", []uint64{2003, 2000, 2001, 2002}},
+		{`{"tags": "re/group"}`, "sort=class,-bodyid&limit=5", []uint64{2003, 2002, 2001, 2000, 3003}},
+		{`{"tags": "re/group"}`, "offset=2&limit=3", []uint64{1002, 1003, 2000}},
+		{`{"tags": "re/group"}`, "sort=-bodyid&offset=1&limit=2", []uint64{3002, 3001}},
+		{`{"bodyid": [1000, 2000, 3000]}`, "offset=10", []uint64{}},
+	}
+	for _, version := range []dvid.UUID{uuid, uuid2} {
+		for _, tc := range tests {
+			queryreq := fmt.Sprintf("%snode/%s/neurons/query?%s", server.WebAPIPath, version, tc.options)
+			returnValue := server.TestHTTP(t, "GET", queryreq, strings.NewReader(tc.query))
+			var results []struct {
+				BodyID uint64 `json:"bodyid"`
+			}
+			if err := json.Unmarshal(returnValue, &results); err != nil {
+				t.Fatalf("bad response to query %s: %s\n", tc.query, string(returnValue))
+			}
+			bodyids := make([]uint64, len(results))
+			for i, result := range results {
+				bodyids[i] = result.BodyID
+			}
+			if len(bodyids) == 0 && len(tc.expected) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(bodyids, tc.expected) {
+				t.Fatalf("version %s query %s with options %q: expected %v, got %v\n",
+					version, tc.query, tc.options, tc.expected, bodyids)
+			}
+		}
+
+		queryreq := fmt.Sprintf("%snode/%s/neurons/query?sort=-bodyid&limit=1", server.WebAPIPath, version)
+		returnValue := server.TestHTTP(t, "GET", queryreq, strings.NewReader(`{"class": {"contains": "9"}}`))
+		expectedValue := []byte(fmt.Sprintf("[%s]", sampleData[3003]))
+		if !equalListJSON(returnValue, expectedValue, ShowBasic) {
+			t.Fatalf("Bad query request return.  Expected:%v.  Got: %v\n", string(expectedValue), string(returnValue))
+		}
+	}
+
+	queryreq := fmt.Sprintf("%snode/%s/neurons/query", server.WebAPIPath, uuid2)
+	server.TestBadHTTP(t, "GET", queryreq, strings.NewReader(`{"position": {"gt": "abc"}}`))
+	server.TestBadHTTP(t, "GET", queryreq, strings.NewReader(`{"position": {"between": [5, 1]}}`))
+	server.TestBadHTTP(t, "GET", queryreq, strings.NewReader(`{"position": {"gt": 1, "lt": 5}}`))
+	server.TestBadHTTP(t, "GET", queryreq, strings.NewReader(`{"class": {"near": "9A"}}`))
+	server.TestBadHTTP(t, "GET", queryreq+"?limit=-1", strings.NewReader(`{"class": "9A"}`))
+	server.TestBadHTTP(t, "GET", queryreq+"?offset=a", strings.NewReader(`{"class": "9A"}`))
+}
+
+func TestQueryLargeIDs(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	payload := bytes.NewBufferString(`{"typename": "neuronjson", "dataname": "neurons"}`)
+	apiStr := fmt.Sprintf("%srepo/%s/instance", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr, payload)
+
+	// IDs that can't be distinguished as float64.
+	const id1, id2 = uint64(9007199254740992), uint64(9007199254740993)
+	for _, bodyid := range []uint64{id1, id2} {
+		keyreq := fmt.Sprintf("%snode/%s/neurons/key/%d", server.WebAPIPath, uuid, bodyid)
+		jsonStr := fmt.Sprintf(`{"bodyid": %d, "partner": %d, "class": "big"}`, bodyid, id1+id2-bodyid)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(jsonStr))
+	}
+
+	tests := []struct {
+		query    string
+		expected []uint64
+	}{
+		{fmt.Sprintf(`{"bodyid": {"gt": %d}}`, id1), []uint64{id2}},
+		{fmt.Sprintf(`{"bodyid": {"lt": %d}}`, id2), []uint64{id1}},
+		{fmt.Sprintf(`{"bodyid": {"not": %d}}`, id1), []uint64{id2}},
+		{fmt.Sprintf(`{"partner": [%d, {"contains": "x"}]}`, id1), []uint64{id2}},
+		{fmt.Sprintf(`{"bodyid": {"between": [%d, %d]}}`, id2, id2), []uint64{id2}},
+	}
+	queryreq := fmt.Sprintf("%snode/%s/neurons/query?sort=bodyid", server.WebAPIPath, uuid)
+	for _, tc := range tests {
+		returnValue := server.TestHTTP(t, "GET", queryreq, strings.NewReader(tc.query))
+		var results []struct {
+			BodyID uint64 `json:"bodyid"`
+		}
+		if err := json.Unmarshal(returnValue, &results); err != nil {
+			t.Fatalf("bad response to query %s: %s\n", tc.query, string(returnValue))
+		}
+		bodyids := make([]uint64, len(results))
+		for i, result := range results {
+			bodyids[i] = result.BodyID
+		}
+		if !reflect.DeepEqual(bodyids, tc.expected) {
+			t.Fatalf("query %s: expected %v, got %v\n", tc.query, tc.expected, bodyids)
+		}
+	}
+	server.TestBadHTTP(t, "GET", queryreq, strings.NewReader(fmt.Sprintf(`{"bodyid": {"between": [%d, %d]}}`, id2, id1)))
+}
+
+func TestQueryStoreLimit(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	payload := bytes.NewBufferString(`{"typename": "neuronjson", "dataname": "neurons"}`)
+	apiStr := fmt.Sprintf("%srepo/%s/instance", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr, payload)
+	for bodyid, jsonStr := range sampleData {
+		keyreq := fmt.Sprintf("%snode/%s/neurons/key/%d", server.WebAPIPath, uuid, bodyid)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(jsonStr))
+	}
+	d, err := GetByUUIDName(uuid, "neurons")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+
+	// the store scan stops once enough results are written.
+	var scanned int
+	err = d.processStoreRange(ctx, func(key string, value NeuronJSON) error {
+		if scanned++; scanned == 3 {
+			return errStopRange
+		}
+		return nil
+	})
+	if err != nil || scanned != 3 {
+		t.Fatalf("expected stopped scan after 3 annotations without error, got %d: %v\n", scanned, err)
+	}
+
+	var buf bytes.Buffer
+	results := newQueryResults(&buf, QueryOptions{Limit: 2})
+	query := ListQueryJSON{QueryJSON{"class": querySubstring("9")}}
+	if err := d.queryBackingStore(ctx, results, query, nil, ShowBasic); err != nil {
+		t.Fatal(err)
+	}
+	if results.numWritten != 2 || results.numMatches != 2 {
+		t.Fatalf("expected scan to stop after 2 matches, got %d matches and %d written\n", results.numMatches, results.numWritten)
+	}
+}
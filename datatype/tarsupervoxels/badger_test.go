@@ -7,3 +7,7 @@ import "testing"
 func TestBadgerTarballRoundTrip(t *testing.T) {
 	testTarball(t, "badger")
 }
+
+func TestBadgerMeshGenerator(t *testing.T) {
+	testMeshGenerator(t, "badger")
+}
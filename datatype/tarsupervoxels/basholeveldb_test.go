@@ -7,3 +7,7 @@ import "testing"
 func TestBasholeveldbTarballRoundTrip(t *testing.T) {
 	testTarball(t, "basholeveldb")
 }
+
+func TestBasholeveldbMeshGenerator(t *testing.T) {
+	testMeshGenerator(t, "basholeveldb")
+}
@@ -7,3 +7,7 @@ import "testing"
 func TestFilestoreTarballRoundTrip(t *testing.T) {
 	testTarball(t, "filestore")
 }
+
+func TestFilestoreMeshGenerator(t *testing.T) {
+	testMeshGenerator(t, "filestore")
+}
@@ -0,0 +1,124 @@
+/*
+	This file supports generating supervoxel data from the synced labelmap.
+*/
+
+package tarsupervoxels
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/mesh"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// MeshGenerator is the Generator setting for computing supervoxel meshes from the
+// synced labelmap.
+const MeshGenerator = "mesh"
+
+// checkGenerator returns an error if the generator is unknown or can't produce data
+// with the given extension.
+func checkGenerator(generator, extension string) error {
+	switch generator {
+	case "":
+		return nil
+	case MeshGenerator:
+		if _, err := mesh.ParseFormat(extension); err != nil {
+			return fmt.Errorf("%q generator requires an Extension of %q, %q, or %q, not %q",
+				generator, mesh.NgMesh, mesh.OBJ, mesh.PLY, extension)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown tarsupervoxels generator %q", generator)
+	}
+}
+
+// generateData computes the data for a supervoxel at the given version of the synced
+// labelmap and stores it under the root context.  The returned bool is false if the
+// supervoxel doesn't exist in the synced labelmap.
+func (d *Data) generateData(db storage.KeyValueDB, ctx *datastore.VersionedCtx, v dvid.VersionID, supervoxel uint64) ([]byte, bool, error) {
+	if d.Generator != MeshGenerator {
+		return nil, false, fmt.Errorf("data %q has no generator for supervoxel %d", d.DataName(), supervoxel)
+	}
+	ldata := d.getSyncedLabels()
+	if ldata == nil {
+		return nil, false, fmt.Errorf("data %q is not synced with any labelmap instance", d.DataName())
+	}
+	format, err := mesh.ParseFormat(d.Extension)
+	if err != nil {
+		return nil, false, err
+	}
+	m, err := ldata.GetSupervoxelMesh(v, supervoxel)
+	if err != nil {
+		return nil, false, fmt.Errorf("can't generate mesh for supervoxel %d: %v", supervoxel, err)
+	}
+	if m == nil {
+		return nil, false, nil
+	}
+	var buf bytes.Buffer
+	if err := m.Write(&buf, format); err != nil {
+		return nil, false, err
+	}
+	tk, err := NewTKey(supervoxel, d.Extension)
+	if err != nil {
+		return nil, false, err
+	}
+	data := buf.Bytes()
+	if err := db.Put(ctx, tk, data); err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// generateMissing generates and stores data for any of the given supervoxels that have
+// no stored data.
+func (d *Data) generateMissing(v dvid.VersionID, supervoxels ...uint64) error {
+	db, err := datastore.GetKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	root, err := datastore.GetRepoRootVersion(v)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, root)
+	for _, supervoxel := range supervoxels {
+		if supervoxel == 0 {
+			continue
+		}
+		tk, err := NewTKey(supervoxel, d.Extension)
+		if err != nil {
+			return err
+		}
+		exists, err := db.Exists(ctx, tk)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, _, err := d.generateData(db, ctx, v, supervoxel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateSupervoxel generates and stores data for a supervoxel at the given version.
+func (d *Data) generateSupervoxel(uuid dvid.UUID, supervoxel uint64) ([]byte, bool, error) {
+	db, err := datastore.GetKeyValueDB(d)
+	if err != nil {
+		return nil, false, err
+	}
+	v, err := datastore.VersionFromUUID(uuid)
+	if err != nil {
+		return nil, false, err
+	}
+	ctx, err := d.getRootContext(uuid)
+	if err != nil {
+		return nil, false, err
+	}
+	return d.generateData(db, ctx, v, supervoxel)
+}
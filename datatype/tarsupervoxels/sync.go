@@ -1,12 +1,138 @@
+/*
+	This file supports generating supervoxel data in response to synced labelmap changes.
+*/
+
 package tarsupervoxels
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
 	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
 )
 
-// GetSyncSubs implements the datastore.Syncer interface, but tarsupervoxels doesn't need
-// to process events.
+// Number of change messages we can buffer before blocking on sync channel.
+const syncBufferSize = 100
+
+// InitDataHandlers launches goroutines to handle each tarsupervoxels instance's syncs.
+func (d *Data) InitDataHandlers() error {
+	if d.syncCh != nil || d.syncDone != nil {
+		return nil
+	}
+	d.syncCh = make(chan datastore.SyncMessage, syncBufferSize)
+	d.syncDone = make(chan *sync.WaitGroup)
+
+	// Launch handlers of sync events.
+	fmt.Printf("Launching sync event handler for data %q...\n", d.DataName())
+	go d.processEvents()
+	return nil
+}
+
+// Shutdown terminates blocks until syncs are done then terminates background goroutines processing data.
+func (d *Data) Shutdown(wg *sync.WaitGroup) {
+	if d.syncDone != nil {
+		dwg := new(sync.WaitGroup)
+		dwg.Add(1)
+		d.syncDone <- dwg
+		dwg.Wait() // Block until we are done.
+	}
+	wg.Done()
+}
+
+// GetSyncSubs implements the datastore.Syncer interface.  Supervoxel and label splits in a
+// synced labelmap are subscribed so data can be generated for new supervoxels.  Without a
+// Generator, the events are ignored.
 func (d *Data) GetSyncSubs(synced dvid.Data) (datastore.SyncSubs, error) {
-	return datastore.SyncSubs{}, nil
+	if synced.TypeName() != "labelmap" {
+		return datastore.SyncSubs{}, nil
+	}
+	if d.syncCh == nil {
+		if err := d.InitDataHandlers(); err != nil {
+			return nil, fmt.Errorf("unable to initialize handlers for data %q: %v\n", d.DataName(), err)
+		}
+	}
+	events := []string{
+		labels.SupervoxelSplitEvent,
+		labels.SplitLabelEvent,
+	}
+	subs := make(datastore.SyncSubs, len(events))
+	for i, event := range events {
+		subs[i] = datastore.SyncSub{
+			Event:  datastore.SyncEvent{Data: synced.DataUUID(), Event: event},
+			Notify: d.DataUUID(),
+			Ch:     d.syncCh,
+		}
+	}
+	return subs, nil
+}
+
+// SyncPending returns true if any sync messages are in queue
+func (d *Data) SyncPending() bool {
+	return len(d.syncCh) > 0
+}
+
+// If supervoxels are split, generate data for the new supervoxels.
+func (d *Data) processEvents() {
+	defer func() {
+		if e := recover(); e != nil {
+			msg := fmt.Sprintf("Panic detected on tarsupervoxels sync thread: %+v\n", e)
+			dvid.ReportPanic(msg, server.WebServer())
+		}
+	}()
+	var stop bool
+	var wg *sync.WaitGroup
+	for {
+		select {
+		case wg = <-d.syncDone:
+			queued := len(d.syncCh)
+			if queued > 0 {
+				dvid.Infof("Received shutdown signal for %q sync events (%d in queue)\n", d.DataName(), queued)
+				stop = true
+			} else {
+				dvid.Infof("Shutting down sync event handler for instance %q...\n", d.DataName())
+				wg.Done()
+				return
+			}
+		case msg := <-d.syncCh:
+			d.handleSyncMessage(msg)
+
+			if stop && len(d.syncCh) == 0 {
+				dvid.Infof("Shutting down sync even handler for instance %q after draining sync events.\n", d.DataName())
+				wg.Done()
+				return
+			}
+		}
+	}
+}
+
+func (d *Data) handleSyncMessage(msg datastore.SyncMessage) {
+	if d.Generator == "" {
+		return
+	}
+	d.StartUpdate()
+	defer d.StopUpdate()
+
+	switch delta := msg.Delta.(type) {
+	case labels.SplitSupervoxelOp:
+		if err := d.generateMissing(msg.Version, delta.SplitSupervoxel, delta.RemainSupervoxel); err != nil {
+			dvid.Errorf("unable to generate data for split of supervoxel %d in %q: %v\n", delta.Supervoxel, d.DataName(), err)
+		}
+
+	case labels.DeltaSplit:
+		// Only the supervoxels created by the split are generated.  Data for other missing
+		// supervoxels of the split bodies is generated on demand by GET requests.
+		supervoxels := make([]uint64, 0, 2*len(delta.SVSplits))
+		for _, svsplit := range delta.SVSplits {
+			supervoxels = append(supervoxels, svsplit.Split, svsplit.Remain)
+		}
+		if err := d.generateMissing(msg.Version, supervoxels...); err != nil {
+			dvid.Errorf("unable to generate data for split of label %d in %q: %v\n", delta.OldLabel, d.DataName(), err)
+		}
+
+	default:
+		dvid.Criticalf("Received unknown delta in tarsupervoxels.handleSyncMessage(): %v\n", msg)
+	}
 }
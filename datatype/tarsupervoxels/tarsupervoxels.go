@@ -15,10 +15,12 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/common/mesh"
 	"github.com/janelia-flyem/dvid/datatype/labelmap"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
@@ -63,6 +65,10 @@ $ dvid repo <UUID> new tarsupervoxels <data name> <settings...>
                    Example key/value: "Extension" is the expected extension for blobs uploaded.
                        If no extension is given, it is "dat" by default.
                        It could be set to "drc" for Google Draco file formats, for example.
+                   Example key/value: "Generator" is an optional generator of supervoxel data
+                       computed by DVID from the synced labelmap.  The only generator is "mesh",
+                       which requires an Extension of "ngmesh", "obj", or "ply" giving the mesh
+                       format.  See the "Generator mode" section below.
 
     ------------------
 
@@ -90,6 +96,7 @@ POST <api URL>/node/<UUID>/<data name>/info
 
      "Extension"        Expected extension for blobs uploaded (default: "dat").
                            Other common uses include "drc" for Google Draco file formats..
+     "Generator"        Optional generator of supervoxel data, currently only "mesh".
 
     Arguments:
 
@@ -146,8 +153,8 @@ HEAD <api URL>/node/<UUID>/<data name>/tarfile/<label>
     GET returns a tarfile of all supervoxel data that has been mapped to the given label.
     File names within the tarfile will be the supervoxel id and an extension.  HTTP status
     code 400 (Bad Request) is returned if no such label exists.  If a supervoxel's data does 
-    not exist, a file will be returned named "X.missing" where X is the supervoxel id.
-    Note that HTTP status code 200 (OK) is usually returned if the streaming response
+    not exist, a file will be returned named "X.missing" where X is the supervoxel id, unless
+    a Generator is set, in which case the data is generated and stored.  Note that HTTP status code 200 (OK) is usually returned if the streaming response
     has been initiated, and if an error occurs during the return, there will be an ill-formed
     tar file.  This is a tradeoff to allow streaming response.
 
@@ -221,6 +228,22 @@ POST <api URL>/node/<UUID>/<data name>/load
     UUID          Hexadecimal string with enough characters to uniquely identify a version node.
     data name     Name of tarsupervoxels data instance.
 
+    ------------------
+
+Generator mode:
+
+If a "Generator" is set, DVID computes the data for a supervoxel from the blocks of the
+synced labelmap whenever the data would otherwise be missing.  The "mesh" generator computes
+a scale 0 surface mesh of the supervoxel via marching cubes, with vertices in physical units
+given by the labelmap voxel resolution, and serializes it in the format given by the
+Extension: "ngmesh" (neuroglancer legacy precomputed format without Draco compression),
+"obj", or "ply".
+
+Data is generated and stored for the new supervoxels created by supervoxel splits and body
+splits in the synced labelmap.  Data is also generated and stored when a GET of /supervoxel
+or /tarfile encounters a supervoxel without data, so /tarfile never returns ".missing"
+placeholders for existing supervoxels.  POSTed data still takes precedence over generated
+data, and /missing still reports supervoxels without stored data.
 `
 
 func init() {
@@ -265,7 +288,14 @@ func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.
 	if !found {
 		return nil, fmt.Errorf("tarsupervoxels instances must have Extension set in the configuration")
 	}
-	return &Data{Data: basedata, Extension: extension}, nil
+	generator, _, err := c.GetString("Generator")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkGenerator(generator, extension); err != nil {
+		return nil, err
+	}
+	return &Data{Data: basedata, Extension: extension, Generator: generator}, nil
 }
 
 func (dtype *Type) Help() string {
@@ -288,6 +318,7 @@ func GetByUUIDName(uuid dvid.UUID, name dvid.InstanceName) (*Data, error) {
 type mappedLabelType interface {
 	GetSupervoxels(dvid.VersionID, uint64) (labels.Set, error)
 	GetMappedLabels(dvid.VersionID, []uint64) (mapped []uint64, found []bool, err error)
+	GetSupervoxelMesh(dvid.VersionID, uint64) (*mesh.Mesh, error)
 	DataName() dvid.InstanceName
 }
 
@@ -298,6 +329,16 @@ type Data struct {
 	// Extension is the expected extension for blobs uploaded.
 	// If no extension is given, it is "dat" by default.
 	Extension string
+
+	// Generator is the optional generator of supervoxel data from the synced labelmap.
+	Generator string
+
+	// Keep track of sync operations that could be updating the data.
+	datastore.Updater
+
+	// channels for processing messages from the synced labelmap
+	syncCh   chan datastore.SyncMessage
+	syncDone chan *sync.WaitGroup
 }
 
 // --- Override of DataService interface ---
@@ -306,13 +347,25 @@ func (d *Data) modifyConfig(config dvid.Config) error {
 	if err := d.Data.ModifyConfig(config); err != nil {
 		return err
 	}
+	extension, generator := d.Extension, d.Generator
 	s, found, err := config.GetString("Extension")
 	if err != nil {
 		return err
 	}
 	if found {
-		d.Extension = s
+		extension = s
+	}
+	s, found, err = config.GetString("Generator")
+	if err != nil {
+		return err
+	}
+	if found {
+		generator = s
 	}
+	if err := checkGenerator(generator, extension); err != nil {
+		return err
+	}
+	d.Extension, d.Generator = extension, generator
 	return nil
 }
 
@@ -335,6 +388,7 @@ func (d *Data) Equals(d2 *Data) bool {
 
 type propsJSON struct {
 	Extension string
+	Generator string
 }
 
 func (d *Data) MarshalJSON() ([]byte, error) {
@@ -345,6 +399,7 @@ func (d *Data) MarshalJSON() ([]byte, error) {
 		d.Data,
 		propsJSON{
 			Extension: d.Extension,
+			Generator: d.Generator,
 		},
 	})
 }
@@ -358,6 +413,10 @@ func (d *Data) GobDecode(b []byte) error {
 	if err := dec.Decode(&(d.Extension)); err != nil {
 		return fmt.Errorf("decoding tarsupervoxels %q: no Extension", d.DataName())
 	}
+	// Instances stored before generators were added have no Generator.
+	if err := dec.Decode(&(d.Generator)); err != nil && err != io.EOF {
+		return fmt.Errorf("decoding tarsupervoxels %q Generator: %v", d.DataName(), err)
+	}
 	return nil
 }
 
@@ -370,6 +429,9 @@ func (d *Data) GobEncode() ([]byte, error) {
 	if err := enc.Encode(d.Extension); err != nil {
 		return nil, err
 	}
+	if err := enc.Encode(d.Generator); err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
@@ -458,7 +520,7 @@ type fileData struct {
 	err    error
 }
 
-func (d *Data) getSupervoxelGoroutine(db storage.KeyValueDB, ctx *datastore.VersionedCtx, supervoxels []uint64, outCh chan fileData, done <-chan struct{}) {
+func (d *Data) getSupervoxelGoroutine(db storage.KeyValueDB, ctx *datastore.VersionedCtx, v dvid.VersionID, supervoxels []uint64, outCh chan fileData, done <-chan struct{}) {
 	dbt, canGetTimestamp := db.(storage.KeyValueTimestampGetter)
 	for _, supervoxel := range supervoxels {
 		tk, err := NewTKey(supervoxel, d.Extension)
@@ -479,6 +541,13 @@ func (d *Data) getSupervoxelGoroutine(db storage.KeyValueDB, ctx *datastore.Vers
 			outCh <- fileData{err: err}
 			continue
 		}
+		if data == nil && d.Generator != "" {
+			if data, _, err = d.generateData(db, ctx, v, supervoxel); err != nil {
+				outCh <- fileData{err: err}
+				continue
+			}
+			modTime = time.Now()
+		}
 		var ext string
 		if data == nil {
 			ext = "missing"
@@ -703,7 +772,7 @@ func (d *Data) sendTarfile(w http.ResponseWriter, uuid dvid.UUID, label uint64)
 	defer close(done)
 	outCh := make(chan fileData, len(supervoxels))
 	for i := 0; i < numHandlers; i++ {
-		go d.getSupervoxelGoroutine(db, ctx, svlist[i], outCh, done)
+		go d.getSupervoxelGoroutine(db, ctx, v, svlist[i], outCh, done)
 	}
 
 	w.Header().Set("Content-type", "application/tar")
@@ -937,6 +1006,12 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				server.BadRequest(w, r, err)
 				return
 			}
+			if !found && d.Generator != "" {
+				if data, found, err = d.generateSupervoxel(uuid, supervoxel); err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+			}
 			if !found {
 				http.Error(w, fmt.Sprintf("Supervoxel %d not found", supervoxel), http.StatusNotFound)
 				return
@@ -13,6 +13,7 @@ import (
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/common/mesh"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 	"github.com/janelia-flyem/dvid/storage"
@@ -219,3 +220,207 @@ func testTarball(t *testing.T, storetype storage.Alias) {
 	apiStr = fmt.Sprintf("%snode/%s/%s/tarfile/30", server.WebAPIPath, uuid, tarsvname)
 	server.TestHTTP(t, "HEAD", apiStr, nil) // now has every supervoxel including 15
 }
+
+// checks the data is a non-empty mesh in the neuroglancer legacy format.
+func checkNgMesh(t *testing.T, supervoxel uint64, data []byte) {
+	if len(data) < 4 {
+		t.Fatalf("expected ngmesh data for supervoxel %d, got %d bytes\n", supervoxel, len(data))
+	}
+	numVertices := binary.LittleEndian.Uint32(data[0:4])
+	if numVertices == 0 {
+		t.Fatalf("expected vertices in generated mesh for supervoxel %d\n", supervoxel)
+	}
+	triangleBytes := len(data) - 4 - int(numVertices)*12
+	if triangleBytes <= 0 || triangleBytes%12 != 0 {
+		t.Fatalf("bad ngmesh for supervoxel %d: %d vertices in %d bytes\n", supervoxel, numVertices, len(data))
+	}
+}
+
+func testMeshGenerator(t *testing.T, storetype storage.Alias) {
+	testConfig := server.TestConfig{
+		KVStoresMap: storage.DataMap{"tarsupervoxels": storetype},
+	}
+	if err := server.OpenTest(testConfig); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	labelname := "labels"
+	server.CreateTestInstance(t, uuid, "labelmap", labelname, config)
+	tarsvname := "meshes"
+	config.Set("Extension", string(mesh.NgMesh))
+	config.Set("Generator", MeshGenerator)
+	server.CreateTestInstance(t, uuid, "tarsupervoxels", tarsvname, config)
+	server.CreateTestSync(t, uuid, tarsvname, labelname)
+
+	// Generators require a mesh format extension.
+	apiStr := fmt.Sprintf("%srepo/%s/instance", server.WebAPIPath, uuid)
+	payload := `{"typename": "tarsupervoxels", "dataname": "badmeshes", "Extension": "dat", "Generator": "mesh"}`
+	server.TestBadHTTP(t, "POST", apiStr, bytes.NewBufferString(payload))
+	payload = `{"typename": "tarsupervoxels", "dataname": "badmeshes", "Extension": "obj", "Generator": "skeleton"}`
+	server.TestBadHTTP(t, "POST", apiStr, bytes.NewBufferString(payload))
+
+	// Put in a block with supervoxel 1 for x < 32 and supervoxel 2 for x >= 32.
+	n := 64
+	voxels := make([]byte, n*n*n*8)
+	for i := 0; i < n*n*n; i++ {
+		label := uint64(1)
+		if i%n >= 32 {
+			label = 2
+		}
+		binary.LittleEndian.PutUint64(voxels[i*8:i*8+8], label)
+	}
+	apiStr = fmt.Sprintf("%snode/%s/%s/raw/0_1_2/%d_%d_%d/0_0_0", server.WebAPIPath,
+		uuid, labelname, n, n, n)
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBuffer(voxels))
+	if err := datastore.BlockOnUpdating(uuid, dvid.InstanceName(labelname)); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	// Supervoxel 2 data is generated and stored on GET.
+	apiStr = fmt.Sprintf("%snode/%s/%s/missing/2", server.WebAPIPath, uuid, tarsvname)
+	if missingResp := server.TestHTTP(t, "GET", apiStr, nil); string(missingResp) != "[2]" {
+		t.Fatalf("For GET /missing/2, expected %q, got %q\n", "[2]", missingResp)
+	}
+	apiStr = fmt.Sprintf("%snode/%s/%s/supervoxel/2", server.WebAPIPath, uuid, tarsvname)
+	checkNgMesh(t, 2, server.TestHTTP(t, "GET", apiStr, nil))
+	apiStr = fmt.Sprintf("%snode/%s/%s/missing/2", server.WebAPIPath, uuid, tarsvname)
+	if missingResp := server.TestHTTP(t, "GET", apiStr, nil); string(missingResp) != "[]" {
+		t.Fatalf("For GET /missing/2, expected %q, got %q\n", "[]", missingResp)
+	}
+
+	// Nonexistent supervoxels are still not found.
+	apiStr = fmt.Sprintf("%snode/%s/%s/supervoxel/17", server.WebAPIPath, uuid, tarsvname)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+
+	// POSTed data for supervoxel 1 is not replaced by generated data.
+	apiStr = fmt.Sprintf("%snode/%s/%s/supervoxel/1", server.WebAPIPath, uuid, tarsvname)
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBufferString("posted mesh"))
+	if data := server.TestHTTP(t, "GET", apiStr, nil); string(data) != "posted mesh" {
+		t.Fatalf("expected POSTed data for supervoxel 1, got %q\n", string(data))
+	}
+
+	// Split supervoxel 1 along x = 16.
+	var rles dvid.RLEs
+	for z := int32(0); z < int32(n); z++ {
+		for y := int32(0); y < int32(n); y++ {
+			rles = append(rles, dvid.NewRLE(dvid.Point3d{0, y, z}, 16))
+		}
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(dvid.EncodingBinary)
+	binary.Write(buf, binary.LittleEndian, uint8(3))          // # of dimensions
+	binary.Write(buf, binary.LittleEndian, byte(0))           // dimension of run (X = 0)
+	buf.WriteByte(byte(0))                                    // reserved for later
+	binary.Write(buf, binary.LittleEndian, uint32(0))         // Placeholder for # voxels
+	binary.Write(buf, binary.LittleEndian, uint32(len(rles))) // # spans
+	rleBytes, err := rles.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unable to serialize RLEs: %v\n", err)
+	}
+	buf.Write(rleBytes)
+	apiStr = fmt.Sprintf("%snode/%s/%s/split-supervoxel/1", server.WebAPIPath, uuid, labelname)
+	r := server.TestHTTP(t, "POST", apiStr, buf)
+	var splitResp struct {
+		SplitSupervoxel  uint64
+		RemainSupervoxel uint64
+	}
+	if err := json.Unmarshal(r, &splitResp); err != nil {
+		t.Fatalf("unable to parse supervoxel split response %q: %v\n", string(r), err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, dvid.InstanceName(labelname)); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, dvid.InstanceName(tarsvname)); err != nil {
+		t.Fatalf("Error blocking on sync of tarsupervoxels: %v\n", err)
+	}
+
+	// Data for the new supervoxels is generated by the sync.
+	apiStr = fmt.Sprintf("%snode/%s/%s/missing/1", server.WebAPIPath, uuid, tarsvname)
+	if missingResp := server.TestHTTP(t, "GET", apiStr, nil); string(missingResp) != "[]" {
+		t.Fatalf("For GET /missing/1 after split, expected %q, got %q\n", "[]", missingResp)
+	}
+	apiStr = fmt.Sprintf("%snode/%s/%s/tarfile/1", server.WebAPIPath, uuid, tarsvname)
+	server.TestHTTP(t, "HEAD", apiStr, nil)
+
+	expected := labels.NewSet(splitResp.SplitSupervoxel, splitResp.RemainSupervoxel)
+	tr := tar.NewReader(bytes.NewBuffer(server.TestHTTP(t, "GET", apiStr, nil)))
+	var numFiles int
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error parsing tar: %v\n", err)
+		}
+		var svdata bytes.Buffer
+		if _, err := io.Copy(&svdata, tr); err != nil {
+			t.Fatalf("error reading tar data: %v\n", err)
+		}
+		var supervoxel uint64
+		var ext string
+		if _, err := fmt.Sscanf(hdr.Name, "%d.%s", &supervoxel, &ext); err != nil {
+			t.Fatalf("can't parse tar file name %q: %v\n", hdr.Name, err)
+		}
+		if ext != string(mesh.NgMesh) {
+			t.Fatalf("bad extension for tar file name %q\n", hdr.Name)
+		}
+		if _, found := expected[supervoxel]; !found {
+			t.Fatalf("got back supervoxel %d in tarfile, which is not in set %s\n", supervoxel, expected)
+		}
+		checkNgMesh(t, supervoxel, svdata.Bytes())
+		numFiles++
+	}
+	if numFiles != 2 {
+		t.Fatalf("Only got %d files instead of expected 2\n", numFiles)
+	}
+	// Merge body 2 without stored data into body 1, then split off part of the remaining
+	// supervoxel.  Only the supervoxels created by the split get data.
+	apiStr = fmt.Sprintf("%snode/%s/%s/supervoxel/2", server.WebAPIPath, uuid, tarsvname)
+	server.TestHTTP(t, "DELETE", apiStr, nil)
+	apiStr = fmt.Sprintf("%snode/%s/%s/merge", server.WebAPIPath, uuid, labelname)
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBufferString("[1, 2]"))
+
+	rles = nil
+	for z := int32(0); z < int32(n); z++ {
+		for y := int32(0); y < int32(n); y++ {
+			rles = append(rles, dvid.NewRLE(dvid.Point3d{20, y, z}, 4))
+		}
+	}
+	buf = new(bytes.Buffer)
+	buf.WriteByte(dvid.EncodingBinary)
+	binary.Write(buf, binary.LittleEndian, uint8(3))
+	binary.Write(buf, binary.LittleEndian, byte(0))
+	buf.WriteByte(byte(0))
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	binary.Write(buf, binary.LittleEndian, uint32(len(rles)))
+	if rleBytes, err = rles.MarshalBinary(); err != nil {
+		t.Fatalf("Unable to serialize RLEs: %v\n", err)
+	}
+	buf.Write(rleBytes)
+	apiStr = fmt.Sprintf("%snode/%s/%s/split/1", server.WebAPIPath, uuid, labelname)
+	r = server.TestHTTP(t, "POST", apiStr, buf)
+	var bodySplitResp struct {
+		Label uint64
+	}
+	if err := json.Unmarshal(r, &bodySplitResp); err != nil {
+		t.Fatalf("unable to parse split response %q: %v\n", string(r), err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, dvid.InstanceName(labelname)); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, dvid.InstanceName(tarsvname)); err != nil {
+		t.Fatalf("Error blocking on sync of tarsupervoxels: %v\n", err)
+	}
+	apiStr = fmt.Sprintf("%snode/%s/%s/missing/%d", server.WebAPIPath, uuid, tarsvname, bodySplitResp.Label)
+	if missingResp := server.TestHTTP(t, "GET", apiStr, nil); string(missingResp) != "[]" {
+		t.Fatalf("For GET /missing/%d after body split, expected %q, got %q\n", bodySplitResp.Label, "[]", missingResp)
+	}
+	apiStr = fmt.Sprintf("%snode/%s/%s/missing/1", server.WebAPIPath, uuid, tarsvname)
+	if missingResp := server.TestHTTP(t, "GET", apiStr, nil); string(missingResp) != "[2]" {
+		t.Fatalf("For GET /missing/1 after body split, expected %q, got %q\n", "[2]", missingResp)
+	}
+}
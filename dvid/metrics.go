@@ -0,0 +1,303 @@
+/*
+	This file implements a simple registry of metrics that can be exported in the
+	Prometheus text exposition format.
+*/
+
+package dvid
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MetricType is the Prometheus type of a metric.
+type MetricType string
+
+const (
+	CounterMetric   MetricType = "counter"
+	GaugeMetric     MetricType = "gauge"
+	HistogramMetric MetricType = "histogram"
+)
+
+// DefaultLatencyBuckets are histogram upper bounds in seconds suitable for request latencies.
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// MetricSample is a value for a particular set of label values.
+type MetricSample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type metric interface {
+	writeMetric(w *bufio.Writer)
+}
+
+var metricRegistry = struct {
+	sync.RWMutex
+	metrics map[string]metric
+}{metrics: make(map[string]metric)}
+
+func registerMetric(name string, m metric) {
+	metricRegistry.Lock()
+	defer metricRegistry.Unlock()
+	if _, found := metricRegistry.metrics[name]; found {
+		panic(fmt.Sprintf("metric %q registered more than once", name))
+	}
+	metricRegistry.metrics[name] = m
+}
+
+// WriteMetrics writes all registered metrics in the Prometheus text format.
+func WriteMetrics(w io.Writer) error {
+	metricRegistry.RLock()
+	names := make([]string, 0, len(metricRegistry.metrics))
+	for name := range metricRegistry.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		metrics[i] = metricRegistry.metrics[name]
+	}
+	metricRegistry.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.writeMetric(bw)
+	}
+	return bw.Flush()
+}
+
+func writeMetricHeader(w *bufio.Writer, name, help string, t MetricType) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, t)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// returns the label set in Prometheus format, e.g., {a="x",b="y"}, with optional extra label.
+func formatLabels(labelNames, labelValues []string, extraName, extraValue string) string {
+	if len(labelNames) == 0 && extraName == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range labelNames {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		if i < len(labelValues) {
+			sb.WriteString(labelValueEscaper.Replace(labelValues[i]))
+		}
+		sb.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(labelNames) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extraName)
+		sb.WriteString(`="`)
+		sb.WriteString(extraValue)
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func labelKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]*MetricSample
+}
+
+// NewCounterVec registers and returns a counter with the given label names.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		values:     make(map[string]*MetricSample),
+	}
+	registerMetric(name, c)
+	return c
+}
+
+// Add adds a non-negative delta to the counter with the given label values.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if len(labelValues) != len(c.labelNames) || delta < 0 {
+		Errorf("bad update of counter %q with labels %v: %f\n", c.name, labelValues, delta)
+		return
+	}
+	key := labelKey(labelValues)
+	c.mu.Lock()
+	sample, found := c.values[key]
+	if !found {
+		sample = &MetricSample{LabelValues: append([]string{}, labelValues...)}
+		c.values[key] = sample
+	}
+	sample.Value += delta
+	c.mu.Unlock()
+}
+
+// Inc increments the counter with the given label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the current count for the given label values.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sample, found := c.values[labelKey(labelValues)]; found {
+		return sample.Value
+	}
+	return 0
+}
+
+func (c *CounterVec) writeMetric(w *bufio.Writer) {
+	writeMetricHeader(w, c.name, c.help, CounterMetric)
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sample := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labelNames, sample.LabelValues, "", ""), formatMetricValue(sample.Value))
+	}
+	c.mu.Unlock()
+}
+
+type histogramValue struct {
+	labelValues []string
+	counts      []uint64 // non-cumulative count per bucket
+	sum         float64
+	count       uint64
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64 // sorted upper bounds not including +Inf
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+// NewHistogramVec registers and returns a histogram with the given bucket upper bounds
+// and label names.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    sorted,
+		values:     make(map[string]*histogramValue),
+	}
+	registerMetric(name, h)
+	return h
+}
+
+// Observe adds an observation to the histogram with the given label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	if len(labelValues) != len(h.labelNames) {
+		Errorf("bad observation of histogram %q with labels %v\n", h.name, labelValues)
+		return
+	}
+	key := labelKey(labelValues)
+	h.mu.Lock()
+	hv, found := h.values[key]
+	if !found {
+		hv = &histogramValue{
+			labelValues: append([]string{}, labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = hv
+	}
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.sum += v
+	hv.count++
+	h.mu.Unlock()
+}
+
+// Count returns the number of observations for the given label values.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hv, found := h.values[labelKey(labelValues)]; found {
+		return hv.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) writeMetric(w *bufio.Writer) {
+	writeMetricHeader(w, h.name, h.help, HistogramMetric)
+	h.mu.Lock()
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		hv := h.values[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += hv.counts[i]
+			labels := formatLabels(h.labelNames, hv.labelValues, "le", formatMetricValue(upper))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, cumulative)
+		}
+		labels := formatLabels(h.labelNames, hv.labelValues, "le", "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, hv.count)
+		labels = formatLabels(h.labelNames, hv.labelValues, "", "")
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatMetricValue(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, hv.count)
+	}
+	h.mu.Unlock()
+}
+
+type metricFunc struct {
+	name       string
+	help       string
+	metricType MetricType
+	labelNames []string
+	f          func() []MetricSample
+}
+
+// RegisterMetricFunc registers a counter or gauge whose samples are computed by the given
+// function each time metrics are written.
+func RegisterMetricFunc(name, help string, metricType MetricType, labelNames []string, f func() []MetricSample) {
+	registerMetric(name, &metricFunc{name, help, metricType, labelNames, f})
+}
+
+func (m *metricFunc) writeMetric(w *bufio.Writer) {
+	writeMetricHeader(w, m.name, m.help, m.metricType)
+	for _, sample := range m.f() {
+		fmt.Fprintf(w, "%s%s %s\n", m.name, formatLabels(m.labelNames, sample.LabelValues, "", ""), formatMetricValue(sample.Value))
+	}
+}
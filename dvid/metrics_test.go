@@ -0,0 +1,60 @@
+package dvid
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	counter := NewCounterVec("test_requests_total", "Number of test requests.", "method", "path")
+	counter.Inc("GET", "/a")
+	counter.Inc("GET", "/a")
+	counter.Add(3, "POST", `/b"c`)
+	counter.Inc("GET") // bad number of labels is ignored
+	if counter.Value("GET", "/a") != 2 {
+		t.Fatalf("expected count of 2, got %f\n", counter.Value("GET", "/a"))
+	}
+
+	histogram := NewHistogramVec("test_latency_seconds", "Test latency.", []float64{1, 0.1}, "op")
+	histogram.Observe(0.05, "get")
+	histogram.Observe(0.5, "get")
+	histogram.Observe(5, "get")
+
+	RegisterMetricFunc("test_queue_depth", "Test queue depth.", GaugeMetric, nil, func() []MetricSample {
+		return []MetricSample{{Value: 7}}
+	})
+
+	var buf bytes.Buffer
+	if err := WriteMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	expected := []string{
+		"# HELP test_requests_total Number of test requests.\n# TYPE test_requests_total counter\n",
+		`test_requests_total{method="GET",path="/a"} 2` + "\n",
+		`test_requests_total{method="POST",path="/b\"c"} 3` + "\n",
+		"# TYPE test_latency_seconds histogram\n",
+		`test_latency_seconds_bucket{op="get",le="0.1"} 1` + "\n",
+		`test_latency_seconds_bucket{op="get",le="1"} 2` + "\n",
+		`test_latency_seconds_bucket{op="get",le="+Inf"} 3` + "\n",
+		`test_latency_seconds_sum{op="get"} 5.55` + "\n",
+		`test_latency_seconds_count{op="get"} 3` + "\n",
+		"# TYPE test_queue_depth gauge\ntest_queue_depth 7\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected %q in metrics output:\n%s\n", line, out)
+		}
+	}
+	if strings.Index(out, "test_latency_seconds") > strings.Index(out, "test_requests_total") {
+		t.Errorf("expected metrics sorted by name:\n%s\n", out)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on duplicate metric registration\n")
+		}
+	}()
+	NewCounterVec("test_requests_total", "duplicate")
+}
@@ -9,6 +9,7 @@ require (
 	github.com/BurntSushi/toml v1.0.0
 	github.com/DmitriyVTitov/size v1.5.0
 	github.com/Shopify/sarama v1.32.0
+	github.com/aws/aws-sdk-go v1.40.34
 	github.com/blang/semver v3.5.1+incompatible
 	github.com/coocood/freecache v1.2.1
 	github.com/dgraph-io/badger/v3 v3.2103.2
@@ -41,7 +42,6 @@ require (
 	cloud.google.com/go v0.100.2 // indirect
 	cloud.google.com/go/compute v1.5.0 // indirect
 	cloud.google.com/go/iam v0.1.1 // indirect
-	github.com/aws/aws-sdk-go v1.40.34 // indirect
 	github.com/aws/aws-sdk-go-v2 v1.9.0 // indirect
 	github.com/aws/aws-sdk-go-v2/config v1.7.0 // indirect
 	github.com/aws/aws-sdk-go-v2/credentials v1.4.0 // indirect
@@ -0,0 +1,205 @@
+/*
+	This file supports a local append-only audit log of mutating HTTP requests that
+	can be queried via the /api/server/audit endpoint.
+*/
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/zenazn/goji/web"
+)
+
+// AuditRecord describes a mutating request and is stored as one JSON line in the audit log.
+type AuditRecord struct {
+	Time       time.Time
+	User       string
+	UUID       dvid.UUID         `json:",omitempty"`
+	Instance   dvid.InstanceName `json:",omitempty"`
+	Method     string
+	Endpoint   string  // URL path of request
+	BytesIn    int64   // payload size or -1 if unknown
+	Status     int     // HTTP status code of response
+	DurationMs float64 // time to handle request in milliseconds
+	RemoteAddr string
+}
+
+var auditLog struct {
+	sync.Mutex
+	filename string
+	f        *os.File
+}
+
+// openAuditLog opens the audit log file for appending, creating it if necessary.
+func openAuditLog(filename string) error {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open audit log %q: %v", filename, err)
+	}
+	auditLog.Lock()
+	if auditLog.f != nil {
+		auditLog.f.Close()
+	}
+	auditLog.filename = filename
+	auditLog.f = f
+	auditLog.Unlock()
+	dvid.Infof("Logging mutating requests to audit log %q\n", filename)
+	return nil
+}
+
+func closeAuditLog() {
+	auditLog.Lock()
+	if auditLog.f != nil {
+		auditLog.f.Close()
+		auditLog.f = nil
+	}
+	auditLog.filename = ""
+	auditLog.Unlock()
+}
+
+// auditRequest appends a record of a request to the audit log if it's enabled.  The user is
+// taken from an authenticated JWT or, if not available, the "u" query string.
+func auditRequest(c *web.C, r *http.Request, uuid dvid.UUID, dataname dvid.InstanceName, w *wrappedResponseWriter, t0 time.Time) {
+	auditLog.Lock()
+	defer auditLog.Unlock()
+	if auditLog.f == nil {
+		return
+	}
+	user, ok := c.Env["user"].(string)
+	if !ok || user == "" {
+		user = r.URL.Query().Get("u")
+	}
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	rec := AuditRecord{
+		Time:       t0,
+		User:       user,
+		UUID:       uuid,
+		Instance:   dataname,
+		Method:     r.Method,
+		Endpoint:   r.URL.Path,
+		BytesIn:    r.ContentLength,
+		Status:     status,
+		DurationMs: time.Since(t0).Seconds() * 1000.0,
+		RemoteAddr: r.RemoteAddr,
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		dvid.Errorf("unable to encode audit record %v: %v\n", rec, err)
+		return
+	}
+	if _, err := auditLog.f.Write(append(line, '\n')); err != nil {
+		dvid.Errorf("unable to write to audit log %q: %v\n", auditLog.filename, err)
+	}
+}
+
+// AuditQuery selects records from the audit log.  Zero values match all records.
+type AuditQuery struct {
+	User     string
+	UUID     string // full or partial UUID
+	Instance dvid.InstanceName
+	Since    time.Time
+	Until    time.Time
+}
+
+func (q AuditQuery) matches(rec *AuditRecord) bool {
+	if q.User != "" && rec.User != q.User {
+		return false
+	}
+	if q.UUID != "" && !strings.HasPrefix(string(rec.UUID), q.UUID) {
+		return false
+	}
+	if q.Instance != "" && rec.Instance != q.Instance {
+		return false
+	}
+	if !q.Since.IsZero() && rec.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && rec.Time.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// ReadAuditLog returns the audit records matching the query in the order they were logged.
+func ReadAuditLog(q AuditQuery) ([]AuditRecord, error) {
+	auditLog.Lock()
+	filename := auditLog.filename
+	auditLog.Unlock()
+	if filename == "" {
+		return nil, fmt.Errorf("no audit log has been configured")
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records := []AuditRecord{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			dvid.Errorf("skipping bad line in audit log %q: %s\n", filename, scanner.Text())
+			continue
+		}
+		if q.matches(&rec) {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// parses a time given as RFC3339 or Unix seconds.
+func parseAuditTime(s string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func serverAuditHandler(c web.C, w http.ResponseWriter, r *http.Request) {
+	queryStrings := r.URL.Query()
+	q := AuditQuery{
+		User:     queryStrings.Get("user"),
+		UUID:     queryStrings.Get("uuid"),
+		Instance: dvid.InstanceName(queryStrings.Get("instance")),
+	}
+	var err error
+	if since := queryStrings.Get("since"); since != "" {
+		if q.Since, err = parseAuditTime(since); err != nil {
+			BadRequest(w, r, "bad 'since' time %q: %v", since, err)
+			return
+		}
+	}
+	if until := queryStrings.Get("until"); until != "" {
+		if q.Until, err = parseAuditTime(until); err != nil {
+			BadRequest(w, r, "bad 'until' time %q: %v", until, err)
+			return
+		}
+	}
+	records, err := ReadAuditLog(q)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	jsonBytes, err := json.Marshal(records)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+)
+
+func getAuditRecords(t *testing.T, query string) []AuditRecord {
+	if query == "" {
+		query = "?admintoken=" + adminToken
+	} else {
+		query += "&admintoken=" + adminToken
+	}
+	data := TestHTTP(t, "GET", WebAPIPath+"server/audit"+query, nil)
+	var records []AuditRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatalf("bad audit response: %s\n", string(data))
+	}
+	return records
+}
+
+func TestAuditLog(t *testing.T) {
+	if err := OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer CloseTest()
+
+	oldToken := adminToken
+	adminToken = "my-secret-token"
+	defer func() { adminToken = oldToken }()
+
+	TestBadHTTP(t, "GET", WebAPIPath+"server/audit?admintoken="+adminToken, nil)
+
+	if err := openAuditLog(filepath.Join(t.TempDir(), "audit.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	defer closeAuditLog()
+
+	uuid1, _ := datastore.NewTestRepo()
+	uuid2, _ := datastore.NewTestRepo()
+	start := time.Now().Add(-time.Second)
+
+	infoURL := fmt.Sprintf("%srepo/%s/info?u=alice", WebAPIPath, uuid1)
+	TestHTTP(t, "POST", infoURL, bytes.NewBufferString(`{"alias":"first"}`))
+	TestHTTP(t, "GET", infoURL, nil)
+	noteURL := fmt.Sprintf("%snode/%s/note?u=bob", WebAPIPath, uuid2)
+	TestHTTP(t, "POST", noteURL, bytes.NewBufferString(`{"note": "a note"}`))
+	TestHTTP(t, "GET", noteURL, nil)
+	badURL := fmt.Sprintf("%snode/%s/note?u=alice", WebAPIPath, uuid2)
+	TestBadHTTP(t, "POST", badURL, bytes.NewBufferString(`not json`))
+
+	records := getAuditRecords(t, "")
+	if len(records) != 3 {
+		t.Fatalf("expected 3 audit records, got %v\n", records)
+	}
+	rec := records[0]
+	if rec.User != "alice" || rec.UUID != uuid1 || rec.Method != "POST" || rec.Status != 200 ||
+		rec.Endpoint != fmt.Sprintf("%srepo/%s/info", WebAPIPath, uuid1) || rec.BytesIn != 17 {
+		t.Fatalf("bad audit record: %v\n", rec)
+	}
+	if records[2].Status != 400 || records[2].UUID != uuid2 {
+		t.Fatalf("bad audit record for failed request: %v\n", records[2])
+	}
+
+	if records = getAuditRecords(t, "?user=alice"); len(records) != 2 {
+		t.Fatalf("expected 2 records for alice, got %v\n", records)
+	}
+	query := fmt.Sprintf("?user=alice&uuid=%s", uuid2[:8])
+	if records = getAuditRecords(t, query); len(records) != 1 || records[0].Status != 400 {
+		t.Fatalf("expected 1 record for alice on %s, got %v\n", uuid2, records)
+	}
+	query = fmt.Sprintf("?since=%d", start.Unix())
+	if records = getAuditRecords(t, query); len(records) != 3 {
+		t.Fatalf("expected 3 records since %s, got %v\n", start, records)
+	}
+	query = fmt.Sprintf("?until=%s", start.Format(time.RFC3339))
+	if records = getAuditRecords(t, query); len(records) != 0 {
+		t.Fatalf("expected no records until %s, got %v\n", start, records)
+	}
+	TestBadHTTP(t, "GET", WebAPIPath+"server/audit?since=yesterday&admintoken="+adminToken, nil)
+
+	// Audit log is only available with admin privileges.
+	TestBadHTTP(t, "GET", WebAPIPath+"server/audit", nil)
+	TestBadHTTP(t, "GET", WebAPIPath+"server/audit?admintoken=wrong", nil)
+}
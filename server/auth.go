@@ -11,7 +11,6 @@ import (
 	"sync"
 	"time"
 
-	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/zenazn/goji/web"
@@ -31,10 +30,128 @@ func init() {
 	jwtSecretKey = os.Getenv(SecretKeyVarName)
 }
 
+// permission is a set of privileges for reading, writing, and administering.
+type permission uint8
+
+const (
+	permRead permission = 1 << iota
+	permWrite
+	permAdmin
+)
+
+// parsePermission converts a privilege string from the auth file into a permission.
+// An "admin" privilege includes reading and writing.
+func parsePermission(priv string) (permission, error) {
+	switch priv {
+	case "none":
+		return 0, nil
+	case "read":
+		return permRead, nil
+	case "write":
+		return permWrite, nil
+	case "readwrite":
+		return permRead | permWrite, nil
+	case "admin":
+		return permRead | permWrite | permAdmin, nil
+	default:
+		return 0, fmt.Errorf("unknown privilege %q", priv)
+	}
+}
+
+// userACL holds a user's privileges for the server and for particular repos, identified
+// by root UUID, and data instances within them.  The most specific matching scope is used.
+type userACL struct {
+	server    *permission           // privilege for any repo not otherwise specified
+	repos     map[string]permission // keyed by root UUID or a unique prefix of it
+	instances map[string]permission // keyed by "<root UUID>/<data name>"
+}
+
+// UnmarshalJSON accepts either a privilege string that applies to the whole server or
+// an object with optional "server", "repos", and "instances" fields.
+func (acl *userACL) UnmarshalJSON(b []byte) error {
+	var priv string
+	if err := json.Unmarshal(b, &priv); err == nil {
+		perm, err := parsePermission(priv)
+		if err != nil {
+			return err
+		}
+		acl.server = &perm
+		return nil
+	}
+	var scoped struct {
+		Server    string
+		Repos     map[string]string
+		Instances map[string]string
+	}
+	if err := json.Unmarshal(b, &scoped); err != nil {
+		return fmt.Errorf("user privileges must be string or object with server, repos, or instances: %v", err)
+	}
+	if scoped.Server != "" {
+		perm, err := parsePermission(scoped.Server)
+		if err != nil {
+			return err
+		}
+		acl.server = &perm
+	}
+	acl.repos = make(map[string]permission, len(scoped.Repos))
+	for root, priv := range scoped.Repos {
+		perm, err := parsePermission(priv)
+		if err != nil {
+			return fmt.Errorf("repo %s: %v", root, err)
+		}
+		acl.repos[root] = perm
+	}
+	acl.instances = make(map[string]permission, len(scoped.Instances))
+	for key, priv := range scoped.Instances {
+		if !strings.Contains(key, "/") {
+			return fmt.Errorf("instance ACL %q should be of form <root UUID>/<data name>", key)
+		}
+		perm, err := parsePermission(priv)
+		if err != nil {
+			return fmt.Errorf("instance %s: %v", key, err)
+		}
+		acl.instances[key] = perm
+	}
+	return nil
+}
+
+// returns the permission for the most specific scope matching the repo root and data
+// instance, preferring the longest matching root UUID prefix.  If no scope matches,
+// found is false.
+func (acl userACL) permission(root dvid.UUID, dataname dvid.InstanceName) (perm permission, found bool) {
+	if dataname != "" {
+		var matchLen int
+		for key, instancePerm := range acl.instances {
+			prefix, name, _ := strings.Cut(key, "/")
+			if name == string(dataname) && len(prefix) > matchLen && strings.HasPrefix(string(root), prefix) {
+				perm, found, matchLen = instancePerm, true, len(prefix)
+			}
+		}
+		if found {
+			return
+		}
+	}
+	if root != "" {
+		var matchLen int
+		for prefix, repoPerm := range acl.repos {
+			if len(prefix) > matchLen && strings.HasPrefix(string(root), prefix) {
+				perm, found, matchLen = repoPerm, true, len(prefix)
+			}
+		}
+		if found {
+			return
+		}
+	}
+	if acl.server != nil {
+		return *acl.server, true
+	}
+	return 0, false
+}
+
 // authorization data handling both public versions and user-specific permissions.
 type authData struct {
 	sync.RWMutex
-	users  map[string]string
+	users  map[string]userACL
 	public dvid.UUIDSet
 }
 
@@ -42,6 +159,12 @@ func (auth *authData) initialize() error {
 	if err := auth.loadAuthFile(); err != nil {
 		return err
 	}
+	if err := loadTokenKeys(); err != nil {
+		return err
+	}
+	if err := loadRevocationFile(); err != nil {
+		return err
+	}
 	auth.Lock()
 	auth.public = make(dvid.UUIDSet)
 	for _, uuidStr := range tc.Auth.PublicVersions {
@@ -66,15 +189,20 @@ func (auth *authData) loadAuthFile() error {
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 	data, err := ioutil.ReadAll(f)
 	if err != nil {
 		return err
 	}
+	users := make(map[string]userACL)
+	if err := json.Unmarshal(data, &users); err != nil {
+		return fmt.Errorf("bad auth file %q: %v", tc.Auth.AuthFile, err)
+	}
 	auth.Lock()
-	auth.users = make(map[string]string)
-	err = json.Unmarshal(data, auth)
+	auth.users = users
 	auth.Unlock()
-	return err
+	dvid.Infof("Loaded authorizations for %d users from %q\n", len(users), tc.Auth.AuthFile)
+	return nil
 }
 
 // authConfig holds information on what server to contact for login and other auth settings
@@ -85,23 +213,30 @@ type authConfig struct {
 	Enforce        string   `toml:"enforce"` // either "none", "token" or "authfile"
 
 	NoEnforce bool `toml:"no_enforce"` // legacy: if true, accept all requests
+
+	PrivateKeyFile string `toml:"private_key_file"` // PEM RSA or ECDSA key for signing tokens
+	PublicKeyFile  string `toml:"public_key_file"`  // PEM public key if only verifying tokens
+	TokenIssuer    string `toml:"token_issuer"`     // "iss" claim of issued and accepted tokens
+	TokenLifetime  string `toml:"token_lifetime"`   // duration like "8h" of issued tokens
+	RevocationFile string `toml:"revocation_file"`  // revoked tokens and users
 }
 
-// generateJWT returns a JWT given a user and secret key string
-func generateJWT(user string) (string, error) {
-	if jwtSecretKey == "" {
-		return "", fmt.Errorf("Auth token support requires env variable %q to be set", SecretKeyVarName)
+// enforcement returns "none", "token", or "authfile" depending on the configuration.
+// Without an explicit setting, tokens are only required when a proxy server is used.
+func (ac authConfig) enforcement() string {
+	enforce := strings.ToLower(ac.Enforce)
+	if enforce == "" {
+		if ac.NoEnforce || len(ac.ProxyAddress) == 0 {
+			return "none"
+		}
+		return "token"
 	}
-	token := jwt.New(jwt.SigningMethodRS512)
-
-	claims := token.Claims.(jwt.MapClaims)
-	claims["user"] = user
+	return enforce
+}
 
-	tokenString, err := token.SignedString([]byte(jwtSecretKey))
-	if err != nil {
-		return "", fmt.Errorf("error with JWT signing: %v", err)
-	}
-	return tokenString, nil
+// enabled returns true if requests are checked for authorization.
+func (ac authConfig) enabled() bool {
+	return len(ac.ProxyAddress) != 0 || ac.enforcement() != "none"
 }
 
 // isPublic returns true if the request is a read and the version is
@@ -133,53 +268,19 @@ func isAuthorized(c *web.C, h http.Handler) http.Handler {
 			h.ServeHTTP(w, r)
 			return
 		}
-		reqToken := r.Header.Get("Authorization")
-		enforce := strings.ToLower(tc.Auth.Enforce)
-		if tc.Auth.NoEnforce && enforce == "" {
-			enforce = "none"
-		}
+		enforce := tc.Auth.enforcement()
 		if enforce == "none" {
 			h.ServeHTTP(w, r)
 			return
 		}
-		if len(reqToken) == 0 {
-			BadRequest(w, r, "JWT required via Authorization in request header")
-			return
-		}
-		splitToken := strings.Split(reqToken, "Bearer")
-		if len(splitToken) != 2 {
-			BadRequest(w, r, "bearer not in proper format")
+		user, err := jwtUser(r)
+		if err != nil {
+			BadRequest(w, r, err)
 			return
 		}
-		reqToken = strings.TrimSpace(splitToken[1])
-		if len(reqToken) != 0 {
-			token, err := jwt.Parse(reqToken, func(token *jwt.Token) (interface{}, error) {
-				return []byte(jwtSecretKey), nil
-			})
-			if err != nil {
-				BadRequest(w, r, "error parsing JWT: %v", err)
-				return
-			}
-			if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-				userClaim, found := claims["user"]
-				if found {
-					c.Env["user"] = userClaim
-				}
-				user, ok := userClaim.(string)
-				if !ok {
-					BadRequest(w, r, "user %v is not a simple string", user)
-					return
-				}
-				if enforce == "authfile" && !userIsAuthorized(user, r.Method) {
-					BadRequest(w, r, "user %q is not authorized", user)
-					return
-				}
-			} else {
-				BadRequest(w, r, "failed authorization")
-				return
-			}
-		} else {
-			BadRequest(w, r, "requests require JWT authentication")
+		c.Env["user"] = user
+		if enforce == "authfile" && !userIsAuthorized(c, user, r) {
+			BadRequest(w, r, "user %q is not authorized", user)
 			return
 		}
 		h.ServeHTTP(w, r)
@@ -187,38 +288,112 @@ func isAuthorized(c *web.C, h http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
-// userIsAuthorized returns true if the user is in our authorization file
-func userIsAuthorized(user string, httpMethod string) bool {
-	if len(authorizations.users) == 0 {
-		return false
+// jwtUser returns the user given by a valid JWT in the request's Authorization header.
+func jwtUser(r *http.Request) (string, error) {
+	reqToken := r.Header.Get("Authorization")
+	if len(reqToken) == 0 {
+		return "", fmt.Errorf("JWT required via Authorization in request header")
 	}
-	authorizations.RLock()
-	priv, found := authorizations.users[user]
-	authorizations.RUnlock()
-	if !found {
-		authorizations.RLock()
-		priv, found = authorizations.users["*"]
-		authorizations.RUnlock()
-		if !found {
-			return false
+	splitToken := strings.Split(reqToken, "Bearer")
+	if len(splitToken) != 2 {
+		return "", fmt.Errorf("bearer not in proper format")
+	}
+	reqToken = strings.TrimSpace(splitToken[1])
+	if len(reqToken) == 0 {
+		return "", fmt.Errorf("requests require JWT authentication")
+	}
+	user, err := validateJWT(reqToken)
+	if err != nil {
+		return "", fmt.Errorf("failed authorization: %v", err)
+	}
+	return user, nil
+}
+
+// requireAdmin wraps a handler so it is only served for requests with admin privileges,
+// either through the admin token or, when an authorization file is enforced, a JWT for
+// a user with server-wide admin permission.
+func requireAdmin(h func(web.C, http.ResponseWriter, *http.Request)) func(web.C, http.ResponseWriter, *http.Request) {
+	return func(c web.C, w http.ResponseWriter, r *http.Request) {
+		if adminPriv, _ := c.Env["adminPriv"].(bool); adminPriv {
+			h(c, w, r)
+			return
+		}
+		if tc.Auth.enforcement() != "authfile" {
+			BadRequest(w, r, "request requires admin privileges via admintoken")
+			return
+		}
+		user, err := jwtUser(r)
+		if err != nil {
+			BadRequest(w, r, err)
+			return
+		}
+		if !authorizations.userPermitted(user, "", "", permAdmin) {
+			BadRequest(w, r, "user %q does not have admin privileges", user)
+			return
 		}
+		c.Env["user"] = user
+		h(c, w, r)
 	}
-	var readReq bool
-	switch httpMethod {
+}
+
+// requiredPermission returns the permission needed for a request given its HTTP method
+// and the action for repo and node requests.  Creating data instances and changing the
+// version DAG require admin privileges.
+func requiredPermission(method, action string) permission {
+	switch method {
 	case http.MethodGet, http.MethodHead, http.MethodOptions:
-		readReq = true
+		return permRead
 	}
-	switch priv {
-	case "readwrite":
+	switch action {
+	case "instance", "merge", "resolve", "commit", "branch", "newversion":
+		return permAdmin
+	}
+	return permWrite
+}
+
+// hasUser returns true if the user or the wildcard "*" user is in the authorization file.
+func (auth *authData) hasUser(user string) bool {
+	auth.RLock()
+	defer auth.RUnlock()
+	if _, found := auth.users[user]; found {
 		return true
-	case "read":
-		return readReq
-	case "write":
-		return !readReq
-	default:
-		dvid.Errorf("Authorized user %q has unparsable privilege %q\n", user, priv)
-		return false
 	}
+	_, found := auth.users["*"]
+	return found
+}
+
+// userPermitted returns true if the user, or the wildcard "*" user if the user isn't in the
+// authorization file, has the needed permission for the repo and data instance.
+func (auth *authData) userPermitted(user string, root dvid.UUID, dataname dvid.InstanceName, needed permission) bool {
+	auth.RLock()
+	defer auth.RUnlock()
+	acl, found := auth.users[user]
+	if !found {
+		if acl, found = auth.users["*"]; !found {
+			return false
+		}
+	}
+	perm, found := acl.permission(root, dataname)
+	return found && perm&needed == needed
+}
+
+// userIsAuthorized returns true if the user is granted the privileges needed for the request
+// within the repo and data instance, if any, that it addresses.
+func userIsAuthorized(c *web.C, user string, r *http.Request) bool {
+	var root dvid.UUID
+	if uuid, ok := c.Env["uuid"].(dvid.UUID); ok {
+		var err error
+		if root, err = datastore.GetRepoRoot(uuid); err != nil {
+			dvid.Errorf("unable to get root of version %s for authorization: %v\n", uuid, err)
+			return false
+		}
+	}
+	dataname := dvid.InstanceName(c.URLParams["dataname"])
+	var action string
+	if dataname == "" {
+		action = c.URLParams["action"]
+	}
+	return authorizations.userPermitted(user, root, dataname, requiredPermission(r.Method, action))
 }
 
 // contacts proxy server and returns email
@@ -287,6 +462,11 @@ func serverTokenHandler(w http.ResponseWriter, r *http.Request) {
 		email = tokenInfo.Email
 	}
 
+	if tc.Auth.enforcement() == "authfile" && !authorizations.hasUser(email) {
+		BadRequest(w, r, "user %q is not in authorization file", email)
+		return
+	}
+
 	// generate JWT
 	tokenString, err := generateJWT(email)
 	if err != nil {
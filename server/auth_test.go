@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/zenazn/goji/web"
+)
+
+func TestAuthFileACLs(t *testing.T) {
+	if err := OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer CloseTest()
+
+	root, _ := datastore.NewTestRepo()
+	if err := datastore.Commit(root, "base", nil); err != nil {
+		t.Fatalf("unable to commit root: %v\n", err)
+	}
+	child, err := datastore.NewVersion(root, "child", "", nil)
+	if err != nil {
+		t.Fatalf("unable to create child version: %v\n", err)
+	}
+	otherRoot, _ := datastore.NewTestRepo()
+
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	authJSON := fmt.Sprintf(`{
+		"legacy@example.org": "readwrite",
+		"writer@example.org": "write",
+		"scoped@example.org": {
+			"server": "read",
+			"repos": {"%s": "readwrite"},
+			"instances": {"%s/segmentation": "admin", "%s/secret": "none"}
+		},
+		"*": {"repos": {"%s": "read"}}
+	}`, root[:8], root, root[:6], otherRoot)
+	if err := os.WriteFile(authFile, []byte(authJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldAuth := tc.Auth
+	defer func() {
+		tc.Auth = oldAuth
+		authorizations.users = nil
+	}()
+	tc.Auth.AuthFile = authFile
+	if err := authorizations.loadAuthFile(); err != nil {
+		t.Fatalf("unable to load auth file: %v\n", err)
+	}
+
+	tests := []struct {
+		user     string
+		uuid     dvid.UUID
+		dataname string
+		action   string
+		method   string
+		expected bool
+	}{
+		{"legacy@example.org", child, "grayscale", "", http.MethodPost, true},
+		{"legacy@example.org", child, "", "newversion", http.MethodPost, false},
+		{"writer@example.org", root, "grayscale", "", http.MethodGet, false},
+		{"writer@example.org", root, "grayscale", "", http.MethodPost, true},
+		{"scoped@example.org", child, "grayscale", "", http.MethodPost, true},
+		{"scoped@example.org", child, "", "commit", http.MethodPost, false},
+		{"scoped@example.org", child, "segmentation", "", http.MethodDelete, true},
+		{"scoped@example.org", child, "secret", "", http.MethodGet, false},
+		{"scoped@example.org", otherRoot, "grayscale", "", http.MethodGet, true},
+		{"scoped@example.org", otherRoot, "grayscale", "", http.MethodPost, false},
+		{"scoped@example.org", otherRoot, "", "info", http.MethodGet, true},
+		{"unknown@example.org", otherRoot, "grayscale", "", http.MethodGet, true},
+		{"unknown@example.org", otherRoot, "grayscale", "", http.MethodPost, false},
+		{"unknown@example.org", root, "grayscale", "", http.MethodGet, false},
+	}
+	for _, test := range tests {
+		c := &web.C{
+			Env:       map[interface{}]interface{}{"uuid": test.uuid},
+			URLParams: map[string]string{"dataname": test.dataname, "action": test.action},
+		}
+		r, err := http.NewRequest(test.method, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authorized := userIsAuthorized(c, test.user, r); authorized != test.expected {
+			t.Errorf("%s %s on version %s, data %q, action %q: expected authorized %t, got %t\n",
+				test.user, test.method, test.uuid, test.dataname, test.action, test.expected, authorized)
+		}
+	}
+
+	// reload with changed privileges
+	if err := os.WriteFile(authFile, []byte(`{"writer@example.org": "admin"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	TestHTTP(t, "POST", WebAPIPath+"server/reload-auth", nil)
+	if !authorizations.userPermitted("writer@example.org", root, "", permAdmin) {
+		t.Errorf("expected admin privileges after reload\n")
+	}
+	if authorizations.userPermitted("legacy@example.org", root, "grayscale", permRead) {
+		t.Errorf("expected removal of user after reload\n")
+	}
+
+	// bad privileges should not replace current authorizations
+	if err := os.WriteFile(authFile, []byte(`{"writer@example.org": "superuser"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	TestBadHTTP(t, "POST", WebAPIPath+"server/reload-auth", nil)
+	if !authorizations.userPermitted("writer@example.org", root, "", permAdmin) {
+		t.Errorf("expected admin privileges retained after bad reload\n")
+	}
+}
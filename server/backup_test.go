@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+)
+
+func TestBackupEndpoint(t *testing.T) {
+	if err := OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer CloseTest()
+
+	oldToken, oldDir := adminToken, tc.Server.BackupDir
+	defer func() {
+		adminToken, tc.Server.BackupDir = oldToken, oldDir
+	}()
+	adminToken = "my-secret-token"
+	tc.Server.BackupDir = ""
+
+	datastore.NewTestRepo()
+
+	backupURL := WebAPIPath + "server/backup?admintoken=" + adminToken
+	payload := `{"path": "backup.tar"}`
+
+	// Backups via HTTP require a configured backup directory and admin privileges.
+	TestBadHTTP(t, "POST", backupURL, strings.NewReader(payload))
+	tc.Server.BackupDir = t.TempDir()
+	TestBadHTTP(t, "POST", WebAPIPath+"server/backup", strings.NewReader(payload))
+	TestBadHTTP(t, "GET", WebAPIPath+"server/backup", nil)
+
+	// Paths must stay within the backup directory.
+	outside := filepath.Join(t.TempDir(), "backup.tar")
+	TestBadHTTP(t, "POST", backupURL, strings.NewReader(fmt.Sprintf(`{"path": %q}`, outside)))
+	TestBadHTTP(t, "POST", backupURL, strings.NewReader(`{"path": "../backup.tar"}`))
+	TestBadHTTP(t, "POST", backupURL, strings.NewReader(`{"path": "sub/../../backup.tar"}`))
+	TestBadHTTP(t, "POST", backupURL, strings.NewReader(`{"path": ""}`))
+
+	TestHTTP(t, "POST", backupURL, strings.NewReader(payload))
+
+	path := filepath.Join(tc.Server.BackupDir, "backup.tar")
+	var status datastore.BackupStatus
+	for i := 0; i < 100; i++ {
+		data := TestHTTP(t, "GET", backupURL, nil)
+		if err := json.Unmarshal(data, &status); err != nil {
+			t.Fatalf("bad backup status response: %s\n", string(data))
+		}
+		if !status.Running {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if status.Running || status.Error != "" || status.Path != path || status.NumKV == 0 {
+		t.Fatalf("unexpected backup status: %v\n", status)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected backup archive at %q: %v\n", path, err)
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("expected no backup outside of backup directory at %q\n", outside)
+	}
+}
@@ -45,16 +45,23 @@ func loadBlockListFile() error {
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 	blockList.mu.Lock()
 	defer blockList.mu.Unlock()
 	blockList.users = make(map[string]string)
 	blockList.ips = make(map[string]string)
+	limits := newRateLimitConfig()
 
 	// read each line in block list file
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		line := scanner.Text()
 		switch {
+		case strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "limit="):
+			if err := limits.addLimit(line[6:]); err != nil {
+				return fmt.Errorf("bad rate limit line %q: %v", line, err)
+			}
 		case strings.HasPrefix(line, "u="):
 			if err := addBlock(blockList.users, line[2:]); err != nil {
 				return fmt.Errorf("bad user blocklist line: %s", line)
@@ -70,6 +77,7 @@ func loadBlockListFile() error {
 	if len(blockList.users) > 0 || len(blockList.ips) > 0 {
 		blockList.active = true
 	}
+	setRateLimits(limits)
 	return nil
 }
 
@@ -103,26 +111,30 @@ func blockedRequest(w http.ResponseWriter, r *http.Request) bool {
 func blockedIP(ip string) (string, bool) {
 	blockList.mu.RLock()
 	defer blockList.mu.RUnlock()
-	targetParts := strings.Split(ip, ".")
 	for blockIP, note := range blockList.ips {
-		match := true
-		parts := strings.Split(blockIP, ".")
-		for i := 0; i < len(parts); i++ {
-			if parts[i] == "*" {
-				continue
-			}
-			if parts[i] != targetParts[i] {
-				match = false
-				break
-			}
-		}
-		if match {
+		if ipMatches(blockIP, ip) {
 			return note, true
 		}
 	}
 	return "", false
 }
 
+// ipMatches returns true if the ip matches the pattern, where "*" matches any part,
+// e.g., "10.2.*.*" matches all IPs starting with "10.2.".
+func ipMatches(pattern, ip string) bool {
+	targetParts := strings.Split(ip, ".")
+	parts := strings.Split(pattern, ".")
+	for i := 0; i < len(parts); i++ {
+		if parts[i] == "*" {
+			continue
+		}
+		if i >= len(targetParts) || parts[i] != targetParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // See https://www.refactoredtelegram.net/2021/01/a-simple-source-ip-address-filter-in-go/
 func requestSourceIP(r *http.Request) (string, error) {
 	// Check the Forward header
@@ -0,0 +1,115 @@
+/*
+	This file exports server metrics in the Prometheus text format via the /metrics endpoint.
+*/
+
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/zenazn/goji/web"
+)
+
+var (
+	requestCount = dvid.NewCounterVec("dvid_http_requests_total",
+		"Number of HTTP requests by datatype, endpoint keyword, method and status code.",
+		"datatype", "keyword", "method", "code")
+
+	requestLatency = dvid.NewHistogramVec("dvid_http_request_duration_seconds",
+		"Latency of HTTP requests by datatype and endpoint keyword.",
+		dvid.DefaultLatencyBuckets, "datatype", "keyword")
+)
+
+func init() {
+	dvid.RegisterMetricFunc("dvid_chunk_handlers_active", "Number of chunk handlers currently in use.",
+		dvid.GaugeMetric, nil, func() []dvid.MetricSample {
+			return []dvid.MetricSample{{Value: float64(MaxChunkHandlers - len(HandlerToken))}}
+		})
+	dvid.RegisterMetricFunc("dvid_chunk_handlers_max", "Maximum number of chunk handlers.",
+		dvid.GaugeMetric, nil, func() []dvid.MetricSample {
+			return []dvid.MetricSample{{Value: float64(MaxChunkHandlers)}}
+		})
+	dvid.RegisterMetricFunc("dvid_throttled_ops_active", "Number of throttled CPU-heavy operations in progress.",
+		dvid.GaugeMetric, nil, func() []dvid.MetricSample {
+			curThrottleMu.Lock()
+			defer curThrottleMu.Unlock()
+			return []dvid.MetricSample{{Value: float64(curThrottledOps)}}
+		})
+	dvid.RegisterMetricFunc("dvid_throttled_ops_max", "Maximum number of concurrent throttled operations.",
+		dvid.GaugeMetric, nil, func() []dvid.MetricSample {
+			curThrottleMu.Lock()
+			defer curThrottleMu.Unlock()
+			return []dvid.MetricSample{{Value: float64(maxThrottledOps)}}
+		})
+	dvid.RegisterMetricFunc("dvid_interactive_requests_2min", "Number of interactive requests over the last 2 minutes.",
+		dvid.GaugeMetric, nil, func() []dvid.MetricSample {
+			return []dvid.MetricSample{{Value: float64(InteractiveOpsPer2Min)}}
+		})
+}
+
+var (
+	serverActionRegexp    = regexp.MustCompile(`/api/(?:server|repos|repo/\{uuid\}|node/\{uuid\})/([A-Za-z0-9_-]+)`)
+	datatypeKeywordRegexp = regexp.MustCompile(`<data name>/([A-Za-z0-9_-]+)`)
+
+	endpointKeywordsMu sync.Mutex
+	endpointKeywords   = make(map[dvid.TypeString]map[string]struct{})
+)
+
+// getEndpointKeywords returns the endpoint keywords documented in the help of a datatype
+// or, if the datatype is empty, of the server's own API.
+func getEndpointKeywords(datatype dvid.TypeString) map[string]struct{} {
+	endpointKeywordsMu.Lock()
+	defer endpointKeywordsMu.Unlock()
+	if keywords, found := endpointKeywords[datatype]; found {
+		return keywords
+	}
+	var matches [][]string
+	if datatype == "" {
+		matches = serverActionRegexp.FindAllStringSubmatch(webHelp, -1)
+	} else if t, err := datastore.TypeServiceByName(datatype); err == nil {
+		matches = datatypeKeywordRegexp.FindAllStringSubmatch(t.Help(), -1)
+	}
+	keywords := map[string]struct{}{"help": {}, "info": {}}
+	for _, match := range matches {
+		keywords[match[1]] = struct{}{}
+	}
+	endpointKeywords[datatype] = keywords
+	return keywords
+}
+
+// metricKeyword returns the keyword to use as a metric label, which is "other" for
+// keywords not documented for the datatype so arbitrary request paths can't create
+// unbounded numbers of time series.
+func metricKeyword(datatype dvid.TypeString, keyword string) string {
+	if keyword == "" {
+		return keyword
+	}
+	if _, found := getEndpointKeywords(datatype)[keyword]; found {
+		return keyword
+	}
+	return "other"
+}
+
+// observeRequest records the count and latency of a handled request.
+func observeRequest(datatype dvid.TypeString, keyword, method string, w *wrappedResponseWriter, t0 time.Time) {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	keyword = metricKeyword(datatype, keyword)
+	requestCount.Inc(string(datatype), keyword, method, strconv.Itoa(status))
+	requestLatency.Observe(time.Since(t0).Seconds(), string(datatype), keyword)
+}
+
+func metricsHandler(c web.C, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := dvid.WriteMetrics(w); err != nil {
+		dvid.Errorf("unable to write metrics: %v\n", err)
+	}
+}
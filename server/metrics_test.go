@@ -0,0 +1,56 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/datastore"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	if err := OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer CloseTest()
+
+	uuid, _ := datastore.NewTestRepo()
+	before := requestCount.Value("", "info", "GET", "200")
+	TestHTTP(t, "GET", WebAPIPath+"server/info", nil)
+	TestHTTP(t, "GET", fmt.Sprintf("%srepo/%s/info", WebAPIPath, uuid), nil)
+	if after := requestCount.Value("", "info", "GET", "200"); after != before+2 {
+		t.Fatalf("expected 2 more info requests counted, got %f -> %f\n", before, after)
+	}
+
+	// Undocumented keywords are counted as "other".
+	before = requestCount.Value("", "other", "GET", "404")
+	TestBadHTTP(t, "GET", WebAPIPath+"server/no-such-action", nil)
+	if after := requestCount.Value("", "other", "GET", "404"); after != before+1 {
+		t.Fatalf("expected 1 more other request counted, got %f -> %f\n", before, after)
+	}
+	if metricKeyword("", "backup") != "backup" {
+		t.Fatalf("expected documented server action to be kept as metric keyword\n")
+	}
+
+	out := string(TestHTTP(t, "GET", "/metrics", nil))
+	expected := []string{
+		`dvid_http_requests_total{datatype="",keyword="info",method="GET",code="200"}`,
+		`dvid_http_request_duration_seconds_count{datatype="",keyword="info"}`,
+		`dvid_http_request_duration_seconds_bucket{datatype="",keyword="info",le="+Inf"}`,
+		"dvid_chunk_handlers_active ",
+		fmt.Sprintf("dvid_chunk_handlers_max %d\n", MaxChunkHandlers),
+		"dvid_throttled_ops_active 0\n",
+		"dvid_throttled_ops_max ",
+		"dvid_interactive_requests_2min ",
+		`dvid_store_operations_total{store=`,
+		"# TYPE dvid_groupcache_hit_ratio gauge\n",
+	}
+	if strings.Contains(out, "no-such-action") {
+		t.Errorf("undocumented keyword used as label in /metrics output:\n%s\n", out)
+	}
+	for _, s := range expected {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected %q in /metrics output:\n%s\n", s, out)
+		}
+	}
+}
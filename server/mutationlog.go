@@ -182,6 +182,33 @@ func StreamMutationsForSequence(w io.Writer, dataID dvid.UUID, sequence []dvid.U
 	return err
 }
 
+// ReadMutationsForSequence returns the JSON mutation records for the given data instance
+// across the sequence of versions, in the order of the sequence and the order each record
+// was logged within a version.
+func ReadMutationsForSequence(dataID dvid.UUID, sequence []dvid.UUID) ([][]byte, error) {
+	if tc.Mutations.Jsonstore == "" {
+		return nil, fmt.Errorf("no jsonstore configured in [mutations] section of TOML config")
+	}
+	ch := make(chan []byte, 100)
+	done := make(chan struct{})
+	var records [][]byte
+	go func() {
+		for data := range ch {
+			records = append(records, append([]byte{}, data...))
+		}
+		close(done)
+	}()
+	var err error
+	for _, uuid := range sequence {
+		if _, err = sendVersionMutations(ch, uuid, dataID); err != nil {
+			break
+		}
+	}
+	close(ch)
+	<-done
+	return records, err
+}
+
 // sends JSON mutation records from one UUID to the channel.
 func sendVersionMutations(ch chan []byte, uuid, dataID dvid.UUID) (numMutations int, err error) {
 	lf, err := getJSONLogFile(uuid, dataID)
@@ -0,0 +1,298 @@
+/*
+	This file implements token-bucket rate limiting per user and per client IP.  Limits are
+	read from "limit=" lines in the blocklist file and reloaded with it.
+*/
+
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// Request classes for rate limits.  Every request counts against the "all" budget while
+// heavy requests also count against a separate "heavy" budget.
+const (
+	allRequests   = "all"
+	heavyRequests = "heavy"
+)
+
+// maxRateBuckets is the number of token buckets above which full buckets are discarded.
+const maxRateBuckets = 100000
+
+// endpoint keywords for data instances whose GET requests are considered heavy.
+var heavyKeywords = map[string]struct{}{
+	"raw":                {},
+	"isotropic":          {},
+	"sparsevol":          {},
+	"sparsevol-coarse":   {},
+	"sparsevols-coarse":  {},
+	"sparsevol-by-point": {},
+	"blocks":             {},
+	"specificblocks":     {},
+}
+
+var (
+	rateLimiter rateLimiterT
+
+	rateLimitedCount = dvid.NewCounterVec("dvid_rate_limited_requests_total",
+		"Number of requests rejected with 429 status due to rate limits by scope and request class.",
+		"scope", "class")
+)
+
+// rateLimit is a token-bucket limit.  A zero rate means no limit.
+type rateLimit struct {
+	rate  float64 // tokens added per second
+	burst float64 // maximum tokens in bucket
+}
+
+// rateLimits are keyed by request class.
+type rateLimits map[string]rateLimit
+
+type rateLimitConfig struct {
+	user  rateLimits            // default limits for each user
+	ip    rateLimits            // default limits for each IP
+	users map[string]rateLimits // limits for particular users
+	ips   map[string]rateLimits // limits for IPs matching a pattern like 10.1.*.*
+}
+
+func newRateLimitConfig() *rateLimitConfig {
+	return &rateLimitConfig{
+		user:  make(rateLimits),
+		ip:    make(rateLimits),
+		users: make(map[string]rateLimits),
+		ips:   make(map[string]rateLimits),
+	}
+}
+
+func (cfg *rateLimitConfig) empty() bool {
+	return len(cfg.user) == 0 && len(cfg.ip) == 0 && len(cfg.users) == 0 && len(cfg.ips) == 0
+}
+
+// addLimit parses the data of a blocklist line "limit=<scope>,<class>,<rate>,<burst>" where
+// scope is "user", "ip", "user:<user id>" or "ip:<ip pattern>", class is "all" or "heavy",
+// rate is requests per second, and burst is the maximum number of requests at once.
+func (cfg *rateLimitConfig) addLimit(data string) error {
+	parts := strings.Split(data, ",")
+	if len(parts) != 4 {
+		return fmt.Errorf("expected limit=<scope>,<class>,<rate>,<burst>")
+	}
+	class := strings.TrimSpace(parts[1])
+	if class != allRequests && class != heavyRequests {
+		return fmt.Errorf("request class must be %q or %q, not %q", allRequests, heavyRequests, class)
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+	if err != nil || rate < 0 {
+		return fmt.Errorf("bad rate %q", parts[2])
+	}
+	burst, err := strconv.ParseFloat(strings.TrimSpace(parts[3]), 64)
+	if err != nil || burst < 1 {
+		return fmt.Errorf("burst must be at least 1, not %q", parts[3])
+	}
+	limit := rateLimit{rate: rate, burst: burst}
+
+	scope := strings.TrimSpace(parts[0])
+	switch {
+	case scope == "user":
+		cfg.user[class] = limit
+	case scope == "ip":
+		cfg.ip[class] = limit
+	case strings.HasPrefix(scope, "user:"):
+		addScopedLimit(cfg.users, scope[5:], class, limit)
+	case strings.HasPrefix(scope, "ip:"):
+		addScopedLimit(cfg.ips, scope[3:], class, limit)
+	default:
+		return fmt.Errorf("bad limit scope %q", scope)
+	}
+	return nil
+}
+
+func addScopedLimit(m map[string]rateLimits, key, class string, limit rateLimit) {
+	limits, found := m[key]
+	if !found {
+		limits = make(rateLimits)
+		m[key] = limits
+	}
+	limits[class] = limit
+}
+
+// returns the limit for a user or IP and request class, with particular settings
+// taking precedence over defaults.
+func (cfg *rateLimitConfig) limitFor(scope, id, class string) (limit rateLimit, found bool) {
+	if scope == "user" {
+		if limits, ok := cfg.users[id]; ok {
+			if limit, found = limits[class]; found {
+				return
+			}
+		}
+		limit, found = cfg.user[class]
+		return
+	}
+	for pattern, limits := range cfg.ips {
+		if ipMatches(pattern, id) {
+			if limit, found = limits[class]; found {
+				return
+			}
+		}
+	}
+	limit, found = cfg.ip[class]
+	return
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	limit  rateLimit
+}
+
+// refill adds tokens accumulated since the last update.
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.limit.burst, b.tokens+now.Sub(b.last).Seconds()*b.limit.rate)
+	b.last = now
+}
+
+// returns the time until a token is available.
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.limit.rate * float64(time.Second))
+}
+
+type rateLimiterT struct {
+	mu      sync.Mutex
+	config  *rateLimitConfig
+	buckets map[string]*tokenBucket
+}
+
+// setRateLimits replaces the current limits and resets all token buckets.
+func setRateLimits(cfg *rateLimitConfig) {
+	rateLimiter.mu.Lock()
+	if cfg == nil || cfg.empty() {
+		rateLimiter.config = nil
+	} else {
+		rateLimiter.config = cfg
+	}
+	rateLimiter.buckets = make(map[string]*tokenBucket)
+	rateLimiter.mu.Unlock()
+}
+
+// returns true if the request is a GET on a heavy data instance endpoint.
+func isHeavyRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	path := strings.TrimPrefix(r.URL.Path, WebAPIPath+"node/")
+	if path == r.URL.Path {
+		return false
+	}
+	parts := strings.SplitN(path, "/", 4)
+	if len(parts) < 3 {
+		return false
+	}
+	_, found := heavyKeywords[parts[2]]
+	return found
+}
+
+// returns the user of a request from a valid JWT.  The unauthenticated "u" query string is
+// only used when authorization is disabled, since otherwise any client could evade its limits
+// or exhaust another user's budget.  Requests without a user are only limited per IP.
+func requestUser(r *http.Request) string {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		if strings.HasPrefix(authHeader, "Bearer") {
+			if user, err := validateJWT(strings.TrimSpace(authHeader[6:])); err == nil {
+				return user
+			}
+		}
+	}
+	if tc.Auth.enabled() {
+		return ""
+	}
+	return r.URL.Query().Get("u")
+}
+
+// rateLimitedRequest checks the request against any user and IP rate limits and, if any
+// budget is exhausted, sends a 429 (Too Many Requests) response with a Retry-After header.
+func rateLimitedRequest(w http.ResponseWriter, r *http.Request) bool {
+	rateLimiter.mu.Lock()
+	active := rateLimiter.config != nil
+	rateLimiter.mu.Unlock()
+	if !active {
+		return false
+	}
+
+	type requester struct{ scope, id string }
+	var requesters []requester
+	if user := requestUser(r); user != "" {
+		requesters = append(requesters, requester{"user", user})
+	}
+	if ip, err := requestSourceIP(r); err != nil {
+		dvid.Errorf("Error getting source IP for request: %v\n", err)
+	} else {
+		requesters = append(requesters, requester{"ip", ip})
+	}
+	classes := []string{allRequests}
+	if isHeavyRequest(r) {
+		classes = append(classes, heavyRequests)
+	}
+
+	now := time.Now()
+	rateLimiter.mu.Lock()
+	defer rateLimiter.mu.Unlock()
+	cfg := rateLimiter.config
+	if cfg == nil {
+		return false
+	}
+	if len(rateLimiter.buckets) > maxRateBuckets {
+		for key, b := range rateLimiter.buckets {
+			if b.refill(now); b.tokens >= b.limit.burst {
+				delete(rateLimiter.buckets, key)
+			}
+		}
+	}
+
+	// All applicable buckets must have a token before any are consumed.
+	var buckets []*tokenBucket
+	var wait time.Duration
+	var denied requester
+	var deniedClass string
+	for _, req := range requesters {
+		for _, class := range classes {
+			limit, found := cfg.limitFor(req.scope, req.id, class)
+			if !found || limit.rate == 0 {
+				continue
+			}
+			key := req.scope + "|" + class + "|" + req.id
+			b, found := rateLimiter.buckets[key]
+			if !found || b.limit != limit {
+				b = &tokenBucket{tokens: limit.burst, last: now, limit: limit}
+				rateLimiter.buckets[key] = b
+			}
+			b.refill(now)
+			if bw := b.wait(); bw > wait {
+				wait, denied, deniedClass = bw, req, class
+			}
+			buckets = append(buckets, b)
+		}
+	}
+	if wait == 0 {
+		for _, b := range buckets {
+			b.tokens--
+		}
+		return false
+	}
+	rateLimitedCount.Inc(denied.scope, deniedClass)
+	retrySecs := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retrySecs))
+	msg := fmt.Sprintf("Rate limit exceeded for %s %q on %s requests; retry after %d seconds",
+		denied.scope, denied.id, deniedClass, retrySecs)
+	http.Error(w, msg, http.StatusTooManyRequests)
+	return true
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/datastore"
+)
+
+func rateLimitTestRequest(t *testing.T, urlStr, ip string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", urlStr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Forwarded-For", ip)
+	w := httptest.NewRecorder()
+	ServeSingleHTTP(w, req)
+	return w
+}
+
+func TestRateLimits(t *testing.T) {
+	if err := OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer CloseTest()
+
+	oldBlockList := tc.Server.BlockListFile
+	defer func() {
+		tc.Server.BlockListFile = oldBlockList
+		setRateLimits(nil)
+	}()
+	tc.Server.BlockListFile = filepath.Join(t.TempDir(), "blocklist.csv")
+	limits := `# rate limits
+limit=user,all,0.01,2
+limit=user:bob,all,0,1
+
+limit=ip,heavy,0.01,1
+limit=ip:10.9.*.*,heavy,0,1
+`
+	if err := os.WriteFile(tc.Server.BlockListFile, []byte(limits), 0644); err != nil {
+		t.Fatal(err)
+	}
+	TestHTTP(t, "POST", WebAPIPath+"server/reload-blocklist", nil)
+
+	// default user limit with burst of 2
+	infoURL := WebAPIPath + "server/info?u=alice"
+	for i := 0; i < 2; i++ {
+		if w := rateLimitTestRequest(t, infoURL, "10.1.1.1"); w.Code != http.StatusOK {
+			t.Fatalf("expected request %d from alice to succeed, got status %d\n", i, w.Code)
+		}
+	}
+	w := rateLimitTestRequest(t, infoURL, "10.1.1.2")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after exceeding user burst, got status %d\n", w.Code)
+	}
+	if secs, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || secs < 1 {
+		t.Fatalf("bad Retry-After header: %q\n", w.Header().Get("Retry-After"))
+	}
+	if rateLimitedCount.Value("user", allRequests) < 1 {
+		t.Errorf("expected rate limited request to be counted\n")
+	}
+
+	// particular user with no limit
+	for i := 0; i < 5; i++ {
+		if w := rateLimitTestRequest(t, WebAPIPath+"server/info?u=bob", "10.1.1.1"); w.Code != http.StatusOK {
+			t.Fatalf("expected unlimited requests from bob, got status %d\n", w.Code)
+		}
+	}
+
+	// with authorization on, the "u" query string isn't trusted so only IP limits apply.
+	oldEnforce := tc.Auth.Enforce
+	tc.Auth.Enforce = "token"
+	for i := 0; i < 5; i++ {
+		if w := rateLimitTestRequest(t, infoURL, "10.1.1.4"); w.Code != http.StatusOK {
+			t.Fatalf("expected unauthenticated user to only be limited by IP, got status %d\n", w.Code)
+		}
+	}
+	tc.Auth.Enforce = oldEnforce
+
+	// heavy requests have a separate budget per IP.
+	uuid, _ := datastore.NewTestRepo()
+	rawURL := fmt.Sprintf("%snode/%s/grayscale/raw/0_1/10_10/0_0", WebAPIPath, uuid)
+	if w := rateLimitTestRequest(t, rawURL, "10.1.1.3"); w.Code == http.StatusTooManyRequests {
+		t.Fatalf("expected first heavy request not to be rate limited\n")
+	}
+	if w := rateLimitTestRequest(t, rawURL, "10.1.1.3"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected second heavy request to be rate limited, got status %d\n", w.Code)
+	}
+	if w := rateLimitTestRequest(t, WebAPIPath+"server/info", "10.1.1.3"); w.Code != http.StatusOK {
+		t.Fatalf("expected light request from IP to succeed, got status %d\n", w.Code)
+	}
+	for i := 0; i < 3; i++ {
+		if w := rateLimitTestRequest(t, rawURL, "10.9.1.1"); w.Code == http.StatusTooManyRequests {
+			t.Fatalf("expected no heavy limit for 10.9.*.* IPs\n")
+		}
+	}
+
+	// reloading without limits removes them.
+	if err := os.WriteFile(tc.Server.BlockListFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	TestHTTP(t, "POST", WebAPIPath+"server/reload-blocklist", nil)
+	if w := rateLimitTestRequest(t, infoURL, "10.1.1.1"); w.Code != http.StatusOK {
+		t.Fatalf("expected no rate limit after reload, got status %d\n", w.Code)
+	}
+
+	if err := os.WriteFile(tc.Server.BlockListFile, []byte("limit=user,all,1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	TestBadHTTP(t, "POST", WebAPIPath+"server/reload-blocklist", nil)
+}
@@ -50,6 +50,16 @@ Commands executed on the server (rpc address = %s):
 
 	node <UUID> <data name> <type-specific commands>
 
+	backup <archive path> [<UUID> <data name>...]
+
+		Starts an online backup of all metadata and either all data instances or
+		the given data instances of the repo with the UUID.  The archive path is 
+		a directory on the server or, if it ends in ".tar", a tar archive.  The
+		server keeps running during the backup, and each data instance is read
+		from a consistent snapshot of its store.  Mutations are refused while the
+		snapshots are taken or, for stores without snapshot support, until the
+		backup finishes.  Use "dvid restore" to rebuild a store from the backup.
+
 DANGEROUS COMMANDS (only available via command line)
 
 	repos delete <UUID> <repo passcode if any>
@@ -325,6 +335,17 @@ func handleCommand(cmd *datastore.Request) (reply *datastore.Response, err error
 	}
 	reply = new(datastore.Response)
 
+	// Repo and data commands can modify the datastore, so they are refused while mutations
+	// are suspended for a backup.
+	switch cmd.Name() {
+	case "repos", "repo", "node":
+		var end func()
+		if end, err = datastore.StartMutation(); err != nil {
+			return
+		}
+		defer end()
+	}
+
 	switch cmd.Name() {
 
 	case "help":
@@ -336,6 +357,27 @@ func handleCommand(cmd *datastore.Request) (reply *datastore.Response, err error
 		// launch goroutine shutdown so we can concurrently return shutdown message to client.
 		go Shutdown()
 
+	case "backup":
+		if len(cmd.Command) < 2 {
+			err = fmt.Errorf("backup command requires an archive path")
+			return
+		}
+		cfg := datastore.BackupConfig{Path: cmd.Command[1]}
+		if len(cmd.Command) > 2 {
+			cfg.UUID = dvid.UUID(cmd.Command[2])
+			for _, name := range cmd.Command[3:] {
+				cfg.Instances = append(cfg.Instances, dvid.InstanceName(name))
+			}
+			if len(cfg.Instances) == 0 {
+				err = fmt.Errorf("backup of repo %s requires at least one data name", cfg.UUID)
+				return
+			}
+		}
+		if err = datastore.StartBackup(cfg); err != nil {
+			return
+		}
+		reply.Text = fmt.Sprintf("Started backup to %q.  Check GET /api/server/backup for status.\n", cfg.Path)
+
 	case "types":
 		if len(cmd.Command) == 1 {
 			text := "\nData Types within this DVID Server\n"
@@ -715,6 +757,11 @@ func handleCommand(cmd *datastore.Request) (reply *datastore.Response, err error
 			reply.Text = dataservice.Help()
 			return
 		}
+		if dataservice.Versioned() {
+			if err = datastore.CheckMergeComplete(uuid); err != nil {
+				return
+			}
+		}
 		err = dataservice.DoRPC(*cmd, reply)
 		return
 
@@ -78,6 +78,7 @@ type TestConfig struct {
 	KVStoresMap  storage.DataMap
 	LogStoresMap storage.DataMap
 	CacheSize    map[string]int // MB for caches
+	Mutations    MutationsConfig
 }
 
 // OpenTest initializes the server for testing, setting up caching, datastore, etc.
@@ -104,6 +105,9 @@ func OpenTest(configs ...TestConfig) error {
 					tc.Cache[id] = sizeConfig{Size: size}
 				}
 			}
+			if c.Mutations.Jsonstore != "" {
+				tc.Mutations = c.Mutations
+			}
 		}
 	}
 	dvid.Infof("OpenTest with %v: cache setting %v\n", configs, tc.Cache)
@@ -146,6 +150,12 @@ func Initialize() error {
 		loadBlockListFile()
 	}
 
+	if tc.Server.AuditLog != "" {
+		if err := openAuditLog(tc.Server.AuditLog); err != nil {
+			return err
+		}
+	}
+
 	// don't let server start if it can't create critical directories like
 	// mutation log files.
 	if tc.Mutations.Jsonstore != "" {
@@ -443,6 +453,8 @@ type localConfig struct {
 	CorsDomains     []string
 	RWMode          string // optional setting can be empty, "readonly" or "fullwrite"
 	BlockListFile   string // filename for blocked users or IP addresses and optional note
+	AuditLog        string // filename of append-only JSON lines log of mutating requests
+	BackupDir       string // directory holding backups requested via POST /api/server/backup
 
 	AllowTiming        bool   // If true, returns * for Timing-Allow-Origin in response headers.
 	StartWebhook       string // http address that should be called when server is started up.
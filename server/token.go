@@ -0,0 +1,303 @@
+/*
+	This file handles issuance and verification of JWTs signed with RSA or ECDSA keys
+	so other services can verify DVID tokens offline using the public key.
+*/
+
+package server
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/zenazn/goji/web"
+)
+
+// DefaultTokenLifetime is the lifetime of issued tokens if not set in the configuration.
+const DefaultTokenLifetime = time.Hour
+
+var tokens tokenData
+
+// keys used for signing and verification of tokens and any revocations.
+type tokenData struct {
+	sync.RWMutex
+	method    jwt.SigningMethod
+	signKey   interface{} // nil if tokens can only be verified
+	verifyKey interface{}
+
+	revokedIDs   map[string]struct{}  // revoked token IDs ("jti" claim)
+	revokedUsers map[string]time.Time // tokens issued before time are revoked; zero time revokes all
+}
+
+// returns signing method for an ECDSA key given its curve.
+func ecdsaSigningMethod(key *ecdsa.PublicKey) (jwt.SigningMethod, error) {
+	switch key.Curve.Params().BitSize {
+	case 256:
+		return jwt.SigningMethodES256, nil
+	case 384:
+		return jwt.SigningMethodES384, nil
+	case 521:
+		return jwt.SigningMethodES512, nil
+	default:
+		return nil, fmt.Errorf("unsupported ECDSA curve %s", key.Curve.Params().Name)
+	}
+}
+
+func parsePrivateKey(pemData []byte) (method jwt.SigningMethod, signKey, verifyKey interface{}, err error) {
+	if rsaKey, rsaErr := jwt.ParseRSAPrivateKeyFromPEM(pemData); rsaErr == nil {
+		return jwt.SigningMethodRS256, rsaKey, &rsaKey.PublicKey, nil
+	}
+	ecKey, err := jwt.ParseECPrivateKeyFromPEM(pemData)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("private key must be PEM-encoded RSA or ECDSA key")
+	}
+	if method, err = ecdsaSigningMethod(&ecKey.PublicKey); err != nil {
+		return
+	}
+	return method, ecKey, &ecKey.PublicKey, nil
+}
+
+func parsePublicKey(pemData []byte) (method jwt.SigningMethod, verifyKey interface{}, err error) {
+	if rsaKey, rsaErr := jwt.ParseRSAPublicKeyFromPEM(pemData); rsaErr == nil {
+		return jwt.SigningMethodRS256, rsaKey, nil
+	}
+	ecKey, err := jwt.ParseECPublicKeyFromPEM(pemData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("public key must be PEM-encoded RSA or ECDSA key")
+	}
+	if method, err = ecdsaSigningMethod(ecKey); err != nil {
+		return
+	}
+	return method, ecKey, nil
+}
+
+// returns true if the two public keys are the same RSA or ECDSA key.
+func samePublicKey(a, b interface{}) bool {
+	pubKey, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pubKey.Equal(b)
+}
+
+// loadTokenKeys loads the key files set in the auth configuration.  If only a public key
+// is given, tokens can be verified but not issued.  If no key files are set, the legacy
+// secret key from the DVID_JWT_SECRET_KEY environment variable is used with HMAC signing.
+func loadTokenKeys() error {
+	var method jwt.SigningMethod
+	var signKey, verifyKey interface{}
+	if tc.Auth.PrivateKeyFile != "" {
+		pemData, err := os.ReadFile(tc.Auth.PrivateKeyFile)
+		if err != nil {
+			return err
+		}
+		if method, signKey, verifyKey, err = parsePrivateKey(pemData); err != nil {
+			return fmt.Errorf("bad private key file %q: %v", tc.Auth.PrivateKeyFile, err)
+		}
+	}
+	if tc.Auth.PublicKeyFile != "" {
+		pemData, err := os.ReadFile(tc.Auth.PublicKeyFile)
+		if err != nil {
+			return err
+		}
+		pubMethod, pubKey, err := parsePublicKey(pemData)
+		if err != nil {
+			return fmt.Errorf("bad public key file %q: %v", tc.Auth.PublicKeyFile, err)
+		}
+		if method == nil {
+			method, verifyKey = pubMethod, pubKey
+		} else if !samePublicKey(verifyKey, pubKey) {
+			// The public key is derived from the private key, so a different key would
+			// reject our own tokens while handing out a key that can't verify them.
+			return fmt.Errorf("public key file %q does not match the key pair of private key file %q",
+				tc.Auth.PublicKeyFile, tc.Auth.PrivateKeyFile)
+		}
+	}
+	if method == nil && jwtSecretKey != "" {
+		method = jwt.SigningMethodHS256
+		signKey = []byte(jwtSecretKey)
+		verifyKey = signKey
+	}
+	if method != nil {
+		dvid.Infof("Using %s for signing and verifying tokens.\n", method.Alg())
+	}
+	tokens.Lock()
+	tokens.method, tokens.signKey, tokens.verifyKey = method, signKey, verifyKey
+	tokens.Unlock()
+	return nil
+}
+
+// loadRevocationFile loads a revocation list where each line is either "jti=<token id>"
+// to revoke a particular token or "u=<user>[,<RFC3339 time>]" to revoke all tokens of the
+// user issued before the given time, or all tokens of the user if no time is given.
+// Blank lines and lines starting with "#" are ignored.
+func loadRevocationFile() error {
+	revokedIDs := make(map[string]struct{})
+	revokedUsers := make(map[string]time.Time)
+	if tc.Auth.RevocationFile != "" {
+		f, err := os.Open(tc.Auth.RevocationFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			switch {
+			case line == "" || strings.HasPrefix(line, "#"):
+			case strings.HasPrefix(line, "jti="):
+				revokedIDs[line[4:]] = struct{}{}
+			case strings.HasPrefix(line, "u="):
+				user, timeStr, found := strings.Cut(line[2:], ",")
+				var before time.Time
+				if found {
+					if before, err = time.Parse(time.RFC3339, strings.TrimSpace(timeStr)); err != nil {
+						return fmt.Errorf("bad time in revocation file (%s) line %q: %v", tc.Auth.RevocationFile, line, err)
+					}
+				}
+				revokedUsers[user] = before
+			default:
+				return fmt.Errorf("bad line in revocation file (%s): %s", tc.Auth.RevocationFile, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		dvid.Infof("Loaded %d token and %d user revocations from %q\n", len(revokedIDs), len(revokedUsers), tc.Auth.RevocationFile)
+	}
+	tokens.Lock()
+	tokens.revokedIDs, tokens.revokedUsers = revokedIDs, revokedUsers
+	tokens.Unlock()
+	return nil
+}
+
+// returns the configured lifetime of issued tokens.
+func tokenLifetime() (time.Duration, error) {
+	if tc.Auth.TokenLifetime == "" {
+		return DefaultTokenLifetime, nil
+	}
+	lifetime, err := time.ParseDuration(tc.Auth.TokenLifetime)
+	if err != nil {
+		return 0, fmt.Errorf("bad token_lifetime %q in auth config: %v", tc.Auth.TokenLifetime, err)
+	}
+	if lifetime <= 0 {
+		return 0, fmt.Errorf("token_lifetime in auth config must be positive, not %q", tc.Auth.TokenLifetime)
+	}
+	return lifetime, nil
+}
+
+// returns the configured issuer for tokens or "dvid" if none is set.
+func tokenIssuer() string {
+	if tc.Auth.TokenIssuer != "" {
+		return tc.Auth.TokenIssuer
+	}
+	return "dvid"
+}
+
+// generateJWT returns a signed JWT for the given user with "iat", "exp", "iss", and
+// "jti" claims.
+func generateJWT(user string) (string, error) {
+	tokens.RLock()
+	method, signKey := tokens.method, tokens.signKey
+	tokens.RUnlock()
+	if signKey == nil {
+		return "", fmt.Errorf("token issuance requires private_key_file in auth config or env variable %q to be set", SecretKeyVarName)
+	}
+	lifetime, err := tokenLifetime()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"user": user,
+		"iat":  now.Unix(),
+		"exp":  now.Add(lifetime).Unix(),
+		"iss":  tokenIssuer(),
+		"jti":  string(dvid.NewUUID()),
+	}
+	tokenString, err := jwt.NewWithClaims(method, claims).SignedString(signKey)
+	if err != nil {
+		return "", fmt.Errorf("error with JWT signing: %v", err)
+	}
+	return tokenString, nil
+}
+
+// validateJWT verifies the token signature, its expiration, issue time, and issuer if
+// one is configured, and checks the revocation list.  It returns the token's user.
+func validateJWT(tokenString string) (user string, err error) {
+	tokens.RLock()
+	method, verifyKey := tokens.method, tokens.verifyKey
+	tokens.RUnlock()
+	if verifyKey == nil {
+		return "", fmt.Errorf("no key available to verify tokens")
+	}
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != method.Alg() {
+			return nil, fmt.Errorf("unexpected token signing method %q", token.Method.Alg())
+		}
+		return verifyKey, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error parsing JWT: %v", err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", fmt.Errorf("invalid token")
+	}
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) {
+		return "", fmt.Errorf("token is expired or has no expiration")
+	}
+	if !claims.VerifyIssuedAt(now, true) {
+		return "", fmt.Errorf("token has no valid issue time")
+	}
+	if tc.Auth.TokenIssuer != "" && !claims.VerifyIssuer(tc.Auth.TokenIssuer, true) {
+		return "", fmt.Errorf("token not issued by %q", tc.Auth.TokenIssuer)
+	}
+	if user, ok = claims["user"].(string); !ok {
+		return "", fmt.Errorf("token user %v is not a simple string", claims["user"])
+	}
+	tokens.RLock()
+	defer tokens.RUnlock()
+	if jti, ok := claims["jti"].(string); ok {
+		if _, revoked := tokens.revokedIDs[jti]; revoked {
+			return "", fmt.Errorf("token %s has been revoked", jti)
+		}
+	}
+	if before, found := tokens.revokedUsers[user]; found {
+		iat, _ := claims["iat"].(float64)
+		if before.IsZero() || int64(iat) < before.Unix() {
+			return "", fmt.Errorf("tokens for user %q have been revoked", user)
+		}
+	}
+	return user, nil
+}
+
+// handler for /api/server/token-key requests that returns the PEM-encoded public key
+// for offline verification of tokens.
+func serverTokenKeyHandler(c web.C, w http.ResponseWriter, r *http.Request) {
+	tokens.RLock()
+	verifyKey := tokens.verifyKey
+	tokens.RUnlock()
+	switch verifyKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		BadRequest(w, r, "no public key available for token verification")
+		return
+	}
+	der, err := x509.MarshalPKIXPublicKey(verifyKey)
+	if err != nil {
+		BadRequest(w, r, "unable to encode public key: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	pem.Encode(w, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+func writePEM(t *testing.T, dir, name, pemType string, der []byte) string {
+	filename := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der})
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestTokens(t *testing.T) {
+	if err := OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer CloseTest()
+
+	oldAuth := tc.Auth
+	defer func() {
+		tc.Auth = oldAuth
+		loadTokenKeys()
+		loadRevocationFile()
+	}()
+
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPubDER, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFile := writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	ecFile := writePEM(t, dir, "ec.pem", "EC PRIVATE KEY", ecDER)
+	ecPubFile := writePEM(t, dir, "ec.pub", "PUBLIC KEY", ecPubDER)
+
+	for _, keyFile := range []string{rsaFile, ecFile} {
+		tc.Auth = authConfig{PrivateKeyFile: keyFile, TokenIssuer: "test-dvid", TokenLifetime: "10m"}
+		if err := loadTokenKeys(); err != nil {
+			t.Fatalf("unable to load key file %s: %v\n", keyFile, err)
+		}
+		tokenString, err := generateJWT("someone@example.org")
+		if err != nil {
+			t.Fatalf("unable to generate token: %v\n", err)
+		}
+		user, err := validateJWT(tokenString)
+		if err != nil || user != "someone@example.org" {
+			t.Fatalf("expected valid token for user, got user %q, err %v\n", user, err)
+		}
+		claims := jwt.MapClaims{}
+		if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims); err != nil {
+			t.Fatal(err)
+		}
+		exp, iat := claims["exp"].(float64), claims["iat"].(float64)
+		if exp-iat != 600 || claims["iss"] != "test-dvid" || claims["jti"] == "" {
+			t.Fatalf("bad claims in issued token: %v\n", claims)
+		}
+	}
+
+	// verify offline using public key from server.
+	keyData := TestHTTP(t, "GET", WebAPIPath+"server/token-key", nil)
+	pubKey, err := jwt.ParseECPublicKeyFromPEM(keyData)
+	if err != nil || !pubKey.Equal(&ecKey.PublicKey) {
+		t.Fatalf("bad public key returned: %v\n", err)
+	}
+	tokenString, err := generateJWT("someone@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) { return pubKey, nil }); err != nil {
+		t.Fatalf("unable to verify token offline: %v\n", err)
+	}
+
+	// bad tokens
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	now := time.Now()
+	badTokens := map[string]string{
+		"expired": sign(jwt.SigningMethodES256, ecKey, jwt.MapClaims{
+			"user": "a", "iss": "test-dvid", "iat": now.Add(-time.Hour).Unix(), "exp": now.Add(-time.Minute).Unix(),
+		}),
+		"no expiration": sign(jwt.SigningMethodES256, ecKey, jwt.MapClaims{
+			"user": "a", "iss": "test-dvid", "iat": now.Unix(),
+		}),
+		"no issue time": sign(jwt.SigningMethodES256, ecKey, jwt.MapClaims{
+			"user": "a", "iss": "test-dvid", "exp": now.Add(time.Minute).Unix(),
+		}),
+		"wrong issuer": sign(jwt.SigningMethodES256, ecKey, jwt.MapClaims{
+			"user": "a", "iss": "other", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+		}),
+		"wrong method": sign(jwt.SigningMethodHS256, keyData, jwt.MapClaims{
+			"user": "a", "iss": "test-dvid", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+		}),
+		"wrong key": sign(jwt.SigningMethodRS256, rsaKey, jwt.MapClaims{
+			"user": "a", "iss": "test-dvid", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+		}),
+	}
+	for desc, badToken := range badTokens {
+		if _, err := validateJWT(badToken); err == nil {
+			t.Errorf("expected %s token to fail validation\n", desc)
+		}
+	}
+
+	// public key must be from the same key pair as the private key.
+	tc.Auth = authConfig{PrivateKeyFile: ecFile, PublicKeyFile: ecPubFile, TokenIssuer: "test-dvid"}
+	if err := loadTokenKeys(); err != nil {
+		t.Fatalf("expected matching public key to load: %v\n", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPubDER, err := x509.MarshalPKIXPublicKey(&otherKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.Auth.PublicKeyFile = writePEM(t, dir, "other.pub", "PUBLIC KEY", otherPubDER)
+	if err := loadTokenKeys(); err == nil {
+		t.Fatalf("expected error loading public key from a different key pair\n")
+	}
+
+	// verification-only with public key
+	tc.Auth = authConfig{PublicKeyFile: ecPubFile, TokenIssuer: "test-dvid", RevocationFile: filepath.Join(dir, "revoked.txt")}
+	if err := os.WriteFile(tc.Auth.RevocationFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadTokenKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generateJWT("someone@example.org"); err == nil {
+		t.Fatalf("expected no token issuance without private key\n")
+	}
+	if _, err := validateJWT(tokenString); err != nil {
+		t.Fatalf("expected token verification with public key: %v\n", err)
+	}
+
+	// revocations are reloaded with auth.
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims); err != nil {
+		t.Fatal(err)
+	}
+	revocations := []string{
+		"jti=" + claims["jti"].(string),
+		"u=someone@example.org",
+		"u=someone@example.org," + now.Add(time.Minute).Format(time.RFC3339),
+	}
+	for _, revocation := range revocations {
+		if err := os.WriteFile(tc.Auth.RevocationFile, []byte("# revoked\n"+revocation+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		TestHTTP(t, "POST", WebAPIPath+"server/reload-auth", nil)
+		if _, err := validateJWT(tokenString); err == nil || !strings.Contains(err.Error(), "revoked") {
+			t.Errorf("expected token revoked by %q, got error %v\n", revocation, err)
+		}
+	}
+	revocation := "u=someone@example.org," + now.Add(-time.Minute).Format(time.RFC3339)
+	if err := os.WriteFile(tc.Auth.RevocationFile, []byte(revocation), 0644); err != nil {
+		t.Fatal(err)
+	}
+	TestHTTP(t, "POST", WebAPIPath+"server/reload-auth", nil)
+	if _, err := validateJWT(tokenString); err != nil {
+		t.Errorf("expected token issued after revocation time to be valid: %v\n", err)
+	}
+	if err := os.WriteFile(tc.Auth.RevocationFile, []byte("bad line"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	TestBadHTTP(t, "POST", WebAPIPath+"server/reload-auth", nil)
+}
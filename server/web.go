@@ -20,6 +20,7 @@ import (
 	"runtime"
 	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -126,6 +127,17 @@ GET /api/user-latencies[?u=<username]
 		...
 	]
 
+GET /metrics
+
+	Returns server metrics in the Prometheus text exposition format, including:
+	  dvid_http_requests_total, dvid_http_request_duration_seconds: request counts and
+	  	latency histograms by datatype and endpoint keyword (or server/repo/node action).
+	  	Keywords not documented for the datatype are reported as "other".
+	  dvid_chunk_handlers_active, dvid_throttled_ops_active, ...: queue depths.
+	  dvid_store_operations_total: get, put, and range operations for each store.
+	  dvid_groupcache_hit_ratio, ...: groupcache statistics if groupcache is configured.
+	  dvid_labelmap_mutations_total: labelmap merges, cleaves, splits, and renumbers.
+
 GET  /api/server/info
 
 	Returns JSON for server properties.
@@ -159,6 +171,49 @@ GET /api/server/blobstore/{reference}
 	populated as part of mutation logging and is read-only.  The reference is a URL-friendly 
 	content hash (FNV-128) of the blob data.
 
+GET /api/server/token
+
+	Returns a signed JWT for the user authenticated by the configured proxy server or, if no
+	proxy is configured, by a Google ID token in the Authorization header.  If the auth
+	configuration enforces an auth file, the user must be present in it.  The token has
+	"user", "iat", "exp", "iss", and "jti" (token ID) claims and expires after the configured
+	token_lifetime (default 1 hour).  Tokens are passed to DVID and other services in an
+	"Authorization: Bearer <token>" header.
+
+GET /api/server/token-key
+
+	Returns the PEM-encoded public key used to verify tokens so other services can verify
+	them offline.  Only available if RSA or ECDSA key files are configured.
+
+GET /api/server/audit[?user=...&uuid=...&instance=...&since=...&until=...]
+
+	Returns a JSON list of mutating requests recorded in the audit log, which is enabled by
+	setting "auditLog" in the [server] section of the configuration TOML.  Requires admin
+	privileges, either through the "admintoken" query string or a JWT for a user with
+	server-wide "admin" permission in the authorization file.  Records are in the order
+	received and have the following format:
+
+	{
+		"Time": "2023-03-01T10:05:32.215-05:00",
+		"User": "someone@example.org",  // from the authorization token or "u" query string
+		"UUID": "3f8c...",
+		"Instance": "segmentation",
+		"Method": "POST",
+		"Endpoint": "/api/node/3f8c.../segmentation/merge",
+		"BytesIn": 14,
+		"Status": 200,
+		"DurationMs": 35.2,
+		"RemoteAddr": "10.1.2.3:56782"
+	}
+
+	Query-string Options:
+
+	user        Only return requests by this user.
+	uuid        Only return requests on versions whose UUID starts with this string.
+	instance    Only return requests on this data instance.
+	since       Only return requests at or after this time, either RFC3339 or Unix seconds.
+	until       Only return requests at or before this time, either RFC3339 or Unix seconds.
+
 ---- Server endpoints that require use of additional authorization by requester ----
 
 POST  /api/server/settings
@@ -182,11 +237,84 @@ POST  /api/server/settings
 
 POST /api/server/reload-auth
 
-	Reloads any authorization file as configured in the TOML file.
+	Reloads any authorization file as configured in the TOML file.  The authorization file
+	is JSON where each key is a user email or "*" for any other user, and each value is
+	either a privilege for the whole server or an object with privileges scoped to repos
+	(by root UUID) and data instances, where the most specific scope is used:
+
+	{
+		"admin@example.org": "admin",
+		"someone@example.org": {
+			"server": "read",
+			"repos": { "3f8c": "readwrite" },
+			"instances": { "3f8c/segmentation": "admin", "3f8c/secret": "none" }
+		}
+	}
+
+	Privileges are "none", "read", "write", "readwrite", or "admin".  Admin privileges
+	allow creation of data instances and commits, branches, new versions, and merges
+	within a repo.
+
+	Any configured token key files and token revocation file are also reloaded.
 
 POST /api/server/reload-blocklist
 
-	Reloads any blocklist file as configured in the TOML file.
+	Reloads any blocklist file as configured in the TOML file, including any rate limits.
+	Besides "u=" and "ip=" lines that block users or IPs outright, the blocklist file can
+	have token-bucket rate limit lines of the form:
+
+	limit=<scope>,<class>,<requests per second>,<burst>
+
+	where scope is "user" or "ip" for the default limit on each user or client IP, or
+	"user:<user id>" or "ip:<ip pattern like 10.2.*.*>" for particular users or IPs.
+	The user is taken from a valid JWT or, only if authorization is disabled, the "u" query
+	string.  Requests without a user are only limited by IP.  The class is "all" for every
+	request or "heavy" for a separate budget on GET requests to raw, isotropic, sparsevol*,
+	blocks and specificblocks endpoints.  A rate of 0 removes the limit.
+	Requests over a limit receive a 429 (Too Many Requests) status with a Retry-After
+	header giving the seconds to wait.
+
+POST /api/server/backup
+
+	Starts an online backup of metadata and data instances while the server keeps running.
+	Only one backup can run at a time.  Requires admin privileges, either through the
+	"admintoken" query string or a JWT for a user with server-wide "admin" permission in the
+	authorization file.  The POSTed JSON gives the destination and optionally restricts the
+	data instances backed up:
+
+	{
+		"path": "mybackup.tar",
+		"uuid": "3f8a",
+		"instances": ["grayscale", "segmentation"]
+	}
+
+	The path is relative to the "backupDir" directory set in the [server] section of the
+	configuration TOML and cannot be absolute or contain "..".  Backups are refused if no
+	backupDir is configured.  The path is a directory or, if it ends in ".tar", a tar
+	archive.  If no instances are given, all data instances in all repos are backed up.
+	All backed up data is from the same point in time, so mutating requests are refused
+	with a 503 (Service Unavailable) status code while snapshots of the stores are taken.
+	Currently badger and golsm stores support snapshots.  With other stores, mutations
+	are refused until the backup is finished.  A store can be
+	rebuilt from the backup using the "dvid restore" command, which only restores the
+	backed up data instances.
+
+GET /api/server/backup
+
+	Returns JSON giving the status of the running or last finished backup.  Requires admin
+	privileges like the POST.
+
+
+	{
+		"Running": false,
+		"Path": "/demo/backups/mybackup.tar",
+		"Started": "2026-10-16T10:27:05.102371-04:00",
+		"Finished": "2026-10-16T10:52:41.548211-04:00",
+		"NumKV": 3819472,
+		"Bytes": 20188437216
+	}
+
+	An "Error" property is included if the backup failed.
 
 
 -------------------------
@@ -303,11 +431,23 @@ Repo-Level REST endpoints
 
  POST /api/repo/{uuid}/merge
 
-	Creates a conflict-free merge of a set of committed parent UUIDs into a child.  Note
-	the merge will not necessarily create an error immediately, but later GETs that
+	Creates a merge of a set of committed parent UUIDs into a child.  For a conflict-free
+	merge, the merge will not necessarily create an error immediately, but later GETs that
 	detect conflicts will produce an error at that time.  These can be resolved by
 	doing a POST on the "resolve" endpoint below.
 
+	An "auto" merge spawns an asynchronous routine that scans all versioned data instances
+	for keys modified in more than one parent and writes a resolution into the child.
+	Datatypes that support automatic merging (e.g., keyvalue, neuronjson, annotation,
+	labelmap) reconcile the conflicting values using the closest common ancestor.  Other
+	datatypes use the value from the first parent in the list with a modification.
+	Progress can be monitored using the GET merge endpoints below.
+
+	An "external" merge resolves each conflicting key using the parent chosen by a
+	"manifest" of rules for each data instance.  The manifest is checked against all
+	conflicts before the child is created, and the merge is rejected if any conflict is
+	not covered by a rule.  Conflicts are then resolved asynchronously like an "auto" merge.
+
 	The post body should be JSON of the following format: 
 
 	{ 
@@ -318,15 +458,98 @@ Repo-Level REST endpoints
 
 	The elements of the JSON object are:
 
-		mergeType:  must be "conflict-free".  We will introduce other merge options in future.
-		parents:    a list of the parent UUIDs to be merged. 
+		mergeType:  must be "conflict-free", "auto", or "external".
+		parents:    a list of the parent UUIDs to be merged in order of priority.
 		note:       any note that should be set for the child version.
+		manifest:   (required for "external") rules for each data instance.
+
+	A manifest for an "external" merge gives, for each data instance name, a list of rules
+	that are checked in order.  The first rule matching a conflicting key selects the parent
+	whose value is used.  A rule matches if all its given criteria match: "begin" and "end"
+	give an inclusive range of keys for keyvalue or neuronjson data, "labels" lists labels
+	or bodies, and "minBlock" and "maxBlock" give an inclusive range of block coordinates.
+	A rule without criteria matches all keys of the data instance.  For labelmap data, label
+	rules only match label indices and related per-label keys, so the merge is rejected if a
+	label rule selects a parent other than the one selected for any conflicting block of
+	that label.  Example:
+
+	{
+		"mergeType": "external",
+		"parents": [ "parent-uuid1", "parent-uuid2" ],
+		"note": "merge of proofreading in two regions",
+		"manifest": {
+			"segmentation": [
+				{ "parent": "parent-uuid2", "minBlock": [0,0,100], "maxBlock": [200,200,199] },
+				{ "parent": "parent-uuid1" }
+			],
+			"bodyannotations": [
+				{ "parent": "parent-uuid2", "labels": [23, 1000] },
+				{ "parent": "parent-uuid1", "begin": "a", "end": "m" }
+			]
+		}
+	}
 
 	A JSON response will be sent with the following format:
 
 	{ "child": "3f01a8856" }
 
-	The response includes the UUID of the new merged, child node.
+	The response includes the UUID of the new merged, child node.  For an "auto" or
+	"external" merge, the child is returned immediately and is not fully merged until the merge status
+	reports a "done" state.  Until then, requests on versioned data and mutations of the child node
+	return a 503 (Service Unavailable) status code.
+
+ GET /api/repo/{uuid}/merge[/{child uuid}]
+
+	Returns the status of asynchronous merges.  If a child UUID is given, a JSON object
+	describing the merge into that child is returned, else a JSON list of all merges 
+	within the repo since the server started.  Example:
+
+	{
+		"child": "3f01a8856...",
+		"parents": [ "parent-uuid1", "parent-uuid2" ],
+		"mergeType": "auto",
+		"state": "done",
+		"started": "2022-05-01T10:22:01-04:00",
+		"finished": "2022-05-01T10:24:31-04:00",
+		"instances": {
+			"grayscale": { "keys_scanned": 0, "conflicts": 0, "resolved": 0, "failed": 0, "done": true },
+			"segmentation": { "keys_scanned": 23812, "conflicts": 12, "resolved": 12, "failed": 0, "done": true }
+		}
+	}
+
+	The "state" is one of "running", "done", or "failed".  Any errors are given in an "errors" list.
+
+ GET /api/repo/{uuid}/conflicts?parents=uuid1,uuid2[,uuid3...][&data=name1,name2...][&samples=20]
+
+	Does a dry run of a merge of the given parent UUIDs and returns the keys that were
+	modified in more than one parent relative to their closest common ancestor, i.e.,
+	keys that would need resolution by a merge.  No data is modified.
+
+	Query-string Options:
+
+	parents       Comma-separated list of parent UUIDs (at least two) that would be merged.
+	data          (optional) Comma-separated list of data instance names to check.  If not
+	                given, all versioned data instances are checked.
+	samples       (optional) Maximum number of conflicting keys to list per data instance.
+	                Default is 20.
+
+	A JSON response will be sent with the following format:
+
+	{
+		"segmentation": {
+			"keys_scanned": 23812,
+			"conflicts": 2,
+			"samples": [ "label 1830", "block (12,8,20) scale 0" ]
+		},
+		"bodyannotations": {
+			"keys_scanned": 832,
+			"conflicts": 1,
+			"samples": [ "body 1830" ]
+		}
+	}
+
+	Samples are decoded into block coordinates, labels, body ids, or keys if the datatype
+	supports it, else they are given as a hexadecimal type-specific key.
 
  POST /api/repo/{uuid}/resolve
 
@@ -538,6 +761,27 @@ references to "B:master" now return the data from "D".
 
 	Note that POST /blobstore will not be logged in any associated kafka system.
 
+ GET /api/node/{uuid}/{data name}/events[?since=<mutation id>]
+
+	Streams the JSON messages for mutations of the given data instance, e.g., labelmap
+	merge, split, cleave, renumber and nextlabel messages, as server-sent events
+	(content type "text/event-stream").  These are the same messages sent to any
+	associated Kafka system, so sites without Kafka can follow mutations in real time.
+	Each event has the type given by the message "Action" and an id set to the 
+	message "MutationID" if present:
+
+	id: 1000000012
+	event: merge-complete
+	data: {"Action":"merge-complete","Labels":[2],"MutationID":1000000012,...}
+
+	Only messages for the given version are streamed unless "allversions=true" is
+	added to the query string.  A stream can be resumed by passing the last received
+	mutation id via the "since" query string or the standard "Last-Event-ID" header,
+	and recent messages after that mutation are replayed before new ones are streamed.
+	If some messages are no longer retained for replay, a "gap" event is sent first.
+	Messages without mutation ids may be replayed more than once.  Streams are closed
+	by the server after the HTTP write timeout, and clients should then resume.
+
 		</pre>
 
 		<h4>Data type commands</h4>
@@ -698,7 +942,7 @@ func initRoutes() {
 	}
 	var wildcardOrigin bool
 	var c *cors.Cors
-	authorizationOn := (len(tc.Auth.ProxyAddress) != 0)
+	authorizationOn := tc.Auth.enabled()
 	if len(corsDomains) > 0 {
 		copts := cors.Options{
 			AllowedMethods: []string{"GET", "POST", "DELETE", "HEAD"},
@@ -731,6 +975,7 @@ func initRoutes() {
 	webMux.Handle("/api/load", silentMux)
 	webMux.Handle("/api/heartbeat", silentMux)
 	webMux.Handle("/api/user-latencies", silentMux)
+	webMux.Handle("/metrics", silentMux)
 	if c != nil {
 		silentMux.Use(c.Handler)
 	} else if wildcardOrigin {
@@ -740,6 +985,7 @@ func initRoutes() {
 	silentMux.Get("/api/load", loadHandler)
 	silentMux.Get("/api/heartbeat", heartbeatHandler)
 	silentMux.Get("/api/user-latencies", latenciesHandler)
+	silentMux.Get("/metrics", metricsHandler)
 
 	mainMux := web.New()
 	webMux.Handle("/*", mainMux)
@@ -783,12 +1029,19 @@ func initRoutes() {
 	serverMux.Get("/api/server/blobstore/:ref", blobstoreHandler)
 	serverMux.Get("/api/server/token", serverTokenHandler)
 	serverMux.Get("/api/server/token/", serverTokenHandler)
+	serverMux.Get("/api/server/token-key", serverTokenKeyHandler)
+	serverMux.Get("/api/server/audit", requireAdmin(serverAuditHandler))
+	serverMux.Get("/api/server/audit/", requireAdmin(serverAuditHandler))
 
 	serverMux.Post("/api/server/settings", serverSettingsHandler)
 	serverMux.Post("/api/server/reload-auth", serverReloadAuthHandler)
 	serverMux.Post("/api/server/reload-auth/", serverReloadAuthHandler)
 	serverMux.Post("/api/server/reload-blocklist", serverReloadBlocklistHandler)
 	serverMux.Post("/api/server/reload-blocklist/", serverReloadBlocklistHandler)
+	serverMux.Get("/api/server/backup", requireAdmin(serverBackupHandler))
+	serverMux.Get("/api/server/backup/", requireAdmin(serverBackupHandler))
+	serverMux.Post("/api/server/backup", requireAdmin(serverBackupHandler))
+	serverMux.Post("/api/server/backup/", requireAdmin(serverBackupHandler))
 
 	// -- repos API
 
@@ -820,7 +1073,10 @@ func initRoutes() {
 	repoMux.Get("/api/repo/:uuid/log", getRepoLogHandler)
 	repoMux.Post("/api/repo/:uuid/log", postRepoLogHandler)
 	repoMux.Post("/api/repo/:uuid/merge", repoMergeHandler)
+	repoMux.Get("/api/repo/:uuid/merge", repoMergeStatusHandler)
+	repoMux.Get("/api/repo/:uuid/merge/:name", repoMergeStatusHandler)
 	repoMux.Post("/api/repo/:uuid/resolve", repoResolveHandler)
+	repoMux.Get("/api/repo/:uuid/conflicts", repoConflictsHandler)
 
 	nodeMux := web.New()
 	mainMux.Handle("/api/node/:uuid", nodeMux)
@@ -869,6 +1125,28 @@ func httpUnavailable(w http.ResponseWriter) bool {
 	return true
 }
 
+// startMutation registers a mutating request with the datastore, returning a function to
+// call when the request is done.  If mutations are suspended, e.g., during a backup, it sends
+// a 503 (Service Unavailable) status code and returns false.
+func startMutation(w http.ResponseWriter) (end func(), ok bool) {
+	end, err := datastore.StartMutation()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return end, true
+}
+
+// mergeRunning returns true and sends a 503 (Service Unavailable) status code if the given
+// version is the child of an asynchronous merge that is still resolving conflicts.
+func mergeRunning(w http.ResponseWriter, uuid dvid.UUID) bool {
+	if err := datastore.CheckMergeComplete(uuid); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return true
+	}
+	return false
+}
+
 type wrappedResponseWriter struct {
 	http.ResponseWriter
 	wroteHeader bool
@@ -902,7 +1180,7 @@ func wrapResponseWriter(w http.ResponseWriter) *wrappedResponseWriter {
 // shutdown of server when doing critical reorg of internals.
 func httpAvailHandler(c *web.C, h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		if httpUnavailable(w) || blockedRequest(w, r) {
+		if httpUnavailable(w) || blockedRequest(w, r) || rateLimitedRequest(w, r) {
 			return
 		}
 		h.ServeHTTP(w, r)
@@ -989,6 +1267,13 @@ func activityLogHandler(c *web.C, h http.Handler) http.Handler {
 		t0 := time.Now()
 		myw := wrapResponseWriter(w)
 		h.ServeHTTP(myw, r)
+		observeRequest("", c.URLParams["action"], r.Method, myw, t0)
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			uuid, _ := c.Env["uuid"].(dvid.UUID)
+			auditRequest(c, r, uuid, "", myw, t0)
+		}
 		if KafkaAvailable() {
 			user := r.URL.Query().Get("u")
 			app := r.URL.Query().Get("app")
@@ -1180,6 +1465,16 @@ func nodeSelector(c *web.C, h http.Handler) http.Handler {
 			BadRequest(w, r, "Cannot do %s on locked node %s", method, uuid)
 			return
 		}
+		if method != "get" && method != "head" {
+			if mergeRunning(w, uuid) {
+				return
+			}
+			end, ok := startMutation(w)
+			if !ok {
+				return
+			}
+			defer end()
+		}
 		h.ServeHTTP(w, r)
 	}
 	return http.HandlerFunc(fn)
@@ -1202,6 +1497,13 @@ func repoSelector(c *web.C, h http.Handler) http.Handler {
 			return
 		}
 		c.Env["uuid"] = uuid
+		if method != "get" && method != "head" {
+			end, ok := startMutation(w)
+			if !ok {
+				return
+			}
+			defer end()
+		}
 		h.ServeHTTP(w, r)
 	}
 	return http.HandlerFunc(fn)
@@ -1273,11 +1575,32 @@ func instanceSelector(c *web.C, h http.Handler) http.Handler {
 			return
 		}
 
+		// handle mutation event streams
+		if c.URLParams["keyword"] == "events" {
+			if method != "get" {
+				BadRequest(w, r, "can only do GET action on events endpoint")
+				return
+			}
+			mutationEventsHandler(w, r, data.DataUUID(), uuid)
+			return
+		}
+
 		v, err := datastore.VersionFromUUID(uuid)
 		if err != nil {
 			BadRequest(w, r, err)
 			return
 		}
+		// Versioned data in the child of a running merge is unresolved until the merge is done.
+		if data.Versioned() && mergeRunning(w, uuid) {
+			return
+		}
+		if data.IsMutationRequest(r.Method, c.URLParams["keyword"]) {
+			end, ok := startMutation(w)
+			if !ok {
+				return
+			}
+			defer end()
+		}
 		if data.Versioned() {
 			// Make sure we aren't trying mutable methods on committed nodes.
 			locked, err := datastore.LockedUUID(uuid)
@@ -1350,6 +1673,10 @@ func instanceSelector(c *web.C, h http.Handler) http.Handler {
 		}
 		myw := wrapResponseWriter(w)
 		activity := data.ServeHTTP(uuid, ctx, myw, r)
+		observeRequest(data.TypeName(), c.URLParams["keyword"], r.Method, myw, t0)
+		if data.IsMutationRequest(r.Method, c.URLParams["keyword"]) {
+			auditRequest(c, r, uuid, dataname, myw, t0)
+		}
 		if KafkaAvailable() {
 			t := time.Since(t0)
 			data := map[string]interface{}{
@@ -1635,6 +1962,14 @@ func serverReloadAuthHandler(c web.C, w http.ResponseWriter, r *http.Request) {
 		BadRequest(w, r, "unable to reload auth file: %v", err)
 		return
 	}
+	if err := loadTokenKeys(); err != nil {
+		BadRequest(w, r, "unable to reload token keys: %v", err)
+		return
+	}
+	if err := loadRevocationFile(); err != nil {
+		BadRequest(w, r, "unable to reload revocation file: %v", err)
+		return
+	}
 	w.Header().Set("Content-Type", "text/plain")
 	fmt.Fprintf(w, "Reloaded authorizations from file %q.\n", tc.Auth.AuthFile)
 }
@@ -1648,6 +1983,134 @@ func serverReloadBlocklistHandler(c web.C, w http.ResponseWriter, r *http.Reques
 	fmt.Fprintf(w, "Reloaded block list from file %q.\n", tc.Server.BlockListFile)
 }
 
+func serverBackupHandler(c web.C, w http.ResponseWriter, r *http.Request) {
+	if strings.ToLower(r.Method) == "post" {
+		var cfg datastore.BackupConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			BadRequest(w, r, "bad backup JSON: %v", err)
+			return
+		}
+		path, err := backupPath(cfg.Path)
+		if err != nil {
+			BadRequest(w, r, err)
+			return
+		}
+		cfg.Path = path
+		if err := datastore.StartBackup(cfg); err != nil {
+			BadRequest(w, r, err)
+			return
+		}
+		dvid.Infof("Started backup to %q requested by %s\n", cfg.Path, r.RemoteAddr)
+	}
+	jsonBytes, err := json.Marshal(datastore.GetBackupStatus())
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+}
+
+// backupPath returns the location of a backup given a path relative to the configured
+// backup directory.
+func backupPath(relpath string) (string, error) {
+	if tc.Server.BackupDir == "" {
+		return "", fmt.Errorf("backups are not allowed unless backupDir is set in server configuration")
+	}
+	if relpath == "" {
+		return "", fmt.Errorf("backup requires a path")
+	}
+	if filepath.IsAbs(relpath) {
+		return "", fmt.Errorf("backup path %q must be relative to the backup directory", relpath)
+	}
+	for _, part := range strings.Split(filepath.ToSlash(relpath), "/") {
+		if part == ".." {
+			return "", fmt.Errorf("backup path %q cannot contain \"..\"", relpath)
+		}
+	}
+	return filepath.Join(tc.Server.BackupDir, relpath), nil
+}
+
+// EventKeepAlive is the interval between comments sent on idle mutation event streams.
+var EventKeepAlive = 30 * time.Second
+
+// streams mutation events for a data instance and version as server-sent events.
+func mutationEventsHandler(w http.ResponseWriter, r *http.Request, dataID, uuid dvid.UUID) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		BadRequest(w, r, "streaming of events is not supported by this connection")
+		return
+	}
+	queryStrings := r.URL.Query()
+	allVersions := queryStrings.Get("allversions") == "true"
+	sinceStr := queryStrings.Get("since")
+	if sinceStr == "" {
+		sinceStr = r.Header.Get("Last-Event-ID")
+	}
+	var since uint64
+	if sinceStr != "" {
+		var err error
+		if since, err = strconv.ParseUint(sinceStr, 10, 64); err != nil {
+			BadRequest(w, r, "bad mutation id %q for resuming events: %v", sinceStr, err)
+			return
+		}
+	}
+	sub, replay, gap := datastore.SubscribeMutationEvents(dataID, sinceStr != "", since)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	if gap {
+		fmt.Fprintf(w, "event: gap\ndata: {\"Since\": %d}\n\n", since)
+	}
+	writeEvent := func(evt datastore.MutationEvent) error {
+		if !allVersions && evt.Version != "" && evt.Version != uuid {
+			return nil
+		}
+		if evt.MutationID != 0 {
+			if _, err := fmt.Fprintf(w, "id: %d\n", evt.MutationID); err != nil {
+				return err
+			}
+		}
+		if evt.Action != "" {
+			if _, err := fmt.Fprintf(w, "event: %s\n", evt.Action); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "data: %s\n\n", bytes.Replace(evt.JSON, []byte("\n"), []byte("\ndata: "), -1))
+		return err
+	}
+	for _, evt := range replay {
+		if err := writeEvent(evt); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(EventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprintf(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case evt, ok := <-sub.C:
+			if !ok {
+				return // subscriber dropped, so client should resume with last event id.
+			}
+			if err := writeEvent(evt); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
 func blobstoreHandler(c web.C, w http.ResponseWriter, r *http.Request) {
 	method := strings.ToLower(r.Method)
 	if method != "get" {
@@ -1704,6 +2167,11 @@ func reposPostHandler(c web.C, w http.ResponseWriter, r *http.Request) {
 		BadRequest(w, r, "Cannot POST on repos endpoints in read-only mode")
 		return
 	}
+	end, ok := startMutation(w)
+	if !ok {
+		return
+	}
+	defer end()
 	config := dvid.NewConfig()
 	if r.Body != nil {
 		if err := config.SetByJSON(r.Body); err != nil {
@@ -2277,9 +2745,10 @@ func repoMergeHandler(c web.C, w http.ResponseWriter, r *http.Request) {
 	}
 
 	jsonData := struct {
-		MergeType string   `json:"mergeType"`
-		Note      string   `json:"note"`
-		Parents   []string `json:"parents"`
+		MergeType string                  `json:"mergeType"`
+		Note      string                  `json:"note"`
+		Parents   []string                `json:"parents"`
+		Manifest  datastore.MergeManifest `json:"manifest"`
 	}{}
 	if err := json.Unmarshal(data, &jsonData); err != nil {
 		BadRequest(w, r, fmt.Sprintf("Malformed JSON request in body: %v", err))
@@ -2306,13 +2775,26 @@ func repoMergeHandler(c web.C, w http.ResponseWriter, r *http.Request) {
 	switch jsonData.MergeType {
 	case "conflict-free":
 		mt = datastore.MergeConflictFree
+	case "auto":
+		mt = datastore.MergeTypeSpecificAuto
+	case "external":
+		mt = datastore.MergeExternalData
+		if len(jsonData.Manifest) == 0 {
+			BadRequest(w, r, "an 'external' merge requires a 'manifest'")
+			return
+		}
 	default:
-		BadRequest(w, r, "'mergeType' must be 'conflict-free' at this time")
+		BadRequest(w, r, "'mergeType' must be 'conflict-free', 'auto', or 'external'")
 		return
 	}
 
 	// Do the merge
-	newuuid, err := datastore.Merge(parents, jsonData.Note, mt)
+	var newuuid dvid.UUID
+	if mt == datastore.MergeExternalData {
+		newuuid, err = datastore.MergeWithManifest(parents, jsonData.Note, jsonData.Manifest)
+	} else {
+		newuuid, err = datastore.Merge(parents, jsonData.Note, mt)
+	}
 	if err != nil {
 		BadRequest(w, r, err)
 	} else {
@@ -2321,6 +2803,102 @@ func repoMergeHandler(c web.C, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func repoMergeStatusHandler(c web.C, w http.ResponseWriter, r *http.Request) {
+	var jsonBytes []byte
+	if childStr, found := c.URLParams["name"]; found {
+		child, _, err := datastore.MatchingUUID(childStr)
+		if err != nil {
+			BadRequest(w, r, err)
+			return
+		}
+		status, err := datastore.GetMergeStatus(child)
+		if err != nil {
+			BadRequest(w, r, err)
+			return
+		}
+		if jsonBytes, err = json.Marshal(status); err != nil {
+			BadRequest(w, r, err)
+			return
+		}
+	} else {
+		uuid := c.Env["uuid"].(dvid.UUID)
+		statuses, err := datastore.GetMergeStatuses(uuid)
+		if err != nil {
+			BadRequest(w, r, err)
+			return
+		}
+		if jsonBytes, err = json.Marshal(statuses); err != nil {
+			BadRequest(w, r, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+}
+
+func repoConflictsHandler(c web.C, w http.ResponseWriter, r *http.Request) {
+	uuid := c.Env["uuid"].(dvid.UUID)
+	root, err := datastore.GetRepoRoot(uuid)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	queryStrings := r.URL.Query()
+	parentsStr := queryStrings.Get("parents")
+	if parentsStr == "" {
+		BadRequest(w, r, "Must specify at least two parent UUIDs using 'parents' query string")
+		return
+	}
+	var parents []dvid.UUID
+	for _, uuidFrag := range strings.Split(parentsStr, ",") {
+		parent, _, err := datastore.MatchingUUID(uuidFrag)
+		if err != nil {
+			BadRequest(w, r, fmt.Sprintf("can't match parent %q: %v", uuidFrag, err))
+			return
+		}
+		parentRoot, err := datastore.GetRepoRoot(parent)
+		if err != nil {
+			BadRequest(w, r, err)
+			return
+		}
+		if parentRoot != root {
+			BadRequest(w, r, "parent %s is not in the repo of %s", parent, uuid)
+			return
+		}
+		parents = append(parents, parent)
+	}
+	if len(parents) < 2 {
+		BadRequest(w, r, "Must specify at least two parent UUIDs using 'parents' query string")
+		return
+	}
+	var names []dvid.InstanceName
+	if dataStr := queryStrings.Get("data"); dataStr != "" {
+		for _, name := range strings.Split(dataStr, ",") {
+			names = append(names, dvid.InstanceName(name))
+		}
+	}
+	maxSamples := 20
+	if samplesStr := queryStrings.Get("samples"); samplesStr != "" {
+		if maxSamples, err = strconv.Atoi(samplesStr); err != nil || maxSamples < 0 {
+			BadRequest(w, r, "bad 'samples' query string: %q", samplesStr)
+			return
+		}
+	}
+
+	reports, err := datastore.MergeConflicts(parents, names, maxSamples)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	jsonBytes, err := json.Marshal(reports)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+}
+
 func repoResolveHandler(c web.C, w http.ResponseWriter, r *http.Request) {
 	uuid, _, err := datastore.MatchingUUID(c.URLParams["uuid"])
 	if err != nil {
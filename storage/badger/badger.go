@@ -145,6 +145,7 @@ func (e Engine) newDB(config dvid.StoreConfig) (*BadgerDB, bool, error) {
 		return nil, false, err
 	}
 	badgerDB.bdp = bdp
+	badgerDB.counters = storage.NewStoreCounters(badgerDB.String())
 
 	// if we know it's newly created, just return.
 	if created {
@@ -219,6 +220,8 @@ type BadgerDB struct {
 
 	options *badger.Options
 	bdp     *badger.DB
+
+	counters *storage.StoreCounters
 }
 
 // Close closes the BadgerDB
@@ -270,6 +273,7 @@ func (db *BadgerDB) Get(ctx storage.Context, tk storage.TKey) ([]byte, error) {
 	if db == nil {
 		return nil, fmt.Errorf("Can't call GET on nil BadgerDB")
 	}
+	db.counters.CountGet()
 	if db.options == nil {
 		return nil, fmt.Errorf("Can't call GET on db with nil options: %v", db)
 	}
@@ -536,6 +540,7 @@ func (db *BadgerDB) KeysInRange(ctx storage.Context, kStart, kEnd storage.TKey)
 	if db == nil {
 		return nil, fmt.Errorf("Can't call KeysInRange on nil BadgerDB")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return nil, fmt.Errorf("Received nil context in KeysInRange()")
 	}
@@ -578,6 +583,7 @@ func (db *BadgerDB) SendKeysInRange(ctx storage.Context, kStart, kEnd storage.TK
 	if db == nil {
 		return fmt.Errorf("Can't call SendKeysInRange on nil BadgerDB")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in SendKeysInRange()")
 	}
@@ -616,6 +622,7 @@ func (db *BadgerDB) GetRange(ctx storage.Context, kStart, kEnd storage.TKey) ([]
 	if db == nil {
 		return nil, fmt.Errorf("Can't call GetRange on nil BadgerDB")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return nil, fmt.Errorf("Received nil context in GetRange()")
 	}
@@ -658,6 +665,7 @@ func (db *BadgerDB) ProcessRange(ctx storage.Context, kStart, kEnd storage.TKey,
 	if db == nil {
 		return fmt.Errorf("Can't call ProcessRange on nil BadgerDB")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in ProcessRange()")
 	}
@@ -706,39 +714,65 @@ func (db *BadgerDB) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out c
 	if db == nil {
 		return fmt.Errorf("Can't call RawRangeQuery on nil BadgerDB")
 	}
-	err := db.bdp.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		if keysOnly {
-			opts.PrefetchValues = false
+	db.counters.CountRange()
+	return db.bdp.View(func(txn *badger.Txn) error {
+		return rawRangeQuery(txn, kStart, kEnd, keysOnly, out, cancel)
+	})
+}
+
+func rawRangeQuery(txn *badger.Txn, kStart, kEnd storage.Key, keysOnly bool, out chan *storage.KeyValue, cancel <-chan struct{}) error {
+	opts := badger.DefaultIteratorOptions
+	if keysOnly {
+		opts.PrefetchValues = false
+	}
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Seek(kStart); it.Valid(); it.Next() {
+		kv := new(storage.KeyValue)
+		item := it.Item()
+		kv.K = item.KeyCopy(nil)
+		storage.StoreKeyBytesRead <- len(kv.K)
+		// Did we pass the final key?
+		if bytes.Compare(kv.K, kEnd) > 0 {
+			break
 		}
-		it := txn.NewIterator(opts)
-		defer it.Close()
-		for it.Seek(kStart); it.Valid(); it.Next() {
-			kv := new(storage.KeyValue)
-			item := it.Item()
-			kv.K = item.KeyCopy(nil)
-			storage.StoreKeyBytesRead <- len(kv.K)
-			// Did we pass the final key?
-			if bytes.Compare(kv.K, kEnd) > 0 {
-				break
-			}
-			if !keysOnly {
-				var err error
-				if kv.V, err = item.ValueCopy(nil); err != nil {
-					return err
-				}
-				storage.StoreValueBytesRead <- len(kv.V)
-			}
-			select {
-			case out <- kv:
-			case <-cancel:
-				return nil
+		if !keysOnly {
+			var err error
+			if kv.V, err = item.ValueCopy(nil); err != nil {
+				return err
 			}
+			storage.StoreValueBytesRead <- len(kv.V)
 		}
-		out <- nil
-		return nil
-	})
-	return err
+		select {
+		case out <- kv:
+		case <-cancel:
+			return nil
+		}
+	}
+	out <- nil
+	return nil
+}
+
+// rawSnapshot is a point-in-time view of the store using a read-only transaction.
+type rawSnapshot struct {
+	txn *badger.Txn
+}
+
+func (s rawSnapshot) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out chan *storage.KeyValue, cancel <-chan struct{}) error {
+	return rawRangeQuery(s.txn, kStart, kEnd, keysOnly, out, cancel)
+}
+
+func (s rawSnapshot) Release() {
+	s.txn.Discard()
+}
+
+// NewRawSnapshot returns a view of the store for raw range queries that is unaffected by
+// later writes.  It must be released when no longer needed.
+func (db *BadgerDB) NewRawSnapshot() (storage.RawSnapshot, error) {
+	if db == nil {
+		return nil, fmt.Errorf("Can't call NewRawSnapshot on nil BadgerDB")
+	}
+	return rawSnapshot{db.bdp.NewTransaction(false)}, nil
 }
 
 // ---- KeyValueSetter interface ------
@@ -748,6 +782,7 @@ func (db *BadgerDB) Put(ctx storage.Context, tk storage.TKey, v []byte) error {
 	if db == nil {
 		return fmt.Errorf("Can't call Put on nil BadgerDB")
 	}
+	db.counters.CountPut()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in Put()")
 	}
@@ -785,6 +820,7 @@ func (db *BadgerDB) RawPut(k storage.Key, v []byte) error {
 	if db == nil {
 		return fmt.Errorf("Can't call RawPut on nil BadgerDB")
 	}
+	db.counters.CountPut()
 	err := db.bdp.Update(func(txn *badger.Txn) error {
 		return txn.Set(k, v)
 	})
@@ -848,6 +884,7 @@ func (db *BadgerDB) PutRange(ctx storage.Context, kvs []storage.TKeyValue) error
 	if db == nil {
 		return fmt.Errorf("Can't call PutRange on nil BadgerDB")
 	}
+	db.counters.CountPut()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in PutRange()")
 	}
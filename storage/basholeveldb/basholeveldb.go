@@ -195,6 +195,7 @@ func (e Engine) newLevelDB(config dvid.StoreConfig) (*LevelDB, bool, error) {
 		return nil, false, err
 	}
 	leveldb.ldb = ldb
+	leveldb.counters = storage.NewStoreCounters(leveldb.String())
 
 	// if we know it's newly created, just return.
 	if created {
@@ -284,6 +285,8 @@ type LevelDB struct {
 
 	options *leveldbOptions
 	ldb     *levigo.DB
+
+	counters *storage.StoreCounters
 }
 
 func getOptions(config dvid.Config) (*leveldbOptions, error) {
@@ -441,6 +444,7 @@ func (db *LevelDB) Get(ctx storage.Context, tk storage.TKey) ([]byte, error) {
 	if db == nil {
 		return nil, fmt.Errorf("Can't call GET on nil LevelDB")
 	}
+	db.counters.CountGet()
 	if db.options == nil {
 		return nil, fmt.Errorf("Can't call GET on db with nil options: %v", db)
 	}
@@ -708,6 +712,7 @@ func (db *LevelDB) KeysInRange(ctx storage.Context, kStart, kEnd storage.TKey) (
 	if db == nil {
 		return nil, fmt.Errorf("Can't call KeysInRange on nil LevelDB")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return nil, fmt.Errorf("Received nil context in KeysInRange()")
 	}
@@ -750,6 +755,7 @@ func (db *LevelDB) SendKeysInRange(ctx storage.Context, kStart, kEnd storage.TKe
 	if db == nil {
 		return fmt.Errorf("Can't call SendKeysInRange on nil LevelDB")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in SendKeysInRange()")
 	}
@@ -788,6 +794,7 @@ func (db *LevelDB) GetRange(ctx storage.Context, kStart, kEnd storage.TKey) ([]*
 	if db == nil {
 		return nil, fmt.Errorf("Can't call GetRange on nil LevelDB")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return nil, fmt.Errorf("Received nil context in GetRange()")
 	}
@@ -830,6 +837,7 @@ func (db *LevelDB) ProcessRange(ctx storage.Context, kStart, kEnd storage.TKey,
 	if db == nil {
 		return fmt.Errorf("Can't call ProcessRange on nil LevelDB")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in ProcessRange()")
 	}
@@ -878,6 +886,7 @@ func (db *LevelDB) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out ch
 	if db == nil {
 		return fmt.Errorf("Can't call RawRangeQuery on nil LevelDB")
 	}
+	db.counters.CountRange()
 	ro := levigo.NewReadOptions()
 	it := db.ldb.NewIterator(ro)
 	defer it.Close()
@@ -922,6 +931,7 @@ func (db *LevelDB) Put(ctx storage.Context, tk storage.TKey, v []byte) error {
 	if db == nil {
 		return fmt.Errorf("Can't call Put on nil LevelDB")
 	}
+	db.counters.CountPut()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in Put()")
 	}
@@ -959,6 +969,7 @@ func (db *LevelDB) RawPut(k storage.Key, v []byte) error {
 	if db == nil {
 		return fmt.Errorf("Can't call RawPut on nil LevelDB")
 	}
+	db.counters.CountPut()
 	wo := db.options.WriteOptions
 	dvid.StartCgo()
 	defer dvid.StopCgo()
@@ -1026,6 +1037,7 @@ func (db *LevelDB) PutRange(ctx storage.Context, kvs []storage.TKeyValue) error
 	if db == nil {
 		return fmt.Errorf("Can't call PutRange on nil LevelDB")
 	}
+	db.counters.CountPut()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in PutRange()")
 	}
@@ -193,6 +193,7 @@ func (e *Engine) newBigTable(config dvid.StoreConfig) (*BigTable, bool, error) {
 	if err != nil {
 		return nil, false, fmt.Errorf("Error in newBigTable() %s\n", err)
 	}
+	bt.counters = storage.NewStoreCounters(bt.String())
 
 	if bt.testing {
 
@@ -287,6 +288,8 @@ type BigTable struct {
 	testing bool
 	testSrv *bttest.Server
 	ctx     context.Context
+
+	counters *storage.StoreCounters
 }
 
 func (db *BigTable) String() string {
@@ -316,6 +319,7 @@ func (db *BigTable) Get(ctx storage.Context, tk storage.TKey) ([]byte, error) {
 	if db == nil {
 		return nil, fmt.Errorf("Can't call Get() on nil BigTable")
 	}
+	db.counters.CountGet()
 	if ctx == nil {
 		return nil, fmt.Errorf("Received nil context in Get()")
 	}
@@ -349,6 +353,7 @@ func (db *BigTable) GetRange(ctx storage.Context, TkBeg, TkEnd storage.TKey) ([]
 	if db == nil {
 		return nil, fmt.Errorf("Can't call GetRange() on nil BigTable")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return nil, fmt.Errorf("Received nil context in GetRange()")
 	}
@@ -405,6 +410,7 @@ func (db *BigTable) KeysInRange(ctx storage.Context, TkBeg, TkEnd storage.TKey)
 	if db == nil {
 		return nil, fmt.Errorf("Can't call KeysInRange() on nil BigTable")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return nil, fmt.Errorf("Received nil context in KeysInRange()")
 	}
@@ -462,6 +468,7 @@ func (db *BigTable) SendKeysInRange(ctx storage.Context, TkBeg, TkEnd storage.TK
 	if db == nil {
 		return fmt.Errorf("Can't call SendKeysInRange() on nil BigTable")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in SendKeysInRange()")
 	}
@@ -516,6 +523,7 @@ func (db *BigTable) ProcessRange(ctx storage.Context, TkBeg, TkEnd storage.TKey,
 	if db == nil {
 		return fmt.Errorf("Can't call ProcessRange() on nil BigTable")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in ProcessRange()")
 	}
@@ -588,6 +596,7 @@ func (db *BigTable) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out c
 	if db == nil {
 		return fmt.Errorf("Can't call RawRangeQuery() on nil BigTable")
 	}
+	db.counters.CountRange()
 
 	unvKeyBeg, verKeyBeg, err := storage.SplitKey(kStart)
 	if err != nil {
@@ -653,6 +662,7 @@ func (db *BigTable) Put(ctx storage.Context, tkey storage.TKey, value []byte) er
 	if db == nil {
 		return fmt.Errorf("Can't call Put() on nil BigTable")
 	}
+	db.counters.CountPut()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in Put()")
 	}
@@ -730,6 +740,7 @@ func (db *BigTable) RawPut(fullKey storage.Key, value []byte) error {
 	if db == nil {
 		return fmt.Errorf("Can't call RawPut() on nil BigTable")
 	}
+	db.counters.CountPut()
 
 	unvKey, verKey, err := storage.SplitKey(fullKey)
 	if err != nil {
@@ -802,6 +813,7 @@ func (db *BigTable) PutRange(ctx storage.Context, TKeyValue []storage.TKeyValue)
 	if db == nil {
 		return fmt.Errorf("Can't call PutRange() on nil BigTable")
 	}
+	db.counters.CountPut()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in PutRange()")
 	}
@@ -130,8 +130,9 @@ func parseConfig(config dvid.StoreConfig) (path string, testing bool, err error)
 }
 
 type fileStore struct {
-	path   string
-	config dvid.StoreConfig
+	path     string
+	config   dvid.StoreConfig
+	counters *storage.StoreCounters
 }
 
 // newStore returns a file-based key-value store, insuring a directory at the path.
@@ -156,6 +157,7 @@ func (e Engine) newStore(config dvid.StoreConfig) (*fileStore, bool, error) {
 		path:   path,
 		config: config,
 	}
+	store.counters = storage.NewStoreCounters(store.String())
 	return store, created, nil
 }
 
@@ -223,6 +225,7 @@ func (fs *fileStore) Get(ctx storage.Context, tk storage.TKey) ([]byte, error) {
 	if fs == nil {
 		return nil, fmt.Errorf("bad fileStore specified for Get on %s", ctx)
 	}
+	fs.counters.CountGet()
 	dirpath, filename, err := fs.filepathFromTKey(ctx, tk)
 	if err != nil {
 		return nil, err
@@ -243,6 +246,7 @@ func (fs *fileStore) GetWithTimestamp(ctx storage.Context, tk storage.TKey) (dat
 		err = fmt.Errorf("bad fileStore specified for GetWithTimestamp on %s", ctx)
 		return
 	}
+	fs.counters.CountGet()
 	var dirpath, filename string
 	if dirpath, filename, err = fs.filepathFromTKey(ctx, tk); err != nil {
 		return
@@ -273,6 +277,7 @@ func (fs *fileStore) Put(ctx storage.Context, tk storage.TKey, v []byte) error {
 	if fs == nil {
 		return fmt.Errorf("bad fileStore specified for Put on %s", ctx)
 	}
+	fs.counters.CountPut()
 	dirpath, filename, err := fs.filepathFromTKey(ctx, tk)
 	if err != nil {
 		return err
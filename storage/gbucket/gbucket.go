@@ -161,6 +161,7 @@ func parseConfig(config dvid.StoreConfig) (*GBucket, error) {
 		activeOps:      make(chan interface{}, MAXNETOPS),
 		config:         config,
 	}
+	gb.counters = storage.NewStoreCounters(gb.String())
 	return gb, nil
 }
 
@@ -269,6 +270,7 @@ type GBucket struct {
 	mutex     sync.Mutex
 	projectid string
 	config    dvid.StoreConfig
+	counters  *storage.StoreCounters
 }
 
 // ---- HELPER FUNCTIONS ----
@@ -1581,6 +1583,7 @@ func (db *GBucket) rawDelete(ctx storage.Context, fullKey storage.Key) error {
 
 // Get returns a value given a key.
 func (db *GBucket) Get(ctx storage.Context, tk storage.TKey) ([]byte, error) {
+	db.counters.CountGet()
 	db.grabOpResource()
 	defer db.releaseOpResource()
 
@@ -1613,6 +1616,7 @@ func (db *GBucket) KeysInRange(ctx storage.Context, TkBeg, TkEnd storage.TKey) (
 	if db == nil {
 		return nil, fmt.Errorf("Can't call KeysInRange() on nil Google bucket")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return nil, fmt.Errorf("Received nil context in KeysInRange()")
 	}
@@ -1644,6 +1648,7 @@ func (db *GBucket) GetRange(ctx storage.Context, TkBeg, TkEnd storage.TKey) ([]*
 	if db == nil {
 		return nil, fmt.Errorf("Can't call GetRange() on nil GBucket")
 	}
+	db.counters.CountRange()
 	if ctx == nil {
 		return nil, fmt.Errorf("Received nil context in GetRange()")
 	}
@@ -1698,6 +1703,7 @@ func (db *GBucket) GetRange(ctx storage.Context, TkBeg, TkEnd storage.TKey) ([]*
 // receiving function can be organized as a pool of chunk handling goroutines.
 // See datatype/imageblk.ProcessChunk() for an example.
 func (db *GBucket) ProcessRange(ctx storage.Context, TkBeg, TkEnd storage.TKey, op *storage.ChunkOp, f storage.ChunkFunc) error {
+	db.counters.CountRange()
 	// use buffer interface
 	buffer := db.NewBuffer(ctx)
 
@@ -1725,6 +1731,7 @@ func (db *GBucket) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out ch
 
 // Put writes a value with given key in a possibly versioned context.
 func (db *GBucket) Put(ctx storage.Context, tkey storage.TKey, value []byte) error {
+	db.counters.CountPut()
 	// use buffer interface
 	buffer := db.NewBuffer(ctx)
 
@@ -1922,6 +1929,7 @@ func (db *GBucket) Patch(ctx storage.Context, tk storage.TKey, f storage.PatchFu
 
 // Put key-value pairs.  This is currently executed with parallel requests.
 func (db *GBucket) PutRange(ctx storage.Context, kvs []storage.TKeyValue) error {
+	db.counters.CountPut()
 	// use buffer interface
 	buffer := db.NewBuffer(ctx)
 
@@ -0,0 +1,1098 @@
+//go:build golsm
+// +build golsm
+
+package golsm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// Default options for the LSM tree.
+const (
+	DefaultWriteBufferSize   = 64 * dvid.Mega
+	DefaultBlockSize         = 64 * dvid.Kilo
+	DefaultBloomBits         = 10
+	DefaultCompactionTrigger = 4
+	DefaultMaxTables         = 24
+)
+
+// Options for the LSM tree.
+type Options struct {
+	// WriteBufferSize is the approximate bytes of writes held in a memtable before it is
+	// flushed to a sorted table.
+	WriteBufferSize int
+
+	// BlockSize is the approximate bytes of entries in each table block.
+	BlockSize int
+
+	// BloomBitsPerKey is the number of bloom filter bits per key in each table.
+	BloomBitsPerKey int
+
+	// Sync writes the write-ahead log to stable storage on each write.
+	Sync bool
+
+	// CompactionTrigger is the minimum number of similarly-sized recent tables that
+	// are merged into one table.
+	CompactionTrigger int
+
+	// MaxTables is the number of tables beyond which the most recent tables are merged
+	// regardless of size.
+	MaxTables int
+}
+
+func (opts *Options) setDefaults() {
+	if opts.WriteBufferSize <= 0 {
+		opts.WriteBufferSize = DefaultWriteBufferSize
+	}
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = DefaultBlockSize
+	}
+	if opts.BloomBitsPerKey <= 0 {
+		opts.BloomBitsPerKey = DefaultBloomBits
+	}
+	if opts.CompactionTrigger < 2 {
+		opts.CompactionTrigger = DefaultCompactionTrigger
+	}
+	if opts.MaxTables < opts.CompactionTrigger {
+		opts.MaxTables = DefaultMaxTables
+	}
+}
+
+// maximum number of memtables waiting to be flushed before writes are stalled.
+const maxImmutable = 2
+
+var errClosed = errors.New("lsm database is closed")
+
+// DB is a log-structured merge tree.  Writes go to a write-ahead log and an in-memory
+// memtable that is flushed to an immutable sorted table when full.  Recent tables of
+// similar size are merged in the background.  Every entry carries a sequence number so
+// snapshots can read a consistent point-in-time view while writes continue.
+type DB struct {
+	dir  string
+	opts Options
+
+	writeMu sync.Mutex // serializes writers
+
+	mu          sync.Mutex
+	cond        *sync.Cond // signaled when memtables are flushed or background error
+	mem         *memtable
+	imm         []*memtable // memtables being flushed, newest first
+	tables      []*table    // newest first
+	log         *os.File
+	nextFileNum uint64
+	lastSeq     uint64
+	snapshots   map[uint64]int // count of live snapshots at each sequence number
+	bgErr       error
+	closed      int32 // set atomically
+
+	flushCh   chan struct{}
+	compactCh chan struct{}
+	done      chan struct{} // closed to stop background goroutines
+	wg        sync.WaitGroup
+}
+
+type manifest struct {
+	NextFileNum uint64
+	LogNum      uint64 // logs with number >= LogNum have writes not yet in tables
+	LastSeq     uint64
+	Tables      []uint64 // newest first
+}
+
+func fileName(dir string, num uint64, ext string) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.%s", num, ext))
+}
+
+func manifestName(dir string) string {
+	return filepath.Join(dir, "MANIFEST")
+}
+
+// returns the numbered files in the directory with the given extension in ascending order.
+func listFiles(dir, ext string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var nums []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, "."+ext) {
+			continue
+		}
+		num, err := strconv.ParseUint(strings.TrimSuffix(name, "."+ext), 10, 64)
+		if err != nil {
+			continue
+		}
+		nums = append(nums, num)
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+	return nums, nil
+}
+
+func readManifest(dir string) (*manifest, error) {
+	data, err := os.ReadFile(manifestName(dir))
+	if err != nil {
+		return nil, err
+	}
+	m := new(manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("bad manifest in %q: %v", dir, err)
+	}
+	return m, nil
+}
+
+// writeManifest atomically replaces the manifest.
+func writeManifest(dir string, m *manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmpName := manifestName(dir) + ".tmp"
+	f, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, manifestName(dir)); err != nil {
+		return err
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Open opens or creates a database in the given directory.
+func Open(dir string, opts Options) (*DB, error) {
+	opts.setDefaults()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	m, err := readManifest(dir)
+	if os.IsNotExist(err) {
+		tableNums, err := listFiles(dir, "sst")
+		if err != nil {
+			return nil, err
+		}
+		if len(tableNums) != 0 {
+			return nil, fmt.Errorf("tables but no manifest found in %q; repair database", dir)
+		}
+		m = &manifest{NextFileNum: 1}
+	} else if err != nil {
+		return nil, err
+	}
+
+	db := &DB{
+		dir:         dir,
+		opts:        opts,
+		nextFileNum: m.NextFileNum,
+		lastSeq:     m.LastSeq,
+		snapshots:   make(map[uint64]int),
+		flushCh:     make(chan struct{}, 1),
+		compactCh:   make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	db.cond = sync.NewCond(&db.mu)
+	live := make(map[uint64]struct{}, len(m.Tables))
+	for _, num := range m.Tables {
+		t, err := openTable(fileName(dir, num, "sst"), num)
+		if err != nil {
+			db.unrefTables()
+			return nil, err
+		}
+		db.tables = append(db.tables, t)
+		live[num] = struct{}{}
+		if num >= db.nextFileNum {
+			db.nextFileNum = num + 1
+		}
+	}
+
+	// Remove tables from interrupted flushes or compactions.
+	tableNums, err := listFiles(dir, "sst")
+	if err != nil {
+		db.unrefTables()
+		return nil, err
+	}
+	for _, num := range tableNums {
+		if _, found := live[num]; !found {
+			dvid.Infof("Removing unused table %s\n", fileName(dir, num, "sst"))
+			os.Remove(fileName(dir, num, "sst"))
+		}
+		if num >= db.nextFileNum {
+			db.nextFileNum = num + 1
+		}
+	}
+
+	// Replay logs with writes that were not flushed.
+	logNums, err := listFiles(dir, "log")
+	if err != nil {
+		db.unrefTables()
+		return nil, err
+	}
+	recovered := newMemtable(0)
+	for _, num := range logNums {
+		if num >= db.nextFileNum {
+			db.nextFileNum = num + 1
+		}
+		if num < m.LogNum {
+			continue
+		}
+		if err := replayLog(fileName(dir, num, "log"), recovered, &db.lastSeq); err != nil {
+			db.unrefTables()
+			return nil, err
+		}
+	}
+	if !recovered.empty() {
+		t, err := db.writeTable(recovered.newIterator(), db.lastSeq, len(db.tables) == 0)
+		if err != nil {
+			db.unrefTables()
+			return nil, err
+		}
+		if t != nil {
+			db.tables = append([]*table{t}, db.tables...)
+		}
+	}
+	if err := db.newLog(); err != nil {
+		db.unrefTables()
+		return nil, err
+	}
+	if err := db.saveManifest(); err != nil {
+		db.log.Close()
+		db.unrefTables()
+		return nil, err
+	}
+	db.removeObsoleteLogs(db.minLogNum())
+
+	db.wg.Add(2)
+	go db.flusher()
+	go db.compactor()
+	db.compactCh <- struct{}{}
+	return db, nil
+}
+
+func (db *DB) unrefTables() {
+	for _, t := range db.tables {
+		t.unref()
+	}
+	db.tables = nil
+}
+
+// newLog starts a new write-ahead log and memtable.  Must hold mu or be opening.
+func (db *DB) newLog() error {
+	num := db.nextFileNum
+	db.nextFileNum++
+	f, err := os.OpenFile(fileName(db.dir, num, "log"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if db.log != nil {
+		if err := db.log.Sync(); err != nil {
+			dvid.Errorf("unable to sync log for %q: %v\n", db.dir, err)
+		}
+		db.log.Close()
+	}
+	db.log = f
+	db.mem = newMemtable(num)
+	return nil
+}
+
+// saveManifest writes the current set of tables.  Must hold mu or be opening.
+func (db *DB) saveManifest() error {
+	m := &manifest{
+		NextFileNum: db.nextFileNum,
+		LogNum:      db.minLogNum(),
+		LastSeq:     db.lastSeq,
+		Tables:      make([]uint64, len(db.tables)),
+	}
+	for i, t := range db.tables {
+		m.Tables[i] = t.num
+	}
+	return writeManifest(db.dir, m)
+}
+
+// returns the oldest log still needed for writes not in tables.
+func (db *DB) minLogNum() uint64 {
+	num := db.mem.logNum
+	for _, m := range db.imm {
+		if m.logNum < num {
+			num = m.logNum
+		}
+	}
+	return num
+}
+
+// removeObsoleteLogs deletes logs older than the given log number.
+func (db *DB) removeObsoleteLogs(minNum uint64) {
+	logNums, err := listFiles(db.dir, "log")
+	if err != nil {
+		dvid.Errorf("unable to list logs in %q: %v\n", db.dir, err)
+		return
+	}
+	for _, num := range logNums {
+		if num < minNum {
+			os.Remove(fileName(db.dir, num, "log"))
+		}
+	}
+}
+
+// Close waits for background work to stop and closes the database.  Writes not yet
+// flushed to tables are recovered from the write-ahead log on the next Open.
+func (db *DB) Close() error {
+	if !atomic.CompareAndSwapInt32(&db.closed, 0, 1) {
+		return errClosed
+	}
+	// wake any writer waiting for a flush so it can see the database is closed.
+	db.mu.Lock()
+	db.cond.Broadcast()
+	db.mu.Unlock()
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	// flushCh and compactCh are never closed since background goroutines send on them.
+	close(db.done)
+	db.wg.Wait()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var err error
+	if db.log != nil {
+		err = db.log.Sync()
+		db.log.Close()
+		db.log = nil
+	}
+	db.unrefTables()
+	return err
+}
+
+func (db *DB) isClosed() bool {
+	return atomic.LoadInt32(&db.closed) == 1
+}
+
+// ---- writes ----
+
+func appendUvarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	return append(b, buf[:n]...)
+}
+
+// Batch is a set of writes applied atomically.
+type Batch struct {
+	data  []byte
+	count uint32
+}
+
+// Put adds a write of a key-value pair to the batch.
+func (b *Batch) Put(key, value []byte) {
+	b.data = append(b.data, byte(kindPut))
+	b.data = appendUvarint(b.data, uint64(len(key)))
+	b.data = append(b.data, key...)
+	b.data = appendUvarint(b.data, uint64(len(value)))
+	b.data = append(b.data, value...)
+	b.count++
+}
+
+// Delete adds a deletion of a key to the batch.
+func (b *Batch) Delete(key []byte) {
+	b.data = append(b.data, byte(kindDelete))
+	b.data = appendUvarint(b.data, uint64(len(key)))
+	b.data = append(b.data, key...)
+	b.count++
+}
+
+// Len returns the number of writes in the batch.
+func (b *Batch) Len() int {
+	return int(b.count)
+}
+
+// Reset clears the batch for reuse.
+func (b *Batch) Reset() {
+	b.data = b.data[:0]
+	b.count = 0
+}
+
+// Log records are a uint32 crc of the payload, uint32 payload length, and a payload
+// of the uint64 sequence number of the first write, uint32 number of writes, and the
+// batch data.
+const logHeaderSize = 8
+
+func encodeRecord(seq uint64, b *Batch) []byte {
+	payloadSize := 12 + len(b.data)
+	record := make([]byte, logHeaderSize+payloadSize)
+	payload := record[logHeaderSize:]
+	binary.LittleEndian.PutUint64(payload, seq)
+	binary.LittleEndian.PutUint32(payload[8:], b.count)
+	copy(payload[12:], b.data)
+	binary.LittleEndian.PutUint32(record, crc32.Checksum(payload, crcTable))
+	binary.LittleEndian.PutUint32(record[4:], uint32(payloadSize))
+	return record
+}
+
+// applyRecord adds the writes of a log record payload to the memtable and returns the
+// sequence number of the last write.
+func applyRecord(payload []byte, mem *memtable) (uint64, error) {
+	if len(payload) < 12 {
+		return 0, fmt.Errorf("log record too short")
+	}
+	seq := binary.LittleEndian.Uint64(payload)
+	count := binary.LittleEndian.Uint32(payload[8:])
+	data := payload[12:]
+	readBytes := func() ([]byte, error) {
+		n, sz := binary.Uvarint(data)
+		if sz <= 0 || uint64(len(data)-sz) < n {
+			return nil, fmt.Errorf("corrupt log record")
+		}
+		b := data[sz : sz+int(n)]
+		data = data[sz+int(n):]
+		return b, nil
+	}
+	for i := uint32(0); i < count; i++ {
+		if len(data) == 0 {
+			return 0, fmt.Errorf("log record has fewer than %d writes", count)
+		}
+		k := kind(data[0])
+		data = data[1:]
+		key, err := readBytes()
+		if err != nil {
+			return 0, err
+		}
+		var value []byte
+		if k == kindPut {
+			if value, err = readBytes(); err != nil {
+				return 0, err
+			}
+		} else if k != kindDelete {
+			return 0, fmt.Errorf("bad write kind %d in log record", k)
+		}
+		mem.add(key, seq+uint64(i), k, value)
+	}
+	return seq + uint64(count) - 1, nil
+}
+
+// replayLog adds the writes in a log to the memtable, stopping at any torn or corrupt
+// record at the end of the log, which can occur if the process crashed during a write.
+func replayLog(filename string, mem *memtable, lastSeq *uint64) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var header [logHeaderSize]byte
+	var numRecords int
+	for {
+		if _, err := io.ReadFull(f, header[:]); err != nil {
+			if err != io.EOF {
+				dvid.Errorf("ignoring partial record header at end of log %q\n", filename)
+			}
+			break
+		}
+		crc := binary.LittleEndian.Uint32(header[:])
+		payload := make([]byte, binary.LittleEndian.Uint32(header[4:]))
+		if _, err := io.ReadFull(f, payload); err != nil {
+			dvid.Errorf("ignoring partial record at end of log %q\n", filename)
+			break
+		}
+		if crc32.Checksum(payload, crcTable) != crc {
+			dvid.Errorf("ignoring corrupt record %d and remainder of log %q\n", numRecords, filename)
+			break
+		}
+		seq, err := applyRecord(payload, mem)
+		if err != nil {
+			dvid.Errorf("ignoring bad record %d and remainder of log %q: %v\n", numRecords, filename, err)
+			break
+		}
+		if seq > *lastSeq {
+			*lastSeq = seq
+		}
+		numRecords++
+	}
+	dvid.Infof("Recovered %d write batches from log %q\n", numRecords, filename)
+	return nil
+}
+
+// Write applies the batch atomically.
+func (db *DB) Write(b *Batch) error {
+	if b.count == 0 {
+		return nil
+	}
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	if db.isClosed() {
+		return errClosed
+	}
+
+	db.mu.Lock()
+	if err := db.makeRoomForWrite(); err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	seq := db.lastSeq + 1
+	mem, log := db.mem, db.log
+	db.mu.Unlock()
+
+	record := encodeRecord(seq, b)
+	if _, err := log.Write(record); err != nil {
+		return fmt.Errorf("unable to write log for %q: %v", db.dir, err)
+	}
+	if db.opts.Sync {
+		if err := log.Sync(); err != nil {
+			return fmt.Errorf("unable to sync log for %q: %v", db.dir, err)
+		}
+	}
+	lastSeq, err := applyRecord(record[logHeaderSize:], mem)
+	if err != nil {
+		return err
+	}
+
+	// make writes visible to new snapshots
+	db.mu.Lock()
+	db.lastSeq = lastSeq
+	db.mu.Unlock()
+	return nil
+}
+
+// Put writes a key-value pair.
+func (db *DB) Put(key, value []byte) error {
+	var b Batch
+	b.Put(key, value)
+	return db.Write(&b)
+}
+
+// Delete removes a key.
+func (db *DB) Delete(key []byte) error {
+	var b Batch
+	b.Delete(key)
+	return db.Write(&b)
+}
+
+// makeRoomForWrite switches to a new memtable if the current one is full, waiting if
+// too many memtables are waiting to be flushed.  Must hold mu.
+func (db *DB) makeRoomForWrite() error {
+	for {
+		switch {
+		case db.bgErr != nil:
+			return db.bgErr
+		case db.isClosed():
+			return errClosed
+		case db.mem.approximateSize() < int64(db.opts.WriteBufferSize):
+			return nil
+		case len(db.imm) >= maxImmutable:
+			db.cond.Wait()
+		default:
+			db.imm = append([]*memtable{db.mem}, db.imm...)
+			if err := db.newLog(); err != nil {
+				db.mem = db.imm[0]
+				db.imm = db.imm[1:]
+				return err
+			}
+			select {
+			case db.flushCh <- struct{}{}:
+			default:
+			}
+			return nil
+		}
+	}
+}
+
+// ---- snapshots and reads ----
+
+// Snapshot is a consistent, read-only view of the database at a point in time.
+type Snapshot struct {
+	db     *DB
+	seq    uint64
+	mem    *memtable
+	imm    []*memtable
+	tables []*table
+
+	released int32
+}
+
+// NewSnapshot returns a view of the database that is unaffected by later writes.  It
+// must be released when no longer needed so obsolete tables can be removed.
+func (db *DB) NewSnapshot() (*Snapshot, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.isClosed() {
+		return nil, errClosed
+	}
+	s := &Snapshot{
+		db:     db,
+		seq:    db.lastSeq,
+		mem:    db.mem,
+		imm:    append([]*memtable{}, db.imm...),
+		tables: append([]*table{}, db.tables...),
+	}
+	for _, t := range s.tables {
+		t.ref()
+	}
+	db.snapshots[s.seq]++
+	return s, nil
+}
+
+// Release frees the snapshot's resources.
+func (s *Snapshot) Release() {
+	if !atomic.CompareAndSwapInt32(&s.released, 0, 1) {
+		return
+	}
+	for _, t := range s.tables {
+		t.unref()
+	}
+	s.db.mu.Lock()
+	if s.db.snapshots[s.seq]--; s.db.snapshots[s.seq] <= 0 {
+		delete(s.db.snapshots, s.seq)
+	}
+	s.db.mu.Unlock()
+}
+
+// Get returns the value for a key and whether it was found.
+func (s *Snapshot) Get(key []byte) ([]byte, bool, error) {
+	mems := append([]*memtable{s.mem}, s.imm...)
+	for _, m := range mems {
+		if value, k, found := m.get(key, s.seq); found {
+			if k == kindDelete {
+				return nil, false, nil
+			}
+			return append([]byte{}, value...), true, nil
+		}
+	}
+	for _, t := range s.tables {
+		value, k, found, err := t.get(key, s.seq)
+		if err != nil {
+			return nil, false, err
+		}
+		if found {
+			if k == kindDelete {
+				return nil, false, nil
+			}
+			return value, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// NewIterator returns an iterator over the snapshot.  It must be closed before the
+// snapshot is released.
+func (s *Snapshot) NewIterator() *Iterator {
+	iters := []internalIterator{s.mem.newIterator()}
+	for _, m := range s.imm {
+		iters = append(iters, m.newIterator())
+	}
+	for _, t := range s.tables {
+		iters = append(iters, t.newIterator())
+	}
+	return &Iterator{snap: s, m: newMergingIterator(iters)}
+}
+
+// ApproximateSizes returns the approximate bytes in tables for each key range, where
+// each range includes its start key and excludes its end key.
+func (s *Snapshot) ApproximateSizes(ranges [][2][]byte) []uint64 {
+	sizes := make([]uint64, len(ranges))
+	for i, r := range ranges {
+		for _, t := range s.tables {
+			beg, end := t.approximateOffset(r[0]), t.approximateOffset(r[1])
+			if end > beg {
+				sizes[i] += end - beg
+			}
+		}
+	}
+	return sizes
+}
+
+// Get returns the current value for a key and whether it was found.
+func (db *DB) Get(key []byte) ([]byte, bool, error) {
+	s, err := db.NewSnapshot()
+	if err != nil {
+		return nil, false, err
+	}
+	defer s.Release()
+	return s.Get(key)
+}
+
+// ---- background flushes and compactions ----
+
+// returns the sequence number at or below which older versions of keys are not needed.
+// Must hold mu.
+func (db *DB) smallestSnapshot() uint64 {
+	smallest := db.lastSeq
+	for seq := range db.snapshots {
+		if seq < smallest {
+			smallest = seq
+		}
+	}
+	return smallest
+}
+
+func (db *DB) setBackgroundError(err error) {
+	db.mu.Lock()
+	if db.bgErr == nil && err != errClosed {
+		dvid.Criticalf("background error in lsm database %q: %v\n", db.dir, err)
+		db.bgErr = err
+	}
+	db.cond.Broadcast()
+	db.mu.Unlock()
+}
+
+// writeTable writes the entries from the iterator to a new table, dropping versions of
+// keys that are hidden from all snapshots and, if the table will hold the oldest data,
+// deletion tombstones.  Returns a nil table if no entries were written.
+func (db *DB) writeTable(it internalIterator, smallestSnap uint64, bottom bool) (*table, error) {
+	db.mu.Lock()
+	num := db.nextFileNum
+	db.nextFileNum++
+	db.mu.Unlock()
+
+	filename := fileName(db.dir, num, "sst")
+	tw, err := newTableWriter(filename, db.opts.BlockSize, db.opts.BloomBitsPerKey)
+	if err != nil {
+		return nil, err
+	}
+	var curKey []byte
+	lastSeqForKey := maxSeq
+	var n int
+	for it.seekGE(nil); it.valid(); it.next() {
+		if n++; n%10000 == 0 && db.isClosed() {
+			tw.abandon()
+			return nil, errClosed
+		}
+		key, seq := it.key(), it.seq()
+		if curKey == nil || string(key) != string(curKey) {
+			curKey = append(curKey[:0], key...)
+			lastSeqForKey = maxSeq
+		}
+		drop := lastSeqForKey <= smallestSnap // newer version visible to all snapshots
+		if !drop && bottom && it.kind() == kindDelete && seq <= smallestSnap {
+			drop = true
+		}
+		lastSeqForKey = seq
+		if drop {
+			continue
+		}
+		if err := tw.add(key, seq, it.kind(), it.value()); err != nil {
+			tw.abandon()
+			return nil, err
+		}
+	}
+	if err := it.err(); err != nil {
+		tw.abandon()
+		return nil, err
+	}
+	if tw.entries == 0 {
+		tw.abandon()
+		return nil, nil
+	}
+	if _, err := tw.finish(); err != nil {
+		os.Remove(filename)
+		return nil, err
+	}
+	return openTable(filename, num)
+}
+
+func (db *DB) flusher() {
+	defer db.wg.Done()
+	for {
+		select {
+		case <-db.done:
+			return
+		case <-db.flushCh:
+		}
+		for !db.isClosed() {
+			db.mu.Lock()
+			if len(db.imm) == 0 {
+				db.mu.Unlock()
+				break
+			}
+			mem := db.imm[len(db.imm)-1]
+			smallestSnap := db.smallestSnapshot()
+			bottom := len(db.tables) == 0
+			db.mu.Unlock()
+
+			t, err := db.writeTable(mem.newIterator(), smallestSnap, bottom)
+			if err != nil {
+				db.setBackgroundError(fmt.Errorf("flush failed: %v", err))
+				return
+			}
+			db.mu.Lock()
+			if t != nil {
+				db.tables = append([]*table{t}, db.tables...)
+			}
+			db.imm = db.imm[:len(db.imm)-1]
+			err = db.saveManifest()
+			minLogNum := db.minLogNum()
+			db.cond.Broadcast()
+			db.mu.Unlock()
+			if err != nil {
+				db.setBackgroundError(fmt.Errorf("unable to save manifest: %v", err))
+				return
+			}
+			db.removeObsoleteLogs(minLogNum)
+			select {
+			case db.compactCh <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// pickCompaction returns a run of the most recent tables to merge.  Tables are added to
+// the run while each is not much larger than the combined size of the more recent tables,
+// so tables grow geometrically.  Must hold mu.
+func (db *DB) pickCompaction() []*table {
+	n := len(db.tables)
+	if n < db.opts.CompactionTrigger {
+		return nil
+	}
+	sum := db.tables[0].size
+	k := 1
+	for k < n && db.tables[k].size*100 <= sum*101 {
+		sum += db.tables[k].size
+		k++
+	}
+	if k < db.opts.CompactionTrigger {
+		if n <= db.opts.MaxTables {
+			return nil
+		}
+		k = n - db.opts.MaxTables + 1
+		if k < 2 {
+			k = 2
+		}
+	}
+	return append([]*table{}, db.tables[:k]...)
+}
+
+func (db *DB) compactor() {
+	defer db.wg.Done()
+	for {
+		select {
+		case <-db.done:
+			return
+		case <-db.compactCh:
+		}
+		for !db.isClosed() {
+			if err := db.compactOnce(); err != nil {
+				if err != errNoCompaction {
+					db.setBackgroundError(fmt.Errorf("compaction failed: %v", err))
+					return
+				}
+				break
+			}
+		}
+	}
+}
+
+var errNoCompaction = errors.New("no compaction needed")
+
+func (db *DB) compactOnce() error {
+	db.mu.Lock()
+	run := db.pickCompaction()
+	if run == nil {
+		db.mu.Unlock()
+		return errNoCompaction
+	}
+	for _, t := range run {
+		t.ref()
+	}
+	smallestSnap := db.smallestSnapshot()
+	bottom := run[len(run)-1] == db.tables[len(db.tables)-1]
+	db.mu.Unlock()
+
+	iters := make([]internalIterator, len(run))
+	for i, t := range run {
+		iters[i] = t.newIterator()
+	}
+	out, err := db.writeTable(newMergingIterator(iters), smallestSnap, bottom)
+	for _, t := range run {
+		t.unref()
+	}
+	if err != nil {
+		return err
+	}
+
+	// Replace the run, which stays contiguous since flushes only add newer tables.
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	pos := -1
+	for i, t := range db.tables {
+		if t == run[0] {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 || pos+len(run) > len(db.tables) {
+		return fmt.Errorf("compacted tables no longer present")
+	}
+	tables := append([]*table{}, db.tables[:pos]...)
+	if out != nil {
+		tables = append(tables, out)
+	}
+	tables = append(tables, db.tables[pos+len(run):]...)
+	db.tables = tables
+	if err := db.saveManifest(); err != nil {
+		return err
+	}
+	for _, t := range run {
+		atomic.StoreInt32(&t.obsolete, 1)
+		t.unref()
+	}
+	var outSize uint64
+	if out != nil {
+		outSize = out.size
+	}
+	dvid.Debugf("Compacted %d tables into %d bytes in %q, now %d tables\n", len(run), outSize, db.dir, len(db.tables))
+	return nil
+}
+
+// ---- repair ----
+
+// Repair rebuilds the manifest of the database in the given directory from its tables
+// and logs.  Tables with unreadable metadata are moved to a "lost" subdirectory, tables
+// with corrupt blocks are rewritten without those blocks, and readable writes in logs are
+// saved to new tables.
+func Repair(dir string, opts Options) error {
+	opts.setDefaults()
+	db := &DB{dir: dir, opts: opts, snapshots: make(map[uint64]int)}
+	lostDir := filepath.Join(dir, "lost")
+	moveToLost := func(filename string) {
+		if err := os.MkdirAll(lostDir, 0755); err != nil {
+			dvid.Errorf("unable to make directory %q: %v\n", lostDir, err)
+			return
+		}
+		os.Rename(filename, filepath.Join(lostDir, filepath.Base(filename)))
+	}
+
+	tableNums, err := listFiles(dir, "sst")
+	if err != nil {
+		return err
+	}
+	logNums, err := listFiles(dir, "log")
+	if err != nil {
+		return err
+	}
+	for _, nums := range [][]uint64{tableNums, logNums} {
+		if len(nums) > 0 && nums[len(nums)-1] >= db.nextFileNum {
+			db.nextFileNum = nums[len(nums)-1] + 1
+		}
+	}
+	if db.nextFileNum == 0 {
+		db.nextFileNum = 1
+	}
+
+	for _, num := range tableNums {
+		filename := fileName(dir, num, "sst")
+		t, err := openTable(filename, num)
+		if err != nil {
+			dvid.Errorf("moving unreadable table: %v\n", err)
+			moveToLost(filename)
+			continue
+		}
+		// Copy readable entries into a memtable if any block is corrupt.
+		var salvage *memtable
+		for i := range t.handles {
+			b, err := t.readBlock(i)
+			if err != nil {
+				dvid.Errorf("skipping block in repair: %v\n", err)
+				if salvage == nil {
+					salvage = newMemtable(0)
+				}
+				continue
+			}
+			for b.next(); b.valid(); b.next() {
+				if b.seq > db.lastSeq {
+					db.lastSeq = b.seq
+				}
+			}
+			if b.err != nil {
+				dvid.Errorf("skipping remainder of block %d of table %q: %v\n", i, filename, b.err)
+				if salvage == nil {
+					salvage = newMemtable(0)
+				}
+			}
+		}
+		if salvage == nil {
+			db.tables = append(db.tables, t)
+			continue
+		}
+		for i := range t.handles {
+			if b, err := t.readBlock(i); err == nil {
+				for b.next(); b.valid(); b.next() {
+					salvage.add(b.k, b.seq, b.kind, b.v)
+				}
+			}
+		}
+		t.unref()
+		moveToLost(filename)
+		newTable, err := db.writeTable(salvage.newIterator(), 0, false)
+		if err != nil {
+			return err
+		}
+		if newTable != nil {
+			db.tables = append(db.tables, newTable)
+		}
+	}
+
+	for _, num := range logNums {
+		filename := fileName(dir, num, "log")
+		mem := newMemtable(0)
+		if err := replayLog(filename, mem, &db.lastSeq); err != nil {
+			return err
+		}
+		if !mem.empty() {
+			t, err := db.writeTable(mem.newIterator(), 0, false)
+			if err != nil {
+				return err
+			}
+			if t != nil {
+				db.tables = append(db.tables, t)
+			}
+		}
+		os.Remove(filename)
+	}
+	defer db.unrefTables()
+
+	// Order doesn't affect reads since entries carry sequence numbers, but keep tables
+	// newest first by the most recent write they hold for efficient gets.
+	maxSeqs := make(map[*table]uint64, len(db.tables))
+	for _, t := range db.tables {
+		for _, h := range t.handles {
+			if h.lastSeq > maxSeqs[t] {
+				maxSeqs[t] = h.lastSeq
+			}
+		}
+	}
+	sort.SliceStable(db.tables, func(i, j int) bool {
+		return maxSeqs[db.tables[i]] > maxSeqs[db.tables[j]]
+	})
+	m := &manifest{
+		NextFileNum: db.nextFileNum,
+		LogNum:      db.nextFileNum,
+		LastSeq:     db.lastSeq,
+		Tables:      make([]uint64, len(db.tables)),
+	}
+	for i, t := range db.tables {
+		m.Tables[i] = t.num
+	}
+	dvid.Infof("Repaired lsm database %q with %d tables and last sequence %d\n", dir, len(m.Tables), m.LastSeq)
+	return writeManifest(dir, m)
+}
@@ -0,0 +1,1116 @@
+//go:build golsm
+// +build golsm
+
+/*
+Package golsm implements a pure-Go, embedded ordered key-value store using a
+log-structured merge tree.  Unlike basholeveldb, it requires no cgo.  All reads,
+including long range scans like ProcessRange, use point-in-time snapshots so they
+see a stable view of the data while writes continue.
+*/
+package golsm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+
+	"github.com/blang/semver"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/twinj/uuid"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+func init() {
+	ver, err := semver.Make("0.1.0")
+	if err != nil {
+		dvid.Errorf("Unable to make semver in golsm: %v\n", err)
+	}
+	e := Engine{"golsm", "Pure-Go log-structured merge tree", ver}
+	storage.RegisterEngine(e)
+}
+
+// --- Engine Implementation ------
+
+type Engine struct {
+	name   string
+	desc   string
+	semver semver.Version
+}
+
+func (e Engine) GetName() string {
+	return e.name
+}
+
+func (e Engine) GetDescription() string {
+	return e.desc
+}
+
+func (e Engine) IsDistributed() bool {
+	return false
+}
+
+func (e Engine) GetSemVer() semver.Version {
+	return e.semver
+}
+
+func (e Engine) String() string {
+	return fmt.Sprintf("%s [%s]", e.name, e.semver)
+}
+
+// NewStore returns a golsm store. The passed Config must contain "path" string.
+func (e Engine) NewStore(config dvid.StoreConfig) (dvid.Store, bool, error) {
+	return e.newLSM(config)
+}
+
+func parseConfig(config dvid.StoreConfig) (path string, testing bool, err error) {
+	c := config.GetAll()
+
+	v, found := c["path"]
+	if !found {
+		err = fmt.Errorf("%q must be specified for golsm configuration", "path")
+		return
+	}
+	var ok bool
+	path, ok = v.(string)
+	if !ok {
+		err = fmt.Errorf("%q setting must be a string (%v)", "path", v)
+		return
+	}
+	v, found = c["testing"]
+	if found {
+		testing, ok = v.(bool)
+		if !ok {
+			err = fmt.Errorf("%q setting must be a bool (%v)", "testing", v)
+			return
+		}
+	}
+	if testing {
+		path = filepath.Join(os.TempDir(), path)
+	}
+	return
+}
+
+// getOptions returns LSM options from the store configuration.  Sizes in the
+// configuration are in MB for WriteBufferSize and bytes for BlockSize.
+func getOptions(config dvid.Config) (Options, error) {
+	var opts Options
+	writeBufferSize, found, err := config.GetInt("WriteBufferSize")
+	if err != nil {
+		return opts, err
+	}
+	if found {
+		opts.WriteBufferSize = writeBufferSize * dvid.Mega
+	}
+	if opts.BlockSize, _, err = config.GetInt("BlockSize"); err != nil {
+		return opts, err
+	}
+	if opts.BloomBitsPerKey, _, err = config.GetInt("BloomFilterBitsPerKey"); err != nil {
+		return opts, err
+	}
+	if opts.CompactionTrigger, _, err = config.GetInt("CompactionTrigger"); err != nil {
+		return opts, err
+	}
+	if opts.MaxTables, _, err = config.GetInt("MaxTables"); err != nil {
+		return opts, err
+	}
+	if opts.Sync, _, err = config.GetBool("Sync"); err != nil {
+		return opts, err
+	}
+	opts.setDefaults()
+	return opts, nil
+}
+
+// newLSM returns a golsm backend, creating the database at the path if it
+// doesn't already exist.
+func (e Engine) newLSM(config dvid.StoreConfig) (*LSM, bool, error) {
+	path, _, err := parseConfig(config)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var created bool
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		dvid.TimeInfof("Database not already at path (%s). Creating directory...\n", path)
+		created = true
+		if err := os.MkdirAll(path, 0744); err != nil {
+			return nil, true, fmt.Errorf("Can't make directory at %s: %v", path, err)
+		}
+	} else {
+		dvid.TimeInfof("Found directory at %s (err = %v)\n", path, err)
+	}
+
+	opts, err := getOptions(config.Config)
+	if err != nil {
+		return nil, false, err
+	}
+	dvid.TimeInfof("golsm write buffer size: %s\n", humanize.Bytes(uint64(opts.WriteBufferSize)))
+
+	dvid.TimeInfof("Opening golsm @ path %s\n", path)
+	ldb, err := Open(path, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	db := &LSM{
+		directory: path,
+		config:    config,
+		ldb:       ldb,
+	}
+	db.counters = storage.NewStoreCounters(db.String())
+
+	if created {
+		return db, created, nil
+	}
+
+	// otherwise, check if there's been any metadata or we need to initialize it.
+	metadataExists, err := db.metadataExists()
+	if err != nil {
+		db.Close()
+		return nil, false, err
+	}
+	return db, !metadataExists, nil
+}
+
+// ---- RepairableEngine interface implementation ------
+
+// Repair tries to repair a damaged golsm database.  Implements the RepairableEngine
+// interface.
+func (e Engine) Repair(path string) error {
+	opts, err := getOptions(dvid.Config{})
+	if err != nil {
+		return err
+	}
+	return Repair(path, opts)
+}
+
+// ---- TestableEngine interface implementation -------
+
+// AddTestConfig add this engine to be used for testing.
+func (e Engine) AddTestConfig(backend *storage.Backend) (storage.Alias, error) {
+	alias := storage.Alias("golsm")
+	if backend.DefaultKVDB == "" {
+		backend.DefaultKVDB = alias
+	}
+	if backend.Metadata == "" {
+		backend.Metadata = alias
+	}
+	if backend.Stores == nil {
+		backend.Stores = make(map[storage.Alias]dvid.StoreConfig)
+	}
+	tc := map[string]interface{}{
+		"path":    fmt.Sprintf("dvid-test-golsm-%x", uuid.NewV4().Bytes()),
+		"testing": true,
+	}
+	var c dvid.Config
+	c.SetAll(tc)
+	backend.Stores[alias] = dvid.StoreConfig{Config: c, Engine: "golsm"}
+	return alias, nil
+}
+
+// Delete implements the TestableEngine interface by providing a way to dispose
+// of testing databases.
+func (e Engine) Delete(config dvid.StoreConfig) error {
+	path, _, err := parseConfig(config)
+	if err != nil {
+		return err
+	}
+
+	// Delete the directory if it exists
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("Can't delete old datastore %q: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// LSM is a store backed by a pure-Go log-structured merge tree.
+type LSM struct {
+	// Directory of datastore
+	directory string
+
+	// Config at time of Open()
+	config dvid.StoreConfig
+
+	ldb *DB
+
+	counters *storage.StoreCounters
+}
+
+func (db *LSM) String() string {
+	return fmt.Sprintf("golsm @ %s", db.directory)
+}
+
+// --- dvid.Store interface ---
+
+// Close closes the database.
+func (db *LSM) Close() {
+	if db != nil && db.ldb != nil {
+		if err := db.ldb.Close(); err != nil {
+			dvid.Errorf("closing %s: %v\n", db, err)
+		}
+		db.ldb = nil
+	}
+}
+
+// Equal returns true if the store matches the given store configuration.
+func (db *LSM) Equal(config dvid.StoreConfig) bool {
+	path, _, err := parseConfig(config)
+	if err != nil {
+		return false
+	}
+	return db.directory == path
+}
+
+// GetStoreConfig returns the configuration for this store.
+func (db *LSM) GetStoreConfig() dvid.StoreConfig {
+	return db.config
+}
+
+// NewSnapshot returns a consistent, read-only view of the store that is unaffected by
+// later writes.  The snapshot must be released after use.
+func (db *LSM) NewSnapshot() (*Snapshot, error) {
+	if db == nil || db.ldb == nil {
+		return nil, fmt.Errorf("Can't call NewSnapshot on nil or closed golsm")
+	}
+	return db.ldb.NewSnapshot()
+}
+
+func (db *LSM) metadataExists() (bool, error) {
+	var ctx storage.MetadataContext
+	keyBeg, keyEnd := ctx.KeyRange()
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		return false, err
+	}
+	defer snap.Release()
+	it := snap.NewIterator()
+	defer it.Close()
+
+	it.Seek(keyBeg)
+	if it.Valid() && bytes.Compare(it.Key(), keyEnd) <= 0 {
+		return true, nil
+	}
+	if err := it.GetError(); err != nil {
+		return false, err
+	}
+	dvid.TimeInfof("No metadata found for %s...\n", db)
+	return false, nil
+}
+
+// ---- KeyValueGetter interface ------
+
+// Get returns a value given a key.
+func (db *LSM) Get(ctx storage.Context, tk storage.TKey) ([]byte, error) {
+	if db == nil || db.ldb == nil {
+		return nil, fmt.Errorf("Can't call GET on nil or closed golsm")
+	}
+	db.counters.CountGet()
+	if ctx == nil {
+		return nil, fmt.Errorf("Received nil context in Get()")
+	}
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	if ctx.Versioned() {
+		vctx, ok := ctx.(storage.VersionedCtx)
+		if !ok {
+			return nil, fmt.Errorf("Bad Get(): context is versioned but doesn't fulfill interface: %v", ctx)
+		}
+
+		// Get all versions of this key and return the most recent
+		values, err := getSingleKeyVersions(snap, vctx, tk)
+		if err != nil {
+			return nil, err
+		}
+		kv, err := vctx.VersionedKeyValue(values)
+		if kv != nil {
+			return kv.V, err
+		}
+		return nil, err
+	}
+	key := ctx.ConstructKey(tk)
+	v, _, err := snap.Get(key)
+	storage.StoreValueBytesRead <- len(v)
+	return v, err
+}
+
+// Exists returns true if the key exists.
+func (db *LSM) Exists(ctx storage.Context, tk storage.TKey) (bool, error) {
+	if db == nil || db.ldb == nil {
+		return false, fmt.Errorf("Can't call Exists() on nil or closed golsm")
+	}
+	if ctx == nil {
+		return false, fmt.Errorf("Received nil context in Exists()")
+	}
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		return false, err
+	}
+	defer snap.Release()
+
+	if ctx.Versioned() {
+		vctx, ok := ctx.(storage.VersionedCtx)
+		if !ok {
+			return false, fmt.Errorf("Bad Exists(): context is versioned but doesn't fulfill interface: %v", ctx)
+		}
+		values, err := getSingleKeyVersions(snap, vctx, tk)
+		if err != nil {
+			return false, err
+		}
+		kv, err := vctx.VersionedKeyValue(values)
+		if err != nil {
+			return false, err
+		}
+		return kv != nil, nil
+	}
+	_, found, err := snap.Get(ctx.ConstructKey(tk))
+	return found, err
+}
+
+// getSingleKeyVersions returns all versions of a key.  These key-value pairs will be sorted
+// in ascending key order and could include a tombstone key.
+func getSingleKeyVersions(snap *Snapshot, vctx storage.VersionedCtx, tk []byte) ([]*storage.KeyValue, error) {
+	begKey, err := vctx.MinVersionKey(tk)
+	if err != nil {
+		return nil, err
+	}
+	endKey, err := vctx.MaxVersionKey(tk)
+	if err != nil {
+		return nil, err
+	}
+	it := snap.NewIterator()
+	defer it.Close()
+
+	values := []*storage.KeyValue{}
+	for it.Seek(begKey); it.Valid(); it.Next() {
+		itKey := it.Key()
+		storage.StoreKeyBytesRead <- len(itKey)
+		if bytes.Compare(itKey, endKey) > 0 {
+			break
+		}
+		itValue := it.Value()
+		storage.StoreValueBytesRead <- len(itValue)
+		values = append(values, &storage.KeyValue{
+			K: append([]byte{}, itKey...),
+			V: append([]byte{}, itValue...),
+		})
+	}
+	if err := it.GetError(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+type errorableKV struct {
+	*storage.KeyValue
+	error
+}
+
+func sendKV(vctx storage.VersionedCtx, values []*storage.KeyValue, ch chan errorableKV) {
+	if len(values) != 0 {
+		kv, err := vctx.VersionedKeyValue(values)
+		if err != nil {
+			ch <- errorableKV{nil, err}
+			return
+		}
+		if kv != nil {
+			ch <- errorableKV{kv, nil}
+		}
+	}
+}
+
+// versionedRange sends a range of key-value pairs for a particular version down a channel.
+// The snapshot is released when the range is complete.
+func versionedRange(snap *Snapshot, vctx storage.VersionedCtx, begTKey, endTKey storage.TKey, ch chan errorableKV, done <-chan struct{}, keysOnly bool) {
+	defer snap.Release()
+	it := snap.NewIterator()
+	defer it.Close()
+
+	minKey, err := vctx.MinVersionKey(begTKey)
+	if err != nil {
+		ch <- errorableKV{nil, err}
+		return
+	}
+	maxKey, err := vctx.MaxVersionKey(endTKey)
+	if err != nil {
+		ch <- errorableKV{nil, err}
+		return
+	}
+
+	values := []*storage.KeyValue{}
+	maxVersionKey, err := vctx.MaxVersionKey(begTKey)
+	if err != nil {
+		ch <- errorableKV{nil, err}
+		return
+	}
+
+	var itValue []byte
+	for it.Seek(minKey); it.Valid(); it.Next() {
+		select {
+		case <-done: // only happens if we don't care about rest of data.
+			ch <- errorableKV{nil, nil}
+			return
+		default:
+		}
+		if !keysOnly {
+			itValue = append([]byte{}, it.Value()...)
+			storage.StoreValueBytesRead <- len(itValue)
+		}
+		itKey := append([]byte{}, it.Key()...)
+		storage.StoreKeyBytesRead <- len(itKey)
+
+		// Did we pass all versions for last key read?
+		if bytes.Compare(itKey, maxVersionKey) > 0 {
+			if storage.Key(itKey).IsDataKey() {
+				indexBytes, err := storage.TKeyFromKey(itKey)
+				if err != nil {
+					ch <- errorableKV{nil, err}
+					return
+				}
+				maxVersionKey, err = vctx.MaxVersionKey(indexBytes)
+				if err != nil {
+					ch <- errorableKV{nil, err}
+					return
+				}
+			}
+			sendKV(vctx, values, ch)
+			values = []*storage.KeyValue{}
+		}
+		// Did we pass the final key?
+		if bytes.Compare(itKey, maxKey) > 0 {
+			if len(values) > 0 {
+				sendKV(vctx, values, ch)
+			}
+			ch <- errorableKV{nil, nil}
+			return
+		}
+		values = append(values, &storage.KeyValue{K: itKey, V: itValue})
+	}
+	if err = it.GetError(); err != nil {
+		ch <- errorableKV{nil, err}
+	} else {
+		sendKV(vctx, values, ch)
+		ch <- errorableKV{nil, nil}
+	}
+}
+
+// unversionedRange sends a range of key-value pairs down a channel.  The snapshot is
+// released when the range is complete.
+func unversionedRange(snap *Snapshot, ctx storage.Context, begTKey, endTKey storage.TKey, ch chan errorableKV, done <-chan struct{}, keysOnly bool) {
+	defer snap.Release()
+	it := snap.NewIterator()
+	defer it.Close()
+
+	begKey := ctx.ConstructKey(begTKey)
+	endKey := ctx.ConstructKey(endTKey)
+
+	var itValue []byte
+	for it.Seek(begKey); it.Valid(); it.Next() {
+		if !keysOnly {
+			itValue = append([]byte{}, it.Value()...)
+			storage.StoreValueBytesRead <- len(itValue)
+		}
+		itKey := it.Key()
+		storage.StoreKeyBytesRead <- len(itKey)
+		// Did we pass the final key?
+		if bytes.Compare(itKey, endKey) > 0 {
+			break
+		}
+		select {
+		case <-done:
+			ch <- errorableKV{nil, nil}
+			return
+		case ch <- errorableKV{&storage.KeyValue{K: append([]byte{}, itKey...), V: itValue}, nil}:
+		}
+	}
+	if err := it.GetError(); err != nil {
+		ch <- errorableKV{nil, err}
+	} else {
+		ch <- errorableKV{nil, nil}
+	}
+}
+
+// startRange takes a snapshot and runs the range query on a potentially versioned key
+// in a goroutine.
+func (db *LSM) startRange(ctx storage.Context, kStart, kEnd storage.TKey, done <-chan struct{}, keysOnly bool) (chan errorableKV, error) {
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan errorableKV)
+	go func() {
+		if !ctx.Versioned() {
+			unversionedRange(snap, ctx, kStart, kEnd, ch, done, keysOnly)
+		} else {
+			versionedRange(snap, ctx.(storage.VersionedCtx), kStart, kEnd, ch, done, keysOnly)
+		}
+	}()
+	return ch, nil
+}
+
+// KeysInRange returns a range of present keys spanning (kStart, kEnd).  Values
+// associated with the keys are not read.   If the keys are versioned, only keys
+// in the ancestor path of the current context's version will be returned.
+func (db *LSM) KeysInRange(ctx storage.Context, kStart, kEnd storage.TKey) ([]storage.TKey, error) {
+	if db == nil {
+		return nil, fmt.Errorf("Can't call KeysInRange on nil golsm")
+	}
+	db.counters.CountRange()
+	if ctx == nil {
+		return nil, fmt.Errorf("Received nil context in KeysInRange()")
+	}
+	done := make(chan struct{})
+	defer close(done)
+	ch, err := db.startRange(ctx, kStart, kEnd, done, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Consume the keys.
+	values := []storage.TKey{}
+	for {
+		result := <-ch
+		if result.error != nil {
+			return nil, result.error
+		}
+		if result.KeyValue == nil {
+			return values, nil
+		}
+		tk, err := storage.TKeyFromKey(result.KeyValue.K)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, tk)
+	}
+}
+
+// SendKeysInRange sends a range of keys spanning (kStart, kEnd).  Values
+// associated with the keys are not read.   If the keys are versioned, only keys
+// in the ancestor path of the current context's version will be returned.
+// End of range is marked by a nil key.
+func (db *LSM) SendKeysInRange(ctx storage.Context, kStart, kEnd storage.TKey, kch storage.KeyChan) error {
+	if db == nil {
+		return fmt.Errorf("Can't call SendKeysInRange on nil golsm")
+	}
+	db.counters.CountRange()
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in SendKeysInRange()")
+	}
+	done := make(chan struct{})
+	defer close(done)
+	ch, err := db.startRange(ctx, kStart, kEnd, done, true)
+	if err != nil {
+		kch <- nil
+		return err
+	}
+
+	// Consume the keys.
+	for {
+		result := <-ch
+		if result.error != nil {
+			kch <- nil
+			return result.error
+		}
+		if result.KeyValue == nil {
+			kch <- nil
+			return nil
+		}
+		kch <- result.KeyValue.K
+	}
+}
+
+// GetRange returns a range of values spanning (kStart, kEnd) keys.  These key-value
+// pairs will be sorted in ascending key order.  If the keys are versioned, all key-value
+// pairs for the particular version will be returned.
+func (db *LSM) GetRange(ctx storage.Context, kStart, kEnd storage.TKey) ([]*storage.TKeyValue, error) {
+	if db == nil {
+		return nil, fmt.Errorf("Can't call GetRange on nil golsm")
+	}
+	db.counters.CountRange()
+	if ctx == nil {
+		return nil, fmt.Errorf("Received nil context in GetRange()")
+	}
+	done := make(chan struct{})
+	defer close(done)
+	ch, err := db.startRange(ctx, kStart, kEnd, done, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Consume the key-value pairs.
+	values := []*storage.TKeyValue{}
+	for {
+		result := <-ch
+		if result.error != nil {
+			return nil, result.error
+		}
+		if result.KeyValue == nil {
+			return values, nil
+		}
+		tk, err := storage.TKeyFromKey(result.KeyValue.K)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, &storage.TKeyValue{K: tk, V: result.KeyValue.V})
+	}
+}
+
+// ProcessRange sends a range of key-value pairs to chunk handlers.  If the keys are versioned,
+// only key-value pairs for kStart's version will be transmitted.  The range is read from a
+// snapshot taken at the start of the call, so writes made while processing, including
+// writes by f, are not seen.  If f returns an error, the function is immediately terminated
+// and returns an error.
+func (db *LSM) ProcessRange(ctx storage.Context, kStart, kEnd storage.TKey, op *storage.ChunkOp, f storage.ChunkFunc) error {
+	if db == nil {
+		return fmt.Errorf("Can't call ProcessRange on nil golsm")
+	}
+	db.counters.CountRange()
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in ProcessRange()")
+	}
+	done := make(chan struct{})
+	defer close(done)
+	ch, err := db.startRange(ctx, kStart, kEnd, done, false)
+	if err != nil {
+		return err
+	}
+
+	// Consume the key-value pairs.
+	for {
+		result := <-ch
+		if result.error != nil {
+			return result.error
+		}
+		if result.KeyValue == nil {
+			return nil
+		}
+		if op != nil && op.Wg != nil {
+			op.Wg.Add(1)
+		}
+		tk, err := storage.TKeyFromKey(result.KeyValue.K)
+		if err != nil {
+			return err
+		}
+		tkv := storage.TKeyValue{K: tk, V: result.KeyValue.V}
+		chunk := &storage.Chunk{ChunkOp: op, TKeyValue: &tkv}
+		if err := f(chunk); err != nil {
+			return err
+		}
+	}
+}
+
+// RawRangeQuery sends a range of full keys.  This is to be used for low-level data
+// retrieval like DVID-to-DVID communication and should not be used by data type
+// implementations if possible.  A nil is sent down the channel when the
+// range is complete.
+func (db *LSM) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out chan *storage.KeyValue, cancel <-chan struct{}) error {
+	if db == nil {
+		return fmt.Errorf("Can't call RawRangeQuery on nil golsm")
+	}
+	db.counters.CountRange()
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+	return rawRangeQuery(snap, kStart, kEnd, keysOnly, out, cancel)
+}
+
+func rawRangeQuery(snap *Snapshot, kStart, kEnd storage.Key, keysOnly bool, out chan *storage.KeyValue, cancel <-chan struct{}) error {
+	it := snap.NewIterator()
+	defer it.Close()
+
+	var itValue []byte
+	for it.Seek(kStart); it.Valid(); it.Next() {
+		if !keysOnly {
+			itValue = append([]byte{}, it.Value()...)
+			storage.StoreValueBytesRead <- len(itValue)
+		}
+		itKey := it.Key()
+		storage.StoreKeyBytesRead <- len(itKey)
+		// Did we pass the final key?
+		if bytes.Compare(itKey, kEnd) > 0 {
+			break
+		}
+		kv := storage.KeyValue{K: append([]byte{}, itKey...), V: itValue}
+		select {
+		case out <- &kv:
+		case <-cancel:
+			return nil
+		}
+	}
+	out <- nil
+	return it.GetError()
+}
+
+// rawSnapshot is a point-in-time view of the store used for raw range queries.
+type rawSnapshot struct {
+	snap *Snapshot
+}
+
+func (s rawSnapshot) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out chan *storage.KeyValue, cancel <-chan struct{}) error {
+	return rawRangeQuery(s.snap, kStart, kEnd, keysOnly, out, cancel)
+}
+
+func (s rawSnapshot) Release() {
+	s.snap.Release()
+}
+
+// NewRawSnapshot returns a view of the store for raw range queries that is unaffected by
+// later writes.  It must be released when no longer needed.
+func (db *LSM) NewRawSnapshot() (storage.RawSnapshot, error) {
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return rawSnapshot{snap}, nil
+}
+
+// ---- KeyValueSetter interface ------
+
+// Put writes a value with given key.
+func (db *LSM) Put(ctx storage.Context, tk storage.TKey, v []byte) error {
+	if db == nil {
+		return fmt.Errorf("Can't call Put on nil golsm")
+	}
+	db.counters.CountPut()
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in Put()")
+	}
+	key := ctx.ConstructKey(tk)
+	var batch Batch
+	if ctx.Versioned() {
+		vctx, ok := ctx.(storage.VersionedCtx)
+		if !ok {
+			return fmt.Errorf("Non-versioned context that says it's versioned received in Put(): %v", ctx)
+		}
+		batch.Delete(vctx.TombstoneKey(tk))
+	}
+	batch.Put(key, v)
+	if err := db.ldb.Write(&batch); err != nil {
+		dvid.Criticalf("Error on Put: %v\n", err)
+		return fmt.Errorf("Error on Put: %v", err)
+	}
+	storage.StoreKeyBytesWritten <- len(key)
+	storage.StoreValueBytesWritten <- len(v)
+	return nil
+}
+
+// RawPut is a low-level function that puts a key-value pair using full keys.
+// This can be used in conjunction with RawRangeQuery.
+func (db *LSM) RawPut(k storage.Key, v []byte) error {
+	if db == nil {
+		return fmt.Errorf("Can't call RawPut on nil golsm")
+	}
+	db.counters.CountPut()
+	if err := db.ldb.Put(k, v); err != nil {
+		return err
+	}
+	storage.StoreKeyBytesWritten <- len(k)
+	storage.StoreValueBytesWritten <- len(v)
+	return nil
+}
+
+// Delete removes a value with given key.
+func (db *LSM) Delete(ctx storage.Context, tk storage.TKey) error {
+	if db == nil {
+		return fmt.Errorf("Can't call Delete on nil golsm")
+	}
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in Delete()")
+	}
+	var batch Batch
+	batch.Delete(ctx.ConstructKey(tk))
+	if ctx.Versioned() {
+		vctx, ok := ctx.(storage.VersionedCtx)
+		if !ok {
+			return fmt.Errorf("Non-versioned context that says it's versioned received in Delete(): %v", ctx)
+		}
+		batch.Put(vctx.TombstoneKey(tk), dvid.EmptyValue())
+	}
+	if err := db.ldb.Write(&batch); err != nil {
+		dvid.Criticalf("Error on Delete: %v\n", err)
+		return fmt.Errorf("Error on Delete: %v", err)
+	}
+	return nil
+}
+
+// RawDelete is a low-level function.  It deletes a key-value pair using full keys
+// without any context.  This can be used in conjunction with RawRangeQuery.
+func (db *LSM) RawDelete(k storage.Key) error {
+	if db == nil {
+		return fmt.Errorf("Can't call RawDelete on nil golsm")
+	}
+	return db.ldb.Delete(k)
+}
+
+// ---- OrderedKeyValueSetter interface ------
+
+// PutRange puts type key-value pairs that have been sorted in sequential key order.
+func (db *LSM) PutRange(ctx storage.Context, kvs []storage.TKeyValue) error {
+	if db == nil {
+		return fmt.Errorf("Can't call PutRange on nil golsm")
+	}
+	db.counters.CountPut()
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in PutRange()")
+	}
+	batch := db.NewBatch(ctx).(*goBatch)
+	for _, kv := range kvs {
+		batch.Put(kv.K, kv.V)
+	}
+	if err := batch.Commit(); err != nil {
+		dvid.Criticalf("Error on batch commit of PutRange: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteRange removes all key-value pairs with keys in the given range.
+func (db *LSM) DeleteRange(ctx storage.Context, kStart, kEnd storage.TKey) error {
+	if db == nil {
+		return fmt.Errorf("Can't call DeleteRange on nil golsm")
+	}
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in DeleteRange()")
+	}
+
+	// Iterate over keys in range and delete each one using batch.
+	const BATCH_SIZE = 10000
+	batch := db.NewBatch(ctx).(*goBatch)
+
+	done := make(chan struct{})
+	defer close(done)
+	ch, err := db.startRange(ctx, kStart, kEnd, done, true)
+	if err != nil {
+		return err
+	}
+
+	numKV := 0
+	for {
+		result := <-ch
+		if result.error != nil {
+			return result.error
+		}
+		if result.KeyValue == nil {
+			break
+		}
+		// If versioned, batch.Delete writes a tombstone using current version id since
+		// we don't want to delete locked ancestors.
+		tk, err := storage.TKeyFromKey(result.KeyValue.K)
+		if err != nil {
+			return err
+		}
+		batch.Delete(tk)
+
+		if (numKV+1)%BATCH_SIZE == 0 {
+			if err := batch.Commit(); err != nil {
+				dvid.Criticalf("Error on batch commit of DeleteRange at key-value pair %d: %v\n", numKV, err)
+				return fmt.Errorf("Error on batch commit of DeleteRange at key-value pair %d: %v", numKV, err)
+			}
+			batch = db.NewBatch(ctx).(*goBatch)
+		}
+		numKV++
+	}
+	if numKV%BATCH_SIZE != 0 {
+		if err := batch.Commit(); err != nil {
+			dvid.Criticalf("Error on last batch commit of DeleteRange: %v\n", err)
+			return fmt.Errorf("Error on last batch commit of DeleteRange: %v", err)
+		}
+	}
+	dvid.Debugf("Deleted %d key-value pairs via delete range for %s.\n", numKV, ctx)
+	return nil
+}
+
+// DeleteAll deletes all key-value associated with a context (data instance and version).
+func (db *LSM) DeleteAll(ctx storage.Context) error {
+	if db == nil {
+		return fmt.Errorf("Can't call DeleteAll on nil golsm")
+	}
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in DeleteAll()")
+	}
+
+	var err error
+	var minKey, maxKey storage.Key
+	vctx, versioned := ctx.(storage.VersionedCtx)
+	if versioned {
+		// Don't have to worry about tombstones.  Delete all keys from all versions for this instance id.
+		minTKey := storage.MinTKey(storage.TKeyMinClass)
+		maxTKey := storage.MaxTKey(storage.TKeyMaxClass)
+		minKey, err = vctx.MinVersionKey(minTKey)
+		if err != nil {
+			return err
+		}
+		maxKey, err = vctx.MaxVersionKey(maxTKey)
+		if err != nil {
+			return err
+		}
+	} else {
+		minKey, maxKey = ctx.KeyRange()
+	}
+
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+	it := snap.NewIterator()
+	defer it.Close()
+
+	const BATCH_SIZE = 10000
+	var batch Batch
+	numKV := 0
+	for it.Seek(minKey); it.Valid(); it.Next() {
+		itKey := it.Key()
+		storage.StoreKeyBytesRead <- len(itKey)
+		// Did we pass the final key?
+		if bytes.Compare(itKey, maxKey) > 0 {
+			break
+		}
+		batch.Delete(itKey)
+		if (numKV+1)%BATCH_SIZE == 0 {
+			if err := db.ldb.Write(&batch); err != nil {
+				dvid.Criticalf("Error on batch commit of DeleteAll at key-value pair %d: %v\n", numKV, err)
+				return fmt.Errorf("Error on batch commit of DeleteAll at key-value pair %d: %v", numKV, err)
+			}
+			batch.Reset()
+			dvid.Debugf("Deleted %d key-value pairs in ongoing DELETE ALL for %s.\n", numKV+1, ctx)
+		}
+		numKV++
+	}
+	if err := it.GetError(); err != nil {
+		return fmt.Errorf("Error iterating during DeleteAll for %s: %v", ctx, err)
+	}
+	if err := db.ldb.Write(&batch); err != nil {
+		dvid.Criticalf("Error on last batch commit of DeleteAll: %v\n", err)
+		return fmt.Errorf("Error on last batch commit of DeleteAll: %v", err)
+	}
+	dvid.Debugf("Deleted %d key-value pairs via DELETE ALL for %s.\n", numKV, ctx)
+	return nil
+}
+
+// --- Batcher interface ----
+
+type goBatch struct {
+	ctx   storage.Context
+	vctx  storage.VersionedCtx
+	batch Batch
+	ldb   *DB
+}
+
+// NewBatch returns an implementation that allows batch writes
+func (db *LSM) NewBatch(ctx storage.Context) storage.Batch {
+	if db == nil {
+		dvid.Criticalf("Can't call NewBatch on nil golsm\n")
+		return nil
+	}
+	if ctx == nil {
+		dvid.Criticalf("Received nil context in NewBatch()")
+		return nil
+	}
+	vctx, ok := ctx.(storage.VersionedCtx)
+	if !ok {
+		vctx = nil
+	}
+	return &goBatch{ctx: ctx, vctx: vctx, ldb: db.ldb}
+}
+
+// --- Batch interface ---
+
+func (batch *goBatch) Delete(tk storage.TKey) {
+	if batch == nil || batch.ctx == nil {
+		dvid.Criticalf("Received nil batch or nil batch context in batch.Delete()\n")
+		return
+	}
+	key := batch.ctx.ConstructKey(tk)
+	if batch.vctx != nil {
+		tombstone := batch.vctx.TombstoneKey(tk) // This will now have current version
+		batch.batch.Put(tombstone, dvid.EmptyValue())
+	}
+	batch.batch.Delete(key)
+}
+
+func (batch *goBatch) Put(tk storage.TKey, v []byte) {
+	if batch == nil || batch.ctx == nil {
+		dvid.Criticalf("Received nil batch or nil batch context in batch.Put()\n")
+		return
+	}
+	key := batch.ctx.ConstructKey(tk)
+	if batch.vctx != nil {
+		tombstone := batch.vctx.TombstoneKey(tk) // This will now have current version
+		batch.batch.Delete(tombstone)
+	}
+	storage.StoreKeyBytesWritten <- len(key)
+	storage.StoreValueBytesWritten <- len(v)
+	batch.batch.Put(key, v)
+}
+
+func (batch *goBatch) Commit() error {
+	if batch == nil {
+		return fmt.Errorf("Received nil batch in batch.Commit()")
+	}
+	err := batch.ldb.Write(&batch.batch)
+	batch.batch.Reset()
+	return err
+}
+
+// ---- SizeViewer interface ------
+
+func (db *LSM) GetApproximateSizes(ranges []storage.KeyRange) ([]uint64, error) {
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+	lr := make([][2][]byte, len(ranges))
+	for i, kr := range ranges {
+		lr[i] = [2][]byte{kr.Start, kr.OpenEnd}
+	}
+	return snap.ApproximateSizes(lr), nil
+}
+
+// ---- BlobStore interface ----
+
+// PutBlob writes unversioned data and returns a filename-friendly base64 encoding of the reference.
+func (db *LSM) PutBlob(v []byte) (ref string, err error) {
+	if db == nil || db.ldb == nil {
+		return "", fmt.Errorf("Can't call PutBlob on nil or closed golsm")
+	}
+	h := fnv.New128()
+	if _, err = h.Write(v); err != nil {
+		return
+	}
+	contentHash := h.Sum(nil)
+	key := storage.ConstructBlobKey(contentHash)
+	err = db.ldb.Put(key, v)
+
+	storage.StoreKeyBytesWritten <- len(key)
+	storage.StoreValueBytesWritten <- len(v)
+
+	b64key := base64.URLEncoding.EncodeToString(contentHash)
+	return b64key, err
+}
+
+// GetBlob returns unversioned data given a reference.
+func (db *LSM) GetBlob(ref string) (v []byte, err error) {
+	if db == nil || db.ldb == nil {
+		return nil, fmt.Errorf("Can't call GetBlob on nil or closed golsm")
+	}
+	var contentHash []byte
+	if contentHash, err = base64.URLEncoding.DecodeString(ref); err != nil {
+		return
+	}
+	key := storage.ConstructBlobKey(contentHash)
+	v, _, err = db.ldb.Get(key)
+	storage.StoreValueBytesRead <- len(v)
+	return
+}
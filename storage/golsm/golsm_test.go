@@ -0,0 +1,324 @@
+//go:build golsm
+// +build golsm
+
+package golsm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// small buffers and blocks to exercise flushes and compactions.
+var testOptions = Options{
+	WriteBufferSize:   16 * dvid.Kilo,
+	BlockSize:         512,
+	CompactionTrigger: 3,
+	MaxTables:         8,
+}
+
+func testKey(i int) []byte {
+	return []byte(fmt.Sprintf("key-%06d", i))
+}
+
+func testValue(i, version int) []byte {
+	return []byte(fmt.Sprintf("value %d for key %d with padding to make it larger", version, i))
+}
+
+func checkValues(t *testing.T, db *DB, n int, deleted func(int) bool, version int) {
+	for i := 0; i < n; i++ {
+		v, found, err := db.Get(testKey(i))
+		if err != nil {
+			t.Fatalf("error getting key %d: %v\n", i, err)
+		}
+		if deleted(i) {
+			if found {
+				t.Fatalf("expected key %d to be deleted, got %q\n", i, v)
+			}
+			continue
+		}
+		if !found || !bytes.Equal(v, testValue(i, version)) {
+			t.Fatalf("bad value for key %d: found %t, %q\n", i, found, v)
+		}
+	}
+}
+
+func TestLSMInterfaces(t *testing.T) {
+	eng := storage.GetEngine("golsm")
+	if eng == nil {
+		t.Fatalf("Init does not register 'golsm' engine.\n")
+	}
+	if _, ok := eng.(storage.RepairableEngine); !ok {
+		t.Errorf("golsm engine should implement storage.RepairableEngine\n")
+	}
+	if _, ok := eng.(storage.TestableEngine); !ok {
+		t.Errorf("golsm engine should implement storage.TestableEngine\n")
+	}
+	var store dvid.Store = new(LSM)
+	if _, ok := store.(storage.OrderedKeyValueDB); !ok {
+		t.Errorf("LSM should implement storage.OrderedKeyValueDB\n")
+	}
+	if _, ok := store.(storage.KeyValueBatcher); !ok {
+		t.Errorf("LSM should implement storage.KeyValueBatcher\n")
+	}
+	if _, ok := store.(storage.SizeViewer); !ok {
+		t.Errorf("LSM should implement storage.SizeViewer\n")
+	}
+}
+
+func TestPutGetDeleteReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 3000
+	for version := 0; version < 2; version++ {
+		for i := 0; i < n; i++ {
+			if err := db.Put(testKey(i), testValue(i, version)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	deleted := func(i int) bool { return i%7 == 0 }
+	var b Batch
+	for i := 0; i < n; i += 7 {
+		b.Delete(testKey(i))
+	}
+	if err := db.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, db, n, deleted, 1)
+
+	db.mu.Lock()
+	numTables := len(db.tables)
+	db.mu.Unlock()
+	if numTables == 0 || numTables > testOptions.MaxTables {
+		t.Errorf("expected between 1 and %d tables, got %d\n", testOptions.MaxTables, numTables)
+	}
+
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := snap.NewIterator()
+	var count int
+	var lastKey []byte
+	for it.Seek(testKey(100)); it.Valid(); it.Next() {
+		if lastKey != nil && bytes.Compare(lastKey, it.Key()) >= 0 {
+			t.Fatalf("keys out of order: %q then %q\n", lastKey, it.Key())
+		}
+		lastKey = append(lastKey[:0], it.Key()...)
+		count++
+	}
+	if err := it.GetError(); err != nil {
+		t.Fatal(err)
+	}
+	it.Close()
+	snap.Release()
+	var expected int
+	for i := 100; i < n; i++ {
+		if !deleted(i) {
+			expected++
+		}
+	}
+	if count != expected {
+		t.Errorf("expected %d keys from iteration, got %d\n", expected, count)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = Open(dir, testOptions); err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, db, n, deleted, 1)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Closes the database while background flushes and compactions are likely running.
+func TestOpenPutCloseStress(t *testing.T) {
+	dir := t.TempDir()
+	const n = 500
+	for round := 0; round < 20; round++ {
+		db, err := Open(dir, testOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			if err := db.Put(testKey(i), testValue(i, round)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := Open(dir, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, db, n, func(int) bool { return false }, 19)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogRecovery(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	const n = 100
+	for i := 0; i < n; i++ {
+		if err := db.Put(testKey(i), testValue(i, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// copy the files of the open database to simulate a crash, adding a torn record
+	// to the end of the log.
+	crashDir := t.TempDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Ext(entry.Name()) == ".log" && len(data) > 0 {
+			data = append(data, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+		}
+		if err := os.WriteFile(filepath.Join(crashDir, entry.Name()), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	crashDB, err := Open(crashDir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, crashDB, n, func(int) bool { return false }, 0)
+	if err := crashDB.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshotDuringWrites(t *testing.T) {
+	db, err := Open(t.TempDir(), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	const n = 2000
+	for i := 0; i < n; i++ {
+		if err := db.Put(testKey(i), testValue(i, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+
+	// overwrite and delete keys, forcing flushes and compactions, while scanning.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for version := 1; version < 4; version++ {
+			for i := 0; i < n; i++ {
+				var err error
+				if i%3 == 0 {
+					err = db.Delete(testKey(i))
+				} else {
+					err = db.Put(testKey(i), testValue(i, version))
+				}
+				if err != nil {
+					t.Errorf("write error: %v\n", err)
+					return
+				}
+			}
+		}
+	}()
+	for pass := 0; pass < 3; pass++ {
+		it := snap.NewIterator()
+		var i int
+		for it.Seek(nil); it.Valid(); it.Next() {
+			if !bytes.Equal(it.Key(), testKey(i)) || !bytes.Equal(it.Value(), testValue(i, 0)) {
+				t.Fatalf("snapshot pass %d saw %q = %q, expected key %d at version 0\n", pass, it.Key(), it.Value(), i)
+			}
+			i++
+		}
+		if err := it.GetError(); err != nil {
+			t.Fatal(err)
+		}
+		it.Close()
+		if i != n {
+			t.Fatalf("snapshot pass %d saw %d keys, expected %d\n", pass, i, n)
+		}
+	}
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		v, found, err := snap.Get(testKey(i))
+		if err != nil || !found || !bytes.Equal(v, testValue(i, 0)) {
+			t.Fatalf("bad snapshot get of key %d after writes: %q, %t, %v\n", i, v, found, err)
+		}
+	}
+	checkValues(t, db, n, func(i int) bool { return i%3 == 0 }, 3)
+}
+
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 1000
+	for i := 0; i < n; i++ {
+		if err := db.Put(testKey(i), testValue(i, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(manifestName(dir)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir, testOptions); err == nil {
+		t.Fatalf("expected error opening database without manifest\n")
+	}
+
+	eng := storage.GetEngine("golsm").(storage.RepairableEngine)
+	if err := eng.Repair(dir); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = Open(dir, testOptions); err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, db, n, func(int) bool { return false }, 0)
+
+	// new writes must be newer than repaired data.
+	if err := db.Put(testKey(0), testValue(0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, _ := db.Get(testKey(0)); !bytes.Equal(v, testValue(0, 1)) {
+		t.Errorf("expected new write after repair, got %q\n", v)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
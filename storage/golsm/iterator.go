@@ -0,0 +1,155 @@
+//go:build golsm
+// +build golsm
+
+package golsm
+
+import (
+	"bytes"
+	"container/heap"
+)
+
+// internalIterator iterates over entries, including all versions and deletion
+// tombstones, in internal key order.
+type internalIterator interface {
+	seekGE(key []byte) // positions at first entry with user key >= key
+	valid() bool
+	next()
+	key() []byte
+	seq() uint64
+	kind() kind
+	value() []byte
+	err() error
+	close() error
+}
+
+// mergingIterator merges internal iterators into a single ordered stream.
+type mergingIterator struct {
+	iters []internalIterator
+	h     iterHeap
+}
+
+func newMergingIterator(iters []internalIterator) *mergingIterator {
+	return &mergingIterator{iters: iters}
+}
+
+type iterHeap []internalIterator
+
+func (h iterHeap) Len() int { return len(h) }
+func (h iterHeap) Less(i, j int) bool {
+	return compareInternal(h[i].key(), h[i].seq(), h[j].key(), h[j].seq()) < 0
+}
+func (h iterHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *iterHeap) Push(x interface{}) { *h = append(*h, x.(internalIterator)) }
+func (h *iterHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+func (m *mergingIterator) seekGE(key []byte) {
+	m.h = m.h[:0]
+	for _, it := range m.iters {
+		it.seekGE(key)
+		if it.valid() {
+			m.h = append(m.h, it)
+		}
+	}
+	heap.Init(&m.h)
+}
+
+func (m *mergingIterator) valid() bool { return len(m.h) > 0 }
+
+func (m *mergingIterator) next() {
+	it := m.h[0]
+	it.next()
+	if it.valid() {
+		heap.Fix(&m.h, 0)
+	} else {
+		heap.Pop(&m.h)
+	}
+}
+
+func (m *mergingIterator) key() []byte   { return m.h[0].key() }
+func (m *mergingIterator) seq() uint64   { return m.h[0].seq() }
+func (m *mergingIterator) kind() kind    { return m.h[0].kind() }
+func (m *mergingIterator) value() []byte { return m.h[0].value() }
+
+func (m *mergingIterator) err() error {
+	for _, it := range m.iters {
+		if err := it.err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mergingIterator) close() error {
+	var err error
+	for _, it := range m.iters {
+		if e := it.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Iterator iterates over the live key-value pairs of a snapshot in ascending key order.
+// Keys and values returned are valid until the iterator is closed but must not be modified.
+type Iterator struct {
+	snap  *Snapshot
+	m     *mergingIterator
+	key   []byte
+	value []byte
+	ok    bool
+}
+
+// Seek positions the iterator at the first key >= the given key.
+func (it *Iterator) Seek(key []byte) {
+	it.m.seekGE(key)
+	it.findNextVisible(nil)
+}
+
+// Valid returns true if the iterator is positioned at a key-value pair.
+func (it *Iterator) Valid() bool { return it.ok }
+
+// Next advances the iterator to the next key.
+func (it *Iterator) Next() {
+	if it.ok {
+		it.findNextVisible(it.key)
+	}
+}
+
+// Key returns the current key.
+func (it *Iterator) Key() []byte { return it.key }
+
+// Value returns the current value.
+func (it *Iterator) Value() []byte { return it.value }
+
+// GetError returns any error encountered during iteration.
+func (it *Iterator) GetError() error { return it.m.err() }
+
+// Close releases the iterator's resources.
+func (it *Iterator) Close() error { return it.m.close() }
+
+// findNextVisible moves to the most recent visible version of the next user key after
+// skip, passing over deleted keys.
+func (it *Iterator) findNextVisible(skip []byte) {
+	for it.m.valid() {
+		k := it.m.key()
+		if it.m.seq() > it.snap.seq || (skip != nil && bytes.Equal(k, skip)) {
+			it.m.next()
+			continue
+		}
+		// first visible version of a new user key
+		if it.m.kind() == kindDelete {
+			skip = k
+			it.m.next()
+			continue
+		}
+		it.key, it.value, it.ok = k, it.m.value(), true
+		return
+	}
+	it.key, it.value, it.ok = nil, nil, false
+}
@@ -0,0 +1,160 @@
+//go:build golsm
+// +build golsm
+
+package golsm
+
+import (
+	"bytes"
+	"math/rand"
+	"sync/atomic"
+	"unsafe"
+)
+
+// kind distinguishes puts from deletion tombstones in the LSM tree.
+type kind uint8
+
+const (
+	kindDelete kind = 0
+	kindPut    kind = 1
+)
+
+// maxSeq is larger than any sequence number assigned to a write.
+const maxSeq = uint64(1)<<56 - 1
+
+// compareInternal orders entries by ascending user key and then descending sequence number
+// so the most recent version of a key comes first.
+func compareInternal(akey []byte, aseq uint64, bkey []byte, bseq uint64) int {
+	if c := bytes.Compare(akey, bkey); c != 0 {
+		return c
+	}
+	switch {
+	case aseq > bseq:
+		return -1
+	case aseq < bseq:
+		return 1
+	}
+	return 0
+}
+
+const maxHeight = 12
+
+type memNode struct {
+	key   []byte
+	seq   uint64
+	kind  kind
+	value []byte
+	next  []unsafe.Pointer // *memNode at each level, accessed atomically
+}
+
+func (n *memNode) getNext(level int) *memNode {
+	return (*memNode)(atomic.LoadPointer(&n.next[level]))
+}
+
+func (n *memNode) setNext(level int, x *memNode) {
+	atomic.StorePointer(&n.next[level], unsafe.Pointer(x))
+}
+
+// memtable is a skiplist of recent writes.  Writes must be serialized by the caller but
+// reads can proceed concurrently with a write.
+type memtable struct {
+	head   *memNode
+	height int32 // accessed atomically
+	size   int64 // approximate bytes, accessed atomically
+	rnd    *rand.Rand
+	logNum uint64 // number of write-ahead log holding this memtable's writes
+}
+
+func newMemtable(logNum uint64) *memtable {
+	return &memtable{
+		head:   &memNode{next: make([]unsafe.Pointer, maxHeight)},
+		height: 1,
+		rnd:    rand.New(rand.NewSource(int64(logNum) + 1)),
+		logNum: logNum,
+	}
+}
+
+func (m *memtable) approximateSize() int64 {
+	return atomic.LoadInt64(&m.size)
+}
+
+func (m *memtable) empty() bool {
+	return m.head.getNext(0) == nil
+}
+
+func (m *memtable) randomHeight() int {
+	h := 1
+	for h < maxHeight && m.rnd.Intn(4) == 0 {
+		h++
+	}
+	return h
+}
+
+// findGE returns the first node at or after the given internal key and, if prev is
+// non-nil, fills it with the predecessor at each level.
+func (m *memtable) findGE(key []byte, seq uint64, prev []*memNode) *memNode {
+	x := m.head
+	level := int(atomic.LoadInt32(&m.height)) - 1
+	for {
+		next := x.getNext(level)
+		if next != nil && compareInternal(next.key, next.seq, key, seq) < 0 {
+			x = next
+			continue
+		}
+		if prev != nil {
+			prev[level] = x
+		}
+		if level == 0 {
+			return next
+		}
+		level--
+	}
+}
+
+// add inserts an entry.  Sequence numbers are unique so there are no duplicates.
+func (m *memtable) add(key []byte, seq uint64, k kind, value []byte) {
+	var prev [maxHeight]*memNode
+	m.findGE(key, seq, prev[:])
+	h := m.randomHeight()
+	curHeight := int(atomic.LoadInt32(&m.height))
+	if h > curHeight {
+		for i := curHeight; i < h; i++ {
+			prev[i] = m.head
+		}
+		atomic.StoreInt32(&m.height, int32(h))
+	}
+	n := &memNode{key: key, seq: seq, kind: k, value: value, next: make([]unsafe.Pointer, h)}
+	for i := 0; i < h; i++ {
+		n.setNext(i, prev[i].getNext(i))
+		prev[i].setNext(i, n)
+	}
+	atomic.AddInt64(&m.size, int64(len(key)+len(value)+16+8*h))
+}
+
+// get returns the most recent entry for the key visible at the given sequence number.
+func (m *memtable) get(key []byte, seq uint64) (value []byte, k kind, found bool) {
+	n := m.findGE(key, seq, nil)
+	if n != nil && bytes.Equal(n.key, key) {
+		return n.value, n.kind, true
+	}
+	return nil, 0, false
+}
+
+func (m *memtable) newIterator() *memIterator {
+	return &memIterator{m: m}
+}
+
+// memIterator iterates over all entries of a memtable in internal key order.
+type memIterator struct {
+	m *memtable
+	n *memNode
+}
+
+func (it *memIterator) seekGE(key []byte) { it.n = it.m.findGE(key, maxSeq, nil) }
+func (it *memIterator) valid() bool       { return it.n != nil }
+func (it *memIterator) next()             { it.n = it.n.getNext(0) }
+func (it *memIterator) key() []byte       { return it.n.key }
+func (it *memIterator) seq() uint64       { return it.n.seq }
+func (it *memIterator) kind() kind        { return it.n.kind }
+func (it *memIterator) value() []byte     { return it.n.value }
+func (it *memIterator) err() error        { return nil }
+func (it *memIterator) close() error      { return nil }
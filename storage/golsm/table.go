@@ -0,0 +1,552 @@
+//go:build golsm
+// +build golsm
+
+package golsm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// Sorted tables are immutable files with the following layout:
+//
+//	data blocks:  entries of uvarint key length, key, uint64 trailer (seq << 8 | kind),
+//	              uvarint value length, value
+//	filter block: bloom filter over user keys
+//	index block:  uvarint smallest key length, smallest key, then for each data block:
+//	              uvarint key length, last key, uint64 last trailer, uvarint offset,
+//	              uvarint size, uint32 crc
+//	footer:       uint64 filter offset, uint64 filter size, uint64 index offset,
+//	              uint64 index size, uint64 number of entries, uint32 index crc,
+//	              uint32 filter crc, uint64 magic
+const (
+	tableMagic  = uint64(0x64766964_6c736d31) // "dvidlsm1"
+	footerSize  = 8*5 + 4*2 + 8
+	trailerSize = 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func makeTrailer(seq uint64, k kind) uint64 { return seq<<8 | uint64(k) }
+
+func splitTrailer(t uint64) (seq uint64, k kind) { return t >> 8, kind(t & 0xff) }
+
+// ---- bloom filter ----
+
+type bloomFilter []byte // bit array followed by number of probes
+
+func bloomHash(key []byte) (uint32, uint32) {
+	h := fnv.New64a()
+	h.Write(key)
+	sum := h.Sum64()
+	return uint32(sum), uint32(sum>>32) | 1
+}
+
+func newBloomFilter(hashes [][2]uint32, bitsPerKey int) bloomFilter {
+	nbits := len(hashes) * bitsPerKey
+	if nbits < 64 {
+		nbits = 64
+	}
+	nbytes := (nbits + 7) / 8
+	nbits = nbytes * 8
+	probes := int(float64(bitsPerKey) * 0.69) // ln(2) * bits per key is optimal
+	if probes < 1 {
+		probes = 1
+	} else if probes > 30 {
+		probes = 30
+	}
+	filter := make([]byte, nbytes+1)
+	for _, h := range hashes {
+		for i := 0; i < probes; i++ {
+			bit := (h[0] + uint32(i)*h[1]) % uint32(nbits)
+			filter[bit/8] |= 1 << (bit % 8)
+		}
+	}
+	filter[nbytes] = byte(probes)
+	return filter
+}
+
+func (f bloomFilter) mayContain(key []byte) bool {
+	if len(f) < 2 {
+		return true
+	}
+	nbits := uint32(len(f)-1) * 8
+	probes := int(f[len(f)-1])
+	h1, h2 := bloomHash(key)
+	for i := 0; i < probes; i++ {
+		bit := (h1 + uint32(i)*h2) % nbits
+		if f[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ---- table writer ----
+
+type blockHandle struct {
+	lastKey []byte
+	lastSeq uint64
+	offset  uint64
+	size    uint64
+	crc     uint32
+}
+
+// tableWriter writes entries, which must be added in internal key order, to a table file.
+type tableWriter struct {
+	f         *os.File
+	w         *bufio.Writer
+	blockSize int
+	bitsKey   int
+
+	offset   uint64
+	block    bytes.Buffer
+	lastKey  []byte
+	lastSeq  uint64
+	smallest []byte
+	handles  []blockHandle
+	hashes   [][2]uint32
+	entries  uint64
+	scratch  [binary.MaxVarintLen64]byte
+	prevUser []byte
+}
+
+func newTableWriter(filename string, blockSize, bloomBitsPerKey int) (*tableWriter, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &tableWriter{
+		f:         f,
+		w:         bufio.NewWriterSize(f, 1<<20),
+		blockSize: blockSize,
+		bitsKey:   bloomBitsPerKey,
+	}, nil
+}
+
+func (tw *tableWriter) putUvarint(buf *bytes.Buffer, x uint64) {
+	n := binary.PutUvarint(tw.scratch[:], x)
+	buf.Write(tw.scratch[:n])
+}
+
+func (tw *tableWriter) add(key []byte, seq uint64, k kind, value []byte) error {
+	if tw.entries == 0 {
+		tw.smallest = append([]byte{}, key...)
+	}
+	if tw.entries == 0 || !bytes.Equal(key, tw.prevUser) {
+		h1, h2 := bloomHash(key)
+		tw.hashes = append(tw.hashes, [2]uint32{h1, h2})
+		tw.prevUser = append(tw.prevUser[:0], key...)
+	}
+	tw.putUvarint(&tw.block, uint64(len(key)))
+	tw.block.Write(key)
+	binary.LittleEndian.PutUint64(tw.scratch[:8], makeTrailer(seq, k))
+	tw.block.Write(tw.scratch[:8])
+	tw.putUvarint(&tw.block, uint64(len(value)))
+	tw.block.Write(value)
+	tw.lastKey = append(tw.lastKey[:0], key...)
+	tw.lastSeq = seq
+	tw.entries++
+	if tw.block.Len() >= tw.blockSize {
+		return tw.finishBlock()
+	}
+	return nil
+}
+
+func (tw *tableWriter) finishBlock() error {
+	if tw.block.Len() == 0 {
+		return nil
+	}
+	data := tw.block.Bytes()
+	h := blockHandle{
+		lastKey: append([]byte{}, tw.lastKey...),
+		lastSeq: tw.lastSeq,
+		offset:  tw.offset,
+		size:    uint64(len(data)),
+		crc:     crc32.Checksum(data, crcTable),
+	}
+	if _, err := tw.w.Write(data); err != nil {
+		return err
+	}
+	tw.offset += h.size
+	tw.handles = append(tw.handles, h)
+	tw.block.Reset()
+	return nil
+}
+
+// finish writes the filter, index, and footer and syncs the file, returning its size.
+func (tw *tableWriter) finish() (uint64, error) {
+	defer tw.f.Close()
+	if err := tw.finishBlock(); err != nil {
+		return 0, err
+	}
+	filter := newBloomFilter(tw.hashes, tw.bitsKey)
+	filterOffset := tw.offset
+	if _, err := tw.w.Write(filter); err != nil {
+		return 0, err
+	}
+	tw.offset += uint64(len(filter))
+
+	var index bytes.Buffer
+	tw.putUvarint(&index, uint64(len(tw.smallest)))
+	index.Write(tw.smallest)
+	for _, h := range tw.handles {
+		tw.putUvarint(&index, uint64(len(h.lastKey)))
+		index.Write(h.lastKey)
+		binary.LittleEndian.PutUint64(tw.scratch[:8], h.lastSeq)
+		index.Write(tw.scratch[:8])
+		tw.putUvarint(&index, h.offset)
+		tw.putUvarint(&index, h.size)
+		binary.LittleEndian.PutUint32(tw.scratch[:4], h.crc)
+		index.Write(tw.scratch[:4])
+	}
+	indexOffset := tw.offset
+	if _, err := tw.w.Write(index.Bytes()); err != nil {
+		return 0, err
+	}
+	tw.offset += uint64(index.Len())
+
+	footer := make([]byte, footerSize)
+	binary.LittleEndian.PutUint64(footer[0:], filterOffset)
+	binary.LittleEndian.PutUint64(footer[8:], uint64(len(filter)))
+	binary.LittleEndian.PutUint64(footer[16:], indexOffset)
+	binary.LittleEndian.PutUint64(footer[24:], uint64(index.Len()))
+	binary.LittleEndian.PutUint64(footer[32:], tw.entries)
+	binary.LittleEndian.PutUint32(footer[40:], crc32.Checksum(index.Bytes(), crcTable))
+	binary.LittleEndian.PutUint32(footer[44:], crc32.Checksum(filter, crcTable))
+	binary.LittleEndian.PutUint64(footer[48:], tableMagic)
+	if _, err := tw.w.Write(footer); err != nil {
+		return 0, err
+	}
+	tw.offset += footerSize
+	if err := tw.w.Flush(); err != nil {
+		return 0, err
+	}
+	if err := tw.f.Sync(); err != nil {
+		return 0, err
+	}
+	return tw.offset, nil
+}
+
+// abandon closes and removes a partially written table.
+func (tw *tableWriter) abandon() {
+	tw.f.Close()
+	os.Remove(tw.f.Name())
+}
+
+// ---- table reader ----
+
+// table is an open, immutable sorted table.  It is reference counted so that its file
+// is removed only after it is obsolete and no snapshot is using it.
+type table struct {
+	num      uint64
+	filename string
+	f        *os.File
+	size     uint64
+	entries  uint64
+	smallest []byte
+	handles  []blockHandle
+	filter   bloomFilter
+
+	refs     int32 // accessed atomically
+	obsolete int32 // set atomically when file should be removed on last unref
+}
+
+func openTable(filename string, num uint64) (*table, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	t, err := readTable(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("bad table file %q: %v", filename, err)
+	}
+	t.num = num
+	t.filename = filename
+	t.refs = 1
+	return t, nil
+}
+
+func readTable(f *os.File) (*table, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(fi.Size())
+	if size < footerSize {
+		return nil, fmt.Errorf("file too small (%d bytes)", size)
+	}
+	footer := make([]byte, footerSize)
+	if _, err := f.ReadAt(footer, int64(size-footerSize)); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint64(footer[48:]) != tableMagic {
+		return nil, fmt.Errorf("bad magic number")
+	}
+	filterOffset := binary.LittleEndian.Uint64(footer[0:])
+	filterSize := binary.LittleEndian.Uint64(footer[8:])
+	indexOffset := binary.LittleEndian.Uint64(footer[16:])
+	indexSize := binary.LittleEndian.Uint64(footer[24:])
+	if filterOffset+filterSize > indexOffset || indexOffset+indexSize > size-footerSize {
+		return nil, fmt.Errorf("bad footer")
+	}
+	t := &table{f: f, size: size, entries: binary.LittleEndian.Uint64(footer[32:])}
+
+	filter := make([]byte, filterSize)
+	if _, err := f.ReadAt(filter, int64(filterOffset)); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(filter, crcTable) != binary.LittleEndian.Uint32(footer[44:]) {
+		return nil, fmt.Errorf("bad checksum for filter")
+	}
+	t.filter = filter
+
+	index := make([]byte, indexSize)
+	if _, err := f.ReadAt(index, int64(indexOffset)); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(index, crcTable) != binary.LittleEndian.Uint32(footer[40:]) {
+		return nil, fmt.Errorf("bad checksum for index")
+	}
+	r := bytes.NewReader(index)
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return b, err
+	}
+	if t.smallest, err = readBytes(); err != nil {
+		return nil, err
+	}
+	for r.Len() > 0 {
+		var h blockHandle
+		if h.lastKey, err = readBytes(); err != nil {
+			return nil, err
+		}
+		var buf [8]byte
+		if _, err = io.ReadFull(r, buf[:]); err != nil {
+			return nil, err
+		}
+		h.lastSeq = binary.LittleEndian.Uint64(buf[:])
+		if h.offset, err = binary.ReadUvarint(r); err != nil {
+			return nil, err
+		}
+		if h.size, err = binary.ReadUvarint(r); err != nil {
+			return nil, err
+		}
+		if _, err = io.ReadFull(r, buf[:4]); err != nil {
+			return nil, err
+		}
+		h.crc = binary.LittleEndian.Uint32(buf[:4])
+		t.handles = append(t.handles, h)
+	}
+	return t, nil
+}
+
+func (t *table) ref() { atomic.AddInt32(&t.refs, 1) }
+
+func (t *table) unref() {
+	if atomic.AddInt32(&t.refs, -1) == 0 {
+		t.f.Close()
+		if atomic.LoadInt32(&t.obsolete) == 1 {
+			os.Remove(t.filename)
+		}
+	}
+}
+
+// largest returns the largest user key in the table.
+func (t *table) largest() []byte {
+	if len(t.handles) == 0 {
+		return nil
+	}
+	return t.handles[len(t.handles)-1].lastKey
+}
+
+// returns the index of the first block that may contain the internal key.
+func (t *table) findBlock(key []byte, seq uint64) int {
+	return sort.Search(len(t.handles), func(i int) bool {
+		h := t.handles[i]
+		return compareInternal(h.lastKey, h.lastSeq, key, seq) >= 0
+	})
+}
+
+func (t *table) readBlock(i int) (*blockIterator, error) {
+	h := t.handles[i]
+	data := make([]byte, h.size)
+	if _, err := t.f.ReadAt(data, int64(h.offset)); err != nil {
+		return nil, fmt.Errorf("unable to read block %d of table %q: %v", i, t.filename, err)
+	}
+	if crc32.Checksum(data, crcTable) != h.crc {
+		return nil, fmt.Errorf("bad checksum for block %d of table %q", i, t.filename)
+	}
+	return &blockIterator{data: data}, nil
+}
+
+// get returns the most recent entry for the key visible at the given sequence number.
+func (t *table) get(key []byte, seq uint64) (value []byte, k kind, found bool, err error) {
+	if !t.filter.mayContain(key) {
+		return
+	}
+	i := t.findBlock(key, seq)
+	if i == len(t.handles) {
+		return
+	}
+	b, err := t.readBlock(i)
+	if err != nil {
+		return
+	}
+	b.seekGE(key, seq)
+	if b.err != nil {
+		err = b.err
+		return
+	}
+	if b.valid() && bytes.Equal(b.k, key) {
+		return b.v, b.kind, true, nil
+	}
+	return
+}
+
+// approximateOffset returns the file offset of the block that would contain the key.
+func (t *table) approximateOffset(key []byte) uint64 {
+	i := t.findBlock(key, maxSeq)
+	if i == len(t.handles) {
+		if len(t.handles) == 0 {
+			return 0
+		}
+		last := t.handles[len(t.handles)-1]
+		return last.offset + last.size
+	}
+	return t.handles[i].offset
+}
+
+// blockIterator decodes the entries of a data block.
+type blockIterator struct {
+	data []byte
+	pos  int // offset of next entry to decode
+	k    []byte
+	seq  uint64
+	kind kind
+	v    []byte
+	ok   bool
+	err  error
+}
+
+func (b *blockIterator) valid() bool { return b.ok }
+
+func (b *blockIterator) next() {
+	if b.pos >= len(b.data) {
+		b.ok = false
+		return
+	}
+	klen, n := binary.Uvarint(b.data[b.pos:])
+	if n <= 0 || b.pos+n+int(klen)+trailerSize > len(b.data) {
+		b.corrupt()
+		return
+	}
+	b.pos += n
+	b.k = b.data[b.pos : b.pos+int(klen)]
+	b.pos += int(klen)
+	b.seq, b.kind = splitTrailer(binary.LittleEndian.Uint64(b.data[b.pos:]))
+	b.pos += trailerSize
+	vlen, n := binary.Uvarint(b.data[b.pos:])
+	if n <= 0 || b.pos+n+int(vlen) > len(b.data) {
+		b.corrupt()
+		return
+	}
+	b.pos += n
+	b.v = b.data[b.pos : b.pos+int(vlen)]
+	b.pos += int(vlen)
+	b.ok = true
+}
+
+func (b *blockIterator) corrupt() {
+	b.ok = false
+	b.err = fmt.Errorf("corrupt block entry at offset %d", b.pos)
+}
+
+func (b *blockIterator) seekGE(key []byte, seq uint64) {
+	b.pos = 0
+	for b.next(); b.ok; b.next() {
+		if compareInternal(b.k, b.seq, key, seq) >= 0 {
+			return
+		}
+	}
+}
+
+// tableIterator iterates over all entries of a table in internal key order.
+type tableIterator struct {
+	t     *table
+	i     int // current block
+	b     *blockIterator
+	error error
+}
+
+func (t *table) newIterator() *tableIterator {
+	return &tableIterator{t: t, i: len(t.handles)}
+}
+
+func (it *tableIterator) loadBlock(i int) bool {
+	it.i = i
+	if i >= len(it.t.handles) {
+		it.b = nil
+		return false
+	}
+	b, err := it.t.readBlock(i)
+	if err != nil {
+		it.error = err
+		it.b = nil
+		return false
+	}
+	it.b = b
+	return true
+}
+
+// skips to the next block if the current one is exhausted.
+func (it *tableIterator) settle() {
+	for it.b != nil && !it.b.valid() {
+		if it.b.err != nil {
+			it.error = it.b.err
+			it.b = nil
+			return
+		}
+		if it.loadBlock(it.i + 1) {
+			it.b.next()
+		}
+	}
+}
+
+func (it *tableIterator) seekGE(key []byte) {
+	if it.loadBlock(it.t.findBlock(key, maxSeq)) {
+		it.b.seekGE(key, maxSeq)
+		it.settle()
+	}
+}
+
+func (it *tableIterator) valid() bool { return it.b != nil && it.b.valid() }
+
+func (it *tableIterator) next() {
+	it.b.next()
+	it.settle()
+}
+
+func (it *tableIterator) key() []byte   { return it.b.k }
+func (it *tableIterator) seq() uint64   { return it.b.seq }
+func (it *tableIterator) kind() kind    { return it.b.kind }
+func (it *tableIterator) value() []byte { return it.b.v }
+func (it *tableIterator) err() error    { return it.error }
+func (it *tableIterator) close() error  { return nil }
@@ -324,6 +324,22 @@ type OrderedKeyValueDB interface {
 	OrderedKeyValueSetter
 }
 
+// RawSnapshot is a consistent, read-only view of a store at a point in time.
+type RawSnapshot interface {
+	// RawRangeQuery sends a range of full keys as they were when the snapshot was taken.
+	// See OrderedKeyValueGetter.RawRangeQuery.
+	RawRangeQuery(kStart, kEnd Key, keysOnly bool, out chan *KeyValue, cancel <-chan struct{}) error
+
+	// Release frees any resources held by the snapshot.
+	Release()
+}
+
+// RawSnapshotter is implemented by stores that can provide point-in-time views unaffected
+// by later writes, e.g., to make a consistent backup while mutations continue.
+type RawSnapshotter interface {
+	NewRawSnapshot() (RawSnapshot, error)
+}
+
 // KeyValueBatcher allow batching operations into an atomic update or transaction.
 // For example: "Atomic Updates" in http://leveldb.googlecode.com/svn/trunk/doc/index.html
 type KeyValueBatcher interface {
@@ -125,6 +125,7 @@ func (e Engine) NewStore(config dvid.StoreConfig) (dvid.Store, bool, error) {
 		owner:      owner,
 		collection: collection,
 	}
+	kv.counters = storage.NewStoreCounters(kv.String())
 	exists, err := kv.metadataExists()
 	if err != nil {
 		return nil, false, err
@@ -157,6 +158,8 @@ type KVAutobus struct {
 
 	// collection id for this store
 	collection dvid.UUID
+
+	counters *storage.StoreCounters
 }
 
 // check if any metadata has been written into this store.
@@ -406,6 +409,7 @@ func (db *KVAutobus) deleteRange(kStart, kEnd storage.Key) error {
 // implementations if possible.  A nil is sent down the channel when the
 // range is complete.
 func (db *KVAutobus) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out chan *storage.KeyValue, cancel <-chan struct{}) error {
+	db.counters.CountRange()
 	var value []byte
 	if keysOnly {
 		keys, err := db.getKeyRange(kStart, kEnd)
@@ -428,6 +432,7 @@ func (db *KVAutobus) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out
 }
 
 func (db *KVAutobus) RawPut(key storage.Key, value []byte) error {
+	db.counters.CountPut()
 	b64key := encodeKey(key)
 	url := fmt.Sprintf("%s/kvautobus/api/value/%s/%s/", db.host, db.collection, b64key)
 	var bin Binary
@@ -471,6 +476,7 @@ func (db *KVAutobus) RawDelete(key storage.Key) error {
 
 // Get returns a value given a key.
 func (db *KVAutobus) Get(ctx storage.Context, tk storage.TKey) ([]byte, error) {
+	db.counters.CountGet()
 	if ctx == nil {
 		return nil, fmt.Errorf("Received nil context in Get()")
 	}
@@ -617,6 +623,7 @@ func (db *KVAutobus) unversionedRange(ctx storage.Context, kStart, kEnd storage.
 // associated with the keys are not read.   If the keys are versioned, only keys
 // in the ancestor path of the current context's version will be returned.
 func (db *KVAutobus) KeysInRange(ctx storage.Context, kStart, kEnd storage.TKey) ([]storage.TKey, error) {
+	db.counters.CountRange()
 	if ctx == nil {
 		return nil, fmt.Errorf("Received nil context in KeysInRange()")
 	}
@@ -654,6 +661,7 @@ func (db *KVAutobus) KeysInRange(ctx storage.Context, kStart, kEnd storage.TKey)
 // in the ancestor path of the current context's version will be returned.
 // End of range is marked by a nil key.
 func (db *KVAutobus) SendKeysInRange(ctx storage.Context, kStart, kEnd storage.TKey, kch storage.KeyChan) error {
+	db.counters.CountRange()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in SendKeysInRange()")
 	}
@@ -687,6 +695,7 @@ func (db *KVAutobus) SendKeysInRange(ctx storage.Context, kStart, kEnd storage.T
 // pairs will be sorted in ascending key order.  If the keys are versioned, all key-value
 // pairs for the particular version will be returned.
 func (db *KVAutobus) GetRange(ctx storage.Context, kStart, kEnd storage.TKey) ([]*storage.TKeyValue, error) {
+	db.counters.CountRange()
 	if ctx == nil {
 		return nil, fmt.Errorf("Received nil context in GetRange()")
 	}
@@ -723,6 +732,7 @@ func (db *KVAutobus) GetRange(ctx storage.Context, kStart, kEnd storage.TKey) ([
 // ProcessRange sends a range of key-value pairs to chunk handlers.  If the keys are versioned,
 // only key-value pairs for kStart's version will be transmitted.
 func (db *KVAutobus) ProcessRange(ctx storage.Context, kStart, kEnd storage.TKey, op *storage.ChunkOp, f storage.ChunkFunc) error {
+	db.counters.CountRange()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in ProcessRange()")
 	}
@@ -791,6 +801,7 @@ func (db *KVAutobus) Delete(ctx storage.Context, tk storage.TKey) error {
 
 // PutRange puts type key-value pairs that have been sorted in sequential key order.
 func (db *KVAutobus) PutRange(ctx storage.Context, tkvs []storage.TKeyValue) error {
+	db.counters.CountPut()
 	if ctx == nil {
 		return fmt.Errorf("Received nil context in PutRange()")
 	}
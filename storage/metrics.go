@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// StoreCounters tracks the number of get, put, and range operations on a store.
+// Storage engines should obtain one via NewStoreCounters when opening a store.
+type StoreCounters struct {
+	gets   uint64
+	puts   uint64
+	ranges uint64
+}
+
+// CountGet increments the number of single key reads.
+func (sc *StoreCounters) CountGet() {
+	if sc != nil {
+		atomic.AddUint64(&sc.gets, 1)
+	}
+}
+
+// CountPut increments the number of write operations.
+func (sc *StoreCounters) CountPut() {
+	if sc != nil {
+		atomic.AddUint64(&sc.puts, 1)
+	}
+}
+
+// CountRange increments the number of range queries.
+func (sc *StoreCounters) CountRange() {
+	if sc != nil {
+		atomic.AddUint64(&sc.ranges, 1)
+	}
+}
+
+var storeCounters = struct {
+	sync.Mutex
+	stores map[string]*StoreCounters
+}{stores: make(map[string]*StoreCounters)}
+
+// NewStoreCounters returns the counters for the store with the given name, which
+// should be the store's String() description.  Reopening a store with the same name
+// continues its counts.
+func NewStoreCounters(name string) *StoreCounters {
+	storeCounters.Lock()
+	defer storeCounters.Unlock()
+	sc, found := storeCounters.stores[name]
+	if !found {
+		sc = new(StoreCounters)
+		storeCounters.stores[name] = sc
+	}
+	return sc
+}
+
+func storeOperationSamples() []dvid.MetricSample {
+	storeCounters.Lock()
+	names := make([]string, 0, len(storeCounters.stores))
+	for name := range storeCounters.stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	samples := make([]dvid.MetricSample, 0, 3*len(names))
+	for _, name := range names {
+		sc := storeCounters.stores[name]
+		samples = append(samples,
+			dvid.MetricSample{LabelValues: []string{name, "get"}, Value: float64(atomic.LoadUint64(&sc.gets))},
+			dvid.MetricSample{LabelValues: []string{name, "put"}, Value: float64(atomic.LoadUint64(&sc.puts))},
+			dvid.MetricSample{LabelValues: []string{name, "range"}, Value: float64(atomic.LoadUint64(&sc.ranges))},
+		)
+	}
+	storeCounters.Unlock()
+	return samples
+}
+
+func groupcacheSamples(f func(GroupcacheStats) []dvid.MetricSample) func() []dvid.MetricSample {
+	return func() []dvid.MetricSample {
+		if !manager.setup || manager.gcache.cache == nil {
+			return nil
+		}
+		stats, err := GetGroupcacheStats()
+		if err != nil {
+			return nil
+		}
+		return f(stats)
+	}
+}
+
+func hitRatio(hits, gets int64) float64 {
+	if gets == 0 {
+		return 0
+	}
+	return float64(hits) / float64(gets)
+}
+
+func init() {
+	dvid.RegisterMetricFunc("dvid_store_operations_total", "Number of operations on each store by type.",
+		dvid.CounterMetric, []string{"store", "op"}, storeOperationSamples)
+
+	dvid.RegisterMetricFunc("dvid_groupcache_gets_total", "Number of groupcache gets by cache.",
+		dvid.CounterMetric, []string{"cache"}, groupcacheSamples(func(s GroupcacheStats) []dvid.MetricSample {
+			return []dvid.MetricSample{
+				{LabelValues: []string{"all"}, Value: float64(s.Gets)},
+				{LabelValues: []string{"main"}, Value: float64(s.MainCache.Gets)},
+				{LabelValues: []string{"hot"}, Value: float64(s.HotCache.Gets)},
+			}
+		}))
+	dvid.RegisterMetricFunc("dvid_groupcache_hits_total", "Number of groupcache hits by cache.",
+		dvid.CounterMetric, []string{"cache"}, groupcacheSamples(func(s GroupcacheStats) []dvid.MetricSample {
+			return []dvid.MetricSample{
+				{LabelValues: []string{"all"}, Value: float64(s.CacheHits)},
+				{LabelValues: []string{"main"}, Value: float64(s.MainCache.Hits)},
+				{LabelValues: []string{"hot"}, Value: float64(s.HotCache.Hits)},
+			}
+		}))
+	dvid.RegisterMetricFunc("dvid_groupcache_hit_ratio", "Fraction of groupcache gets that were hits.",
+		dvid.GaugeMetric, []string{"cache"}, groupcacheSamples(func(s GroupcacheStats) []dvid.MetricSample {
+			return []dvid.MetricSample{
+				{LabelValues: []string{"all"}, Value: hitRatio(s.CacheHits, s.Gets)},
+				{LabelValues: []string{"main"}, Value: hitRatio(s.MainCache.Hits, s.MainCache.Gets)},
+				{LabelValues: []string{"hot"}, Value: hitRatio(s.HotCache.Hits, s.HotCache.Gets)},
+			}
+		}))
+}
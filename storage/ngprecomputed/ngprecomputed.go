@@ -17,6 +17,7 @@ import (
 
 	"github.com/blang/semver"
 	"gocloud.dev/blob"
+	"gocloud.dev/blob/fileblob"
 	"gocloud.dev/blob/gcsblob"
 	_ "gocloud.dev/blob/gcsblob"
 	_ "gocloud.dev/blob/s3blob"
@@ -149,7 +150,15 @@ func (e Engine) newStore(config dvid.StoreConfig) (*ngStore, bool, error) {
 	ctx := context.Background()
 	var bucket *blob.Bucket
 
-	if strings.HasPrefix(ref, "s3://") {
+	if strings.HasPrefix(ref, "file://") {
+		// Local directory, e.g., one written by an ngprecomputed Writer.
+		var err error
+		bucket, err = fileblob.OpenBucket(strings.TrimPrefix(ref, "file://"), nil)
+		if err != nil {
+			dvid.Errorf("Can't open NG precomputed @ %q: %v\n", ref, err)
+			return nil, false, err
+		}
+	} else if strings.HasPrefix(ref, "s3://") {
 		// This relies on the non-GCS-specific blob API
 		// This relies on the non-GCS-specific blob API
 		// and requires that the user:
@@ -219,6 +228,7 @@ func (e Engine) newStore(config dvid.StoreConfig) (*ngStore, bool, error) {
 	if err := ng.initialize(); err != nil {
 		return nil, false, err
 	}
+	ng.counters = storage.NewStoreCounters(ng.String())
 	dvid.Infof("Loaded %q [%s] @ %q ...\n", ng.vol.StoreType, ng.vol.VolumeType, ref)
 	return ng, false, nil
 }
@@ -355,6 +365,8 @@ type ngStore struct {
 	shardIndexMu sync.RWMutex
 
 	config dvid.StoreConfig
+
+	counters *storage.StoreCounters
 }
 
 type shardT struct {
@@ -388,6 +400,11 @@ func (ng *ngStore) initialize() error {
 	if ng.vol.VolumeType != "image" {
 		return fmt.Errorf("NG Store volume type %q, DVID driver can only handle 'image' type", ng.vol.VolumeType)
 	}
+	return ng.initScales()
+}
+
+// initScales precomputes the bits and masks used to locate chunks in each scale.
+func (ng *ngStore) initScales() error {
 	for n, scale := range ng.vol.Scales {
 		if len(scale.ChunkSizes) > 1 {
 			return fmt.Errorf("scale %d has more than one chunk size, which is unsupported: %v", n, scale.ChunkSizes)
@@ -750,6 +767,7 @@ func (ng *ngStore) GridProperties(scaleLevel int) (props storage.GridProps, err
 // partial blocks on edges so that chunks meet contract with other DVID systems that
 // expect a full block.
 func (ng *ngStore) GridGet(scaleLevel int, blockCoord dvid.ChunkPoint3d) (val []byte, err error) {
+	ng.counters.CountGet()
 	timedLog := dvid.NewTimeLog()
 	scale := &(ng.vol.Scales[scaleLevel])
 	chunkSize := scale.ChunkSizes[0]
@@ -858,6 +876,7 @@ func (ng *ngStore) GridGetVolume(scaleLevel int, minBlock, maxBlock dvid.ChunkPo
 	if ordered {
 		return fmt.Errorf("ordered retrieval not implemented at this time")
 	}
+	ng.counters.CountRange()
 	ch := make(chan dvid.ChunkPoint3d)
 
 	// Start concurrent processing routines to read each block and then pass it to given function.
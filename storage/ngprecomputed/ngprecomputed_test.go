@@ -1,8 +1,13 @@
 package ngprecomputed
 
 import (
+	"bytes"
 	"encoding/json"
+	"io/ioutil"
+	"os"
 	"testing"
+
+	"github.com/janelia-flyem/dvid/dvid"
 )
 
 var sampleInfo = `
@@ -218,3 +223,108 @@ func TestConfig(t *testing.T) {
 		t.Fatalf("expected [4.0, 4.0, 4.0] got %v\n", ng.vol.Scales[2].Resolution)
 	}
 }
+
+func TestWriterRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ngprecomputed-writer")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := VolumeConfig{
+		VolumeType: "image",
+		DataType:   "uint8",
+		Scales: []ScaleConfig{
+			{
+				ChunkSize:     dvid.Point3d{32, 32, 32},
+				Size:          dvid.Point3d{100, 70, 40},
+				Resolution:    [3]float64{8, 8, 8},
+				Encoding:      "raw",
+				Sharded:       true,
+				PreshiftBits:  1,
+				MinishardBits: 2,
+				ShardBits:     1,
+			},
+			{
+				ChunkSize:  dvid.Point3d{32, 32, 32},
+				Size:       dvid.Point3d{50, 35, 40},
+				Resolution: [3]float64{16, 16, 16},
+				Encoding:   "jpeg",
+			},
+		},
+	}
+	w, err := NewWriter(dir, config)
+	if err != nil {
+		t.Fatalf("unable to create writer: %v\n", err)
+	}
+	chunkBytes := 32 * 32 * 32
+	chunkValue := func(x, y, z int32) byte {
+		return byte(10 + x + 4*y + 16*z)
+	}
+	for z := int32(0); z < 2; z++ {
+		for y := int32(0); y < 3; y++ {
+			for x := int32(0); x < 4; x++ {
+				data := bytes.Repeat([]byte{chunkValue(x, y, z)}, chunkBytes)
+				if err := w.WriteChunk(0, dvid.ChunkPoint3d{x, y, z}, data); err != nil {
+					t.Fatalf("unable to write chunk (%d,%d,%d): %v\n", x, y, z, err)
+				}
+			}
+		}
+	}
+	for _, coord := range []dvid.ChunkPoint3d{{0, 0, 0}, {1, 1, 0}} {
+		if err := w.WriteChunk(1, coord, bytes.Repeat([]byte{200}, chunkBytes)); err != nil {
+			t.Fatalf("unable to write jpeg chunk %s: %v\n", coord, err)
+		}
+	}
+	if err := w.WriteChunk(0, dvid.ChunkPoint3d{4, 0, 0}, make([]byte, chunkBytes)); err == nil {
+		t.Fatalf("expected error writing chunk outside volume\n")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unable to close writer: %v\n", err)
+	}
+
+	var c dvid.Config
+	c.Set("ref", "file://"+dir)
+	ng, _, err := Engine{}.newStore(dvid.StoreConfig{Config: c, Engine: "ngprecomputed"})
+	if err != nil {
+		t.Fatalf("unable to open written volume: %v\n", err)
+	}
+	defer ng.Close()
+
+	props, err := ng.GridProperties(1)
+	if err != nil {
+		t.Fatalf("unable to get grid properties: %v\n", err)
+	}
+	if props.VolumeSize != (dvid.Point3d{50, 35, 40}) || props.Encoding != "jpeg" {
+		t.Errorf("bad grid properties for scale 1: %v\n", props)
+	}
+	// Only unclipped raw chunks can be read back.
+	for _, coord := range []dvid.ChunkPoint3d{{0, 0, 0}, {1, 0, 0}, {2, 1, 0}} {
+		val, err := ng.GridGet(0, coord)
+		if err != nil {
+			t.Fatalf("unable to get chunk %s: %v\n", coord, err)
+		}
+		expected := bytes.Repeat([]byte{chunkValue(coord[0], coord[1], coord[2])}, chunkBytes)
+		if !bytes.Equal(val, expected) {
+			t.Errorf("chunk %s read back incorrectly (%d bytes)\n", coord, len(val))
+		}
+	}
+	val, err := ng.GridGet(1, dvid.ChunkPoint3d{0, 0, 0})
+	if err != nil {
+		t.Fatalf("unable to get jpeg chunk: %v\n", err)
+	}
+	chunkSize := dvid.Point3d{32, 32, 32}
+	data, err := jpegUncompress(chunkSize, chunkSize, val, dvid.ChunkPoint3d{0, 0, 0})
+	if err != nil {
+		t.Fatalf("unable to uncompress jpeg chunk: %v\n", err)
+	}
+	for _, i := range []int{0, 17*32*32 + 2*32 + 17, chunkBytes - 1} {
+		if data[i] < 198 || data[i] > 202 {
+			t.Errorf("jpeg chunk read back incorrectly: voxel %d has value %d\n", i, data[i])
+		}
+	}
+	val, err = ng.GridGet(1, dvid.ChunkPoint3d{1, 1, 0})
+	if err != nil || val == nil {
+		t.Errorf("unable to get clipped jpeg chunk: %v\n", err)
+	}
+}
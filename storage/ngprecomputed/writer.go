@@ -0,0 +1,411 @@
+package ngprecomputed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// ---- Writing of neuroglancer precomputed volumes to a local directory -----
+
+// VolumeConfig describes a neuroglancer precomputed volume to be written.
+type VolumeConfig struct {
+	VolumeType string // "image" or "segmentation"
+	DataType   string // "uint8" or "uint64"
+	Scales     []ScaleConfig
+}
+
+// ScaleConfig describes one scale of a neuroglancer precomputed volume.
+type ScaleConfig struct {
+	ChunkSize  dvid.Point3d
+	Size       dvid.Point3d // size of volume in voxels
+	Resolution [3]float64
+	Encoding   string // "raw" or "jpeg", where "jpeg" requires uint8 data
+
+	// If Sharded is true, chunks are written into "neuroglancer_uint64_sharded_v1" shard
+	// files using the identity hash, else each chunk is written to a separate file.
+	Sharded       bool
+	PreshiftBits  uint8
+	MinishardBits uint8
+	ShardBits     uint8
+	IndexEncoding string // "raw" or "gzip" (default) for minishard indices
+	DataEncoding  string // "raw" or "gzip" (default) for chunk data
+}
+
+// SetDefaultSharding sets the scale to use sharding with parameters similar to common
+// neuroglancer tools: up to 2^9 chunks per minishard and 2^6 minishards per shard, with
+// gzip encoding of data and minishard indices.
+func (sc *ScaleConfig) SetDefaultSharding() {
+	var totalBits uint8
+	for dim := 0; dim < 3; dim++ {
+		numChunks := (sc.Size[dim] + sc.ChunkSize[dim] - 1) / sc.ChunkSize[dim]
+		totalBits += log2(numChunks)
+	}
+	sc.Sharded = true
+	sc.PreshiftBits = 9
+	if totalBits < sc.PreshiftBits {
+		sc.PreshiftBits = totalBits
+	}
+	sc.MinishardBits = 6
+	if totalBits-sc.PreshiftBits < sc.MinishardBits {
+		sc.MinishardBits = totalBits - sc.PreshiftBits
+	}
+	sc.ShardBits = totalBits - sc.PreshiftBits - sc.MinishardBits
+	sc.IndexEncoding = "gzip"
+	sc.DataEncoding = "gzip"
+}
+
+// JSON for info file, which differs from ngVolume in optional fields.
+type infoScale struct {
+	ChunkSizes  []dvid.Point3d `json:"chunk_sizes"`
+	Encoding    string         `json:"encoding"`
+	Key         string         `json:"key"`
+	Resolution  [3]float64     `json:"resolution"`
+	Sharding    *ngShard       `json:"sharding,omitempty"`
+	Size        dvid.Point3d   `json:"size"`
+	VoxelOffset dvid.Point3d   `json:"voxel_offset"`
+}
+
+type infoVolume struct {
+	StoreType   string      `json:"@type"`
+	VolumeType  string      `json:"type"`
+	DataType    string      `json:"data_type"`
+	NumChannels int         `json:"num_channels"`
+	Scales      []infoScale `json:"scales"`
+}
+
+// Writer writes chunks of a multi-scale volume in neuroglancer precomputed format to a
+// local directory.  Chunks can be written concurrently and in any order, but shard files
+// are not complete until Close is called.
+type Writer struct {
+	dir           string
+	ng            *ngStore // used for shard calculations
+	bytesPerVoxel int64
+
+	mu     sync.Mutex
+	shards map[string]*shardWriter // keyed by shard file relative to dir
+	closed bool
+}
+
+// shardWriter tracks the chunks appended to the data section of a shard file.
+type shardWriter struct {
+	path          string
+	indexSize     uint64 // size of the fixed-size shard index at start of file
+	indexEncoding string // encoding of minishard indices
+	dataSize      uint64 // bytes written after the shard index
+	minishards    map[uint64]map[uint64]valueLoc
+}
+
+// NewWriter creates a directory with an info file for the given volume and returns
+// a Writer for its chunks.
+func NewWriter(dir string, config VolumeConfig) (*Writer, error) {
+	var bytesPerVoxel int64
+	switch config.DataType {
+	case "uint8":
+		bytesPerVoxel = 1
+	case "uint64":
+		bytesPerVoxel = 8
+	default:
+		return nil, fmt.Errorf("ngprecomputed writer can't handle data type %q", config.DataType)
+	}
+	switch config.VolumeType {
+	case "image", "segmentation":
+	default:
+		return nil, fmt.Errorf("ngprecomputed writer can't handle volume type %q", config.VolumeType)
+	}
+	if len(config.Scales) == 0 {
+		return nil, fmt.Errorf("ngprecomputed writer requires at least one scale")
+	}
+
+	vol := ngVolume{
+		StoreType:   "neuroglancer_multiscale_volume",
+		VolumeType:  config.VolumeType,
+		DataType:    config.DataType,
+		NumChannels: 1,
+		Scales:      make([]ngScale, len(config.Scales)),
+	}
+	info := infoVolume{
+		StoreType:   vol.StoreType,
+		VolumeType:  vol.VolumeType,
+		DataType:    vol.DataType,
+		NumChannels: vol.NumChannels,
+		Scales:      make([]infoScale, len(config.Scales)),
+	}
+	for n, sc := range config.Scales {
+		for dim := 0; dim < 3; dim++ {
+			if sc.ChunkSize[dim] <= 0 || sc.Size[dim] <= 0 {
+				return nil, fmt.Errorf("scale %d has bad chunk size %s or volume size %s", n, sc.ChunkSize, sc.Size)
+			}
+		}
+		switch sc.Encoding {
+		case "raw":
+		case "jpeg":
+			if bytesPerVoxel != 1 {
+				return nil, fmt.Errorf("scale %d: jpeg encoding requires uint8 data", n)
+			}
+		default:
+			return nil, fmt.Errorf("scale %d has unsupported encoding %q", n, sc.Encoding)
+		}
+		scale := ngScale{
+			ChunkSizes: []dvid.Point3d{sc.ChunkSize},
+			Encoding:   sc.Encoding,
+			Key:        fmt.Sprintf("%g_%g_%g", sc.Resolution[0], sc.Resolution[1], sc.Resolution[2]),
+			Resolution: sc.Resolution,
+			Size:       sc.Size,
+		}
+		if sc.Sharded {
+			scale.Sharding = ngShard{
+				FormatType:    "neuroglancer_uint64_sharded_v1",
+				Hash:          "identity",
+				MinishardBits: sc.MinishardBits,
+				PreshiftBits:  sc.PreshiftBits,
+				ShardBits:     sc.ShardBits,
+				IndexEncoding: sc.IndexEncoding,
+				DataEncoding:  sc.DataEncoding,
+			}
+			for _, encoding := range []*string{&scale.Sharding.IndexEncoding, &scale.Sharding.DataEncoding} {
+				switch *encoding {
+				case "":
+					*encoding = "gzip"
+				case "raw", "gzip":
+				default:
+					return nil, fmt.Errorf("scale %d has unsupported shard encoding %q", n, *encoding)
+				}
+			}
+			if int(sc.MinishardBits)+int(sc.ShardBits) > 64 {
+				return nil, fmt.Errorf("scale %d has too many minishard and shard bits", n)
+			}
+		}
+		vol.Scales[n] = scale
+		info.Scales[n] = infoScale{
+			ChunkSizes: scale.ChunkSizes,
+			Encoding:   scale.Encoding,
+			Key:        scale.Key,
+			Resolution: scale.Resolution,
+			Size:       scale.Size,
+		}
+		if sc.Sharded {
+			sharding := scale.Sharding
+			info.Scales[n].Sharding = &sharding
+		}
+	}
+
+	ng := &ngStore{ref: dir, vol: vol}
+	if err := ng.initScales(); err != nil {
+		return nil, err
+	}
+	for _, scale := range vol.Scales {
+		if err := os.MkdirAll(filepath.Join(dir, scale.Key), 0755); err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "info"), data, 0644); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		dir:           dir,
+		ng:            ng,
+		bytesPerVoxel: bytesPerVoxel,
+		shards:        make(map[string]*shardWriter),
+	}, nil
+}
+
+func gzipCompress(in []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(in); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteChunk encodes and writes the chunk at the given chunk coordinate.  The data should
+// be a full, uncompressed chunk with x varying fastest; chunks on the edge of the volume
+// are clipped to the volume size.
+func (w *Writer) WriteChunk(scaleLevel int, chunkCoord dvid.ChunkPoint3d, data []byte) error {
+	if scaleLevel < 0 || scaleLevel >= len(w.ng.vol.Scales) {
+		return fmt.Errorf("bad scale %d for ngprecomputed writer with %d scales", scaleLevel, len(w.ng.vol.Scales))
+	}
+	scale := &(w.ng.vol.Scales[scaleLevel])
+	chunkSize := scale.ChunkSizes[0]
+	if int64(len(data)) != chunkSize.Prod()*w.bytesPerVoxel {
+		return fmt.Errorf("chunk %s has %d bytes, expected %d", chunkCoord, len(data), chunkSize.Prod()*w.bytesPerVoxel)
+	}
+	minPt := chunkCoord.MinPoint(chunkSize).(dvid.Point3d)
+	maxPt := minPt.Add(chunkSize).(dvid.Point3d)
+	clippedSize := chunkSize
+	for dim := 0; dim < 3; dim++ {
+		if minPt[dim] < 0 || minPt[dim] >= scale.Size[dim] {
+			return fmt.Errorf("chunk %s is outside volume of size %s", chunkCoord, scale.Size)
+		}
+		if maxPt[dim] > scale.Size[dim] {
+			maxPt[dim] = scale.Size[dim]
+			clippedSize[dim] = scale.Size[dim] - minPt[dim]
+		}
+	}
+	if clippedSize != chunkSize {
+		data = clipChunk(data, chunkSize, clippedSize, w.bytesPerVoxel)
+	}
+
+	var val []byte
+	var err error
+	switch scale.Encoding {
+	case "jpeg":
+		if val, err = jpegCompress(clippedSize, data); err != nil {
+			return fmt.Errorf("unable to jpeg compress chunk %s: %v", chunkCoord, err)
+		}
+	default:
+		val = data
+	}
+
+	if scale.Sharding.FormatType == "" {
+		key := fmt.Sprintf("%s/%d-%d_%d-%d_%d-%d", scale.Key, minPt[0], maxPt[0], minPt[1], maxPt[1], minPt[2], maxPt[2])
+		return ioutil.WriteFile(filepath.Join(w.dir, filepath.FromSlash(key)), val, 0644)
+	}
+	if scale.Sharding.DataEncoding == "gzip" {
+		if val, err = gzipCompress(val); err != nil {
+			return err
+		}
+	}
+	shardFile, minishard, chunkID, err := w.ng.calcShard(scale, chunkCoord)
+	if err != nil {
+		return err
+	}
+	return w.appendToShard(scale, shardFile, minishard, chunkID, val)
+}
+
+// returns the portion of a chunk within the clipped size.
+func clipChunk(data []byte, chunkSize, clippedSize dvid.Point3d, bytesPerVoxel int64) []byte {
+	rowBytes := int64(clippedSize[0]) * bytesPerVoxel
+	chunkRowBytes := int64(chunkSize[0]) * bytesPerVoxel
+	chunkPlaneBytes := int64(chunkSize[1]) * chunkRowBytes
+	clipped := make([]byte, clippedSize.Prod()*bytesPerVoxel)
+	var dst int64
+	for z := int64(0); z < int64(clippedSize[2]); z++ {
+		for y := int64(0); y < int64(clippedSize[1]); y++ {
+			src := z*chunkPlaneBytes + y*chunkRowBytes
+			copy(clipped[dst:dst+rowBytes], data[src:src+rowBytes])
+			dst += rowBytes
+		}
+	}
+	return clipped
+}
+
+func (w *Writer) appendToShard(scale *ngScale, shardFile string, minishard, chunkID uint64, val []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return fmt.Errorf("ngprecomputed writer for %q already closed", w.dir)
+	}
+	shard, found := w.shards[shardFile]
+	if !found {
+		shard = &shardWriter{
+			path:          filepath.Join(w.dir, filepath.FromSlash(shardFile)),
+			indexSize:     scale.shardIndexEnd,
+			indexEncoding: scale.Sharding.IndexEncoding,
+			minishards:    make(map[uint64]map[uint64]valueLoc),
+		}
+		w.shards[shardFile] = shard
+	}
+	f, err := os.OpenFile(shard.path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(val, int64(shard.indexSize+shard.dataSize)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	chunks, found := shard.minishards[minishard]
+	if !found {
+		chunks = make(map[uint64]valueLoc)
+		shard.minishards[minishard] = chunks
+	}
+	chunks[chunkID] = valueLoc{pos: shard.dataSize, size: uint64(len(val))}
+	shard.dataSize += uint64(len(val))
+	return nil
+}
+
+// Close finishes all shard files by writing the minishard indices and shard index.
+// No chunks can be written after Close.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	for shardFile, shard := range w.shards {
+		if err := shard.finish(); err != nil {
+			return fmt.Errorf("unable to finish shard %q: %v", shardFile, err)
+		}
+	}
+	return nil
+}
+
+// finish appends the minishard indices to the shard file and writes the shard index.
+func (shard *shardWriter) finish() error {
+	f, err := os.OpenFile(shard.path, os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	shardIndex := make([]byte, shard.indexSize)
+	offset := shard.dataSize
+	for minishard, chunks := range shard.minishards {
+		chunkIDs := make([]uint64, 0, len(chunks))
+		for chunkID := range chunks {
+			chunkIDs = append(chunkIDs, chunkID)
+		}
+		sort.Slice(chunkIDs, func(i, j int) bool { return chunkIDs[i] < chunkIDs[j] })
+
+		// minishard index is delta-encoded chunk ids, then offsets relative to end of
+		// prior chunk, then sizes.
+		n := len(chunkIDs)
+		index := make([]byte, n*24)
+		var prevID, prevEnd uint64
+		for i, chunkID := range chunkIDs {
+			loc := chunks[chunkID]
+			binary.LittleEndian.PutUint64(index[i*8:], chunkID-prevID)
+			binary.LittleEndian.PutUint64(index[(n+i)*8:], loc.pos-prevEnd)
+			binary.LittleEndian.PutUint64(index[(2*n+i)*8:], loc.size)
+			prevID = chunkID
+			prevEnd = loc.pos + loc.size
+		}
+		if shard.indexEncoding == "gzip" {
+			if index, err = gzipCompress(index); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		if _, err := f.WriteAt(index, int64(shard.indexSize+offset)); err != nil {
+			f.Close()
+			return err
+		}
+		binary.LittleEndian.PutUint64(shardIndex[minishard*16:], offset)
+		binary.LittleEndian.PutUint64(shardIndex[minishard*16+8:], offset+uint64(len(index)))
+		offset += uint64(len(index))
+	}
+	if _, err := f.WriteAt(shardIndex, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,1039 @@
+//go:build s3
+// +build s3
+
+/*
+Package s3 implements a storage engine on top of any S3-compatible object store,
+e.g., Amazon S3, MinIO, or Ceph.  Like gbucket, each key-value pair is an object whose
+name is the hex encoding of the full key, so object listings are in key order.
+Versioned data uses a separate object per version and tombstone objects for deletions.
+
+Note: S3 provides no snapshots or multi-object transactions, so range queries see
+writes made during the query and batches are not atomic.
+*/
+package s3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/blang/semver"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	api "github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+func init() {
+	ver, err := semver.Make("0.1.0")
+	if err != nil {
+		dvid.Errorf("Unable to make semver in s3: %v\n", err)
+	}
+	e := Engine{"s3", "S3-compatible object storage", ver}
+	storage.RegisterEngine(e)
+}
+
+const (
+	// init object for a store, which holds the version of the key layout
+	INITKEY = "initialized"
+
+	// current version of the key layout
+	CURVER = "1.0"
+
+	// default limit on the number of parallel requests
+	DefaultMaxRequests = 100
+
+	// maximum number of objects returned per list request or deleted per
+	// multi-object delete request
+	maxListKeys = 1000
+
+	// default region if none is configured, which suffices for most S3-compatible stores
+	defaultRegion = "us-east-1"
+)
+
+// errStopRange is returned by range functions to end a range early.
+var errStopRange = errors.New("s3: range stopped")
+
+// --- Engine Implementation ------
+
+type Engine struct {
+	name   string
+	desc   string
+	semver semver.Version
+}
+
+func (e Engine) GetName() string {
+	return e.name
+}
+
+func (e Engine) GetDescription() string {
+	return e.desc
+}
+
+func (e Engine) IsDistributed() bool {
+	return true
+}
+
+func (e Engine) GetSemVer() semver.Version {
+	return e.semver
+}
+
+func (e Engine) String() string {
+	return fmt.Sprintf("%s [%s]", e.name, e.semver)
+}
+
+// NewStore returns an S3 store suitable as a general storage engine.
+// The passed Config must contain "bucket", the name of an existing bucket, and
+// can optionally contain:
+//
+//	"endpoint": URL of an S3-compatible server like "http://localhost:9000" for MinIO
+//	"region": region of the bucket, default "us-east-1"
+//	"accesskey", "secretkey": credentials, else the standard AWS environment variables
+//	   or shared credentials file are used
+//	"prefix": prefix for all object names so a bucket can hold many stores
+//	"pathstyle": use path-style bucket addressing, default true if endpoint is given
+//	"maxrequests": maximum number of parallel requests, default 100
+func (e Engine) NewStore(config dvid.StoreConfig) (dvid.Store, bool, error) {
+	return e.newS3(config)
+}
+
+// parseConfig initializes S3 from config
+func parseConfig(config dvid.StoreConfig) (*S3, error) {
+	c := config.GetAll()
+	getString := func(name string, required bool) (string, error) {
+		v, found := c[name]
+		if !found {
+			if required {
+				return "", fmt.Errorf("%q must be specified for s3 configuration", name)
+			}
+			return "", nil
+		}
+		s, ok := v.(string)
+		if !ok {
+			return "", fmt.Errorf("%q setting must be a string (%v)", name, v)
+		}
+		return s, nil
+	}
+	db := &S3{
+		region:      defaultRegion,
+		maxRequests: DefaultMaxRequests,
+		config:      config,
+	}
+	var err error
+	if db.bucket, err = getString("bucket", true); err != nil {
+		return nil, err
+	}
+	if db.endpoint, err = getString("endpoint", false); err != nil {
+		return nil, err
+	}
+	region, err := getString("region", false)
+	if err != nil {
+		return nil, err
+	}
+	if region != "" {
+		db.region = region
+	}
+	if db.accessKey, err = getString("accesskey", false); err != nil {
+		return nil, err
+	}
+	if db.secretKey, err = getString("secretkey", false); err != nil {
+		return nil, err
+	}
+	if db.prefix, err = getString("prefix", false); err != nil {
+		return nil, err
+	}
+	db.pathStyle = db.endpoint != ""
+	if v, found := c["pathstyle"]; found {
+		pathStyle, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%q setting must be a bool (%v)", "pathstyle", v)
+		}
+		db.pathStyle = pathStyle
+	}
+	if v, found := c["maxrequests"]; found {
+		switch n := v.(type) {
+		case int:
+			db.maxRequests = n
+		case int64:
+			db.maxRequests = int(n)
+		default:
+			return nil, fmt.Errorf("%q setting must be an integer (%v)", "maxrequests", v)
+		}
+		if db.maxRequests < 1 {
+			return nil, fmt.Errorf("%q setting must be positive (%d)", "maxrequests", db.maxRequests)
+		}
+	}
+	return db, nil
+}
+
+// newS3 sets up the S3 client (bucket must already exist)
+func (e Engine) newS3(config dvid.StoreConfig) (*S3, bool, error) {
+	db, err := parseConfig(config)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error in newS3() %s\n", err)
+	}
+
+	awsConfig := &aws.Config{
+		Region:           aws.String(db.region),
+		S3ForcePathStyle: aws.Bool(db.pathStyle),
+	}
+	if db.endpoint != "" {
+		awsConfig.Endpoint = aws.String(db.endpoint)
+	}
+	if db.accessKey != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(db.accessKey, db.secretKey, "")
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, false, err
+	}
+	db.client = api.New(sess)
+	db.opLimit = make(chan struct{}, db.maxRequests)
+	db.counters = storage.NewStoreCounters(db.String())
+
+	// bucket must already exist -- check existence
+	if _, err = db.client.HeadBucket(&api.HeadBucketInput{Bucket: aws.String(db.bucket)}); err != nil {
+		return nil, false, fmt.Errorf("unable to access bucket %q: %v", db.bucket, err)
+	}
+
+	var created bool
+	val, err := db.getV(storage.Key(INITKEY))
+	if err != nil {
+		return nil, false, err
+	}
+	if val == nil {
+		created = true
+		if err = db.putV(storage.Key(INITKEY), []byte(CURVER)); err != nil {
+			return nil, false, err
+		}
+	} else if string(val) != CURVER {
+		return nil, false, fmt.Errorf("s3 store %s has unknown key layout version %q", db, string(val))
+	}
+	dvid.Infof("Opened %s\n", db)
+	return db, created, nil
+}
+
+// S3 is a store backed by a bucket in an S3-compatible object store.
+type S3 struct {
+	bucket      string
+	endpoint    string
+	region      string
+	accessKey   string
+	secretKey   string
+	prefix      string
+	pathStyle   bool
+	maxRequests int
+
+	client *api.S3
+
+	// limits the number of parallel requests
+	opLimit chan struct{}
+
+	config   dvid.StoreConfig
+	counters *storage.StoreCounters
+}
+
+func (db *S3) String() string {
+	if db.endpoint == "" {
+		return fmt.Sprintf("s3 bucket %s/%s", db.bucket, db.prefix)
+	}
+	return fmt.Sprintf("s3 bucket %s/%s @ %s", db.bucket, db.prefix, db.endpoint)
+}
+
+// ---- HELPER FUNCTIONS ----
+
+func (db *S3) objectName(k storage.Key) string {
+	return db.prefix + hex.EncodeToString(k)
+}
+
+// commonPrefix returns the longest common prefix of two strings.
+func commonPrefix(s1, s2 string) string {
+	n := len(s1)
+	if len(s2) < n {
+		n = len(s2)
+	}
+	for i := 0; i < n; i++ {
+		if s1[i] != s2[i] {
+			return s1[:i]
+		}
+	}
+	return s1[:n]
+}
+
+func isNotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case api.ErrCodeNoSuchKey, "NotFound":
+			return true
+		}
+	}
+	return false
+}
+
+// getV retrieves a value for a given key or nil if it doesn't exist.
+func (db *S3) getV(k storage.Key) ([]byte, error) {
+	out, err := db.client.GetObject(&api.GetObjectInput{
+		Bucket: aws.String(db.bucket),
+		Key:    aws.String(db.objectName(k)),
+	})
+	if err != nil {
+		// preserve interface where missing value is not an error
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+	v, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		v = []byte{}
+	}
+	storage.StoreValueBytesRead <- len(v)
+	return v, nil
+}
+
+// putV writes a value for a given key.
+func (db *S3) putV(k storage.Key, v []byte) error {
+	_, err := db.client.PutObject(&api.PutObjectInput{
+		Bucket: aws.String(db.bucket),
+		Key:    aws.String(db.objectName(k)),
+		Body:   bytes.NewReader(v),
+	})
+	if err != nil {
+		return err
+	}
+	storage.StoreKeyBytesWritten <- len(k)
+	storage.StoreValueBytesWritten <- len(v)
+	return nil
+}
+
+// deleteV deletes the object for a given key.  It is not an error if there is no object.
+func (db *S3) deleteV(k storage.Key) error {
+	_, err := db.client.DeleteObject(&api.DeleteObjectInput{
+		Bucket: aws.String(db.bucket),
+		Key:    aws.String(db.objectName(k)),
+	})
+	return err
+}
+
+// deleteKeys deletes the objects for the given keys using multi-object delete requests.
+func (db *S3) deleteKeys(keys []storage.Key) error {
+	for start := 0; start < len(keys); start += maxListKeys {
+		end := start + maxListKeys
+		if end > len(keys) {
+			end = len(keys)
+		}
+		objects := make([]*api.ObjectIdentifier, end-start)
+		for i, k := range keys[start:end] {
+			objects[i] = &api.ObjectIdentifier{Key: aws.String(db.objectName(k))}
+		}
+		out, err := db.client.DeleteObjects(&api.DeleteObjectsInput{
+			Bucket: aws.String(db.bucket),
+			Delete: &api.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Errors) != 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("unable to delete %d objects, e.g., %s: %s", len(out.Errors), aws.StringValue(e.Key), aws.StringValue(e.Message))
+		}
+	}
+	return nil
+}
+
+// listKeys sends pages of keys in the range [begKey, endKey] in ascending order to f.
+// If f returns errStopRange, listing ends without error.
+func (db *S3) listKeys(begKey, endKey storage.Key, f func([]storage.Key) error) error {
+	begName := hex.EncodeToString(begKey)
+	input := &api.ListObjectsV2Input{
+		Bucket:  aws.String(db.bucket),
+		Prefix:  aws.String(db.prefix + commonPrefix(begName, hex.EncodeToString(endKey))),
+		MaxKeys: aws.Int64(maxListKeys),
+	}
+	if begName != "" {
+		// object names have even length, so this precedes begKey and any later key.
+		input.StartAfter = aws.String(db.prefix + begName[:len(begName)-1])
+	}
+	for {
+		out, err := db.client.ListObjectsV2(input)
+		if err != nil {
+			return err
+		}
+		var pastEnd bool
+		keys := make([]storage.Key, 0, len(out.Contents))
+		for _, obj := range out.Contents {
+			k, err := hex.DecodeString(strings.TrimPrefix(aws.StringValue(obj.Key), db.prefix))
+			if err != nil {
+				continue // not a key-value object
+			}
+			storage.StoreKeyBytesRead <- len(k)
+			if bytes.Compare(k, begKey) < 0 {
+				continue
+			}
+			if bytes.Compare(k, endKey) > 0 {
+				pastEnd = true
+				break
+			}
+			keys = append(keys, k)
+		}
+		if len(keys) != 0 {
+			if err := f(keys); err != nil {
+				if err == errStopRange {
+					return nil
+				}
+				return err
+			}
+		}
+		if pastEnd || !aws.BoolValue(out.IsTruncated) {
+			return nil
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+}
+
+// getValues retrieves the values for the given keys in parallel.  The value for a
+// key that no longer exists is nil.
+func (db *S3) getValues(keys []storage.Key) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	var firstErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, k := range keys {
+		wg.Add(1)
+		db.opLimit <- struct{}{}
+		go func(i int, k storage.Key) {
+			defer func() {
+				<-db.opLimit
+				wg.Done()
+			}()
+			v, err := db.getV(k)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				return
+			}
+			values[i] = v
+		}(i, k)
+	}
+	wg.Wait()
+	return values, firstErr
+}
+
+// sendKeyValues sends the key-value pairs for the given keys to f in order.  Pairs
+// deleted since their keys were listed are skipped.
+func (db *S3) sendKeyValues(keys []storage.Key, keysOnly bool, f func(*storage.KeyValue) error) error {
+	if keysOnly {
+		for _, k := range keys {
+			if err := f(&storage.KeyValue{K: k}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	values, err := db.getValues(keys)
+	if err != nil {
+		return err
+	}
+	for i, k := range keys {
+		if values[i] == nil {
+			continue
+		}
+		if err := f(&storage.KeyValue{K: k, V: values[i]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processRange sends the key-value pairs in a range of type-specific keys to f in
+// ascending key order.  If the context is versioned, only the key-value pairs
+// visible to the context's version are sent.
+func (db *S3) processRange(ctx storage.Context, begTKey, endTKey storage.TKey, keysOnly bool, f func(*storage.KeyValue) error) error {
+	if !ctx.Versioned() {
+		begKey := ctx.ConstructKey(begTKey)
+		endKey := ctx.ConstructKey(endTKey)
+		return db.listKeys(begKey, endKey, func(keys []storage.Key) error {
+			return db.sendKeyValues(keys, keysOnly, f)
+		})
+	}
+	vctx, ok := ctx.(storage.VersionedCtx)
+	if !ok {
+		return fmt.Errorf("context is versioned but doesn't fulfill interface: %v", ctx)
+	}
+	minKey, err := vctx.MinVersionKey(begTKey)
+	if err != nil {
+		return err
+	}
+	maxKey, err := vctx.MaxVersionKey(endTKey)
+	if err != nil {
+		return err
+	}
+
+	// keys for all versions of a type-specific key are adjacent, and a group of them
+	// may span list pages.
+	var groupTKey storage.TKey
+	var group []*storage.KeyValue
+	resolveGroup := func(matched []storage.Key) ([]storage.Key, error) {
+		if len(group) == 0 {
+			return matched, nil
+		}
+		kv, err := vctx.VersionedKeyValue(group)
+		group = nil
+		if err != nil {
+			return nil, err
+		}
+		if kv != nil {
+			matched = append(matched, kv.K)
+		}
+		return matched, nil
+	}
+	var stopped bool
+	err = db.listKeys(minKey, maxKey, func(keys []storage.Key) error {
+		var matched []storage.Key
+		for _, k := range keys {
+			tk, err := storage.TKeyFromKey(k)
+			if err != nil {
+				return err
+			}
+			if len(group) != 0 && !bytes.Equal(tk, groupTKey) {
+				if matched, err = resolveGroup(matched); err != nil {
+					return err
+				}
+			}
+			groupTKey = tk
+			group = append(group, &storage.KeyValue{K: k})
+		}
+		err := db.sendKeyValues(matched, keysOnly, f)
+		if err == errStopRange {
+			stopped = true
+		}
+		return err
+	})
+	if err != nil || stopped {
+		return err
+	}
+	matched, err := resolveGroup(nil)
+	if err != nil {
+		return err
+	}
+	err = db.sendKeyValues(matched, keysOnly, f)
+	if err == errStopRange {
+		return nil
+	}
+	return err
+}
+
+// --- dvid.Store interface ---
+
+// Close closes the store.
+func (db *S3) Close() {
+	// Nothing to close.
+}
+
+// Equal returns true if the store matches the given store configuration.
+func (db *S3) Equal(config dvid.StoreConfig) bool {
+	db2, err := parseConfig(config)
+	if err != nil {
+		return false
+	}
+	return db.bucket == db2.bucket && db.endpoint == db2.endpoint && db.prefix == db2.prefix
+}
+
+// GetStoreConfig returns the configuration for this store.
+func (db *S3) GetStoreConfig() dvid.StoreConfig {
+	return db.config
+}
+
+// ---- KeyValueGetter interface ------
+
+// Get returns a value given a key.
+func (db *S3) Get(ctx storage.Context, tk storage.TKey) ([]byte, error) {
+	if db == nil {
+		return nil, fmt.Errorf("Can't call Get() on nil S3")
+	}
+	db.counters.CountGet()
+	if ctx == nil {
+		return nil, fmt.Errorf("Received nil context in Get()")
+	}
+	if !ctx.Versioned() {
+		return db.getV(ctx.ConstructKey(tk))
+	}
+	var v []byte
+	err := db.processRange(ctx, tk, tk, false, func(kv *storage.KeyValue) error {
+		v = kv.V
+		return errStopRange
+	})
+	return v, err
+}
+
+// Exists returns true if a key exists.
+func (db *S3) Exists(ctx storage.Context, tk storage.TKey) (bool, error) {
+	if db == nil {
+		return false, fmt.Errorf("Can't call Exists() on nil S3")
+	}
+	if ctx == nil {
+		return false, fmt.Errorf("Received nil context in Exists()")
+	}
+	if !ctx.Versioned() {
+		_, err := db.client.HeadObject(&api.HeadObjectInput{
+			Bucket: aws.String(db.bucket),
+			Key:    aws.String(db.objectName(ctx.ConstructKey(tk))),
+		})
+		if err != nil {
+			if isNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+	var found bool
+	err := db.processRange(ctx, tk, tk, true, func(kv *storage.KeyValue) error {
+		found = true
+		return errStopRange
+	})
+	return found, err
+}
+
+// ---- OrderedKeyValueGetter interface ------
+
+// KeysInRange returns a range of present keys spanning (kStart, kEnd).  If the keys
+// are versioned, only keys in the ancestor path of the current context's version
+// will be returned.
+func (db *S3) KeysInRange(ctx storage.Context, kStart, kEnd storage.TKey) ([]storage.TKey, error) {
+	if db == nil {
+		return nil, fmt.Errorf("Can't call KeysInRange() on nil S3")
+	}
+	db.counters.CountRange()
+	if ctx == nil {
+		return nil, fmt.Errorf("Received nil context in KeysInRange()")
+	}
+	tkeys := []storage.TKey{}
+	err := db.processRange(ctx, kStart, kEnd, true, func(kv *storage.KeyValue) error {
+		tk, err := storage.TKeyFromKey(kv.K)
+		if err != nil {
+			return err
+		}
+		tkeys = append(tkeys, tk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tkeys, nil
+}
+
+// SendKeysInRange sends a range of keys spanning (kStart, kEnd).  If the keys are
+// versioned, only keys in the ancestor path of the current context's version will be
+// sent.  End of range is marked by a nil key.
+func (db *S3) SendKeysInRange(ctx storage.Context, kStart, kEnd storage.TKey, ch storage.KeyChan) error {
+	if db == nil {
+		return fmt.Errorf("Can't call SendKeysInRange() on nil S3")
+	}
+	db.counters.CountRange()
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in SendKeysInRange()")
+	}
+	err := db.processRange(ctx, kStart, kEnd, true, func(kv *storage.KeyValue) error {
+		ch <- kv.K
+		return nil
+	})
+	ch <- nil
+	return err
+}
+
+// GetRange returns a range of values spanning (kStart, kEnd) keys.  These key-value
+// pairs will be sorted in ascending key order.  If the keys are versioned, all key-value
+// pairs for the particular version will be returned.
+func (db *S3) GetRange(ctx storage.Context, kStart, kEnd storage.TKey) ([]*storage.TKeyValue, error) {
+	if db == nil {
+		return nil, fmt.Errorf("Can't call GetRange() on nil S3")
+	}
+	db.counters.CountRange()
+	if ctx == nil {
+		return nil, fmt.Errorf("Received nil context in GetRange()")
+	}
+	values := []*storage.TKeyValue{}
+	err := db.processRange(ctx, kStart, kEnd, false, func(kv *storage.KeyValue) error {
+		tk, err := storage.TKeyFromKey(kv.K)
+		if err != nil {
+			return err
+		}
+		values = append(values, &storage.TKeyValue{K: tk, V: kv.V})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// ProcessRange sends a range of key-value pairs to chunk handlers.  If the keys are
+// versioned, only key-value pairs for kStart's version will be transmitted.  If f
+// returns an error, the function is immediately terminated and returns an error.
+func (db *S3) ProcessRange(ctx storage.Context, kStart, kEnd storage.TKey, op *storage.ChunkOp, f storage.ChunkFunc) error {
+	if db == nil {
+		return fmt.Errorf("Can't call ProcessRange() on nil S3")
+	}
+	db.counters.CountRange()
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in ProcessRange()")
+	}
+	return db.processRange(ctx, kStart, kEnd, false, func(kv *storage.KeyValue) error {
+		if op != nil && op.Wg != nil {
+			op.Wg.Add(1)
+		}
+		tk, err := storage.TKeyFromKey(kv.K)
+		if err != nil {
+			return err
+		}
+		tkv := storage.TKeyValue{K: tk, V: kv.V}
+		chunk := &storage.Chunk{ChunkOp: op, TKeyValue: &tkv}
+		return f(chunk)
+	})
+}
+
+// RawRangeQuery sends a range of full keys.  This is to be used for low-level data
+// retrieval like DVID-to-DVID communication and should not be used by data type
+// implementations if possible.  A nil is sent down the channel when the
+// range is complete.
+func (db *S3) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out chan *storage.KeyValue, cancel <-chan struct{}) error {
+	if db == nil {
+		return fmt.Errorf("Can't call RawRangeQuery() on nil S3")
+	}
+	db.counters.CountRange()
+	var cancelled bool
+	err := db.listKeys(kStart, kEnd, func(keys []storage.Key) error {
+		return db.sendKeyValues(keys, keysOnly, func(kv *storage.KeyValue) error {
+			select {
+			case out <- kv:
+				return nil
+			case <-cancel:
+				cancelled = true
+				return errStopRange
+			}
+		})
+	})
+	if err != nil || cancelled {
+		return err
+	}
+	out <- nil
+	return nil
+}
+
+// ---- KeyValueSetter interface ------
+
+// Put writes a value with given key in a possibly versioned context.
+func (db *S3) Put(ctx storage.Context, tk storage.TKey, v []byte) error {
+	if db == nil {
+		return fmt.Errorf("Can't call Put() on nil S3")
+	}
+	db.counters.CountPut()
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in Put()")
+	}
+	if ctx.Versioned() {
+		vctx, ok := ctx.(storage.VersionedCtx)
+		if !ok {
+			return fmt.Errorf("Non-versioned context that says it's versioned received in Put(): %v", ctx)
+		}
+		// remove any tombstone first so an interrupted put leaves the previous value.
+		if err := db.deleteV(vctx.TombstoneKey(tk)); err != nil {
+			return err
+		}
+	}
+	return db.putV(ctx.ConstructKey(tk), v)
+}
+
+// RawPut is a low-level function that puts a key-value pair using full keys.
+// This can be used in conjunction with RawRangeQuery.
+func (db *S3) RawPut(k storage.Key, v []byte) error {
+	if db == nil {
+		return fmt.Errorf("Can't call RawPut() on nil S3")
+	}
+	db.counters.CountPut()
+	return db.putV(k, v)
+}
+
+// Delete deletes a key-value pair so that subsequent Get on the key returns nil.
+func (db *S3) Delete(ctx storage.Context, tk storage.TKey) error {
+	if db == nil {
+		return fmt.Errorf("Can't call Delete() on nil S3")
+	}
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in Delete()")
+	}
+	if ctx.Versioned() {
+		vctx, ok := ctx.(storage.VersionedCtx)
+		if !ok {
+			return fmt.Errorf("Non-versioned context that says it's versioned received in Delete(): %v", ctx)
+		}
+		// the tombstone takes precedence over a value of the same version, so write it first.
+		if err := db.putV(vctx.TombstoneKey(tk), dvid.EmptyValue()); err != nil {
+			return err
+		}
+	}
+	return db.deleteV(ctx.ConstructKey(tk))
+}
+
+// RawDelete is a low-level function.  It deletes a key-value pair using full keys
+// without any context.  This can be used in conjunction with RawRangeQuery.
+func (db *S3) RawDelete(k storage.Key) error {
+	if db == nil {
+		return fmt.Errorf("Can't call RawDelete() on nil S3")
+	}
+	return db.deleteV(k)
+}
+
+// ---- KeyValueIngestable interface ------
+
+// KeyValueIngest accepts mutations without any guarantee that the ingested key value
+// will be immediately readable.  For S3, ingested data is written like any Put.
+func (db *S3) KeyValueIngest(ctx storage.Context, tk storage.TKey, v []byte) error {
+	return db.Put(ctx, tk, v)
+}
+
+// ---- OrderedKeyValueSetter interface ------
+
+// PutRange puts type key-value pairs using parallel requests.
+func (db *S3) PutRange(ctx storage.Context, kvs []storage.TKeyValue) error {
+	if db == nil {
+		return fmt.Errorf("Can't call PutRange() on nil S3")
+	}
+	db.counters.CountPut()
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in PutRange()")
+	}
+	batch := db.NewBatch(ctx).(*goBatch)
+	for _, kv := range kvs {
+		batch.Put(kv.K, kv.V)
+	}
+	return batch.Commit()
+}
+
+// DeleteRange removes all key-value pairs with keys in the given range.  If versioned,
+// tombstones are written for the context's version.
+func (db *S3) DeleteRange(ctx storage.Context, kStart, kEnd storage.TKey) error {
+	if db == nil {
+		return fmt.Errorf("Can't call DeleteRange() on nil S3")
+	}
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in DeleteRange()")
+	}
+	var tkeys []storage.TKey
+	err := db.processRange(ctx, kStart, kEnd, true, func(kv *storage.KeyValue) error {
+		tk, err := storage.TKeyFromKey(kv.K)
+		if err != nil {
+			return err
+		}
+		tkeys = append(tkeys, tk)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	batch := db.NewBatch(ctx).(*goBatch)
+	for _, tk := range tkeys {
+		batch.Delete(tk)
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	dvid.Debugf("Deleted %d key-value pairs via delete range for %s.\n", len(tkeys), ctx)
+	return nil
+}
+
+// DeleteAll removes all key-value pairs for the context.  If versioned, all versions
+// of the data instance are deleted.  Will not produce any tombstones.
+func (db *S3) DeleteAll(ctx storage.Context) error {
+	if db == nil {
+		return fmt.Errorf("Can't call DeleteAll() on nil S3")
+	}
+	if ctx == nil {
+		return fmt.Errorf("Received nil context in DeleteAll()")
+	}
+
+	var err error
+	var minKey, maxKey storage.Key
+	vctx, versioned := ctx.(storage.VersionedCtx)
+	if versioned {
+		minTKey := storage.MinTKey(storage.TKeyMinClass)
+		maxTKey := storage.MaxTKey(storage.TKeyMaxClass)
+		minKey, err = vctx.MinVersionKey(minTKey)
+		if err != nil {
+			return err
+		}
+		maxKey, err = vctx.MaxVersionKey(maxTKey)
+		if err != nil {
+			return err
+		}
+	} else {
+		minKey, maxKey = ctx.KeyRange()
+	}
+
+	var numKV int
+	err = db.listKeys(minKey, maxKey, func(keys []storage.Key) error {
+		numKV += len(keys)
+		return db.deleteKeys(keys)
+	})
+	if err != nil {
+		return err
+	}
+	dvid.Debugf("Deleted %d key-value pairs via DELETE ALL for %s.\n", numKV, ctx)
+	return nil
+}
+
+// --- Batcher interface ----
+
+type batchOp struct {
+	key   storage.Key
+	value []byte
+	del   bool
+}
+
+type goBatch struct {
+	db   *S3
+	ctx  storage.Context
+	vctx storage.VersionedCtx
+	ops  []batchOp
+}
+
+// NewBatch returns an implementation that allows batch writes.  Batches are sent
+// using parallel requests and are not atomic.
+func (db *S3) NewBatch(ctx storage.Context) storage.Batch {
+	if db == nil {
+		dvid.Criticalf("Can't call NewBatch on nil S3\n")
+		return nil
+	}
+	if ctx == nil {
+		dvid.Criticalf("Received nil context in NewBatch()")
+		return nil
+	}
+	vctx, ok := ctx.(storage.VersionedCtx)
+	if !ok {
+		vctx = nil
+	}
+	return &goBatch{db: db, ctx: ctx, vctx: vctx}
+}
+
+// --- Batch interface ---
+
+func (batch *goBatch) Delete(tk storage.TKey) {
+	if batch == nil || batch.ctx == nil {
+		dvid.Criticalf("Received nil batch or nil batch context in batch.Delete()\n")
+		return
+	}
+	if batch.vctx != nil {
+		batch.ops = append(batch.ops, batchOp{key: batch.vctx.TombstoneKey(tk), value: dvid.EmptyValue()})
+	}
+	batch.ops = append(batch.ops, batchOp{key: batch.ctx.ConstructKey(tk), del: true})
+}
+
+func (batch *goBatch) Put(tk storage.TKey, v []byte) {
+	if batch == nil || batch.ctx == nil {
+		dvid.Criticalf("Received nil batch or nil batch context in batch.Put()\n")
+		return
+	}
+	if batch.vctx != nil {
+		batch.ops = append(batch.ops, batchOp{key: batch.vctx.TombstoneKey(tk), del: true})
+	}
+	batch.ops = append(batch.ops, batchOp{key: batch.ctx.ConstructKey(tk), value: v})
+}
+
+// Commit sends the last operation on each key, with deletions grouped into
+// multi-object delete requests.
+func (batch *goBatch) Commit() error {
+	if batch == nil {
+		return fmt.Errorf("Received nil batch in batch.Commit()")
+	}
+	last := make(map[string]int, len(batch.ops))
+	for i, op := range batch.ops {
+		last[string(op.key)] = i
+	}
+	var delKeys []storage.Key
+	var firstErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, op := range batch.ops {
+		if last[string(op.key)] != i {
+			continue
+		}
+		if op.del {
+			delKeys = append(delKeys, op.key)
+			continue
+		}
+		wg.Add(1)
+		batch.db.opLimit <- struct{}{}
+		go func(op batchOp) {
+			defer func() {
+				<-batch.db.opLimit
+				wg.Done()
+			}()
+			if err := batch.db.putV(op.key, op.value); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(op)
+	}
+	if err := batch.db.deleteKeys(delKeys); err != nil {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	wg.Wait()
+	batch.ops = nil
+	return firstErr
+}
+
+// ---- BlobStore interface ----
+
+// PutBlob writes unversioned data and returns a filename-friendly base64 encoding of the reference.
+func (db *S3) PutBlob(v []byte) (ref string, err error) {
+	if db == nil {
+		return "", fmt.Errorf("Can't call PutBlob on nil S3")
+	}
+	h := fnv.New128()
+	if _, err = h.Write(v); err != nil {
+		return
+	}
+	contentHash := h.Sum(nil)
+	if err = db.putV(storage.ConstructBlobKey(contentHash), v); err != nil {
+		return
+	}
+	return base64.URLEncoding.EncodeToString(contentHash), nil
+}
+
+// GetBlob returns unversioned data given a reference.
+func (db *S3) GetBlob(ref string) (v []byte, err error) {
+	if db == nil {
+		return nil, fmt.Errorf("Can't call GetBlob on nil S3")
+	}
+	var contentHash []byte
+	if contentHash, err = base64.URLEncoding.DecodeString(ref); err != nil {
+		return
+	}
+	return db.getV(storage.ConstructBlobKey(contentHash))
+}
@@ -0,0 +1,462 @@
+//go:build s3
+// +build s3
+
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// fakeS3 is a minimal in-memory S3 server handling path-style requests for one bucket.
+type fakeS3 struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+type listResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Name                  string
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	NextContinuationToken string `xml:",omitempty"`
+	Contents              []listContent
+}
+
+type listContent struct {
+	Key  string
+	Size int
+}
+
+type deleteRequest struct {
+	Objects []struct {
+		Key string
+	} `xml:"Object"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+}
+
+func (s *fakeS3) writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (s *fakeS3) writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "InternalError")
+	}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if parts[0] != s.bucket {
+		s.writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(parts) == 1 || parts[1] == "" {
+		switch {
+		case r.Method == http.MethodHead:
+		case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+			s.list(w, r)
+		case r.Method == http.MethodPost && r.URL.Query()["delete"] != nil:
+			var req deleteRequest
+			if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+				s.writeError(w, http.StatusBadRequest, "MalformedXML")
+				return
+			}
+			for _, obj := range req.Objects {
+				delete(s.objects, obj.Key)
+			}
+			s.writeXML(w, deleteResult{})
+		default:
+			s.writeError(w, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+	name := parts[1]
+	switch r.Method {
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		s.objects[name] = data
+	case http.MethodGet, http.MethodHead:
+		data, found := s.objects[name]
+		if !found {
+			s.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (s *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	maxKeys := 1000
+	if mk := q.Get("max-keys"); mk != "" {
+		maxKeys, _ = strconv.Atoi(mk)
+	}
+	after := q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		after = token
+	}
+	var names []string
+	for name := range s.objects {
+		if strings.HasPrefix(name, q.Get("prefix")) && name > after {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	result := listResult{Name: s.bucket, MaxKeys: maxKeys}
+	if len(names) > maxKeys {
+		names = names[:maxKeys]
+		result.IsTruncated = true
+		result.NextContinuationToken = names[maxKeys-1]
+	}
+	result.KeyCount = len(names)
+	for _, name := range names {
+		result.Contents = append(result.Contents, listContent{Key: name, Size: len(s.objects[name])})
+	}
+	s.writeXML(w, result)
+}
+
+func (s *fakeS3) numObjects() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.objects)
+}
+
+func newTestStore(t *testing.T, prefix string) (*S3, *fakeS3, bool) {
+	fake := &fakeS3{bucket: "dvidtest", objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	config := dvid.NewConfig()
+	config.SetAll(map[string]interface{}{
+		"engine":      "s3",
+		"bucket":      "dvidtest",
+		"endpoint":    server.URL,
+		"accesskey":   "testkey",
+		"secretkey":   "testsecret",
+		"prefix":      prefix,
+		"maxrequests": int64(8),
+	})
+	store, created, err := storage.NewStore(dvid.StoreConfig{Config: config, Engine: "s3"})
+	if err != nil {
+		t.Fatalf("unable to create s3 store: %v\n", err)
+	}
+	db, ok := store.(*S3)
+	if !ok {
+		t.Fatalf("s3 engine returned store of type %T\n", store)
+	}
+	return db, fake, created
+}
+
+// Satisfies dvid.Data interface
+type testData struct {
+	instanceID dvid.InstanceID
+}
+
+func (d *testData) DataName() dvid.InstanceName            { return "s3test" }
+func (d *testData) InstanceID() dvid.InstanceID            { return d.instanceID }
+func (d *testData) RootUUID() dvid.UUID                    { return "01" }
+func (d *testData) DAGRootUUID() (dvid.UUID, error)        { return "01", nil }
+func (d *testData) RootVersionID() (dvid.VersionID, error) { return 1, nil }
+func (d *testData) DataUUID() dvid.UUID                    { return "02" }
+func (d *testData) SetInstanceID(id dvid.InstanceID)       { d.instanceID = id }
+func (d *testData) SetDataUUID(uuid dvid.UUID)             {}
+func (d *testData) SetRootUUID(uuid dvid.UUID)             {}
+func (d *testData) SetName(name dvid.InstanceName)         {}
+func (d *testData) SetSync(syncs dvid.UUIDSet)             {}
+func (d *testData) SetTags(tags map[string]string)         {}
+func (d *testData) Versioned() bool                        { return true }
+func (d *testData) TypeName() dvid.TypeString              { return "testType" }
+func (d *testData) TypeURL() dvid.URLString                { return "foo.baz.com/go/testData" }
+func (d *testData) TypeVersion() string                    { return "1.0" }
+func (d *testData) Tags() map[string]string                { return nil }
+func (d *testData) NewMutationID() uint64                  { return 0 }
+func (d *testData) KVStore() (dvid.Store, error)           { return nil, nil }
+func (d *testData) SetKVStore(kvStore dvid.Store)          {}
+func (d *testData) SetLogStore(logStore dvid.Store)        {}
+func (d *testData) IsDeleted() bool                        { return false }
+func (d *testData) SetDeleted(deleted bool)                {}
+func (d *testData) PersistMetadata() error                 { return nil }
+
+// testCtx is a versioned context where each version is the child of the previous one.
+type testCtx struct {
+	*storage.DataContext
+}
+
+func newTestCtx(instanceID dvid.InstanceID, v dvid.VersionID) *testCtx {
+	return &testCtx{storage.NewDataContext(&testData{instanceID: instanceID}, v)}
+}
+
+func (ctx *testCtx) Versioned() bool                     { return true }
+func (ctx *testCtx) Head() bool                          { return true }
+func (ctx *testCtx) MasterVersion(v dvid.VersionID) bool { return true }
+func (ctx *testCtx) NumVersions() int32                  { return int32(ctx.VersionID()) }
+
+func (ctx *testCtx) VersionedKeyValue(values []*storage.KeyValue) (*storage.KeyValue, error) {
+	var best *storage.KeyValue
+	var bestV dvid.VersionID
+	for _, kv := range values {
+		v, err := ctx.VersionFromKey(kv.K)
+		if err != nil {
+			return nil, err
+		}
+		if v > ctx.VersionID() || (best != nil && v < bestV) {
+			continue
+		}
+		if v == bestV && best != nil && !kv.K.IsTombstone() {
+			continue // tombstone takes precedence within a version
+		}
+		best, bestV = kv, v
+	}
+	if best == nil || best.K.IsTombstone() {
+		return nil, nil
+	}
+	return best, nil
+}
+
+func (ctx *testCtx) GetBestKeyVersion(keys []storage.Key) (storage.Key, error) {
+	values := make([]*storage.KeyValue, len(keys))
+	for i, k := range keys {
+		values[i] = &storage.KeyValue{K: k}
+	}
+	kv, err := ctx.VersionedKeyValue(values)
+	if kv == nil {
+		return nil, err
+	}
+	return kv.K, err
+}
+
+func testTKey(i int) storage.TKey {
+	return storage.NewTKey(17, []byte(fmt.Sprintf("key-%05d", i)))
+}
+
+func testValue(i int) []byte {
+	return []byte(fmt.Sprintf("value for key %d", i))
+}
+
+func TestS3Interfaces(t *testing.T) {
+	eng := storage.GetEngine("s3")
+	if eng == nil {
+		t.Fatalf("Init does not register 's3' engine.\n")
+	}
+	var store dvid.Store = new(S3)
+	if _, ok := store.(storage.OrderedKeyValueDB); !ok {
+		t.Errorf("S3 should implement storage.OrderedKeyValueDB\n")
+	}
+	if _, ok := store.(storage.KeyValueBatcher); !ok {
+		t.Errorf("S3 should implement storage.KeyValueBatcher\n")
+	}
+	if _, ok := store.(storage.BlobStore); !ok {
+		t.Errorf("S3 should implement storage.BlobStore\n")
+	}
+	if _, ok := store.(storage.KeyValueIngestable); !ok {
+		t.Errorf("S3 should implement storage.KeyValueIngestable\n")
+	}
+}
+
+func TestS3Config(t *testing.T) {
+	config := dvid.NewConfig()
+	config.SetAll(map[string]interface{}{"endpoint": "http://localhost:9000"})
+	if _, err := parseConfig(dvid.StoreConfig{Config: config, Engine: "s3"}); err == nil {
+		t.Errorf("expected error for s3 config without bucket\n")
+	}
+	config.SetAll(map[string]interface{}{"bucket": "mybucket", "endpoint": "http://localhost:9000", "maxrequests": "many"})
+	if _, err := parseConfig(dvid.StoreConfig{Config: config, Engine: "s3"}); err == nil {
+		t.Errorf("expected error for non-integer maxrequests\n")
+	}
+	config.SetAll(map[string]interface{}{"bucket": "mybucket", "endpoint": "http://localhost:9000"})
+	db, err := parseConfig(dvid.StoreConfig{Config: config, Engine: "s3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.pathStyle || db.region != defaultRegion || db.maxRequests != DefaultMaxRequests {
+		t.Errorf("bad defaults for s3 config: %v\n", db)
+	}
+	config.SetAll(map[string]interface{}{"bucket": "otherbucket"})
+	if db.Equal(dvid.StoreConfig{Config: config, Engine: "s3"}) {
+		t.Errorf("expected s3 stores with different buckets to differ\n")
+	}
+}
+
+func TestS3Unversioned(t *testing.T) {
+	db, fake, created := newTestStore(t, "store1/")
+	if !created {
+		t.Errorf("expected new s3 store to be created\n")
+	}
+	ctx := storage.NewDataContext(&testData{instanceID: 3}, 1)
+
+	// more than one list page
+	const numKeys = 2100
+	batch := db.NewBatch(ctx)
+	for i := 0; i < numKeys; i++ {
+		batch.Put(testTKey(i), testValue(i))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{0, 999, 1000, numKeys - 1} {
+		v, err := db.Get(ctx, testTKey(i))
+		if err != nil || !bytes.Equal(v, testValue(i)) {
+			t.Fatalf("bad value for key %d: %q, %v\n", i, v, err)
+		}
+	}
+	if v, err := db.Get(ctx, testTKey(numKeys)); err != nil || v != nil {
+		t.Errorf("expected nil value for missing key, got %q, %v\n", v, err)
+	}
+	if found, err := db.Exists(ctx, testTKey(5)); err != nil || !found {
+		t.Errorf("expected key 5 to exist: %v\n", err)
+	}
+
+	kvs, err := db.GetRange(ctx, testTKey(990), testTKey(1009))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 20 {
+		t.Fatalf("expected 20 key-value pairs in range, got %d\n", len(kvs))
+	}
+	for i, kv := range kvs {
+		if !bytes.Equal(kv.K, testTKey(990+i)) || !bytes.Equal(kv.V, testValue(990+i)) {
+			t.Fatalf("bad key-value %d in range: %v\n", i, kv)
+		}
+	}
+	tkeys, err := db.KeysInRange(ctx, testTKey(0), testTKey(numKeys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tkeys) != numKeys {
+		t.Errorf("expected %d keys in range, got %d\n", numKeys, len(tkeys))
+	}
+
+	if err := db.DeleteRange(ctx, testTKey(10), testTKey(19)); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := db.Exists(ctx, testTKey(15)); err != nil || found {
+		t.Errorf("expected key 15 to be deleted: %v\n", err)
+	}
+
+	// raw range over the data instance key space should see all remaining pairs.
+	minKey, maxKey := ctx.KeyRange()
+	ch := make(chan *storage.KeyValue)
+	var numKV int
+	go func() {
+		if err := db.RawRangeQuery(minKey, maxKey, false, ch, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	for kv := range ch {
+		if kv == nil {
+			break
+		}
+		numKV++
+	}
+	if numKV != numKeys-10 {
+		t.Errorf("expected %d key-value pairs from raw range query, got %d\n", numKeys-10, numKV)
+	}
+
+	ref, err := db.PutBlob([]byte("blob data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob, err := db.GetBlob(ref); err != nil || string(blob) != "blob data" {
+		t.Errorf("bad blob: %q, %v\n", blob, err)
+	}
+
+	if err := db.DeleteAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.numObjects(); n != 2 {
+		t.Errorf("expected only init and blob objects after delete all, got %d objects\n", n)
+	}
+}
+
+func TestS3Versioned(t *testing.T) {
+	db, _, _ := newTestStore(t, "")
+	ctx1 := newTestCtx(4, 1)
+	ctx2 := newTestCtx(4, 2)
+
+	for i := 0; i < 10; i++ {
+		if err := db.Put(ctx1, testTKey(i), testValue(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put(ctx2, testTKey(3), []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(ctx2, testTKey(4)); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := db.Get(ctx1, testTKey(3)); err != nil || !bytes.Equal(v, testValue(3)) {
+		t.Errorf("bad value for key 3 in version 1: %q, %v\n", v, err)
+	}
+	if v, err := db.Get(ctx2, testTKey(3)); err != nil || string(v) != "changed" {
+		t.Errorf("bad value for key 3 in version 2: %q, %v\n", v, err)
+	}
+	if found, err := db.Exists(ctx2, testTKey(4)); err != nil || found {
+		t.Errorf("expected key 4 to be deleted in version 2: %v\n", err)
+	}
+	if found, err := db.Exists(ctx1, testTKey(4)); err != nil || !found {
+		t.Errorf("expected key 4 to exist in version 1: %v\n", err)
+	}
+
+	kvs, err := db.GetRange(ctx2, testTKey(0), testTKey(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 9 {
+		t.Fatalf("expected 9 key-value pairs in version 2, got %d\n", len(kvs))
+	}
+	if !bytes.Equal(kvs[3].K, testTKey(3)) || string(kvs[3].V) != "changed" || !bytes.Equal(kvs[4].K, testTKey(5)) {
+		t.Errorf("bad key-value pairs in version 2 range: %v, %v\n", kvs[3], kvs[4])
+	}
+
+	// putting after a delete should remove the tombstone.
+	if err := db.Put(ctx2, testTKey(4), []byte("restored")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get(ctx2, testTKey(4)); err != nil || string(v) != "restored" {
+		t.Errorf("bad value for key 4 in version 2 after put: %q, %v\n", v, err)
+	}
+
+	if err := db.KeyValueIngest(ctx2, testTKey(20), []byte("ingested")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get(ctx2, testTKey(20)); err != nil || string(v) != "ingested" {
+		t.Errorf("bad ingested value: %q, %v\n", v, err)
+	}
+}
@@ -114,7 +114,7 @@ func GetEngine(name string) Engine {
 // GetTestableBackend returns a testable engine and backend.
 func GetTestableBackend(kvMap, logMap DataMap) (map[Alias]TestableEngine, *Backend, error) {
 	// any engine used for testing should be added below.
-	kvTestPreferences := []string{"badger", "basholeveldb", "filelog", "filestore"}
+	kvTestPreferences := []string{"badger", "basholeveldb", "golsm", "filelog", "filestore"}
 	var found bool
 	engines := make(map[Alias]TestableEngine)
 	backend := new(Backend)
@@ -44,6 +44,8 @@ type Store struct {
 	batchLocksMutex    sync.Mutex     // Synchronize access to the lock map and channel.
 
 	config dvid.StoreConfig
+
+	counters *storage.StoreCounters
 }
 
 func (s *Store) String() string {
@@ -150,6 +152,8 @@ func NewStore(config dvid.StoreConfig) (*Store, bool, error) {
 		return nil, false, fmt.Errorf(`Unable to check if Swift container "%s" exists: %s`, s.container, err)
 	}
 
+	s.counters = storage.NewStoreCounters(s.String())
+
 	// Check if we already have metadata.
 	var context storage.MetadataContext
 	from, to := context.KeyRange()
@@ -267,6 +271,7 @@ func (s *Store) objectExists(key storage.Key) (bool, error) {
 
 // Get returns a value given a key.
 func (s *Store) Get(context storage.Context, key storage.TKey) ([]byte, error) {
+	s.counters.CountGet()
 	var accessKey storage.Key
 	if context.Versioned() {
 		versionedContext, ok := context.(storage.VersionedCtx)
@@ -352,6 +357,7 @@ func (s *Store) Exists(context storage.Context, key storage.TKey) (bool, error)
 // RawPut is a low-level function that puts a key-value pair using full keys.
 // This can be used in conjunction with RawRangeQuery.
 func (s *Store) RawPut(key storage.Key, value []byte) error {
+	s.counters.CountPut()
 	delay := initialDelay
 
 	for {
@@ -533,6 +539,7 @@ func (s *Store) keyRange(context storage.Context, kStart, kEnd storage.TKey) (k
 // KeysInRange returns a range of type-specific key components spanning (kStart,
 // kEnd).
 func (s *Store) KeysInRange(context storage.Context, kStart, kEnd storage.TKey) (typeKeys []storage.TKey, e error) {
+	s.counters.CountRange()
 	// Get the keys and convert them to type keys.
 	keys, err := s.keyRange(context, kStart, kEnd)
 	if err != nil {
@@ -550,6 +557,7 @@ func (s *Store) KeysInRange(context storage.Context, kStart, kEnd storage.TKey)
 
 // SendKeysInRange sends a range of keys down a key channel.
 func (s *Store) SendKeysInRange(context storage.Context, kStart, kEnd storage.TKey, ch storage.KeyChan) error {
+	s.counters.CountRange()
 	keys, err := s.keyRange(context, kStart, kEnd)
 	if err != nil {
 		return err
@@ -564,6 +572,7 @@ func (s *Store) SendKeysInRange(context storage.Context, kStart, kEnd storage.TK
 
 // GetRange returns a range of values spanning (kStart, kEnd) keys.
 func (s *Store) GetRange(context storage.Context, kStart, kEnd storage.TKey) (keyValues []*storage.TKeyValue, e error) {
+	s.counters.CountRange()
 	keys, err := s.keyRange(context, kStart, kEnd)
 	if err != nil {
 		return nil, err
@@ -627,6 +636,7 @@ func (s *Store) GetRange(context storage.Context, kStart, kEnd storage.TKey) (ke
 // handlers, allowing chunk processing to be concurrent with key-value
 // sequential reads.
 func (s *Store) ProcessRange(context storage.Context, kStart, kEnd storage.TKey, op *storage.ChunkOp, f storage.ChunkFunc) error {
+	s.counters.CountRange()
 	keys, err := s.keyRange(context, kStart, kEnd)
 	if err != nil {
 		return err
@@ -657,6 +667,7 @@ func (s *Store) ProcessRange(context storage.Context, kStart, kEnd storage.TKey,
 
 // RawRangeQuery sends a range of full keys.
 func (s *Store) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out chan *storage.KeyValue, cancel <-chan struct{}) error {
+	s.counters.CountRange()
 	// Get the object names for this range.
 	keys, err := s.objectNames(kStart, kEnd)
 	if err != nil {